@@ -0,0 +1,229 @@
+// Package cidrset 提供 CIDR 前缀集合运算（IPv4 / IPv6）
+package cidrset
+
+import (
+	"fmt"
+	"math/big"
+	"net/netip"
+	"sort"
+	"strings"
+)
+
+// Parse 解析逗号分隔的前缀列表；裸地址视为主机路由（/32 或 /128）
+func Parse(s string) ([]netip.Prefix, error) {
+	var out []netip.Prefix
+	for _, x := range strings.Split(s, ",") {
+		x = strings.TrimSpace(x)
+		if x == "" {
+			continue
+		}
+		p, err := ParsePrefix(x)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, p)
+	}
+	return out, nil
+}
+
+// ParsePrefix 解析单个前缀并规整为网络地址（10.0.0.5/8 -> 10.0.0.0/8）
+func ParsePrefix(s string) (netip.Prefix, error) {
+	s = strings.TrimSpace(s)
+	if !strings.Contains(s, "/") {
+		a, err := netip.ParseAddr(s)
+		if err != nil {
+			return netip.Prefix{}, fmt.Errorf("invalid CIDR %q", s)
+		}
+		return netip.PrefixFrom(a.Unmap(), a.Unmap().BitLen()), nil
+	}
+	p, err := netip.ParsePrefix(s)
+	if err != nil {
+		return netip.Prefix{}, fmt.Errorf("invalid CIDR %q", s)
+	}
+	return netip.PrefixFrom(p.Addr().Unmap(), p.Bits()).Masked(), nil
+}
+
+// Strings 格式化为字符串列表
+func Strings(ps []netip.Prefix) []string {
+	out := make([]string, len(ps))
+	for i, p := range ps {
+		out[i] = p.String()
+	}
+	return out
+}
+
+// Subtract 返回 base 中去掉 exclude 后剩余的地址空间（最少前缀、有序、互不重叠）
+func Subtract(base, exclude []netip.Prefix) []netip.Prefix {
+	cur := append([]netip.Prefix(nil), base...)
+	for _, x := range exclude {
+		var next []netip.Prefix
+		for _, p := range cur {
+			next = append(next, subtractOne(p, x)...)
+		}
+		cur = next
+	}
+	return Union(cur)
+}
+
+// subtractOne 计算 p - x：x 在 p 内时把 p 逐级二分，保留不含 x 的一半
+func subtractOne(p, x netip.Prefix) []netip.Prefix {
+	if p.Addr().Is4() != x.Addr().Is4() || !p.Overlaps(x) {
+		return []netip.Prefix{p}
+	}
+	if x.Bits() <= p.Bits() {
+		// x 覆盖 p
+		return nil
+	}
+	var out []netip.Prefix
+	for p.Bits() < x.Bits() {
+		lo, hi := halves(p)
+		if lo.Contains(x.Addr()) {
+			out = append(out, hi)
+			p = lo
+		} else {
+			out = append(out, lo)
+			p = hi
+		}
+	}
+	return out
+}
+
+// Union 合并前缀集合：去重、去掉被覆盖的前缀，并把相邻区间聚合为最少的前缀
+func Union(ps []netip.Prefix) []netip.Prefix {
+	rs := make([]Range, 0, len(ps))
+	for _, p := range ps {
+		if p.IsValid() {
+			rs = append(rs, RangeOf(p))
+		}
+	}
+	sort.Slice(rs, func(i, j int) bool {
+		a, b := rs[i], rs[j]
+		if a.First.Is4() != b.First.Is4() {
+			return a.First.Is4()
+		}
+		return a.First.Less(b.First)
+	})
+
+	var merged []Range
+	for _, r := range rs {
+		if n := len(merged); n > 0 {
+			last := &merged[n-1]
+			// 同族且重叠或首尾相接
+			if last.First.Is4() == r.First.Is4() && (r.First.Compare(last.Last) <= 0 || last.Last.Next() == r.First) {
+				if r.Last.Compare(last.Last) > 0 {
+					last.Last = r.Last
+				}
+				continue
+			}
+		}
+		merged = append(merged, r)
+	}
+
+	var out []netip.Prefix
+	for _, r := range merged {
+		out = append(out, r.Prefixes()...)
+	}
+	return out
+}
+
+// ContainsPrefix 判断 p 是否完全落在集合 set 内
+func ContainsPrefix(set []netip.Prefix, p netip.Prefix) bool {
+	return len(Subtract([]netip.Prefix{p}, set)) == 0
+}
+
+// ContainsAddr 判断地址是否落在集合内
+func ContainsAddr(set []netip.Prefix, a netip.Addr) bool {
+	for _, p := range set {
+		if p.Contains(a) {
+			return true
+		}
+	}
+	return false
+}
+
+// Size 返回集合覆盖的地址数（先合并重叠部分）；IPv6 可能超出 uint64
+func Size(ps []netip.Prefix) *big.Int {
+	n := new(big.Int)
+	for _, p := range Union(ps) {
+		n.Add(n, new(big.Int).Lsh(big.NewInt(1), uint(p.Addr().BitLen()-p.Bits())))
+	}
+	return n
+}
+
+/* -------------------- 地址区间 -------------------- */
+
+// Range 是闭区间 [First, Last]，两端属于同一地址族
+type Range struct {
+	First netip.Addr
+	Last  netip.Addr
+}
+
+// RangeOf 返回前缀覆盖的地址区间
+func RangeOf(p netip.Prefix) Range {
+	p = p.Masked()
+	return Range{First: p.Addr(), Last: lastAddr(p)}
+}
+
+// ParseRange 解析 "a-b" 形式的地址区间
+func ParseRange(s string) (Range, error) {
+	lo, hi, ok := strings.Cut(s, "-")
+	if !ok {
+		return Range{}, fmt.Errorf("invalid range %q", s)
+	}
+	first, err1 := netip.ParseAddr(strings.TrimSpace(lo))
+	last, err2 := netip.ParseAddr(strings.TrimSpace(hi))
+	if err1 != nil || err2 != nil {
+		return Range{}, fmt.Errorf("invalid range %q", s)
+	}
+	first, last = first.Unmap(), last.Unmap()
+	if first.Is4() != last.Is4() || last.Less(first) {
+		return Range{}, fmt.Errorf("invalid range %q", s)
+	}
+	return Range{First: first, Last: last}, nil
+}
+
+// Prefixes 返回恰好覆盖区间的最少前缀（从低地址开始取能对齐的最大块）
+func (r Range) Prefixes() []netip.Prefix {
+	var out []netip.Prefix
+	cur := r.First
+	for {
+		bits := cur.BitLen()
+		// 逐步放大块，直到起点不再对齐或越过区间末尾
+		for bits > 0 {
+			p := netip.PrefixFrom(cur, bits-1)
+			if p.Masked().Addr() != cur || r.Last.Less(lastAddr(p)) {
+				break
+			}
+			bits--
+		}
+		p := netip.PrefixFrom(cur, bits)
+		out = append(out, p)
+		end := lastAddr(p)
+		if end == r.Last {
+			return out
+		}
+		cur = end.Next()
+	}
+}
+
+// lastAddr 返回前缀内的最后一个地址（主机位全置 1）
+func lastAddr(p netip.Prefix) netip.Addr {
+	b := p.Masked().Addr().AsSlice()
+	for i := p.Bits(); i < len(b)*8; i++ {
+		b[i/8] |= 0x80 >> (i % 8)
+	}
+	a, _ := netip.AddrFromSlice(b)
+	return a
+}
+
+// halves 把前缀拆成长度 +1 的两半
+func halves(p netip.Prefix) (lo, hi netip.Prefix) {
+	bits := p.Bits() + 1
+	lo = netip.PrefixFrom(p.Addr(), bits)
+	b := p.Addr().AsSlice()
+	idx := p.Bits() / 8
+	b[idx] |= 0x80 >> (p.Bits() % 8)
+	a, _ := netip.AddrFromSlice(b)
+	hi = netip.PrefixFrom(a, bits)
+	return lo, hi
+}
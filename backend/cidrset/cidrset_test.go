@@ -0,0 +1,92 @@
+package cidrset
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSubtract(t *testing.T) {
+	tests := []struct {
+		name          string
+		base, exclude string
+		want          []string
+	}{
+		{"nothing excluded", "10.0.0.0/24", "", []string{"10.0.0.0/24"}},
+		{"disjoint", "10.0.0.0/24", "192.168.0.0/16", []string{"10.0.0.0/24"}},
+		{"fully covered", "10.0.0.0/24", "10.0.0.0/8", nil},
+		{"single host", "10.0.0.0/30", "10.0.0.1", []string{"10.0.0.0/32", "10.0.0.2/31"}},
+		{"half of the default route", "0.0.0.0/0", "0.0.0.0/1", []string{"128.0.0.0/1"}},
+		{
+			"first quarter minus 10/8",
+			"0.0.0.0/2",
+			"10.0.0.0/8",
+			[]string{"0.0.0.0/5", "8.0.0.0/7", "11.0.0.0/8", "12.0.0.0/6", "16.0.0.0/4", "32.0.0.0/3"},
+		},
+		{"families kept apart", "10.0.0.0/24, fd00::/64", "fd00::/65", []string{"10.0.0.0/24", "fd00::8000:0:0:0/65"}},
+		{"several excludes", "10.0.0.0/29", "10.0.0.0/31, 10.0.0.6/31", []string{"10.0.0.2/31", "10.0.0.4/31"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			base, _ := Parse(tt.base)
+			exclude, _ := Parse(tt.exclude)
+			got := Strings(Subtract(base, exclude))
+			if len(got) == 0 {
+				got = nil
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUnion(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want []string
+	}{
+		{"duplicates", "10.0.0.0/24, 10.0.0.0/24", []string{"10.0.0.0/24"}},
+		{"covered prefix dropped", "10.0.0.0/16, 10.0.5.0/24", []string{"10.0.0.0/16"}},
+		{"adjacent halves merge", "10.0.0.0/25, 10.0.0.128/25", []string{"10.0.0.0/24"}},
+		{"adjacent but unaligned", "10.0.0.128/25, 10.0.1.0/25", []string{"10.0.0.128/25", "10.0.1.0/25"}},
+		{"hosts merge", "10.0.0.4, 10.0.0.5, 10.0.0.6, 10.0.0.7", []string{"10.0.0.4/30"}},
+		{"v4 sorted before v6", "fd00::/64, 10.0.0.0/8", []string{"10.0.0.0/8", "fd00::/64"}},
+		{"host bits masked", "10.0.0.5/24", []string{"10.0.0.0/24"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			in, err := Parse(tt.in)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := Strings(Union(in)); !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseRange(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    []string
+		wantErr bool
+	}{
+		{in: "10.0.0.1-10.0.0.6", want: []string{"10.0.0.1/32", "10.0.0.2/31", "10.0.0.4/31", "10.0.0.6/32"}},
+		{in: "10.0.0.0-10.0.0.255", want: []string{"10.0.0.0/24"}},
+		{in: "10.0.0.9-10.0.0.1", wantErr: true},
+		{in: "10.0.0.1-fd00::1", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			r, err := ParseRange(tt.in)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && !reflect.DeepEqual(Strings(r.Prefixes()), tt.want) {
+				t.Fatalf("got %v, want %v", Strings(r.Prefixes()), tt.want)
+			}
+		})
+	}
+}
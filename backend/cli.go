@@ -0,0 +1,304 @@
+package main
+
+import (
+	"backend/config"
+	"backend/database"
+	"backend/keystore"
+	"backend/services"
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"time"
+)
+
+const usage = `usage: backend [command]
+
+commands:
+  (none)        start the API server
+  genkey        print a new base64 master key for WG_MASTER_KEY
+  rotate-keys   re-encrypt all stored private keys with the current master key
+                (put the old key into WG_MASTER_KEY_PREVIOUS)
+  backup [-o file] [-passphrase p]
+                write a consistent backup archive (default: stdout)
+  restore [-passphrase p] file
+                validate and restore a backup archive, then re-apply interfaces
+  state export [-format yaml|json] [-o file]
+                print interfaces and peers as a declarative document
+  state plan file
+                show the changes needed to reach the document
+  state apply file
+                apply the document in one transaction and re-apply interfaces
+  import [-name n] [-policy skip|merge|overwrite] [-dry-run] file.conf...
+                import wg-quick configs; existing interfaces/peers follow -policy`
+
+func runCommand(cfg *config.Config, args []string) error {
+	switch args[0] {
+	case "genkey":
+		k, err := keystore.GenerateKey()
+		if err != nil {
+			return err
+		}
+		fmt.Println(k)
+		return nil
+
+	case "rotate-keys":
+		db, err := database.Initialize(cfg.DatabaseURL)
+		if err != nil {
+			return err
+		}
+		defer db.Close()
+		store, keys, err := openStore(db, cfg)
+		if err != nil {
+			return err
+		}
+		if keys == nil {
+			return fmt.Errorf("rotate-keys: WG_MASTER_KEY or WG_MASTER_KEY_FILE is required")
+		}
+		n, err := store.RewrapSecrets(context.Background(), true)
+		if err != nil {
+			return err
+		}
+		log.Printf("Re-encrypted %d secret(s) with master key %s", n, keys.CurrentID())
+		return nil
+
+	case "backup":
+		fs := flag.NewFlagSet("backup", flag.ContinueOnError)
+		out := fs.String("o", "", "output file (default stdout)")
+		pass := fs.String("passphrase", cfg.BackupPassphrase, "encrypt the archive with this passphrase")
+		if err := fs.Parse(args[1:]); err != nil {
+			return err
+		}
+		backups, closeDB, err := openBackupService(cfg)
+		if err != nil {
+			return err
+		}
+		defer closeDB()
+
+		w := io.Writer(os.Stdout)
+		if *out != "" {
+			f, err := os.OpenFile(*out, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o600)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			w = f
+		}
+		m, err := backups.CreateBackup(context.Background(), w, *pass)
+		if err != nil {
+			return err
+		}
+		log.Printf("Backup written: %d interface(s), db sha256 %s", len(m.Interfaces), m.DBSHA256)
+		for _, warn := range m.Warnings {
+			log.Printf("Warning: %s", warn)
+		}
+		return nil
+
+	case "restore":
+		fs := flag.NewFlagSet("restore", flag.ContinueOnError)
+		pass := fs.String("passphrase", cfg.BackupPassphrase, "passphrase of an encrypted archive")
+		if err := fs.Parse(args[1:]); err != nil {
+			return err
+		}
+		if fs.NArg() != 1 {
+			return fmt.Errorf("restore: archive file is required\n%s", usage)
+		}
+		f, err := os.Open(fs.Arg(0))
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		backups, closeDB, err := openBackupService(cfg)
+		if err != nil {
+			return err
+		}
+		defer closeDB()
+
+		res, err := backups.Restore(context.Background(), f, *pass)
+		if err != nil {
+			return err
+		}
+		log.Printf("Restored backup from %s; stopped %v, re-applied %v",
+			res.Manifest.CreatedAt.Format(time.RFC3339), res.Stopped, res.Reapplied)
+		if res.SafetyCopy != "" {
+			log.Printf("Previous state saved as %s", res.SafetyCopy)
+		}
+		for _, e := range res.Errors {
+			log.Printf("Warning: %s", e)
+		}
+		return nil
+
+	case "state":
+		return runStateCommand(cfg, args[1:])
+
+	case "import":
+		fs := flag.NewFlagSet("import", flag.ContinueOnError)
+		name := fs.String("name", "", "interface name (default: file name)")
+		policy := fs.String("policy", services.ImportSkip, "skip, merge or overwrite existing interfaces and peers")
+		dryRun := fs.Bool("dry-run", false, "show what would change without writing")
+		if err := fs.Parse(args[1:]); err != nil {
+			return err
+		}
+		if fs.NArg() == 0 {
+			return fmt.Errorf("import: config file is required\n%s", usage)
+		}
+		if *name != "" && fs.NArg() > 1 {
+			return fmt.Errorf("import: -name can only be used with a single file")
+		}
+		db, err := database.Initialize(cfg.DatabaseURL)
+		if err != nil {
+			return err
+		}
+		defer db.Close()
+		store, _, err := openStore(db, cfg)
+		if err != nil {
+			return err
+		}
+		importer := services.NewImportService(store, newWireGuardService(store, cfg), cfg.WGConfDir)
+		for _, path := range fs.Args() {
+			rep, err := importer.ImportFile(context.Background(), path, services.ImportOptions{
+				Name: *name, Policy: *policy, DryRun: *dryRun,
+			})
+			if err != nil {
+				return fmt.Errorf("%s: %w", path, err)
+			}
+			printImportReport(rep)
+		}
+		return nil
+
+	case "help", "-h", "--help":
+		fmt.Println(usage)
+		return nil
+	}
+	return fmt.Errorf("unknown command %q\n%s", args[0], usage)
+}
+
+func openBackupService(cfg *config.Config) (*services.BackupService, func(), error) {
+	db, err := database.Initialize(cfg.DatabaseURL)
+	if err != nil {
+		return nil, nil, err
+	}
+	store, keys, err := openStore(db, cfg)
+	if err != nil {
+		db.Close()
+		return nil, nil, err
+	}
+	wg := newWireGuardService(store, cfg)
+	return services.NewBackupService(db, store, keys, wg, cfg.BackupDir), func() { db.Close() }, nil
+}
+
+func runStateCommand(cfg *config.Config, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("state: subcommand required (export, plan, apply)\n%s", usage)
+	}
+	db, err := database.Initialize(cfg.DatabaseURL)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	store, _, err := openStore(db, cfg)
+	if err != nil {
+		return err
+	}
+	state := services.NewStateService(store, newWireGuardService(store, cfg))
+	ctx := context.Background()
+
+	switch args[0] {
+	case "export":
+		fs := flag.NewFlagSet("state export", flag.ContinueOnError)
+		format := fs.String("format", "yaml", "yaml or json")
+		out := fs.String("o", "", "output file (default stdout)")
+		if err := fs.Parse(args[1:]); err != nil {
+			return err
+		}
+		doc, err := state.Export(ctx)
+		if err != nil {
+			return err
+		}
+		w := io.Writer(os.Stdout)
+		if *out != "" {
+			f, err := os.Create(*out)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			w = f
+		}
+		return services.EncodeStateDocument(w, doc, *format)
+
+	case "plan", "apply":
+		if len(args) != 2 {
+			return fmt.Errorf("state %s: document file is required\n%s", args[0], usage)
+		}
+		f, err := os.Open(args[1])
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		doc, err := services.ParseStateDocument(f)
+		if err != nil {
+			return err
+		}
+		var plan *services.StatePlan
+		if args[0] == "plan" {
+			plan, err = state.Plan(ctx, doc)
+		} else {
+			plan, err = state.Apply(ctx, doc)
+		}
+		if err != nil {
+			return err
+		}
+		printPlan(plan)
+		return nil
+	}
+	return fmt.Errorf("state: unknown subcommand %q\n%s", args[0], usage)
+}
+
+func printPlan(plan *services.StatePlan) {
+	for _, c := range plan.Changes {
+		target := c.Interface
+		if c.Kind == "peer" {
+			target += "/" + c.Name
+		}
+		line := fmt.Sprintf("  %-6s %-9s %s", c.Action, c.Kind, target)
+		if len(c.Fields) > 0 {
+			line += " (" + strings.Join(c.Fields, ", ") + ")"
+		}
+		fmt.Println(line)
+	}
+	fmt.Printf("%d to create, %d to update, %d to delete\n", plan.Create, plan.Update, plan.Delete)
+	for _, w := range plan.Warnings {
+		fmt.Println("warning:", w)
+	}
+	for _, name := range plan.Applied {
+		fmt.Println("applied:", name)
+	}
+	for _, e := range plan.Errors {
+		fmt.Println("error:", e)
+	}
+}
+
+func printImportReport(rep *services.ImportReport) {
+	prefix := ""
+	if rep.DryRun {
+		prefix = "(dry run) "
+	}
+	line := fmt.Sprintf("%sinterface %s: %s", prefix, rep.Interface, rep.Action)
+	if len(rep.Fields) > 0 {
+		line += " (" + strings.Join(rep.Fields, ", ") + ")"
+	}
+	fmt.Println(line)
+	for _, p := range rep.Peers {
+		line := fmt.Sprintf("  %-9s peer %s %s", p.Action, p.Name, p.IP)
+		if len(p.Fields) > 0 {
+			line += " (" + strings.Join(p.Fields, ", ") + ")"
+		}
+		fmt.Println(line)
+	}
+	for _, w := range rep.Warnings {
+		fmt.Println("warning:", w)
+	}
+}
@@ -2,12 +2,61 @@ package config
 
 import (
 	"os"
+	"strconv"
+	"time"
 )
 
 type Config struct {
 	DatabaseURL string
 	JWTSecret   string
 	Port        string
+
+	// 私钥落库加密的主密钥（base64 32 字节），二选一；旧密钥逗号分隔，仅用于轮换时解密
+	MasterKey          string
+	MasterKeyFile      string
+	PreviousMasterKeys string
+
+	// wg-quick 配置目录；SyncOnBoot 为 true 时启动时导入其中的 *.conf（只新增，不覆盖），
+	// WriteConf 为 true 时每次变更后把 <name>.conf 写回该目录
+	WGConfDir  string
+	SyncOnBoot bool
+	WriteConf  bool
+
+	// 备份：目录为空则不做定时备份；间隔为 0 关闭定时；口令非空时归档加密
+	BackupDir        string
+	BackupInterval   time.Duration
+	BackupRetention  int
+	BackupPassphrase string
+
+	// 释放的隧道地址在隔离期内不会被自动分配给新 peer；0 关闭
+	IPQuarantine time.Duration
+	// IPv6 隧道地址在网段内随机分配（false 时与 IPv4 一样顺序分配）
+	RandomIPv6 bool
+	// 创建/修改接口时检查网段是否与主机路由重叠（读取 ip route）；接口之间的重叠始终检查。
+	// 默认关闭，避免升级后与已有路由重叠的接口无法修改；设置 WG_CHECK_HOST_ROUTES=true 开启
+	CheckHostRoutes bool
+	// 用 nftables 管理接口的 NAT/转发规则（独占 inet wg_manager 表）。默认关闭，
+	// 避免接管自行维护防火墙的主机；设置 WG_MANAGE_FIREWALL=true 开启。
+	// 注意：管理表 forward 链的 accept 只在本表生效，其他表（docker/ufw 设置的 iptables FORWARD DROP 等）
+	// 仍会丢弃转发流量，需要在那里另行放行 wg 接口；启动时检测到此类策略会记录警告
+	ManageFirewall bool
+	// 不执行接口的 PreUp/PostUp/PreDown/PostDown（仍可保存）；HookTimeout 为单条命令的超时
+	DisableHooks bool
+	HookTimeout  time.Duration
+	// 客户端模式接口的握手检查间隔（超时后重新解析远端 endpoint），0 关闭
+	ClientMonitorInterval time.Duration
+	// 以主机名配置 endpoint 的 peer 的重新解析间隔（动态 DNS），0 关闭
+	EndpointResolveInterval time.Duration
+	// peer 最近握手在该时间内视为在线；监控按间隔采样并记录上下线时段，间隔为 0 关闭
+	PeerOnlineThreshold time.Duration
+	PeerMonitorInterval time.Duration
+	// 超过该天数未连接的 peer 标记为 stale（0 关闭），StaleAutoDisable 为 true 时自动停用
+	PeerStaleDays        int
+	PeerStaleAutoDisable bool
+	// 已结束的 peer 在线时段的保留期
+	PeerSessionRetention time.Duration
+	// 告警规则的评估间隔，0 关闭定时评估（仍可手动触发）
+	AlertInterval time.Duration
 }
 
 func Load() *Config {
@@ -15,6 +64,39 @@ func Load() *Config {
 		DatabaseURL: getEnv("DATABASE_URL", "wireguard.db"),
 		JWTSecret:   getEnv("JWT_SECRET", "your-secret-key-change-this-in-production"),
 		Port:        getEnv("PORT", "8080"),
+
+		MasterKey:          getEnv("WG_MASTER_KEY", ""),
+		MasterKeyFile:      getEnv("WG_MASTER_KEY_FILE", ""),
+		PreviousMasterKeys: getEnv("WG_MASTER_KEY_PREVIOUS", ""),
+
+		WGConfDir:  getEnv("WG_CONF_DIR", "/etc/wireguard"),
+		SyncOnBoot: getEnvBool("WG_SYNC_ON_BOOT", false),
+		WriteConf:  getEnvBool("WG_WRITE_CONF", false),
+
+		BackupDir:        getEnv("BACKUP_DIR", ""),
+		BackupInterval:   getEnvDuration("BACKUP_INTERVAL", 0),
+		BackupRetention:  getEnvInt("BACKUP_RETENTION", 7),
+		BackupPassphrase: getEnv("BACKUP_PASSPHRASE", ""),
+
+		IPQuarantine: getEnvDuration("WG_IP_QUARANTINE", 24*time.Hour),
+		RandomIPv6:   getEnvBool("WG_IPV6_RANDOM", true),
+
+		CheckHostRoutes: getEnvBool("WG_CHECK_HOST_ROUTES", false),
+		ManageFirewall:  getEnvBool("WG_MANAGE_FIREWALL", false),
+
+		DisableHooks: getEnvBool("WG_DISABLE_HOOKS", false),
+		HookTimeout:  getEnvDuration("WG_HOOK_TIMEOUT", 30*time.Second),
+
+		ClientMonitorInterval:   getEnvDuration("WG_CLIENT_MONITOR_INTERVAL", 30*time.Second),
+		EndpointResolveInterval: getEnvDuration("WG_ENDPOINT_RERESOLVE_INTERVAL", time.Minute),
+
+		PeerOnlineThreshold:  getEnvDuration("WG_PEER_ONLINE_THRESHOLD", 180*time.Second),
+		PeerMonitorInterval:  getEnvDuration("WG_PEER_MONITOR_INTERVAL", 30*time.Second),
+		PeerStaleDays:        getEnvInt("WG_PEER_STALE_DAYS", 30),
+		PeerStaleAutoDisable: getEnvBool("WG_PEER_STALE_AUTO_DISABLE", false),
+		PeerSessionRetention: getEnvDuration("WG_PEER_SESSION_RETENTION", 90*24*time.Hour),
+
+		AlertInterval: getEnvDuration("WG_ALERT_INTERVAL", time.Minute),
 	}
 }
 
@@ -24,3 +106,24 @@ func getEnv(key, defaultValue string) string {
 	}
 	return defaultValue
 }
+
+func getEnvDuration(key string, defaultValue time.Duration) time.Duration {
+	if d, err := time.ParseDuration(os.Getenv(key)); err == nil {
+		return d
+	}
+	return defaultValue
+}
+
+func getEnvInt(key string, defaultValue int) int {
+	if n, err := strconv.Atoi(os.Getenv(key)); err == nil {
+		return n
+	}
+	return defaultValue
+}
+
+func getEnvBool(key string, defaultValue bool) bool {
+	if b, err := strconv.ParseBool(os.Getenv(key)); err == nil {
+		return b
+	}
+	return defaultValue
+}
@@ -0,0 +1,114 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+// 备份/恢复必须存在的表
+var requiredTables = []string{"users", "wireguard_interfaces", "wireguard_peers"}
+
+// Migrate 对已打开的库执行建表与列补齐（用于恢复旧版本备份后）
+func Migrate(db *sql.DB) error {
+	return createTables(db)
+}
+
+// BackupTo 使用 SQLite 在线备份 API 把运行中的库复制到 destPath，得到一致性快照
+func BackupTo(ctx context.Context, db *sql.DB, destPath string) error {
+	dest, err := sql.Open("sqlite3", destPath)
+	if err != nil {
+		return fmt.Errorf("open backup target: %w", err)
+	}
+	defer dest.Close()
+	return copyDatabase(ctx, dest, db)
+}
+
+// RestoreFrom 把 srcPath 的内容经在线备份 API 整库覆盖到 db（连接池保持可用）
+func RestoreFrom(ctx context.Context, db *sql.DB, srcPath string) error {
+	src, err := sql.Open("sqlite3", srcPath)
+	if err != nil {
+		return fmt.Errorf("open restore source: %w", err)
+	}
+	defer src.Close()
+	return copyDatabase(ctx, db, src)
+}
+
+// Verify 检查 path 是否为完整可用的管理库：完整性校验 + 必需表
+func Verify(ctx context.Context, path string) error {
+	db, err := sql.Open("sqlite3", "file:"+path+"?mode=ro")
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	var res string
+	if err := db.QueryRowContext(ctx, `PRAGMA integrity_check`).Scan(&res); err != nil {
+		return fmt.Errorf("integrity check: %w", err)
+	}
+	if res != "ok" {
+		return fmt.Errorf("integrity check failed: %s", res)
+	}
+	for _, t := range requiredTables {
+		var n int
+		if err := db.QueryRowContext(ctx,
+			`SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = ?`, t).Scan(&n); err != nil {
+			return err
+		}
+		if n == 0 {
+			return fmt.Errorf("missing table %s", t)
+		}
+	}
+	return nil
+}
+
+func copyDatabase(ctx context.Context, dst, src *sql.DB) error {
+	dstConn, err := dst.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer dstConn.Close()
+	srcConn, err := src.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer srcConn.Close()
+
+	return dstConn.Raw(func(d any) error {
+		return srcConn.Raw(func(s any) error {
+			dc, ok := d.(*sqlite3.SQLiteConn)
+			if !ok {
+				return fmt.Errorf("backup requires sqlite3 driver")
+			}
+			sc, ok := s.(*sqlite3.SQLiteConn)
+			if !ok {
+				return fmt.Errorf("backup requires sqlite3 driver")
+			}
+			b, err := dc.Backup("main", sc, "main")
+			if err != nil {
+				return fmt.Errorf("start backup: %w", err)
+			}
+			// 分批拷贝页；BUSY/LOCKED 时稍后重试，期间其他连接仍可读写
+			for {
+				done, err := b.Step(256)
+				if err != nil {
+					_ = b.Finish()
+					return fmt.Errorf("backup step: %w", err)
+				}
+				if done {
+					break
+				}
+				select {
+				case <-ctx.Done():
+					_ = b.Finish()
+					return ctx.Err()
+				case <-time.After(5 * time.Millisecond):
+				}
+			}
+			return b.Finish()
+		})
+	})
+}
@@ -1,21 +1,18 @@
 package database
 
 import (
-	"bufio"
 	"context"
 	"database/sql"
 	"fmt"
 	"log"
 	"net"
-	"os"
-	"path/filepath"
 	"strings"
 
 	_ "github.com/mattn/go-sqlite3"
 )
 
 func Initialize(databaseURL string) (*sql.DB, error) {
-	db, err := sql.Open("sqlite3", databaseURL)
+	db, err := sql.Open("sqlite3", withForeignKeys(databaseURL))
 	if err != nil {
 		return nil, fmt.Errorf("failed to open database: %v", err)
 	}
@@ -32,131 +29,31 @@ func Initialize(databaseURL string) (*sql.DB, error) {
 		log.Printf("Warning: Could not create default user: %v", err)
 	}
 
-	// 读取当前服务器 WireGuard 信息并保存到数据库
-	if err := syncWireGuardFromSystem(db); err != nil {
-		log.Printf("Warning: Could not sync WireGuard info from system: %v", err)
-	}
-
 	log.Println("Database initialized successfully")
 	return db, nil
 }
 
-// 读取系统 WireGuard 信息并保存到数据库
-func syncWireGuardFromSystem(db *sql.DB) error {
-	// 读取 /etc/wireguard/*.conf 文件
-	confDir := "/etc/wireguard"
-	files, err := readDir(confDir)
-	if err != nil {
-		log.Printf("[syncWireGuardFromSystem] 无法读取 %s: %v", confDir, err)
-		return nil // 不阻塞初始化
-	}
-
-	for _, file := range files {
-		if !file.IsDir() && (len(file.Name()) > 5 && file.Name()[len(file.Name())-5:] == ".conf") {
-			path := confDir + "/" + file.Name()
-			if err := importWireGuardConf(db, path); err != nil {
-				log.Printf("[syncWireGuardFromSystem] 导入 %s 失败: %v", path, err)
-			}
-		}
-	}
-	return nil
-}
-
-// 读取目录内容
-func readDir(dirname string) ([]os.DirEntry, error) {
-	return os.ReadDir(dirname)
-}
-
-// 解析单个 WireGuard 配置文件并写入数据库
-func importWireGuardConf(db *sql.DB, path string) error {
-	f, err := os.Open(path)
-	if err != nil {
-		return err
-	}
-	defer f.Close()
-
-	scanner := bufio.NewScanner(f)
-	section := ""
-	iface := make(map[string]string)
-	var peers []map[string]string
-	peer := make(map[string]string)
-	for scanner.Scan() {
-		line := strings.TrimSpace(scanner.Text())
-		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";") {
-			continue
-		}
-		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
-			if section == "Peer" && len(peer) > 0 {
-				peers = append(peers, peer)
-				peer = make(map[string]string)
-			}
-			section = strings.Trim(line, "[]")
-			continue
-		}
-		kv := strings.SplitN(line, "=", 2)
-		if len(kv) != 2 {
-			continue
-		}
-		key := strings.TrimSpace(kv[0])
-		val := strings.TrimSpace(kv[1])
-		if section == "Interface" {
-			iface[key] = val
-		} else if section == "Peer" {
-			peer[key] = val
-		}
-	}
-	if section == "Peer" && len(peer) > 0 {
-		peers = append(peers, peer)
-	}
-
-	// 插入 interface
-	if iface["PrivateKey"] == "" || iface["Address"] == "" || iface["ListenPort"] == "" {
-		return nil // 跳过无效配置
+// withForeignKeys 通过 DSN 为连接池中的每个连接开启外键（PRAGMA 只对执行它的那个连接生效）；
+// DSN 已显式设置时保持原样
+func withForeignKeys(dsn string) string {
+	if strings.Contains(dsn, "_foreign_keys=") || strings.Contains(dsn, "_fk=") {
+		return dsn
 	}
-	name := strings.TrimSuffix(filepath.Base(path), ".conf")
-	// 检查是否已存在
-	var count int
-	_ = db.QueryRow("SELECT COUNT(*) FROM wireguard_interfaces WHERE name = ?", name).Scan(&count)
-	if count == 0 {
-		_, err = db.Exec(`INSERT INTO wireguard_interfaces (name, private_key, public_key, listen_port, address, status) VALUES (?, ?, '', ?, ?, 'inactive')`,
-			name, iface["PrivateKey"], iface["ListenPort"], iface["Address"])
-		if err != nil {
-			log.Printf("[importWireGuardConf] 插入interface失败: %v", err)
-		}
-	}
-	// 获取interface id
-	var ifaceID int
-	_ = db.QueryRow("SELECT id FROM wireguard_interfaces WHERE name = ?", name).Scan(&ifaceID)
-
-	// 插入 peers
-	for _, p := range peers {
-		if p["PublicKey"] == "" || p["AllowedIPs"] == "" {
-			continue
-		}
-		// 检查是否已存在
-		var peerCount int
-		_ = db.QueryRow("SELECT COUNT(*) FROM wireguard_peers WHERE interface_id = ? AND public_key = ?", ifaceID, p["PublicKey"]).Scan(&peerCount)
-		if peerCount == 0 {
-			_, err = db.Exec(`INSERT INTO wireguard_peers (interface_id, name, public_key, private_key, ip, allowed_ips, status) VALUES (?, ?, ?, '', '', ?, 'inactive')`,
-				ifaceID, p["PublicKey"], p["PublicKey"], p["AllowedIPs"])
-			if err != nil {
-				log.Printf("[importWireGuardConf] 插入peer失败: %v", err)
-			}
-		}
+	sep := "?"
+	if strings.Contains(dsn, "?") {
+		sep = "&"
 	}
-	return nil
+	return dsn + sep + "_foreign_keys=on"
 }
 
 func createTables(db *sql.DB) error {
-	// SQLite: 开启外键（其他数据库无影响）
-	_, _ = db.Exec(`PRAGMA foreign_keys = ON`)
-
 	// 1) 基础表（新库会直接带上 cidr/server_ip、endpoint、persistent_keepalive）
 	creates := []string{
 		`CREATE TABLE IF NOT EXISTS users (
 		   id INTEGER PRIMARY KEY AUTOINCREMENT,
 		   username TEXT UNIQUE NOT NULL,
 		   password_hash TEXT NOT NULL,
+		   role TEXT NOT NULL DEFAULT 'user',
 		   created_at DATETIME DEFAULT CURRENT_TIMESTAMP
 		)`,
 		`CREATE TABLE IF NOT EXISTS wireguard_interfaces (
@@ -174,6 +71,16 @@ func createTables(db *sql.DB) error {
 		  created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
 		  updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
 		)`,
+		`CREATE TABLE IF NOT EXISTS routing_profiles (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			name TEXT UNIQUE NOT NULL,
+			kind TEXT NOT NULL,          -- full / split / full_except_lan
+			routes TEXT DEFAULT '',
+			excluded TEXT DEFAULT '',
+			description TEXT DEFAULT '',
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		)`,
 		`CREATE TABLE IF NOT EXISTS wireguard_peers (
 			id INTEGER PRIMARY KEY AUTOINCREMENT,
 			interface_id INTEGER NOT NULL,
@@ -185,6 +92,9 @@ func createTables(db *sql.DB) error {
 			preshared_key TEXT,
 			endpoint TEXT DEFAULT '',
 			persistent_keepalive INTEGER DEFAULT 25,
+			client_allowed_ips TEXT DEFAULT '',   -- 客户端配置的 AllowedIPs
+			routing_profile_id INTEGER REFERENCES routing_profiles(id) ON DELETE SET NULL,
+			excluded_ips TEXT DEFAULT '',         -- 从客户端 AllowedIPs 中扣除的网段
 			status TEXT DEFAULT 'inactive',
 			last_handshake DATETIME,
 			bytes_received INTEGER DEFAULT 0,
@@ -193,6 +103,190 @@ func createTables(db *sql.DB) error {
 			updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
 			FOREIGN KEY (interface_id) REFERENCES wireguard_interfaces(id) ON DELETE CASCADE
 		)`,
+		// peer 的每个隧道地址一行（双栈 peer 两行），保证同一接口下每个地址各自唯一；
+		// wireguard_peers.ip 仍是对外的 "v4, v6" 字段，两者由仓储在同一事务中写入
+		`CREATE TABLE IF NOT EXISTS peer_addresses (
+			peer_id INTEGER NOT NULL REFERENCES wireguard_peers(id) ON DELETE CASCADE,
+			interface_id INTEGER NOT NULL,
+			addr TEXT NOT NULL,
+			PRIMARY KEY (interface_id, addr)
+		)`,
+		`CREATE TABLE IF NOT EXISTS ip_pools (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			interface_id INTEGER NOT NULL REFERENCES wireguard_interfaces(id) ON DELETE CASCADE,
+			name TEXT NOT NULL,
+			ranges TEXT NOT NULL,        -- 逗号分隔：CIDR 或 a-b 区间
+			description TEXT DEFAULT '',
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			UNIQUE (interface_id, name)
+		)`,
+		`CREATE TABLE IF NOT EXISTS ip_reservations (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			interface_id INTEGER NOT NULL REFERENCES wireguard_interfaces(id) ON DELETE CASCADE,
+			addresses TEXT NOT NULL,     -- 逗号分隔：地址、CIDR 或 a-b 区间
+			note TEXT DEFAULT '',
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		)`,
+		`CREATE TABLE IF NOT EXISTS ip_quarantine (
+			interface_id INTEGER NOT NULL REFERENCES wireguard_interfaces(id) ON DELETE CASCADE,
+			ip TEXT NOT NULL,
+			peer_name TEXT DEFAULT '',
+			released_at DATETIME NOT NULL,
+			until DATETIME NOT NULL,     -- 到期前不参与自动分配
+			PRIMARY KEY (interface_id, ip)
+		)`,
+		// 接口地址占用的版本号，由下方触发器维护；服务层据此判断缓存的空闲区间是否过期
+		`CREATE TABLE IF NOT EXISTS ipam_versions (
+			interface_id INTEGER PRIMARY KEY,
+			version INTEGER NOT NULL DEFAULT 0
+		)`,
+		// 空闲区间快照：分配缓存的持久化，version 与 ipam_versions 一致（且网段未变、隔离地址未到期）时
+		// 可直接加载，避免重启后读取全部已用地址；不一致时由服务层重建
+		`CREATE TABLE IF NOT EXISTS ipam_free_state (
+			interface_id INTEGER PRIMARY KEY REFERENCES wireguard_interfaces(id) ON DELETE CASCADE,
+			version INTEGER NOT NULL,
+			families TEXT NOT NULL,      -- 生成时的网段与服务端地址
+			expires DATETIME             -- 最早到期的隔离地址；NULL 表示没有
+		)`,
+		`CREATE TABLE IF NOT EXISTS ipam_free_spans (
+			interface_id INTEGER NOT NULL REFERENCES wireguard_interfaces(id) ON DELETE CASCADE,
+			family INTEGER NOT NULL,     -- 接口地址族的下标
+			first TEXT NOT NULL,
+			last TEXT NOT NULL,
+			PRIMARY KEY (interface_id, family, first)
+		)`,
+		`CREATE TABLE IF NOT EXISTS interface_gateways (
+			interface_id INTEGER PRIMARY KEY REFERENCES wireguard_interfaces(id) ON DELETE CASCADE,
+			masquerade INTEGER NOT NULL DEFAULT 0,
+			egress_interface TEXT DEFAULT '',  -- 空表示任意非本接口的出口
+			lan_forward TEXT NOT NULL DEFAULT 'allow',
+			lan_cidrs TEXT DEFAULT '',         -- 逗号分隔；空取私有网段
+			updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		)`,
+		`CREATE TABLE IF NOT EXISTS peer_groups (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			name TEXT UNIQUE NOT NULL,
+			description TEXT DEFAULT '',
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		)`,
+		`CREATE TABLE IF NOT EXISTS peer_group_members (
+			group_id INTEGER NOT NULL REFERENCES peer_groups(id) ON DELETE CASCADE,
+			peer_id INTEGER NOT NULL REFERENCES wireguard_peers(id) ON DELETE CASCADE,
+			PRIMARY KEY (group_id, peer_id)
+		)`,
+		`CREATE TABLE IF NOT EXISTS meshes (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			name TEXT UNIQUE NOT NULL,
+			network TEXT NOT NULL,
+			listen_port INTEGER NOT NULL DEFAULT 51820,
+			mtu INTEGER NOT NULL DEFAULT 1420,
+			persistent_keepalive INTEGER NOT NULL DEFAULT 25,
+			revision INTEGER NOT NULL DEFAULT 1,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		)`,
+		`CREATE TABLE IF NOT EXISTS mesh_members (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			mesh_id INTEGER NOT NULL REFERENCES meshes(id) ON DELETE CASCADE,
+			name TEXT NOT NULL,
+			endpoint TEXT NOT NULL,
+			ip TEXT NOT NULL,
+			listen_port INTEGER NOT NULL DEFAULT 0,
+			public_key TEXT NOT NULL,
+			private_key TEXT DEFAULT '',
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			UNIQUE (mesh_id, name),
+			UNIQUE (mesh_id, public_key)
+		)`,
+		`CREATE TABLE IF NOT EXISTS acl_rules (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			interface_id INTEGER NOT NULL REFERENCES wireguard_interfaces(id) ON DELETE CASCADE,
+			peer_id INTEGER REFERENCES wireguard_peers(id) ON DELETE CASCADE, -- NULL：接口下全部 peer
+			action TEXT NOT NULL,
+			destinations TEXT DEFAULT '',    -- 逗号分隔 CIDR；空表示任意
+			protocol TEXT NOT NULL DEFAULT 'any',
+			ports TEXT DEFAULT '',
+			priority INTEGER NOT NULL DEFAULT 0,
+			description TEXT DEFAULT '',
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		)`,
+		`CREATE TABLE IF NOT EXISTS interface_remotes (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			interface_id INTEGER NOT NULL UNIQUE REFERENCES wireguard_interfaces(id) ON DELETE CASCADE,
+			public_key TEXT NOT NULL,
+			preshared_key TEXT DEFAULT '',
+			endpoint TEXT NOT NULL,
+			allowed_ips TEXT NOT NULL DEFAULT '0.0.0.0/0, ::/0',
+			persistent_keepalive INTEGER NOT NULL DEFAULT 25,
+			route_table TEXT NOT NULL DEFAULT 'auto', -- auto / off / 路由表编号
+			fwmark INTEGER NOT NULL DEFAULT 0,
+			updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		)`,
+		`CREATE TABLE IF NOT EXISTS interface_events (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			interface_id INTEGER NOT NULL REFERENCES wireguard_interfaces(id) ON DELETE CASCADE,
+			kind TEXT NOT NULL,
+			message TEXT NOT NULL,
+			output TEXT DEFAULT '',
+			success INTEGER NOT NULL DEFAULT 1,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		)`,
+		`CREATE TABLE IF NOT EXISTS peer_sessions (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			peer_id INTEGER NOT NULL REFERENCES wireguard_peers(id) ON DELETE CASCADE,
+			interface_id INTEGER NOT NULL REFERENCES wireguard_interfaces(id) ON DELETE CASCADE,
+			started_at DATETIME NOT NULL,
+			ended_at DATETIME             -- NULL：仍在线
+		)`,
+		`CREATE TABLE IF NOT EXISTS alert_rules (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			name TEXT NOT NULL UNIQUE,
+			type TEXT NOT NULL,
+			enabled INTEGER NOT NULL DEFAULT 1,
+			severity TEXT NOT NULL DEFAULT 'warning',
+			threshold REAL NOT NULL DEFAULT 0,
+			duration TEXT DEFAULT '',
+			interface_id INTEGER REFERENCES wireguard_interfaces(id) ON DELETE CASCADE,
+			path TEXT DEFAULT '',
+			notifier_ids TEXT DEFAULT '',       -- 逗号分隔；为空发往全部启用的渠道
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		)`,
+		`CREATE TABLE IF NOT EXISTS alerts (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			rule_id INTEGER NOT NULL,            -- 规则删除后告警仍保留为历史
+			rule_name TEXT NOT NULL,
+			type TEXT NOT NULL,
+			severity TEXT NOT NULL,
+			alert_key TEXT NOT NULL,
+			subject TEXT NOT NULL,
+			message TEXT NOT NULL,
+			status TEXT NOT NULL,                -- firing / resolved
+			started_at DATETIME NOT NULL,
+			last_seen_at DATETIME NOT NULL,
+			resolved_at DATETIME,
+			notified_at DATETIME,
+			notify_error TEXT DEFAULT ''
+		)`,
+		`CREATE TABLE IF NOT EXISTS notifiers (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			name TEXT NOT NULL UNIQUE,
+			type TEXT NOT NULL,                  -- webhook / smtp / telegram
+			enabled INTEGER NOT NULL DEFAULT 1,
+			settings TEXT NOT NULL DEFAULT '{}', -- JSON 对象，按类型取值
+			secret TEXT,                         -- 签名密钥 / SMTP 密码 / bot token，加密存储
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		)`,
+		`CREATE TABLE IF NOT EXISTS rendered_configs (
+			name TEXT PRIMARY KEY,     -- 接口名，对应 <name>.conf
+			sha256 TEXT NOT NULL,      -- 最近一次写出内容的校验和
+			written_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		)`,
 		`CREATE TABLE IF NOT EXISTS devices (
 			id INTEGER PRIMARY KEY AUTOINCREMENT,
 			name TEXT NOT NULL,
@@ -252,28 +346,117 @@ func createTables(db *sql.DB) error {
 			}
 		}
 	}
+	// 老库没有角色：升级前的用户都拥有全部权限，统一回填为 admin
+	if !columnExists(db, "users", "role") {
+		ensure("users", "role", "TEXT NOT NULL DEFAULT 'user'")
+		if _, err := db.Exec(`UPDATE users SET role = 'admin'`); err != nil {
+			log.Printf("[createTables] backfill users.role failed: %v", err)
+		}
+	}
+
 	ensure("wireguard_interfaces", "dns", "TEXT DEFAULT ''")
 	ensure("wireguard_interfaces", "mtu", "INTEGER DEFAULT 1420")
 	ensure("wireguard_interfaces", "cidr", "TEXT")
 	ensure("wireguard_interfaces", "server_ip", "TEXT")
+	for _, col := range []string{"pre_up", "post_up", "pre_down", "post_down"} {
+		ensure("wireguard_interfaces", col, "TEXT DEFAULT ''") // 每行一条命令
+	}
+	ensure("wireguard_interfaces", "mode", "TEXT NOT NULL DEFAULT 'server'")
+	ensure("wireguard_interfaces", "endpoint", "TEXT DEFAULT ''")      // 客户端配置中的对外地址 host[:port]
+	ensure("wireguard_interfaces", "local_subnets", "TEXT DEFAULT ''") // 站点间互联的本端局域网
 
 	ensure("wireguard_peers", "endpoint", "TEXT DEFAULT ''")
 	ensure("wireguard_peers", "persistent_keepalive", "INTEGER DEFAULT 25")
-
-	// 3) 索引：同一接口下 IP 唯一 + 查询加速
+	ensure("wireguard_peers", "client_allowed_ips", "TEXT DEFAULT ''")
+	ensure("wireguard_peers", "routing_profile_id", "INTEGER REFERENCES routing_profiles(id) ON DELETE SET NULL")
+	ensure("wireguard_peers", "excluded_ips", "TEXT DEFAULT ''")
+	ensure("wireguard_peers", "disabled", "INTEGER NOT NULL DEFAULT 0")
+	ensure("wireguard_peers", "type", "TEXT NOT NULL DEFAULT 'client'")
+	ensure("wireguard_peers", "resolved_endpoint", "TEXT DEFAULT ''")
+	ensure("wireguard_peers", "routed_subnets", "TEXT DEFAULT ''")
+
+	ensure("interface_gateways", "acl_default", "TEXT NOT NULL DEFAULT 'allow'")
+	ensure("acl_rules", "group_id", "INTEGER REFERENCES peer_groups(id)")
+
+	// 3) 索引：同一接口下 IP 唯一（逐地址的唯一性见 peer_addresses）+ 查询加速
 	indexes := []string{
 		`CREATE UNIQUE INDEX IF NOT EXISTS idx_peer_interface_ip ON wireguard_peers(interface_id, ip)`,
+		`CREATE INDEX IF NOT EXISTS idx_peer_address_peer ON peer_addresses(peer_id)`,
 		`CREATE INDEX IF NOT EXISTS idx_peer_interface ON wireguard_peers(interface_id)`,
+		`CREATE INDEX IF NOT EXISTS idx_acl_interface ON acl_rules(interface_id)`,
+		`CREATE INDEX IF NOT EXISTS idx_group_member_peer ON peer_group_members(peer_id)`,
+		`CREATE INDEX IF NOT EXISTS idx_event_interface ON interface_events(interface_id, id)`,
+		`CREATE INDEX IF NOT EXISTS idx_mesh_member_mesh ON mesh_members(mesh_id)`,
+		`CREATE INDEX IF NOT EXISTS idx_peer_session_peer ON peer_sessions(peer_id, started_at)`,
+		`CREATE INDEX IF NOT EXISTS idx_alert_status ON alerts(status, id)`,
 	}
 	if err := execMany(db, indexes); err != nil {
 		return fmt.Errorf("create indexes: %w", err)
 	}
 
+	// 地址占用（peer 地址、地址池、保留与隔离地址）任何变化都递增 ipam_versions；
+	// 包括级联删除在内的所有写入路径都会经过这里
+	triggers := []string{
+		`CREATE TRIGGER IF NOT EXISTS trg_ipam_peer_ins AFTER INSERT ON wireguard_peers BEGIN
+			INSERT INTO ipam_versions (interface_id, version) VALUES (NEW.interface_id, 1) ON CONFLICT(interface_id) DO UPDATE SET version = version + 1;
+		END`,
+		`CREATE TRIGGER IF NOT EXISTS trg_ipam_peer_upd AFTER UPDATE OF ip, interface_id ON wireguard_peers BEGIN
+			INSERT INTO ipam_versions (interface_id, version) VALUES (OLD.interface_id, 1) ON CONFLICT(interface_id) DO UPDATE SET version = version + 1;
+			INSERT INTO ipam_versions (interface_id, version) VALUES (NEW.interface_id, 1) ON CONFLICT(interface_id) DO UPDATE SET version = version + 1;
+		END`,
+		`CREATE TRIGGER IF NOT EXISTS trg_ipam_peer_del AFTER DELETE ON wireguard_peers BEGIN
+			INSERT INTO ipam_versions (interface_id, version) VALUES (OLD.interface_id, 1) ON CONFLICT(interface_id) DO UPDATE SET version = version + 1;
+		END`,
+		`CREATE TRIGGER IF NOT EXISTS trg_ipam_pool_ins AFTER INSERT ON ip_pools BEGIN
+			INSERT INTO ipam_versions (interface_id, version) VALUES (NEW.interface_id, 1) ON CONFLICT(interface_id) DO UPDATE SET version = version + 1;
+		END`,
+		`CREATE TRIGGER IF NOT EXISTS trg_ipam_pool_upd AFTER UPDATE OF ranges, interface_id ON ip_pools BEGIN
+			INSERT INTO ipam_versions (interface_id, version) VALUES (OLD.interface_id, 1) ON CONFLICT(interface_id) DO UPDATE SET version = version + 1;
+			INSERT INTO ipam_versions (interface_id, version) VALUES (NEW.interface_id, 1) ON CONFLICT(interface_id) DO UPDATE SET version = version + 1;
+		END`,
+		`CREATE TRIGGER IF NOT EXISTS trg_ipam_pool_del AFTER DELETE ON ip_pools BEGIN
+			INSERT INTO ipam_versions (interface_id, version) VALUES (OLD.interface_id, 1) ON CONFLICT(interface_id) DO UPDATE SET version = version + 1;
+		END`,
+		`CREATE TRIGGER IF NOT EXISTS trg_ipam_reservation_ins AFTER INSERT ON ip_reservations BEGIN
+			INSERT INTO ipam_versions (interface_id, version) VALUES (NEW.interface_id, 1) ON CONFLICT(interface_id) DO UPDATE SET version = version + 1;
+		END`,
+		`CREATE TRIGGER IF NOT EXISTS trg_ipam_reservation_upd AFTER UPDATE OF addresses, interface_id ON ip_reservations BEGIN
+			INSERT INTO ipam_versions (interface_id, version) VALUES (OLD.interface_id, 1) ON CONFLICT(interface_id) DO UPDATE SET version = version + 1;
+			INSERT INTO ipam_versions (interface_id, version) VALUES (NEW.interface_id, 1) ON CONFLICT(interface_id) DO UPDATE SET version = version + 1;
+		END`,
+		`CREATE TRIGGER IF NOT EXISTS trg_ipam_reservation_del AFTER DELETE ON ip_reservations BEGIN
+			INSERT INTO ipam_versions (interface_id, version) VALUES (OLD.interface_id, 1) ON CONFLICT(interface_id) DO UPDATE SET version = version + 1;
+		END`,
+		`CREATE TRIGGER IF NOT EXISTS trg_ipam_quarantine_ins AFTER INSERT ON ip_quarantine BEGIN
+			INSERT INTO ipam_versions (interface_id, version) VALUES (NEW.interface_id, 1) ON CONFLICT(interface_id) DO UPDATE SET version = version + 1;
+		END`,
+		`CREATE TRIGGER IF NOT EXISTS trg_ipam_quarantine_upd AFTER UPDATE OF ip, until, interface_id ON ip_quarantine BEGIN
+			INSERT INTO ipam_versions (interface_id, version) VALUES (OLD.interface_id, 1) ON CONFLICT(interface_id) DO UPDATE SET version = version + 1;
+			INSERT INTO ipam_versions (interface_id, version) VALUES (NEW.interface_id, 1) ON CONFLICT(interface_id) DO UPDATE SET version = version + 1;
+		END`,
+		`CREATE TRIGGER IF NOT EXISTS trg_ipam_quarantine_del AFTER DELETE ON ip_quarantine BEGIN
+			INSERT INTO ipam_versions (interface_id, version) VALUES (OLD.interface_id, 1) ON CONFLICT(interface_id) DO UPDATE SET version = version + 1;
+		END`,
+	}
+	if err := execMany(db, triggers); err != nil {
+		return fmt.Errorf("create ipam triggers: %w", err)
+	}
+
 	// 4) 从 address 回填 cidr/server_ip（仅当为空时）
 	if err := migrateInterfaceCIDR(db); err != nil {
 		return fmt.Errorf("migrate interface cidr/server_ip: %w", err)
 	}
 
+	// 5) 服务端 AllowedIPs 中的默认路由移到客户端字段
+	if err := migratePeerDefaultRoutes(db); err != nil {
+		return fmt.Errorf("migrate peer default routes: %w", err)
+	}
+
+	// 6) 为还没有地址行的 peer（旧库或旧备份）回填 peer_addresses
+	if err := migratePeerAddresses(db); err != nil {
+		return fmt.Errorf("migrate peer addresses: %w", err)
+	}
+
 	return nil
 }
 
@@ -324,7 +507,7 @@ func createDefaultUser(db *sql.DB) error {
 	hashedPassword := "$2a$10$92IXUNpkjO0rOQ5byMi.Ye4oKoEa3Ro9llC/.og/at2.uheWG/igi" // bcrypt hash of "admin123"
 
 	_, err = db.Exec(
-		"INSERT INTO users (username, password_hash) VALUES (?, ?)",
+		"INSERT INTO users (username, password_hash, role) VALUES (?, ?, 'admin')",
 		"admin", hashedPassword,
 	)
 
@@ -404,3 +587,125 @@ func migrateInterfaceCIDR(db *sql.DB) error {
 
 	return tx.Commit()
 }
+
+// 老版本把 "0.0.0.0/0" 之类的客户端路由存进了 allowed_ips（服务端含义），
+// 导出时再悄悄改写；这里一次性迁移：默认路由移到 client_allowed_ips，服务端恢复为隧道 IP 的主机路由
+// peerHostRoutes 把 peer 的 ip 列（双栈时逗号分隔）转为主机路由：IPv4 用 /32，IPv6 用 /128
+func peerHostRoutes(ips string) []string {
+	var out []string
+	for _, x := range strings.Split(ips, ",") {
+		x = strings.TrimSpace(x)
+		if i := strings.IndexByte(x, '/'); i >= 0 {
+			x = x[:i]
+		}
+		ip := net.ParseIP(x)
+		if ip == nil {
+			continue
+		}
+		if ip.To4() != nil {
+			out = append(out, x+"/32")
+		} else {
+			out = append(out, x+"/128")
+		}
+	}
+	return out
+}
+
+func migratePeerDefaultRoutes(db *sql.DB) error {
+	rows, err := db.Query(`SELECT id, ip, allowed_ips, COALESCE(client_allowed_ips, '') FROM wireguard_peers
+		WHERE allowed_ips LIKE '%0.0.0.0/0%' OR allowed_ips LIKE '%::/0%'`)
+	if err != nil {
+		return err
+	}
+	type row struct {
+		id                    int
+		ip, allowed, clientIP string
+	}
+	var rs []row
+	for rows.Next() {
+		var r row
+		if err := rows.Scan(&r.id, &r.ip, &r.allowed, &r.clientIP); err != nil {
+			rows.Close()
+			return err
+		}
+		rs = append(rs, r)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, r := range rs {
+		var server, client []string
+		for _, x := range strings.Split(r.allowed, ",") {
+			x = strings.TrimSpace(x)
+			switch {
+			case x == "":
+			case x == "0.0.0.0/0" || x == "::/0":
+				client = append(client, x)
+			default:
+				server = append(server, x)
+			}
+		}
+		if len(client) == 0 {
+			continue // LIKE 只是粗筛
+		}
+		if len(server) == 0 {
+			server = peerHostRoutes(r.ip)
+		}
+		clientIPs := r.clientIP
+		if strings.TrimSpace(clientIPs) == "" {
+			clientIPs = strings.Join(client, ", ")
+		}
+		if _, err := db.Exec(`UPDATE wireguard_peers SET allowed_ips = ?, client_allowed_ips = ? WHERE id = ?`,
+			strings.Join(server, ", "), clientIPs, r.id); err != nil {
+			return err
+		}
+		log.Printf("[migrate] peer %d: moved default route from allowed_ips to client_allowed_ips", r.id)
+	}
+	return nil
+}
+
+// migratePeerAddresses 按 wireguard_peers.ip 回填 peer_addresses；
+// 旧数据中与其他 peer 重复的地址无法满足唯一约束，跳过并记录日志
+func migratePeerAddresses(db *sql.DB) error {
+	rows, err := db.Query(`SELECT id, interface_id, ip FROM wireguard_peers
+		WHERE ip <> '' AND id NOT IN (SELECT peer_id FROM peer_addresses)`)
+	if err != nil {
+		return err
+	}
+	type row struct {
+		id, interfaceID int
+		ip              string
+	}
+	var rs []row
+	for rows.Next() {
+		var r row
+		if err := rows.Scan(&r.id, &r.interfaceID, &r.ip); err != nil {
+			rows.Close()
+			return err
+		}
+		rs = append(rs, r)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, r := range rs {
+		for _, addr := range strings.Split(r.ip, ",") {
+			if addr = strings.TrimSpace(addr); addr == "" {
+				continue
+			}
+			res, err := db.Exec(`INSERT OR IGNORE INTO peer_addresses (peer_id, interface_id, addr) VALUES (?, ?, ?)`,
+				r.id, r.interfaceID, addr)
+			if err != nil {
+				return err
+			}
+			if n, _ := res.RowsAffected(); n == 0 {
+				log.Printf("[migrate] peer %d: address %s is already used by another peer on interface %d", r.id, addr, r.interfaceID)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,137 @@
+package handlers
+
+import (
+	"backend/models"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+func (h *WireGuardHandler) GetACLRules(c *gin.Context) {
+	id, ok := ipamParam(c, "id", "interface")
+	if !ok {
+		return
+	}
+
+	list, err := h.service.ListACLRules(c.Request.Context(), id)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Data:    list,
+	})
+}
+
+func (h *WireGuardHandler) CreateACLRule(c *gin.Context) {
+	id, ok := ipamParam(c, "id", "interface")
+	if !ok {
+		return
+	}
+	var req models.ACLRuleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Error:   "Invalid request format: " + err.Error(),
+		})
+		return
+	}
+
+	rule, err := h.service.SaveACLRule(c.Request.Context(), id, 0, &req)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, models.APIResponse{
+		Success: true,
+		Message: "ACL rule created successfully",
+		Data:    rule,
+	})
+}
+
+func (h *WireGuardHandler) UpdateACLRule(c *gin.Context) {
+	id, ok := ipamParam(c, "id", "interface")
+	if !ok {
+		return
+	}
+	ruleID, ok := ipamParam(c, "rule", "ACL rule")
+	if !ok {
+		return
+	}
+	var req models.ACLRuleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Error:   "Invalid request format: " + err.Error(),
+		})
+		return
+	}
+
+	rule, err := h.service.SaveACLRule(c.Request.Context(), id, ruleID, &req)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Message: "ACL rule updated successfully",
+		Data:    rule,
+	})
+}
+
+func (h *WireGuardHandler) DeleteACLRule(c *gin.Context) {
+	id, ok := ipamParam(c, "id", "interface")
+	if !ok {
+		return
+	}
+	ruleID, ok := ipamParam(c, "rule", "ACL rule")
+	if !ok {
+		return
+	}
+
+	if err := h.service.DeleteACLRule(c.Request.Context(), id, ruleID); err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Message: "ACL rule deleted successfully",
+	})
+}
+
+// TestACL 回答 peer 能否访问目标：?dst=host[:port]&port=22&proto=tcp|udp|icmp
+func (h *WireGuardHandler) TestACL(c *gin.Context) {
+	id, ok := ipamParam(c, "id", "peer")
+	if !ok {
+		return
+	}
+	port := 0
+	if v := c.Query("port"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, models.APIResponse{
+				Success: false,
+				Error:   "Invalid port",
+			})
+			return
+		}
+		port = n
+	}
+
+	d, err := h.service.TestACL(c.Request.Context(), id, c.Query("dst"), port, c.Query("proto"))
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Data:    d,
+	})
+}
@@ -0,0 +1,308 @@
+package handlers
+
+import (
+	"backend/models"
+	"backend/repository"
+	"backend/services"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+type AlertHandler struct {
+	service *services.AlertService
+}
+
+func NewAlertHandler(service *services.AlertService) *AlertHandler {
+	return &AlertHandler{service: service}
+}
+
+func redactNotifier(n *models.Notifier) {
+	n.Secret = ""
+}
+
+/* -------------------- 告警 -------------------- */
+
+// GetAlerts 返回告警历史（?status=firing|resolved、?type=、?rule_id=、?limit=，默认 100 条）
+func (h *AlertHandler) GetAlerts(c *gin.Context) {
+	f := repository.AlertFilter{Status: c.Query("status"), Type: c.Query("type")}
+	for key, dst := range map[string]*int{"rule_id": &f.RuleID, "limit": &f.Limit} {
+		if v := c.Query(key); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 0 {
+				c.JSON(http.StatusBadRequest, models.APIResponse{
+					Success: false,
+					Error:   "Invalid " + key,
+				})
+				return
+			}
+			*dst = n
+		}
+	}
+
+	list, err := h.service.ListAlerts(c.Request.Context(), f)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Data:    list,
+	})
+}
+
+// EvaluateAlerts 立即评估所有规则（不等待定时任务）
+func (h *AlertHandler) EvaluateAlerts(c *gin.Context) {
+	res, err := h.service.Evaluate(c.Request.Context())
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Data:    res,
+	})
+}
+
+/* -------------------- 规则 -------------------- */
+
+func (h *AlertHandler) GetAlertRules(c *gin.Context) {
+	list, err := h.service.ListRules(c.Request.Context())
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Data:    list,
+	})
+}
+
+func (h *AlertHandler) GetAlertRule(c *gin.Context) {
+	id, ok := ipamParam(c, "id", "alert rule")
+	if !ok {
+		return
+	}
+
+	ar, err := h.service.GetRule(c.Request.Context(), id)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Data:    ar,
+	})
+}
+
+func (h *AlertHandler) CreateAlertRule(c *gin.Context) {
+	var req models.AlertRuleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Error:   "Invalid request format: " + err.Error(),
+		})
+		return
+	}
+
+	ar, err := h.service.CreateRule(c.Request.Context(), req)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, models.APIResponse{
+		Success: true,
+		Message: "Alert rule created successfully",
+		Data:    ar,
+	})
+}
+
+func (h *AlertHandler) UpdateAlertRule(c *gin.Context) {
+	id, ok := ipamParam(c, "id", "alert rule")
+	if !ok {
+		return
+	}
+
+	var req models.AlertRuleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Error:   "Invalid request format: " + err.Error(),
+		})
+		return
+	}
+
+	ar, err := h.service.UpdateRule(c.Request.Context(), id, req)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Message: "Alert rule updated successfully",
+		Data:    ar,
+	})
+}
+
+func (h *AlertHandler) DeleteAlertRule(c *gin.Context) {
+	id, ok := ipamParam(c, "id", "alert rule")
+	if !ok {
+		return
+	}
+
+	if err := h.service.DeleteRule(c.Request.Context(), id); err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Message: "Alert rule deleted successfully",
+	})
+}
+
+/* -------------------- 通知渠道 -------------------- */
+
+func (h *AlertHandler) GetNotifiers(c *gin.Context) {
+	secrets, ok := includeSecrets(c)
+	if !ok {
+		return
+	}
+
+	list, err := h.service.ListNotifiers(c.Request.Context())
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	if !secrets {
+		for i := range list {
+			redactNotifier(&list[i])
+		}
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Data:    list,
+	})
+}
+
+func (h *AlertHandler) GetNotifier(c *gin.Context) {
+	id, ok := ipamParam(c, "id", "notifier")
+	if !ok {
+		return
+	}
+	secrets, ok := includeSecrets(c)
+	if !ok {
+		return
+	}
+
+	n, err := h.service.GetNotifier(c.Request.Context(), id)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	if !secrets {
+		redactNotifier(n)
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Data:    n,
+	})
+}
+
+func (h *AlertHandler) CreateNotifier(c *gin.Context) {
+	var req models.NotifierRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Error:   "Invalid request format: " + err.Error(),
+		})
+		return
+	}
+
+	n, err := h.service.CreateNotifier(c.Request.Context(), req)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	redactNotifier(n)
+
+	c.JSON(http.StatusCreated, models.APIResponse{
+		Success: true,
+		Message: "Notifier created successfully",
+		Data:    n,
+	})
+}
+
+// UpdateNotifier 更新通知渠道；请求中省略 secret 时保留原值
+func (h *AlertHandler) UpdateNotifier(c *gin.Context) {
+	id, ok := ipamParam(c, "id", "notifier")
+	if !ok {
+		return
+	}
+
+	var req models.NotifierRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Error:   "Invalid request format: " + err.Error(),
+		})
+		return
+	}
+
+	n, err := h.service.UpdateNotifier(c.Request.Context(), id, req)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	redactNotifier(n)
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Message: "Notifier updated successfully",
+		Data:    n,
+	})
+}
+
+func (h *AlertHandler) DeleteNotifier(c *gin.Context) {
+	id, ok := ipamParam(c, "id", "notifier")
+	if !ok {
+		return
+	}
+
+	if err := h.service.DeleteNotifier(c.Request.Context(), id); err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Message: "Notifier deleted successfully",
+	})
+}
+
+// TestNotifier 通过通知渠道发送一条测试消息；投递失败返回 502
+func (h *AlertHandler) TestNotifier(c *gin.Context) {
+	id, ok := ipamParam(c, "id", "notifier")
+	if !ok {
+		return
+	}
+
+	if err := h.service.TestNotifier(c.Request.Context(), id); err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Message: "Test notification sent",
+	})
+}
@@ -0,0 +1,94 @@
+package handlers
+
+import (
+	"backend/models"
+	"backend/services"
+	"bytes"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+type BackupHandler struct {
+	service *services.BackupService
+}
+
+func NewBackupHandler(service *services.BackupService) *BackupHandler {
+	return &BackupHandler{service: service}
+}
+
+type backupRequest struct {
+	Passphrase string `json:"passphrase"`
+}
+
+func (h *BackupHandler) CreateBackup(c *gin.Context) {
+	var req backupRequest
+	// 请求体可为空：不加密
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, models.APIResponse{
+				Success: false,
+				Error:   "Invalid request format: " + err.Error(),
+			})
+			return
+		}
+	}
+
+	// 先完整生成再输出，出错时仍能返回 JSON
+	var buf bytes.Buffer
+	if _, err := h.service.CreateBackup(c.Request.Context(), &buf, req.Passphrase); err != nil {
+		respondError(c, err)
+		return
+	}
+
+	name := "wg-manager-" + time.Now().UTC().Format("20060102-150405") + ".tar.gz"
+	if req.Passphrase != "" {
+		name += ".enc"
+	}
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%s", name))
+	c.Data(http.StatusOK, "application/octet-stream", buf.Bytes())
+}
+
+func (h *BackupHandler) Restore(c *gin.Context) {
+	file, err := c.FormFile("archive")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Error:   "Missing archive file",
+		})
+		return
+	}
+	f, err := file.Open()
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	defer f.Close()
+
+	res, err := h.service.Restore(c.Request.Context(), f, c.PostForm("passphrase"))
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Message: "Backup restored successfully",
+		Data:    res,
+	})
+}
+
+func (h *BackupHandler) ListBackups(c *gin.Context) {
+	list, err := h.service.ListBackups()
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Data:    list,
+	})
+}
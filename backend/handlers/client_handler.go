@@ -0,0 +1,82 @@
+package handlers
+
+import (
+	"backend/models"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetClientRemote 返回客户端模式接口的远端（预共享密钥需 include_secrets）
+func (h *WireGuardHandler) GetClientRemote(c *gin.Context) {
+	id, ok := ipamParam(c, "id", "interface")
+	if !ok {
+		return
+	}
+	secrets, ok := includeSecrets(c)
+	if !ok {
+		return
+	}
+
+	r, err := h.service.GetClientRemote(c.Request.Context(), id)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	if !secrets {
+		redactRemote(r)
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Data:    r,
+	})
+}
+
+// UpdateClientRemote 设置客户端模式接口的远端；接口运行中时立即重新下发
+func (h *WireGuardHandler) UpdateClientRemote(c *gin.Context) {
+	id, ok := ipamParam(c, "id", "interface")
+	if !ok {
+		return
+	}
+	var req models.ClientRemoteRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Error:   "Invalid request format: " + err.Error(),
+		})
+		return
+	}
+
+	r, err := h.service.SetClientRemote(c.Request.Context(), id, &req)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	redactRemote(r)
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Message: "Remote updated successfully",
+		Data:    r,
+	})
+}
+
+// GetClientStatus 返回客户端模式接口的握手健康与重连次数
+func (h *WireGuardHandler) GetClientStatus(c *gin.Context) {
+	id, ok := ipamParam(c, "id", "interface")
+	if !ok {
+		return
+	}
+
+	st, err := h.service.GetClientStatus(c.Request.Context(), id)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Data:    st,
+	})
+}
@@ -0,0 +1,65 @@
+package handlers
+
+import (
+	"backend/models"
+	"backend/services"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetConfFile 查看 <name>.conf 与当前配置是否一致（含 diff）
+func (h *WireGuardHandler) GetConfFile(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Error:   "Invalid interface ID",
+		})
+		return
+	}
+
+	st, err := h.service.ConfFileStatus(id)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Data:    st,
+	})
+}
+
+// WriteConfFile 立即写出 <name>.conf；?force=1 覆盖手工修改过的文件（旧文件保存为 .bak）
+func (h *WireGuardHandler) WriteConfFile(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Error:   "Invalid interface ID",
+		})
+		return
+	}
+	force, _ := strconv.ParseBool(c.Query("force"))
+
+	st, err := h.service.WriteConfFile(id, force)
+	if err != nil {
+		var drift *services.ConfDriftError
+		if errors.As(err, &drift) {
+			// 返回差异，便于确认后带 force 重试
+			respondErrorData(c, err, st)
+			return
+		}
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Message: "Config file written successfully",
+		Data:    st,
+	})
+}
@@ -0,0 +1,84 @@
+package handlers
+
+import (
+	"backend/models"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetGateway 返回接口的网关设置（NAT / LAN 转发）及其生成的 nftables 规则
+func (h *WireGuardHandler) GetGateway(c *gin.Context) {
+	id, ok := ipamParam(c, "id", "interface")
+	if !ok {
+		return
+	}
+
+	st, err := h.service.GetGateway(c.Request.Context(), id)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Data:    st,
+	})
+}
+
+// UpdateGateway 覆盖接口的网关设置；接口运行中时立即下发规则
+func (h *WireGuardHandler) UpdateGateway(c *gin.Context) {
+	id, ok := ipamParam(c, "id", "interface")
+	if !ok {
+		return
+	}
+	var req models.InterfaceGatewayRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Error:   "Invalid request format: " + err.Error(),
+		})
+		return
+	}
+
+	st, err := h.service.SaveGateway(c.Request.Context(), id, &req)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Message: "Gateway settings updated successfully",
+		Data:    st,
+	})
+}
+
+// GetFirewall 对比按 DB 生成的管理表脚本与内核中的实际规则
+func (h *WireGuardHandler) GetFirewall(c *gin.Context) {
+	st, err := h.service.GetFirewallStatus(c.Request.Context())
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Data:    st,
+	})
+}
+
+// SyncFirewall 重建管理表
+func (h *WireGuardHandler) SyncFirewall(c *gin.Context) {
+	st, err := h.service.SyncFirewall(c.Request.Context())
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Message: "Firewall rules reapplied",
+		Data:    st,
+	})
+}
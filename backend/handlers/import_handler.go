@@ -0,0 +1,106 @@
+package handlers
+
+import (
+	"backend/models"
+	"backend/services"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+type ImportHandler struct {
+	service *services.ImportService
+}
+
+func NewImportHandler(service *services.ImportService) *ImportHandler {
+	return &ImportHandler{service: service}
+}
+
+type importPathRequest struct {
+	Path   string `json:"path" binding:"required"`
+	Name   string `json:"name"`
+	Policy string `json:"policy"`
+	DryRun bool   `json:"dry_run"`
+	Mode   string `json:"mode"`
+}
+
+// 上传的 .conf 上限
+const maxImportSize = 1 << 20
+
+// ImportConfig 导入 wg-quick 配置：
+//   - multipart：file=<.conf>，可选 name / policy / dry_run / mode
+//   - JSON：{"path": "wg0.conf", "name", "policy", "dry_run", "mode"}，path 限定在 WG_CONF_DIR 内
+//
+// mode=client 时按客户端配置导入：唯一的 [Peer] 作为远端
+func (h *ImportHandler) ImportConfig(c *gin.Context) {
+	var (
+		rep *services.ImportReport
+		err error
+	)
+
+	if strings.HasPrefix(c.ContentType(), "multipart/") {
+		file, ferr := c.FormFile("file")
+		if ferr != nil {
+			c.JSON(http.StatusBadRequest, models.APIResponse{
+				Success: false,
+				Error:   "Missing config file",
+			})
+			return
+		}
+		f, ferr := file.Open()
+		if ferr != nil {
+			respondError(c, ferr)
+			return
+		}
+		defer f.Close()
+		data, ferr := io.ReadAll(io.LimitReader(f, maxImportSize))
+		if ferr != nil {
+			respondError(c, ferr)
+			return
+		}
+
+		dryRun, _ := strconv.ParseBool(c.PostForm("dry_run"))
+		opts := services.ImportOptions{
+			Name:   c.PostForm("name"),
+			Policy: c.PostForm("policy"),
+			DryRun: dryRun,
+			Mode:   c.PostForm("mode"),
+		}
+		if opts.Name == "" {
+			opts.Name = strings.TrimSuffix(file.Filename, ".conf")
+		}
+		rep, err = h.service.Import(c.Request.Context(), data, opts)
+	} else {
+		var req importPathRequest
+		if berr := c.ShouldBindJSON(&req); berr != nil {
+			c.JSON(http.StatusBadRequest, models.APIResponse{
+				Success: false,
+				Error:   "Invalid request format: " + berr.Error(),
+			})
+			return
+		}
+		rep, err = h.service.ImportFromConfDir(c.Request.Context(), req.Path, services.ImportOptions{
+			Name:   req.Name,
+			Policy: req.Policy,
+			DryRun: req.DryRun,
+			Mode:   req.Mode,
+		})
+	}
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	msg := "Config imported successfully"
+	if rep.DryRun {
+		msg = "Dry run, nothing was changed"
+	}
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Message: msg,
+		Data:    rep,
+	})
+}
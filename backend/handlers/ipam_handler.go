@@ -0,0 +1,256 @@
+package handlers
+
+import (
+	"backend/models"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ipamParam 读取路径中的整数 ID；失败时直接写 400 响应
+func ipamParam(c *gin.Context, key, what string) (int, bool) {
+	id, err := strconv.Atoi(c.Param(key))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Error:   "Invalid " + what + " ID",
+		})
+		return 0, false
+	}
+	return id, true
+}
+
+// GetIPAMUsage 返回接口各地址族、地址池的使用率以及保留/隔离期地址
+func (h *WireGuardHandler) GetIPAMUsage(c *gin.Context) {
+	id, ok := ipamParam(c, "id", "interface")
+	if !ok {
+		return
+	}
+
+	usage, err := h.service.GetIPAMUsage(c.Request.Context(), id)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Data:    usage,
+	})
+}
+
+// SuggestSubnet 建议一个不与现有接口、主机路由重叠的私有网段；
+// ?family=4|6|dual&prefix=24&prefix6=64
+func (h *WireGuardHandler) SuggestSubnet(c *gin.Context) {
+	var bits4, bits6 int
+	for key, dst := range map[string]*int{"prefix": &bits4, "prefix6": &bits6} {
+		if v := c.Query(key); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, models.APIResponse{
+					Success: false,
+					Error:   "Invalid " + key,
+				})
+				return
+			}
+			*dst = n
+		}
+	}
+
+	sug, err := h.service.SuggestSubnet(c.Request.Context(), c.Query("family"), bits4, bits6)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Data:    sug,
+	})
+}
+
+/* -------------------- 地址池 -------------------- */
+
+func (h *WireGuardHandler) GetIPPools(c *gin.Context) {
+	id, ok := ipamParam(c, "id", "interface")
+	if !ok {
+		return
+	}
+
+	pools, err := h.service.ListIPPools(c.Request.Context(), id)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Data:    pools,
+	})
+}
+
+func (h *WireGuardHandler) CreateIPPool(c *gin.Context) {
+	id, ok := ipamParam(c, "id", "interface")
+	if !ok {
+		return
+	}
+	var req models.IPPoolRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Error:   "Invalid request format: " + err.Error(),
+		})
+		return
+	}
+
+	pool, err := h.service.SaveIPPool(c.Request.Context(), id, 0, &req)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, models.APIResponse{
+		Success: true,
+		Message: "IP pool created successfully",
+		Data:    pool,
+	})
+}
+
+func (h *WireGuardHandler) UpdateIPPool(c *gin.Context) {
+	id, ok := ipamParam(c, "id", "interface")
+	if !ok {
+		return
+	}
+	poolID, ok := ipamParam(c, "pool", "IP pool")
+	if !ok {
+		return
+	}
+	var req models.IPPoolRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Error:   "Invalid request format: " + err.Error(),
+		})
+		return
+	}
+
+	pool, err := h.service.SaveIPPool(c.Request.Context(), id, poolID, &req)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Message: "IP pool updated successfully",
+		Data:    pool,
+	})
+}
+
+func (h *WireGuardHandler) DeleteIPPool(c *gin.Context) {
+	id, ok := ipamParam(c, "id", "interface")
+	if !ok {
+		return
+	}
+	poolID, ok := ipamParam(c, "pool", "IP pool")
+	if !ok {
+		return
+	}
+
+	if err := h.service.DeleteIPPool(c.Request.Context(), id, poolID); err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Message: "IP pool deleted successfully",
+	})
+}
+
+/* -------------------- 保留地址 -------------------- */
+
+func (h *WireGuardHandler) GetIPReservations(c *gin.Context) {
+	id, ok := ipamParam(c, "id", "interface")
+	if !ok {
+		return
+	}
+
+	list, err := h.service.ListIPReservations(c.Request.Context(), id)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Data:    list,
+	})
+}
+
+func (h *WireGuardHandler) CreateIPReservation(c *gin.Context) {
+	id, ok := ipamParam(c, "id", "interface")
+	if !ok {
+		return
+	}
+	var req models.IPReservationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Error:   "Invalid request format: " + err.Error(),
+		})
+		return
+	}
+
+	res, err := h.service.CreateIPReservation(c.Request.Context(), id, &req)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, models.APIResponse{
+		Success: true,
+		Message: "IP reservation created successfully",
+		Data:    res,
+	})
+}
+
+func (h *WireGuardHandler) DeleteIPReservation(c *gin.Context) {
+	id, ok := ipamParam(c, "id", "interface")
+	if !ok {
+		return
+	}
+	resID, ok := ipamParam(c, "rid", "IP reservation")
+	if !ok {
+		return
+	}
+
+	if err := h.service.DeleteIPReservation(c.Request.Context(), id, resID); err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Message: "IP reservation deleted successfully",
+	})
+}
+
+// ReleaseQuarantinedIP 提前结束地址的隔离期，使其可再次分配
+func (h *WireGuardHandler) ReleaseQuarantinedIP(c *gin.Context) {
+	id, ok := ipamParam(c, "id", "interface")
+	if !ok {
+		return
+	}
+
+	if err := h.service.ReleaseQuarantinedIP(c.Request.Context(), id, c.Param("ip")); err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Message: "IP released from quarantine",
+	})
+}
@@ -0,0 +1,257 @@
+package handlers
+
+import (
+	"backend/models"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+func (h *WireGuardHandler) GetMeshes(c *gin.Context) {
+	list, err := h.service.ListMeshes(c.Request.Context())
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Data:    list,
+	})
+}
+
+func (h *WireGuardHandler) GetMesh(c *gin.Context) {
+	id, ok := ipamParam(c, "id", "mesh")
+	if !ok {
+		return
+	}
+
+	m, err := h.service.GetMesh(c.Request.Context(), id)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Data:    m,
+	})
+}
+
+func (h *WireGuardHandler) CreateMesh(c *gin.Context) {
+	var req models.MeshRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Error:   "Invalid request format: " + err.Error(),
+		})
+		return
+	}
+
+	m, err := h.service.CreateMesh(c.Request.Context(), &req)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, models.APIResponse{
+		Success: true,
+		Message: "Mesh created successfully",
+		Data:    m,
+	})
+}
+
+func (h *WireGuardHandler) UpdateMesh(c *gin.Context) {
+	id, ok := ipamParam(c, "id", "mesh")
+	if !ok {
+		return
+	}
+	var req models.MeshRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Error:   "Invalid request format: " + err.Error(),
+		})
+		return
+	}
+
+	m, err := h.service.UpdateMesh(c.Request.Context(), id, &req)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Message: "Mesh updated successfully",
+		Data:    m,
+	})
+}
+
+func (h *WireGuardHandler) DeleteMesh(c *gin.Context) {
+	id, ok := ipamParam(c, "id", "mesh")
+	if !ok {
+		return
+	}
+
+	if err := h.service.DeleteMesh(c.Request.Context(), id); err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Message: "Mesh deleted successfully",
+	})
+}
+
+/* -------------------- 成员 -------------------- */
+
+func (h *WireGuardHandler) GetMeshMembers(c *gin.Context) {
+	id, ok := ipamParam(c, "id", "mesh")
+	if !ok {
+		return
+	}
+	secrets, ok := includeSecrets(c)
+	if !ok {
+		return
+	}
+
+	list, err := h.service.ListMeshMembers(c.Request.Context(), id)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	if !secrets {
+		for i := range list {
+			redactMeshMember(&list[i])
+		}
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Data:    list,
+	})
+}
+
+func (h *WireGuardHandler) CreateMeshMember(c *gin.Context) {
+	id, ok := ipamParam(c, "id", "mesh")
+	if !ok {
+		return
+	}
+	var req models.MeshMemberRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Error:   "Invalid request format: " + err.Error(),
+		})
+		return
+	}
+
+	m, err := h.service.CreateMeshMember(c.Request.Context(), id, &req)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	redactMeshMember(m)
+
+	c.JSON(http.StatusCreated, models.APIResponse{
+		Success: true,
+		Message: "Mesh member created successfully",
+		Data:    m,
+	})
+}
+
+func (h *WireGuardHandler) UpdateMeshMember(c *gin.Context) {
+	id, ok := ipamParam(c, "id", "mesh")
+	if !ok {
+		return
+	}
+	memberID, ok := ipamParam(c, "member", "mesh member")
+	if !ok {
+		return
+	}
+	var req models.MeshMemberRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Error:   "Invalid request format: " + err.Error(),
+		})
+		return
+	}
+
+	m, err := h.service.UpdateMeshMember(c.Request.Context(), id, memberID, &req)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	redactMeshMember(m)
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Message: "Mesh member updated successfully",
+		Data:    m,
+	})
+}
+
+func (h *WireGuardHandler) DeleteMeshMember(c *gin.Context) {
+	id, ok := ipamParam(c, "id", "mesh")
+	if !ok {
+		return
+	}
+	memberID, ok := ipamParam(c, "member", "mesh member")
+	if !ok {
+		return
+	}
+
+	if err := h.service.DeleteMeshMember(c.Request.Context(), id, memberID); err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Message: "Mesh member deleted successfully",
+	})
+}
+
+// GetMeshMemberConfig 下载单个成员的配置；X-Mesh-Revision 用于判断节点上的配置是否过期
+func (h *WireGuardHandler) GetMeshMemberConfig(c *gin.Context) {
+	id, ok := ipamParam(c, "id", "mesh")
+	if !ok {
+		return
+	}
+	memberID, ok := ipamParam(c, "member", "mesh member")
+	if !ok {
+		return
+	}
+
+	out, m, err := h.service.ExportMeshMemberConfig(c.Request.Context(), id, memberID)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.Header("X-Mesh-Revision", strconv.Itoa(m.Revision))
+	c.Header("Content-Disposition", "attachment; filename="+out.Filename)
+	c.Data(http.StatusOK, out.ContentType, out.Data)
+}
+
+// GetMeshConfigs 打包下载全部成员的配置（<member>/<mesh>.conf）
+func (h *WireGuardHandler) GetMeshConfigs(c *gin.Context) {
+	id, ok := ipamParam(c, "id", "mesh")
+	if !ok {
+		return
+	}
+
+	data, m, err := h.service.ExportMeshConfigs(c.Request.Context(), id)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.Header("X-Mesh-Revision", strconv.Itoa(m.Revision))
+	c.Header("Content-Disposition", "attachment; filename="+m.Name+"-r"+strconv.Itoa(m.Revision)+".zip")
+	c.Data(http.StatusOK, "application/zip", data)
+}
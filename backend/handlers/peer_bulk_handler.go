@@ -0,0 +1,112 @@
+package handlers
+
+import (
+	"backend/models"
+	"backend/services"
+	"bytes"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 上传的 CSV/JSON 上限
+const maxBulkUploadSize = 4 << 20
+
+// BulkCreatePeers 批量创建 peer：
+//   - JSON：BulkCreatePeersRequest
+//   - multipart：file=<.csv 或 .json>，表单字段 interface_id / mode
+//
+// 默认返回 zip（每个 peer 的 .conf 与二维码 PNG + results.json）；?format=json 只返回逐行结果
+func (h *WireGuardHandler) BulkCreatePeers(c *gin.Context) {
+	var req models.BulkCreatePeersRequest
+
+	if strings.HasPrefix(c.ContentType(), "multipart/") {
+		file, err := c.FormFile("file")
+		if err != nil {
+			c.JSON(http.StatusBadRequest, models.APIResponse{
+				Success: false,
+				Error:   "Missing peer list file",
+			})
+			return
+		}
+		f, err := file.Open()
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		defer f.Close()
+		data, err := io.ReadAll(io.LimitReader(f, maxBulkUploadSize))
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+
+		if v := c.PostForm("interface_id"); v != "" {
+			id, err := strconv.Atoi(v)
+			if err != nil || id <= 0 {
+				c.JSON(http.StatusBadRequest, models.APIResponse{
+					Success: false,
+					Error:   "Invalid interface ID",
+				})
+				return
+			}
+			req.InterfaceID = uint(id)
+		}
+		req.Mode = c.PostForm("mode")
+
+		if strings.HasSuffix(strings.ToLower(file.Filename), ".json") {
+			err = services.ParseBulkPeersJSON(data, &req)
+		} else {
+			req.Peers, err = services.ParseBulkPeersCSV(bytes.NewReader(data))
+		}
+		if err != nil {
+			c.JSON(http.StatusBadRequest, models.APIResponse{
+				Success: false,
+				Error:   "Invalid peer list: " + err.Error(),
+			})
+			return
+		}
+		if req.InterfaceID == 0 {
+			c.JSON(http.StatusBadRequest, models.APIResponse{
+				Success: false,
+				Error:   "interface_id is required",
+			})
+			return
+		}
+	} else if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Error:   "Invalid request format: " + err.Error(),
+		})
+		return
+	}
+
+	rep, err := h.service.BulkCreatePeers(c.Request.Context(), &req)
+	if err != nil {
+		respondErrorData(c, err, rep)
+		return
+	}
+
+	if c.Query("format") == "json" {
+		c.JSON(http.StatusOK, models.APIResponse{
+			Success: true,
+			Message: "Peers created",
+			Data:    rep,
+		})
+		return
+	}
+
+	data, err := h.service.BulkArchive(rep)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	c.Header("X-Peers-Created", strconv.Itoa(rep.Created))
+	c.Header("X-Peers-Failed", strconv.Itoa(rep.Failed))
+	c.Header("Content-Disposition", "attachment; filename=wg-peers-"+time.Now().UTC().Format("20060102-150405")+".zip")
+	c.Data(http.StatusOK, "application/zip", data)
+}
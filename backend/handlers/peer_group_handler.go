@@ -0,0 +1,220 @@
+package handlers
+
+import (
+	"backend/models"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+func (h *WireGuardHandler) GetPeerGroups(c *gin.Context) {
+	list, err := h.service.ListPeerGroups(c.Request.Context())
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Data:    list,
+	})
+}
+
+func (h *WireGuardHandler) GetPeerGroup(c *gin.Context) {
+	id, ok := ipamParam(c, "id", "group")
+	if !ok {
+		return
+	}
+
+	g, err := h.service.GetPeerGroup(c.Request.Context(), id)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Data:    g,
+	})
+}
+
+func (h *WireGuardHandler) CreatePeerGroup(c *gin.Context) {
+	var req models.PeerGroupRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Error:   "Invalid request format: " + err.Error(),
+		})
+		return
+	}
+
+	g, err := h.service.CreatePeerGroup(c.Request.Context(), &req)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, models.APIResponse{
+		Success: true,
+		Message: "Peer group created successfully",
+		Data:    g,
+	})
+}
+
+func (h *WireGuardHandler) UpdatePeerGroup(c *gin.Context) {
+	id, ok := ipamParam(c, "id", "group")
+	if !ok {
+		return
+	}
+	var req models.PeerGroupRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Error:   "Invalid request format: " + err.Error(),
+		})
+		return
+	}
+
+	g, err := h.service.UpdatePeerGroup(c.Request.Context(), id, &req)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Message: "Peer group updated successfully",
+		Data:    g,
+	})
+}
+
+func (h *WireGuardHandler) DeletePeerGroup(c *gin.Context) {
+	id, ok := ipamParam(c, "id", "group")
+	if !ok {
+		return
+	}
+
+	if err := h.service.DeletePeerGroup(c.Request.Context(), id); err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Message: "Peer group deleted successfully",
+	})
+}
+
+func (h *WireGuardHandler) GetPeerGroupMembers(c *gin.Context) {
+	id, ok := ipamParam(c, "id", "group")
+	if !ok {
+		return
+	}
+	secrets, ok := includeSecrets(c)
+	if !ok {
+		return
+	}
+
+	peers, err := h.service.GetPeerGroupMembers(c.Request.Context(), id)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	if !secrets {
+		for i := range peers {
+			redactPeer(&peers[i])
+		}
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Data:    peers,
+	})
+}
+
+// AddPeerGroupMembers 加入成员（POST）；PUT 整体替换
+func (h *WireGuardHandler) AddPeerGroupMembers(c *gin.Context) {
+	h.setPeerGroupMembers(c, false)
+}
+
+func (h *WireGuardHandler) ReplacePeerGroupMembers(c *gin.Context) {
+	h.setPeerGroupMembers(c, true)
+}
+
+func (h *WireGuardHandler) setPeerGroupMembers(c *gin.Context, replace bool) {
+	id, ok := ipamParam(c, "id", "group")
+	if !ok {
+		return
+	}
+	var req models.PeerGroupMembersRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Error:   "Invalid request format: " + err.Error(),
+		})
+		return
+	}
+
+	peers, err := h.service.SetPeerGroupMembers(c.Request.Context(), id, req.PeerIDs, replace)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	for i := range peers {
+		redactPeer(&peers[i])
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Message: "Peer group members updated successfully",
+		Data:    peers,
+	})
+}
+
+func (h *WireGuardHandler) RemovePeerGroupMember(c *gin.Context) {
+	id, ok := ipamParam(c, "id", "group")
+	if !ok {
+		return
+	}
+	peerID, ok := ipamParam(c, "peer", "peer")
+	if !ok {
+		return
+	}
+
+	if err := h.service.RemovePeerGroupMember(c.Request.Context(), id, peerID); err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Message: "Peer removed from group",
+	})
+}
+
+// BulkPeerGroup 对分组内全部 peer 执行 disable / enable / keepalive / routing_profile
+func (h *WireGuardHandler) BulkPeerGroup(c *gin.Context) {
+	id, ok := ipamParam(c, "id", "group")
+	if !ok {
+		return
+	}
+	var req models.PeerGroupBulkRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Error:   "Invalid request format: " + err.Error(),
+		})
+		return
+	}
+
+	rep, err := h.service.BulkPeerGroup(c.Request.Context(), id, &req)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Data:    rep,
+	})
+}
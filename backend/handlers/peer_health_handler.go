@@ -0,0 +1,55 @@
+package handlers
+
+import (
+	"backend/models"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetPeersHealth 返回 peer 在统计窗口内的在线率（?window=24h / 7d，?interface_id= 只看一个接口）
+func (h *WireGuardHandler) GetPeersHealth(c *gin.Context) {
+	interfaceID := 0
+	if v := c.Query("interface_id"); v != "" {
+		id, err := strconv.Atoi(v)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, models.APIResponse{
+				Success: false,
+				Error:   "Invalid interface ID",
+			})
+			return
+		}
+		interfaceID = id
+	}
+
+	list, err := h.service.ListPeerHealth(c.Request.Context(), interfaceID, c.Query("window"))
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Data:    list,
+	})
+}
+
+// GetPeerHealth 返回单个 peer 的在线时段、last seen 与在线率
+func (h *WireGuardHandler) GetPeerHealth(c *gin.Context) {
+	id, ok := ipamParam(c, "id", "peer")
+	if !ok {
+		return
+	}
+
+	health, err := h.service.GetPeerHealth(c.Request.Context(), id, c.Query("window"))
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Data:    health,
+	})
+}
@@ -0,0 +1,31 @@
+package handlers
+
+import (
+	"backend/models"
+	"backend/services"
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 按 service 层错误类型选择 HTTP 状态码
+func respondError(c *gin.Context, err error) {
+	respondErrorData(c, err, nil)
+}
+
+// respondErrorData 同 respondError，附带 data（如逐行错误、diff）
+func respondErrorData(c *gin.Context, err error, data interface{}) {
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, services.ErrBadRequest):
+		status = http.StatusBadRequest
+	case errors.Is(err, services.ErrNotFound):
+		status = http.StatusNotFound
+	case errors.Is(err, services.ErrConflict):
+		status = http.StatusConflict
+	case errors.Is(err, services.ErrUpstream):
+		status = http.StatusBadGateway
+	}
+	c.JSON(status, models.APIResponse{Success: false, Error: err.Error(), Data: data})
+}
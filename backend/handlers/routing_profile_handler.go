@@ -0,0 +1,120 @@
+package handlers
+
+import (
+	"backend/models"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+func (h *WireGuardHandler) GetRoutingProfiles(c *gin.Context) {
+	list, err := h.service.ListRoutingProfiles()
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Data:    list,
+	})
+}
+
+func (h *WireGuardHandler) GetRoutingProfile(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Error:   "Invalid routing profile ID",
+		})
+		return
+	}
+
+	rp, err := h.service.GetRoutingProfile(id)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Data:    rp,
+	})
+}
+
+func (h *WireGuardHandler) CreateRoutingProfile(c *gin.Context) {
+	var req models.RoutingProfileRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Error:   "Invalid request format: " + err.Error(),
+		})
+		return
+	}
+
+	rp, err := h.service.CreateRoutingProfile(c.Request.Context(), &req)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, models.APIResponse{
+		Success: true,
+		Message: "Routing profile created successfully",
+		Data:    rp,
+	})
+}
+
+func (h *WireGuardHandler) UpdateRoutingProfile(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Error:   "Invalid routing profile ID",
+		})
+		return
+	}
+
+	var req models.RoutingProfileRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Error:   "Invalid request format: " + err.Error(),
+		})
+		return
+	}
+
+	rp, err := h.service.UpdateRoutingProfile(c.Request.Context(), id, &req)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Message: "Routing profile updated successfully",
+		Data:    rp,
+	})
+}
+
+func (h *WireGuardHandler) DeleteRoutingProfile(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Error:   "Invalid routing profile ID",
+		})
+		return
+	}
+
+	if err := h.service.DeleteRoutingProfile(c.Request.Context(), id); err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Message: "Routing profile deleted successfully",
+	})
+}
@@ -0,0 +1,59 @@
+package handlers
+
+import (
+	"backend/models"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// includeSecrets 判断本次响应是否返回私钥：仅当显式 ?include_secrets=1 且为 admin。
+// 非 admin 显式请求时直接返回 403，ok=false 表示已写响应
+func includeSecrets(c *gin.Context) (include bool, ok bool) {
+	switch c.Query("include_secrets") {
+	case "1", "true":
+	default:
+		return false, true
+	}
+	if c.GetString("role") != models.RoleAdmin {
+		c.JSON(http.StatusForbidden, models.APIResponse{
+			Success: false,
+			Error:   "include_secrets requires admin role",
+		})
+		return false, false
+	}
+	return true, true
+}
+
+// hooksAllowed 检查请求中的 hook 字段：hook 以 root 身份执行任意命令，只有 admin 能设置。
+// ok=false 表示已写 403 响应
+func hooksAllowed(c *gin.Context, h models.InterfaceHooks) (ok bool) {
+	if h.PreUp == nil && h.PostUp == nil && h.PreDown == nil && h.PostDown == nil {
+		return true
+	}
+	if c.GetString("role") != models.RoleAdmin {
+		c.JSON(http.StatusForbidden, models.APIResponse{
+			Success: false,
+			Error:   "setting pre_up/post_up/pre_down/post_down requires admin role",
+		})
+		return false
+	}
+	return true
+}
+
+func redactInterface(it *models.WireGuardInterface) {
+	it.PrivateKey = ""
+}
+
+func redactPeer(p *models.WireGuardPeer) {
+	p.PrivateKey = ""
+	p.PresharedKey = ""
+}
+
+func redactRemote(r *models.ClientRemote) {
+	r.PresharedKey = ""
+}
+
+func redactMeshMember(m *models.MeshMember) {
+	m.PrivateKey = ""
+}
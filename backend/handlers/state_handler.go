@@ -0,0 +1,82 @@
+package handlers
+
+import (
+	"backend/models"
+	"backend/services"
+	"bytes"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+type StateHandler struct {
+	service *services.StateService
+}
+
+func NewStateHandler(service *services.StateService) *StateHandler {
+	return &StateHandler{service: service}
+}
+
+// ExportState 输出声明式状态文档；?format=yaml（默认）或 json
+func (h *StateHandler) ExportState(c *gin.Context) {
+	doc, err := h.service.Export(c.Request.Context())
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	format := c.DefaultQuery("format", "yaml")
+	var buf bytes.Buffer
+	if err := services.EncodeStateDocument(&buf, doc, format); err != nil {
+		respondError(c, err)
+		return
+	}
+
+	contentType, ext := "application/yaml; charset=utf-8", "yaml"
+	if format == "json" {
+		contentType, ext = "application/json; charset=utf-8", "json"
+	}
+	c.Header("Content-Disposition", "attachment; filename=wg-state."+ext)
+	c.Data(http.StatusOK, contentType, buf.Bytes())
+}
+
+// PlanState 对比请求体中的文档（YAML/JSON）与当前库，返回变更计划
+func (h *StateHandler) PlanState(c *gin.Context) {
+	doc, err := services.ParseStateDocument(c.Request.Body)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	plan, err := h.service.Plan(c.Request.Context(), doc)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Data:    plan,
+	})
+}
+
+// ApplyState 在事务内应用文档，并重新下发受影响的运行中接口
+func (h *StateHandler) ApplyState(c *gin.Context) {
+	doc, err := services.ParseStateDocument(c.Request.Body)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	plan, err := h.service.Apply(c.Request.Context(), doc)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Message: "State applied successfully",
+		Data:    plan,
+	})
+}
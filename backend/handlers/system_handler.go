@@ -0,0 +1,38 @@
+package handlers
+
+import (
+	"backend/models"
+	"backend/services"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+type SystemHandler struct {
+	service *services.SystemService
+}
+
+func NewSystemHandler(service *services.SystemService) *SystemHandler {
+	return &SystemHandler{service: service}
+}
+
+func (h *SystemHandler) GetKeyStatus(c *gin.Context) {
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Data:    h.service.KeyStatus(),
+	})
+}
+
+func (h *SystemHandler) RotateKeys(c *gin.Context) {
+	n, err := h.service.RotateKeys(c.Request.Context())
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Message: "Secrets re-encrypted successfully",
+		Data:    gin.H{"rewrapped": n, "key": h.service.KeyStatus()},
+	})
+}
@@ -0,0 +1,32 @@
+package handlers
+
+import (
+	"backend/models"
+	"backend/services"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// SubtractCIDR 计算 base 去掉 exclude 后的最少前缀列表
+func (h *WireGuardHandler) SubtractCIDR(c *gin.Context) {
+	var req models.CIDRSubtractRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	res, err := services.SubtractCIDRs(&req)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Data:    res,
+	})
+}
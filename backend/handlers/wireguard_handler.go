@@ -3,11 +3,9 @@ package handlers
 import (
 	"backend/models"
 	"backend/services"
-	"errors"
 	"github.com/gin-gonic/gin"
 	"net/http"
 	"strconv"
-	
 )
 
 type WireGuardHandler struct {
@@ -18,8 +16,13 @@ func NewWireGuardHandler(service *services.WireGuardService) *WireGuardHandler {
 	return &WireGuardHandler{service: service}
 }
 
-// Interface handlersf
+// Interface handlers
 func (h *WireGuardHandler) GetInterfaces(c *gin.Context) {
+	secrets, ok := includeSecrets(c)
+	if !ok {
+		return
+	}
+
 	interfaces, err := h.service.GetInterfaces()
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, models.APIResponse{
@@ -29,6 +32,11 @@ func (h *WireGuardHandler) GetInterfaces(c *gin.Context) {
 		})
 		return
 	}
+	if !secrets {
+		for i := range interfaces {
+			redactInterface(&interfaces[i])
+		}
+	}
 
 	c.JSON(http.StatusOK, models.APIResponse{
 		Success: true,
@@ -47,14 +55,19 @@ func (h *WireGuardHandler) GetInterface(c *gin.Context) {
 		return
 	}
 
+	secrets, ok := includeSecrets(c)
+	if !ok {
+		return
+	}
+
 	iface, err := h.service.GetInterface(id)
 	if err != nil {
-		c.JSON(http.StatusNotFound, models.APIResponse{
-			Success: false,
-			Error:   err.Error(),
-		})
+		respondError(c, err)
 		return
 	}
+	if !secrets {
+		redactInterface(iface)
+	}
 
 	c.JSON(http.StatusOK, models.APIResponse{
 		Success: true,
@@ -72,14 +85,22 @@ func (h *WireGuardHandler) CreateInterface(c *gin.Context) {
 		return
 	}
 
+	secrets, ok := includeSecrets(c)
+	if !ok {
+		return
+	}
+	if !hooksAllowed(c, req.InterfaceHooks) {
+		return
+	}
+
 	iface, err := h.service.CreateInterface(req)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, models.APIResponse{
-			Success: false,
-			Error:   err.Error(),
-		})
+		respondError(c, err)
 		return
 	}
+	if !secrets {
+		redactInterface(iface)
+	}
 
 	c.JSON(http.StatusCreated, models.APIResponse{
 		Success: true,
@@ -107,14 +128,22 @@ func (h *WireGuardHandler) UpdateInterface(c *gin.Context) {
 		return
 	}
 
+	secrets, ok := includeSecrets(c)
+	if !ok {
+		return
+	}
+	if !hooksAllowed(c, req.InterfaceHooks) {
+		return
+	}
+
 	iface, err := h.service.UpdateInterface(id, req)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, models.APIResponse{
-			Success: false,
-			Error:   err.Error(),
-		})
+		respondError(c, err)
 		return
 	}
+	if !secrets {
+		redactInterface(iface)
+	}
 
 	c.JSON(http.StatusOK, models.APIResponse{
 		Success: true,
@@ -123,7 +152,8 @@ func (h *WireGuardHandler) UpdateInterface(c *gin.Context) {
 	})
 }
 
-func (h *WireGuardHandler) DeleteInterface(c *gin.Context) {
+// RenumberInterface 把接口换到新网段并平移 peer 地址，返回需要重新下发配置的客户端
+func (h *WireGuardHandler) RenumberInterface(c *gin.Context) {
 	id, err := strconv.Atoi(c.Param("id"))
 	if err != nil {
 		c.JSON(http.StatusBadRequest, models.APIResponse{
@@ -133,15 +163,48 @@ func (h *WireGuardHandler) DeleteInterface(c *gin.Context) {
 		return
 	}
 
-	err = h.service.DeleteInterface(id)
+	var req models.RenumberInterfaceRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Error:   "Invalid request format: " + err.Error(),
+		})
+		return
+	}
+
+	rep, err := h.service.RenumberInterface(c.Request.Context(), id, &req)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, models.APIResponse{
+		respondError(c, err)
+		return
+	}
+
+	msg := "Interface renumbered successfully"
+	if rep.DryRun {
+		msg = "Renumber plan (dry run, nothing changed)"
+	}
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Message: msg,
+		Data:    rep,
+	})
+}
+
+func (h *WireGuardHandler) DeleteInterface(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.APIResponse{
 			Success: false,
-			Error:   err.Error(),
+			Error:   "Invalid interface ID",
 		})
 		return
 	}
 
+	err = h.service.DeleteInterface(id)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
 	c.JSON(http.StatusOK, models.APIResponse{
 		Success: true,
 		Message: "Interface deleted successfully",
@@ -160,10 +223,7 @@ func (h *WireGuardHandler) StartInterface(c *gin.Context) {
 
 	err = h.service.StartInterface(id)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, models.APIResponse{
-			Success: false,
-			Error:   err.Error(),
-		})
+		respondError(c, err)
 		return
 	}
 
@@ -173,6 +233,25 @@ func (h *WireGuardHandler) StartInterface(c *gin.Context) {
 	})
 }
 
+// ResolveEndpoints 立即重新解析接口上以主机名配置的 peer endpoint，返回有变化的 peer
+func (h *WireGuardHandler) ResolveEndpoints(c *gin.Context) {
+	id, ok := ipamParam(c, "id", "interface")
+	if !ok {
+		return
+	}
+
+	changes, err := h.service.ReresolveEndpoints(c.Request.Context(), id)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Data:    changes,
+	})
+}
+
 func (h *WireGuardHandler) StopInterface(c *gin.Context) {
 	id, err := strconv.Atoi(c.Param("id"))
 	if err != nil {
@@ -185,10 +264,7 @@ func (h *WireGuardHandler) StopInterface(c *gin.Context) {
 
 	err = h.service.StopInterface(id)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, models.APIResponse{
-			Success: false,
-			Error:   err.Error(),
-		})
+		respondError(c, err)
 		return
 	}
 
@@ -198,6 +274,22 @@ func (h *WireGuardHandler) StopInterface(c *gin.Context) {
 	})
 }
 
+// GetInterfaceEvents 返回接口最近的事件（hook 输出等），?limit= 默认 100
+func (h *WireGuardHandler) GetInterfaceEvents(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.APIResponse{Success: false, Error: "Invalid interface ID"})
+		return
+	}
+	limit, _ := strconv.Atoi(c.Query("limit"))
+	events, err := h.service.GetInterfaceEvents(c.Request.Context(), id, limit)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, models.APIResponse{Success: true, Data: events})
+}
+
 func (h *WireGuardHandler) GetInterfaceStatus(c *gin.Context) {
 	id, err := strconv.Atoi(c.Param("id"))
 	if err != nil {
@@ -206,7 +298,7 @@ func (h *WireGuardHandler) GetInterfaceStatus(c *gin.Context) {
 	}
 	status, err := h.service.GetInterfaceStatus(id)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, models.APIResponse{Success: false, Error: err.Error()})
+		respondError(c, err)
 		return
 	}
 	c.JSON(http.StatusOK, models.APIResponse{Success: true, Data: status})
@@ -214,7 +306,7 @@ func (h *WireGuardHandler) GetInterfaceStatus(c *gin.Context) {
 
 func (h *WireGuardHandler) RestartService(c *gin.Context) {
 	if err := h.service.RestartService(); err != nil {
-		c.JSON(http.StatusInternalServerError, models.APIResponse{Success: false, Error: err.Error()})
+		respondError(c, err)
 		return
 	}
 	c.JSON(http.StatusOK, models.APIResponse{Success: true, Message: "WireGuard service restarted"})
@@ -232,10 +324,7 @@ func (h *WireGuardHandler) GetInterfaceConfig(c *gin.Context) {
 
 	config, err := h.service.GetInterfaceConfig(id)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, models.APIResponse{
-			Success: false,
-			Error:   err.Error(),
-		})
+		respondError(c, err)
 		return
 	}
 
@@ -246,14 +335,25 @@ func (h *WireGuardHandler) GetInterfaceConfig(c *gin.Context) {
 
 // Peer handlers
 func (h *WireGuardHandler) GetPeers(c *gin.Context) {
+	secrets, ok := includeSecrets(c)
+	if !ok {
+		return
+	}
+
 	peers, err := h.service.GetPeers()
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, models.APIResponse{
-			Success: false,
-			Error:   err.Error(),
-		})
+		respondError(c, err)
 		return
 	}
+	// ?tag= / ?group= 按分组名过滤
+	if tag := c.DefaultQuery("tag", c.Query("group")); tag != "" {
+		peers = services.FilterPeersByGroup(peers, tag)
+	}
+	if !secrets {
+		for i := range peers {
+			redactPeer(&peers[i])
+		}
+	}
 
 	c.JSON(http.StatusOK, models.APIResponse{
 		Success: true,
@@ -271,14 +371,19 @@ func (h *WireGuardHandler) GetPeer(c *gin.Context) {
 		return
 	}
 
+	secrets, ok := includeSecrets(c)
+	if !ok {
+		return
+	}
+
 	peer, err := h.service.GetPeer(id)
 	if err != nil {
-		c.JSON(http.StatusNotFound, models.APIResponse{
-			Success: false,
-			Error:   err.Error(),
-		})
+		respondError(c, err)
 		return
 	}
+	if !secrets {
+		redactPeer(peer)
+	}
 
 	c.JSON(http.StatusOK, models.APIResponse{
 		Success: true,
@@ -302,20 +407,19 @@ func (h *WireGuardHandler) CreatePeer(c *gin.Context) {
 		req.PersistentKeepalive = &def
 	}
 
+	secrets, ok := includeSecrets(c)
+	if !ok {
+		return
+	}
+
 	peer, err := h.service.CreatePeer(c.Request.Context(), &req)
 	if err != nil {
-		switch {
-		case errors.Is(err, services.ErrBadRequest):
-			c.JSON(http.StatusBadRequest, models.APIResponse{Success: false, Error: err.Error()})
-		case errors.Is(err, services.ErrNotFound):
-			c.JSON(http.StatusNotFound, models.APIResponse{Success: false, Error: err.Error()})
-		case errors.Is(err, services.ErrConflict):
-			c.JSON(http.StatusConflict, models.APIResponse{Success: false, Error: err.Error()})
-		default:
-			c.JSON(http.StatusInternalServerError, models.APIResponse{Success: false, Error: err.Error()})
-		}
+		respondError(c, err)
 		return
 	}
+	if !secrets {
+		redactPeer(peer)
+	}
 
 	c.JSON(http.StatusCreated, models.APIResponse{
 		Success: true,
@@ -343,20 +447,19 @@ func (h *WireGuardHandler) UpdatePeer(c *gin.Context) {
 		return
 	}
 
+	secrets, ok := includeSecrets(c)
+	if !ok {
+		return
+	}
+
 	peer, err := h.service.UpdatePeer(c.Request.Context(), id, &req)
 	if err != nil {
-		switch {
-		case errors.Is(err, services.ErrBadRequest):
-			c.JSON(http.StatusBadRequest, models.APIResponse{Success: false, Error: err.Error()})
-		case errors.Is(err, services.ErrNotFound):
-			c.JSON(http.StatusNotFound, models.APIResponse{Success: false, Error: err.Error()})
-		case errors.Is(err, services.ErrConflict):
-			c.JSON(http.StatusConflict, models.APIResponse{Success: false, Error: err.Error()})
-		default:
-			c.JSON(http.StatusInternalServerError, models.APIResponse{Success: false, Error: err.Error()})
-		}
+		respondError(c, err)
 		return
 	}
+	if !secrets {
+		redactPeer(peer)
+	}
 
 	c.JSON(http.StatusOK, models.APIResponse{
 		Success: true,
@@ -377,10 +480,7 @@ func (h *WireGuardHandler) DeletePeer(c *gin.Context) {
 
 	err = h.service.DeletePeer(id)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, models.APIResponse{
-			Success: false,
-			Error:   err.Error(),
-		})
+		respondError(c, err)
 		return
 	}
 
@@ -403,16 +503,13 @@ func (h *WireGuardHandler) GetPeerConfig(c *gin.Context) {
 	// 支持自动生成/回填私钥：?regenerate=1 或 ?rotate=1
 	regenerate := c.Query("regenerate") == "1" || c.Query("rotate") == "1"
 
-	config, err := h.service.GetPeerConfig(id, regenerate) // ← 这里传第二个参数
+	// ?format=wg-quick（默认）| nm | systemd | openwrt | json
+	out, err := h.service.ExportPeerConfig(id, regenerate, c.Query("format"))
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, models.APIResponse{
-			Success: false,
-			Error:   err.Error(),
-		})
+		respondError(c, err)
 		return
 	}
 
-	c.Header("Content-Type", "text/plain; charset=utf-8")
-	c.Header("Content-Disposition", "attachment; filename=wg-peer.conf")
-	c.String(http.StatusOK, config)
+	c.Header("Content-Disposition", "attachment; filename="+out.Filename)
+	c.Data(http.StatusOK, out.ContentType, out.Data)
 }
@@ -1,71 +1,481 @@
+// Package ipam 维护空闲地址区间，为 peer 分配隧道地址（IPv4 / IPv6）
 package ipam
 
 import (
-	"encoding/binary"
+	crand "crypto/rand"
 	"errors"
+	"io"
 	"math/big"
-	"net"
+	"math/rand/v2"
+	"net/netip"
+	"slices"
+	"sort"
 )
 
 var ErrNoAvailableIP = errors.New("no available IP in subnet")
 
-func nextIP(ip net.IP) net.IP {
-	isV4 := ip.To4() != nil
-	i := new(big.Int).SetBytes(ip.To16())
-	i.Add(i, big.NewInt(1))
-	b := i.Bytes()
-	if len(b) < net.IPv6len {
-		p := make([]byte, net.IPv6len)
-		copy(p[net.IPv6len-len(b):], b)
-		b = p
+// span 是闭区间 [first, last]
+type span struct {
+	first, last netip.Addr
+}
+
+// Span 是导出的空闲区间 [First, Last]，用于持久化与恢复 FreeList
+type Span struct {
+	First, Last netip.Addr
+}
+
+// node 是按 first 排序的 treap 节点；prio 满足堆序，树高期望为 O(log n)
+type node struct {
+	s           span
+	prio        uint64
+	left, right *node
+}
+
+// FreeList 是按地址排序、互不相交且不相邻的空闲区间集合。
+// 占用情况只体现为区间的切分，区间存于 treap，查找/分配/释放都是 O(log n)，
+// 与网段大小无关：/64 上几万个 peer 也只是几万个区间
+type FreeList struct {
+	root *node
+	n    int
+
+	// dirty 记录 Track 之后起点发生变化的区间（增、删或端点修改），供增量持久化
+	dirty map[netip.Addr]struct{}
+}
+
+// NewFreeList 由可分配网段减去已占用地址构造；ranges 可重叠，taken 可无序、可重复、可在网段外
+func NewFreeList(ranges []netip.Prefix, taken []netip.Addr) *FreeList {
+	var spans []span
+	for _, p := range ranges {
+		if !p.IsValid() {
+			continue
+		}
+		p = p.Masked()
+		spans = append(spans, span{p.Addr(), lastAddr(p)})
+	}
+	sort.Slice(spans, func(i, j int) bool { return spans[i].first.Less(spans[j].first) })
+
+	// 合并重叠与相邻的区间（IPv4 与 IPv6 排序后天然分开，Next 不会跨地址族）
+	var merged []span
+	for _, s := range spans {
+		if n := len(merged); n > 0 && merged[n-1].first.BitLen() == s.first.BitLen() {
+			last := &merged[n-1]
+			if next := last.last.Next(); !next.IsValid() || !next.Less(s.first) {
+				if last.last.Less(s.last) {
+					last.last = s.last
+				}
+				continue
+			}
+		}
+		merged = append(merged, s)
 	}
-	out := net.IP(b)
-	if isV4 {
-		return out.To4()
+
+	taken = slices.Clone(taken)
+	sort.Slice(taken, func(i, j int) bool { return taken[i].Less(taken[j]) })
+
+	// 一次扫描把已占用地址从区间中挖掉
+	var free []span
+	j := 0
+	for _, s := range merged {
+		for j < len(taken) && taken[j].Less(s.first) {
+			j++
+		}
+		cur := s.first
+		for j < len(taken) && !s.last.Less(taken[j]) {
+			a := taken[j]
+			j++
+			if !cur.IsValid() || a.Less(cur) {
+				continue // 重复地址
+			}
+			if cur.Less(a) {
+				free = append(free, span{cur, a.Prev()})
+			}
+			cur = a.Next()
+		}
+		if cur.IsValid() && !s.last.Less(cur) {
+			free = append(free, span{cur, s.last})
+		}
+	}
+
+	f := &FreeList{}
+	for _, s := range free {
+		f.insert(s)
+	}
+	return f
+}
+
+// FromSpans 由 Snapshot 导出的区间恢复空闲列表；区间须互不相交且不相邻，顺序不限
+func FromSpans(spans []Span) *FreeList {
+	f := &FreeList{}
+	for _, s := range spans {
+		f.insert(span{s.First, s.Last})
+	}
+	return f
+}
+
+// Snapshot 按地址顺序导出全部空闲区间
+func (f *FreeList) Snapshot() []Span {
+	out := make([]Span, 0, f.n)
+	var walk func(t *node)
+	walk = func(t *node) {
+		if t == nil {
+			return
+		}
+		walk(t.left)
+		out = append(out, Span{t.s.first, t.s.last})
+		walk(t.right)
 	}
+	walk(f.root)
 	return out
 }
 
-func isReserved(ip net.IP, netw *net.IPNet, serverIP string) bool {
-	if !netw.Contains(ip) {
-		return true
+// Track 开始记录区间变化，之后由 Changes 取出
+func (f *FreeList) Track() {
+	if f.dirty == nil {
+		f.dirty = map[netip.Addr]struct{}{}
 	}
-	if serverIP != "" && ip.Equal(net.ParseIP(serverIP)) {
-		return true
+}
+
+// Changes 返回自 Track 或上次调用以来的变化：set 为起点变化过且仍存在的区间（按新值覆盖），
+// removed 为已不存在的区间起点；取出后清空记录
+func (f *FreeList) Changes() (set []Span, removed []netip.Addr) {
+	for a := range f.dirty {
+		if t := f.floor(a); t != nil && t.s.first == a {
+			set = append(set, Span{t.s.first, t.s.last})
+		} else {
+			removed = append(removed, a)
+		}
+	}
+	sort.Slice(set, func(i, j int) bool { return set[i].First.Less(set[j].First) })
+	sort.Slice(removed, func(i, j int) bool { return removed[i].Less(removed[j]) })
+	if f.dirty != nil {
+		f.dirty = map[netip.Addr]struct{}{}
+	}
+	return set, removed
+}
+
+// touch 记录起点为 a 的区间发生了变化
+func (f *FreeList) touch(a netip.Addr) {
+	if f.dirty != nil {
+		f.dirty[a] = struct{}{}
+	}
+}
+
+/* -------------------- treap -------------------- */
+
+func rotateRight(t *node) *node {
+	l := t.left
+	t.left, l.right = l.right, t
+	return l
+}
+
+func rotateLeft(t *node) *node {
+	r := t.right
+	t.right, r.left = r.left, t
+	return r
+}
+
+func insertNode(t, n *node) *node {
+	if t == nil {
+		return n
 	}
-	if ip4 := ip.To4(); ip4 != nil {
-		network := netw.IP.Mask(netw.Mask)
-		if ip.Equal(network) {
-			return true
+	if n.s.first.Less(t.s.first) {
+		t.left = insertNode(t.left, n)
+		if t.left.prio > t.prio {
+			t = rotateRight(t)
 		}
-		ones, bits := netw.Mask.Size()
-		if bits == 32 && ones < 31 {
-			var mask uint32 = binary.BigEndian.Uint32(netw.Mask)
-			var netInt uint32 = binary.BigEndian.Uint32(network.To4())
-			hostmask := ^mask
-			broadcast := netInt | hostmask
-			bcast := make(net.IP, 4)
-			binary.BigEndian.PutUint32(bcast, broadcast)
-			if ip.Equal(bcast) {
-				return true
-			}
+	} else {
+		t.right = insertNode(t.right, n)
+		if t.right.prio > t.prio {
+			t = rotateLeft(t)
+		}
+	}
+	return t
+}
+
+func mergeNodes(l, r *node) *node {
+	switch {
+	case l == nil:
+		return r
+	case r == nil:
+		return l
+	case l.prio > r.prio:
+		l.right = mergeNodes(l.right, r)
+		return l
+	default:
+		r.left = mergeNodes(l, r.left)
+		return r
+	}
+}
+
+func deleteNode(t *node, first netip.Addr) *node {
+	if t == nil {
+		return nil
+	}
+	switch {
+	case first.Less(t.s.first):
+		t.left = deleteNode(t.left, first)
+	case t.s.first.Less(first):
+		t.right = deleteNode(t.right, first)
+	default:
+		return mergeNodes(t.left, t.right)
+	}
+	return t
+}
+
+func (f *FreeList) insert(s span) {
+	f.root = insertNode(f.root, &node{s: s, prio: rand.Uint64()})
+	f.n++
+	f.touch(s.first)
+}
+
+func (f *FreeList) delete(first netip.Addr) {
+	f.root = deleteNode(f.root, first)
+	f.n--
+	f.touch(first)
+}
+
+// floor 返回 first <= a 的最后一个区间，没有时返回 nil
+func (f *FreeList) floor(a netip.Addr) *node {
+	var out *node
+	for t := f.root; t != nil; {
+		if a.Less(t.s.first) {
+			t = t.left
+		} else {
+			out, t = t, t.right
 		}
 	}
-	return false
+	return out
+}
+
+// ceil 返回 first > a 的第一个区间，没有时返回 nil
+func (f *FreeList) ceil(a netip.Addr) *node {
+	var out *node
+	for t := f.root; t != nil; {
+		if a.Less(t.s.first) {
+			out, t = t, t.left
+		} else {
+			t = t.right
+		}
+	}
+	return out
+}
+
+/* -------------------- 查询与修改 -------------------- */
+
+// Contains 判断地址是否空闲
+func (f *FreeList) Contains(a netip.Addr) bool {
+	t := f.floor(a)
+	return t != nil && !t.s.last.Less(a)
+}
+
+// Take 把地址标记为已占用；地址原本不空闲时返回 false。
+// 区间端点原地修改不会破坏顺序（区间互不相交）
+func (f *FreeList) Take(a netip.Addr) bool {
+	t := f.floor(a)
+	if t == nil || t.s.last.Less(a) {
+		return false
+	}
+	s := t.s
+	switch {
+	case s.first == a && s.last == a:
+		f.delete(a)
+	case s.first == a:
+		t.s.first = a.Next()
+		f.touch(a)
+		f.touch(t.s.first)
+	case s.last == a:
+		t.s.last = a.Prev()
+		f.touch(s.first)
+	default:
+		t.s.last = a.Prev()
+		f.touch(s.first)
+		f.insert(span{a.Next(), s.last})
+	}
+	return true
+}
+
+// Release 把地址放回空闲区间，并与相邻区间合并；调用方保证地址属于原先的可分配网段
+func (f *FreeList) Release(a netip.Addr) {
+	left := f.floor(a)
+	if left != nil && !left.s.last.Less(a) {
+		return
+	}
+	right := f.ceil(a)
+	joinLeft := left != nil && left.s.last.Next() == a
+	joinRight := right != nil && right.s.first.Prev() == a
+	switch {
+	case joinLeft && joinRight:
+		last := right.s.last
+		f.delete(right.s.first)
+		left.s.last = last
+		f.touch(left.s.first)
+	case joinLeft:
+		left.s.last = a
+		f.touch(left.s.first)
+	case joinRight:
+		f.touch(right.s.first)
+		right.s.first = a
+		f.touch(a)
+	default:
+		f.insert(span{a, a})
+	}
+}
+
+// First 返回最小的空闲地址
+func (f *FreeList) First() (netip.Addr, bool) {
+	t := f.root
+	if t == nil {
+		return netip.Addr{}, false
+	}
+	for t.left != nil {
+		t = t.left
+	}
+	return t.s.first, true
+}
+
+// last 返回最大的空闲地址
+func (f *FreeList) last() (netip.Addr, bool) {
+	t := f.root
+	if t == nil {
+		return netip.Addr{}, false
+	}
+	for t.right != nil {
+		t = t.right
+	}
+	return t.s.last, true
+}
+
+// NextFree 返回 >= a 的最小空闲地址
+func (f *FreeList) NextFree(a netip.Addr) (netip.Addr, bool) {
+	if t := f.floor(a); t != nil && !t.s.last.Less(a) {
+		return a, true
+	}
+	if t := f.ceil(a); t != nil {
+		return t.s.first, true
+	}
+	return netip.Addr{}, false
+}
+
+// Random 在首个与最后一个空闲地址之间均匀取一点，再取其后第一个空闲地址（到末尾则回到开头）。
+// 空闲地址稀疏（如 IPv6 /64）时近似均匀分布；r 为 nil 时用 crypto/rand
+func (f *FreeList) Random(r io.Reader) (netip.Addr, error) {
+	lo, ok := f.First()
+	if !ok {
+		return netip.Addr{}, ErrNoAvailableIP
+	}
+	hi, _ := f.last()
+	if r == nil {
+		r = crand.Reader
+	}
+	n := new(big.Int).Sub(addrInt(hi), addrInt(lo))
+	off, err := crand.Int(r, n.Add(n, big.NewInt(1)))
+	if err != nil {
+		return netip.Addr{}, err
+	}
+	x := intAddr(off.Add(off, addrInt(lo)), lo.BitLen())
+	if a, ok := f.NextFree(x); ok {
+		return a, nil
+	}
+	return lo, nil
+}
+
+// FirstIn 返回 ranges 内最小的空闲地址；ranges 须有序且互不重叠
+func (f *FreeList) FirstIn(ranges []netip.Prefix) (netip.Addr, bool) {
+	for _, p := range ranges {
+		if a, ok := f.nextFreeIn(p.Masked().Addr(), p); ok {
+			return a, true
+		}
+	}
+	return netip.Addr{}, false
 }
 
-func AllocateNextIP(cidr string, used map[string]struct{}, serverIP string) (string, error) {
-	_, netw, err := net.ParseCIDR(cidr)
+// RandomIn 在 ranges 内均匀取一点，再取其后（ranges 内）第一个空闲地址，到末尾则回到开头；
+// ranges 须有序且互不重叠，r 为 nil 时用 crypto/rand
+func (f *FreeList) RandomIn(ranges []netip.Prefix, r io.Reader) (netip.Addr, error) {
+	if len(ranges) == 0 {
+		return netip.Addr{}, ErrNoAvailableIP
+	}
+	sizes := make([]*big.Int, len(ranges))
+	total := new(big.Int)
+	for i, p := range ranges {
+		sizes[i] = new(big.Int).Lsh(big.NewInt(1), uint(p.Addr().BitLen()-p.Bits()))
+		total.Add(total, sizes[i])
+	}
+	if r == nil {
+		r = crand.Reader
+	}
+	off, err := crand.Int(r, total)
 	if err != nil {
-		return "", err
+		return netip.Addr{}, err
 	}
-	for ip := nextIP(netw.IP); netw.Contains(ip); ip = nextIP(ip) {
-		if isReserved(ip, netw, serverIP) {
-			continue
+	start := 0
+	for off.Cmp(sizes[start]) >= 0 {
+		off.Sub(off, sizes[start])
+		start++
+	}
+	p := ranges[start].Masked()
+	x := intAddr(off.Add(off, addrInt(p.Addr())), p.Addr().BitLen())
+	if a, ok := f.nextFreeIn(x, p); ok {
+		return a, nil
+	}
+	for i := 1; i <= len(ranges); i++ {
+		p := ranges[(start+i)%len(ranges)].Masked()
+		if a, ok := f.nextFreeIn(p.Addr(), p); ok {
+			return a, nil
 		}
-		if _, taken := used[ip.String()]; !taken {
-			return ip.String(), nil
+	}
+	return netip.Addr{}, ErrNoAvailableIP
+}
+
+// nextFreeIn 返回 p 内 >= a 的最小空闲地址
+func (f *FreeList) nextFreeIn(a netip.Addr, p netip.Prefix) (netip.Addr, bool) {
+	n, ok := f.NextFree(a)
+	if !ok || !p.Contains(n) {
+		return netip.Addr{}, false
+	}
+	return n, true
+}
+
+// Spans 返回空闲区间数
+func (f *FreeList) Spans() int {
+	return f.n
+}
+
+// Size 返回空闲地址总数（遍历全部区间）
+func (f *FreeList) Size() *big.Int {
+	n := new(big.Int)
+	one := big.NewInt(1)
+	var walk func(t *node)
+	walk = func(t *node) {
+		if t == nil {
+			return
 		}
+		walk(t.left)
+		d := new(big.Int).Sub(addrInt(t.s.last), addrInt(t.s.first))
+		n.Add(n, d.Add(d, one))
+		walk(t.right)
 	}
-	return "", ErrNoAvailableIP
+	walk(f.root)
+	return n
+}
+
+/* -------------------- 地址运算 -------------------- */
+
+func lastAddr(p netip.Prefix) netip.Addr {
+	b := p.Addr().AsSlice()
+	for i := p.Bits(); i < len(b)*8; i++ {
+		b[i/8] |= 0x80 >> (i % 8)
+	}
+	a, _ := netip.AddrFromSlice(b)
+	return a
+}
+
+func addrInt(a netip.Addr) *big.Int {
+	return new(big.Int).SetBytes(a.AsSlice())
+}
+
+func intAddr(n *big.Int, bits int) netip.Addr {
+	b := n.FillBytes(make([]byte, bits/8))
+	a, _ := netip.AddrFromSlice(b)
+	return a
 }
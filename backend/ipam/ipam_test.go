@@ -0,0 +1,337 @@
+package ipam
+
+import (
+	"bytes"
+	"fmt"
+	"math/rand/v2"
+	"net/netip"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func prefixes(s string) []netip.Prefix {
+	var out []netip.Prefix
+	for _, x := range strings.Split(s, ",") {
+		if x = strings.TrimSpace(x); x != "" {
+			out = append(out, netip.MustParsePrefix(x))
+		}
+	}
+	return out
+}
+
+func addrs(s string) []netip.Addr {
+	var out []netip.Addr
+	for _, x := range strings.Split(s, ",") {
+		if x = strings.TrimSpace(x); x != "" {
+			out = append(out, netip.MustParseAddr(x))
+		}
+	}
+	return out
+}
+
+// dump 按顺序列出空闲区间，便于比较
+func dump(f *FreeList) string {
+	var parts []string
+	var walk func(t *node)
+	walk = func(t *node) {
+		if t == nil {
+			return
+		}
+		walk(t.left)
+		if t.s.first == t.s.last {
+			parts = append(parts, t.s.first.String())
+		} else {
+			parts = append(parts, t.s.first.String()+"-"+t.s.last.String())
+		}
+		walk(t.right)
+	}
+	walk(f.root)
+	return strings.Join(parts, ",")
+}
+
+func TestNewFreeList(t *testing.T) {
+	tests := []struct {
+		name   string
+		ranges string
+		taken  string
+		want   string
+		size   int64
+	}{
+		{"empty", "", "", "", 0},
+		{"whole /30", "10.0.0.0/30", "", "10.0.0.0-10.0.0.3", 4},
+		{"taken split", "10.0.0.0/29", "10.0.0.0, 10.0.0.3, 10.0.0.7", "10.0.0.1-10.0.0.2,10.0.0.4-10.0.0.6", 5},
+		{"duplicates and outside", "10.0.0.0/30", "10.0.0.1, 10.0.0.1, 192.168.0.1, fd00::1", "10.0.0.0,10.0.0.2-10.0.0.3", 3},
+		{"overlapping ranges merge", "10.0.0.0/30, 10.0.0.2/31, 10.0.0.4/30", "", "10.0.0.0-10.0.0.7", 8},
+		{"families stay apart", "10.0.0.0/31, fd00::/127", "fd00::", "10.0.0.0-10.0.0.1,fd00::1", 3},
+		{"all taken", "10.0.0.0/31", "10.0.0.0, 10.0.0.1", "", 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := NewFreeList(prefixes(tt.ranges), addrs(tt.taken))
+			if got := dump(f); got != tt.want {
+				t.Fatalf("spans: got %q, want %q", got, tt.want)
+			}
+			if got := f.Size().Int64(); got != tt.size {
+				t.Fatalf("size: got %d, want %d", got, tt.size)
+			}
+		})
+	}
+}
+
+func TestFreeListTakeRelease(t *testing.T) {
+	type op struct {
+		take bool // false 为 Release
+		addr string
+		ok   bool // Take 的返回值
+	}
+	tests := []struct {
+		name string
+		ops  []op
+		want string
+	}{
+		{"take first", []op{{true, "10.0.0.0", true}}, "10.0.0.1-10.0.0.7"},
+		{"take last", []op{{true, "10.0.0.7", true}}, "10.0.0.0-10.0.0.6"},
+		{"take middle splits", []op{{true, "10.0.0.3", true}}, "10.0.0.0-10.0.0.2,10.0.0.4-10.0.0.7"},
+		{"take twice", []op{{true, "10.0.0.3", true}, {true, "10.0.0.3", false}}, "10.0.0.0-10.0.0.2,10.0.0.4-10.0.0.7"},
+		{"take outside", []op{{true, "10.0.1.0", false}}, "10.0.0.0-10.0.0.7"},
+		{
+			"release rejoins both sides",
+			[]op{{true, "10.0.0.3", true}, {false, "10.0.0.3", true}},
+			"10.0.0.0-10.0.0.7",
+		},
+		{
+			"release joins left",
+			[]op{{true, "10.0.0.3", true}, {true, "10.0.0.4", true}, {false, "10.0.0.3", true}},
+			"10.0.0.0-10.0.0.3,10.0.0.5-10.0.0.7",
+		},
+		{
+			"release joins right",
+			[]op{{true, "10.0.0.3", true}, {true, "10.0.0.4", true}, {false, "10.0.0.4", true}},
+			"10.0.0.0-10.0.0.2,10.0.0.4-10.0.0.7",
+		},
+		{
+			"release isolated",
+			[]op{{true, "10.0.0.2", true}, {true, "10.0.0.3", true}, {true, "10.0.0.4", true}, {false, "10.0.0.3", true}},
+			"10.0.0.0-10.0.0.1,10.0.0.3,10.0.0.5-10.0.0.7",
+		},
+		{"release free address is a no-op", []op{{false, "10.0.0.3", true}}, "10.0.0.0-10.0.0.7"},
+		{
+			"drain single-address span",
+			[]op{{true, "10.0.0.1", true}, {true, "10.0.0.0", true}},
+			"10.0.0.2-10.0.0.7",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := NewFreeList(prefixes("10.0.0.0/29"), nil)
+			saved := f.Snapshot()
+			f.Track()
+			for _, o := range tt.ops {
+				a := netip.MustParseAddr(o.addr)
+				if o.take {
+					if got := f.Take(a); got != o.ok {
+						t.Fatalf("Take(%s) = %v, want %v", a, got, o.ok)
+					}
+				} else {
+					f.Release(a)
+				}
+			}
+			if got := dump(f); got != tt.want {
+				t.Fatalf("got %q, want %q", got, tt.want)
+			}
+			// 把增量变化应用到操作前的快照上，应得到同样的区间
+			if got := dump(FromSpans(patch(saved, f))); got != tt.want {
+				t.Fatalf("patched snapshot = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// patch 按 Changes 的结果更新快照，模拟持久化的增量写入
+func patch(saved []Span, f *FreeList) []Span {
+	byFirst := map[netip.Addr]netip.Addr{}
+	for _, s := range saved {
+		byFirst[s.First] = s.Last
+	}
+	set, removed := f.Changes()
+	for _, a := range removed {
+		delete(byFirst, a)
+	}
+	for _, s := range set {
+		byFirst[s.First] = s.Last
+	}
+	var out []Span
+	for first, last := range byFirst {
+		out = append(out, Span{first, last})
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].First.Less(out[j].First) })
+	return out
+}
+
+func TestFreeListQueries(t *testing.T) {
+	f := NewFreeList(prefixes("10.0.0.0/29"), addrs("10.0.0.0, 10.0.0.1, 10.0.0.4"))
+	if a, ok := f.First(); !ok || a.String() != "10.0.0.2" {
+		t.Fatalf("First = %v, %v", a, ok)
+	}
+	tests := []struct {
+		addr     string
+		contains bool
+		next     string
+	}{
+		{"10.0.0.0", false, "10.0.0.2"},
+		{"10.0.0.2", true, "10.0.0.2"},
+		{"10.0.0.4", false, "10.0.0.5"},
+		{"10.0.0.7", true, "10.0.0.7"},
+		{"10.0.0.8", false, ""},
+	}
+	for _, tt := range tests {
+		a := netip.MustParseAddr(tt.addr)
+		if got := f.Contains(a); got != tt.contains {
+			t.Errorf("Contains(%s) = %v", a, got)
+		}
+		got := ""
+		if next, ok := f.NextFree(a); ok {
+			got = next.String()
+		}
+		if got != tt.next {
+			t.Errorf("NextFree(%s) = %q, want %q", a, got, tt.next)
+		}
+	}
+}
+
+func TestFreeListRandom(t *testing.T) {
+	f := NewFreeList(prefixes("fd00::/64"), addrs("fd00::"))
+	seen := map[netip.Addr]bool{}
+	for i := 0; i < 100; i++ {
+		a, err := f.Random(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !f.Take(a) || seen[a] {
+			t.Fatalf("random returned taken address %s", a)
+		}
+		seen[a] = true
+	}
+
+	// 随机点落在末尾之后时回到开头
+	small := NewFreeList(prefixes("10.0.0.0/30"), addrs("10.0.0.1, 10.0.0.2"))
+	a, err := small.Random(bytes.NewReader(bytes.Repeat([]byte{0xff}, 64)))
+	if err != nil || (a.String() != "10.0.0.0" && a.String() != "10.0.0.3") {
+		t.Fatalf("random = %v, %v", a, err)
+	}
+	if _, err := NewFreeList(nil, nil).Random(nil); err != ErrNoAvailableIP {
+		t.Fatalf("empty list: got %v", err)
+	}
+}
+
+func TestFreeListIn(t *testing.T) {
+	f := NewFreeList(prefixes("10.0.0.0/24"), addrs("10.0.0.0, 10.0.0.1, 10.0.0.16, 10.0.0.17"))
+	tests := []struct {
+		ranges string
+		want   string
+	}{
+		{"10.0.0.0/24", "10.0.0.2"},
+		{"10.0.0.16/30", "10.0.0.18"},
+		{"10.0.0.16/31, 10.0.0.64/26", "10.0.0.64"},
+		{"10.0.0.0/31, 10.0.0.16/31", ""},
+		{"10.0.1.0/24", ""},
+	}
+	for _, tt := range tests {
+		got := ""
+		if a, ok := f.FirstIn(prefixes(tt.ranges)); ok {
+			got = a.String()
+		}
+		if got != tt.want {
+			t.Errorf("FirstIn(%s) = %q, want %q", tt.ranges, got, tt.want)
+		}
+	}
+
+	ranges := prefixes("10.0.0.16/30, 10.0.0.128/30")
+	for i := 0; i < 6; i++ {
+		a, err := f.RandomIn(ranges, nil)
+		if err != nil {
+			t.Fatalf("RandomIn #%d: %v", i, err)
+		}
+		if !f.Take(a) || !(ranges[0].Contains(a) || ranges[1].Contains(a)) {
+			t.Fatalf("RandomIn returned %s", a)
+		}
+	}
+	if a, err := f.RandomIn(ranges, nil); err != ErrNoAvailableIP {
+		t.Fatalf("exhausted ranges: got %v, %v", a, err)
+	}
+}
+
+// addrAt 返回前缀内偏移 off 处的地址（off 只取低 64 位）
+func addrAt(p netip.Prefix, off uint64) netip.Addr {
+	b := p.Masked().Addr().AsSlice()
+	for i := len(b) - 1; i >= 0 && off > 0; i-- {
+		sum := uint64(b[i]) + off&0xff
+		b[i] = byte(sum)
+		off = off>>8 + sum>>8
+	}
+	a, _ := netip.AddrFromSlice(b)
+	return a
+}
+
+func BenchmarkAllocate(b *testing.B) {
+	cases := []struct {
+		name   string
+		prefix string
+		taken  func(p netip.Prefix) []netip.Addr
+		random bool
+	}{
+		{
+			// /64 上 10 万个随机分布的 peer：空闲区间数与 peer 数同量级
+			name:   "ipv6 /64 with 100k peers",
+			prefix: "fd00:1::/64",
+			taken: func(p netip.Prefix) []netip.Addr {
+				r := rand.New(rand.NewPCG(1, 2))
+				out := make([]netip.Addr, 100_000)
+				for i := range out {
+					out[i] = addrAt(p, r.Uint64())
+				}
+				return out
+			},
+			random: true,
+		},
+		{
+			// /16 只剩每 512 个地址空一个：首个空闲地址之前有大量碎片
+			name:   "ipv4 /16 nearly full",
+			prefix: "10.0.0.0/16",
+			taken: func(p netip.Prefix) []netip.Addr {
+				var out []netip.Addr
+				for i := uint64(0); i < 1<<16; i++ {
+					if i%512 != 511 {
+						out = append(out, addrAt(p, i))
+					}
+				}
+				return out
+			},
+		},
+	}
+	for _, c := range cases {
+		p := netip.MustParsePrefix(c.prefix)
+		f := NewFreeList([]netip.Prefix{p}, c.taken(p))
+		b.Run(fmt.Sprintf("%s (%d spans)", c.name, f.Spans()), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				var a netip.Addr
+				if c.random {
+					var err error
+					if a, err = f.Random(nil); err != nil {
+						b.Fatal(err)
+					}
+				} else {
+					var ok bool
+					if a, ok = f.First(); !ok {
+						b.Fatal("pool exhausted")
+					}
+				}
+				if !f.Take(a) {
+					b.Fatalf("take %s", a)
+				}
+				f.Release(a) // 保持空闲区间规模不变
+			}
+		})
+	}
+}
@@ -0,0 +1,203 @@
+package keystore
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// 密文格式：enc:v1:<主密钥ID>:<被主密钥包裹的数据密钥>:<数据密文>
+// 每个字段使用独立的随机数据密钥（信封加密），主密钥只用于包裹数据密钥
+const prefix = "enc:v1:"
+
+const keySize = 32 // AES-256
+
+var (
+	ErrUnknownKey = errors.New("secret encrypted with unknown master key")
+	ErrMalformed  = errors.New("malformed encrypted secret")
+)
+
+type masterKey struct {
+	id   string
+	aead cipher.AEAD
+}
+
+// Keyring 持有当前主密钥及轮换前的旧主密钥（仅用于解密）
+type Keyring struct {
+	current *masterKey
+	keys    map[string]*masterKey
+}
+
+// Load 按优先级读取主密钥：key（base64）> keyFile；previous 为逗号分隔的旧密钥（base64）。
+// 未配置任何主密钥时返回 (nil, nil)，调用方按明文模式运行
+func Load(key, keyFile, previous string) (*Keyring, error) {
+	raw := strings.TrimSpace(key)
+	if raw == "" && strings.TrimSpace(keyFile) != "" {
+		b, err := os.ReadFile(strings.TrimSpace(keyFile))
+		if err != nil {
+			return nil, fmt.Errorf("read master key file: %w", err)
+		}
+		raw = strings.TrimSpace(string(b))
+	}
+	if raw == "" {
+		return nil, nil
+	}
+
+	cur, err := newMasterKey(raw)
+	if err != nil {
+		return nil, fmt.Errorf("master key: %w", err)
+	}
+	kr := &Keyring{current: cur, keys: map[string]*masterKey{cur.id: cur}}
+	for _, p := range strings.Split(previous, ",") {
+		if p = strings.TrimSpace(p); p == "" {
+			continue
+		}
+		old, err := newMasterKey(p)
+		if err != nil {
+			return nil, fmt.Errorf("previous master key: %w", err)
+		}
+		kr.keys[old.id] = old
+	}
+	return kr, nil
+}
+
+// GenerateKey 生成一个新的 base64 主密钥（供 CLI 使用）
+func GenerateKey() (string, error) {
+	b := make([]byte, keySize)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(b), nil
+}
+
+func newMasterKey(b64 string) (*masterKey, error) {
+	b, err := base64.StdEncoding.DecodeString(b64)
+	if err != nil {
+		return nil, fmt.Errorf("expect base64: %w", err)
+	}
+	if len(b) != keySize {
+		return nil, fmt.Errorf("expect %d bytes, got %d", keySize, len(b))
+	}
+	aead, err := newAEAD(b)
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(b)
+	return &masterKey{id: hex.EncodeToString(sum[:4]), aead: aead}, nil
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// seal 输出 nonce||ciphertext
+func seal(aead cipher.AEAD, plaintext, aad []byte) ([]byte, error) {
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return aead.Seal(nonce, nonce, plaintext, aad), nil
+}
+
+func open(aead cipher.AEAD, data, aad []byte) ([]byte, error) {
+	if len(data) < aead.NonceSize() {
+		return nil, ErrMalformed
+	}
+	return aead.Open(nil, data[:aead.NonceSize()], data[aead.NonceSize():], aad)
+}
+
+// CurrentID 返回当前主密钥 ID（sha256 前 4 字节）
+func (k *Keyring) CurrentID() string { return k.current.id }
+
+// IsEncrypted 判断值是否为本包产生的密文
+func IsEncrypted(v string) bool { return strings.HasPrefix(v, prefix) }
+
+// KeyID 返回密文使用的主密钥 ID；明文返回空串
+func KeyID(v string) string {
+	if !IsEncrypted(v) {
+		return ""
+	}
+	parts := strings.SplitN(strings.TrimPrefix(v, prefix), ":", 3)
+	return parts[0]
+}
+
+// Encrypt 使用新数据密钥加密，并用当前主密钥包裹数据密钥；空串原样返回
+func (k *Keyring) Encrypt(plaintext string) (string, error) {
+	if plaintext == "" {
+		return "", nil
+	}
+	dek := make([]byte, keySize)
+	if _, err := rand.Read(dek); err != nil {
+		return "", err
+	}
+	wrapped, err := seal(k.current.aead, dek, []byte(k.current.id))
+	if err != nil {
+		return "", fmt.Errorf("wrap data key: %w", err)
+	}
+	dekAEAD, err := newAEAD(dek)
+	if err != nil {
+		return "", err
+	}
+	ct, err := seal(dekAEAD, []byte(plaintext), wrapped)
+	if err != nil {
+		return "", fmt.Errorf("encrypt secret: %w", err)
+	}
+	enc := base64.RawStdEncoding
+	return prefix + k.current.id + ":" + enc.EncodeToString(wrapped) + ":" + enc.EncodeToString(ct), nil
+}
+
+// Decrypt 解密密文；明文（历史数据）原样返回
+func (k *Keyring) Decrypt(v string) (string, error) {
+	if !IsEncrypted(v) {
+		return v, nil
+	}
+	parts := strings.Split(strings.TrimPrefix(v, prefix), ":")
+	if len(parts) != 3 {
+		return "", ErrMalformed
+	}
+	mk, ok := k.keys[parts[0]]
+	if !ok {
+		return "", fmt.Errorf("%w: %s", ErrUnknownKey, parts[0])
+	}
+	enc := base64.RawStdEncoding
+	wrapped, err := enc.DecodeString(parts[1])
+	if err != nil {
+		return "", ErrMalformed
+	}
+	ct, err := enc.DecodeString(parts[2])
+	if err != nil {
+		return "", ErrMalformed
+	}
+	dek, err := open(mk.aead, wrapped, []byte(mk.id))
+	if err != nil {
+		return "", fmt.Errorf("unwrap data key: %w", err)
+	}
+	dekAEAD, err := newAEAD(dek)
+	if err != nil {
+		return "", err
+	}
+	pt, err := open(dekAEAD, ct, wrapped)
+	if err != nil {
+		return "", fmt.Errorf("decrypt secret: %w", err)
+	}
+	return string(pt), nil
+}
+
+// NeedsRewrap 明文或非当前主密钥加密的值需要重新加密
+func (k *Keyring) NeedsRewrap(v string) bool {
+	if v == "" {
+		return false
+	}
+	return KeyID(v) != k.current.id
+}
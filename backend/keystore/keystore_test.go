@@ -0,0 +1,176 @@
+package keystore
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func mustKey(t *testing.T) string {
+	t.Helper()
+	k, err := GenerateKey()
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	return k
+}
+
+func mustLoad(t *testing.T, key, previous string) *Keyring {
+	t.Helper()
+	kr, err := Load(key, "", previous)
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	return kr
+}
+
+func TestEncryptDecrypt(t *testing.T) {
+	kr := mustLoad(t, mustKey(t), "")
+	tests := []struct {
+		name      string
+		plaintext string
+	}{
+		{"empty stays empty", ""},
+		{"wireguard key", "yAnz5TF+lXXJte14tji3zlMNq+hd2rYUIgJBgB3fBmk="},
+		{"unicode", "密钥 with : separators"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ct, err := kr.Encrypt(tt.plaintext)
+			if err != nil {
+				t.Fatalf("encrypt: %v", err)
+			}
+			if tt.plaintext == "" {
+				if ct != "" {
+					t.Fatalf("empty plaintext encrypted to %q", ct)
+				}
+				return
+			}
+			if !IsEncrypted(ct) || KeyID(ct) != kr.CurrentID() || strings.Contains(ct, tt.plaintext) {
+				t.Fatalf("unexpected ciphertext %q", ct)
+			}
+			pt, err := kr.Decrypt(ct)
+			if err != nil || pt != tt.plaintext {
+				t.Fatalf("decrypt: got %q, %v", pt, err)
+			}
+		})
+	}
+
+	// 明文（历史数据）原样返回
+	if pt, err := kr.Decrypt("plain"); err != nil || pt != "plain" {
+		t.Fatalf("decrypt plaintext: got %q, %v", pt, err)
+	}
+}
+
+func TestDecryptErrors(t *testing.T) {
+	kr := mustLoad(t, mustKey(t), "")
+	other := mustLoad(t, mustKey(t), "")
+	ct, err := kr.Encrypt("secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	parts := strings.Split(ct, ":")
+	tampered := strings.Join(append(parts[:len(parts)-1], "AAAA"+parts[len(parts)-1][4:]), ":")
+
+	tests := []struct {
+		name string
+		kr   *Keyring
+		v    string
+		want error
+	}{
+		{"unknown master key", other, ct, ErrUnknownKey},
+		{"missing field", kr, prefix + kr.CurrentID() + ":abc", ErrMalformed},
+		{"bad base64", kr, prefix + kr.CurrentID() + ":!!:!!", ErrMalformed},
+		{"tampered ciphertext", kr, tampered, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := tt.kr.Decrypt(tt.v)
+			if err == nil {
+				t.Fatal("expected error")
+			}
+			if tt.want != nil && !errors.Is(err, tt.want) {
+				t.Fatalf("got %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestRewrap(t *testing.T) {
+	oldKey, newKey := mustKey(t), mustKey(t)
+	old := mustLoad(t, oldKey, "")
+	rotated := mustLoad(t, newKey, oldKey)
+
+	ct, err := old.Encrypt("secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fresh, err := rotated.Encrypt("secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		v     string
+		needs bool
+	}{
+		{"empty", "", false},
+		{"plaintext", "secret", true},
+		{"previous master key", ct, true},
+		{"current master key", fresh, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := rotated.NeedsRewrap(tt.v); got != tt.needs {
+				t.Fatalf("NeedsRewrap = %v, want %v", got, tt.needs)
+			}
+			if !tt.needs {
+				return
+			}
+			// 重新加密：旧密钥仍可解密，新密文只依赖当前主密钥
+			pt, err := rotated.Decrypt(tt.v)
+			if err != nil {
+				t.Fatalf("decrypt with previous key: %v", err)
+			}
+			again, err := rotated.Encrypt(pt)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if rotated.NeedsRewrap(again) || KeyID(again) != rotated.CurrentID() {
+				t.Fatalf("rewrapped value still needs rewrap: %q", again)
+			}
+			onlyNew := mustLoad(t, newKey, "")
+			if pt2, err := onlyNew.Decrypt(again); err != nil || pt2 != "secret" {
+				t.Fatalf("decrypt rewrapped without previous key: %q, %v", pt2, err)
+			}
+		})
+	}
+}
+
+func TestLoad(t *testing.T) {
+	tests := []struct {
+		name     string
+		key      string
+		previous string
+		nilRing  bool
+		wantErr  bool
+	}{
+		{name: "not configured", nilRing: true},
+		{name: "not base64", key: "!!", wantErr: true},
+		{name: "wrong length", key: "AAAA", wantErr: true},
+		{name: "bad previous key", key: mustKey(t), previous: "AAAA", wantErr: true},
+		{name: "ok", key: mustKey(t), previous: " , " + mustKey(t)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			kr, err := Load(tt.key, "", tt.previous)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && (kr == nil) != tt.nilRing {
+				t.Fatalf("keyring = %v, want nil %v", kr, tt.nilRing)
+			}
+		})
+	}
+}
@@ -3,13 +3,19 @@ package main
 import (
 	"backend/config"
 	"backend/database"
+	"backend/keystore"
+	"backend/repository"
 	"backend/routes"
 	"backend/services"
 	"backend/websocket"
+	"context"
+	"database/sql"
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
 	"log"
 	"os"
+	"path/filepath"
+	"strings"
 	"time"
 )
 
@@ -18,12 +24,25 @@ func main() {
 	// Load configuration
 	cfg := config.Load()
 
+	// 子命令（如 genkey / rotate-keys），执行完即退出
+	if len(os.Args) > 1 {
+		if err := runCommand(cfg, os.Args[1:]); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
 	// 初始化数据库
 	db, err := database.Initialize(cfg.DatabaseURL)
 	if err != nil {
 		log.Fatal("Failed to initialize database:", err)
 	}
 
+	store, keys, err := openStore(db, cfg)
+	if err != nil {
+		log.Fatal("Failed to load master key:", err)
+	}
+
 	// 创建路由器
 	router := gin.Default()
 	// ① 全局 CORS（一定要在注册路由前 Use）
@@ -39,14 +58,59 @@ func main() {
 
 	// Initialize services
 	authService := services.NewAuthService(db, cfg.JWTSecret)
-	wgService := services.NewWireGuardService(db)
+	wgService := newWireGuardService(store, cfg)
+	if cfg.WriteConf {
+		log.Printf("Writing wg-quick configs to %s", cfg.WGConfDir)
+	}
+	if cfg.ManageFirewall {
+		wgService.CheckFirewallConflicts()
+	}
+	systemService := services.NewSystemService(store, keys)
+	backupService := services.NewBackupService(db, store, keys, wgService, cfg.BackupDir)
+	stateService := services.NewStateService(store, wgService)
+	importService := services.NewImportService(store, wgService, cfg.WGConfDir)
+	alertService := services.NewAlertService(store, wgService, authService, databaseDir(cfg.DatabaseURL))
+
+	// 启动时从 wg-quick 配置目录导入（需显式开启，已存在的接口/peer 不会被修改）
+	if cfg.SyncOnBoot {
+		reports, err := importService.ImportDir(context.Background(), cfg.WGConfDir, services.ImportOptions{Policy: services.ImportSkip})
+		if err != nil {
+			log.Printf("Warning: Could not import configs from %s: %v", cfg.WGConfDir, err)
+		}
+		for _, r := range reports {
+			log.Printf("Imported %s: %s, %d peer(s)", r.Interface, r.Action, len(r.Peers))
+		}
+	}
+
+	// 定时备份（BACKUP_DIR + BACKUP_INTERVAL 均配置时启用）
+	if cfg.BackupDir != "" && cfg.BackupInterval > 0 {
+		go backupService.RunSchedule(context.Background(), cfg.BackupInterval, cfg.BackupRetention, cfg.BackupPassphrase)
+		log.Printf("Scheduled backups every %s to %s (keep %d)", cfg.BackupInterval, cfg.BackupDir, cfg.BackupRetention)
+	}
+
+	// 客户端模式接口的握手监控与 endpoint 重新解析
+	if cfg.ClientMonitorInterval > 0 {
+		go wgService.RunClientMonitor(context.Background(), cfg.ClientMonitorInterval)
+	}
+	// 服务端 peer 的主机名 endpoint 定期重新解析
+	if cfg.EndpointResolveInterval > 0 {
+		go wgService.RunEndpointResolver(context.Background(), cfg.EndpointResolveInterval)
+	}
+	// peer 上下线时段、last seen 与 stale 处理
+	if cfg.PeerMonitorInterval > 0 {
+		go wgService.RunPeerMonitor(context.Background(), cfg.PeerMonitorInterval)
+	}
+	// 告警规则评估与通知
+	if cfg.AlertInterval > 0 {
+		go alertService.RunSchedule(context.Background(), cfg.AlertInterval)
+	}
 
 	// Initialize WebSocket hub
 	hub := websocket.NewHub()
 	go hub.Run()
 
 	// 设置路由
-	routes.SetupRoutes(router, authService, wgService, hub)
+	routes.SetupRoutes(router, authService, wgService, systemService, backupService, stateService, importService, alertService, hub)
 
 	// Start server
 	port := os.Getenv("PORT")
@@ -62,3 +126,59 @@ func main() {
 	}
 
 }
+
+// 构造仓储；配置了主密钥时启用私钥加密，并把明文/旧主密钥加密的行迁移到当前主密钥
+func openStore(db *sql.DB, cfg *config.Config) (*repository.SQLStore, *keystore.Keyring, error) {
+	store := repository.NewSQLStore(db)
+	keys, err := keystore.Load(cfg.MasterKey, cfg.MasterKeyFile, cfg.PreviousMasterKeys)
+	if err != nil {
+		return nil, nil, err
+	}
+	if keys == nil {
+		log.Println("Warning: WG_MASTER_KEY / WG_MASTER_KEY_FILE not set, private keys are stored in plaintext")
+		return store, nil, nil
+	}
+
+	store = store.WithCipher(keys)
+	n, err := store.RewrapSecrets(context.Background(), false)
+	if err != nil {
+		return nil, nil, err
+	}
+	if n > 0 {
+		log.Printf("Encrypted %d secret(s) with master key %s", n, keys.CurrentID())
+	}
+	return store, keys, nil
+}
+
+// databaseDir 返回 SQLite 数据库文件所在目录（disk_low 告警的默认检查路径）
+func databaseDir(dsn string) string {
+	dsn = strings.TrimPrefix(dsn, "file:")
+	if i := strings.IndexByte(dsn, '?'); i >= 0 {
+		dsn = dsn[:i]
+	}
+	return filepath.Dir(dsn)
+}
+
+// 构造 WireGuardService；WG_WRITE_CONF 开启时变更后写回 <name>.conf
+func newWireGuardService(store *repository.SQLStore, cfg *config.Config) *services.WireGuardService {
+	wg := services.NewWireGuardServiceWithStore(store)
+	wg.SetIPQuarantine(cfg.IPQuarantine)
+	wg.SetRandomIPv6(cfg.RandomIPv6)
+	if !cfg.CheckHostRoutes {
+		wg.SetNetworkBackend(nil)
+	}
+	if !cfg.ManageFirewall {
+		wg.SetFirewall(nil)
+	}
+	wg.SetHooks(!cfg.DisableHooks, cfg.HookTimeout)
+	wg.SetPeerHealthPolicy(services.PeerHealthPolicy{
+		OnlineThreshold:  cfg.PeerOnlineThreshold,
+		StaleAfter:       time.Duration(cfg.PeerStaleDays) * 24 * time.Hour,
+		AutoDisable:      cfg.PeerStaleAutoDisable,
+		SessionRetention: cfg.PeerSessionRetention,
+	})
+	if cfg.WriteConf {
+		wg.SetConfWriter(services.NewConfWriter(cfg.WGConfDir, store))
+	}
+	return wg
+}
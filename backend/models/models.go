@@ -4,10 +4,16 @@ import (
 	"time"
 )
 
+const (
+	RoleAdmin = "admin" // 可查看私钥、修改敏感配置
+	RoleUser  = "user"
+)
+
 type User struct {
 	ID           int       `json:"id" db:"id"`
 	Username     string    `json:"username" db:"username"`
 	PasswordHash string    `json:"-" db:"password_hash"`
+	Role         string    `json:"role" db:"role"`
 	CreatedAt    time.Time `json:"created_at" db:"created_at"`
 	UpdatedAt    time.Time `json:"updated_at" db:"updated_at"`
 }
@@ -15,39 +21,376 @@ type User struct {
 type WireGuardInterface struct {
 	ID         int       `json:"id" db:"id"`
 	Name       string    `json:"name" db:"name"`
-	PrivateKey string    `json:"private_key" db:"private_key"`
+	PrivateKey string    `json:"private_key,omitempty" db:"private_key"`
 	PublicKey  string    `json:"public_key" db:"public_key"`
-	Address    string    `json:"address" db:"address"`
+	Address    string    `json:"address" db:"address"` // 逗号分隔，每个地址族至多一个：10.8.0.1/24, fd00:8::1/64
 	ListenPort int       `json:"listen_port" db:"listen_port"`
 	DNS        string    `json:"dns" db:"dns"`
 	MTU        int       `json:"mtu" db:"mtu"`
+	CIDR       string    `json:"cidr" db:"cidr"`           // 由 address 派生，顺序相同
+	ServerIP   string    `json:"server_ip" db:"server_ip"` // 由 address 派生，顺序相同
 	Endpoint   string    `db:"endpoint" json:"endpoint"`
 	Mode       string    `db:"mode" json:"mode"`
 	Status     string    `json:"status" db:"status"`
 	CreatedAt  time.Time `json:"created_at" db:"created_at"`
 	UpdatedAt  time.Time `json:"updated_at" db:"updated_at"`
+
+	// wg-quick 兼容的 hook，每行一条命令，%i 替换为接口名；仅管理员可设置
+	PreUp    string `json:"pre_up" db:"pre_up"`
+	PostUp   string `json:"post_up" db:"post_up"`
+	PreDown  string `json:"pre_down" db:"pre_down"`
+	PostDown string `json:"post_down" db:"post_down"`
+
+	// 站点间互联：本端局域网网段（逗号分隔），写入 site 类型 peer 的对端配置
+	LocalSubnets string `json:"local_subnets" db:"local_subnets"`
+}
+
+// 接口模式
+const (
+	InterfaceModeServer = "server" // 作为服务端接受 peer 连接
+	InterfaceModeClient = "client" // 作为客户端拨向远端服务端（ClientRemote），没有 peer
+)
+
+// 客户端模式的路由表（同 wg-quick 的 Table）；其余取值为路由表编号
+const (
+	RouteTableAuto = "auto" // AllowedIPs 含默认路由时走 fwmark 策略路由，其余网段加到 main 表
+	RouteTableOff  = "off"  // 不加路由
+)
+
+// ClientRemote 是客户端模式接口的远端服务端，即配置中唯一的 [Peer]
+type ClientRemote struct {
+	InterfaceID         int       `json:"interface_id" db:"interface_id"`
+	PublicKey           string    `json:"public_key" db:"public_key"`
+	PresharedKey        string    `json:"preshared_key,omitempty" db:"preshared_key"`
+	Endpoint            string    `json:"endpoint" db:"endpoint"`       // host:port；主机名在下发与重连时解析
+	AllowedIPs          string    `json:"allowed_ips" db:"allowed_ips"` // 走隧道的网段
+	PersistentKeepalive int       `json:"persistent_keepalive" db:"persistent_keepalive"`
+	Table               string    `json:"table" db:"route_table"` // auto / off / 路由表编号
+	FwMark              int       `json:"fwmark" db:"fwmark"`     // 0：需要策略路由时自动取 51820 + 接口 ID
+	UpdatedAt           time.Time `json:"updated_at" db:"updated_at"`
+}
+
+// ClientStatus 是客户端模式接口的连接状态（握手健康与重连）
+type ClientStatus struct {
+	InterfaceID      int        `json:"interface_id"`
+	Running          bool       `json:"running"`
+	Endpoint         string     `json:"endpoint"`          // 配置的 host:port
+	ResolvedEndpoint string     `json:"resolved_endpoint"` // 内核中当前使用的地址
+	LastHandshake    *time.Time `json:"last_handshake"`
+	Healthy          bool       `json:"healthy"` // 最近一次握手在超时之内
+	BytesReceived    int64      `json:"bytes_received"`
+	BytesSent        int64      `json:"bytes_sent"`
+	Reconnects       int        `json:"reconnects"` // 本次运行以来重新解析并更换地址的次数
+	LastReconnect    *time.Time `json:"last_reconnect"`
+}
+
+// peer 类型
+const (
+	PeerTypeClient = "client" // 单个设备：服务端只路由其隧道地址
+	PeerTypeSite   = "site"   // 站点网关：服务端另外路由其背后的局域网（routed_subnets）
+)
+
+// 接口事件类型
+const (
+	EventHook      = "hook"      // PreUp/PostUp/PreDown/PostDown 的执行结果
+	EventHandshake = "handshake" // 客户端模式：握手超时、重新解析 endpoint、恢复
+	EventEndpoint  = "endpoint"  // peer 的 endpoint 主机名重新解析后地址变化
+	EventStale     = "stale"     // peer 长期未连接，按策略自动停用
+)
+
+// InterfaceEvent 是接口的事件日志，按接口保留最近若干条
+type InterfaceEvent struct {
+	ID          int       `json:"id" db:"id"`
+	InterfaceID int       `json:"interface_id" db:"interface_id"`
+	Kind        string    `json:"kind" db:"kind"`
+	Message     string    `json:"message" db:"message"`
+	Output      string    `json:"output,omitempty" db:"output"` // 命令输出（截断）
+	Success     bool      `json:"success" db:"success"`
+	CreatedAt   time.Time `json:"created_at" db:"created_at"`
+}
+
+// PeerSession 是 peer 的一次在线时段：握手进入在线阈值时开始，超出阈值（或下线、停用）时结束
+type PeerSession struct {
+	ID          int        `json:"id" db:"id"`
+	PeerID      int        `json:"peer_id" db:"peer_id"`
+	InterfaceID int        `json:"interface_id" db:"interface_id"`
+	StartedAt   time.Time  `json:"started_at" db:"started_at"`
+	EndedAt     *time.Time `json:"ended_at" db:"ended_at"` // nil：仍在线
+	Duration    int64      `json:"duration_seconds"`       // 截至结束（或当前）时间
+}
+
+// PeerHealth 是 peer 在统计窗口内的在线情况
+type PeerHealth struct {
+	PeerID        int           `json:"peer_id"`
+	PeerName      string        `json:"peer_name"`
+	InterfaceID   int           `json:"interface_id"`
+	InterfaceName string        `json:"interface_name"`
+	Online        bool          `json:"online"`
+	OnlineSince   *time.Time    `json:"online_since"`
+	LastSeen      *time.Time    `json:"last_seen"` // 最近一次握手（持久化，重启后仍在）
+	Stale         bool          `json:"stale"`
+	Disabled      bool          `json:"disabled"`
+	WindowStart   time.Time     `json:"window_start"`
+	WindowEnd     time.Time     `json:"window_end"`
+	OnlineSeconds int64         `json:"online_seconds"`
+	Availability  float64       `json:"availability"` // 窗口内在线时间占比（百分比）
+	Sessions      []PeerSession `json:"sessions"`     // 与窗口有交集的时段，按开始时间倒序
 }
 
 type WireGuardPeer struct {
-	ID                  int        `json:"id" db:"id"`
-	InterfaceID         int        `json:"interface_id" db:"interface_id"`
-	InterfaceName       string     `json:"interface_name"`
-	Name                string     `json:"name" db:"name"`
-	PublicKey           string     `json:"public_key" db:"public_key"`
-	PrivateKey          string     `json:"private_key" db:"private_key"`
-	IP                  string     `db:"ip" json:"ip"`
-	AllowedIPs          string     `json:"allowed_ips" db:"allowed_ips"`
-	PresharedKey        string    `json:"preshared_key,omitempty"`
-	Endpoint            string     `json:"endpoint" db:"endpoint"`
+	ID            int    `json:"id" db:"id"`
+	InterfaceID   int    `json:"interface_id" db:"interface_id"`
+	InterfaceName string `json:"interface_name"`
+	Name          string `json:"name" db:"name"`
+	PublicKey     string `json:"public_key" db:"public_key"`
+	PrivateKey    string `json:"private_key,omitempty" db:"private_key"`
+	IP            string `db:"ip" json:"ip"`                   // 每个接口地址族一个，逗号分隔，顺序同接口 address
+	AllowedIPs    string `json:"allowed_ips" db:"allowed_ips"` // 服务端：路由到该 peer 的网段
+	// 客户端配置中的 AllowedIPs（走隧道的流量）；为空时取路由模板，再退回接口网段
+	ClientAllowedIPs    string     `json:"client_allowed_ips" db:"client_allowed_ips"`
+	RoutingProfileID    *int       `json:"routing_profile_id" db:"routing_profile_id"`
+	ExcludedIPs         string     `json:"excluded_ips" db:"excluded_ips"` // 从客户端 AllowedIPs 中扣除的网段
+	Type                string     `json:"type" db:"type"`
+	RoutedSubnets       string     `json:"routed_subnets" db:"routed_subnets"` // site 类型：对端局域网，服务端路由到该 peer
+	PresharedKey        string     `json:"preshared_key,omitempty" db:"preshared_key"`
+	Endpoint            string     `json:"endpoint" db:"endpoint"`                   // 配置的 host:port，主机名会定期重新解析
+	ResolvedEndpoint    string     `json:"resolved_endpoint" db:"resolved_endpoint"` // 最近一次下发到内核的地址
 	PersistentKeepalive int        `json:"persistent_keepalive" db:"persistent_keepalive"`
 	Status              string     `json:"status" db:"status"`
+	Disabled            bool       `json:"disabled" db:"disabled"` // 停用：不下发到内核、不写入服务端配置
+	Groups              []string   `json:"groups"`                 // 所属分组（标签）名
 	LastHandshake       *time.Time `json:"last_handshake" db:"last_handshake"`
+	OnlineSince         *time.Time `json:"online_since"` // 当前在线时段的开始时间
+	Stale               bool       `json:"stale"`        // 超过设定天数未连接
 	BytesReceived       int64      `json:"bytes_received" db:"bytes_received"`
 	BytesSent           int64      `json:"bytes_sent" db:"bytes_sent"`
 	CreatedAt           time.Time  `json:"created_at" db:"created_at"`
 	UpdatedAt           time.Time  `json:"updated_at" db:"updated_at"`
 }
 
+// PeerGroup 是 peer 的分组（标签），与 peer 多对多；可作为批量操作与 ACL 规则的目标
+type PeerGroup struct {
+	ID          int       `json:"id" db:"id"`
+	Name        string    `json:"name" db:"name"`
+	Description string    `json:"description" db:"description"`
+	MemberCount int       `json:"member_count"`
+	CreatedAt   time.Time `json:"created_at" db:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at" db:"updated_at"`
+}
+
+// 路由模板类型
+const (
+	RoutingFull          = "full"            // 全局：0.0.0.0/0, ::/0
+	RoutingSplit         = "split"           // 分流：接口网段 + Routes
+	RoutingFullExceptLAN = "full_except_lan" // 全局但排除 Excluded（默认私有网段）
+)
+
+// RoutingProfile 是可复用的客户端 AllowedIPs 模板
+type RoutingProfile struct {
+	ID          int       `json:"id" db:"id"`
+	Name        string    `json:"name" db:"name"`
+	Kind        string    `json:"kind" db:"kind"`
+	Routes      string    `json:"routes" db:"routes"`     // split：走隧道的网段
+	Excluded    string    `json:"excluded" db:"excluded"` // full_except_lan：不走隧道的网段
+	Description string    `json:"description" db:"description"`
+	CreatedAt   time.Time `json:"created_at" db:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at" db:"updated_at"`
+}
+
+// IPPool 是接口网段内的命名地址段（如 laptops: 10.8.0.2-10.8.0.99）；peer 可指定从哪个池分配
+type IPPool struct {
+	ID          int       `json:"id" db:"id"`
+	InterfaceID int       `json:"interface_id" db:"interface_id"`
+	Name        string    `json:"name" db:"name"`
+	Ranges      string    `json:"ranges" db:"ranges"` // 逗号分隔，CIDR 或 a-b 区间，可含两个地址族
+	Description string    `json:"description" db:"description"`
+	CreatedAt   time.Time `json:"created_at" db:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at" db:"updated_at"`
+}
+
+// IPReservation 是不参与分配的地址（网关、LAN 设备等），静态指定也会被拒绝
+type IPReservation struct {
+	ID          int       `json:"id" db:"id"`
+	InterfaceID int       `json:"interface_id" db:"interface_id"`
+	Addresses   string    `json:"addresses" db:"addresses"` // 逗号分隔，地址 / CIDR / a-b 区间
+	Note        string    `json:"note" db:"note"`
+	CreatedAt   time.Time `json:"created_at" db:"created_at"`
+}
+
+// QuarantinedIP 是刚被释放的地址，隔离期内不会被自动分配给新 peer
+type QuarantinedIP struct {
+	InterfaceID int       `json:"interface_id" db:"interface_id"`
+	IP          string    `json:"ip" db:"ip"`
+	PeerName    string    `json:"peer_name" db:"peer_name"` // 释放前的使用者
+	ReleasedAt  time.Time `json:"released_at" db:"released_at"`
+	Until       time.Time `json:"until" db:"until"`
+}
+
+// IPAMFreeState 是接口空闲区间快照的元数据：快照对应 ipam_versions 的 Version，
+// Families 记录生成时的网段与服务端地址，Expires 为最早到期的隔离地址（零值表示没有）
+type IPAMFreeState struct {
+	InterfaceID int       `json:"interface_id" db:"interface_id"`
+	Version     int64     `json:"version" db:"version"`
+	Families    string    `json:"families" db:"families"`
+	Expires     time.Time `json:"expires" db:"expires"`
+}
+
+// IPAMFreeSpan 是快照中的一个空闲区间 [First, Last]；Family 为接口地址族的下标
+type IPAMFreeSpan struct {
+	Family int    `json:"family" db:"family"`
+	First  string `json:"first" db:"first"`
+	Last   string `json:"last" db:"last"`
+}
+
+// 转发策略：WG 网段与 LAN 之间、ACL 规则及其默认动作
+const (
+	ForwardAllow = "allow"
+	ForwardDeny  = "deny"
+)
+
+// InterfaceGateway 是接口的网关设置：经出口网卡做 NAT，以及 WG 网段与 LAN 之间是否放行转发
+type InterfaceGateway struct {
+	InterfaceID     int       `json:"interface_id" db:"interface_id"`
+	Masquerade      bool      `json:"masquerade" db:"masquerade"`
+	EgressInterface string    `json:"egress_interface" db:"egress_interface"` // 出口网卡（如 eth0）；为空表示任意非本接口
+	LANForward      string    `json:"lan_forward" db:"lan_forward"`           // allow / deny
+	LANCIDRs        string    `json:"lan_cidrs" db:"lan_cidrs"`               // 逗号分隔；为空取私有网段
+	ACLDefault      string    `json:"acl_default" db:"acl_default"`           // allow / deny：未命中 ACL 规则的 peer 流量
+	UpdatedAt       time.Time `json:"updated_at" db:"updated_at"`
+}
+
+// ACL 规则协议
+const (
+	ProtoAny  = "any"
+	ProtoTCP  = "tcp"
+	ProtoUDP  = "udp"
+	ProtoICMP = "icmp"
+)
+
+// ACLRule 限制 peer 经本机转发可访问的目标；同接口按 priority、id 顺序首个命中生效
+type ACLRule struct {
+	ID           int       `json:"id" db:"id"`
+	InterfaceID  int       `json:"interface_id" db:"interface_id"`
+	PeerID       *int      `json:"peer_id" db:"peer_id"`           // 与 group_id 均为 nil 表示接口下全部 peer
+	GroupID      *int      `json:"group_id" db:"group_id"`         // 分组内属于本接口的 peer
+	Action       string    `json:"action" db:"action"`             // allow / deny
+	Destinations string    `json:"destinations" db:"destinations"` // 逗号分隔 CIDR；为空表示任意
+	Protocol     string    `json:"protocol" db:"protocol"`         // any / tcp / udp / icmp
+	Ports        string    `json:"ports" db:"ports"`               // 逗号分隔端口或 a-b 区间，仅 tcp/udp；为空表示全部
+	Priority     int       `json:"priority" db:"priority"`
+	Description  string    `json:"description" db:"description"`
+	CreatedAt    time.Time `json:"created_at" db:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at" db:"updated_at"`
+}
+
+// Mesh 是全互联网络：每个成员与其余所有成员直连，管理端分配地址并为每个成员生成配置
+type Mesh struct {
+	ID                  int       `json:"id" db:"id"`
+	Name                string    `json:"name" db:"name"`
+	Network             string    `json:"network" db:"network"` // 每个地址族一个 CIDR，如 "10.99.0.0/24, fd99::/64"
+	ListenPort          int       `json:"listen_port" db:"listen_port"`
+	MTU                 int       `json:"mtu" db:"mtu"`
+	PersistentKeepalive int       `json:"persistent_keepalive" db:"persistent_keepalive"`
+	Revision            int       `json:"revision" db:"revision"` // 成员或网络设置变化时递增，成员配置需重新下载
+	MemberCount         int       `json:"member_count"`
+	CreatedAt           time.Time `json:"created_at" db:"created_at"`
+	UpdatedAt           time.Time `json:"updated_at" db:"updated_at"`
+}
+
+// MeshMember 是 mesh 中的一个节点；PrivateKey 为空表示节点自带密钥（配置中需自行填写）
+type MeshMember struct {
+	ID         int       `json:"id" db:"id"`
+	MeshID     int       `json:"mesh_id" db:"mesh_id"`
+	Name       string    `json:"name" db:"name"`
+	Endpoint   string    `json:"endpoint" db:"endpoint"` // 其他成员连接它的 host[:port]
+	IP         string    `json:"ip" db:"ip"`
+	ListenPort int       `json:"listen_port" db:"listen_port"` // 0：使用 mesh 的 listen_port
+	PublicKey  string    `json:"public_key" db:"public_key"`
+	PrivateKey string    `json:"private_key,omitempty" db:"private_key"`
+	CreatedAt  time.Time `json:"created_at" db:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at" db:"updated_at"`
+}
+
+// RenderedConfig 记录最近一次写出的 <name>.conf 校验和，用于识别手工修改
+type RenderedConfig struct {
+	Name      string    `json:"name" db:"name"`
+	SHA256    string    `json:"sha256" db:"sha256"`
+	WrittenAt time.Time `json:"written_at" db:"written_at"`
+}
+
+// 告警规则类型
+const (
+	AlertInterfaceDown = "interface_down" // 应在运行的接口链路或 WireGuard 设备不在
+	AlertPeerOffline   = "peer_offline"   // peer 超过 duration 没有握手
+	AlertQuota         = "quota"          // 接口网段 / 地址池使用率达到 threshold（百分比）
+	AlertDrift         = "drift"          // 内核中的 peer、端口或 .conf 与数据库不一致
+	AlertDiskLow       = "disk_low"       // path 所在文件系统剩余空间低于 threshold（百分比）
+	AlertFailedLogins  = "failed_logins"  // duration 内登录失败次数超过 threshold
+)
+
+// 告警级别与状态
+const (
+	AlertSeverityInfo     = "info"
+	AlertSeverityWarning  = "warning"
+	AlertSeverityCritical = "critical"
+
+	AlertStatusFiring   = "firing"
+	AlertStatusResolved = "resolved"
+)
+
+// AlertRule 是定时评估的告警规则；同一规则下每个对象（接口、peer、地址池等）至多一条进行中的告警
+type AlertRule struct {
+	ID          int       `json:"id" db:"id"`
+	Name        string    `json:"name" db:"name"`
+	Type        string    `json:"type" db:"type"`
+	Enabled     bool      `json:"enabled" db:"enabled"`
+	Severity    string    `json:"severity" db:"severity"`
+	Threshold   float64   `json:"threshold" db:"threshold"`       // quota / disk_low 为百分比，failed_logins 为次数
+	Duration    string    `json:"duration" db:"duration"`         // peer_offline 的离线时长、failed_logins 的统计窗口，如 30m
+	InterfaceID *int      `json:"interface_id" db:"interface_id"` // 只检查该接口；nil 表示全部
+	Path        string    `json:"path" db:"path"`                 // disk_low 检查的目录；为空取数据库所在目录
+	NotifierIDs []int     `json:"notifier_ids"`                   // 为空时发往全部启用的通知渠道
+	CreatedAt   time.Time `json:"created_at" db:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at" db:"updated_at"`
+}
+
+// Alert 是一次告警：规则命中时创建（firing），条件消失后转为 resolved 并保留为历史
+type Alert struct {
+	ID          int        `json:"id" db:"id"`
+	RuleID      int        `json:"rule_id" db:"rule_id"`
+	RuleName    string     `json:"rule_name" db:"rule_name"`
+	Type        string     `json:"type" db:"type"`
+	Severity    string     `json:"severity" db:"severity"`
+	Key         string     `json:"key" db:"alert_key"` // 去重键：规则内的对象，如 peer:12
+	Subject     string     `json:"subject" db:"subject"`
+	Message     string     `json:"message" db:"message"`
+	Status      string     `json:"status" db:"status"`
+	StartedAt   time.Time  `json:"started_at" db:"started_at"`
+	LastSeenAt  time.Time  `json:"last_seen_at" db:"last_seen_at"` // 最近一次评估仍命中的时间
+	ResolvedAt  *time.Time `json:"resolved_at" db:"resolved_at"`
+	NotifiedAt  *time.Time `json:"notified_at" db:"notified_at"`   // 触发通知送达的时间；失败时下次评估重试
+	NotifyError string     `json:"notify_error" db:"notify_error"` // 最近一次投递失败的原因
+}
+
+// 通知渠道类型
+const (
+	NotifierWebhook  = "webhook"  // settings: url；secret 用于 HMAC-SHA256 签名
+	NotifierSMTP     = "smtp"     // settings: host、port、username、from、to、tls；secret 为密码
+	NotifierTelegram = "telegram" // settings: chat_id、api_url；secret 为 bot token
+)
+
+// Notifier 是告警的通知渠道；Secret 加密存储，默认不在响应中返回
+type Notifier struct {
+	ID        int               `json:"id" db:"id"`
+	Name      string            `json:"name" db:"name"`
+	Type      string            `json:"type" db:"type"`
+	Enabled   bool              `json:"enabled" db:"enabled"`
+	Settings  map[string]string `json:"settings"`
+	Secret    string            `json:"secret,omitempty" db:"secret"`
+	CreatedAt time.Time         `json:"created_at" db:"created_at"`
+	UpdatedAt time.Time         `json:"updated_at" db:"updated_at"`
+}
+
 type Device struct {
 	ID          int        `json:"id" db:"id"`
 	Name        string     `json:"name" db:"name"`
@@ -106,6 +449,8 @@ type CreateInterfaceRequest struct {
 	PrivateKey string `json:"private_key,omitempty"`
 	DNS        string `json:"dns,omitempty"`
 	MTU        int    `json:"mtu,omitempty"`
+	InterfaceHooks
+	InterfaceSite
 }
 
 type UpdateInterfaceRequest struct {
@@ -114,22 +459,219 @@ type UpdateInterfaceRequest struct {
 	Address    string `json:"address"`
 	DNS        string `json:"dns"`
 	MTU        int    `json:"mtu"`
+	InterfaceHooks
+	InterfaceSite
+}
+
+// InterfaceHooks 是请求中的 hook 字段；nil 表示不修改，空串表示清除
+type InterfaceHooks struct {
+	PreUp    *string `json:"pre_up,omitempty"`
+	PostUp   *string `json:"post_up,omitempty"`
+	PreDown  *string `json:"pre_down,omitempty"`
+	PostDown *string `json:"post_down,omitempty"`
+}
+
+// InterfaceSite 是请求中的模式 / 对外地址 / 本端局域网；nil 表示不修改
+type InterfaceSite struct {
+	Mode         *string `json:"mode,omitempty"`          // server | client
+	Endpoint     *string `json:"endpoint,omitempty"`      // host[:port]，写入客户端配置，优先于 WG_PUBLIC_ENDPOINT
+	LocalSubnets *string `json:"local_subnets,omitempty"` // 本端局域网，site peer 的对端配置会路由这些网段
+}
+
+// ClientRemoteRequest 整体替换客户端模式接口的远端；PresharedKey 为 nil 时保留原值
+type ClientRemoteRequest struct {
+	PublicKey           string  `json:"public_key" binding:"required"`
+	PresharedKey        *string `json:"preshared_key,omitempty"`
+	Endpoint            string  `json:"endpoint" binding:"required"`
+	AllowedIPs          string  `json:"allowed_ips,omitempty"` // 为空取 0.0.0.0/0, ::/0
+	PersistentKeepalive *int    `json:"persistent_keepalive,omitempty"`
+	Table               string  `json:"table,omitempty"` // 为空取 auto
+	FwMark              int     `json:"fwmark,omitempty"`
+}
+
+// RenumberInterfaceRequest 把接口换到新网段；dry_run 只返回改址计划
+type RenumberInterfaceRequest struct {
+	Address string `json:"address" binding:"required"`
+	DryRun  bool   `json:"dry_run"`
 }
 
 type CreatePeerRequest struct {
-	InterfaceID         uint    `json:"interface_id" binding:"required"`
-	Name                string  `json:"name" binding:"required"`
+	InterfaceID         uint     `json:"interface_id" binding:"required"`
+	Name                string   `json:"name" binding:"required"`
+	IP                  *string  `json:"ip,omitempty"`   // 静态地址（双栈可逗号分隔），缺失的地址族自动分配
+	Pool                *string  `json:"pool,omitempty"` // 从指定地址池分配
+	AllowedIPs          *string  `json:"allowed_ips,omitempty"`
+	Endpoint            *string  `json:"endpoint,omitempty"`
+	PersistentKeepalive *int     `json:"persistent_keepalive,omitempty"` // 为空则默认 25
+	PublicKey           *string  `json:"public_key,omitempty"`
+	ClientAllowedIPs    *string  `json:"client_allowed_ips,omitempty"`
+	RoutingProfileID    *int     `json:"routing_profile_id,omitempty"`
+	ExcludedIPs         *string  `json:"excluded_ips,omitempty"`
+	Groups              []string `json:"groups,omitempty"` // 分组名，不存在的自动创建
+	Type                *string  `json:"type,omitempty"`   // client（默认）| site
+	RoutedSubnets       *string  `json:"routed_subnets,omitempty"`
+}
+
+// BulkPeerEntry 是批量创建中的一行；未填写的字段取请求级默认值
+type BulkPeerEntry struct {
+	Name                string  `json:"name"`
+	IP                  *string `json:"ip,omitempty"`
+	Pool                *string `json:"pool,omitempty"`
 	AllowedIPs          *string `json:"allowed_ips,omitempty"`
 	Endpoint            *string `json:"endpoint,omitempty"`
-	PersistentKeepalive *int    `json:"persistent_keepalive,omitempty"` // 为空则默认 25
+	PersistentKeepalive *int    `json:"persistent_keepalive,omitempty"`
 	PublicKey           *string `json:"public_key,omitempty"`
+	ClientAllowedIPs    *string `json:"client_allowed_ips,omitempty"`
+	RoutingProfileID    *int    `json:"routing_profile_id,omitempty"`
+	ExcludedIPs         *string `json:"excluded_ips,omitempty"`
+	// Groups 为分组名，不存在的自动创建；nil 时取请求级默认值
+	Groups []string `json:"groups,omitempty"`
+}
+
+type BulkCreatePeersRequest struct {
+	InterfaceID uint   `json:"interface_id" binding:"required"`
+	Mode        string `json:"mode,omitempty"` // atomic（默认，全部成功或全部回滚）| partial（逐行报告错误）
+	// Names 为只需名称时的简写，与 Peers 合并
+	Names []string        `json:"names,omitempty"`
+	Peers []BulkPeerEntry `json:"peers,omitempty"`
+	// 各行的默认值
+	Pool                *string  `json:"pool,omitempty"`
+	AllowedIPs          *string  `json:"allowed_ips,omitempty"`
+	Endpoint            *string  `json:"endpoint,omitempty"`
+	PersistentKeepalive *int     `json:"persistent_keepalive,omitempty"`
+	ClientAllowedIPs    *string  `json:"client_allowed_ips,omitempty"`
+	RoutingProfileID    *int     `json:"routing_profile_id,omitempty"`
+	ExcludedIPs         *string  `json:"excluded_ips,omitempty"`
+	Groups              []string `json:"groups,omitempty"`
 }
 
 type UpdatePeerRequest struct {
-	Name                *string `json:"name,omitempty"`
-	AllowedIPs          *string `json:"allowed_ips,omitempty"`
-	Endpoint            *string `json:"endpoint,omitempty"`
-	PersistentKeepalive *int    `json:"persistent_keepalive,omitempty"` // 为空则默认 25
+	Name                *string   `json:"name,omitempty"`
+	AllowedIPs          *string   `json:"allowed_ips,omitempty"`
+	Endpoint            *string   `json:"endpoint,omitempty"`
+	PersistentKeepalive *int      `json:"persistent_keepalive,omitempty"` // 为空则默认 25
+	ClientAllowedIPs    *string   `json:"client_allowed_ips,omitempty"`   // "" 清空
+	RoutingProfileID    *int      `json:"routing_profile_id,omitempty"`   // 0 解除
+	ExcludedIPs         *string   `json:"excluded_ips,omitempty"`         // "" 清空
+	Disabled            *bool     `json:"disabled,omitempty"`
+	Groups              *[]string `json:"groups,omitempty"` // 整体替换所属分组；不存在的自动创建
+	Type                *string   `json:"type,omitempty"`
+	RoutedSubnets       *string   `json:"routed_subnets,omitempty"` // 整体替换
+}
+
+type RoutingProfileRequest struct {
+	Name        string `json:"name" binding:"required"`
+	Kind        string `json:"kind" binding:"required"`
+	Routes      string `json:"routes,omitempty"`
+	Excluded    string `json:"excluded,omitempty"`
+	Description string `json:"description,omitempty"`
+}
+
+type IPPoolRequest struct {
+	Name        string `json:"name" binding:"required"`
+	Ranges      string `json:"ranges" binding:"required"`
+	Description string `json:"description,omitempty"`
+}
+
+type IPReservationRequest struct {
+	Addresses string `json:"addresses" binding:"required"`
+	Note      string `json:"note,omitempty"`
+}
+
+// InterfaceGatewayRequest 整体替换接口的网关设置；LANForward 为空按 allow
+type InterfaceGatewayRequest struct {
+	Masquerade      bool   `json:"masquerade"`
+	EgressInterface string `json:"egress_interface"`
+	LANForward      string `json:"lan_forward"`
+	LANCIDRs        string `json:"lan_cidrs"`
+	ACLDefault      string `json:"acl_default"`
+}
+
+// ACLRuleRequest 创建/覆盖 ACL 规则；Action、Protocol 为空分别按 allow、any
+type ACLRuleRequest struct {
+	PeerID       *int   `json:"peer_id"`
+	GroupID      *int   `json:"group_id"`
+	Action       string `json:"action"`
+	Destinations string `json:"destinations"`
+	Protocol     string `json:"protocol"`
+	Ports        string `json:"ports"`
+	Priority     int    `json:"priority"`
+	Description  string `json:"description"`
+}
+
+type PeerGroupRequest struct {
+	Name        string `json:"name" binding:"required"`
+	Description string `json:"description,omitempty"`
+}
+
+// MeshRequest 创建/修改 mesh；ListenPort、MTU、PersistentKeepalive 为 nil 时取默认值（修改时保留原值）
+type MeshRequest struct {
+	Name                string `json:"name" binding:"required"`
+	Network             string `json:"network" binding:"required"`
+	ListenPort          *int   `json:"listen_port,omitempty"`
+	MTU                 *int   `json:"mtu,omitempty"`
+	PersistentKeepalive *int   `json:"persistent_keepalive,omitempty"`
+}
+
+// MeshMemberRequest 创建/修改 mesh 成员；IP 为空自动分配，PublicKey 为空由管理端生成密钥对
+type MeshMemberRequest struct {
+	Name       string  `json:"name" binding:"required"`
+	Endpoint   string  `json:"endpoint" binding:"required"`
+	IP         *string `json:"ip,omitempty"`
+	ListenPort *int    `json:"listen_port,omitempty"`
+	PublicKey  *string `json:"public_key,omitempty"`
+}
+
+// PeerGroupMembersRequest 增加或整体替换分组成员
+type PeerGroupMembersRequest struct {
+	PeerIDs []int `json:"peer_ids"`
+}
+
+// 分组批量操作
+const (
+	GroupActionDisable        = "disable"
+	GroupActionEnable         = "enable"
+	GroupActionKeepalive      = "keepalive"       // 需要 persistent_keepalive
+	GroupActionRoutingProfile = "routing_profile" // routing_profile_id 为 0 表示解除
+)
+
+type PeerGroupBulkRequest struct {
+	Action              string `json:"action" binding:"required"`
+	PersistentKeepalive *int   `json:"persistent_keepalive,omitempty"`
+	RoutingProfileID    *int   `json:"routing_profile_id,omitempty"`
+}
+
+// AlertRuleRequest 创建/覆盖告警规则；Enabled 为 nil 时启用，Severity、Threshold、Duration 为空时按类型取默认值
+type AlertRuleRequest struct {
+	Name        string   `json:"name" binding:"required"`
+	Type        string   `json:"type" binding:"required"`
+	Enabled     *bool    `json:"enabled,omitempty"`
+	Severity    string   `json:"severity"`
+	Threshold   *float64 `json:"threshold,omitempty"`
+	Duration    string   `json:"duration"`
+	InterfaceID *int     `json:"interface_id"`
+	Path        string   `json:"path"`
+	NotifierIDs []int    `json:"notifier_ids"`
+}
+
+// NotifierRequest 创建/覆盖通知渠道；Secret 为 nil 时沿用原值
+type NotifierRequest struct {
+	Name     string            `json:"name" binding:"required"`
+	Type     string            `json:"type" binding:"required"`
+	Enabled  *bool             `json:"enabled,omitempty"`
+	Settings map[string]string `json:"settings"`
+	Secret   *string           `json:"secret,omitempty"`
+}
+
+// CIDRSubtractRequest 的元素可以是 CIDR、裸地址或 "a-b" 地址区间；Base 为空时取 0.0.0.0/0, ::/0
+type CIDRSubtractRequest struct {
+	Base    []string `json:"base"`
+	Exclude []string `json:"exclude"`
+}
+
+type CIDRSubtractResponse struct {
+	Result []string `json:"result"`
+	Count  int      `json:"count"`
 }
 
 type APIResponse struct {
@@ -0,0 +1,1760 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"backend/models"
+)
+
+// MemoryStore 是 Store 的内存实现，约束与 SQL 实现保持一致，
+// 便于在没有 SQLite 的情况下测试 service 逻辑
+type MemoryStore struct {
+	mu   *sync.Mutex
+	data *memData
+	inTx bool // 事务内已持有锁
+}
+
+type memData struct {
+	interfaces  map[int]models.WireGuardInterface
+	peers       map[int]models.WireGuardPeer
+	rendered    map[string]models.RenderedConfig
+	profiles    map[int]models.RoutingProfile
+	pools       map[int]models.IPPool
+	reserved    map[int]models.IPReservation
+	quarantine  map[string]models.QuarantinedIP // key: interfaceID/ip
+	gateways    map[int]models.InterfaceGateway // key: interfaceID
+	remotes     map[int]models.ClientRemote     // key: interfaceID
+	meshes      map[int]models.Mesh
+	meshMembers map[int]models.MeshMember
+	acls        map[int]models.ACLRule
+	groups      map[int]models.PeerGroup
+	members     map[[2]int]bool // key: {groupID, peerID}
+	events      []models.InterfaceEvent
+	sessions    map[int]models.PeerSession
+	alertRules  map[int]models.AlertRule
+	alerts      map[int]models.Alert
+	notifiers   map[int]models.Notifier
+	ipamVer     map[int]int64 // key: interfaceID，对应 SQL 的 ipam_versions
+	freeState   map[int]models.IPAMFreeState
+	freeSpans   map[int]map[freeSpanKey]models.IPAMFreeSpan // key: interfaceID
+	nextIfaceID int
+	nextPeerID  int
+	nextProfID  int
+	nextPoolID  int
+	nextResID   int
+	nextACLID   int
+	nextGroupID int
+	nextEventID int
+	nextMeshID  int
+	nextMMID    int
+	nextSessID  int
+	nextRuleID  int
+	nextAlertID int
+	nextNotifID int
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		mu: &sync.Mutex{},
+		data: &memData{
+			interfaces:  map[int]models.WireGuardInterface{},
+			peers:       map[int]models.WireGuardPeer{},
+			rendered:    map[string]models.RenderedConfig{},
+			profiles:    map[int]models.RoutingProfile{},
+			pools:       map[int]models.IPPool{},
+			reserved:    map[int]models.IPReservation{},
+			quarantine:  map[string]models.QuarantinedIP{},
+			gateways:    map[int]models.InterfaceGateway{},
+			remotes:     map[int]models.ClientRemote{},
+			meshes:      map[int]models.Mesh{},
+			meshMembers: map[int]models.MeshMember{},
+			acls:        map[int]models.ACLRule{},
+			groups:      map[int]models.PeerGroup{},
+			members:     map[[2]int]bool{},
+			sessions:    map[int]models.PeerSession{},
+			alertRules:  map[int]models.AlertRule{},
+			alerts:      map[int]models.Alert{},
+			notifiers:   map[int]models.Notifier{},
+			ipamVer:     map[int]int64{},
+			freeState:   map[int]models.IPAMFreeState{},
+			freeSpans:   map[int]map[freeSpanKey]models.IPAMFreeSpan{},
+		},
+	}
+}
+
+func (d *memData) clone() *memData {
+	c := &memData{
+		interfaces:  make(map[int]models.WireGuardInterface, len(d.interfaces)),
+		peers:       make(map[int]models.WireGuardPeer, len(d.peers)),
+		rendered:    make(map[string]models.RenderedConfig, len(d.rendered)),
+		profiles:    make(map[int]models.RoutingProfile, len(d.profiles)),
+		pools:       make(map[int]models.IPPool, len(d.pools)),
+		reserved:    make(map[int]models.IPReservation, len(d.reserved)),
+		quarantine:  make(map[string]models.QuarantinedIP, len(d.quarantine)),
+		gateways:    make(map[int]models.InterfaceGateway, len(d.gateways)),
+		remotes:     make(map[int]models.ClientRemote, len(d.remotes)),
+		meshes:      make(map[int]models.Mesh, len(d.meshes)),
+		meshMembers: make(map[int]models.MeshMember, len(d.meshMembers)),
+		acls:        make(map[int]models.ACLRule, len(d.acls)),
+		groups:      make(map[int]models.PeerGroup, len(d.groups)),
+		members:     make(map[[2]int]bool, len(d.members)),
+		sessions:    make(map[int]models.PeerSession, len(d.sessions)),
+		alertRules:  make(map[int]models.AlertRule, len(d.alertRules)),
+		alerts:      make(map[int]models.Alert, len(d.alerts)),
+		notifiers:   make(map[int]models.Notifier, len(d.notifiers)),
+		ipamVer:     make(map[int]int64, len(d.ipamVer)),
+		freeState:   make(map[int]models.IPAMFreeState, len(d.freeState)),
+		freeSpans:   make(map[int]map[freeSpanKey]models.IPAMFreeSpan, len(d.freeSpans)),
+		nextIfaceID: d.nextIfaceID,
+		nextPeerID:  d.nextPeerID,
+		nextProfID:  d.nextProfID,
+		nextPoolID:  d.nextPoolID,
+		nextResID:   d.nextResID,
+		nextACLID:   d.nextACLID,
+		nextGroupID: d.nextGroupID,
+		nextEventID: d.nextEventID,
+		nextMeshID:  d.nextMeshID,
+		nextMMID:    d.nextMMID,
+		nextSessID:  d.nextSessID,
+		nextRuleID:  d.nextRuleID,
+		nextAlertID: d.nextAlertID,
+		nextNotifID: d.nextNotifID,
+		events:      append([]models.InterfaceEvent(nil), d.events...),
+	}
+	for k, v := range d.interfaces {
+		c.interfaces[k] = v
+	}
+	for k, v := range d.peers {
+		c.peers[k] = v
+	}
+	for k, v := range d.rendered {
+		c.rendered[k] = v
+	}
+	for k, v := range d.profiles {
+		c.profiles[k] = v
+	}
+	for k, v := range d.pools {
+		c.pools[k] = v
+	}
+	for k, v := range d.reserved {
+		c.reserved[k] = v
+	}
+	for k, v := range d.quarantine {
+		c.quarantine[k] = v
+	}
+	for k, v := range d.gateways {
+		c.gateways[k] = v
+	}
+	for k, v := range d.remotes {
+		c.remotes[k] = v
+	}
+	for k, v := range d.meshes {
+		c.meshes[k] = v
+	}
+	for k, v := range d.meshMembers {
+		c.meshMembers[k] = v
+	}
+	for k, v := range d.acls {
+		c.acls[k] = v
+	}
+	for k, v := range d.groups {
+		c.groups[k] = v
+	}
+	for k, v := range d.members {
+		c.members[k] = v
+	}
+	for k, v := range d.sessions {
+		c.sessions[k] = v
+	}
+	for k, v := range d.alertRules {
+		c.alertRules[k] = v
+	}
+	for k, v := range d.alerts {
+		c.alerts[k] = v
+	}
+	for k, v := range d.notifiers {
+		c.notifiers[k] = v
+	}
+	for k, v := range d.ipamVer {
+		c.ipamVer[k] = v
+	}
+	for k, v := range d.freeState {
+		c.freeState[k] = v
+	}
+	for k, spans := range d.freeSpans {
+		m := make(map[freeSpanKey]models.IPAMFreeSpan, len(spans))
+		for sk, sp := range spans {
+			m[sk] = sp
+		}
+		c.freeSpans[k] = m
+	}
+	return c
+}
+
+// bumpIPAM 递增接口地址占用的版本号，等价于 SQL 的 ipam_versions 触发器
+func (d *memData) bumpIPAM(interfaceID int) {
+	d.ipamVer[interfaceID]++
+}
+
+func (s *MemoryStore) lock() func() {
+	if s.inTx {
+		return func() {}
+	}
+	s.mu.Lock()
+	return s.mu.Unlock
+}
+
+func (s *MemoryStore) Interfaces() InterfaceRepository { return &memInterfaceRepo{s: s} }
+func (s *MemoryStore) Peers() PeerRepository           { return &memPeerRepo{s: s} }
+func (s *MemoryStore) RenderedConfigs() RenderedConfigRepository {
+	return &memRenderedConfigRepo{s: s}
+}
+func (s *MemoryStore) RoutingProfiles() RoutingProfileRepository {
+	return &memRoutingProfileRepo{s: s}
+}
+
+func (s *MemoryStore) IPAM() IPAMRepository        { return &memIPAMRepo{s: s} }
+func (s *MemoryStore) Gateways() GatewayRepository { return &memGatewayRepo{s: s} }
+func (s *MemoryStore) Remotes() RemoteRepository   { return &memRemoteRepo{s: s} }
+func (s *MemoryStore) Meshes() MeshRepository      { return &memMeshRepo{s: s} }
+func (s *MemoryStore) ACLs() ACLRepository         { return &memACLRepo{s: s} }
+func (s *MemoryStore) PeerGroups() PeerGroupRepository {
+	return &memPeerGroupRepo{s: s}
+}
+func (s *MemoryStore) Events() EventRepository { return &memEventRepo{s: s} }
+func (s *MemoryStore) PeerSessions() PeerSessionRepository {
+	return &memPeerSessionRepo{s: s}
+}
+func (s *MemoryStore) Alerts() AlertRepository       { return &memAlertRepo{s: s} }
+func (s *MemoryStore) Notifiers() NotifierRepository { return &memNotifierRepo{s: s} }
+
+func (s *MemoryStore) WithTx(ctx context.Context, fn func(tx Store) error) error {
+	if s.inTx {
+		return fn(s)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// 在副本上执行，成功后整体替换，失败则丢弃（等价回滚）
+	tx := &MemoryStore{mu: s.mu, data: s.data.clone(), inTx: true}
+	if err := fn(tx); err != nil {
+		return err
+	}
+	s.data = tx.data
+	return nil
+}
+
+/* -------------------- 接口 -------------------- */
+
+type memInterfaceRepo struct {
+	s *MemoryStore
+}
+
+func (r *memInterfaceRepo) List(ctx context.Context) ([]models.WireGuardInterface, error) {
+	defer r.s.lock()()
+	list := make([]models.WireGuardInterface, 0, len(r.s.data.interfaces))
+	for _, it := range r.s.data.interfaces {
+		list = append(list, it)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if !list[i].CreatedAt.Equal(list[j].CreatedAt) {
+			return list[i].CreatedAt.After(list[j].CreatedAt)
+		}
+		return list[i].ID > list[j].ID
+	})
+	return list, nil
+}
+
+func (r *memInterfaceRepo) Get(ctx context.Context, id int) (*models.WireGuardInterface, error) {
+	defer r.s.lock()()
+	it, ok := r.s.data.interfaces[id]
+	if !ok {
+		return nil, fmt.Errorf("get interface: %w", ErrNotFound)
+	}
+	return &it, nil
+}
+
+func (r *memInterfaceRepo) GetByName(ctx context.Context, name string) (*models.WireGuardInterface, error) {
+	defer r.s.lock()()
+	for _, it := range r.s.data.interfaces {
+		if it.Name == name {
+			return &it, nil
+		}
+	}
+	return nil, fmt.Errorf("get interface by name: %w", ErrNotFound)
+}
+
+// 模拟 name / listen_port 的 UNIQUE 约束
+func (r *memInterfaceRepo) checkUnique(it *models.WireGuardInterface) error {
+	for id, other := range r.s.data.interfaces {
+		if id == it.ID {
+			continue
+		}
+		if other.Name == it.Name {
+			return fmt.Errorf("interface name %q: %w", it.Name, ErrConflict)
+		}
+		if other.ListenPort == it.ListenPort {
+			return fmt.Errorf("listen port %d: %w", it.ListenPort, ErrConflict)
+		}
+	}
+	return nil
+}
+
+func (r *memInterfaceRepo) Create(ctx context.Context, it *models.WireGuardInterface) error {
+	defer r.s.lock()()
+	it.ID = 0
+	if err := r.checkUnique(it); err != nil {
+		return fmt.Errorf("create interface: %w", err)
+	}
+	r.s.data.nextIfaceID++
+	it.ID = r.s.data.nextIfaceID
+	if it.Status == "" {
+		it.Status = "stopped"
+	}
+	if it.MTU == 0 {
+		it.MTU = 1420
+	}
+	it.Mode = interfaceMode(it.Mode)
+	now := time.Now()
+	it.CreatedAt, it.UpdatedAt = now, now
+	r.s.data.interfaces[it.ID] = *it
+	return nil
+}
+
+func (r *memInterfaceRepo) Update(ctx context.Context, it *models.WireGuardInterface) error {
+	defer r.s.lock()()
+	cur, ok := r.s.data.interfaces[it.ID]
+	if !ok {
+		return fmt.Errorf("update interface: %w", ErrNotFound)
+	}
+	if err := r.checkUnique(it); err != nil {
+		return fmt.Errorf("update interface: %w", err)
+	}
+	// status / created_at 不由 Update 修改，与 SQL 实现一致
+	next := *it
+	next.Status = cur.Status
+	next.Mode = interfaceMode(next.Mode)
+	next.CreatedAt = cur.CreatedAt
+	next.UpdatedAt = time.Now()
+	r.s.data.interfaces[it.ID] = next
+	return nil
+}
+
+func (r *memInterfaceRepo) SetStatus(ctx context.Context, id int, status string) error {
+	defer r.s.lock()()
+	it, ok := r.s.data.interfaces[id]
+	if !ok {
+		return fmt.Errorf("set interface status: %w", ErrNotFound)
+	}
+	it.Status = status
+	it.UpdatedAt = time.Now()
+	r.s.data.interfaces[id] = it
+	return nil
+}
+
+func (r *memInterfaceRepo) Delete(ctx context.Context, id int) error {
+	defer r.s.lock()()
+	if _, ok := r.s.data.interfaces[id]; !ok {
+		return fmt.Errorf("delete interface: %w", ErrNotFound)
+	}
+	delete(r.s.data.interfaces, id)
+	r.s.data.bumpIPAM(id)
+	delete(r.s.data.freeState, id)
+	delete(r.s.data.freeSpans, id)
+	for pid, p := range r.s.data.peers {
+		if p.InterfaceID == id {
+			delete(r.s.data.peers, pid)
+			r.s.data.dropMemberships(pid)
+		}
+	}
+	for k, p := range r.s.data.pools {
+		if p.InterfaceID == id {
+			delete(r.s.data.pools, k)
+		}
+	}
+	for k, res := range r.s.data.reserved {
+		if res.InterfaceID == id {
+			delete(r.s.data.reserved, k)
+		}
+	}
+	for k, q := range r.s.data.quarantine {
+		if q.InterfaceID == id {
+			delete(r.s.data.quarantine, k)
+		}
+	}
+	delete(r.s.data.gateways, id)
+	delete(r.s.data.remotes, id)
+	r.s.data.events = slices.DeleteFunc(r.s.data.events, func(e models.InterfaceEvent) bool { return e.InterfaceID == id })
+	for k, ps := range r.s.data.sessions {
+		if ps.InterfaceID == id {
+			delete(r.s.data.sessions, k)
+		}
+	}
+	for k, ar := range r.s.data.alertRules {
+		if ar.InterfaceID != nil && *ar.InterfaceID == id {
+			delete(r.s.data.alertRules, k)
+		}
+	}
+	for k, a := range r.s.data.acls {
+		if a.InterfaceID == id {
+			delete(r.s.data.acls, k)
+		}
+	}
+	return nil
+}
+
+/* -------------------- Peer -------------------- */
+
+type memPeerRepo struct {
+	s *MemoryStore
+}
+
+// 补齐 interface_name，等价于 SQL 的 LEFT JOIN
+func (r *memPeerRepo) hydrate(p models.WireGuardPeer) models.WireGuardPeer {
+	p.InterfaceName = r.s.data.interfaces[p.InterfaceID].Name
+	return p
+}
+
+func (r *memPeerRepo) list(filter func(models.WireGuardPeer) bool) []models.WireGuardPeer {
+	var list []models.WireGuardPeer
+	for _, p := range r.s.data.peers {
+		if filter == nil || filter(p) {
+			list = append(list, r.hydrate(p))
+		}
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if !list[i].CreatedAt.Equal(list[j].CreatedAt) {
+			return list[i].CreatedAt.After(list[j].CreatedAt)
+		}
+		return list[i].ID > list[j].ID
+	})
+	return list
+}
+
+func (r *memPeerRepo) List(ctx context.Context) ([]models.WireGuardPeer, error) {
+	defer r.s.lock()()
+	return r.list(nil), nil
+}
+
+func (r *memPeerRepo) ListByInterface(ctx context.Context, interfaceID int) ([]models.WireGuardPeer, error) {
+	defer r.s.lock()()
+	return r.list(func(p models.WireGuardPeer) bool { return p.InterfaceID == interfaceID }), nil
+}
+
+func (r *memPeerRepo) Get(ctx context.Context, id int) (*models.WireGuardPeer, error) {
+	defer r.s.lock()()
+	p, ok := r.s.data.peers[id]
+	if !ok {
+		return nil, fmt.Errorf("get peer: %w", ErrNotFound)
+	}
+	p = r.hydrate(p)
+	return &p, nil
+}
+
+// 模拟 (interface_id, ip) 的 UNIQUE 索引
+func (r *memPeerRepo) checkUnique(p *models.WireGuardPeer) error {
+	for id, other := range r.s.data.peers {
+		if id == p.ID || other.InterfaceID != p.InterfaceID {
+			continue
+		}
+		for _, a := range splitIPs(other.IP) {
+			for _, b := range splitIPs(p.IP) {
+				if a == b {
+					return fmt.Errorf("%s: %w", a, ErrIPConflict)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func (r *memPeerRepo) Create(ctx context.Context, p *models.WireGuardPeer) error {
+	defer r.s.lock()()
+	if _, ok := r.s.data.interfaces[p.InterfaceID]; !ok {
+		return fmt.Errorf("create peer: interface %d: %w", p.InterfaceID, ErrNotFound)
+	}
+	p.ID = 0
+	if err := r.checkUnique(p); err != nil {
+		return fmt.Errorf("create peer: %w", err)
+	}
+	r.s.data.nextPeerID++
+	p.ID = r.s.data.nextPeerID
+	if p.Status == "" {
+		p.Status = "inactive"
+	}
+	now := time.Now()
+	p.CreatedAt, p.UpdatedAt = now, now
+	p.Endpoint = strings.TrimSpace(p.Endpoint)
+	p.RoutingProfileID = normProfileID(p.RoutingProfileID)
+	p.Type = peerType(p.Type)
+	r.s.data.peers[p.ID] = *p
+	r.s.data.bumpIPAM(p.InterfaceID)
+	return nil
+}
+
+func (r *memPeerRepo) Update(ctx context.Context, p *models.WireGuardPeer) error {
+	defer r.s.lock()()
+	cur, ok := r.s.data.peers[p.ID]
+	if !ok {
+		return fmt.Errorf("update peer: %w", ErrNotFound)
+	}
+	if err := r.checkUnique(p); err != nil {
+		return fmt.Errorf("update peer: %w", err)
+	}
+	// 运行态字段（状态/握手/流量）与归属接口不由 Update 修改
+	next := cur
+	next.Name = p.Name
+	next.IP = p.IP
+	next.AllowedIPs = p.AllowedIPs
+	next.Endpoint = strings.TrimSpace(p.Endpoint)
+	if next.Endpoint != cur.Endpoint {
+		next.ResolvedEndpoint = ""
+	}
+	next.PersistentKeepalive = p.PersistentKeepalive
+	next.ClientAllowedIPs = p.ClientAllowedIPs
+	next.RoutingProfileID = normProfileID(p.RoutingProfileID)
+	next.ExcludedIPs = p.ExcludedIPs
+	next.Disabled = p.Disabled
+	next.Type = peerType(p.Type)
+	next.RoutedSubnets = p.RoutedSubnets
+	next.PublicKey = p.PublicKey
+	next.PrivateKey = p.PrivateKey
+	next.PresharedKey = p.PresharedKey
+	next.UpdatedAt = time.Now()
+	r.s.data.peers[p.ID] = next
+	r.s.data.bumpIPAM(next.InterfaceID)
+	return nil
+}
+
+func (r *memPeerRepo) SetResolvedEndpoint(ctx context.Context, id int, endpoint string) error {
+	defer r.s.lock()()
+	p, ok := r.s.data.peers[id]
+	if !ok {
+		return nil
+	}
+	p.ResolvedEndpoint = endpoint
+	r.s.data.peers[id] = p
+	return nil
+}
+
+func (r *memPeerRepo) SetHandshake(ctx context.Context, id int, status string, last *time.Time) error {
+	defer r.s.lock()()
+	p, ok := r.s.data.peers[id]
+	if !ok {
+		return nil
+	}
+	p.Status = status
+	p.LastHandshake = nil
+	if last != nil {
+		t := *last
+		p.LastHandshake = &t
+	}
+	r.s.data.peers[id] = p
+	return nil
+}
+
+func (r *memPeerRepo) Delete(ctx context.Context, id int) error {
+	defer r.s.lock()()
+	cur, ok := r.s.data.peers[id]
+	if !ok {
+		return fmt.Errorf("delete peer: %w", ErrNotFound)
+	}
+	delete(r.s.data.peers, id)
+	r.s.data.bumpIPAM(cur.InterfaceID)
+	for k, a := range r.s.data.acls {
+		if a.PeerID != nil && *a.PeerID == id {
+			delete(r.s.data.acls, k)
+		}
+	}
+	for k, ps := range r.s.data.sessions {
+		if ps.PeerID == id {
+			delete(r.s.data.sessions, k)
+		}
+	}
+	r.s.data.dropMemberships(id)
+	return nil
+}
+
+func (r *memPeerRepo) UsedIPs(ctx context.Context, interfaceID int) ([]string, error) {
+	defer r.s.lock()()
+	var ips []string
+	for _, p := range r.s.data.peers {
+		if p.InterfaceID == interfaceID {
+			ips = append(ips, splitIPs(p.IP)...)
+		}
+	}
+	sort.Strings(ips)
+	return ips, nil
+}
+
+/* -------------------- 已写出的配置 -------------------- */
+
+type memRenderedConfigRepo struct {
+	s *MemoryStore
+}
+
+func (r *memRenderedConfigRepo) Get(ctx context.Context, name string) (*models.RenderedConfig, error) {
+	defer r.s.lock()()
+	rc, ok := r.s.data.rendered[name]
+	if !ok {
+		return nil, fmt.Errorf("get rendered config: %w", ErrNotFound)
+	}
+	return &rc, nil
+}
+
+func (r *memRenderedConfigRepo) Upsert(ctx context.Context, rc *models.RenderedConfig) error {
+	defer r.s.lock()()
+	if rc.WrittenAt.IsZero() {
+		rc.WrittenAt = time.Now()
+	}
+	r.s.data.rendered[rc.Name] = *rc
+	return nil
+}
+
+func (r *memRenderedConfigRepo) Delete(ctx context.Context, name string) error {
+	defer r.s.lock()()
+	delete(r.s.data.rendered, name)
+	return nil
+}
+
+/* -------------------- 路由模板 -------------------- */
+
+type memRoutingProfileRepo struct {
+	s *MemoryStore
+}
+
+// 0 与 nil 等价（SQL 实现写入 NULL）
+func normProfileID(id *int) *int {
+	if id == nil || *id == 0 {
+		return nil
+	}
+	v := *id
+	return &v
+}
+
+func (r *memRoutingProfileRepo) List(ctx context.Context) ([]models.RoutingProfile, error) {
+	defer r.s.lock()()
+	list := make([]models.RoutingProfile, 0, len(r.s.data.profiles))
+	for _, rp := range r.s.data.profiles {
+		list = append(list, rp)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list, nil
+}
+
+func (r *memRoutingProfileRepo) Get(ctx context.Context, id int) (*models.RoutingProfile, error) {
+	defer r.s.lock()()
+	rp, ok := r.s.data.profiles[id]
+	if !ok {
+		return nil, fmt.Errorf("get routing profile: %w", ErrNotFound)
+	}
+	return &rp, nil
+}
+
+func (r *memRoutingProfileRepo) GetByName(ctx context.Context, name string) (*models.RoutingProfile, error) {
+	defer r.s.lock()()
+	for _, rp := range r.s.data.profiles {
+		if rp.Name == name {
+			return &rp, nil
+		}
+	}
+	return nil, fmt.Errorf("get routing profile by name: %w", ErrNotFound)
+}
+
+func (r *memRoutingProfileRepo) checkUnique(rp *models.RoutingProfile) error {
+	for id, other := range r.s.data.profiles {
+		if id != rp.ID && other.Name == rp.Name {
+			return fmt.Errorf("routing profile name %q: %w", rp.Name, ErrConflict)
+		}
+	}
+	return nil
+}
+
+func (r *memRoutingProfileRepo) Create(ctx context.Context, rp *models.RoutingProfile) error {
+	defer r.s.lock()()
+	rp.ID = 0
+	if err := r.checkUnique(rp); err != nil {
+		return fmt.Errorf("create routing profile: %w", err)
+	}
+	r.s.data.nextProfID++
+	rp.ID = r.s.data.nextProfID
+	now := time.Now()
+	rp.CreatedAt, rp.UpdatedAt = now, now
+	r.s.data.profiles[rp.ID] = *rp
+	return nil
+}
+
+func (r *memRoutingProfileRepo) Update(ctx context.Context, rp *models.RoutingProfile) error {
+	defer r.s.lock()()
+	cur, ok := r.s.data.profiles[rp.ID]
+	if !ok {
+		return fmt.Errorf("update routing profile: %w", ErrNotFound)
+	}
+	if err := r.checkUnique(rp); err != nil {
+		return fmt.Errorf("update routing profile: %w", err)
+	}
+	next := *rp
+	next.CreatedAt = cur.CreatedAt
+	next.UpdatedAt = time.Now()
+	r.s.data.profiles[rp.ID] = next
+	return nil
+}
+
+func (r *memRoutingProfileRepo) Delete(ctx context.Context, id int) error {
+	defer r.s.lock()()
+	if _, ok := r.s.data.profiles[id]; !ok {
+		return fmt.Errorf("delete routing profile: %w", ErrNotFound)
+	}
+	delete(r.s.data.profiles, id)
+	for pid, p := range r.s.data.peers {
+		if p.RoutingProfileID != nil && *p.RoutingProfileID == id {
+			p.RoutingProfileID = nil
+			r.s.data.peers[pid] = p
+		}
+	}
+	return nil
+}
+
+/* -------------------- IPAM -------------------- */
+
+type memIPAMRepo struct {
+	s *MemoryStore
+}
+
+func (r *memIPAMRepo) ListPools(ctx context.Context, interfaceID int) ([]models.IPPool, error) {
+	defer r.s.lock()()
+	var list []models.IPPool
+	for _, p := range r.s.data.pools {
+		if p.InterfaceID == interfaceID {
+			list = append(list, p)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list, nil
+}
+
+func (r *memIPAMRepo) GetPool(ctx context.Context, id int) (*models.IPPool, error) {
+	defer r.s.lock()()
+	p, ok := r.s.data.pools[id]
+	if !ok {
+		return nil, fmt.Errorf("get ip pool: %w", ErrNotFound)
+	}
+	return &p, nil
+}
+
+func (r *memIPAMRepo) checkPoolUnique(p *models.IPPool) error {
+	for id, other := range r.s.data.pools {
+		if id != p.ID && other.InterfaceID == p.InterfaceID && other.Name == p.Name {
+			return fmt.Errorf("ip pool name %q: %w", p.Name, ErrConflict)
+		}
+	}
+	return nil
+}
+
+func (r *memIPAMRepo) CreatePool(ctx context.Context, p *models.IPPool) error {
+	defer r.s.lock()()
+	if _, ok := r.s.data.interfaces[p.InterfaceID]; !ok {
+		return fmt.Errorf("create ip pool: interface %d: %w", p.InterfaceID, ErrNotFound)
+	}
+	p.ID = 0
+	if err := r.checkPoolUnique(p); err != nil {
+		return fmt.Errorf("create ip pool: %w", err)
+	}
+	r.s.data.nextPoolID++
+	p.ID = r.s.data.nextPoolID
+	now := time.Now()
+	p.CreatedAt, p.UpdatedAt = now, now
+	r.s.data.pools[p.ID] = *p
+	r.s.data.bumpIPAM(p.InterfaceID)
+	return nil
+}
+
+func (r *memIPAMRepo) UpdatePool(ctx context.Context, p *models.IPPool) error {
+	defer r.s.lock()()
+	cur, ok := r.s.data.pools[p.ID]
+	if !ok {
+		return fmt.Errorf("update ip pool: %w", ErrNotFound)
+	}
+	next := cur
+	next.Name, next.Ranges, next.Description = p.Name, p.Ranges, p.Description
+	if err := r.checkPoolUnique(&next); err != nil {
+		return fmt.Errorf("update ip pool: %w", err)
+	}
+	next.UpdatedAt = time.Now()
+	r.s.data.pools[p.ID] = next
+	r.s.data.bumpIPAM(next.InterfaceID)
+	return nil
+}
+
+func (r *memIPAMRepo) DeletePool(ctx context.Context, id int) error {
+	defer r.s.lock()()
+	cur, ok := r.s.data.pools[id]
+	if !ok {
+		return fmt.Errorf("delete ip pool: %w", ErrNotFound)
+	}
+	delete(r.s.data.pools, id)
+	r.s.data.bumpIPAM(cur.InterfaceID)
+	return nil
+}
+
+func (r *memIPAMRepo) ListReservations(ctx context.Context, interfaceID int) ([]models.IPReservation, error) {
+	defer r.s.lock()()
+	var list []models.IPReservation
+	for _, res := range r.s.data.reserved {
+		if res.InterfaceID == interfaceID {
+			list = append(list, res)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].ID < list[j].ID })
+	return list, nil
+}
+
+func (r *memIPAMRepo) CreateReservation(ctx context.Context, res *models.IPReservation) error {
+	defer r.s.lock()()
+	if _, ok := r.s.data.interfaces[res.InterfaceID]; !ok {
+		return fmt.Errorf("create ip reservation: interface %d: %w", res.InterfaceID, ErrNotFound)
+	}
+	r.s.data.nextResID++
+	res.ID = r.s.data.nextResID
+	res.CreatedAt = time.Now()
+	r.s.data.reserved[res.ID] = *res
+	r.s.data.bumpIPAM(res.InterfaceID)
+	return nil
+}
+
+func (r *memIPAMRepo) UpdateReservation(ctx context.Context, res *models.IPReservation) error {
+	defer r.s.lock()()
+	cur, ok := r.s.data.reserved[res.ID]
+	if !ok {
+		return fmt.Errorf("update ip reservation: %w", ErrNotFound)
+	}
+	cur.Addresses, cur.Note = res.Addresses, res.Note
+	r.s.data.reserved[res.ID] = cur
+	r.s.data.bumpIPAM(cur.InterfaceID)
+	return nil
+}
+
+func (r *memIPAMRepo) DeleteReservation(ctx context.Context, id int) error {
+	defer r.s.lock()()
+	cur, ok := r.s.data.reserved[id]
+	if !ok {
+		return fmt.Errorf("delete ip reservation: %w", ErrNotFound)
+	}
+	delete(r.s.data.reserved, id)
+	r.s.data.bumpIPAM(cur.InterfaceID)
+	return nil
+}
+
+func quarantineKey(interfaceID int, ip string) string {
+	return fmt.Sprintf("%d/%s", interfaceID, ip)
+}
+
+func (r *memIPAMRepo) ListQuarantine(ctx context.Context, interfaceID int, now time.Time) ([]models.QuarantinedIP, error) {
+	defer r.s.lock()()
+	var list []models.QuarantinedIP
+	for _, q := range r.s.data.quarantine {
+		if q.InterfaceID == interfaceID && q.Until.After(now) {
+			list = append(list, q)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Until.Before(list[j].Until) })
+	return list, nil
+}
+
+func (r *memIPAMRepo) Quarantine(ctx context.Context, q *models.QuarantinedIP) error {
+	defer r.s.lock()()
+	for k, old := range r.s.data.quarantine {
+		if old.InterfaceID == q.InterfaceID && !old.Until.After(q.ReleasedAt) {
+			delete(r.s.data.quarantine, k)
+		}
+	}
+	r.s.data.quarantine[quarantineKey(q.InterfaceID, q.IP)] = *q
+	r.s.data.bumpIPAM(q.InterfaceID)
+	return nil
+}
+
+func (r *memIPAMRepo) Unquarantine(ctx context.Context, interfaceID int, ip string) error {
+	defer r.s.lock()()
+	key := quarantineKey(interfaceID, ip)
+	if _, ok := r.s.data.quarantine[key]; ok {
+		delete(r.s.data.quarantine, key)
+		r.s.data.bumpIPAM(interfaceID)
+	}
+	return nil
+}
+
+func (r *memIPAMRepo) Version(ctx context.Context, interfaceID int) (int64, error) {
+	defer r.s.lock()()
+	return r.s.data.ipamVer[interfaceID], nil
+}
+
+// freeSpanKey 对应 SQL ipam_free_spans 主键中的 (family, first)
+type freeSpanKey struct {
+	family int
+	first  string
+}
+
+func (r *memIPAMRepo) GetFreeState(ctx context.Context, interfaceID int) (*models.IPAMFreeState, error) {
+	defer r.s.lock()()
+	st, ok := r.s.data.freeState[interfaceID]
+	if !ok {
+		return nil, fmt.Errorf("get ipam free state: %w", ErrNotFound)
+	}
+	return &st, nil
+}
+
+func (r *memIPAMRepo) ListFreeSpans(ctx context.Context, interfaceID int) ([]models.IPAMFreeSpan, error) {
+	defer r.s.lock()()
+	var list []models.IPAMFreeSpan
+	for _, sp := range r.s.data.freeSpans[interfaceID] {
+		list = append(list, sp)
+	}
+	return list, nil
+}
+
+func (r *memIPAMRepo) SaveFreeSpans(ctx context.Context, st *models.IPAMFreeState, spans []models.IPAMFreeSpan) error {
+	defer r.s.lock()()
+	r.s.data.freeState[st.InterfaceID] = *st
+	r.s.data.freeSpans[st.InterfaceID] = map[freeSpanKey]models.IPAMFreeSpan{}
+	r.writeFreeSpans(st.InterfaceID, spans, nil)
+	return nil
+}
+
+func (r *memIPAMRepo) PatchFreeSpans(ctx context.Context, from int64, st *models.IPAMFreeState, set, removed []models.IPAMFreeSpan) (bool, error) {
+	defer r.s.lock()()
+	cur, ok := r.s.data.freeState[st.InterfaceID]
+	if !ok || cur.Version != from || cur.Families != st.Families {
+		return false, nil
+	}
+	r.s.data.freeState[st.InterfaceID] = *st
+	r.writeFreeSpans(st.InterfaceID, set, removed)
+	return true, nil
+}
+
+func (r *memIPAMRepo) writeFreeSpans(interfaceID int, set, removed []models.IPAMFreeSpan) {
+	m := r.s.data.freeSpans[interfaceID]
+	if m == nil {
+		m = map[freeSpanKey]models.IPAMFreeSpan{}
+		r.s.data.freeSpans[interfaceID] = m
+	}
+	for _, sp := range removed {
+		delete(m, freeSpanKey{sp.Family, sp.First})
+	}
+	for _, sp := range set {
+		m[freeSpanKey{sp.Family, sp.First}] = sp
+	}
+}
+
+/* -------------------- 网关设置 -------------------- */
+
+type memGatewayRepo struct {
+	s *MemoryStore
+}
+
+func (r *memGatewayRepo) Get(ctx context.Context, interfaceID int) (*models.InterfaceGateway, error) {
+	defer r.s.lock()()
+	g, ok := r.s.data.gateways[interfaceID]
+	if !ok {
+		return nil, fmt.Errorf("get interface gateway: %w", ErrNotFound)
+	}
+	return &g, nil
+}
+
+func (r *memGatewayRepo) List(ctx context.Context) ([]models.InterfaceGateway, error) {
+	defer r.s.lock()()
+	list := make([]models.InterfaceGateway, 0, len(r.s.data.gateways))
+	for _, g := range r.s.data.gateways {
+		list = append(list, g)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].InterfaceID < list[j].InterfaceID })
+	return list, nil
+}
+
+func (r *memGatewayRepo) Save(ctx context.Context, g *models.InterfaceGateway) error {
+	defer r.s.lock()()
+	if _, ok := r.s.data.interfaces[g.InterfaceID]; !ok {
+		return fmt.Errorf("save interface gateway: %w", ErrNotFound)
+	}
+	g.UpdatedAt = time.Now().UTC()
+	r.s.data.gateways[g.InterfaceID] = *g
+	return nil
+}
+
+/* -------------------- 客户端模式远端 -------------------- */
+
+type memRemoteRepo struct {
+	s *MemoryStore
+}
+
+func (r *memRemoteRepo) Get(ctx context.Context, interfaceID int) (*models.ClientRemote, error) {
+	defer r.s.lock()()
+	c, ok := r.s.data.remotes[interfaceID]
+	if !ok {
+		return nil, fmt.Errorf("get interface remote: %w", ErrNotFound)
+	}
+	return &c, nil
+}
+
+func (r *memRemoteRepo) Save(ctx context.Context, c *models.ClientRemote) error {
+	defer r.s.lock()()
+	if _, ok := r.s.data.interfaces[c.InterfaceID]; !ok {
+		return fmt.Errorf("save interface remote: %w", ErrNotFound)
+	}
+	c.UpdatedAt = time.Now().UTC()
+	r.s.data.remotes[c.InterfaceID] = *c
+	return nil
+}
+
+func (r *memRemoteRepo) Delete(ctx context.Context, interfaceID int) error {
+	defer r.s.lock()()
+	delete(r.s.data.remotes, interfaceID)
+	return nil
+}
+
+/* -------------------- Mesh -------------------- */
+
+type memMeshRepo struct {
+	s *MemoryStore
+}
+
+// 补齐 member_count，等价于 SQL 的子查询
+func (r *memMeshRepo) hydrate(m models.Mesh) models.Mesh {
+	m.MemberCount = 0
+	for _, x := range r.s.data.meshMembers {
+		if x.MeshID == m.ID {
+			m.MemberCount++
+		}
+	}
+	return m
+}
+
+func (r *memMeshRepo) List(ctx context.Context) ([]models.Mesh, error) {
+	defer r.s.lock()()
+	list := make([]models.Mesh, 0, len(r.s.data.meshes))
+	for _, m := range r.s.data.meshes {
+		list = append(list, r.hydrate(m))
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list, nil
+}
+
+func (r *memMeshRepo) Get(ctx context.Context, id int) (*models.Mesh, error) {
+	defer r.s.lock()()
+	m, ok := r.s.data.meshes[id]
+	if !ok {
+		return nil, fmt.Errorf("get mesh: %w", ErrNotFound)
+	}
+	m = r.hydrate(m)
+	return &m, nil
+}
+
+func (r *memMeshRepo) checkUnique(m *models.Mesh) error {
+	for id, other := range r.s.data.meshes {
+		if id != m.ID && other.Name == m.Name {
+			return fmt.Errorf("mesh name %q: %w", m.Name, ErrConflict)
+		}
+	}
+	return nil
+}
+
+func (r *memMeshRepo) Create(ctx context.Context, m *models.Mesh) error {
+	defer r.s.lock()()
+	m.ID = 0
+	if err := r.checkUnique(m); err != nil {
+		return fmt.Errorf("create mesh: %w", err)
+	}
+	r.s.data.nextMeshID++
+	m.ID = r.s.data.nextMeshID
+	m.Revision = 1
+	now := time.Now()
+	m.CreatedAt, m.UpdatedAt = now, now
+	r.s.data.meshes[m.ID] = *m
+	return nil
+}
+
+func (r *memMeshRepo) Update(ctx context.Context, m *models.Mesh) error {
+	defer r.s.lock()()
+	cur, ok := r.s.data.meshes[m.ID]
+	if !ok {
+		return fmt.Errorf("update mesh: %w", ErrNotFound)
+	}
+	if err := r.checkUnique(m); err != nil {
+		return fmt.Errorf("update mesh: %w", err)
+	}
+	next := *m
+	next.CreatedAt = cur.CreatedAt
+	next.UpdatedAt = time.Now()
+	r.s.data.meshes[m.ID] = next
+	return nil
+}
+
+func (r *memMeshRepo) Bump(ctx context.Context, id int) error {
+	defer r.s.lock()()
+	m, ok := r.s.data.meshes[id]
+	if !ok {
+		return fmt.Errorf("bump mesh revision: %w", ErrNotFound)
+	}
+	m.Revision++
+	m.UpdatedAt = time.Now()
+	r.s.data.meshes[id] = m
+	return nil
+}
+
+func (r *memMeshRepo) Delete(ctx context.Context, id int) error {
+	defer r.s.lock()()
+	if _, ok := r.s.data.meshes[id]; !ok {
+		return fmt.Errorf("delete mesh: %w", ErrNotFound)
+	}
+	delete(r.s.data.meshes, id)
+	for k, x := range r.s.data.meshMembers {
+		if x.MeshID == id {
+			delete(r.s.data.meshMembers, k)
+		}
+	}
+	return nil
+}
+
+func (r *memMeshRepo) Members(ctx context.Context, meshID int) ([]models.MeshMember, error) {
+	defer r.s.lock()()
+	var list []models.MeshMember
+	for _, x := range r.s.data.meshMembers {
+		if x.MeshID == meshID {
+			list = append(list, x)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].ID < list[j].ID })
+	return list, nil
+}
+
+func (r *memMeshRepo) GetMember(ctx context.Context, id int) (*models.MeshMember, error) {
+	defer r.s.lock()()
+	m, ok := r.s.data.meshMembers[id]
+	if !ok {
+		return nil, fmt.Errorf("get mesh member: %w", ErrNotFound)
+	}
+	return &m, nil
+}
+
+func (r *memMeshRepo) checkMemberUnique(m *models.MeshMember) error {
+	for id, other := range r.s.data.meshMembers {
+		if id == m.ID || other.MeshID != m.MeshID {
+			continue
+		}
+		if other.Name == m.Name || other.PublicKey == m.PublicKey {
+			return fmt.Errorf("mesh member %q: %w", m.Name, ErrConflict)
+		}
+	}
+	return nil
+}
+
+func (r *memMeshRepo) CreateMember(ctx context.Context, m *models.MeshMember) error {
+	defer r.s.lock()()
+	if _, ok := r.s.data.meshes[m.MeshID]; !ok {
+		return fmt.Errorf("create mesh member: %w", ErrNotFound)
+	}
+	m.ID = 0
+	if err := r.checkMemberUnique(m); err != nil {
+		return fmt.Errorf("create mesh member: %w", err)
+	}
+	r.s.data.nextMMID++
+	m.ID = r.s.data.nextMMID
+	now := time.Now()
+	m.CreatedAt, m.UpdatedAt = now, now
+	r.s.data.meshMembers[m.ID] = *m
+	return nil
+}
+
+func (r *memMeshRepo) UpdateMember(ctx context.Context, m *models.MeshMember) error {
+	defer r.s.lock()()
+	cur, ok := r.s.data.meshMembers[m.ID]
+	if !ok {
+		return fmt.Errorf("update mesh member: %w", ErrNotFound)
+	}
+	next := *m
+	next.MeshID = cur.MeshID
+	if err := r.checkMemberUnique(&next); err != nil {
+		return fmt.Errorf("update mesh member: %w", err)
+	}
+	next.CreatedAt = cur.CreatedAt
+	next.UpdatedAt = time.Now()
+	r.s.data.meshMembers[m.ID] = next
+	return nil
+}
+
+func (r *memMeshRepo) DeleteMember(ctx context.Context, id int) error {
+	defer r.s.lock()()
+	if _, ok := r.s.data.meshMembers[id]; !ok {
+		return fmt.Errorf("delete mesh member: %w", ErrNotFound)
+	}
+	delete(r.s.data.meshMembers, id)
+	return nil
+}
+
+/* -------------------- ACL -------------------- */
+
+type memACLRepo struct {
+	s *MemoryStore
+}
+
+func (r *memACLRepo) List(ctx context.Context, interfaceID int) ([]models.ACLRule, error) {
+	defer r.s.lock()()
+	var list []models.ACLRule
+	for _, a := range r.s.data.acls {
+		if a.InterfaceID == interfaceID {
+			list = append(list, a)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Priority != list[j].Priority {
+			return list[i].Priority < list[j].Priority
+		}
+		return list[i].ID < list[j].ID
+	})
+	return list, nil
+}
+
+func (r *memACLRepo) Get(ctx context.Context, id int) (*models.ACLRule, error) {
+	defer r.s.lock()()
+	a, ok := r.s.data.acls[id]
+	if !ok {
+		return nil, fmt.Errorf("get acl rule: %w", ErrNotFound)
+	}
+	return &a, nil
+}
+
+func (r *memACLRepo) Create(ctx context.Context, a *models.ACLRule) error {
+	defer r.s.lock()()
+	r.s.data.nextACLID++
+	a.ID = r.s.data.nextACLID
+	now := time.Now()
+	a.CreatedAt, a.UpdatedAt = now, now
+	r.s.data.acls[a.ID] = *a
+	return nil
+}
+
+func (r *memACLRepo) Update(ctx context.Context, a *models.ACLRule) error {
+	defer r.s.lock()()
+	cur, ok := r.s.data.acls[a.ID]
+	if !ok {
+		return fmt.Errorf("update acl rule: %w", ErrNotFound)
+	}
+	next := *a
+	next.InterfaceID = cur.InterfaceID
+	next.CreatedAt = cur.CreatedAt
+	next.UpdatedAt = time.Now()
+	r.s.data.acls[a.ID] = next
+	return nil
+}
+
+func (r *memACLRepo) Delete(ctx context.Context, id int) error {
+	defer r.s.lock()()
+	if _, ok := r.s.data.acls[id]; !ok {
+		return fmt.Errorf("delete acl rule: %w", ErrNotFound)
+	}
+	delete(r.s.data.acls, id)
+	return nil
+}
+
+/* -------------------- Peer Group -------------------- */
+
+type memPeerGroupRepo struct {
+	s *MemoryStore
+}
+
+// 删除 peer 的全部分组成员关系
+func (d *memData) dropMemberships(peerID int) {
+	for k := range d.members {
+		if k[1] == peerID {
+			delete(d.members, k)
+		}
+	}
+}
+
+// 补齐 member_count，等价于 SQL 的子查询
+func (r *memPeerGroupRepo) hydrate(g models.PeerGroup) models.PeerGroup {
+	g.MemberCount = 0
+	for k := range r.s.data.members {
+		if k[0] == g.ID {
+			g.MemberCount++
+		}
+	}
+	return g
+}
+
+func (r *memPeerGroupRepo) List(ctx context.Context) ([]models.PeerGroup, error) {
+	defer r.s.lock()()
+	list := make([]models.PeerGroup, 0, len(r.s.data.groups))
+	for _, g := range r.s.data.groups {
+		list = append(list, r.hydrate(g))
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list, nil
+}
+
+func (r *memPeerGroupRepo) Get(ctx context.Context, id int) (*models.PeerGroup, error) {
+	defer r.s.lock()()
+	g, ok := r.s.data.groups[id]
+	if !ok {
+		return nil, fmt.Errorf("get peer group: %w", ErrNotFound)
+	}
+	g = r.hydrate(g)
+	return &g, nil
+}
+
+func (r *memPeerGroupRepo) GetByName(ctx context.Context, name string) (*models.PeerGroup, error) {
+	defer r.s.lock()()
+	for _, g := range r.s.data.groups {
+		if g.Name == name {
+			g = r.hydrate(g)
+			return &g, nil
+		}
+	}
+	return nil, fmt.Errorf("get peer group by name: %w", ErrNotFound)
+}
+
+func (r *memPeerGroupRepo) checkUnique(g *models.PeerGroup) error {
+	for id, other := range r.s.data.groups {
+		if id != g.ID && other.Name == g.Name {
+			return fmt.Errorf("peer group name %q: %w", g.Name, ErrConflict)
+		}
+	}
+	return nil
+}
+
+func (r *memPeerGroupRepo) Create(ctx context.Context, g *models.PeerGroup) error {
+	defer r.s.lock()()
+	g.ID = 0
+	if err := r.checkUnique(g); err != nil {
+		return fmt.Errorf("create peer group: %w", err)
+	}
+	r.s.data.nextGroupID++
+	g.ID = r.s.data.nextGroupID
+	now := time.Now()
+	g.CreatedAt, g.UpdatedAt = now, now
+	r.s.data.groups[g.ID] = *g
+	return nil
+}
+
+func (r *memPeerGroupRepo) Update(ctx context.Context, g *models.PeerGroup) error {
+	defer r.s.lock()()
+	cur, ok := r.s.data.groups[g.ID]
+	if !ok {
+		return fmt.Errorf("update peer group: %w", ErrNotFound)
+	}
+	if err := r.checkUnique(g); err != nil {
+		return fmt.Errorf("update peer group: %w", err)
+	}
+	next := *g
+	next.CreatedAt = cur.CreatedAt
+	next.UpdatedAt = time.Now()
+	r.s.data.groups[g.ID] = next
+	return nil
+}
+
+func (r *memPeerGroupRepo) Delete(ctx context.Context, id int) error {
+	defer r.s.lock()()
+	if _, ok := r.s.data.groups[id]; !ok {
+		return fmt.Errorf("delete peer group: %w", ErrNotFound)
+	}
+	delete(r.s.data.groups, id)
+	for k := range r.s.data.members {
+		if k[0] == id {
+			delete(r.s.data.members, k)
+		}
+	}
+	return nil
+}
+
+func (r *memPeerGroupRepo) Members(ctx context.Context, groupID int) ([]int, error) {
+	defer r.s.lock()()
+	var ids []int
+	for k := range r.s.data.members {
+		if k[0] == groupID {
+			ids = append(ids, k[1])
+		}
+	}
+	sort.Ints(ids)
+	return ids, nil
+}
+
+func (r *memPeerGroupRepo) AddMembers(ctx context.Context, groupID int, peerIDs []int) error {
+	defer r.s.lock()()
+	for _, pid := range peerIDs {
+		r.s.data.members[[2]int{groupID, pid}] = true
+	}
+	return nil
+}
+
+func (r *memPeerGroupRepo) SetMembers(ctx context.Context, groupID int, peerIDs []int) error {
+	defer r.s.lock()()
+	for k := range r.s.data.members {
+		if k[0] == groupID {
+			delete(r.s.data.members, k)
+		}
+	}
+	for _, pid := range peerIDs {
+		r.s.data.members[[2]int{groupID, pid}] = true
+	}
+	return nil
+}
+
+func (r *memPeerGroupRepo) RemoveMember(ctx context.Context, groupID, peerID int) error {
+	defer r.s.lock()()
+	k := [2]int{groupID, peerID}
+	if !r.s.data.members[k] {
+		return fmt.Errorf("remove peer group member: %w", ErrNotFound)
+	}
+	delete(r.s.data.members, k)
+	return nil
+}
+
+func (r *memPeerGroupRepo) SetPeerGroups(ctx context.Context, peerID int, groupIDs []int) error {
+	defer r.s.lock()()
+	r.s.data.dropMemberships(peerID)
+	for _, gid := range groupIDs {
+		r.s.data.members[[2]int{gid, peerID}] = true
+	}
+	return nil
+}
+
+func (r *memPeerGroupRepo) Memberships(ctx context.Context) (map[int][]string, error) {
+	defer r.s.lock()()
+	out := map[int][]string{}
+	for k := range r.s.data.members {
+		if g, ok := r.s.data.groups[k[0]]; ok {
+			out[k[1]] = append(out[k[1]], g.Name)
+		}
+	}
+	for _, names := range out {
+		sort.Strings(names)
+	}
+	return out, nil
+}
+
+/* -------------------- Event -------------------- */
+
+type memEventRepo struct {
+	s *MemoryStore
+}
+
+func (r *memEventRepo) Add(ctx context.Context, e *models.InterfaceEvent) error {
+	defer r.s.lock()()
+	r.s.data.nextEventID++
+	e.ID = r.s.data.nextEventID
+	e.CreatedAt = time.Now()
+	r.s.data.events = append(r.s.data.events, *e)
+
+	// 只保留最近的若干条
+	n := 0
+	for i := len(r.s.data.events) - 1; i >= 0; i-- {
+		if r.s.data.events[i].InterfaceID != e.InterfaceID {
+			continue
+		}
+		if n++; n > MaxEventsPerInterface {
+			r.s.data.events = slices.Delete(r.s.data.events, i, i+1)
+		}
+	}
+	return nil
+}
+
+func (r *memEventRepo) List(ctx context.Context, interfaceID, limit int) ([]models.InterfaceEvent, error) {
+	defer r.s.lock()()
+	var list []models.InterfaceEvent
+	for i := len(r.s.data.events) - 1; i >= 0 && len(list) < limit; i-- {
+		if e := r.s.data.events[i]; e.InterfaceID == interfaceID {
+			list = append(list, e)
+		}
+	}
+	return list, nil
+}
+
+/* -------------------- peer 在线时段 -------------------- */
+
+type memPeerSessionRepo struct {
+	s *MemoryStore
+}
+
+func (r *memPeerSessionRepo) Open(ctx context.Context, ps *models.PeerSession) error {
+	defer r.s.lock()()
+	r.s.data.nextSessID++
+	ps.ID = r.s.data.nextSessID
+	next := *ps
+	next.EndedAt = nil
+	r.s.data.sessions[ps.ID] = next
+	return nil
+}
+
+func (r *memPeerSessionRepo) Close(ctx context.Context, peerID int, endedAt time.Time) error {
+	defer r.s.lock()()
+	for k, ps := range r.s.data.sessions {
+		if ps.PeerID == peerID && ps.EndedAt == nil {
+			t := endedAt
+			ps.EndedAt = &t
+			r.s.data.sessions[k] = ps
+		}
+	}
+	return nil
+}
+
+func (r *memPeerSessionRepo) ListOpen(ctx context.Context) ([]models.PeerSession, error) {
+	return r.list(func(ps models.PeerSession) bool { return ps.EndedAt == nil }), nil
+}
+
+func (r *memPeerSessionRepo) ListByPeer(ctx context.Context, peerID int, since time.Time) ([]models.PeerSession, error) {
+	return r.list(func(ps models.PeerSession) bool {
+		return ps.PeerID == peerID && (ps.EndedAt == nil || !ps.EndedAt.Before(since))
+	}), nil
+}
+
+func (r *memPeerSessionRepo) ListSince(ctx context.Context, since time.Time) ([]models.PeerSession, error) {
+	return r.list(func(ps models.PeerSession) bool { return ps.EndedAt == nil || !ps.EndedAt.Before(since) }), nil
+}
+
+func (r *memPeerSessionRepo) Prune(ctx context.Context, before time.Time) error {
+	defer r.s.lock()()
+	for k, ps := range r.s.data.sessions {
+		if ps.EndedAt != nil && ps.EndedAt.Before(before) {
+			delete(r.s.data.sessions, k)
+		}
+	}
+	return nil
+}
+
+// list 按开始时间倒序返回满足 keep 的时段
+func (r *memPeerSessionRepo) list(keep func(models.PeerSession) bool) []models.PeerSession {
+	defer r.s.lock()()
+	var list []models.PeerSession
+	for _, ps := range r.s.data.sessions {
+		if keep(ps) {
+			list = append(list, ps)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if !list[i].StartedAt.Equal(list[j].StartedAt) {
+			return list[i].StartedAt.After(list[j].StartedAt)
+		}
+		return list[i].ID > list[j].ID
+	})
+	return list
+}
+
+/* -------------------- 告警 -------------------- */
+
+type memAlertRepo struct {
+	s *MemoryStore
+}
+
+// 规则与通知渠道的 ID 列表按副本保存，避免调用方修改共享底层数组
+func copyAlertRule(ar models.AlertRule) models.AlertRule {
+	ar.NotifierIDs = append([]int{}, ar.NotifierIDs...)
+	ar.InterfaceID = normProfileID(ar.InterfaceID)
+	return ar
+}
+
+func (r *memAlertRepo) ListRules(ctx context.Context) ([]models.AlertRule, error) {
+	defer r.s.lock()()
+	list := make([]models.AlertRule, 0, len(r.s.data.alertRules))
+	for _, ar := range r.s.data.alertRules {
+		list = append(list, copyAlertRule(ar))
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list, nil
+}
+
+func (r *memAlertRepo) GetRule(ctx context.Context, id int) (*models.AlertRule, error) {
+	defer r.s.lock()()
+	ar, ok := r.s.data.alertRules[id]
+	if !ok {
+		return nil, fmt.Errorf("get alert rule: %w", ErrNotFound)
+	}
+	ar = copyAlertRule(ar)
+	return &ar, nil
+}
+
+func (r *memAlertRepo) checkUnique(ar *models.AlertRule) error {
+	for id, other := range r.s.data.alertRules {
+		if id != ar.ID && other.Name == ar.Name {
+			return fmt.Errorf("alert rule name %q: %w", ar.Name, ErrConflict)
+		}
+	}
+	return nil
+}
+
+func (r *memAlertRepo) CreateRule(ctx context.Context, ar *models.AlertRule) error {
+	defer r.s.lock()()
+	ar.ID = 0
+	if err := r.checkUnique(ar); err != nil {
+		return fmt.Errorf("create alert rule: %w", err)
+	}
+	r.s.data.nextRuleID++
+	ar.ID = r.s.data.nextRuleID
+	now := time.Now()
+	ar.CreatedAt, ar.UpdatedAt = now, now
+	r.s.data.alertRules[ar.ID] = copyAlertRule(*ar)
+	return nil
+}
+
+func (r *memAlertRepo) UpdateRule(ctx context.Context, ar *models.AlertRule) error {
+	defer r.s.lock()()
+	cur, ok := r.s.data.alertRules[ar.ID]
+	if !ok {
+		return fmt.Errorf("update alert rule: %w", ErrNotFound)
+	}
+	if err := r.checkUnique(ar); err != nil {
+		return fmt.Errorf("update alert rule: %w", err)
+	}
+	next := copyAlertRule(*ar)
+	next.CreatedAt = cur.CreatedAt
+	next.UpdatedAt = time.Now()
+	r.s.data.alertRules[ar.ID] = next
+	return nil
+}
+
+func (r *memAlertRepo) DeleteRule(ctx context.Context, id int) error {
+	defer r.s.lock()()
+	if _, ok := r.s.data.alertRules[id]; !ok {
+		return fmt.Errorf("delete alert rule: %w", ErrNotFound)
+	}
+	delete(r.s.data.alertRules, id)
+	return nil
+}
+
+func (r *memAlertRepo) List(ctx context.Context, f AlertFilter) ([]models.Alert, error) {
+	defer r.s.lock()()
+	var list []models.Alert
+	for _, a := range r.s.data.alerts {
+		if (f.Status != "" && a.Status != f.Status) || (f.Type != "" && a.Type != f.Type) || (f.RuleID != 0 && a.RuleID != f.RuleID) {
+			continue
+		}
+		list = append(list, a)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].ID > list[j].ID })
+	if f.Limit > 0 && len(list) > f.Limit {
+		list = list[:f.Limit]
+	}
+	return list, nil
+}
+
+func (r *memAlertRepo) Create(ctx context.Context, a *models.Alert) error {
+	defer r.s.lock()()
+	r.s.data.nextAlertID++
+	a.ID = r.s.data.nextAlertID
+	r.s.data.alerts[a.ID] = *a
+
+	// 只保留最近的若干条已解决告警
+	var resolved []int
+	for id, x := range r.s.data.alerts {
+		if x.Status == models.AlertStatusResolved {
+			resolved = append(resolved, id)
+		}
+	}
+	if len(resolved) > MaxAlertHistory {
+		sort.Sort(sort.Reverse(sort.IntSlice(resolved)))
+		for _, id := range resolved[MaxAlertHistory:] {
+			delete(r.s.data.alerts, id)
+		}
+	}
+	return nil
+}
+
+func (r *memAlertRepo) Update(ctx context.Context, a *models.Alert) error {
+	defer r.s.lock()()
+	cur, ok := r.s.data.alerts[a.ID]
+	if !ok {
+		return fmt.Errorf("update alert: %w", ErrNotFound)
+	}
+	// 规则、类型与去重键在创建后不变
+	cur.Severity, cur.Subject, cur.Message, cur.Status = a.Severity, a.Subject, a.Message, a.Status
+	cur.LastSeenAt, cur.ResolvedAt, cur.NotifiedAt, cur.NotifyError = a.LastSeenAt, a.ResolvedAt, a.NotifiedAt, a.NotifyError
+	r.s.data.alerts[a.ID] = cur
+	return nil
+}
+
+/* -------------------- 通知渠道 -------------------- */
+
+type memNotifierRepo struct {
+	s *MemoryStore
+}
+
+func copyNotifier(n models.Notifier) models.Notifier {
+	settings := make(map[string]string, len(n.Settings))
+	for k, v := range n.Settings {
+		settings[k] = v
+	}
+	n.Settings = settings
+	return n
+}
+
+func (r *memNotifierRepo) List(ctx context.Context) ([]models.Notifier, error) {
+	defer r.s.lock()()
+	list := make([]models.Notifier, 0, len(r.s.data.notifiers))
+	for _, n := range r.s.data.notifiers {
+		list = append(list, copyNotifier(n))
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list, nil
+}
+
+func (r *memNotifierRepo) Get(ctx context.Context, id int) (*models.Notifier, error) {
+	defer r.s.lock()()
+	n, ok := r.s.data.notifiers[id]
+	if !ok {
+		return nil, fmt.Errorf("get notifier: %w", ErrNotFound)
+	}
+	n = copyNotifier(n)
+	return &n, nil
+}
+
+func (r *memNotifierRepo) checkUnique(n *models.Notifier) error {
+	for id, other := range r.s.data.notifiers {
+		if id != n.ID && other.Name == n.Name {
+			return fmt.Errorf("notifier name %q: %w", n.Name, ErrConflict)
+		}
+	}
+	return nil
+}
+
+func (r *memNotifierRepo) Create(ctx context.Context, n *models.Notifier) error {
+	defer r.s.lock()()
+	n.ID = 0
+	if err := r.checkUnique(n); err != nil {
+		return fmt.Errorf("create notifier: %w", err)
+	}
+	r.s.data.nextNotifID++
+	n.ID = r.s.data.nextNotifID
+	now := time.Now()
+	n.CreatedAt, n.UpdatedAt = now, now
+	r.s.data.notifiers[n.ID] = copyNotifier(*n)
+	return nil
+}
+
+func (r *memNotifierRepo) Update(ctx context.Context, n *models.Notifier) error {
+	defer r.s.lock()()
+	cur, ok := r.s.data.notifiers[n.ID]
+	if !ok {
+		return fmt.Errorf("update notifier: %w", ErrNotFound)
+	}
+	if err := r.checkUnique(n); err != nil {
+		return fmt.Errorf("update notifier: %w", err)
+	}
+	next := copyNotifier(*n)
+	next.CreatedAt = cur.CreatedAt
+	next.UpdatedAt = time.Now()
+	r.s.data.notifiers[n.ID] = next
+	return nil
+}
+
+func (r *memNotifierRepo) Delete(ctx context.Context, id int) error {
+	defer r.s.lock()()
+	if _, ok := r.s.data.notifiers[id]; !ok {
+		return fmt.Errorf("delete notifier: %w", ErrNotFound)
+	}
+	delete(r.s.data.notifiers, id)
+	return nil
+}
@@ -0,0 +1,375 @@
+package repository
+
+import (
+	"backend/database"
+	"backend/models"
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+)
+
+// newSQLTestStore 在临时目录建一个完整 schema 的 SQLite 库
+func newSQLTestStore(t *testing.T) *SQLStore {
+	t.Helper()
+	db, err := database.Initialize(filepath.Join(t.TempDir(), "parity.db"))
+	if err != nil {
+		t.Fatalf("init sqlite: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return NewSQLStore(db)
+}
+
+// errKind 把错误归类，两种实现的错误文本不必一致
+func errKind(err error) string {
+	switch {
+	case err == nil:
+		return "ok"
+	case errors.Is(err, ErrIPConflict):
+		return "ip conflict"
+	case errors.Is(err, ErrConflict):
+		return "conflict"
+	case errors.Is(err, ErrNotFound):
+		return "not found"
+	default:
+		return "error"
+	}
+}
+
+// normalize 去掉写入时间戳，其余时间统一到 UTC 秒（SQLite 只存到秒）
+func normalize(v any) any {
+	rv := reflect.ValueOf(v)
+	cp := reflect.New(rv.Type()).Elem()
+	cp.Set(rv)
+	normalizeValue(cp, "")
+	return cp.Interface()
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+func normalizeValue(v reflect.Value, field string) {
+	switch {
+	case v.Type() == timeType:
+		if field == "CreatedAt" || field == "UpdatedAt" {
+			v.Set(reflect.Zero(timeType))
+		} else {
+			v.Set(reflect.ValueOf(v.Interface().(time.Time).UTC().Truncate(time.Second)))
+		}
+	case v.Kind() == reflect.Pointer && !v.IsNil():
+		e := reflect.New(v.Type().Elem())
+		e.Elem().Set(v.Elem())
+		normalizeValue(e.Elem(), field)
+		v.Set(e)
+	case v.Kind() == reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			if v.Type().Field(i).IsExported() {
+				normalizeValue(v.Field(i), v.Type().Field(i).Name)
+			}
+		}
+	case v.Kind() == reflect.Slice && !v.IsNil():
+		s := reflect.MakeSlice(v.Type(), v.Len(), v.Len())
+		reflect.Copy(s, v)
+		for i := 0; i < s.Len(); i++ {
+			normalizeValue(s.Index(i), field)
+		}
+		v.Set(s)
+	}
+}
+
+// recorder 收集一个场景中的观察结果，逐条比较两种实现
+type recorder struct {
+	t   *testing.T
+	obs []string
+}
+
+func (r *recorder) see(label string, v any) {
+	r.obs = append(r.obs, fmt.Sprintf("%s: %+v", label, normalize(v)))
+}
+
+func (r *recorder) err(label string, err error) {
+	r.obs = append(r.obs, label+": "+errKind(err))
+}
+
+func (r *recorder) must(label string, err error) {
+	r.t.Helper()
+	if err != nil {
+		r.t.Fatalf("%s: %v", label, err)
+	}
+}
+
+func testInterface(name string, port int) *models.WireGuardInterface {
+	return &models.WireGuardInterface{Name: name, PrivateKey: "priv-" + name, PublicKey: "pub-" + name,
+		ListenPort: port, Address: "10.8.0.1/24", CIDR: "10.8.0.0/24", ServerIP: "10.8.0.1", MTU: 1420, Mode: "server"}
+}
+
+func testPeer(ifaceID int, name, ip string) *models.WireGuardPeer {
+	return &models.WireGuardPeer{InterfaceID: ifaceID, Name: name, PublicKey: "pub-" + name, IP: ip,
+		AllowedIPs: ip + "/32", PersistentKeepalive: 25}
+}
+
+// testPeerWithID 复制 p 并替换地址，用于不改动原对象的失败更新
+func testPeerWithID(p *models.WireGuardPeer, ip string) *models.WireGuardPeer {
+	cp := *p
+	cp.IP = ip
+	return &cp
+}
+
+func TestStoreParity(t *testing.T) {
+	ctx := context.Background()
+	scenarios := []struct {
+		name string
+		run  func(r *recorder, st Store)
+	}{
+		{
+			name: "interfaces",
+			run: func(r *recorder, st Store) {
+				wg0, wg1 := testInterface("wg0", 51820), testInterface("wg1", 51821)
+				r.must("create wg0", st.Interfaces().Create(ctx, wg0))
+				r.must("create wg1", st.Interfaces().Create(ctx, wg1))
+				r.err("duplicate name", st.Interfaces().Create(ctx, testInterface("wg0", 51822)))
+				r.err("duplicate port", st.Interfaces().Create(ctx, testInterface("wg2", 51820)))
+
+				list, err := st.Interfaces().List(ctx)
+				r.must("list", err)
+				r.see("list", list)
+				got, err := st.Interfaces().GetByName(ctx, "wg1")
+				r.must("get by name", err)
+				r.see("get by name", got)
+
+				wg0.MTU, wg0.DNS, wg0.PostUp = 1380, "1.1.1.1", "echo up"
+				r.must("update", st.Interfaces().Update(ctx, wg0))
+				r.must("set status", st.Interfaces().SetStatus(ctx, wg0.ID, "running"))
+				got, err = st.Interfaces().Get(ctx, wg0.ID)
+				r.must("get", err)
+				r.see("after update", got)
+
+				_, err = st.Interfaces().Get(ctx, 999)
+				r.err("get missing", err)
+				_, err = st.Interfaces().GetByName(ctx, "nope")
+				r.err("get missing by name", err)
+				r.err("delete missing", st.Interfaces().Delete(ctx, 999))
+			},
+		},
+		{
+			name: "peers",
+			run: func(r *recorder, st Store) {
+				it := testInterface("wg0", 51820)
+				r.must("create interface", st.Interfaces().Create(ctx, it))
+				a, b := testPeer(it.ID, "a", "10.8.0.2"), testPeer(it.ID, "b", "10.8.0.3, fd00::3")
+				r.must("create a", st.Peers().Create(ctx, a))
+				r.must("create b", st.Peers().Create(ctx, b))
+				r.err("duplicate ip", st.Peers().Create(ctx, testPeer(it.ID, "c", "10.8.0.2")))
+				// 双栈 peer 的每个地址各自唯一，即便完整的 "v4, v6" 字符串不同
+				r.err("dual-stack shares v4", st.Peers().Create(ctx, testPeer(it.ID, "e", "10.8.0.3, fd00::4")))
+				r.err("dual-stack shares v6", st.Peers().Create(ctx, testPeer(it.ID, "f", "10.8.0.4, fd00::3")))
+				r.err("single v6 taken by dual-stack", st.Peers().Create(ctx, testPeer(it.ID, "g", "fd00::3")))
+				r.err("missing interface", st.Peers().Create(ctx, testPeer(999, "d", "10.8.0.9")))
+
+				list, err := st.Peers().ListByInterface(ctx, it.ID)
+				r.must("list", err)
+				r.see("list", list)
+				ips, err := st.Peers().UsedIPs(ctx, it.ID)
+				r.must("used ips", err)
+				sort.Strings(ips)
+				r.see("used ips", ips)
+
+				a.Name, a.Endpoint, a.Disabled, a.Type, a.RoutedSubnets = "a2", " 1.2.3.4:51820 ", true, "site", "192.168.1.0/24"
+				r.must("update", st.Peers().Update(ctx, a))
+				last := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+				r.must("handshake", st.Peers().SetHandshake(ctx, a.ID, "active", &last))
+				r.must("resolved endpoint", st.Peers().SetResolvedEndpoint(ctx, a.ID, "1.2.3.4:51820"))
+				got, err := st.Peers().Get(ctx, a.ID)
+				r.must("get", err)
+				r.see("after update", got)
+
+				b.IP = "10.8.0.2"
+				r.err("update to taken ip", st.Peers().Update(ctx, b))
+				b.IP = "10.8.0.5, fd00::2"
+				r.err("update to dual-stack with taken v4", st.Peers().Update(ctx, testPeerWithID(b, "10.8.0.2, fd00::5")))
+				r.must("update dual-stack", st.Peers().Update(ctx, b))
+				r.must("reuse released v4", st.Peers().Create(ctx, testPeer(it.ID, "h", "10.8.0.3")))
+				r.err("update missing", st.Peers().Update(ctx, testPeer(it.ID, "x", "10.8.0.50")))
+				r.must("delete", st.Peers().Delete(ctx, a.ID))
+				r.err("delete again", st.Peers().Delete(ctx, a.ID))
+				_, err = st.Peers().Get(ctx, a.ID)
+				r.err("get deleted", err)
+			},
+		},
+		{
+			name: "ipam",
+			run: func(r *recorder, st Store) {
+				it := testInterface("wg0", 51820)
+				r.must("create interface", st.Interfaces().Create(ctx, it))
+				v0, err := st.IPAM().Version(ctx, it.ID)
+				r.must("version", err)
+
+				pb := &models.IPPool{InterfaceID: it.ID, Name: "b", Ranges: "10.8.0.128/25"}
+				r.must("create pool b", st.IPAM().CreatePool(ctx, pb))
+				r.must("create pool a", st.IPAM().CreatePool(ctx, &models.IPPool{InterfaceID: it.ID, Name: "a", Ranges: "10.8.0.16/28"}))
+				r.err("duplicate pool", st.IPAM().CreatePool(ctx, &models.IPPool{InterfaceID: it.ID, Name: "a", Ranges: "10.8.0.32/28"}))
+				pb.Ranges, pb.Description = "10.8.0.192/26", "smaller"
+				r.must("update pool", st.IPAM().UpdatePool(ctx, pb))
+				pools, err := st.IPAM().ListPools(ctx, it.ID)
+				r.must("list pools", err)
+				r.see("pools", pools)
+				_, err = st.IPAM().GetPool(ctx, 999)
+				r.err("get missing pool", err)
+
+				res := &models.IPReservation{InterfaceID: it.ID, Addresses: "10.8.0.100-10.8.0.110", Note: "printers"}
+				r.must("create reservation", st.IPAM().CreateReservation(ctx, res))
+				res.Note = "printers and scanners"
+				r.must("update reservation", st.IPAM().UpdateReservation(ctx, res))
+				list, err := st.IPAM().ListReservations(ctx, it.ID)
+				r.must("list reservations", err)
+				r.see("reservations", list)
+				r.err("delete missing reservation", st.IPAM().DeleteReservation(ctx, 999))
+
+				now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+				for _, q := range []models.QuarantinedIP{
+					{InterfaceID: it.ID, IP: "10.8.0.7", PeerName: "old", ReleasedAt: now.Add(-2 * time.Hour), Until: now.Add(-time.Hour)},
+					{InterfaceID: it.ID, IP: "10.8.0.8", PeerName: "later", ReleasedAt: now, Until: now.Add(2 * time.Hour)},
+					{InterfaceID: it.ID, IP: "10.8.0.9", PeerName: "sooner", ReleasedAt: now, Until: now.Add(time.Hour)},
+				} {
+					r.must("quarantine", st.IPAM().Quarantine(ctx, &q))
+				}
+				qs, err := st.IPAM().ListQuarantine(ctx, it.ID, now)
+				r.must("list quarantine", err)
+				r.see("quarantine", qs)
+				r.must("unquarantine", st.IPAM().Unquarantine(ctx, it.ID, "10.8.0.9"))
+				r.must("unquarantine missing", st.IPAM().Unquarantine(ctx, it.ID, "10.8.0.99"))
+				qs, err = st.IPAM().ListQuarantine(ctx, it.ID, now)
+				r.must("list quarantine", err)
+				r.see("quarantine after release", qs)
+
+				// 版本号的具体数值依实现而定，只比较是否递增
+				v1, err := st.IPAM().Version(ctx, it.ID)
+				r.must("version", err)
+				r.see("version bumped", v1 > v0)
+				r.must("set status", st.Interfaces().SetStatus(ctx, it.ID, "running"))
+				v2, err := st.IPAM().Version(ctx, it.ID)
+				r.must("version", err)
+				r.see("status does not bump", v2 == v1)
+
+				// 空闲区间快照：写入不影响版本号；补丁只在版本与网段一致时生效
+				_, err = st.IPAM().GetFreeState(ctx, it.ID)
+				r.err("free state missing", err)
+				fs := &models.IPAMFreeState{InterfaceID: it.ID, Version: v2, Families: "10.8.0.0/24 10.8.0.1", Expires: now}
+				r.must("save free spans", st.IPAM().SaveFreeSpans(ctx, fs, []models.IPAMFreeSpan{
+					{Family: 0, First: "10.8.0.2", Last: "10.8.0.6"},
+					{Family: 0, First: "10.8.0.10", Last: "10.8.0.254"},
+				}))
+				v3, err := st.IPAM().Version(ctx, it.ID)
+				r.must("version", err)
+				r.see("save does not bump", v3 == v2)
+				next := &models.IPAMFreeState{InterfaceID: it.ID, Version: v2 + 1, Families: fs.Families}
+				ok, err := st.IPAM().PatchFreeSpans(ctx, v2+5, next, nil, nil)
+				r.must("patch stale", err)
+				r.see("patch stale applied", ok)
+				ok, err = st.IPAM().PatchFreeSpans(ctx, v2, &models.IPAMFreeState{InterfaceID: it.ID, Version: v2 + 1, Families: "other"}, nil, nil)
+				r.must("patch other families", err)
+				r.see("patch other families applied", ok)
+				ok, err = st.IPAM().PatchFreeSpans(ctx, v2, next,
+					[]models.IPAMFreeSpan{{Family: 0, First: "10.8.0.3", Last: "10.8.0.6"}, {Family: 0, First: "10.8.0.10", Last: "10.8.0.200"}},
+					[]models.IPAMFreeSpan{{Family: 0, First: "10.8.0.2"}})
+				r.must("patch", err)
+				r.see("patch applied", ok)
+				got, err := st.IPAM().GetFreeState(ctx, it.ID)
+				r.must("get free state", err)
+				r.see("free state version", got.Version == v2+1)
+				got.Version = 0
+				r.see("free state", got)
+				spans, err := st.IPAM().ListFreeSpans(ctx, it.ID)
+				r.must("list free spans", err)
+				sort.Slice(spans, func(i, j int) bool { return spans[i].First < spans[j].First })
+				r.see("free spans", spans)
+				r.must("delete interface", st.Interfaces().Delete(ctx, it.ID))
+				_, err = st.IPAM().GetFreeState(ctx, it.ID)
+				r.err("free state after interface delete", err)
+				spans, err = st.IPAM().ListFreeSpans(ctx, it.ID)
+				r.must("list free spans after delete", err)
+				r.see("free spans after delete", len(spans))
+			},
+		},
+		{
+			name: "groups and cascade",
+			run: func(r *recorder, st Store) {
+				it := testInterface("wg0", 51820)
+				r.must("create interface", st.Interfaces().Create(ctx, it))
+				a, b := testPeer(it.ID, "a", "10.8.0.2"), testPeer(it.ID, "b", "10.8.0.3")
+				r.must("create a", st.Peers().Create(ctx, a))
+				r.must("create b", st.Peers().Create(ctx, b))
+				g := &models.PeerGroup{Name: "ops", Description: "operators"}
+				r.must("create group", st.PeerGroups().Create(ctx, g))
+				r.err("duplicate group", st.PeerGroups().Create(ctx, &models.PeerGroup{Name: "ops"}))
+				r.must("set members", st.PeerGroups().SetMembers(ctx, g.ID, []int{b.ID, a.ID}))
+				r.must("add members", st.PeerGroups().AddMembers(ctx, g.ID, []int{a.ID}))
+				members, err := st.PeerGroups().Members(ctx, g.ID)
+				r.must("members", err)
+				r.see("members", len(members))
+				groups, err := st.PeerGroups().List(ctx)
+				r.must("list groups", err)
+				r.see("groups", groups)
+
+				r.must("create pool", st.IPAM().CreatePool(ctx, &models.IPPool{InterfaceID: it.ID, Name: "a", Ranges: "10.8.0.16/28"}))
+				r.must("delete peer", st.Peers().Delete(ctx, a.ID))
+				members, err = st.PeerGroups().Members(ctx, g.ID)
+				r.must("members", err)
+				r.see("members after peer delete", len(members))
+
+				r.must("delete interface", st.Interfaces().Delete(ctx, it.ID))
+				peers, err := st.Peers().ListByInterface(ctx, it.ID)
+				r.must("list peers", err)
+				pools, err := st.IPAM().ListPools(ctx, it.ID)
+				r.must("list pools", err)
+				members, err = st.PeerGroups().Members(ctx, g.ID)
+				r.must("members", err)
+				r.see("left after interface delete", []int{len(peers), len(pools), len(members)})
+			},
+		},
+		{
+			name: "transactions",
+			run: func(r *recorder, st Store) {
+				boom := errors.New("boom")
+				err := st.WithTx(ctx, func(tx Store) error {
+					if err := tx.Interfaces().Create(ctx, testInterface("wg0", 51820)); err != nil {
+						return err
+					}
+					return boom
+				})
+				r.see("rollback error kept", errors.Is(err, boom))
+				list, err := st.Interfaces().List(ctx)
+				r.must("list", err)
+				r.see("rolled back", len(list))
+
+				r.must("commit", st.WithTx(ctx, func(tx Store) error {
+					return tx.Interfaces().Create(ctx, testInterface("wg1", 51821))
+				}))
+				list, err = st.Interfaces().List(ctx)
+				r.must("list", err)
+				r.see("committed", len(list))
+			},
+		},
+	}
+
+	for _, sc := range scenarios {
+		t.Run(sc.name, func(t *testing.T) {
+			mem := &recorder{t: t}
+			sc.run(mem, NewMemoryStore())
+			sql := &recorder{t: t}
+			sc.run(sql, newSQLTestStore(t))
+
+			if len(mem.obs) != len(sql.obs) {
+				t.Fatalf("observation count differs: memory %d, sql %d", len(mem.obs), len(sql.obs))
+			}
+			for i := range mem.obs {
+				if mem.obs[i] != sql.obs[i] {
+					t.Errorf("mismatch\n memory: %s\n sql:    %s", mem.obs[i], sql.obs[i])
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,266 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"backend/models"
+)
+
+var (
+	ErrNotFound = errors.New("record not found")           // 记录不存在
+	ErrConflict = errors.New("unique constraint violated") // 唯一键冲突
+
+	// ErrIPConflict 是 ErrConflict 的一种：同一接口下 peer IP 重复
+	ErrIPConflict = fmt.Errorf("peer ip %w", ErrConflict)
+)
+
+// InterfaceRepository 负责 wireguard_interfaces 的持久化
+type InterfaceRepository interface {
+	List(ctx context.Context) ([]models.WireGuardInterface, error)
+	Get(ctx context.Context, id int) (*models.WireGuardInterface, error)
+	GetByName(ctx context.Context, name string) (*models.WireGuardInterface, error)
+	// Create 写入新接口并回填 it.ID
+	Create(ctx context.Context, it *models.WireGuardInterface) error
+	Update(ctx context.Context, it *models.WireGuardInterface) error
+	SetStatus(ctx context.Context, id int, status string) error
+	// Delete 删除接口，其下 peers、IPAM、网关与 ACL 记录级联删除
+	Delete(ctx context.Context, id int) error
+}
+
+// PeerRepository 负责 wireguard_peers 的持久化；所有查询返回同一套完整字段
+type PeerRepository interface {
+	List(ctx context.Context) ([]models.WireGuardPeer, error)
+	ListByInterface(ctx context.Context, interfaceID int) ([]models.WireGuardPeer, error)
+	Get(ctx context.Context, id int) (*models.WireGuardPeer, error)
+	// Create 写入新 peer 并回填 p.ID；同接口下 IP 重复返回 ErrIPConflict
+	Create(ctx context.Context, p *models.WireGuardPeer) error
+	// Update 修改可编辑字段；endpoint 变化时清空 resolved_endpoint
+	Update(ctx context.Context, p *models.WireGuardPeer) error
+	// SetResolvedEndpoint 记录 endpoint 解析后下发到内核的地址（不改 updated_at）
+	SetResolvedEndpoint(ctx context.Context, id int, endpoint string) error
+	// SetHandshake 记录内核观测到的在线状态与最近握手（不改 updated_at）
+	SetHandshake(ctx context.Context, id int, status string, last *time.Time) error
+	Delete(ctx context.Context, id int) error
+	// UsedIPs 返回接口下已分配的隧道 IP（双栈 peer 的多个地址逐个返回）
+	UsedIPs(ctx context.Context, interfaceID int) ([]string, error)
+}
+
+// RenderedConfigRepository 负责 rendered_configs：管理器写出的 .conf 校验和
+type RenderedConfigRepository interface {
+	Get(ctx context.Context, name string) (*models.RenderedConfig, error)
+	Upsert(ctx context.Context, rc *models.RenderedConfig) error
+	// Delete 删除记录；不存在时不报错
+	Delete(ctx context.Context, name string) error
+}
+
+// RoutingProfileRepository 负责 routing_profiles 的持久化
+type RoutingProfileRepository interface {
+	List(ctx context.Context) ([]models.RoutingProfile, error)
+	Get(ctx context.Context, id int) (*models.RoutingProfile, error)
+	GetByName(ctx context.Context, name string) (*models.RoutingProfile, error)
+	// Create 写入新模板并回填 rp.ID；重名返回 ErrConflict
+	Create(ctx context.Context, rp *models.RoutingProfile) error
+	Update(ctx context.Context, rp *models.RoutingProfile) error
+	// Delete 删除模板，引用它的 peer 解除关联
+	Delete(ctx context.Context, id int) error
+}
+
+// IPAMRepository 负责接口的地址池、保留地址与隔离期地址
+type IPAMRepository interface {
+	ListPools(ctx context.Context, interfaceID int) ([]models.IPPool, error)
+	GetPool(ctx context.Context, id int) (*models.IPPool, error)
+	// CreatePool 写入地址池并回填 p.ID；同接口重名返回 ErrConflict
+	CreatePool(ctx context.Context, p *models.IPPool) error
+	UpdatePool(ctx context.Context, p *models.IPPool) error
+	DeletePool(ctx context.Context, id int) error
+
+	ListReservations(ctx context.Context, interfaceID int) ([]models.IPReservation, error)
+	CreateReservation(ctx context.Context, r *models.IPReservation) error
+	UpdateReservation(ctx context.Context, r *models.IPReservation) error
+	DeleteReservation(ctx context.Context, id int) error
+
+	// ListQuarantine 返回 now 时仍在隔离期内的地址
+	ListQuarantine(ctx context.Context, interfaceID int, now time.Time) ([]models.QuarantinedIP, error)
+	// Quarantine 记录（或刷新）隔离地址，并顺带清理已到期的记录
+	Quarantine(ctx context.Context, q *models.QuarantinedIP) error
+	// Unquarantine 提前释放地址；不存在时不报错
+	Unquarantine(ctx context.Context, interfaceID int, ip string) error
+
+	// Version 返回接口地址占用的版本号：peer 地址、地址池、保留与隔离地址每次变化都会递增；从未变化时为 0
+	Version(ctx context.Context, interfaceID int) (int64, error)
+
+	// GetFreeState 返回接口空闲区间快照的元数据；没有快照时返回 ErrNotFound。写快照不影响 Version
+	GetFreeState(ctx context.Context, interfaceID int) (*models.IPAMFreeState, error)
+	// ListFreeSpans 返回快照中的全部空闲区间（顺序不定）
+	ListFreeSpans(ctx context.Context, interfaceID int) ([]models.IPAMFreeSpan, error)
+	// SaveFreeSpans 整体替换接口的快照
+	SaveFreeSpans(ctx context.Context, st *models.IPAMFreeState, spans []models.IPAMFreeSpan) error
+	// PatchFreeSpans 在版本为 from 的快照上删除 removed（按 Family 与 First）、写入 set，并改为 st 的元数据；
+	// 快照不存在、版本不是 from 或网段不同时不做修改并返回 false
+	PatchFreeSpans(ctx context.Context, from int64, st *models.IPAMFreeState, set, removed []models.IPAMFreeSpan) (bool, error)
+}
+
+// GatewayRepository 负责 interface_gateways：接口的 NAT 与转发设置
+type GatewayRepository interface {
+	// Get 返回接口的网关设置；未设置过返回 ErrNotFound
+	Get(ctx context.Context, interfaceID int) (*models.InterfaceGateway, error)
+	List(ctx context.Context) ([]models.InterfaceGateway, error)
+	// Save 写入（或覆盖）接口的网关设置
+	Save(ctx context.Context, g *models.InterfaceGateway) error
+}
+
+// RemoteRepository 负责 interface_remotes：客户端模式接口的远端服务端，preshared_key 加密存储
+type RemoteRepository interface {
+	// Get 返回接口的远端；未设置过返回 ErrNotFound
+	Get(ctx context.Context, interfaceID int) (*models.ClientRemote, error)
+	// Save 写入（或覆盖）接口的远端
+	Save(ctx context.Context, r *models.ClientRemote) error
+	// Delete 删除接口的远端；不存在时不报错
+	Delete(ctx context.Context, interfaceID int) error
+}
+
+// EventRepository 负责 interface_events；每个接口只保留最近 MaxEventsPerInterface 条
+type EventRepository interface {
+	Add(ctx context.Context, e *models.InterfaceEvent) error
+	// List 按时间倒序返回最近 limit 条
+	List(ctx context.Context, interfaceID, limit int) ([]models.InterfaceEvent, error)
+}
+
+// MaxEventsPerInterface 是每个接口保留的事件条数
+const MaxEventsPerInterface = 500
+
+// PeerSessionRepository 负责 peer_sessions：peer 的在线时段，每个 peer 至多一条未结束的时段
+type PeerSessionRepository interface {
+	// Open 写入新时段并回填 ps.ID
+	Open(ctx context.Context, ps *models.PeerSession) error
+	// Close 结束 peer 未结束的时段；没有时不报错
+	Close(ctx context.Context, peerID int, endedAt time.Time) error
+	// ListOpen 返回全部未结束的时段
+	ListOpen(ctx context.Context) ([]models.PeerSession, error)
+	// ListByPeer 按开始时间倒序返回 peer 在 since 之后仍在线过的时段
+	ListByPeer(ctx context.Context, peerID int, since time.Time) ([]models.PeerSession, error)
+	// ListSince 同 ListByPeer，但包含全部 peer
+	ListSince(ctx context.Context, since time.Time) ([]models.PeerSession, error)
+	// Prune 删除 before 之前已结束的时段
+	Prune(ctx context.Context, before time.Time) error
+}
+
+// AlertFilter 筛选告警；零值字段不参与过滤
+type AlertFilter struct {
+	Status string
+	Type   string
+	RuleID int
+	Limit  int // <= 0 表示不限
+}
+
+// AlertRepository 负责 alert_rules 与 alerts；已解决的告警只保留最近 MaxAlertHistory 条
+type AlertRepository interface {
+	ListRules(ctx context.Context) ([]models.AlertRule, error)
+	GetRule(ctx context.Context, id int) (*models.AlertRule, error)
+	// CreateRule 写入规则并回填 r.ID；重名返回 ErrConflict
+	CreateRule(ctx context.Context, r *models.AlertRule) error
+	UpdateRule(ctx context.Context, r *models.AlertRule) error
+	// DeleteRule 删除规则，其告警保留为历史
+	DeleteRule(ctx context.Context, id int) error
+
+	// List 按 ID 倒序返回告警
+	List(ctx context.Context, f AlertFilter) ([]models.Alert, error)
+	// Create 写入告警并回填 a.ID
+	Create(ctx context.Context, a *models.Alert) error
+	// Update 修改告警的状态、内容与通知结果
+	Update(ctx context.Context, a *models.Alert) error
+}
+
+// MaxAlertHistory 是保留的已解决告警条数
+const MaxAlertHistory = 1000
+
+// NotifierRepository 负责 notifiers；secret 加密存储
+type NotifierRepository interface {
+	// List 按名称排序
+	List(ctx context.Context) ([]models.Notifier, error)
+	Get(ctx context.Context, id int) (*models.Notifier, error)
+	// Create 写入渠道并回填 n.ID；重名返回 ErrConflict
+	Create(ctx context.Context, n *models.Notifier) error
+	Update(ctx context.Context, n *models.Notifier) error
+	Delete(ctx context.Context, id int) error
+}
+
+// PeerGroupRepository 负责 peer_groups 与多对多的 peer_group_members
+type PeerGroupRepository interface {
+	// List 按名称排序，并统计成员数
+	List(ctx context.Context) ([]models.PeerGroup, error)
+	Get(ctx context.Context, id int) (*models.PeerGroup, error)
+	GetByName(ctx context.Context, name string) (*models.PeerGroup, error)
+	// Create 写入分组并回填 g.ID；重名返回 ErrConflict
+	Create(ctx context.Context, g *models.PeerGroup) error
+	Update(ctx context.Context, g *models.PeerGroup) error
+	// Delete 删除分组及其成员关系
+	Delete(ctx context.Context, id int) error
+
+	// Members 返回分组内的 peer ID（升序）
+	Members(ctx context.Context, groupID int) ([]int, error)
+	// AddMembers 加入成员，已在组内的忽略
+	AddMembers(ctx context.Context, groupID int, peerIDs []int) error
+	// SetMembers 整体替换分组成员
+	SetMembers(ctx context.Context, groupID int, peerIDs []int) error
+	RemoveMember(ctx context.Context, groupID, peerID int) error
+	// SetPeerGroups 整体替换 peer 所属的分组
+	SetPeerGroups(ctx context.Context, peerID int, groupIDs []int) error
+	// Memberships 返回 peer ID 到所属分组名（按名称排序）的映射
+	Memberships(ctx context.Context) (map[int][]string, error)
+}
+
+// MeshRepository 负责 meshes 与 mesh_members；成员私钥加密存储
+type MeshRepository interface {
+	// List 按名称排序，并统计成员数
+	List(ctx context.Context) ([]models.Mesh, error)
+	Get(ctx context.Context, id int) (*models.Mesh, error)
+	// Create 写入 mesh 并回填 m.ID；重名返回 ErrConflict
+	Create(ctx context.Context, m *models.Mesh) error
+	Update(ctx context.Context, m *models.Mesh) error
+	// Bump 递增 revision（成员变化后调用）
+	Bump(ctx context.Context, id int) error
+	// Delete 删除 mesh 及其全部成员
+	Delete(ctx context.Context, id int) error
+
+	// Members 按 ID 排序返回 mesh 的成员
+	Members(ctx context.Context, meshID int) ([]models.MeshMember, error)
+	GetMember(ctx context.Context, id int) (*models.MeshMember, error)
+	// CreateMember 写入成员并回填 m.ID；同一 mesh 内名称或公钥重复返回 ErrConflict
+	CreateMember(ctx context.Context, m *models.MeshMember) error
+	UpdateMember(ctx context.Context, m *models.MeshMember) error
+	DeleteMember(ctx context.Context, id int) error
+}
+
+// ACLRepository 负责 acl_rules；List 按 priority、id 排序，即匹配顺序
+type ACLRepository interface {
+	List(ctx context.Context, interfaceID int) ([]models.ACLRule, error)
+	Get(ctx context.Context, id int) (*models.ACLRule, error)
+	// Create 写入规则并回填 r.ID
+	Create(ctx context.Context, r *models.ACLRule) error
+	Update(ctx context.Context, r *models.ACLRule) error
+	Delete(ctx context.Context, id int) error
+}
+
+// Store 聚合各仓储，并提供事务边界
+type Store interface {
+	Interfaces() InterfaceRepository
+	Peers() PeerRepository
+	RenderedConfigs() RenderedConfigRepository
+	RoutingProfiles() RoutingProfileRepository
+	IPAM() IPAMRepository
+	Gateways() GatewayRepository
+	Remotes() RemoteRepository
+	Meshes() MeshRepository
+	ACLs() ACLRepository
+	PeerGroups() PeerGroupRepository
+	Events() EventRepository
+	PeerSessions() PeerSessionRepository
+	Alerts() AlertRepository
+	Notifiers() NotifierRepository
+	// WithTx 在同一事务内执行 fn；fn 返回错误则整体回滚
+	WithTx(ctx context.Context, fn func(tx Store) error) error
+}
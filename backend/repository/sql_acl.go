@@ -0,0 +1,115 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"backend/models"
+)
+
+type sqlACLRepo struct {
+	q querier
+}
+
+const aclColumns = `
+	id, interface_id, peer_id, group_id, action,
+	COALESCE(destinations, '') AS destinations,
+	protocol,
+	COALESCE(ports, '')        AS ports,
+	priority,
+	COALESCE(description, '')  AS description,
+	created_at, updated_at`
+
+func scanACLRule(r rowScanner) (*models.ACLRule, error) {
+	var (
+		a       models.ACLRule
+		peerID  sql.NullInt64
+		groupID sql.NullInt64
+	)
+	if err := r.Scan(
+		&a.ID, &a.InterfaceID, &peerID, &groupID, &a.Action,
+		&a.Destinations, &a.Protocol, &a.Ports, &a.Priority,
+		&a.Description, &a.CreatedAt, &a.UpdatedAt,
+	); err != nil {
+		return nil, err
+	}
+	if peerID.Valid {
+		id := int(peerID.Int64)
+		a.PeerID = &id
+	}
+	if groupID.Valid {
+		id := int(groupID.Int64)
+		a.GroupID = &id
+	}
+	return &a, nil
+}
+
+func (r *sqlACLRepo) List(ctx context.Context, interfaceID int) ([]models.ACLRule, error) {
+	rows, err := r.q.QueryContext(ctx,
+		`SELECT `+aclColumns+` FROM acl_rules WHERE interface_id = ? ORDER BY priority, id`, interfaceID)
+	if err != nil {
+		return nil, fmt.Errorf("query acl rules: %w", err)
+	}
+	defer rows.Close()
+
+	var list []models.ACLRule
+	for rows.Next() {
+		a, err := scanACLRule(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scan acl rule: %w", err)
+		}
+		list = append(list, *a)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("query acl rules: %w", err)
+	}
+	return list, nil
+}
+
+func (r *sqlACLRepo) Get(ctx context.Context, id int) (*models.ACLRule, error) {
+	a, err := scanACLRule(r.q.QueryRowContext(ctx, `SELECT `+aclColumns+` FROM acl_rules WHERE id = ?`, id))
+	if err != nil {
+		return nil, wrapReadErr("get acl rule", err)
+	}
+	return a, nil
+}
+
+func (r *sqlACLRepo) Create(ctx context.Context, a *models.ACLRule) error {
+	res, err := r.q.ExecContext(ctx, `
+		INSERT INTO acl_rules (interface_id, peer_id, group_id, action, destinations, protocol, ports, priority, description)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		a.InterfaceID, nullInt(a.PeerID), nullInt(a.GroupID), a.Action, a.Destinations, a.Protocol, a.Ports, a.Priority, a.Description,
+	)
+	if err != nil {
+		return wrapWriteErr("create acl rule", err)
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return fmt.Errorf("create acl rule: %w", err)
+	}
+	a.ID = int(id)
+	return nil
+}
+
+func (r *sqlACLRepo) Update(ctx context.Context, a *models.ACLRule) error {
+	res, err := r.q.ExecContext(ctx, `
+		UPDATE acl_rules
+		SET peer_id = ?, group_id = ?, action = ?, destinations = ?, protocol = ?, ports = ?, priority = ?, description = ?,
+		    updated_at = CURRENT_TIMESTAMP
+		WHERE id = ?`,
+		nullInt(a.PeerID), nullInt(a.GroupID), a.Action, a.Destinations, a.Protocol, a.Ports, a.Priority, a.Description, a.ID,
+	)
+	if err != nil {
+		return wrapWriteErr("update acl rule", err)
+	}
+	return expectAffected("update acl rule", res)
+}
+
+func (r *sqlACLRepo) Delete(ctx context.Context, id int) error {
+	res, err := r.q.ExecContext(ctx, `DELETE FROM acl_rules WHERE id = ?`, id)
+	if err != nil {
+		return fmt.Errorf("delete acl rule: %w", err)
+	}
+	return expectAffected("delete acl rule", res)
+}
@@ -0,0 +1,249 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"backend/models"
+)
+
+type sqlAlertRepo struct {
+	q querier
+}
+
+/* -------------------- 规则 -------------------- */
+
+const alertRuleColumns = `
+	id, name, type, enabled, severity, threshold,
+	COALESCE(duration, '')     AS duration,
+	interface_id,
+	COALESCE(path, '')         AS path,
+	COALESCE(notifier_ids, '') AS notifier_ids,
+	created_at, updated_at`
+
+func scanAlertRule(r rowScanner) (*models.AlertRule, error) {
+	var ar models.AlertRule
+	var ifaceID sql.NullInt64
+	var notifiers string
+	if err := r.Scan(
+		&ar.ID, &ar.Name, &ar.Type, &ar.Enabled, &ar.Severity, &ar.Threshold,
+		&ar.Duration, &ifaceID, &ar.Path, &notifiers,
+		&ar.CreatedAt, &ar.UpdatedAt,
+	); err != nil {
+		return nil, err
+	}
+	if ifaceID.Valid {
+		id := int(ifaceID.Int64)
+		ar.InterfaceID = &id
+	}
+	ar.NotifierIDs = splitInts(notifiers)
+	return &ar, nil
+}
+
+func (r *sqlAlertRepo) ListRules(ctx context.Context) ([]models.AlertRule, error) {
+	rows, err := r.q.QueryContext(ctx, `SELECT `+alertRuleColumns+` FROM alert_rules ORDER BY name`)
+	if err != nil {
+		return nil, fmt.Errorf("query alert rules: %w", err)
+	}
+	defer rows.Close()
+
+	var list []models.AlertRule
+	for rows.Next() {
+		ar, err := scanAlertRule(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scan alert rule: %w", err)
+		}
+		list = append(list, *ar)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("query alert rules: %w", err)
+	}
+	return list, nil
+}
+
+func (r *sqlAlertRepo) GetRule(ctx context.Context, id int) (*models.AlertRule, error) {
+	ar, err := scanAlertRule(r.q.QueryRowContext(ctx, `SELECT `+alertRuleColumns+` FROM alert_rules WHERE id = ?`, id))
+	if err != nil {
+		return nil, wrapReadErr("get alert rule", err)
+	}
+	return ar, nil
+}
+
+func (r *sqlAlertRepo) CreateRule(ctx context.Context, ar *models.AlertRule) error {
+	res, err := r.q.ExecContext(ctx, `
+		INSERT INTO alert_rules (name, type, enabled, severity, threshold, duration, interface_id, path, notifier_ids)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		ar.Name, ar.Type, ar.Enabled, ar.Severity, ar.Threshold, ar.Duration,
+		nullInt(ar.InterfaceID), ar.Path, joinInts(ar.NotifierIDs),
+	)
+	if err != nil {
+		return wrapWriteErr("create alert rule", err)
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return fmt.Errorf("create alert rule: %w", err)
+	}
+	ar.ID = int(id)
+	return nil
+}
+
+func (r *sqlAlertRepo) UpdateRule(ctx context.Context, ar *models.AlertRule) error {
+	res, err := r.q.ExecContext(ctx, `
+		UPDATE alert_rules
+		SET name = ?, type = ?, enabled = ?, severity = ?, threshold = ?, duration = ?,
+		    interface_id = ?, path = ?, notifier_ids = ?, updated_at = CURRENT_TIMESTAMP
+		WHERE id = ?`,
+		ar.Name, ar.Type, ar.Enabled, ar.Severity, ar.Threshold, ar.Duration,
+		nullInt(ar.InterfaceID), ar.Path, joinInts(ar.NotifierIDs), ar.ID,
+	)
+	if err != nil {
+		return wrapWriteErr("update alert rule", err)
+	}
+	return expectAffected("update alert rule", res)
+}
+
+func (r *sqlAlertRepo) DeleteRule(ctx context.Context, id int) error {
+	res, err := r.q.ExecContext(ctx, `DELETE FROM alert_rules WHERE id = ?`, id)
+	if err != nil {
+		return fmt.Errorf("delete alert rule: %w", err)
+	}
+	return expectAffected("delete alert rule", res)
+}
+
+/* -------------------- 告警 -------------------- */
+
+const alertColumns = `
+	id, rule_id, rule_name, type, severity, alert_key, subject, message, status,
+	started_at, last_seen_at, resolved_at, notified_at,
+	COALESCE(notify_error, '') AS notify_error`
+
+func (r *sqlAlertRepo) List(ctx context.Context, f AlertFilter) ([]models.Alert, error) {
+	var where []string
+	var args []any
+	if f.Status != "" {
+		where, args = append(where, "status = ?"), append(args, f.Status)
+	}
+	if f.Type != "" {
+		where, args = append(where, "type = ?"), append(args, f.Type)
+	}
+	if f.RuleID != 0 {
+		where, args = append(where, "rule_id = ?"), append(args, f.RuleID)
+	}
+	query := `SELECT ` + alertColumns + ` FROM alerts`
+	if len(where) > 0 {
+		query += ` WHERE ` + strings.Join(where, " AND ")
+	}
+	query += ` ORDER BY id DESC`
+	if f.Limit > 0 {
+		query += ` LIMIT ?`
+		args = append(args, f.Limit)
+	}
+
+	rows, err := r.q.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("query alerts: %w", err)
+	}
+	defer rows.Close()
+
+	var list []models.Alert
+	for rows.Next() {
+		var a models.Alert
+		var resolved, notified sql.NullTime
+		if err := rows.Scan(
+			&a.ID, &a.RuleID, &a.RuleName, &a.Type, &a.Severity, &a.Key, &a.Subject, &a.Message, &a.Status,
+			&a.StartedAt, &a.LastSeenAt, &resolved, &notified, &a.NotifyError,
+		); err != nil {
+			return nil, fmt.Errorf("scan alert: %w", err)
+		}
+		if resolved.Valid {
+			t := resolved.Time
+			a.ResolvedAt = &t
+		}
+		if notified.Valid {
+			t := notified.Time
+			a.NotifiedAt = &t
+		}
+		list = append(list, a)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("query alerts: %w", err)
+	}
+	return list, nil
+}
+
+func (r *sqlAlertRepo) Create(ctx context.Context, a *models.Alert) error {
+	res, err := r.q.ExecContext(ctx, `
+		INSERT INTO alerts
+		  (rule_id, rule_name, type, severity, alert_key, subject, message, status,
+		   started_at, last_seen_at, resolved_at, notified_at, notify_error)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		a.RuleID, a.RuleName, a.Type, a.Severity, a.Key, a.Subject, a.Message, a.Status,
+		a.StartedAt.UTC(), a.LastSeenAt.UTC(), nullTime(a.ResolvedAt), nullTime(a.NotifiedAt), a.NotifyError,
+	)
+	if err != nil {
+		return fmt.Errorf("create alert: %w", err)
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return fmt.Errorf("create alert: %w", err)
+	}
+	a.ID = int(id)
+	// 只保留最近的若干条已解决告警
+	if _, err := r.q.ExecContext(ctx, `
+		DELETE FROM alerts
+		WHERE status = ? AND id NOT IN (
+		  SELECT id FROM alerts WHERE status = ? ORDER BY id DESC LIMIT ?)`,
+		models.AlertStatusResolved, models.AlertStatusResolved, MaxAlertHistory,
+	); err != nil {
+		return fmt.Errorf("prune alerts: %w", err)
+	}
+	return nil
+}
+
+func (r *sqlAlertRepo) Update(ctx context.Context, a *models.Alert) error {
+	res, err := r.q.ExecContext(ctx, `
+		UPDATE alerts
+		SET severity = ?, subject = ?, message = ?, status = ?,
+		    last_seen_at = ?, resolved_at = ?, notified_at = ?, notify_error = ?
+		WHERE id = ?`,
+		a.Severity, a.Subject, a.Message, a.Status,
+		a.LastSeenAt.UTC(), nullTime(a.ResolvedAt), nullTime(a.NotifiedAt), a.NotifyError, a.ID,
+	)
+	if err != nil {
+		return fmt.Errorf("update alert: %w", err)
+	}
+	return expectAffected("update alert", res)
+}
+
+/* -------------------- 工具 -------------------- */
+
+// nil 写入 NULL，其余按 UTC 写入
+func nullTime(t *time.Time) sql.NullTime {
+	if t == nil {
+		return sql.NullTime{}
+	}
+	return sql.NullTime{Time: t.UTC(), Valid: true}
+}
+
+func joinInts(ids []int) string {
+	parts := make([]string, len(ids))
+	for i, id := range ids {
+		parts[i] = strconv.Itoa(id)
+	}
+	return strings.Join(parts, ",")
+}
+
+// splitInts 解析逗号分隔的 ID，忽略无法解析的项
+func splitInts(s string) []int {
+	ids := []int{}
+	for _, x := range strings.Split(s, ",") {
+		if n, err := strconv.Atoi(strings.TrimSpace(x)); err == nil {
+			ids = append(ids, n)
+		}
+	}
+	return ids
+}
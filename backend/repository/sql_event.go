@@ -0,0 +1,62 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+
+	"backend/models"
+)
+
+type sqlEventRepo struct {
+	q querier
+}
+
+func (r *sqlEventRepo) Add(ctx context.Context, e *models.InterfaceEvent) error {
+	res, err := r.q.ExecContext(ctx, `
+		INSERT INTO interface_events (interface_id, kind, message, output, success)
+		VALUES (?, ?, ?, ?, ?)`,
+		e.InterfaceID, e.Kind, e.Message, e.Output, e.Success,
+	)
+	if err != nil {
+		return fmt.Errorf("add interface event: %w", err)
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return fmt.Errorf("add interface event: %w", err)
+	}
+	e.ID = int(id)
+	// 只保留最近的若干条
+	if _, err := r.q.ExecContext(ctx, `
+		DELETE FROM interface_events
+		WHERE interface_id = ? AND id NOT IN (
+		  SELECT id FROM interface_events WHERE interface_id = ? ORDER BY id DESC LIMIT ?)`,
+		e.InterfaceID, e.InterfaceID, MaxEventsPerInterface,
+	); err != nil {
+		return fmt.Errorf("prune interface events: %w", err)
+	}
+	return nil
+}
+
+func (r *sqlEventRepo) List(ctx context.Context, interfaceID, limit int) ([]models.InterfaceEvent, error) {
+	rows, err := r.q.QueryContext(ctx, `
+		SELECT id, interface_id, kind, message, COALESCE(output, '') AS output, success, created_at
+		FROM interface_events WHERE interface_id = ?
+		ORDER BY id DESC LIMIT ?`, interfaceID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("query interface events: %w", err)
+	}
+	defer rows.Close()
+
+	var list []models.InterfaceEvent
+	for rows.Next() {
+		var e models.InterfaceEvent
+		if err := rows.Scan(&e.ID, &e.InterfaceID, &e.Kind, &e.Message, &e.Output, &e.Success, &e.CreatedAt); err != nil {
+			return nil, fmt.Errorf("scan interface event: %w", err)
+		}
+		list = append(list, e)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("query interface events: %w", err)
+	}
+	return list, nil
+}
@@ -0,0 +1,78 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"backend/models"
+)
+
+type sqlGatewayRepo struct {
+	q querier
+}
+
+const gatewayColumns = `
+	interface_id, masquerade,
+	COALESCE(egress_interface, '') AS egress_interface,
+	lan_forward,
+	COALESCE(lan_cidrs, '') AS lan_cidrs,
+	acl_default, updated_at`
+
+func scanGateway(r rowScanner) (*models.InterfaceGateway, error) {
+	var g models.InterfaceGateway
+	if err := r.Scan(
+		&g.InterfaceID, &g.Masquerade, &g.EgressInterface,
+		&g.LANForward, &g.LANCIDRs, &g.ACLDefault, &g.UpdatedAt,
+	); err != nil {
+		return nil, err
+	}
+	return &g, nil
+}
+
+func (r *sqlGatewayRepo) Get(ctx context.Context, interfaceID int) (*models.InterfaceGateway, error) {
+	g, err := scanGateway(r.q.QueryRowContext(ctx,
+		`SELECT `+gatewayColumns+` FROM interface_gateways WHERE interface_id = ?`, interfaceID))
+	if err != nil {
+		return nil, wrapReadErr("get interface gateway", err)
+	}
+	return g, nil
+}
+
+func (r *sqlGatewayRepo) List(ctx context.Context) ([]models.InterfaceGateway, error) {
+	rows, err := r.q.QueryContext(ctx, `SELECT `+gatewayColumns+` FROM interface_gateways ORDER BY interface_id`)
+	if err != nil {
+		return nil, fmt.Errorf("query interface gateways: %w", err)
+	}
+	defer rows.Close()
+
+	var list []models.InterfaceGateway
+	for rows.Next() {
+		g, err := scanGateway(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scan interface gateway: %w", err)
+		}
+		list = append(list, *g)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("query interface gateways: %w", err)
+	}
+	return list, nil
+}
+
+func (r *sqlGatewayRepo) Save(ctx context.Context, g *models.InterfaceGateway) error {
+	g.UpdatedAt = time.Now().UTC()
+	_, err := r.q.ExecContext(ctx, `
+		INSERT INTO interface_gateways (interface_id, masquerade, egress_interface, lan_forward, lan_cidrs, acl_default, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT(interface_id) DO UPDATE SET
+		  masquerade = excluded.masquerade, egress_interface = excluded.egress_interface,
+		  lan_forward = excluded.lan_forward, lan_cidrs = excluded.lan_cidrs,
+		  acl_default = excluded.acl_default, updated_at = excluded.updated_at`,
+		g.InterfaceID, g.Masquerade, g.EgressInterface, g.LANForward, g.LANCIDRs, g.ACLDefault, g.UpdatedAt,
+	)
+	if err != nil {
+		return wrapWriteErr("save interface gateway", err)
+	}
+	return nil
+}
@@ -0,0 +1,184 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+
+	"backend/models"
+)
+
+type sqlInterfaceRepo struct {
+	q       querier
+	secrets secretCodec
+}
+
+const interfaceColumns = `
+	id, name, private_key, public_key, listen_port, address,
+	COALESCE(dns, '')         AS dns,
+	COALESCE(mtu, 1420)       AS mtu,
+	COALESCE(cidr, '')        AS cidr,
+	COALESCE(server_ip, '')   AS server_ip,
+	COALESCE(status, 'stopped') AS status,
+	created_at, updated_at,
+	COALESCE(pre_up, '')      AS pre_up,
+	COALESCE(post_up, '')     AS post_up,
+	COALESCE(pre_down, '')    AS pre_down,
+	COALESCE(post_down, '')   AS post_down,
+	COALESCE(mode, 'server')  AS mode,
+	COALESCE(endpoint, '')    AS endpoint,
+	COALESCE(local_subnets, '') AS local_subnets`
+
+// interfaceMode 把空模式按默认的 server 写入
+func interfaceMode(mode string) string {
+	if mode == "" {
+		return models.InterfaceModeServer
+	}
+	return mode
+}
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func (r *sqlInterfaceRepo) scan(row rowScanner) (*models.WireGuardInterface, error) {
+	it, err := scanInterface(row)
+	if err != nil {
+		return nil, err
+	}
+	if it.PrivateKey, err = r.secrets.open(it.PrivateKey); err != nil {
+		return nil, fmt.Errorf("interface %d private key: %w", it.ID, err)
+	}
+	return it, nil
+}
+
+func scanInterface(r rowScanner) (*models.WireGuardInterface, error) {
+	var it models.WireGuardInterface
+	if err := r.Scan(
+		&it.ID, &it.Name, &it.PrivateKey, &it.PublicKey,
+		&it.ListenPort, &it.Address, &it.DNS, &it.MTU,
+		&it.CIDR, &it.ServerIP, &it.Status,
+		&it.CreatedAt, &it.UpdatedAt,
+		&it.PreUp, &it.PostUp, &it.PreDown, &it.PostDown,
+		&it.Mode, &it.Endpoint, &it.LocalSubnets,
+	); err != nil {
+		return nil, err
+	}
+	return &it, nil
+}
+
+func (r *sqlInterfaceRepo) List(ctx context.Context) ([]models.WireGuardInterface, error) {
+	rows, err := r.q.QueryContext(ctx, `SELECT `+interfaceColumns+` FROM wireguard_interfaces ORDER BY created_at DESC, id DESC`)
+	if err != nil {
+		return nil, fmt.Errorf("query interfaces: %w", err)
+	}
+	defer rows.Close()
+
+	var list []models.WireGuardInterface
+	for rows.Next() {
+		it, err := r.scan(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scan interface: %w", err)
+		}
+		list = append(list, *it)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("query interfaces: %w", err)
+	}
+	return list, nil
+}
+
+func (r *sqlInterfaceRepo) Get(ctx context.Context, id int) (*models.WireGuardInterface, error) {
+	it, err := r.scan(r.q.QueryRowContext(ctx, `SELECT `+interfaceColumns+` FROM wireguard_interfaces WHERE id = ?`, id))
+	if err != nil {
+		return nil, wrapReadErr("get interface", err)
+	}
+	return it, nil
+}
+
+func (r *sqlInterfaceRepo) GetByName(ctx context.Context, name string) (*models.WireGuardInterface, error) {
+	it, err := r.scan(r.q.QueryRowContext(ctx, `SELECT `+interfaceColumns+` FROM wireguard_interfaces WHERE name = ?`, name))
+	if err != nil {
+		return nil, wrapReadErr("get interface by name", err)
+	}
+	return it, nil
+}
+
+func (r *sqlInterfaceRepo) Create(ctx context.Context, it *models.WireGuardInterface) error {
+	status := it.Status
+	if status == "" {
+		status = "stopped"
+	}
+	priv, err := r.secrets.seal(it.PrivateKey)
+	if err != nil {
+		return fmt.Errorf("create interface: %w", err)
+	}
+	res, err := r.q.ExecContext(ctx, `
+		INSERT INTO wireguard_interfaces
+		  (name, private_key, public_key, listen_port, address, dns, mtu, cidr, server_ip, status,
+		   pre_up, post_up, pre_down, post_down, mode, endpoint, local_subnets)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		it.Name, priv, it.PublicKey, it.ListenPort, it.Address,
+		it.DNS, it.MTU, nullString(it.CIDR), nullString(it.ServerIP), status,
+		it.PreUp, it.PostUp, it.PreDown, it.PostDown, interfaceMode(it.Mode), it.Endpoint, it.LocalSubnets,
+	)
+	if err != nil {
+		return wrapWriteErr("create interface", err)
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return fmt.Errorf("create interface: %w", err)
+	}
+	it.ID = int(id)
+	return nil
+}
+
+func (r *sqlInterfaceRepo) Update(ctx context.Context, it *models.WireGuardInterface) error {
+	priv, err := r.secrets.seal(it.PrivateKey)
+	if err != nil {
+		return fmt.Errorf("update interface: %w", err)
+	}
+	res, err := r.q.ExecContext(ctx, `
+		UPDATE wireguard_interfaces
+		SET name = ?, private_key = ?, public_key = ?, listen_port = ?, address = ?,
+		    dns = ?, mtu = ?, cidr = ?, server_ip = ?,
+		    pre_up = ?, post_up = ?, pre_down = ?, post_down = ?,
+		    mode = ?, endpoint = ?, local_subnets = ?, updated_at = CURRENT_TIMESTAMP
+		WHERE id = ?`,
+		it.Name, priv, it.PublicKey, it.ListenPort, it.Address,
+		it.DNS, it.MTU, nullString(it.CIDR), nullString(it.ServerIP),
+		it.PreUp, it.PostUp, it.PreDown, it.PostDown,
+		interfaceMode(it.Mode), it.Endpoint, it.LocalSubnets, it.ID,
+	)
+	if err != nil {
+		return wrapWriteErr("update interface", err)
+	}
+	return expectAffected("update interface", res)
+}
+
+func (r *sqlInterfaceRepo) SetStatus(ctx context.Context, id int, status string) error {
+	res, err := r.q.ExecContext(ctx,
+		`UPDATE wireguard_interfaces SET status = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?`, status, id)
+	if err != nil {
+		return fmt.Errorf("set interface status: %w", err)
+	}
+	return expectAffected("set interface status", res)
+}
+
+func (r *sqlInterfaceRepo) Delete(ctx context.Context, id int) error {
+	// 不依赖 PRAGMA foreign_keys（按连接生效），显式删除 peers 及其分组成员关系、IPAM 等记录
+	if _, err := r.q.ExecContext(ctx,
+		`DELETE FROM peer_group_members WHERE peer_id IN (SELECT id FROM wireguard_peers WHERE interface_id = ?)`, id,
+	); err != nil {
+		return fmt.Errorf("delete interface peer_group_members: %w", err)
+	}
+	for _, tbl := range []string{"peer_addresses", "wireguard_peers", "ip_pools", "ip_reservations", "ip_quarantine", "ipam_free_spans", "ipam_free_state", "interface_gateways", "interface_remotes", "acl_rules", "interface_events", "peer_sessions", "alert_rules"} {
+		if _, err := r.q.ExecContext(ctx, `DELETE FROM `+tbl+` WHERE interface_id = ?`, id); err != nil {
+			return fmt.Errorf("delete interface %s: %w", tbl, err)
+		}
+	}
+	res, err := r.q.ExecContext(ctx, `DELETE FROM wireguard_interfaces WHERE id = ?`, id)
+	if err != nil {
+		return fmt.Errorf("delete interface: %w", err)
+	}
+	return expectAffected("delete interface", res)
+}
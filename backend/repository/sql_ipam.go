@@ -0,0 +1,327 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"backend/models"
+)
+
+type sqlIPAMRepo struct {
+	q querier
+}
+
+/* -------------------- 地址池 -------------------- */
+
+const ipPoolColumns = `
+	id, interface_id, name, ranges,
+	COALESCE(description, '') AS description,
+	created_at, updated_at`
+
+func scanIPPool(r rowScanner) (*models.IPPool, error) {
+	var p models.IPPool
+	if err := r.Scan(
+		&p.ID, &p.InterfaceID, &p.Name, &p.Ranges,
+		&p.Description, &p.CreatedAt, &p.UpdatedAt,
+	); err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+func (r *sqlIPAMRepo) ListPools(ctx context.Context, interfaceID int) ([]models.IPPool, error) {
+	rows, err := r.q.QueryContext(ctx,
+		`SELECT `+ipPoolColumns+` FROM ip_pools WHERE interface_id = ? ORDER BY name`, interfaceID)
+	if err != nil {
+		return nil, fmt.Errorf("query ip pools: %w", err)
+	}
+	defer rows.Close()
+
+	var list []models.IPPool
+	for rows.Next() {
+		p, err := scanIPPool(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scan ip pool: %w", err)
+		}
+		list = append(list, *p)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("query ip pools: %w", err)
+	}
+	return list, nil
+}
+
+func (r *sqlIPAMRepo) GetPool(ctx context.Context, id int) (*models.IPPool, error) {
+	p, err := scanIPPool(r.q.QueryRowContext(ctx, `SELECT `+ipPoolColumns+` FROM ip_pools WHERE id = ?`, id))
+	if err != nil {
+		return nil, wrapReadErr("get ip pool", err)
+	}
+	return p, nil
+}
+
+func (r *sqlIPAMRepo) CreatePool(ctx context.Context, p *models.IPPool) error {
+	res, err := r.q.ExecContext(ctx, `
+		INSERT INTO ip_pools (interface_id, name, ranges, description)
+		VALUES (?, ?, ?, ?)`,
+		p.InterfaceID, p.Name, p.Ranges, p.Description,
+	)
+	if err != nil {
+		return wrapWriteErr("create ip pool", err)
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return fmt.Errorf("create ip pool: %w", err)
+	}
+	p.ID = int(id)
+	return nil
+}
+
+func (r *sqlIPAMRepo) UpdatePool(ctx context.Context, p *models.IPPool) error {
+	res, err := r.q.ExecContext(ctx, `
+		UPDATE ip_pools
+		SET name = ?, ranges = ?, description = ?, updated_at = CURRENT_TIMESTAMP
+		WHERE id = ?`,
+		p.Name, p.Ranges, p.Description, p.ID,
+	)
+	if err != nil {
+		return wrapWriteErr("update ip pool", err)
+	}
+	return expectAffected("update ip pool", res)
+}
+
+func (r *sqlIPAMRepo) DeletePool(ctx context.Context, id int) error {
+	res, err := r.q.ExecContext(ctx, `DELETE FROM ip_pools WHERE id = ?`, id)
+	if err != nil {
+		return fmt.Errorf("delete ip pool: %w", err)
+	}
+	return expectAffected("delete ip pool", res)
+}
+
+/* -------------------- 保留地址 -------------------- */
+
+func (r *sqlIPAMRepo) ListReservations(ctx context.Context, interfaceID int) ([]models.IPReservation, error) {
+	rows, err := r.q.QueryContext(ctx, `
+		SELECT id, interface_id, addresses, COALESCE(note, ''), created_at
+		FROM ip_reservations WHERE interface_id = ? ORDER BY id`, interfaceID)
+	if err != nil {
+		return nil, fmt.Errorf("query ip reservations: %w", err)
+	}
+	defer rows.Close()
+
+	var list []models.IPReservation
+	for rows.Next() {
+		var res models.IPReservation
+		if err := rows.Scan(&res.ID, &res.InterfaceID, &res.Addresses, &res.Note, &res.CreatedAt); err != nil {
+			return nil, fmt.Errorf("scan ip reservation: %w", err)
+		}
+		list = append(list, res)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("query ip reservations: %w", err)
+	}
+	return list, nil
+}
+
+func (r *sqlIPAMRepo) CreateReservation(ctx context.Context, res *models.IPReservation) error {
+	out, err := r.q.ExecContext(ctx,
+		`INSERT INTO ip_reservations (interface_id, addresses, note) VALUES (?, ?, ?)`,
+		res.InterfaceID, res.Addresses, res.Note,
+	)
+	if err != nil {
+		return wrapWriteErr("create ip reservation", err)
+	}
+	id, err := out.LastInsertId()
+	if err != nil {
+		return fmt.Errorf("create ip reservation: %w", err)
+	}
+	res.ID = int(id)
+	return nil
+}
+
+func (r *sqlIPAMRepo) UpdateReservation(ctx context.Context, res *models.IPReservation) error {
+	out, err := r.q.ExecContext(ctx,
+		`UPDATE ip_reservations SET addresses = ?, note = ? WHERE id = ?`,
+		res.Addresses, res.Note, res.ID,
+	)
+	if err != nil {
+		return wrapWriteErr("update ip reservation", err)
+	}
+	return expectAffected("update ip reservation", out)
+}
+
+func (r *sqlIPAMRepo) DeleteReservation(ctx context.Context, id int) error {
+	res, err := r.q.ExecContext(ctx, `DELETE FROM ip_reservations WHERE id = ?`, id)
+	if err != nil {
+		return fmt.Errorf("delete ip reservation: %w", err)
+	}
+	return expectAffected("delete ip reservation", res)
+}
+
+/* -------------------- 隔离期地址 -------------------- */
+
+func (r *sqlIPAMRepo) ListQuarantine(ctx context.Context, interfaceID int, now time.Time) ([]models.QuarantinedIP, error) {
+	rows, err := r.q.QueryContext(ctx, `
+		SELECT interface_id, ip, COALESCE(peer_name, ''), released_at, until
+		FROM ip_quarantine WHERE interface_id = ? ORDER BY until`, interfaceID)
+	if err != nil {
+		return nil, fmt.Errorf("query ip quarantine: %w", err)
+	}
+	defer rows.Close()
+
+	var list []models.QuarantinedIP
+	for rows.Next() {
+		var q models.QuarantinedIP
+		if err := rows.Scan(&q.InterfaceID, &q.IP, &q.PeerName, &q.ReleasedAt, &q.Until); err != nil {
+			return nil, fmt.Errorf("scan ip quarantine: %w", err)
+		}
+		// 到期判断放在这里，避免依赖 SQLite 的时间字符串比较
+		if q.Until.After(now) {
+			list = append(list, q)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("query ip quarantine: %w", err)
+	}
+	return list, nil
+}
+
+func (r *sqlIPAMRepo) Quarantine(ctx context.Context, q *models.QuarantinedIP) error {
+	if _, err := r.q.ExecContext(ctx,
+		`DELETE FROM ip_quarantine WHERE interface_id = ? AND until <= ?`, q.InterfaceID, q.ReleasedAt.UTC(),
+	); err != nil {
+		return fmt.Errorf("purge ip quarantine: %w", err)
+	}
+	_, err := r.q.ExecContext(ctx, `
+		INSERT INTO ip_quarantine (interface_id, ip, peer_name, released_at, until) VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT(interface_id, ip) DO UPDATE SET
+		  peer_name = excluded.peer_name, released_at = excluded.released_at, until = excluded.until`,
+		q.InterfaceID, q.IP, q.PeerName, q.ReleasedAt.UTC(), q.Until.UTC(),
+	)
+	if err != nil {
+		return fmt.Errorf("quarantine ip: %w", err)
+	}
+	return nil
+}
+
+func (r *sqlIPAMRepo) Unquarantine(ctx context.Context, interfaceID int, ip string) error {
+	if _, err := r.q.ExecContext(ctx,
+		`DELETE FROM ip_quarantine WHERE interface_id = ? AND ip = ?`, interfaceID, ip,
+	); err != nil {
+		return fmt.Errorf("unquarantine ip: %w", err)
+	}
+	return nil
+}
+
+func (r *sqlIPAMRepo) Version(ctx context.Context, interfaceID int) (int64, error) {
+	var v int64
+	err := r.q.QueryRowContext(ctx, `SELECT version FROM ipam_versions WHERE interface_id = ?`, interfaceID).Scan(&v)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("query ipam version: %w", err)
+	}
+	return v, nil
+}
+
+/* -------------------- 空闲区间快照 -------------------- */
+
+func (r *sqlIPAMRepo) GetFreeState(ctx context.Context, interfaceID int) (*models.IPAMFreeState, error) {
+	st := models.IPAMFreeState{InterfaceID: interfaceID}
+	var expires sql.NullTime
+	err := r.q.QueryRowContext(ctx,
+		`SELECT version, families, expires FROM ipam_free_state WHERE interface_id = ?`, interfaceID,
+	).Scan(&st.Version, &st.Families, &expires)
+	if err != nil {
+		return nil, wrapReadErr("get ipam free state", err)
+	}
+	if expires.Valid {
+		st.Expires = expires.Time
+	}
+	return &st, nil
+}
+
+func (r *sqlIPAMRepo) ListFreeSpans(ctx context.Context, interfaceID int) ([]models.IPAMFreeSpan, error) {
+	rows, err := r.q.QueryContext(ctx,
+		`SELECT family, first, last FROM ipam_free_spans WHERE interface_id = ?`, interfaceID)
+	if err != nil {
+		return nil, fmt.Errorf("query ipam free spans: %w", err)
+	}
+	defer rows.Close()
+
+	var list []models.IPAMFreeSpan
+	for rows.Next() {
+		var sp models.IPAMFreeSpan
+		if err := rows.Scan(&sp.Family, &sp.First, &sp.Last); err != nil {
+			return nil, fmt.Errorf("scan ipam free span: %w", err)
+		}
+		list = append(list, sp)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("query ipam free spans: %w", err)
+	}
+	return list, nil
+}
+
+func (r *sqlIPAMRepo) SaveFreeSpans(ctx context.Context, st *models.IPAMFreeState, spans []models.IPAMFreeSpan) error {
+	if _, err := r.q.ExecContext(ctx, `DELETE FROM ipam_free_spans WHERE interface_id = ?`, st.InterfaceID); err != nil {
+		return fmt.Errorf("save ipam free spans: %w", err)
+	}
+	if _, err := r.q.ExecContext(ctx, `
+		INSERT INTO ipam_free_state (interface_id, version, families, expires) VALUES (?, ?, ?, ?)
+		ON CONFLICT(interface_id) DO UPDATE SET
+		  version = excluded.version, families = excluded.families, expires = excluded.expires`,
+		st.InterfaceID, st.Version, st.Families, freeExpires(st.Expires),
+	); err != nil {
+		return fmt.Errorf("save ipam free state: %w", err)
+	}
+	return r.writeFreeSpans(ctx, st.InterfaceID, spans, nil)
+}
+
+func (r *sqlIPAMRepo) PatchFreeSpans(ctx context.Context, from int64, st *models.IPAMFreeState, set, removed []models.IPAMFreeSpan) (bool, error) {
+	res, err := r.q.ExecContext(ctx, `
+		UPDATE ipam_free_state SET version = ?, expires = ?
+		WHERE interface_id = ? AND version = ? AND families = ?`,
+		st.Version, freeExpires(st.Expires), st.InterfaceID, from, st.Families,
+	)
+	if err != nil {
+		return false, fmt.Errorf("patch ipam free state: %w", err)
+	}
+	if n, err := res.RowsAffected(); err != nil || n == 0 {
+		return false, err
+	}
+	return true, r.writeFreeSpans(ctx, st.InterfaceID, set, removed)
+}
+
+// freeExpires 把零值的到期时间存为 NULL
+func freeExpires(t time.Time) sql.NullTime {
+	if t.IsZero() {
+		return sql.NullTime{}
+	}
+	return sql.NullTime{Time: t.UTC(), Valid: true}
+}
+
+// writeFreeSpans 删除 removed 中的区间后写入（覆盖）set
+func (r *sqlIPAMRepo) writeFreeSpans(ctx context.Context, interfaceID int, set, removed []models.IPAMFreeSpan) error {
+	for _, sp := range removed {
+		if _, err := r.q.ExecContext(ctx,
+			`DELETE FROM ipam_free_spans WHERE interface_id = ? AND family = ? AND first = ?`,
+			interfaceID, sp.Family, sp.First,
+		); err != nil {
+			return fmt.Errorf("delete ipam free span: %w", err)
+		}
+	}
+	for _, sp := range set {
+		if _, err := r.q.ExecContext(ctx, `
+			INSERT INTO ipam_free_spans (interface_id, family, first, last) VALUES (?, ?, ?, ?)
+			ON CONFLICT(interface_id, family, first) DO UPDATE SET last = excluded.last`,
+			interfaceID, sp.Family, sp.First, sp.Last,
+		); err != nil {
+			return fmt.Errorf("write ipam free span: %w", err)
+		}
+	}
+	return nil
+}
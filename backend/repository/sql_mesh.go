@@ -0,0 +1,209 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+
+	"backend/models"
+)
+
+type sqlMeshRepo struct {
+	q       querier
+	secrets secretCodec
+}
+
+const meshColumns = `
+	m.id, m.name, m.network, m.listen_port, m.mtu, m.persistent_keepalive, m.revision,
+	(SELECT COUNT(*) FROM mesh_members x WHERE x.mesh_id = m.id) AS member_count,
+	m.created_at, m.updated_at`
+
+func scanMesh(r rowScanner) (*models.Mesh, error) {
+	var m models.Mesh
+	if err := r.Scan(
+		&m.ID, &m.Name, &m.Network, &m.ListenPort, &m.MTU, &m.PersistentKeepalive, &m.Revision,
+		&m.MemberCount, &m.CreatedAt, &m.UpdatedAt,
+	); err != nil {
+		return nil, err
+	}
+	return &m, nil
+}
+
+func (r *sqlMeshRepo) List(ctx context.Context) ([]models.Mesh, error) {
+	rows, err := r.q.QueryContext(ctx, `SELECT `+meshColumns+` FROM meshes m ORDER BY m.name`)
+	if err != nil {
+		return nil, fmt.Errorf("query meshes: %w", err)
+	}
+	defer rows.Close()
+
+	var list []models.Mesh
+	for rows.Next() {
+		m, err := scanMesh(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scan mesh: %w", err)
+		}
+		list = append(list, *m)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("query meshes: %w", err)
+	}
+	return list, nil
+}
+
+func (r *sqlMeshRepo) Get(ctx context.Context, id int) (*models.Mesh, error) {
+	m, err := scanMesh(r.q.QueryRowContext(ctx, `SELECT `+meshColumns+` FROM meshes m WHERE m.id = ?`, id))
+	if err != nil {
+		return nil, wrapReadErr("get mesh", err)
+	}
+	return m, nil
+}
+
+func (r *sqlMeshRepo) Create(ctx context.Context, m *models.Mesh) error {
+	res, err := r.q.ExecContext(ctx, `
+		INSERT INTO meshes (name, network, listen_port, mtu, persistent_keepalive)
+		VALUES (?, ?, ?, ?, ?)`,
+		m.Name, m.Network, m.ListenPort, m.MTU, m.PersistentKeepalive,
+	)
+	if err != nil {
+		return wrapWriteErr("create mesh", err)
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return fmt.Errorf("create mesh: %w", err)
+	}
+	m.ID = int(id)
+	return nil
+}
+
+func (r *sqlMeshRepo) Update(ctx context.Context, m *models.Mesh) error {
+	res, err := r.q.ExecContext(ctx, `
+		UPDATE meshes
+		SET name = ?, network = ?, listen_port = ?, mtu = ?, persistent_keepalive = ?, revision = ?,
+		    updated_at = CURRENT_TIMESTAMP
+		WHERE id = ?`,
+		m.Name, m.Network, m.ListenPort, m.MTU, m.PersistentKeepalive, m.Revision, m.ID,
+	)
+	if err != nil {
+		return wrapWriteErr("update mesh", err)
+	}
+	return expectAffected("update mesh", res)
+}
+
+func (r *sqlMeshRepo) Bump(ctx context.Context, id int) error {
+	res, err := r.q.ExecContext(ctx,
+		`UPDATE meshes SET revision = revision + 1, updated_at = CURRENT_TIMESTAMP WHERE id = ?`, id)
+	if err != nil {
+		return fmt.Errorf("bump mesh revision: %w", err)
+	}
+	return expectAffected("bump mesh revision", res)
+}
+
+func (r *sqlMeshRepo) Delete(ctx context.Context, id int) error {
+	if _, err := r.q.ExecContext(ctx, `DELETE FROM mesh_members WHERE mesh_id = ?`, id); err != nil {
+		return fmt.Errorf("delete mesh members: %w", err)
+	}
+	res, err := r.q.ExecContext(ctx, `DELETE FROM meshes WHERE id = ?`, id)
+	if err != nil {
+		return fmt.Errorf("delete mesh: %w", err)
+	}
+	return expectAffected("delete mesh", res)
+}
+
+/* -------------------- 成员 -------------------- */
+
+const meshMemberColumns = `
+	id, mesh_id, name, endpoint, ip, listen_port, public_key,
+	COALESCE(private_key, '') AS private_key,
+	created_at, updated_at`
+
+func (r *sqlMeshRepo) scanMember(row rowScanner) (*models.MeshMember, error) {
+	var m models.MeshMember
+	if err := row.Scan(
+		&m.ID, &m.MeshID, &m.Name, &m.Endpoint, &m.IP, &m.ListenPort, &m.PublicKey, &m.PrivateKey,
+		&m.CreatedAt, &m.UpdatedAt,
+	); err != nil {
+		return nil, err
+	}
+	var err error
+	if m.PrivateKey, err = r.secrets.open(m.PrivateKey); err != nil {
+		return nil, fmt.Errorf("mesh member %d private key: %w", m.ID, err)
+	}
+	return &m, nil
+}
+
+func (r *sqlMeshRepo) Members(ctx context.Context, meshID int) ([]models.MeshMember, error) {
+	rows, err := r.q.QueryContext(ctx,
+		`SELECT `+meshMemberColumns+` FROM mesh_members WHERE mesh_id = ? ORDER BY id`, meshID)
+	if err != nil {
+		return nil, fmt.Errorf("query mesh members: %w", err)
+	}
+	defer rows.Close()
+
+	var list []models.MeshMember
+	for rows.Next() {
+		m, err := r.scanMember(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scan mesh member: %w", err)
+		}
+		list = append(list, *m)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("query mesh members: %w", err)
+	}
+	return list, nil
+}
+
+func (r *sqlMeshRepo) GetMember(ctx context.Context, id int) (*models.MeshMember, error) {
+	m, err := r.scanMember(r.q.QueryRowContext(ctx,
+		`SELECT `+meshMemberColumns+` FROM mesh_members WHERE id = ?`, id))
+	if err != nil {
+		return nil, wrapReadErr("get mesh member", err)
+	}
+	return m, nil
+}
+
+func (r *sqlMeshRepo) CreateMember(ctx context.Context, m *models.MeshMember) error {
+	priv, err := r.secrets.seal(m.PrivateKey)
+	if err != nil {
+		return fmt.Errorf("create mesh member: %w", err)
+	}
+	res, err := r.q.ExecContext(ctx, `
+		INSERT INTO mesh_members (mesh_id, name, endpoint, ip, listen_port, public_key, private_key)
+		VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		m.MeshID, m.Name, m.Endpoint, m.IP, m.ListenPort, m.PublicKey, priv,
+	)
+	if err != nil {
+		return wrapWriteErr("create mesh member", err)
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return fmt.Errorf("create mesh member: %w", err)
+	}
+	m.ID = int(id)
+	return nil
+}
+
+func (r *sqlMeshRepo) UpdateMember(ctx context.Context, m *models.MeshMember) error {
+	priv, err := r.secrets.seal(m.PrivateKey)
+	if err != nil {
+		return fmt.Errorf("update mesh member: %w", err)
+	}
+	res, err := r.q.ExecContext(ctx, `
+		UPDATE mesh_members
+		SET name = ?, endpoint = ?, ip = ?, listen_port = ?, public_key = ?, private_key = ?,
+		    updated_at = CURRENT_TIMESTAMP
+		WHERE id = ?`,
+		m.Name, m.Endpoint, m.IP, m.ListenPort, m.PublicKey, priv, m.ID,
+	)
+	if err != nil {
+		return wrapWriteErr("update mesh member", err)
+	}
+	return expectAffected("update mesh member", res)
+}
+
+func (r *sqlMeshRepo) DeleteMember(ctx context.Context, id int) error {
+	res, err := r.q.ExecContext(ctx, `DELETE FROM mesh_members WHERE id = ?`, id)
+	if err != nil {
+		return fmt.Errorf("delete mesh member: %w", err)
+	}
+	return expectAffected("delete mesh member", res)
+}
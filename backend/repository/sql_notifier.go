@@ -0,0 +1,130 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"backend/models"
+)
+
+type sqlNotifierRepo struct {
+	q       querier
+	secrets secretCodec
+}
+
+const notifierColumns = `
+	id, name, type, enabled,
+	COALESCE(settings, '{}') AS settings,
+	COALESCE(secret, '')     AS secret,
+	created_at, updated_at`
+
+func (r *sqlNotifierRepo) scan(rs rowScanner) (*models.Notifier, error) {
+	var n models.Notifier
+	var settings string
+	if err := rs.Scan(&n.ID, &n.Name, &n.Type, &n.Enabled, &settings, &n.Secret, &n.CreatedAt, &n.UpdatedAt); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal([]byte(settings), &n.Settings); err != nil {
+		return nil, fmt.Errorf("notifier %d settings: %w", n.ID, err)
+	}
+	if n.Settings == nil {
+		n.Settings = map[string]string{}
+	}
+	var err error
+	if n.Secret, err = r.secrets.open(n.Secret); err != nil {
+		return nil, fmt.Errorf("notifier %d secret: %w", n.ID, err)
+	}
+	return &n, nil
+}
+
+// seal 编码 settings 并加密 secret
+func (r *sqlNotifierRepo) seal(n *models.Notifier) (string, string, error) {
+	settings := n.Settings
+	if settings == nil {
+		settings = map[string]string{}
+	}
+	b, err := json.Marshal(settings)
+	if err != nil {
+		return "", "", err
+	}
+	secret, err := r.secrets.seal(n.Secret)
+	if err != nil {
+		return "", "", err
+	}
+	return string(b), secret, nil
+}
+
+func (r *sqlNotifierRepo) List(ctx context.Context) ([]models.Notifier, error) {
+	rows, err := r.q.QueryContext(ctx, `SELECT `+notifierColumns+` FROM notifiers ORDER BY name`)
+	if err != nil {
+		return nil, fmt.Errorf("query notifiers: %w", err)
+	}
+	defer rows.Close()
+
+	var list []models.Notifier
+	for rows.Next() {
+		n, err := r.scan(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scan notifier: %w", err)
+		}
+		list = append(list, *n)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("query notifiers: %w", err)
+	}
+	return list, nil
+}
+
+func (r *sqlNotifierRepo) Get(ctx context.Context, id int) (*models.Notifier, error) {
+	n, err := r.scan(r.q.QueryRowContext(ctx, `SELECT `+notifierColumns+` FROM notifiers WHERE id = ?`, id))
+	if err != nil {
+		return nil, wrapReadErr("get notifier", err)
+	}
+	return n, nil
+}
+
+func (r *sqlNotifierRepo) Create(ctx context.Context, n *models.Notifier) error {
+	settings, secret, err := r.seal(n)
+	if err != nil {
+		return fmt.Errorf("create notifier: %w", err)
+	}
+	res, err := r.q.ExecContext(ctx, `
+		INSERT INTO notifiers (name, type, enabled, settings, secret) VALUES (?, ?, ?, ?, ?)`,
+		n.Name, n.Type, n.Enabled, settings, nullString(secret),
+	)
+	if err != nil {
+		return wrapWriteErr("create notifier", err)
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return fmt.Errorf("create notifier: %w", err)
+	}
+	n.ID = int(id)
+	return nil
+}
+
+func (r *sqlNotifierRepo) Update(ctx context.Context, n *models.Notifier) error {
+	settings, secret, err := r.seal(n)
+	if err != nil {
+		return fmt.Errorf("update notifier: %w", err)
+	}
+	res, err := r.q.ExecContext(ctx, `
+		UPDATE notifiers
+		SET name = ?, type = ?, enabled = ?, settings = ?, secret = ?, updated_at = CURRENT_TIMESTAMP
+		WHERE id = ?`,
+		n.Name, n.Type, n.Enabled, settings, nullString(secret), n.ID,
+	)
+	if err != nil {
+		return wrapWriteErr("update notifier", err)
+	}
+	return expectAffected("update notifier", res)
+}
+
+func (r *sqlNotifierRepo) Delete(ctx context.Context, id int) error {
+	res, err := r.q.ExecContext(ctx, `DELETE FROM notifiers WHERE id = ?`, id)
+	if err != nil {
+		return fmt.Errorf("delete notifier: %w", err)
+	}
+	return expectAffected("delete notifier", res)
+}
@@ -0,0 +1,305 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"backend/models"
+)
+
+type sqlPeerRepo struct {
+	db      *sql.DB // 事务内为 nil
+	q       querier
+	secrets secretCodec
+}
+
+// atomic 在事务中执行 fn；已处于事务内时直接复用
+func (r *sqlPeerRepo) atomic(ctx context.Context, fn func(q querier) error) error {
+	if r.db == nil {
+		return fn(r.q)
+	}
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+	if err := fn(tx); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// setAddresses 重写 peer 的 peer_addresses 行；(interface_id, addr) 主键保证每个地址在接口内唯一
+func setAddresses(ctx context.Context, q querier, peerID int, ips string) error {
+	if _, err := q.ExecContext(ctx, `DELETE FROM peer_addresses WHERE peer_id = ?`, peerID); err != nil {
+		return err
+	}
+	seen := map[string]bool{}
+	for _, addr := range splitIPs(ips) {
+		if seen[addr] {
+			continue
+		}
+		seen[addr] = true
+		if _, err := q.ExecContext(ctx, `
+			INSERT INTO peer_addresses (peer_id, interface_id, addr)
+			SELECT id, interface_id, ? FROM wireguard_peers WHERE id = ?`, addr, peerID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// 所有 peer 查询共用同一列清单，保证返回模型字段一致
+const peerColumns = `
+	p.id,
+	p.interface_id,
+	COALESCE(i.name, '')                AS interface_name,
+	p.name,
+	COALESCE(p.public_key, '')          AS public_key,
+	COALESCE(p.private_key, '')         AS private_key,
+	COALESCE(p.ip, '')                  AS ip,
+	COALESCE(p.allowed_ips, '')         AS allowed_ips,
+	COALESCE(p.preshared_key, '')       AS preshared_key,
+	COALESCE(p.endpoint, '')            AS endpoint,
+	COALESCE(p.resolved_endpoint, '')   AS resolved_endpoint,
+	COALESCE(p.persistent_keepalive, 0) AS persistent_keepalive,
+	COALESCE(p.client_allowed_ips, '')  AS client_allowed_ips,
+	p.routing_profile_id,
+	COALESCE(p.excluded_ips, '')        AS excluded_ips,
+	COALESCE(p.status, 'disconnected')  AS status,
+	COALESCE(p.disabled, 0)             AS disabled,
+	COALESCE(p.type, 'client')          AS type,
+	COALESCE(p.routed_subnets, '')      AS routed_subnets,
+	p.last_handshake,
+	COALESCE(p.bytes_received, 0)       AS bytes_received,
+	COALESCE(p.bytes_sent, 0)           AS bytes_sent,
+	p.created_at,
+	p.updated_at`
+
+const peerFrom = `
+	FROM wireguard_peers p
+	LEFT JOIN wireguard_interfaces i ON i.id = p.interface_id`
+
+func (r *sqlPeerRepo) scan(row rowScanner) (*models.WireGuardPeer, error) {
+	p, err := scanPeer(row)
+	if err != nil {
+		return nil, err
+	}
+	if p.PrivateKey, err = r.secrets.open(p.PrivateKey); err != nil {
+		return nil, fmt.Errorf("peer %d private key: %w", p.ID, err)
+	}
+	if p.PresharedKey, err = r.secrets.open(p.PresharedKey); err != nil {
+		return nil, fmt.Errorf("peer %d preshared key: %w", p.ID, err)
+	}
+	return p, nil
+}
+
+// 加密 peer 的敏感列，返回 (private_key, preshared_key)
+func (r *sqlPeerRepo) sealSecrets(p *models.WireGuardPeer) (priv, psk string, err error) {
+	if priv, err = r.secrets.seal(p.PrivateKey); err != nil {
+		return "", "", err
+	}
+	if psk, err = r.secrets.seal(p.PresharedKey); err != nil {
+		return "", "", err
+	}
+	return priv, psk, nil
+}
+
+// peerType 把空类型按默认的 client 写入
+func peerType(typ string) string {
+	if typ == "" {
+		return models.PeerTypeClient
+	}
+	return typ
+}
+
+func scanPeer(r rowScanner) (*models.WireGuardPeer, error) {
+	var p models.WireGuardPeer
+	var last sql.NullTime
+	var profileID sql.NullInt64
+	if err := r.Scan(
+		&p.ID, &p.InterfaceID, &p.InterfaceName, &p.Name,
+		&p.PublicKey, &p.PrivateKey,
+		&p.IP, &p.AllowedIPs, &p.PresharedKey,
+		&p.Endpoint, &p.ResolvedEndpoint, &p.PersistentKeepalive,
+		&p.ClientAllowedIPs, &profileID, &p.ExcludedIPs,
+		&p.Status, &p.Disabled, &p.Type, &p.RoutedSubnets, &last,
+		&p.BytesReceived, &p.BytesSent,
+		&p.CreatedAt, &p.UpdatedAt,
+	); err != nil {
+		return nil, err
+	}
+	if last.Valid {
+		t := last.Time
+		p.LastHandshake = &t
+	}
+	if profileID.Valid {
+		id := int(profileID.Int64)
+		p.RoutingProfileID = &id
+	}
+	return &p, nil
+}
+
+func (r *sqlPeerRepo) query(ctx context.Context, where string, args ...any) ([]models.WireGuardPeer, error) {
+	rows, err := r.q.QueryContext(ctx, `SELECT `+peerColumns+peerFrom+` `+where+` ORDER BY p.created_at DESC, p.id DESC`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("query peers: %w", err)
+	}
+	defer rows.Close()
+
+	var list []models.WireGuardPeer
+	for rows.Next() {
+		p, err := r.scan(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scan peer: %w", err)
+		}
+		list = append(list, *p)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("query peers: %w", err)
+	}
+	return list, nil
+}
+
+func (r *sqlPeerRepo) List(ctx context.Context) ([]models.WireGuardPeer, error) {
+	return r.query(ctx, "")
+}
+
+func (r *sqlPeerRepo) ListByInterface(ctx context.Context, interfaceID int) ([]models.WireGuardPeer, error) {
+	return r.query(ctx, "WHERE p.interface_id = ?", interfaceID)
+}
+
+func (r *sqlPeerRepo) Get(ctx context.Context, id int) (*models.WireGuardPeer, error) {
+	p, err := r.scan(r.q.QueryRowContext(ctx, `SELECT `+peerColumns+peerFrom+` WHERE p.id = ?`, id))
+	if err != nil {
+		return nil, wrapReadErr("get peer", err)
+	}
+	return p, nil
+}
+
+func (r *sqlPeerRepo) Create(ctx context.Context, p *models.WireGuardPeer) error {
+	priv, psk, err := r.sealSecrets(p)
+	if err != nil {
+		return fmt.Errorf("create peer: %w", err)
+	}
+	return r.atomic(ctx, func(q querier) error {
+		res, err := q.ExecContext(ctx, `
+			INSERT INTO wireguard_peers
+			  (interface_id, name, ip, allowed_ips, endpoint, persistent_keepalive,
+			   client_allowed_ips, routing_profile_id, excluded_ips, disabled, type, routed_subnets,
+			   public_key, private_key, preshared_key)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			p.InterfaceID, p.Name, p.IP, p.AllowedIPs, nullString(p.Endpoint), p.PersistentKeepalive,
+			p.ClientAllowedIPs, nullInt(p.RoutingProfileID), p.ExcludedIPs, p.Disabled, peerType(p.Type), p.RoutedSubnets,
+			p.PublicKey, nullString(priv), nullString(psk),
+		)
+		if err != nil {
+			return wrapPeerWriteErr("create peer", err)
+		}
+		id, err := res.LastInsertId()
+		if err != nil {
+			return fmt.Errorf("create peer: %w", err)
+		}
+		if err := setAddresses(ctx, q, int(id), p.IP); err != nil {
+			return wrapPeerWriteErr("create peer", err)
+		}
+		p.ID = int(id)
+		return nil
+	})
+}
+
+func (r *sqlPeerRepo) Update(ctx context.Context, p *models.WireGuardPeer) error {
+	priv, psk, err := r.sealSecrets(p)
+	if err != nil {
+		return fmt.Errorf("update peer: %w", err)
+	}
+	return r.atomic(ctx, func(q querier) error {
+		res, err := q.ExecContext(ctx, `
+			UPDATE wireguard_peers
+			SET resolved_endpoint = CASE WHEN COALESCE(endpoint, '') = ? THEN resolved_endpoint ELSE '' END,
+			    name = ?, ip = ?, allowed_ips = ?, endpoint = ?, persistent_keepalive = ?,
+			    client_allowed_ips = ?, routing_profile_id = ?, excluded_ips = ?, disabled = ?,
+			    type = ?, routed_subnets = ?,
+			    public_key = ?, private_key = ?, preshared_key = ?, updated_at = CURRENT_TIMESTAMP
+			WHERE id = ?`,
+			p.Endpoint,
+			p.Name, p.IP, p.AllowedIPs, nullString(p.Endpoint), p.PersistentKeepalive,
+			p.ClientAllowedIPs, nullInt(p.RoutingProfileID), p.ExcludedIPs, p.Disabled,
+			peerType(p.Type), p.RoutedSubnets,
+			p.PublicKey, nullString(priv), nullString(psk), p.ID,
+		)
+		if err != nil {
+			return wrapPeerWriteErr("update peer", err)
+		}
+		if err := expectAffected("update peer", res); err != nil {
+			return err
+		}
+		if err := setAddresses(ctx, q, p.ID, p.IP); err != nil {
+			return wrapPeerWriteErr("update peer", err)
+		}
+		return nil
+	})
+}
+
+func (r *sqlPeerRepo) SetResolvedEndpoint(ctx context.Context, id int, endpoint string) error {
+	if _, err := r.q.ExecContext(ctx,
+		`UPDATE wireguard_peers SET resolved_endpoint = ? WHERE id = ?`, endpoint, id); err != nil {
+		return fmt.Errorf("set peer resolved endpoint: %w", err)
+	}
+	return nil
+}
+
+func (r *sqlPeerRepo) SetHandshake(ctx context.Context, id int, status string, last *time.Time) error {
+	var t sql.NullTime
+	if last != nil {
+		t = sql.NullTime{Time: last.UTC(), Valid: true}
+	}
+	if _, err := r.q.ExecContext(ctx,
+		`UPDATE wireguard_peers SET status = ?, last_handshake = ? WHERE id = ?`, status, t, id); err != nil {
+		return fmt.Errorf("set peer handshake: %w", err)
+	}
+	return nil
+}
+
+func (r *sqlPeerRepo) Delete(ctx context.Context, id int) error {
+	// 只针对该 peer 的 ACL 规则、分组成员关系与在线时段随之删除（不依赖 PRAGMA foreign_keys）
+	for _, tbl := range []string{"acl_rules", "peer_group_members", "peer_sessions", "peer_addresses"} {
+		if _, err := r.q.ExecContext(ctx, `DELETE FROM `+tbl+` WHERE peer_id = ?`, id); err != nil {
+			return fmt.Errorf("delete peer %s: %w", tbl, err)
+		}
+	}
+	res, err := r.q.ExecContext(ctx, `DELETE FROM wireguard_peers WHERE id = ?`, id)
+	if err != nil {
+		return fmt.Errorf("delete peer: %w", err)
+	}
+	return expectAffected("delete peer", res)
+}
+
+func (r *sqlPeerRepo) UsedIPs(ctx context.Context, interfaceID int) ([]string, error) {
+	rows, err := r.q.QueryContext(ctx, `SELECT ip FROM wireguard_peers WHERE interface_id = ? AND ip <> ''`, interfaceID)
+	if err != nil {
+		return nil, fmt.Errorf("query used ips: %w", err)
+	}
+	defer rows.Close()
+
+	var ips []string
+	for rows.Next() {
+		var ip string
+		if err := rows.Scan(&ip); err != nil {
+			return nil, fmt.Errorf("scan used ip: %w", err)
+		}
+		ips = append(ips, splitIPs(ip)...)
+	}
+	return ips, rows.Err()
+}
+
+// wrapPeerWriteErr 把地址唯一约束（peer_addresses 主键或 (interface_id, ip) 索引）的冲突标记为 ErrIPConflict
+func wrapPeerWriteErr(op string, err error) error {
+	if isUniqueError(err) && (strings.Contains(err.Error(), "wireguard_peers.ip") || strings.Contains(err.Error(), "peer_addresses.")) {
+		return fmt.Errorf("%s: %w (%v)", op, ErrIPConflict, err)
+	}
+	return wrapWriteErr(op, err)
+}
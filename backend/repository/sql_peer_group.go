@@ -0,0 +1,193 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+
+	"backend/models"
+)
+
+type sqlPeerGroupRepo struct {
+	q querier
+}
+
+const peerGroupColumns = `
+	g.id, g.name,
+	COALESCE(g.description, '') AS description,
+	(SELECT COUNT(*) FROM peer_group_members m WHERE m.group_id = g.id) AS member_count,
+	g.created_at, g.updated_at`
+
+func scanPeerGroup(r rowScanner) (*models.PeerGroup, error) {
+	var g models.PeerGroup
+	if err := r.Scan(
+		&g.ID, &g.Name, &g.Description, &g.MemberCount,
+		&g.CreatedAt, &g.UpdatedAt,
+	); err != nil {
+		return nil, err
+	}
+	return &g, nil
+}
+
+func (r *sqlPeerGroupRepo) List(ctx context.Context) ([]models.PeerGroup, error) {
+	rows, err := r.q.QueryContext(ctx, `SELECT `+peerGroupColumns+` FROM peer_groups g ORDER BY g.name`)
+	if err != nil {
+		return nil, fmt.Errorf("query peer groups: %w", err)
+	}
+	defer rows.Close()
+
+	var list []models.PeerGroup
+	for rows.Next() {
+		g, err := scanPeerGroup(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scan peer group: %w", err)
+		}
+		list = append(list, *g)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("query peer groups: %w", err)
+	}
+	return list, nil
+}
+
+func (r *sqlPeerGroupRepo) Get(ctx context.Context, id int) (*models.PeerGroup, error) {
+	g, err := scanPeerGroup(r.q.QueryRowContext(ctx, `SELECT `+peerGroupColumns+` FROM peer_groups g WHERE g.id = ?`, id))
+	if err != nil {
+		return nil, wrapReadErr("get peer group", err)
+	}
+	return g, nil
+}
+
+func (r *sqlPeerGroupRepo) GetByName(ctx context.Context, name string) (*models.PeerGroup, error) {
+	g, err := scanPeerGroup(r.q.QueryRowContext(ctx, `SELECT `+peerGroupColumns+` FROM peer_groups g WHERE g.name = ?`, name))
+	if err != nil {
+		return nil, wrapReadErr("get peer group by name", err)
+	}
+	return g, nil
+}
+
+func (r *sqlPeerGroupRepo) Create(ctx context.Context, g *models.PeerGroup) error {
+	res, err := r.q.ExecContext(ctx, `INSERT INTO peer_groups (name, description) VALUES (?, ?)`, g.Name, g.Description)
+	if err != nil {
+		return wrapWriteErr("create peer group", err)
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return fmt.Errorf("create peer group: %w", err)
+	}
+	g.ID = int(id)
+	return nil
+}
+
+func (r *sqlPeerGroupRepo) Update(ctx context.Context, g *models.PeerGroup) error {
+	res, err := r.q.ExecContext(ctx, `
+		UPDATE peer_groups
+		SET name = ?, description = ?, updated_at = CURRENT_TIMESTAMP
+		WHERE id = ?`,
+		g.Name, g.Description, g.ID,
+	)
+	if err != nil {
+		return wrapWriteErr("update peer group", err)
+	}
+	return expectAffected("update peer group", res)
+}
+
+func (r *sqlPeerGroupRepo) Delete(ctx context.Context, id int) error {
+	if _, err := r.q.ExecContext(ctx, `DELETE FROM peer_group_members WHERE group_id = ?`, id); err != nil {
+		return fmt.Errorf("delete peer group members: %w", err)
+	}
+	res, err := r.q.ExecContext(ctx, `DELETE FROM peer_groups WHERE id = ?`, id)
+	if err != nil {
+		return fmt.Errorf("delete peer group: %w", err)
+	}
+	return expectAffected("delete peer group", res)
+}
+
+func (r *sqlPeerGroupRepo) Members(ctx context.Context, groupID int) ([]int, error) {
+	rows, err := r.q.QueryContext(ctx,
+		`SELECT peer_id FROM peer_group_members WHERE group_id = ? ORDER BY peer_id`, groupID)
+	if err != nil {
+		return nil, fmt.Errorf("query peer group members: %w", err)
+	}
+	defer rows.Close()
+
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("scan peer group member: %w", err)
+		}
+		ids = append(ids, id)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("query peer group members: %w", err)
+	}
+	return ids, nil
+}
+
+func (r *sqlPeerGroupRepo) AddMembers(ctx context.Context, groupID int, peerIDs []int) error {
+	for _, pid := range peerIDs {
+		if _, err := r.q.ExecContext(ctx,
+			`INSERT OR IGNORE INTO peer_group_members (group_id, peer_id) VALUES (?, ?)`, groupID, pid,
+		); err != nil {
+			return fmt.Errorf("add peer group member: %w", err)
+		}
+	}
+	return nil
+}
+
+func (r *sqlPeerGroupRepo) SetMembers(ctx context.Context, groupID int, peerIDs []int) error {
+	if _, err := r.q.ExecContext(ctx, `DELETE FROM peer_group_members WHERE group_id = ?`, groupID); err != nil {
+		return fmt.Errorf("set peer group members: %w", err)
+	}
+	return r.AddMembers(ctx, groupID, peerIDs)
+}
+
+func (r *sqlPeerGroupRepo) RemoveMember(ctx context.Context, groupID, peerID int) error {
+	res, err := r.q.ExecContext(ctx,
+		`DELETE FROM peer_group_members WHERE group_id = ? AND peer_id = ?`, groupID, peerID)
+	if err != nil {
+		return fmt.Errorf("remove peer group member: %w", err)
+	}
+	return expectAffected("remove peer group member", res)
+}
+
+func (r *sqlPeerGroupRepo) SetPeerGroups(ctx context.Context, peerID int, groupIDs []int) error {
+	if _, err := r.q.ExecContext(ctx, `DELETE FROM peer_group_members WHERE peer_id = ?`, peerID); err != nil {
+		return fmt.Errorf("set peer groups: %w", err)
+	}
+	for _, gid := range groupIDs {
+		if _, err := r.q.ExecContext(ctx,
+			`INSERT OR IGNORE INTO peer_group_members (group_id, peer_id) VALUES (?, ?)`, gid, peerID,
+		); err != nil {
+			return fmt.Errorf("set peer groups: %w", err)
+		}
+	}
+	return nil
+}
+
+func (r *sqlPeerGroupRepo) Memberships(ctx context.Context) (map[int][]string, error) {
+	rows, err := r.q.QueryContext(ctx, `
+		SELECT m.peer_id, g.name
+		FROM peer_group_members m JOIN peer_groups g ON g.id = m.group_id
+		ORDER BY m.peer_id, g.name`)
+	if err != nil {
+		return nil, fmt.Errorf("query peer memberships: %w", err)
+	}
+	defer rows.Close()
+
+	out := map[int][]string{}
+	for rows.Next() {
+		var (
+			pid  int
+			name string
+		)
+		if err := rows.Scan(&pid, &name); err != nil {
+			return nil, fmt.Errorf("scan peer membership: %w", err)
+		}
+		out[pid] = append(out[pid], name)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("query peer memberships: %w", err)
+	}
+	return out, nil
+}
@@ -0,0 +1,94 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"backend/models"
+)
+
+type sqlPeerSessionRepo struct {
+	q querier
+}
+
+// 时间统一按 UTC、精确到秒写入，SQLite 中的字符串比较与时间顺序一致
+func sessionTime(t time.Time) time.Time {
+	return t.UTC().Truncate(time.Second)
+}
+
+func (r *sqlPeerSessionRepo) Open(ctx context.Context, ps *models.PeerSession) error {
+	res, err := r.q.ExecContext(ctx,
+		`INSERT INTO peer_sessions (peer_id, interface_id, started_at) VALUES (?, ?, ?)`,
+		ps.PeerID, ps.InterfaceID, sessionTime(ps.StartedAt),
+	)
+	if err != nil {
+		return fmt.Errorf("open peer session: %w", err)
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return fmt.Errorf("open peer session: %w", err)
+	}
+	ps.ID = int(id)
+	return nil
+}
+
+func (r *sqlPeerSessionRepo) Close(ctx context.Context, peerID int, endedAt time.Time) error {
+	if _, err := r.q.ExecContext(ctx,
+		`UPDATE peer_sessions SET ended_at = ? WHERE peer_id = ? AND ended_at IS NULL`,
+		sessionTime(endedAt), peerID,
+	); err != nil {
+		return fmt.Errorf("close peer session: %w", err)
+	}
+	return nil
+}
+
+func (r *sqlPeerSessionRepo) ListOpen(ctx context.Context) ([]models.PeerSession, error) {
+	return r.query(ctx, `WHERE ended_at IS NULL`)
+}
+
+func (r *sqlPeerSessionRepo) ListByPeer(ctx context.Context, peerID int, since time.Time) ([]models.PeerSession, error) {
+	return r.query(ctx, `WHERE peer_id = ? AND (ended_at IS NULL OR ended_at >= ?)`, peerID, sessionTime(since))
+}
+
+func (r *sqlPeerSessionRepo) ListSince(ctx context.Context, since time.Time) ([]models.PeerSession, error) {
+	return r.query(ctx, `WHERE ended_at IS NULL OR ended_at >= ?`, sessionTime(since))
+}
+
+func (r *sqlPeerSessionRepo) Prune(ctx context.Context, before time.Time) error {
+	if _, err := r.q.ExecContext(ctx,
+		`DELETE FROM peer_sessions WHERE ended_at IS NOT NULL AND ended_at < ?`, sessionTime(before),
+	); err != nil {
+		return fmt.Errorf("prune peer sessions: %w", err)
+	}
+	return nil
+}
+
+func (r *sqlPeerSessionRepo) query(ctx context.Context, where string, args ...any) ([]models.PeerSession, error) {
+	rows, err := r.q.QueryContext(ctx, `
+		SELECT id, peer_id, interface_id, started_at, ended_at
+		FROM peer_sessions `+where+` ORDER BY started_at DESC, id DESC`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("query peer sessions: %w", err)
+	}
+	defer rows.Close()
+
+	var list []models.PeerSession
+	for rows.Next() {
+		var ps models.PeerSession
+		var ended sql.NullTime
+		if err := rows.Scan(&ps.ID, &ps.PeerID, &ps.InterfaceID, &ps.StartedAt, &ended); err != nil {
+			return nil, fmt.Errorf("scan peer session: %w", err)
+		}
+		if ended.Valid {
+			t := ended.Time
+			ps.EndedAt = &t
+		}
+		list = append(list, ps)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("query peer sessions: %w", err)
+	}
+	return list, nil
+}
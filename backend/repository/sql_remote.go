@@ -0,0 +1,66 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"backend/models"
+)
+
+type sqlRemoteRepo struct {
+	q       querier
+	secrets secretCodec
+}
+
+const remoteColumns = `
+	interface_id, public_key,
+	COALESCE(preshared_key, '') AS preshared_key,
+	endpoint, allowed_ips, persistent_keepalive, route_table, fwmark, updated_at`
+
+func (r *sqlRemoteRepo) Get(ctx context.Context, interfaceID int) (*models.ClientRemote, error) {
+	var c models.ClientRemote
+	err := r.q.QueryRowContext(ctx,
+		`SELECT `+remoteColumns+` FROM interface_remotes WHERE interface_id = ?`, interfaceID,
+	).Scan(
+		&c.InterfaceID, &c.PublicKey, &c.PresharedKey,
+		&c.Endpoint, &c.AllowedIPs, &c.PersistentKeepalive, &c.Table, &c.FwMark, &c.UpdatedAt,
+	)
+	if err != nil {
+		return nil, wrapReadErr("get interface remote", err)
+	}
+	if c.PresharedKey, err = r.secrets.open(c.PresharedKey); err != nil {
+		return nil, fmt.Errorf("interface %d remote preshared key: %w", interfaceID, err)
+	}
+	return &c, nil
+}
+
+func (r *sqlRemoteRepo) Save(ctx context.Context, c *models.ClientRemote) error {
+	psk, err := r.secrets.seal(c.PresharedKey)
+	if err != nil {
+		return fmt.Errorf("save interface remote: %w", err)
+	}
+	c.UpdatedAt = time.Now().UTC()
+	_, err = r.q.ExecContext(ctx, `
+		INSERT INTO interface_remotes
+		  (interface_id, public_key, preshared_key, endpoint, allowed_ips, persistent_keepalive, route_table, fwmark, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT(interface_id) DO UPDATE SET
+		  public_key = excluded.public_key, preshared_key = excluded.preshared_key,
+		  endpoint = excluded.endpoint, allowed_ips = excluded.allowed_ips,
+		  persistent_keepalive = excluded.persistent_keepalive,
+		  route_table = excluded.route_table, fwmark = excluded.fwmark, updated_at = excluded.updated_at`,
+		c.InterfaceID, c.PublicKey, psk, c.Endpoint, c.AllowedIPs, c.PersistentKeepalive, c.Table, c.FwMark, c.UpdatedAt,
+	)
+	if err != nil {
+		return wrapWriteErr("save interface remote", err)
+	}
+	return nil
+}
+
+func (r *sqlRemoteRepo) Delete(ctx context.Context, interfaceID int) error {
+	if _, err := r.q.ExecContext(ctx, `DELETE FROM interface_remotes WHERE interface_id = ?`, interfaceID); err != nil {
+		return fmt.Errorf("delete interface remote: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,46 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"backend/models"
+)
+
+type sqlRenderedConfigRepo struct {
+	q querier
+}
+
+func (r *sqlRenderedConfigRepo) Get(ctx context.Context, name string) (*models.RenderedConfig, error) {
+	var rc models.RenderedConfig
+	err := r.q.QueryRowContext(ctx,
+		`SELECT name, sha256, written_at FROM rendered_configs WHERE name = ?`, name,
+	).Scan(&rc.Name, &rc.SHA256, &rc.WrittenAt)
+	if err != nil {
+		return nil, wrapReadErr("get rendered config", err)
+	}
+	return &rc, nil
+}
+
+func (r *sqlRenderedConfigRepo) Upsert(ctx context.Context, rc *models.RenderedConfig) error {
+	if rc.WrittenAt.IsZero() {
+		rc.WrittenAt = time.Now()
+	}
+	_, err := r.q.ExecContext(ctx, `
+		INSERT INTO rendered_configs (name, sha256, written_at) VALUES (?, ?, ?)
+		ON CONFLICT(name) DO UPDATE SET sha256 = excluded.sha256, written_at = excluded.written_at`,
+		rc.Name, rc.SHA256, rc.WrittenAt,
+	)
+	if err != nil {
+		return fmt.Errorf("upsert rendered config: %w", err)
+	}
+	return nil
+}
+
+func (r *sqlRenderedConfigRepo) Delete(ctx context.Context, name string) error {
+	if _, err := r.q.ExecContext(ctx, `DELETE FROM rendered_configs WHERE name = ?`, name); err != nil {
+		return fmt.Errorf("delete rendered config: %w", err)
+	}
+	return nil
+}
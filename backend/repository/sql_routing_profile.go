@@ -0,0 +1,110 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+
+	"backend/models"
+)
+
+type sqlRoutingProfileRepo struct {
+	q querier
+}
+
+const routingProfileColumns = `
+	id, name, kind,
+	COALESCE(routes, '')      AS routes,
+	COALESCE(excluded, '')    AS excluded,
+	COALESCE(description, '') AS description,
+	created_at, updated_at`
+
+func scanRoutingProfile(r rowScanner) (*models.RoutingProfile, error) {
+	var rp models.RoutingProfile
+	if err := r.Scan(
+		&rp.ID, &rp.Name, &rp.Kind,
+		&rp.Routes, &rp.Excluded, &rp.Description,
+		&rp.CreatedAt, &rp.UpdatedAt,
+	); err != nil {
+		return nil, err
+	}
+	return &rp, nil
+}
+
+func (r *sqlRoutingProfileRepo) List(ctx context.Context) ([]models.RoutingProfile, error) {
+	rows, err := r.q.QueryContext(ctx, `SELECT `+routingProfileColumns+` FROM routing_profiles ORDER BY name`)
+	if err != nil {
+		return nil, fmt.Errorf("query routing profiles: %w", err)
+	}
+	defer rows.Close()
+
+	var list []models.RoutingProfile
+	for rows.Next() {
+		rp, err := scanRoutingProfile(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scan routing profile: %w", err)
+		}
+		list = append(list, *rp)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("query routing profiles: %w", err)
+	}
+	return list, nil
+}
+
+func (r *sqlRoutingProfileRepo) Get(ctx context.Context, id int) (*models.RoutingProfile, error) {
+	rp, err := scanRoutingProfile(r.q.QueryRowContext(ctx, `SELECT `+routingProfileColumns+` FROM routing_profiles WHERE id = ?`, id))
+	if err != nil {
+		return nil, wrapReadErr("get routing profile", err)
+	}
+	return rp, nil
+}
+
+func (r *sqlRoutingProfileRepo) GetByName(ctx context.Context, name string) (*models.RoutingProfile, error) {
+	rp, err := scanRoutingProfile(r.q.QueryRowContext(ctx, `SELECT `+routingProfileColumns+` FROM routing_profiles WHERE name = ?`, name))
+	if err != nil {
+		return nil, wrapReadErr("get routing profile by name", err)
+	}
+	return rp, nil
+}
+
+func (r *sqlRoutingProfileRepo) Create(ctx context.Context, rp *models.RoutingProfile) error {
+	res, err := r.q.ExecContext(ctx, `
+		INSERT INTO routing_profiles (name, kind, routes, excluded, description)
+		VALUES (?, ?, ?, ?, ?)`,
+		rp.Name, rp.Kind, rp.Routes, rp.Excluded, rp.Description,
+	)
+	if err != nil {
+		return wrapWriteErr("create routing profile", err)
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return fmt.Errorf("create routing profile: %w", err)
+	}
+	rp.ID = int(id)
+	return nil
+}
+
+func (r *sqlRoutingProfileRepo) Update(ctx context.Context, rp *models.RoutingProfile) error {
+	res, err := r.q.ExecContext(ctx, `
+		UPDATE routing_profiles
+		SET name = ?, kind = ?, routes = ?, excluded = ?, description = ?, updated_at = CURRENT_TIMESTAMP
+		WHERE id = ?`,
+		rp.Name, rp.Kind, rp.Routes, rp.Excluded, rp.Description, rp.ID,
+	)
+	if err != nil {
+		return wrapWriteErr("update routing profile", err)
+	}
+	return expectAffected("update routing profile", res)
+}
+
+func (r *sqlRoutingProfileRepo) Delete(ctx context.Context, id int) error {
+	// 显式解除引用（等价于 ON DELETE SET NULL），不依赖连接是否开启外键
+	if _, err := r.q.ExecContext(ctx, `UPDATE wireguard_peers SET routing_profile_id = NULL WHERE routing_profile_id = ?`, id); err != nil {
+		return fmt.Errorf("delete routing profile: %w", err)
+	}
+	res, err := r.q.ExecContext(ctx, `DELETE FROM routing_profiles WHERE id = ?`, id)
+	if err != nil {
+		return fmt.Errorf("delete routing profile: %w", err)
+	}
+	return expectAffected("delete routing profile", res)
+}
@@ -0,0 +1,110 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"backend/keystore"
+)
+
+var ErrNoCipher = errors.New("secret is encrypted but no master key is configured")
+
+// secretCodec 在读写敏感列时加解密；未配置 cipher 时按明文透传
+type secretCodec struct {
+	c SecretCipher
+}
+
+func (sc secretCodec) seal(v string) (string, error) {
+	if sc.c == nil || v == "" {
+		return v, nil
+	}
+	return sc.c.Encrypt(v)
+}
+
+func (sc secretCodec) open(v string) (string, error) {
+	if sc.c == nil {
+		if keystore.IsEncrypted(v) {
+			return "", ErrNoCipher
+		}
+		return v, nil
+	}
+	return sc.c.Decrypt(v)
+}
+
+// 需要加密存储的列
+var secretColumns = []struct{ table, column string }{
+	{"wireguard_interfaces", "private_key"},
+	{"wireguard_peers", "private_key"},
+	{"wireguard_peers", "preshared_key"},
+	{"interface_remotes", "preshared_key"},
+	{"mesh_members", "private_key"},
+	{"notifiers", "secret"},
+}
+
+// RewrapSecrets 把明文或旧主密钥加密的敏感列用当前主密钥重新加密，返回改写的行数。
+// force 为 true 时所有密文都换新的数据密钥重新加密（用于主动轮换）
+func (s *SQLStore) RewrapSecrets(ctx context.Context, force bool) (int, error) {
+	if s.secret == nil {
+		return 0, ErrNoCipher
+	}
+	total := 0
+	err := s.WithTx(ctx, func(tx Store) error {
+		q := tx.(*SQLStore).q
+		for _, sc := range secretColumns {
+			n, err := rewrapColumn(ctx, q, s.secret, sc.table, sc.column, force)
+			if err != nil {
+				return fmt.Errorf("rewrap %s.%s: %w", sc.table, sc.column, err)
+			}
+			total += n
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return total, nil
+}
+
+func rewrapColumn(ctx context.Context, q querier, c SecretCipher, table, column string, force bool) (int, error) {
+	rows, err := q.QueryContext(ctx,
+		fmt.Sprintf(`SELECT id, %s FROM %s WHERE %s IS NOT NULL AND %s <> ''`, column, table, column, column))
+	if err != nil {
+		return 0, err
+	}
+	type item struct {
+		id  int
+		val string
+	}
+	var items []item
+	for rows.Next() {
+		var it item
+		if err := rows.Scan(&it.id, &it.val); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		if force || c.NeedsRewrap(it.val) {
+			items = append(items, it)
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	for _, it := range items {
+		plain, err := c.Decrypt(it.val)
+		if err != nil {
+			return 0, fmt.Errorf("row %d: %w", it.id, err)
+		}
+		enc, err := c.Encrypt(plain)
+		if err != nil {
+			return 0, fmt.Errorf("row %d: %w", it.id, err)
+		}
+		if _, err := q.ExecContext(ctx,
+			fmt.Sprintf(`UPDATE %s SET %s = ? WHERE id = ?`, table, column), enc, it.id); err != nil {
+			return 0, fmt.Errorf("row %d: %w", it.id, err)
+		}
+	}
+	return len(items), nil
+}
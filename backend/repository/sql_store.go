@@ -0,0 +1,196 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// querier 同时由 *sql.DB 与 *sql.Tx 实现，仓储无需关心是否处于事务中
+type querier interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// SecretCipher 对私钥等敏感列做落库加密；由 keystore.Keyring 实现
+type SecretCipher interface {
+	Encrypt(plaintext string) (string, error)
+	Decrypt(value string) (string, error)
+	NeedsRewrap(value string) bool
+}
+
+// SQLStore 基于 database/sql 的 Store 实现
+type SQLStore struct {
+	db     *sql.DB // 事务内为 nil
+	q      querier
+	secret SecretCipher
+}
+
+func NewSQLStore(db *sql.DB) *SQLStore {
+	return &SQLStore{db: db, q: db}
+}
+
+// WithCipher 返回启用敏感列加密的 Store；c 为 nil 时按明文存储
+func (s *SQLStore) WithCipher(c SecretCipher) *SQLStore {
+	return &SQLStore{db: s.db, q: s.q, secret: c}
+}
+
+func (s *SQLStore) Interfaces() InterfaceRepository {
+	return &sqlInterfaceRepo{q: s.q, secrets: secretCodec{s.secret}}
+}
+func (s *SQLStore) Peers() PeerRepository {
+	return &sqlPeerRepo{db: s.db, q: s.q, secrets: secretCodec{s.secret}}
+}
+
+func (s *SQLStore) RenderedConfigs() RenderedConfigRepository {
+	return &sqlRenderedConfigRepo{q: s.q}
+}
+
+func (s *SQLStore) RoutingProfiles() RoutingProfileRepository {
+	return &sqlRoutingProfileRepo{q: s.q}
+}
+
+func (s *SQLStore) IPAM() IPAMRepository {
+	return &sqlIPAMRepo{q: s.q}
+}
+
+func (s *SQLStore) Gateways() GatewayRepository {
+	return &sqlGatewayRepo{q: s.q}
+}
+
+func (s *SQLStore) Remotes() RemoteRepository {
+	return &sqlRemoteRepo{q: s.q, secrets: secretCodec{s.secret}}
+}
+
+func (s *SQLStore) Meshes() MeshRepository {
+	return &sqlMeshRepo{q: s.q, secrets: secretCodec{s.secret}}
+}
+
+func (s *SQLStore) ACLs() ACLRepository {
+	return &sqlACLRepo{q: s.q}
+}
+
+func (s *SQLStore) PeerGroups() PeerGroupRepository {
+	return &sqlPeerGroupRepo{q: s.q}
+}
+
+func (s *SQLStore) Events() EventRepository {
+	return &sqlEventRepo{q: s.q}
+}
+
+func (s *SQLStore) PeerSessions() PeerSessionRepository {
+	return &sqlPeerSessionRepo{q: s.q}
+}
+
+func (s *SQLStore) Alerts() AlertRepository {
+	return &sqlAlertRepo{q: s.q}
+}
+
+func (s *SQLStore) Notifiers() NotifierRepository {
+	return &sqlNotifierRepo{q: s.q, secrets: secretCodec{s.secret}}
+}
+
+func (s *SQLStore) WithTx(ctx context.Context, fn func(tx Store) error) error {
+	// 已在事务内：直接复用，不嵌套
+	if s.db == nil {
+		return fn(s)
+	}
+	tx, err := s.db.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelSerializable})
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	if err := fn(&SQLStore{q: tx, secret: s.secret}); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+/* -------------------- 工具 -------------------- */
+
+// 空串写入 NULL
+func nullString(s string) sql.NullString {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return sql.NullString{}
+	}
+	return sql.NullString{String: s, Valid: true}
+}
+
+// nil 或 0 写入 NULL
+func nullInt(v *int) sql.NullInt64 {
+	if v == nil || *v == 0 {
+		return sql.NullInt64{}
+	}
+	return sql.NullInt64{Int64: int64(*v), Valid: true}
+}
+
+// splitIPs 拆分 peer 的 ip 列（双栈时逗号分隔）
+func splitIPs(s string) []string {
+	var out []string
+	for _, x := range strings.Split(s, ",") {
+		if x = strings.TrimSpace(x); x != "" {
+			out = append(out, x)
+		}
+	}
+	return out
+}
+
+func isUniqueError(err error) bool {
+	s := strings.ToLower(err.Error())
+	// SQLite
+	if strings.Contains(s, "unique constraint failed") {
+		return true
+	}
+	// MySQL
+	if strings.Contains(s, "error 1062") || strings.Contains(s, "duplicate entry") {
+		return true
+	}
+	// Postgres
+	if strings.Contains(s, "sqlstate 23505") || strings.Contains(s, "duplicate key value violates unique constraint") {
+		return true
+	}
+	return false
+}
+
+// isForeignKeyError 识别引用的父记录不存在（外键约束失败）
+func isForeignKeyError(err error) bool {
+	s := strings.ToLower(err.Error())
+	return strings.Contains(s, "foreign key constraint failed") || // SQLite
+		strings.Contains(s, "error 1452") || // MySQL
+		strings.Contains(s, "sqlstate 23503") // Postgres
+}
+
+// 统一包装写操作错误：唯一冲突映射为 ErrConflict，父记录缺失映射为 ErrNotFound
+func wrapWriteErr(op string, err error) error {
+	if isUniqueError(err) {
+		return fmt.Errorf("%s: %w (%v)", op, ErrConflict, err)
+	}
+	if isForeignKeyError(err) {
+		return fmt.Errorf("%s: %w (%v)", op, ErrNotFound, err)
+	}
+	return fmt.Errorf("%s: %w", op, err)
+}
+
+func wrapReadErr(op string, err error) error {
+	if errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("%s: %w", op, ErrNotFound)
+	}
+	return fmt.Errorf("%s: %w", op, err)
+}
+
+// 按影响行数判断记录是否存在
+func expectAffected(op string, res sql.Result) error {
+	n, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if n == 0 {
+		return fmt.Errorf("%s: %w", op, ErrNotFound)
+	}
+	return nil
+}
@@ -3,6 +3,7 @@ package routes
 import (
 	"backend/handlers"
 	"backend/middleware"
+	"backend/models"
 	"backend/services"
 	"backend/websocket"
 	"github.com/gin-gonic/gin"
@@ -14,12 +15,22 @@ func SetupRoutes(
 	router *gin.Engine,
 	authService *services.AuthService,
 	wgService *services.WireGuardService,
+	systemService *services.SystemService,
+	backupService *services.BackupService,
+	stateService *services.StateService,
+	importService *services.ImportService,
+	alertService *services.AlertService,
 	hub *websocket.Hub,
 ) {
 
 	// Handlers
 	authHandler := handlers.NewAuthHandler(authService)
 	wgHandler := handlers.NewWireGuardHandler(wgService)
+	systemHandler := handlers.NewSystemHandler(systemService)
+	backupHandler := handlers.NewBackupHandler(backupService)
+	stateHandler := handlers.NewStateHandler(stateService)
+	importHandler := handlers.NewImportHandler(importService)
+	alertHandler := handlers.NewAlertHandler(alertService)
 
 	// Public routes
 	api := router.Group("/api")
@@ -58,10 +69,31 @@ func SetupRoutes(
 				interfaces.GET("/:id", wgHandler.GetInterface)
 				interfaces.PUT("/:id", wgHandler.UpdateInterface)
 				interfaces.DELETE("/:id", wgHandler.DeleteInterface)
+				interfaces.POST("/:id/renumber", wgHandler.RenumberInterface)
 				interfaces.POST("/:id/start", wgHandler.StartInterface)
 				interfaces.POST("/:id/stop", wgHandler.StopInterface)
-				interfaces.GET("/:id/config", wgHandler.GetInterfaceConfig)
+				// 主机名 endpoint 立即重新解析（动态 DNS；后台也会定期执行）
+				interfaces.POST("/:id/endpoints/resolve", wgHandler.ResolveEndpoints)
+				// NAT / LAN 转发设置（nftables inet wg_manager 表；修改仅管理员）
+				interfaces.GET("/:id/gateway", wgHandler.GetGateway)
+				interfaces.PUT("/:id/gateway", middleware.RequireRole(models.RoleAdmin), wgHandler.UpdateGateway)
+				// peer 访问控制（编译进同一张 nftables 表；修改仅管理员）
+				interfaces.GET("/:id/acl", wgHandler.GetACLRules)
+				interfaces.POST("/:id/acl", middleware.RequireRole(models.RoleAdmin), wgHandler.CreateACLRule)
+				interfaces.PUT("/:id/acl/:rule", middleware.RequireRole(models.RoleAdmin), wgHandler.UpdateACLRule)
+				interfaces.DELETE("/:id/acl/:rule", middleware.RequireRole(models.RoleAdmin), wgHandler.DeleteACLRule)
+				// 客户端模式接口的远端（拨出到远程 WireGuard 服务端；修改仅管理员）
+				interfaces.GET("/:id/remote", wgHandler.GetClientRemote)
+				interfaces.PUT("/:id/remote", middleware.RequireRole(models.RoleAdmin), wgHandler.UpdateClientRemote)
+				interfaces.GET("/:id/remote/status", wgHandler.GetClientStatus)
+				// 服务端配置含接口私钥，仅管理员
+				interfaces.GET("/:id/config", middleware.RequireRole(models.RoleAdmin), wgHandler.GetInterfaceConfig)
 				interfaces.GET("/:id/status", wgHandler.GetInterfaceStatus)
+				// 事件含 PreUp/PostUp 等钩子命令的输出，可能带出敏感信息，仅管理员
+				interfaces.GET("/:id/events", middleware.RequireRole(models.RoleAdmin), wgHandler.GetInterfaceEvents)
+				// .conf 落盘状态（内容含私钥，仅管理员）
+				interfaces.GET("/:id/conf-file", middleware.RequireRole(models.RoleAdmin), wgHandler.GetConfFile)
+				interfaces.POST("/:id/conf-file", middleware.RequireRole(models.RoleAdmin), wgHandler.WriteConfFile)
 			}
 
 			// Peer routes
@@ -69,11 +101,118 @@ func SetupRoutes(
 			{
 				peers.GET("", wgHandler.GetPeers)
 				peers.POST("", wgHandler.CreatePeer)
+				peers.POST("/bulk", wgHandler.BulkCreatePeers)
+				// 在线率报告（?window=24h / 7d，?interface_id= 过滤）
+				peers.GET("/health", wgHandler.GetPeersHealth)
 				peers.GET("/:id", wgHandler.GetPeer)
 				peers.PUT("/:id", wgHandler.UpdatePeer)
 				peers.DELETE("/:id", wgHandler.DeletePeer)
 				peers.GET("/:id/config", wgHandler.GetPeerConfig)
+				peers.GET("/:id/acl-test", wgHandler.TestACL)
+				peers.GET("/:id/health", wgHandler.GetPeerHealth)
 			}
+
+			// peer 分组（标签）：成员管理与批量操作，也可作为 ACL 规则的源
+			groups := wg.Group("/groups")
+			{
+				groups.GET("", wgHandler.GetPeerGroups)
+				groups.POST("", wgHandler.CreatePeerGroup)
+				groups.GET("/:id", wgHandler.GetPeerGroup)
+				groups.PUT("/:id", wgHandler.UpdatePeerGroup)
+				groups.DELETE("/:id", wgHandler.DeletePeerGroup)
+				groups.GET("/:id/members", wgHandler.GetPeerGroupMembers)
+				groups.POST("/:id/members", wgHandler.AddPeerGroupMembers)
+				groups.PUT("/:id/members", wgHandler.ReplacePeerGroupMembers)
+				groups.DELETE("/:id/members/:peer", wgHandler.RemovePeerGroupMember)
+				groups.POST("/:id/bulk", wgHandler.BulkPeerGroup)
+			}
+
+			// 全互联 mesh：成员增删后所有成员的配置随之变化（revision 递增），逐个或打包下载
+			// （成员配置含私钥；下载与修改仅管理员）
+			meshes := wg.Group("/meshes")
+			{
+				meshes.GET("", wgHandler.GetMeshes)
+				meshes.POST("", middleware.RequireRole(models.RoleAdmin), wgHandler.CreateMesh)
+				meshes.GET("/:id", wgHandler.GetMesh)
+				meshes.PUT("/:id", middleware.RequireRole(models.RoleAdmin), wgHandler.UpdateMesh)
+				meshes.DELETE("/:id", middleware.RequireRole(models.RoleAdmin), wgHandler.DeleteMesh)
+				meshes.GET("/:id/configs", middleware.RequireRole(models.RoleAdmin), wgHandler.GetMeshConfigs)
+				meshes.GET("/:id/members", wgHandler.GetMeshMembers)
+				meshes.POST("/:id/members", middleware.RequireRole(models.RoleAdmin), wgHandler.CreateMeshMember)
+				meshes.PUT("/:id/members/:member", middleware.RequireRole(models.RoleAdmin), wgHandler.UpdateMeshMember)
+				meshes.DELETE("/:id/members/:member", middleware.RequireRole(models.RoleAdmin), wgHandler.DeleteMeshMember)
+				meshes.GET("/:id/members/:member/config", middleware.RequireRole(models.RoleAdmin), wgHandler.GetMeshMemberConfig)
+			}
+
+			// 客户端路由模板（全局 / 分流 / 排除局域网）
+			profiles := wg.Group("/routing-profiles")
+			{
+				profiles.GET("", wgHandler.GetRoutingProfiles)
+				profiles.POST("", wgHandler.CreateRoutingProfile)
+				profiles.GET("/:id", wgHandler.GetRoutingProfile)
+				profiles.PUT("/:id", wgHandler.UpdateRoutingProfile)
+				profiles.DELETE("/:id", wgHandler.DeleteRoutingProfile)
+			}
+
+			// 导入 wg-quick 配置（含私钥，仅管理员）
+			wg.POST("/import", middleware.RequireRole(models.RoleAdmin), importHandler.ImportConfig)
+		}
+
+		// IPAM routes：空闲网段建议 / 地址池 / 保留地址 / 隔离期（修改仅管理员）
+		protected.GET("/ipam/suggest", wgHandler.SuggestSubnet)
+		ipamGroup := protected.Group("/ipam/interfaces/:id")
+		{
+			ipamGroup.GET("", wgHandler.GetIPAMUsage)
+			ipamGroup.GET("/pools", wgHandler.GetIPPools)
+			ipamGroup.POST("/pools", middleware.RequireRole(models.RoleAdmin), wgHandler.CreateIPPool)
+			ipamGroup.PUT("/pools/:pool", middleware.RequireRole(models.RoleAdmin), wgHandler.UpdateIPPool)
+			ipamGroup.DELETE("/pools/:pool", middleware.RequireRole(models.RoleAdmin), wgHandler.DeleteIPPool)
+			ipamGroup.GET("/reservations", wgHandler.GetIPReservations)
+			ipamGroup.POST("/reservations", middleware.RequireRole(models.RoleAdmin), wgHandler.CreateIPReservation)
+			ipamGroup.DELETE("/reservations/:rid", middleware.RequireRole(models.RoleAdmin), wgHandler.DeleteIPReservation)
+			ipamGroup.DELETE("/quarantine/:ip", middleware.RequireRole(models.RoleAdmin), wgHandler.ReleaseQuarantinedIP)
+		}
+
+		// Declarative state routes
+		state := protected.Group("/state")
+		{
+			// 文档含接口 hook 命令，仅管理员
+			state.GET("/export", middleware.RequireRole(models.RoleAdmin), stateHandler.ExportState)
+			state.POST("/plan", stateHandler.PlanState)
+			state.POST("/apply", middleware.RequireRole(models.RoleAdmin), stateHandler.ApplyState)
+		}
+
+		// System routes
+		system := protected.Group("/system")
+		{
+			system.GET("/keys", systemHandler.GetKeyStatus)
+			system.POST("/keys/rotate", middleware.RequireRole(models.RoleAdmin), systemHandler.RotateKeys)
+			system.POST("/backup", middleware.RequireRole(models.RoleAdmin), backupHandler.CreateBackup)
+			system.GET("/backups", middleware.RequireRole(models.RoleAdmin), backupHandler.ListBackups)
+			system.POST("/restore", middleware.RequireRole(models.RoleAdmin), backupHandler.Restore)
+			system.GET("/firewall", wgHandler.GetFirewall)
+			system.POST("/firewall/sync", middleware.RequireRole(models.RoleAdmin), wgHandler.SyncFirewall)
+
+			// 告警：规则、历史与通知渠道
+			system.GET("/alerts", alertHandler.GetAlerts)
+			system.POST("/alerts/evaluate", middleware.RequireRole(models.RoleAdmin), alertHandler.EvaluateAlerts)
+			system.GET("/alert-rules", alertHandler.GetAlertRules)
+			system.GET("/alert-rules/:id", alertHandler.GetAlertRule)
+			system.POST("/alert-rules", middleware.RequireRole(models.RoleAdmin), alertHandler.CreateAlertRule)
+			system.PUT("/alert-rules/:id", middleware.RequireRole(models.RoleAdmin), alertHandler.UpdateAlertRule)
+			system.DELETE("/alert-rules/:id", middleware.RequireRole(models.RoleAdmin), alertHandler.DeleteAlertRule)
+			system.GET("/notifiers", middleware.RequireRole(models.RoleAdmin), alertHandler.GetNotifiers)
+			system.GET("/notifiers/:id", middleware.RequireRole(models.RoleAdmin), alertHandler.GetNotifier)
+			system.POST("/notifiers", middleware.RequireRole(models.RoleAdmin), alertHandler.CreateNotifier)
+			system.PUT("/notifiers/:id", middleware.RequireRole(models.RoleAdmin), alertHandler.UpdateNotifier)
+			system.DELETE("/notifiers/:id", middleware.RequireRole(models.RoleAdmin), alertHandler.DeleteNotifier)
+			system.POST("/notifiers/:id/test", middleware.RequireRole(models.RoleAdmin), alertHandler.TestNotifier)
+		}
+
+		// Tools routes（纯计算，不读写数据）
+		tools := protected.Group("/tools")
+		{
+			tools.POST("/cidr/subtract", wgHandler.SubtractCIDR)
 		}
 	}
 }
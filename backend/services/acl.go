@@ -0,0 +1,560 @@
+package services
+
+import (
+	"backend/cidrset"
+	"backend/models"
+	"backend/repository"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+/* -------------------- 规则校验 -------------------- */
+
+// portRange 是闭区间端口段
+type portRange struct{ Lo, Hi int }
+
+func (r portRange) String() string {
+	if r.Lo == r.Hi {
+		return strconv.Itoa(r.Lo)
+	}
+	return fmt.Sprintf("%d-%d", r.Lo, r.Hi)
+}
+
+// parsePorts 解析 "22, 80, 8000-8100"
+func parsePorts(s string) ([]portRange, error) {
+	var out []portRange
+	for _, item := range strings.Split(s, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		lo, hi, isRange := strings.Cut(item, "-")
+		a, err := strconv.Atoi(strings.TrimSpace(lo))
+		if err != nil {
+			return nil, fmt.Errorf("invalid port %q", item)
+		}
+		b := a
+		if isRange {
+			if b, err = strconv.Atoi(strings.TrimSpace(hi)); err != nil {
+				return nil, fmt.Errorf("invalid port range %q", item)
+			}
+		}
+		if a < 1 || b > 65535 || a > b {
+			return nil, fmt.Errorf("invalid port range %q", item)
+		}
+		out = append(out, portRange{a, b})
+	}
+	return out, nil
+}
+
+func joinPorts(ps []portRange) string {
+	s := make([]string, len(ps))
+	for i, p := range ps {
+		s[i] = p.String()
+	}
+	return strings.Join(s, ", ")
+}
+
+// aclMatch 是规则解析后的匹配条件
+type aclMatch struct {
+	dests []netip.Prefix
+	ports []portRange
+}
+
+func compileACL(r *models.ACLRule) (*aclMatch, error) {
+	dests, err := cidrset.Parse(r.Destinations)
+	if err != nil {
+		return nil, fmt.Errorf("%w: destinations: %v", ErrBadRequest, err)
+	}
+	ports, err := parsePorts(r.Ports)
+	if err != nil {
+		return nil, fmt.Errorf("%w: ports: %v", ErrBadRequest, err)
+	}
+	return &aclMatch{dests: dests, ports: ports}, nil
+}
+
+// normalizeACLRule 校验请求并规范化各字段；peer 必须属于该接口，peer 与分组二选一
+func (s *WireGuardService) normalizeACLRule(ctx context.Context, tx repository.Store, interfaceID int, req *models.ACLRuleRequest) (*models.ACLRule, error) {
+	r := &models.ACLRule{
+		InterfaceID: interfaceID,
+		Action:      strings.ToLower(strings.TrimSpace(req.Action)),
+		Protocol:    strings.ToLower(strings.TrimSpace(req.Protocol)),
+		Priority:    req.Priority,
+		Description: strings.TrimSpace(req.Description),
+	}
+	switch r.Action {
+	case "":
+		r.Action = models.ForwardAllow
+	case models.ForwardAllow, models.ForwardDeny:
+	default:
+		return nil, fmt.Errorf("%w: action must be %q or %q", ErrBadRequest, models.ForwardAllow, models.ForwardDeny)
+	}
+	switch r.Protocol {
+	case "":
+		r.Protocol = models.ProtoAny
+	case models.ProtoAny, models.ProtoTCP, models.ProtoUDP, models.ProtoICMP:
+	default:
+		return nil, fmt.Errorf("%w: protocol must be one of any, tcp, udp, icmp", ErrBadRequest)
+	}
+
+	dests, err := cidrset.Parse(req.Destinations)
+	if err != nil {
+		return nil, fmt.Errorf("%w: destinations: %v", ErrBadRequest, err)
+	}
+	r.Destinations = strings.Join(cidrset.Strings(dests), ", ")
+	ports, err := parsePorts(req.Ports)
+	if err != nil {
+		return nil, fmt.Errorf("%w: ports: %v", ErrBadRequest, err)
+	}
+	if len(ports) > 0 && r.Protocol != models.ProtoTCP && r.Protocol != models.ProtoUDP {
+		return nil, fmt.Errorf("%w: ports require protocol tcp or udp", ErrBadRequest)
+	}
+	r.Ports = joinPorts(ports)
+
+	if req.PeerID != nil && *req.PeerID != 0 {
+		p, err := tx.Peers().Get(ctx, *req.PeerID)
+		if err != nil {
+			return nil, mapRepoErr(err, "peer")
+		}
+		if p.InterfaceID != interfaceID {
+			return nil, fmt.Errorf("%w: peer %d does not belong to this interface", ErrBadRequest, p.ID)
+		}
+		id := p.ID
+		r.PeerID = &id
+	}
+	if req.GroupID != nil && *req.GroupID != 0 {
+		if r.PeerID != nil {
+			return nil, fmt.Errorf("%w: peer_id and group_id are mutually exclusive", ErrBadRequest)
+		}
+		g, err := tx.PeerGroups().Get(ctx, *req.GroupID)
+		if err != nil {
+			return nil, mapRepoErr(err, "peer group")
+		}
+		id := g.ID
+		r.GroupID = &id
+	}
+	return r, nil
+}
+
+// aclGroupMembers 返回规则引用到的分组的成员 peer ID
+func aclGroupMembers(ctx context.Context, store repository.Store, rules []models.ACLRule) (map[int][]int, error) {
+	out := map[int][]int{}
+	for _, r := range rules {
+		if r.GroupID == nil {
+			continue
+		}
+		if _, ok := out[*r.GroupID]; ok {
+			continue
+		}
+		ids, err := store.PeerGroups().Members(ctx, *r.GroupID)
+		if err != nil {
+			return nil, err
+		}
+		out[*r.GroupID] = ids
+	}
+	return out, nil
+}
+
+/* -------------------- CRUD -------------------- */
+
+func (s *WireGuardService) ListACLRules(ctx context.Context, interfaceID int) ([]models.ACLRule, error) {
+	if _, err := s.store.Interfaces().Get(ctx, interfaceID); err != nil {
+		return nil, mapRepoErr(err, "interface")
+	}
+	list, err := s.store.ACLs().List(ctx, interfaceID)
+	if err != nil {
+		return nil, err
+	}
+	if list == nil {
+		list = []models.ACLRule{}
+	}
+	return list, nil
+}
+
+// SaveACLRule 创建（ruleID 为 0）或覆盖规则；接口运行中时立即重建管理表
+func (s *WireGuardService) SaveACLRule(ctx context.Context, interfaceID, ruleID int, req *models.ACLRuleRequest) (*models.ACLRule, error) {
+	it, err := s.store.Interfaces().Get(ctx, interfaceID)
+	if err != nil {
+		return nil, mapRepoErr(err, "interface")
+	}
+	r, err := s.normalizeACLRule(ctx, s.store, interfaceID, req)
+	if err != nil {
+		return nil, err
+	}
+	if ruleID == 0 {
+		if err := s.store.ACLs().Create(ctx, r); err != nil {
+			return nil, mapRepoErr(err, "acl rule")
+		}
+	} else {
+		cur, err := s.store.ACLs().Get(ctx, ruleID)
+		if err != nil || cur.InterfaceID != interfaceID {
+			return nil, fmt.Errorf("%w: acl rule not found", ErrNotFound)
+		}
+		r.ID = ruleID
+		if err := s.store.ACLs().Update(ctx, r); err != nil {
+			return nil, mapRepoErr(err, "acl rule")
+		}
+	}
+	if err := s.syncRunning(ctx, it); err != nil {
+		return nil, fmt.Errorf("acl rule saved but firewall apply failed: %w", err)
+	}
+	return s.store.ACLs().Get(ctx, r.ID)
+}
+
+func (s *WireGuardService) DeleteACLRule(ctx context.Context, interfaceID, ruleID int) error {
+	it, err := s.store.Interfaces().Get(ctx, interfaceID)
+	if err != nil {
+		return mapRepoErr(err, "interface")
+	}
+	cur, err := s.store.ACLs().Get(ctx, ruleID)
+	if err != nil || cur.InterfaceID != interfaceID {
+		return fmt.Errorf("%w: acl rule not found", ErrNotFound)
+	}
+	if err := s.store.ACLs().Delete(ctx, ruleID); err != nil {
+		return mapRepoErr(err, "acl rule")
+	}
+	if err := s.syncRunning(ctx, it); err != nil {
+		return fmt.Errorf("acl rule deleted but firewall apply failed: %w", err)
+	}
+	return nil
+}
+
+/* -------------------- 编译为 nftables -------------------- */
+
+// nftProto 返回协议/端口匹配；fam 为空表示不限地址族
+func nftProto(proto, fam string, ports []portRange) string {
+	switch proto {
+	case models.ProtoTCP, models.ProtoUDP:
+		if len(ports) == 0 {
+			return "meta l4proto " + proto
+		}
+		if len(ports) == 1 {
+			return proto + " dport " + ports[0].String()
+		}
+		return proto + " dport { " + joinPorts(ports) + " }"
+	case models.ProtoICMP:
+		switch fam {
+		case "ip":
+			return "meta l4proto icmp"
+		case "ip6":
+			return "meta l4proto ipv6-icmp"
+		}
+		return "meta l4proto { icmp, ipv6-icmp }"
+	}
+	return ""
+}
+
+// renderACL 把接口的 ACL 编译为一条普通链（forward 中按入接口跳转）：
+// peer / 分组规则的源地址写成按规则命名的集合（键为 peer 隧道地址），allow 返回 forward 链继续走网关规则，deny 直接丢弃；
+// groups 为分组 ID 到成员 peer ID 的映射，只取属于本接口的成员
+func renderACL(plan *firewallPlan, it *models.WireGuardInterface, g *models.InterfaceGateway,
+	peers []models.WireGuardPeer, groups map[int][]int, rules []models.ACLRule) error {
+	if !ifaceNameRe.MatchString(it.Name) {
+		return fmt.Errorf("%w: invalid interface name %q", ErrBadRequest, it.Name)
+	}
+	byID := make(map[int]*models.WireGuardPeer, len(peers))
+	for i := range peers {
+		byID[peers[i].ID] = &peers[i]
+	}
+
+	chain := nftChain{Name: fmt.Sprintf("acl_if%d", it.ID)}
+	// 已建立连接的回程（如 LAN 主动访问 peer）不受 ACL 限制
+	chain.Rules = append(chain.Rules, "ct state established,related return")
+
+	for i := range rules {
+		r := &rules[i]
+		m, err := compileACL(r)
+		if err != nil {
+			return fmt.Errorf("acl rule %d: %w", r.ID, err)
+		}
+		verdict := "return"
+		if r.Action == models.ForwardDeny {
+			verdict = "drop"
+		}
+		comment := fmt.Sprintf(" comment \"acl %d\"", r.ID)
+
+		// 源：nil 表示接口下全部 peer；否则按地址族给出集合名
+		var srcSets map[string]string
+		if r.PeerID != nil || r.GroupID != nil {
+			var src []*models.WireGuardPeer
+			if r.PeerID != nil {
+				src = append(src, byID[*r.PeerID])
+			} else {
+				for _, id := range groups[*r.GroupID] {
+					src = append(src, byID[id])
+				}
+			}
+			srcSets = map[string]string{}
+			elems := map[string][]string{}
+			interval := map[string]bool{} // 含 site peer 的网段时集合需要 flags interval
+			for _, p := range src {
+				if p == nil {
+					continue // 不在本接口
+				}
+				for _, a := range peerAddrs(p.IP) {
+					fam := nftFamily(netip.PrefixFrom(a, a.BitLen()))
+					elems[fam] = append(elems[fam], a.String())
+				}
+				if p.Type == models.PeerTypeSite {
+					ps, _ := cidrset.Parse(p.RoutedSubnets)
+					for _, sn := range ps {
+						elems[nftFamily(sn)] = append(elems[nftFamily(sn)], sn.String())
+						interval[nftFamily(sn)] = true
+					}
+				}
+			}
+			for _, fam := range []string{"ip", "ip6"} {
+				if len(elems[fam]) == 0 {
+					continue
+				}
+				name, typ := fmt.Sprintf("acl_r%d_v4", r.ID), "ipv4_addr"
+				if fam == "ip6" {
+					name, typ = fmt.Sprintf("acl_r%d_v6", r.ID), "ipv6_addr"
+				}
+				flags := ""
+				if interval[fam] {
+					flags = "\t\tflags interval\n"
+				}
+				srcSets[fam] = name
+				plan.Sets = append(plan.Sets, fmt.Sprintf("\tset %s {\n\t\ttype %s\n%s\t\telements = { %s }\n\t}\n",
+					name, typ, flags, strings.Join(elems[fam], ", ")))
+			}
+			if len(srcSets) == 0 {
+				continue // peer 还没有隧道地址，或分组在本接口没有成员
+			}
+		}
+
+		dests := map[string][]netip.Prefix{}
+		for _, p := range m.dests {
+			dests[nftFamily(p)] = append(dests[nftFamily(p)], p)
+		}
+
+		emit := func(fam string) {
+			var parts []string
+			if set, ok := srcSets[fam]; ok {
+				parts = append(parts, fmt.Sprintf("%s saddr @%s", fam, set))
+			}
+			if ds := dests[fam]; len(ds) > 0 {
+				parts = append(parts, fmt.Sprintf("%s daddr %s", fam, nftSet(ds)))
+			}
+			if pm := nftProto(r.Protocol, fam, m.ports); pm != "" {
+				parts = append(parts, pm)
+			}
+			parts = append(parts, verdict+comment)
+			chain.Rules = append(chain.Rules, strings.Join(parts, " "))
+		}
+		switch {
+		case len(m.dests) == 0 && srcSets == nil:
+			emit("")
+		case len(m.dests) == 0:
+			for _, fam := range []string{"ip", "ip6"} {
+				if _, ok := srcSets[fam]; ok {
+					emit(fam)
+				}
+			}
+		default:
+			for _, fam := range []string{"ip", "ip6"} {
+				if len(dests[fam]) == 0 {
+					continue
+				}
+				if _, ok := srcSets[fam]; srcSets != nil && !ok {
+					continue
+				}
+				emit(fam)
+			}
+		}
+	}
+
+	if g != nil && g.ACLDefault == models.ForwardDeny {
+		chain.Rules = append(chain.Rules, "drop comment \"acl default\"")
+	}
+	plan.Chains = append(plan.Chains, chain)
+	plan.ACL = append(plan.ACL, fmt.Sprintf("iifname %q jump %s", it.Name, chain.Name))
+	return nil
+}
+
+/* -------------------- 可达性测试 -------------------- */
+
+// ACLDecision 是按当前 ACL 与网关设置推演的结果（不读取内核规则）
+type ACLDecision struct {
+	Allowed     bool   `json:"allowed"`
+	Peer        string `json:"peer"`
+	Source      string `json:"source,omitempty"` // 与目标同地址族的 peer 隧道地址
+	Destination string `json:"destination"`
+	Protocol    string `json:"protocol"`
+	Port        int    `json:"port,omitempty"`
+	RuleID      *int   `json:"rule_id,omitempty"` // 命中的 ACL 规则
+	Reason      string `json:"reason"`
+}
+
+// resolveTarget 解析 host 或 host:port；主机名解析后取 peer 有隧道地址的地址族
+func resolveTarget(ctx context.Context, target string, port int, has func(netip.Addr) bool) (netip.Addr, int, error) {
+	host := strings.TrimSpace(target)
+	if h, p, err := net.SplitHostPort(host); err == nil {
+		host = h
+		if port == 0 {
+			if port, err = strconv.Atoi(p); err != nil {
+				return netip.Addr{}, 0, fmt.Errorf("%w: invalid port %q", ErrBadRequest, p)
+			}
+		}
+	}
+	if host == "" {
+		return netip.Addr{}, 0, fmt.Errorf("%w: dst is required", ErrBadRequest)
+	}
+	if a, err := netip.ParseAddr(host); err == nil {
+		return a.Unmap(), port, nil
+	}
+	addrs, err := net.DefaultResolver.LookupNetIP(ctx, "ip", host)
+	if err != nil || len(addrs) == 0 {
+		return netip.Addr{}, 0, fmt.Errorf("%w: cannot resolve %q", ErrBadRequest, host)
+	}
+	for _, a := range addrs {
+		if has(a.Unmap()) {
+			return a.Unmap(), port, nil
+		}
+	}
+	return addrs[0].Unmap(), port, nil
+}
+
+// TestACL 回答"peer 能否访问 dst[:port]"：按 ACL 顺序找首个命中规则，再看网关的 LAN 转发策略
+func (s *WireGuardService) TestACL(ctx context.Context, peerID int, dst string, port int, proto string) (*ACLDecision, error) {
+	p, err := s.store.Peers().Get(ctx, peerID)
+	if err != nil {
+		return nil, mapRepoErr(err, "peer")
+	}
+	it, err := s.store.Interfaces().Get(ctx, p.InterfaceID)
+	if err != nil {
+		return nil, mapRepoErr(err, "interface")
+	}
+	proto = strings.ToLower(strings.TrimSpace(proto))
+	if proto == "" {
+		proto = models.ProtoTCP
+	}
+	if proto != models.ProtoTCP && proto != models.ProtoUDP && proto != models.ProtoICMP {
+		return nil, fmt.Errorf("%w: proto must be tcp, udp or icmp", ErrBadRequest)
+	}
+
+	srcs := peerAddrs(p.IP)
+	srcOf := func(a netip.Addr) (netip.Addr, bool) {
+		for _, s := range srcs {
+			if s.Is4() == a.Is4() {
+				return s, true
+			}
+		}
+		return netip.Addr{}, false
+	}
+	addr, port, err := resolveTarget(ctx, dst, port, func(a netip.Addr) bool { _, ok := srcOf(a); return ok })
+	if err != nil {
+		return nil, err
+	}
+	if port < 0 || port > 65535 {
+		return nil, fmt.Errorf("%w: invalid port %d", ErrBadRequest, port)
+	}
+
+	d := &ACLDecision{Peer: p.Name, Destination: addr.String(), Protocol: proto}
+	if proto != models.ProtoICMP {
+		d.Port = port
+	}
+	src, ok := srcOf(addr)
+	if !ok {
+		d.Reason = "peer has no tunnel address in the destination's address family"
+		return d, nil
+	}
+	d.Source = src.String()
+
+	var g *models.InterfaceGateway
+	switch gw, err := s.store.Gateways().Get(ctx, it.ID); {
+	case err == nil:
+		g = gw
+	case !errors.Is(err, repository.ErrNotFound):
+		return nil, err
+	}
+	rules, err := s.store.ACLs().List(ctx, it.ID)
+	if err != nil {
+		return nil, err
+	}
+	groups, err := aclGroupMembers(ctx, s.store, rules)
+	if err != nil {
+		return nil, err
+	}
+
+	// 1) ACL：首个命中的规则决定；deny 直接拒绝，allow 继续检查网关策略
+	matched := false
+	for i := range rules {
+		r := &rules[i]
+		if r.PeerID != nil && *r.PeerID != p.ID {
+			continue
+		}
+		if r.GroupID != nil && !slices.Contains(groups[*r.GroupID], p.ID) {
+			continue
+		}
+		m, err := compileACL(r)
+		if err != nil {
+			return nil, err
+		}
+		if len(m.dests) > 0 && !cidrset.ContainsAddr(m.dests, addr) {
+			continue
+		}
+		if r.Protocol != models.ProtoAny && r.Protocol != proto {
+			continue
+		}
+		if len(m.ports) > 0 && !portIn(m.ports, port) {
+			continue
+		}
+		id := r.ID
+		d.RuleID = &id
+		if r.Action == models.ForwardDeny {
+			d.Reason = fmt.Sprintf("denied by acl rule %d", r.ID)
+			return d, nil
+		}
+		matched = true
+		break
+	}
+	if !matched && g != nil && g.ACLDefault == models.ForwardDeny {
+		d.Reason = "no acl rule matched and the interface default is deny"
+		return d, nil
+	}
+
+	// 2) 网关：LAN 转发被拒绝时，目标在 LAN 网段（且不在本接口网段内）不可达
+	if g != nil && g.LANForward == models.ForwardDeny {
+		fams, err := parseInterfaceAddress(it.Address)
+		if err != nil {
+			return nil, err
+		}
+		lanSrc := g.LANCIDRs
+		if strings.TrimSpace(lanSrc) == "" {
+			lanSrc = defaultLANExcluded
+		}
+		lan, err := cidrset.Parse(lanSrc)
+		if err != nil {
+			return nil, err
+		}
+		if familyOf(fams, addr) < 0 && cidrset.ContainsAddr(lan, addr) {
+			d.Reason = "LAN forwarding is denied by the interface gateway settings"
+			return d, nil
+		}
+	}
+
+	d.Allowed = true
+	if matched {
+		d.Reason = fmt.Sprintf("allowed by acl rule %d", *d.RuleID)
+	} else {
+		d.Reason = "no acl rule matched and the interface default is allow"
+	}
+	return d, nil
+}
+
+func portIn(ps []portRange, port int) bool {
+	for _, r := range ps {
+		if port >= r.Lo && port <= r.Hi {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,188 @@
+package services
+
+import (
+	"backend/models"
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCompileACL(t *testing.T) {
+	tests := []struct {
+		name    string
+		rule    models.ACLRule
+		dests   []string
+		ports   string
+		wantErr bool
+	}{
+		{name: "empty matches everything", rule: models.ACLRule{}},
+		{
+			name:  "ports and destinations",
+			rule:  models.ACLRule{Destinations: "10.0.0.5/8, 192.168.1.1, fd00::/64", Ports: "22,80 , 8000-8100"},
+			dests: []string{"10.0.0.0/8", "192.168.1.1/32", "fd00::/64"},
+			ports: "22, 80, 8000-8100",
+		},
+		{name: "port zero", rule: models.ACLRule{Ports: "0"}, wantErr: true},
+		{name: "port too large", rule: models.ACLRule{Ports: "65536"}, wantErr: true},
+		{name: "reversed range", rule: models.ACLRule{Ports: "90-80"}, wantErr: true},
+		{name: "not a port", rule: models.ACLRule{Ports: "ssh"}, wantErr: true},
+		{name: "bad destination", rule: models.ACLRule{Destinations: "10.0.0.0/33"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, err := compileACL(&tt.rule)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				if !errors.Is(err, ErrBadRequest) {
+					t.Fatalf("err = %v, want ErrBadRequest", err)
+				}
+				return
+			}
+			var dests []string
+			for _, p := range m.dests {
+				dests = append(dests, p.String())
+			}
+			if !reflect.DeepEqual(dests, tt.dests) || joinPorts(m.ports) != tt.ports {
+				t.Fatalf("got dests %v ports %q", dests, joinPorts(m.ports))
+			}
+		})
+	}
+}
+
+// newACLFixture 建一个接口：alice 双栈，bob 仅 IPv4 且属于分组 ops；
+// 网关默认拒绝未命中的流量，并禁止转发到 192.168.0.0/16
+func newACLFixture(t *testing.T) (wg *WireGuardService, alice, bob int, rules []int) {
+	t.Helper()
+	ctx := context.Background()
+	wg = newTestService(t)
+	st := wg.store
+
+	it := &models.WireGuardInterface{Name: "wgacl0", Address: "10.30.0.1/24, fd30::1/64", ListenPort: 51840, Mode: "server"}
+	if err := st.Interfaces().Create(ctx, it); err != nil {
+		t.Fatal(err)
+	}
+	a := &models.WireGuardPeer{InterfaceID: it.ID, Name: "alice", IP: "10.30.0.2, fd30::2", PublicKey: "a"}
+	b := &models.WireGuardPeer{InterfaceID: it.ID, Name: "bob", IP: "10.30.0.3", PublicKey: "b"}
+	for _, p := range []*models.WireGuardPeer{a, b} {
+		if err := st.Peers().Create(ctx, p); err != nil {
+			t.Fatal(err)
+		}
+	}
+	g := &models.PeerGroup{Name: "ops"}
+	if err := st.PeerGroups().Create(ctx, g); err != nil {
+		t.Fatal(err)
+	}
+	if err := st.PeerGroups().SetMembers(ctx, g.ID, []int{b.ID}); err != nil {
+		t.Fatal(err)
+	}
+	if err := st.Gateways().Save(ctx, &models.InterfaceGateway{InterfaceID: it.ID, LANForward: models.ForwardDeny,
+		LANCIDRs: "192.168.0.0/16", ACLDefault: models.ForwardDeny}); err != nil {
+		t.Fatal(err)
+	}
+
+	reqs := []models.ACLRuleRequest{
+		{PeerID: &a.ID, Action: "deny", Protocol: "tcp", Ports: "22", Destinations: "192.168.1.0/24", Priority: 10},
+		{GroupID: &g.ID, Destinations: "192.168.1.0/24", Priority: 20},
+		{Protocol: "udp", Ports: "53, 5000-5010", Destinations: "10.0.0.0/8, fd00::/8", Priority: 30},
+	}
+	for i := range reqs {
+		r, err := wg.SaveACLRule(ctx, it.ID, 0, &reqs[i])
+		if err != nil {
+			t.Fatalf("save rule %d: %v", i, err)
+		}
+		rules = append(rules, r.ID)
+	}
+	return wg, a.ID, b.ID, rules
+}
+
+func TestTestACL(t *testing.T) {
+	wg, alice, bob, rules := newACLFixture(t)
+	tests := []struct {
+		name    string
+		peer    int
+		dst     string
+		port    int
+		proto   string
+		allowed bool
+		rule    int // 命中规则在 rules 中的下标，-1 表示未命中
+		reason  string
+	}{
+		{"peer rule denies", alice, "192.168.1.10", 22, "tcp", false, 0, "denied by acl rule"},
+		{"group rule skips non-members", alice, "192.168.1.10", 80, "tcp", false, -1, "interface default is deny"},
+		{"allowed rule still hits lan policy", bob, "192.168.1.10", 22, "", false, 1, "LAN forwarding is denied"},
+		{"port range", alice, "10.1.2.3", 5005, "udp", true, 2, "allowed by acl rule"},
+		{"port outside range", alice, "10.1.2.3", 5011, "udp", false, -1, "interface default is deny"},
+		{"protocol mismatch", alice, "10.1.2.3", 53, "tcp", false, -1, "interface default is deny"},
+		{"port taken from dst", alice, "10.1.2.3:53", 0, "udp", true, 2, "allowed by acl rule"},
+		{"ipv6 source", alice, "[fd00::1]:53", 0, "udp", true, 2, "allowed by acl rule"},
+		{"no address in family", bob, "fd00::1", 53, "udp", false, -1, "no tunnel address"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d, err := wg.TestACL(context.Background(), tt.peer, tt.dst, tt.port, tt.proto)
+			if err != nil {
+				t.Fatalf("TestACL: %v", err)
+			}
+			if d.Allowed != tt.allowed {
+				t.Errorf("allowed = %v, want %v (%s)", d.Allowed, tt.allowed, d.Reason)
+			}
+			switch {
+			case tt.rule < 0 && d.RuleID != nil:
+				t.Errorf("matched rule %d, want none", *d.RuleID)
+			case tt.rule >= 0 && (d.RuleID == nil || *d.RuleID != rules[tt.rule]):
+				t.Errorf("matched rule %v, want %d", d.RuleID, rules[tt.rule])
+			}
+			if !strings.Contains(d.Reason, tt.reason) {
+				t.Errorf("reason %q does not mention %q", d.Reason, tt.reason)
+			}
+		})
+	}
+
+	bad := []struct {
+		name  string
+		peer  int
+		dst   string
+		port  int
+		proto string
+		want  error
+	}{
+		{"unknown proto", alice, "10.1.2.3", 1, "sctp", ErrBadRequest},
+		{"empty dst", alice, "", 1, "tcp", ErrBadRequest},
+		{"port out of range", alice, "10.1.2.3", 70000, "tcp", ErrBadRequest},
+		{"unknown peer", 999, "10.1.2.3", 1, "tcp", ErrNotFound},
+	}
+	for _, tt := range bad {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := wg.TestACL(context.Background(), tt.peer, tt.dst, tt.port, tt.proto); !errors.Is(err, tt.want) {
+				t.Fatalf("got %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestSaveACLRuleValidation(t *testing.T) {
+	wg, alice, _, _ := newACLFixture(t)
+	ctx := context.Background()
+	p, _ := wg.store.Peers().Get(ctx, alice)
+	group := 1
+	tests := []struct {
+		name string
+		req  models.ACLRuleRequest
+	}{
+		{"ports without protocol", models.ACLRuleRequest{Ports: "22"}},
+		{"unknown action", models.ACLRuleRequest{Action: "drop"}},
+		{"unknown protocol", models.ACLRuleRequest{Protocol: "gre"}},
+		{"peer and group", models.ACLRuleRequest{PeerID: &alice, GroupID: &group}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := wg.SaveACLRule(ctx, p.InterfaceID, 0, &tt.req); !errors.Is(err, ErrBadRequest) {
+				t.Fatalf("got %v, want ErrBadRequest", err)
+			}
+		})
+	}
+}
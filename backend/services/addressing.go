@@ -0,0 +1,185 @@
+package services
+
+import (
+	"backend/cidrset"
+	"backend/models"
+	"fmt"
+	"net/netip"
+	"strings"
+)
+
+/* -------------------- 接口地址族（双栈） -------------------- */
+
+// addrFamily 是接口在某一地址族上的网段与服务端地址；
+// 接口 address 可写多个 CIDR（如 "10.8.0.1/24, fd00:8::1/64"），每个地址族至多一个
+type addrFamily struct {
+	Prefix netip.Prefix // 网段（已规整）：10.8.0.0/24
+	Server netip.Addr   // 服务端地址：10.8.0.1
+}
+
+// parseInterfaceAddress 解析接口 address；顺序即各处输出的顺序
+func parseInterfaceAddress(address string) ([]addrFamily, error) {
+	var fams []addrFamily
+	for _, x := range splitCSV(address) {
+		p, err := netip.ParsePrefix(x)
+		if err != nil {
+			return nil, fmt.Errorf("%w: invalid address %q, expect CIDR like 10.8.0.1/24", ErrBadRequest, x)
+		}
+		a := p.Addr().Unmap()
+		for _, f := range fams {
+			if f.Server.Is4() == a.Is4() {
+				return nil, fmt.Errorf("%w: address %q: only one CIDR per address family is supported", ErrBadRequest, x)
+			}
+		}
+		fams = append(fams, addrFamily{Prefix: netip.PrefixFrom(a, p.Bits()).Masked(), Server: a})
+	}
+	if len(fams) == 0 {
+		return nil, fmt.Errorf("%w: address is required", ErrBadRequest)
+	}
+	return fams, nil
+}
+
+// interfaceFamilies 取接口的地址族；address 为权威来源，cidr/server_ip 只是派生列
+func interfaceFamilies(it *models.WireGuardInterface) ([]addrFamily, error) {
+	fams, err := parseInterfaceAddress(it.Address)
+	if err != nil {
+		return nil, fmt.Errorf("interface %s: %w", it.Name, err)
+	}
+	return fams, nil
+}
+
+// 从 address（如 "10.8.0.1/24, fd00:8::1/64"）推导 cidr / server_ip（逗号分隔，顺序同 address）
+func deriveCIDR(address string) (cidr, serverIP string, err error) {
+	fams, err := parseInterfaceAddress(address)
+	if err != nil {
+		return "", "", err
+	}
+	cidrs := make([]string, len(fams))
+	ips := make([]string, len(fams))
+	for i, f := range fams {
+		cidrs[i], ips[i] = f.Prefix.String(), f.Server.String()
+	}
+	return strings.Join(cidrs, ", "), strings.Join(ips, ", "), nil
+}
+
+// 隧道 IP 对应的主机路由（/32 或 /128）；双栈 peer 的多个地址各生成一条
+func hostCIDR(ips string) string {
+	var out []string
+	for _, ip := range splitCSV(ips) {
+		if a, err := netip.ParseAddr(ip); err == nil {
+			out = append(out, netip.PrefixFrom(a.Unmap(), a.Unmap().BitLen()).String())
+		}
+	}
+	return strings.Join(out, ", ")
+}
+
+// familyOf 返回地址所属的接口地址族下标，不属于任何网段时返回 -1
+func familyOf(fams []addrFamily, a netip.Addr) int {
+	for i, f := range fams {
+		if f.Prefix.Contains(a) {
+			return i
+		}
+	}
+	return -1
+}
+
+/* -------------------- peer 地址 -------------------- */
+
+// peerAddrs 解析 peer 的 ip 列（逗号分隔），无法解析的项被忽略
+func peerAddrs(ips string) []netip.Addr {
+	var out []netip.Addr
+	for _, x := range splitCSV(ips) {
+		if a, err := netip.ParseAddr(x); err == nil {
+			out = append(out, a.Unmap())
+		}
+	}
+	return out
+}
+
+// usedAddrSet 构造已占用地址集合：接口自身地址 + 各 peer 地址
+func usedAddrSet(fams []addrFamily, ips []string) map[string]struct{} {
+	used := make(map[string]struct{}, len(ips)+len(fams))
+	for _, f := range fams {
+		used[f.Server.String()] = struct{}{}
+	}
+	for _, ip := range ips {
+		markUsed(used, ip)
+	}
+	return used
+}
+
+func markUsed(used map[string]struct{}, ips string) {
+	for _, a := range peerAddrs(ips) {
+		used[a.String()] = struct{}{}
+	}
+}
+
+func releaseUsed(used map[string]struct{}, ips string) {
+	for _, a := range peerAddrs(ips) {
+		delete(used, a.String())
+	}
+}
+
+// fitPeerIP 校验并规整 peer 地址：每个地址须落在接口某个地址族内、不是服务端地址，且每个地址族至多一个；
+// 返回按接口地址族排列的地址（缺失的地址族为无效 Addr）
+func fitPeerIP(fams []addrFamily, ips string) ([]netip.Addr, error) {
+	out := make([]netip.Addr, len(fams))
+	for _, x := range splitCSV(ips) {
+		a, err := netip.ParseAddr(x)
+		if err != nil {
+			return nil, fmt.Errorf("invalid ip %q", x)
+		}
+		a = a.Unmap()
+		i := familyOf(fams, a)
+		if i < 0 {
+			return nil, fmt.Errorf("ip %s is outside the interface subnets", a)
+		}
+		if a == fams[i].Server || a == fams[i].Prefix.Addr() ||
+			(a.Is4() && fams[i].Prefix.Bits() < 31 && a == cidrset.RangeOf(fams[i].Prefix).Last) {
+			return nil, fmt.Errorf("ip %s is reserved", a)
+		}
+		if out[i].IsValid() {
+			return nil, fmt.Errorf("more than one ip in %s", fams[i].Prefix)
+		}
+		out[i] = a
+	}
+	return out, nil
+}
+
+// fittingPeerIP 只保留 ips 中仍可用于接口的地址（每个地址族第一个），网段变化后尽量沿用旧地址
+func fittingPeerIP(fams []addrFamily, ips string) string {
+	var keep []string
+	for _, a := range peerAddrs(ips) {
+		if _, err := fitPeerIP(fams, strings.Join(append(keep, a.String()), ",")); err == nil {
+			keep = append(keep, a.String())
+		}
+	}
+	return strings.Join(keep, ", ")
+}
+
+// peerIPComplete 判断 peer 地址是否恰好覆盖接口的全部地址族
+func peerIPComplete(fams []addrFamily, ips string) bool {
+	have, err := fitPeerIP(fams, ips)
+	if err != nil {
+		return false
+	}
+	for _, a := range have {
+		if !a.IsValid() {
+			return false
+		}
+	}
+	return true
+}
+
+// peerInterfaceAddress 生成客户端 [Interface] Address：peer 地址配接口网段的前缀长度
+func peerInterfaceAddress(fams []addrFamily, ips string) []string {
+	var out []string
+	for _, a := range peerAddrs(ips) {
+		if i := familyOf(fams, a); i >= 0 {
+			out = append(out, netip.PrefixFrom(a, fams[i].Prefix.Bits()).String())
+		} else {
+			out = append(out, netip.PrefixFrom(a, a.BitLen()).String())
+		}
+	}
+	return out
+}
@@ -0,0 +1,836 @@
+package services
+
+import (
+	"backend/models"
+	"backend/repository"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+const (
+	defaultAlertInterval      = time.Minute
+	defaultQuotaThreshold     = 90 // 百分比
+	defaultDiskFreeThreshold  = 10 // 百分比
+	defaultFailedLoginLimit   = 5
+	defaultPeerOfflineAfter   = 30 * time.Minute
+	defaultFailedLoginWindow  = 15 * time.Minute
+	maxFailedLoginWindow      = 24 * time.Hour
+	defaultAlertHistoryLimit  = 100
+	maxAlertHistoryListLimit  = repository.MaxAlertHistory
+	alertNotifyErrorSeparator = "; "
+)
+
+// LoginFailureCounter 提供登录失败次数（AuthService 实现）
+type LoginFailureCounter interface {
+	FailedLogins(since time.Time) int
+}
+
+// AlertService 定时评估告警规则，对命中的对象去重、在条件消失后自动解决，并通过通知渠道投递
+type AlertService struct {
+	store   repository.Store
+	wg      *WireGuardService
+	logins  LoginFailureCounter // nil 时 failed_logins 规则报错
+	dataDir string              // disk_low 规则未指定 path 时检查的目录
+
+	mu sync.Mutex // 串行化评估
+}
+
+func NewAlertService(store repository.Store, wg *WireGuardService, logins LoginFailureCounter, dataDir string) *AlertService {
+	if dataDir == "" {
+		dataDir = "."
+	}
+	return &AlertService{store: store, wg: wg, logins: logins, dataDir: dataDir}
+}
+
+/* -------------------- 规则 -------------------- */
+
+func (a *AlertService) ListRules(ctx context.Context) ([]models.AlertRule, error) {
+	list, err := a.store.Alerts().ListRules(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if list == nil {
+		list = []models.AlertRule{}
+	}
+	return list, nil
+}
+
+func (a *AlertService) GetRule(ctx context.Context, id int) (*models.AlertRule, error) {
+	ar, err := a.store.Alerts().GetRule(ctx, id)
+	if err != nil {
+		return nil, mapRepoErr(err, "alert rule")
+	}
+	return ar, nil
+}
+
+func (a *AlertService) CreateRule(ctx context.Context, req models.AlertRuleRequest) (*models.AlertRule, error) {
+	ar := &models.AlertRule{Enabled: true}
+	if err := a.applyRule(ctx, ar, req); err != nil {
+		return nil, err
+	}
+	if err := a.store.Alerts().CreateRule(ctx, ar); err != nil {
+		return nil, mapRepoErr(err, "alert rule")
+	}
+	return a.GetRule(ctx, ar.ID)
+}
+
+func (a *AlertService) UpdateRule(ctx context.Context, id int, req models.AlertRuleRequest) (*models.AlertRule, error) {
+	ar, err := a.GetRule(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := a.applyRule(ctx, ar, req); err != nil {
+		return nil, err
+	}
+	if err := a.store.Alerts().UpdateRule(ctx, ar); err != nil {
+		return nil, mapRepoErr(err, "alert rule")
+	}
+	return a.GetRule(ctx, id)
+}
+
+// DeleteRule 删除规则；其进行中的告警在下次评估时解决（不再通知）
+func (a *AlertService) DeleteRule(ctx context.Context, id int) error {
+	if err := a.store.Alerts().DeleteRule(ctx, id); err != nil {
+		return mapRepoErr(err, "alert rule")
+	}
+	return nil
+}
+
+// applyRule 校验请求并写入规则；threshold / duration 缺省时按类型取默认值
+func (a *AlertService) applyRule(ctx context.Context, ar *models.AlertRule, req models.AlertRuleRequest) error {
+	ar.Name = strings.TrimSpace(req.Name)
+	if ar.Name == "" {
+		return fmt.Errorf("%w: name is required", ErrBadRequest)
+	}
+	typeChanged := ar.Type != req.Type
+	ar.Type = req.Type
+	if req.Enabled != nil {
+		ar.Enabled = *req.Enabled
+	}
+
+	ar.Severity = strings.TrimSpace(req.Severity)
+	switch ar.Severity {
+	case "":
+		ar.Severity = models.AlertSeverityWarning
+	case models.AlertSeverityInfo, models.AlertSeverityWarning, models.AlertSeverityCritical:
+	default:
+		return fmt.Errorf("%w: severity must be info, warning or critical", ErrBadRequest)
+	}
+
+	var defThreshold float64
+	var defDuration time.Duration
+	switch ar.Type {
+	case models.AlertInterfaceDown, models.AlertDrift:
+	case models.AlertPeerOffline:
+		defDuration = defaultPeerOfflineAfter
+	case models.AlertQuota:
+		defThreshold = defaultQuotaThreshold
+	case models.AlertDiskLow:
+		defThreshold = defaultDiskFreeThreshold
+	case models.AlertFailedLogins:
+		defThreshold, defDuration = defaultFailedLoginLimit, defaultFailedLoginWindow
+	default:
+		return fmt.Errorf("%w: unknown alert type %q", ErrBadRequest, ar.Type)
+	}
+
+	switch {
+	case req.Threshold != nil:
+		ar.Threshold = *req.Threshold
+	case typeChanged || ar.Threshold == 0:
+		ar.Threshold = defThreshold
+	}
+	if ar.Threshold < 0 || ((ar.Type == models.AlertQuota || ar.Type == models.AlertDiskLow) && ar.Threshold > 100) {
+		return fmt.Errorf("%w: threshold out of range", ErrBadRequest)
+	}
+
+	ar.Duration = strings.TrimSpace(req.Duration)
+	if defDuration == 0 {
+		ar.Duration = ""
+	} else if ar.Duration == "" {
+		ar.Duration = defDuration.String()
+	} else {
+		d, err := parseHealthWindow(ar.Duration)
+		if err != nil {
+			return err
+		}
+		if ar.Type == models.AlertFailedLogins && d > maxFailedLoginWindow {
+			return fmt.Errorf("%w: failed_logins duration must not exceed %s", ErrBadRequest, maxFailedLoginWindow)
+		}
+	}
+
+	ar.Path = ""
+	if ar.Type == models.AlertDiskLow {
+		ar.Path = strings.TrimSpace(req.Path)
+	}
+
+	ar.InterfaceID = nil
+	if req.InterfaceID != nil && *req.InterfaceID != 0 {
+		if ar.Type == models.AlertDiskLow || ar.Type == models.AlertFailedLogins {
+			return fmt.Errorf("%w: interface_id does not apply to %s rules", ErrBadRequest, ar.Type)
+		}
+		if _, err := a.wg.GetInterface(*req.InterfaceID); err != nil {
+			return err
+		}
+		id := *req.InterfaceID
+		ar.InterfaceID = &id
+	}
+
+	ar.NotifierIDs = []int{}
+	seen := map[int]bool{}
+	for _, id := range req.NotifierIDs {
+		if seen[id] {
+			continue
+		}
+		if _, err := a.GetNotifier(ctx, id); err != nil {
+			return err
+		}
+		seen[id] = true
+		ar.NotifierIDs = append(ar.NotifierIDs, id)
+	}
+	return nil
+}
+
+/* -------------------- 告警历史 -------------------- */
+
+// ListAlerts 按 id 倒序返回告警；limit 缺省 100
+func (a *AlertService) ListAlerts(ctx context.Context, f repository.AlertFilter) ([]models.Alert, error) {
+	switch f.Status {
+	case "", models.AlertStatusFiring, models.AlertStatusResolved:
+	default:
+		return nil, fmt.Errorf("%w: status must be firing or resolved", ErrBadRequest)
+	}
+	if f.Limit <= 0 {
+		f.Limit = defaultAlertHistoryLimit
+	}
+	if f.Limit > maxAlertHistoryListLimit {
+		f.Limit = maxAlertHistoryListLimit
+	}
+	list, err := a.store.Alerts().List(ctx, f)
+	if err != nil {
+		return nil, err
+	}
+	if list == nil {
+		list = []models.Alert{}
+	}
+	return list, nil
+}
+
+/* -------------------- 通知渠道 -------------------- */
+
+func (a *AlertService) ListNotifiers(ctx context.Context) ([]models.Notifier, error) {
+	list, err := a.store.Notifiers().List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if list == nil {
+		list = []models.Notifier{}
+	}
+	return list, nil
+}
+
+func (a *AlertService) GetNotifier(ctx context.Context, id int) (*models.Notifier, error) {
+	n, err := a.store.Notifiers().Get(ctx, id)
+	if err != nil {
+		return nil, mapRepoErr(err, "notifier")
+	}
+	return n, nil
+}
+
+func (a *AlertService) CreateNotifier(ctx context.Context, req models.NotifierRequest) (*models.Notifier, error) {
+	n := &models.Notifier{Enabled: true}
+	if err := applyNotifier(n, req); err != nil {
+		return nil, err
+	}
+	if err := a.store.Notifiers().Create(ctx, n); err != nil {
+		return nil, mapRepoErr(err, "notifier")
+	}
+	return a.GetNotifier(ctx, n.ID)
+}
+
+// UpdateNotifier 更新通知渠道；secret 为 nil 时保留原值
+func (a *AlertService) UpdateNotifier(ctx context.Context, id int, req models.NotifierRequest) (*models.Notifier, error) {
+	n, err := a.GetNotifier(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := applyNotifier(n, req); err != nil {
+		return nil, err
+	}
+	if err := a.store.Notifiers().Update(ctx, n); err != nil {
+		return nil, mapRepoErr(err, "notifier")
+	}
+	return a.GetNotifier(ctx, id)
+}
+
+// DeleteNotifier 删除通知渠道，并从引用它的规则中移除
+func (a *AlertService) DeleteNotifier(ctx context.Context, id int) error {
+	err := a.store.WithTx(ctx, func(tx repository.Store) error {
+		rules, err := tx.Alerts().ListRules(ctx)
+		if err != nil {
+			return err
+		}
+		for i := range rules {
+			ar := &rules[i]
+			kept := ar.NotifierIDs[:0]
+			for _, nid := range ar.NotifierIDs {
+				if nid != id {
+					kept = append(kept, nid)
+				}
+			}
+			if len(kept) == len(ar.NotifierIDs) {
+				continue
+			}
+			ar.NotifierIDs = kept
+			if err := tx.Alerts().UpdateRule(ctx, ar); err != nil {
+				return err
+			}
+		}
+		return tx.Notifiers().Delete(ctx, id)
+	})
+	if err != nil {
+		return mapRepoErr(err, "notifier")
+	}
+	return nil
+}
+
+func applyNotifier(n *models.Notifier, req models.NotifierRequest) error {
+	n.Name = strings.TrimSpace(req.Name)
+	if n.Name == "" {
+		return fmt.Errorf("%w: name is required", ErrBadRequest)
+	}
+	n.Type = req.Type
+	if req.Enabled != nil {
+		n.Enabled = *req.Enabled
+	}
+	n.Settings = map[string]string{}
+	for k, v := range req.Settings {
+		n.Settings[k] = strings.TrimSpace(v)
+	}
+	if req.Secret != nil {
+		n.Secret = *req.Secret
+	}
+	// 构造一次以校验配置
+	_, err := newNotifySender(n)
+	return err
+}
+
+// TestNotifier 向通知渠道发送一条测试消息（渠道停用时也发送）
+func (a *AlertService) TestNotifier(ctx context.Context, id int) error {
+	n, err := a.GetNotifier(ctx, id)
+	if err != nil {
+		return err
+	}
+	msg := AlertMessage{
+		Event:   NotifyTest,
+		Subject: "[TEST] WireGuard alert notifier " + n.Name,
+		Text:    fmt.Sprintf("This is a test message from notifier %q (%s), sent at %s.", n.Name, n.Type, time.Now().UTC().Format(time.RFC3339)),
+	}
+	if err := sendNotification(ctx, n, msg); err != nil {
+		return fmt.Errorf("%w: %v", ErrUpstream, err)
+	}
+	return nil
+}
+
+func sendNotification(ctx context.Context, n *models.Notifier, msg AlertMessage) error {
+	sender, err := newNotifySender(n)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(ctx, notifyTimeout)
+	defer cancel()
+	return sender.Send(ctx, msg)
+}
+
+/* -------------------- 评估 -------------------- */
+
+// AlertEvaluation 是一次评估的结果
+type AlertEvaluation struct {
+	Fired    int      `json:"fired"`    // 新触发
+	Resolved int      `json:"resolved"` // 本次解决
+	Firing   int      `json:"firing"`   // 评估后仍在进行中
+	Errors   []string `json:"errors"`   // 检查失败的规则（其告警保持原状）
+}
+
+// alertFinding 是规则检查命中的一个对象
+type alertFinding struct {
+	Key     string
+	Subject string
+	Message string
+}
+
+// RunSchedule 按间隔评估告警规则，直到 ctx 结束
+func (a *AlertService) RunSchedule(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		interval = defaultAlertInterval
+	}
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			res, err := a.Evaluate(ctx)
+			if err != nil {
+				log.Printf("[alert] evaluate: %v", err)
+				continue
+			}
+			for _, e := range res.Errors {
+				log.Printf("[alert] %s", e)
+			}
+		}
+	}
+}
+
+// Evaluate 检查所有启用的规则：新命中的对象创建告警并通知，仍命中的刷新 last_seen（之前投递失败的重试），
+// 不再命中的解决并通知；停用或已删除规则的告警直接解决。检查出错的规则保留其告警不动
+func (a *AlertService) Evaluate(ctx context.Context) (*AlertEvaluation, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	rules, err := a.store.Alerts().ListRules(ctx)
+	if err != nil {
+		return nil, err
+	}
+	firing, err := a.store.Alerts().List(ctx, repository.AlertFilter{Status: models.AlertStatusFiring})
+	if err != nil {
+		return nil, err
+	}
+	notifiers, err := a.store.Notifiers().List(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	open := map[int]map[string]*models.Alert{}
+	for i := range firing {
+		al := &firing[i]
+		if open[al.RuleID] == nil {
+			open[al.RuleID] = map[string]*models.Alert{}
+		}
+		open[al.RuleID][al.Key] = al
+	}
+
+	res := &AlertEvaluation{Errors: []string{}}
+	now := time.Now()
+	for i := range rules {
+		ar := &rules[i]
+		if !ar.Enabled {
+			continue
+		}
+		findings, err := a.check(ctx, ar, now)
+		if err != nil {
+			res.Errors = append(res.Errors, fmt.Sprintf("rule %q: %v", ar.Name, err))
+			res.Firing += len(open[ar.ID])
+			delete(open, ar.ID)
+			continue
+		}
+		targets := ruleNotifiers(ar, notifiers)
+		cur := open[ar.ID]
+		delete(open, ar.ID)
+
+		for _, f := range findings {
+			if al, ok := cur[f.Key]; ok {
+				delete(cur, f.Key)
+				al.Severity, al.Subject, al.Message, al.LastSeenAt = ar.Severity, f.Subject, f.Message, now
+				if al.NotifiedAt == nil {
+					a.deliver(ctx, targets, NotifyFiring, al, now)
+				}
+				if err := a.store.Alerts().Update(ctx, al); err != nil {
+					return nil, err
+				}
+				res.Firing++
+				continue
+			}
+			al := &models.Alert{
+				RuleID: ar.ID, RuleName: ar.Name, Type: ar.Type, Severity: ar.Severity,
+				Key: f.Key, Subject: f.Subject, Message: f.Message,
+				Status: models.AlertStatusFiring, StartedAt: now, LastSeenAt: now,
+			}
+			if err := a.store.Alerts().Create(ctx, al); err != nil {
+				return nil, err
+			}
+			if a.deliver(ctx, targets, NotifyFiring, al, now) {
+				if err := a.store.Alerts().Update(ctx, al); err != nil {
+					return nil, err
+				}
+			}
+			res.Fired++
+			res.Firing++
+		}
+
+		for _, al := range cur {
+			if err := a.resolve(ctx, al, targets, now); err != nil {
+				return nil, err
+			}
+			res.Resolved++
+		}
+	}
+
+	// 规则已停用或删除：不再通知
+	for _, cur := range open {
+		for _, al := range cur {
+			if err := a.resolve(ctx, al, nil, now); err != nil {
+				return nil, err
+			}
+			res.Resolved++
+		}
+	}
+	return res, nil
+}
+
+// resolve 解决告警；触发通知曾送达时再发送解决通知
+func (a *AlertService) resolve(ctx context.Context, al *models.Alert, targets []models.Notifier, now time.Time) error {
+	al.Status = models.AlertStatusResolved
+	al.ResolvedAt = &now
+	if al.NotifiedAt != nil {
+		a.deliver(ctx, targets, NotifyResolved, al, now)
+	}
+	return a.store.Alerts().Update(ctx, al)
+}
+
+// deliver 把告警发往各渠道；任一渠道送达即记录 notified_at，失败原因写入 notify_error。
+// 返回 al 是否被修改
+func (a *AlertService) deliver(ctx context.Context, targets []models.Notifier, event string, al *models.Alert, now time.Time) bool {
+	if len(targets) == 0 {
+		return false
+	}
+	msg := alertMessage(event, al)
+	var errs []string
+	delivered := false
+	for i := range targets {
+		n := &targets[i]
+		if err := sendNotification(ctx, n, msg); err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %v", n.Name, err))
+			continue
+		}
+		delivered = true
+	}
+	if delivered && event == NotifyFiring {
+		al.NotifiedAt = &now
+	}
+	al.NotifyError = strings.Join(errs, alertNotifyErrorSeparator)
+	return true
+}
+
+// ruleNotifiers 返回规则的通知目标：指定了渠道时取其中启用的，否则取全部启用的
+func ruleNotifiers(ar *models.AlertRule, all []models.Notifier) []models.Notifier {
+	want := map[int]bool{}
+	for _, id := range ar.NotifierIDs {
+		want[id] = true
+	}
+	var out []models.Notifier
+	for _, n := range all {
+		if n.Enabled && (len(want) == 0 || want[n.ID]) {
+			out = append(out, n)
+		}
+	}
+	return out
+}
+
+func alertMessage(event string, al *models.Alert) AlertMessage {
+	tag := strings.ToUpper(event)
+	text := fmt.Sprintf("%s\n\nRule: %s (%s)\nSeverity: %s\nStarted: %s",
+		al.Message, al.RuleName, al.Type, al.Severity, al.StartedAt.UTC().Format(time.RFC3339))
+	if al.ResolvedAt != nil {
+		text += "\nResolved: " + al.ResolvedAt.UTC().Format(time.RFC3339)
+	}
+	return AlertMessage{
+		Event:   event,
+		Subject: fmt.Sprintf("[%s] %s: %s", tag, al.RuleName, al.Subject),
+		Text:    text,
+		Alert:   al,
+	}
+}
+
+/* -------------------- 规则检查 -------------------- */
+
+func (a *AlertService) check(ctx context.Context, ar *models.AlertRule, now time.Time) ([]alertFinding, error) {
+	switch ar.Type {
+	case models.AlertInterfaceDown:
+		return a.checkInterfaceDown(ctx, ar)
+	case models.AlertPeerOffline:
+		return a.checkPeerOffline(ctx, ar, now)
+	case models.AlertQuota:
+		return a.checkQuota(ctx, ar)
+	case models.AlertDrift:
+		return a.checkDrift(ctx, ar)
+	case models.AlertDiskLow:
+		return a.checkDiskLow(ar)
+	case models.AlertFailedLogins:
+		return a.checkFailedLogins(ar, now)
+	}
+	return nil, fmt.Errorf("unknown alert type %q", ar.Type)
+}
+
+// ruleInterfaces 返回规则涉及的接口；running 为 true 时只取数据库中标记为运行的
+func (a *AlertService) ruleInterfaces(ctx context.Context, ar *models.AlertRule, running bool) ([]models.WireGuardInterface, error) {
+	list, err := a.store.Interfaces().List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	out := list[:0]
+	for _, it := range list {
+		if ar.InterfaceID != nil && it.ID != *ar.InterfaceID {
+			continue
+		}
+		if running && it.Status != "running" {
+			continue
+		}
+		out = append(out, it)
+	}
+	return out, nil
+}
+
+func (a *AlertService) checkInterfaceDown(ctx context.Context, ar *models.AlertRule) ([]alertFinding, error) {
+	ifaces, err := a.ruleInterfaces(ctx, ar, true)
+	if err != nil {
+		return nil, err
+	}
+	c, err := a.wg.wgClient()
+	if err != nil {
+		return nil, err
+	}
+	var out []alertFinding
+	for _, it := range ifaces {
+		var problem string
+		if link, err := net.InterfaceByName(it.Name); err != nil {
+			problem = "link does not exist"
+		} else if link.Flags&net.FlagUp == 0 {
+			problem = "link is down"
+		} else if _, err := c.Device(it.Name); err != nil {
+			problem = "WireGuard device not found"
+		}
+		if problem != "" {
+			out = append(out, alertFinding{
+				Key:     fmt.Sprintf("interface:%d", it.ID),
+				Subject: "interface " + it.Name + " is down",
+				Message: fmt.Sprintf("Interface %s should be running but %s.", it.Name, problem),
+			})
+		}
+	}
+	return out, nil
+}
+
+func (a *AlertService) checkPeerOffline(ctx context.Context, ar *models.AlertRule, now time.Time) ([]alertFinding, error) {
+	after, err := parseHealthWindow(ar.Duration)
+	if err != nil {
+		return nil, err
+	}
+	ifaces, err := a.ruleInterfaces(ctx, ar, true)
+	if err != nil {
+		return nil, err
+	}
+	running := map[int]bool{}
+	for _, it := range ifaces {
+		running[it.ID] = true
+	}
+	// GetPeers 叠加了内核中的最新握手
+	peers, err := a.wg.GetPeers()
+	if err != nil {
+		return nil, err
+	}
+	var out []alertFinding
+	for _, p := range peers {
+		if p.Disabled || !running[p.InterfaceID] {
+			continue
+		}
+		ref, seen := p.CreatedAt, "never connected"
+		if p.LastHandshake != nil {
+			ref = *p.LastHandshake
+			seen = "last handshake " + ref.UTC().Format(time.RFC3339)
+		}
+		if now.Sub(ref) <= after {
+			continue
+		}
+		out = append(out, alertFinding{
+			Key:     fmt.Sprintf("peer:%d", p.ID),
+			Subject: fmt.Sprintf("peer %s on %s is offline", p.Name, p.InterfaceName),
+			Message: fmt.Sprintf("Peer %s on %s has been offline for more than %s (%s).", p.Name, p.InterfaceName, formatDays(after), seen),
+		})
+	}
+	return out, nil
+}
+
+// checkQuota 检查接口网段与地址池的地址使用率
+func (a *AlertService) checkQuota(ctx context.Context, ar *models.AlertRule) ([]alertFinding, error) {
+	ifaces, err := a.ruleInterfaces(ctx, ar, false)
+	if err != nil {
+		return nil, err
+	}
+	var out []alertFinding
+	for _, it := range ifaces {
+		if it.Mode == models.InterfaceModeClient {
+			continue
+		}
+		u, err := a.wg.GetIPAMUsage(ctx, it.ID)
+		if err != nil {
+			return nil, fmt.Errorf("interface %s: %w", it.Name, err)
+		}
+		for _, f := range u.Families {
+			if f.Utilization >= ar.Threshold {
+				out = append(out, alertFinding{
+					Key:     fmt.Sprintf("interface:%d:%s", it.ID, f.CIDR),
+					Subject: fmt.Sprintf("%s address space %.1f%% used", it.Name, f.Utilization),
+					Message: fmt.Sprintf("Network %s of interface %s is %.1f%% used (threshold %g%%, %s addresses free).", f.CIDR, it.Name, f.Utilization, ar.Threshold, f.Free),
+				})
+			}
+		}
+		for _, p := range u.Pools {
+			if p.Utilization >= ar.Threshold {
+				out = append(out, alertFinding{
+					Key:     fmt.Sprintf("pool:%d", p.ID),
+					Subject: fmt.Sprintf("pool %s on %s %.1f%% used", p.Name, it.Name, p.Utilization),
+					Message: fmt.Sprintf("IP pool %s (%s) of interface %s is %.1f%% used (threshold %g%%, %s addresses free).", p.Name, p.Ranges, it.Name, p.Utilization, ar.Threshold, p.Free),
+				})
+			}
+		}
+	}
+	return out, nil
+}
+
+// checkDrift 对比内核中的 WireGuard 设备（监听端口、peer 公钥）与数据库；启用 .conf 落盘时同时检查文件是否被改动
+func (a *AlertService) checkDrift(ctx context.Context, ar *models.AlertRule) ([]alertFinding, error) {
+	ifaces, err := a.ruleInterfaces(ctx, ar, true)
+	if err != nil {
+		return nil, err
+	}
+	c, err := a.wg.wgClient()
+	if err != nil {
+		return nil, err
+	}
+	var out []alertFinding
+	for _, it := range ifaces {
+		var problems []string
+		if dev, err := c.Device(it.Name); err == nil { // 设备不存在由 interface_down 规则报告
+			if it.ListenPort > 0 && dev.ListenPort != it.ListenPort {
+				problems = append(problems, fmt.Sprintf("listen port is %d, expected %d", dev.ListenPort, it.ListenPort))
+			}
+			want, err := a.expectedPeerKeys(ctx, &it)
+			if err != nil {
+				return nil, fmt.Errorf("interface %s: %w", it.Name, err)
+			}
+			var unexpected int
+			for _, p := range dev.Peers {
+				k := p.PublicKey.String()
+				if want[k] {
+					delete(want, k)
+				} else {
+					unexpected++
+				}
+			}
+			if len(want) > 0 {
+				problems = append(problems, fmt.Sprintf("%d peer(s) missing from kernel", len(want)))
+			}
+			if unexpected > 0 {
+				problems = append(problems, fmt.Sprintf("%d unknown peer(s) in kernel", unexpected))
+			}
+		}
+		if a.wg.conf != nil {
+			st, err := a.wg.ConfFileStatus(it.ID)
+			if err != nil {
+				return nil, fmt.Errorf("interface %s: %w", it.Name, err)
+			}
+			switch {
+			case st.HandEdited:
+				problems = append(problems, st.Path+" was edited by hand")
+			case st.Managed && !st.InSync:
+				problems = append(problems, st.Path+" is out of date")
+			}
+		}
+		if len(problems) > 0 {
+			out = append(out, alertFinding{
+				Key:     fmt.Sprintf("interface:%d", it.ID),
+				Subject: "configuration drift on " + it.Name,
+				Message: fmt.Sprintf("Interface %s differs from the database: %s.", it.Name, strings.Join(problems, "; ")),
+			})
+		}
+	}
+	return out, nil
+}
+
+// expectedPeerKeys 返回应在内核中出现的 peer 公钥：服务端为启用的 peer，客户端为远端服务端
+func (a *AlertService) expectedPeerKeys(ctx context.Context, it *models.WireGuardInterface) (map[string]bool, error) {
+	want := map[string]bool{}
+	if it.Mode == models.InterfaceModeClient {
+		r, err := a.store.Remotes().Get(ctx, it.ID)
+		if err != nil {
+			if errors.Is(err, repository.ErrNotFound) {
+				return want, nil
+			}
+			return nil, err
+		}
+		want[r.PublicKey] = true
+		return want, nil
+	}
+	peers, err := a.store.Peers().ListByInterface(ctx, it.ID)
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range peers {
+		if !p.Disabled {
+			want[p.PublicKey] = true
+		}
+	}
+	return want, nil
+}
+
+func (a *AlertService) checkDiskLow(ar *models.AlertRule) ([]alertFinding, error) {
+	path := ar.Path
+	if path == "" {
+		path = a.dataDir
+	}
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(path, &st); err != nil {
+		return nil, fmt.Errorf("statfs %s: %w", path, err)
+	}
+	if st.Blocks == 0 {
+		return nil, nil
+	}
+	free := float64(st.Bavail) / float64(st.Blocks) * 100
+	if free >= ar.Threshold {
+		return nil, nil
+	}
+	return []alertFinding{{
+		Key:     "path:" + path,
+		Subject: fmt.Sprintf("disk space low on %s (%.1f%% free)", path, free),
+		Message: fmt.Sprintf("Filesystem holding %s has %.1f%% free (%s available), below the %g%% threshold.",
+			path, free, formatBytes(st.Bavail*uint64(st.Bsize)), ar.Threshold),
+	}}, nil
+}
+
+func (a *AlertService) checkFailedLogins(ar *models.AlertRule, now time.Time) ([]alertFinding, error) {
+	if a.logins == nil {
+		return nil, fmt.Errorf("login tracking is not available")
+	}
+	window, err := parseHealthWindow(ar.Duration)
+	if err != nil {
+		return nil, err
+	}
+	n := a.logins.FailedLogins(now.Add(-window))
+	if float64(n) <= ar.Threshold {
+		return nil, nil
+	}
+	return []alertFinding{{
+		Key:     "logins",
+		Subject: fmt.Sprintf("%d failed logins in %s", n, formatDays(window)),
+		Message: fmt.Sprintf("%d failed login attempts in the last %s (threshold %g).", n, formatDays(window), ar.Threshold),
+	}}, nil
+}
+
+func formatBytes(n uint64) string {
+	units := []string{"B", "KiB", "MiB", "GiB", "TiB"}
+	v := float64(n)
+	i := 0
+	for v >= 1024 && i < len(units)-1 {
+		v /= 1024
+		i++
+	}
+	return fmt.Sprintf("%.1f %s", v, units[i])
+}
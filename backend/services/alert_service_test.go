@@ -0,0 +1,279 @@
+package services
+
+import (
+	"backend/models"
+	"backend/repository"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeLogins 是可调的登录失败计数
+type fakeLogins struct {
+	mu sync.Mutex
+	n  int
+}
+
+func (f *fakeLogins) FailedLogins(time.Time) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.n
+}
+
+func (f *fakeLogins) set(n int) {
+	f.mu.Lock()
+	f.n = n
+	f.mu.Unlock()
+}
+
+func newTestAlertService(t *testing.T, logins LoginFailureCounter) *AlertService {
+	t.Helper()
+	wg := newTestService(t)
+	return NewAlertService(wg.store, wg, logins, t.TempDir())
+}
+
+func ptr[T any](v T) *T { return &v }
+
+func TestAlertRuleValidation(t *testing.T) {
+	ctx := context.Background()
+	a := newTestAlertService(t, nil)
+	hook, err := a.CreateNotifier(ctx, models.NotifierRequest{Name: "hook", Type: models.NotifierWebhook,
+		Settings: map[string]string{"url": "http://127.0.0.1:1/hook"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		req     models.AlertRuleRequest
+		want    models.AlertRule // 只比较 Severity / Threshold / Duration / NotifierIDs
+		wantErr error
+	}{
+		{
+			name: "quota defaults",
+			req:  models.AlertRuleRequest{Name: "q", Type: models.AlertQuota},
+			want: models.AlertRule{Severity: models.AlertSeverityWarning, Threshold: defaultQuotaThreshold, NotifierIDs: []int{}},
+		},
+		{
+			name: "failed logins defaults",
+			req:  models.AlertRuleRequest{Name: "l", Type: models.AlertFailedLogins, Severity: models.AlertSeverityCritical},
+			want: models.AlertRule{Severity: models.AlertSeverityCritical, Threshold: defaultFailedLoginLimit, Duration: "15m0s", NotifierIDs: []int{}},
+		},
+		{
+			name: "peer offline with notifiers",
+			req:  models.AlertRuleRequest{Name: "p", Type: models.AlertPeerOffline, Duration: "2h", NotifierIDs: []int{hook.ID, hook.ID}},
+			want: models.AlertRule{Severity: models.AlertSeverityWarning, Duration: "2h", NotifierIDs: []int{hook.ID}},
+		},
+		{
+			name: "duration dropped for drift",
+			req:  models.AlertRuleRequest{Name: "d", Type: models.AlertDrift, Duration: "5m"},
+			want: models.AlertRule{Severity: models.AlertSeverityWarning, NotifierIDs: []int{}},
+		},
+		{name: "missing name", req: models.AlertRuleRequest{Name: " ", Type: models.AlertQuota}, wantErr: ErrBadRequest},
+		{name: "unknown type", req: models.AlertRuleRequest{Name: "x", Type: "cpu"}, wantErr: ErrBadRequest},
+		{name: "bad severity", req: models.AlertRuleRequest{Name: "x", Type: models.AlertQuota, Severity: "page"}, wantErr: ErrBadRequest},
+		{name: "percent over 100", req: models.AlertRuleRequest{Name: "x", Type: models.AlertDiskLow, Threshold: ptr(120.0)}, wantErr: ErrBadRequest},
+		{name: "negative threshold", req: models.AlertRuleRequest{Name: "x", Type: models.AlertFailedLogins, Threshold: ptr(-1.0)}, wantErr: ErrBadRequest},
+		{name: "bad duration", req: models.AlertRuleRequest{Name: "x", Type: models.AlertPeerOffline, Duration: "soon"}, wantErr: ErrBadRequest},
+		{name: "login window too long", req: models.AlertRuleRequest{Name: "x", Type: models.AlertFailedLogins, Duration: "48h"}, wantErr: ErrBadRequest},
+		{name: "interface on disk rule", req: models.AlertRuleRequest{Name: "x", Type: models.AlertDiskLow, InterfaceID: ptr(1)}, wantErr: ErrBadRequest},
+		{name: "missing interface", req: models.AlertRuleRequest{Name: "x", Type: models.AlertQuota, InterfaceID: ptr(99)}, wantErr: ErrNotFound},
+		{name: "missing notifier", req: models.AlertRuleRequest{Name: "x", Type: models.AlertQuota, NotifierIDs: []int{99}}, wantErr: ErrNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ar, err := a.CreateRule(ctx, tt.req)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("err = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := models.AlertRule{Severity: ar.Severity, Threshold: ar.Threshold, Duration: ar.Duration, NotifierIDs: ar.NotifierIDs}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("rule = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestEvaluateLifecycle 按步骤驱动一条 failed_logins 规则：触发、去重、投递失败后重试、解决
+func TestEvaluateLifecycle(t *testing.T) {
+	ctx := context.Background()
+	logins := &fakeLogins{}
+	a := newTestAlertService(t, logins)
+	rec, srv := newHookServer(t)
+
+	n, err := a.CreateNotifier(ctx, models.NotifierRequest{Name: "hook", Type: models.NotifierWebhook,
+		Settings: map[string]string{"url": srv.URL}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := a.CreateRule(ctx, models.AlertRuleRequest{Name: "logins", Type: models.AlertFailedLogins,
+		Threshold: ptr(3.0), NotifierIDs: []int{n.ID}}); err != nil {
+		t.Fatal(err)
+	}
+
+	steps := []struct {
+		name       string
+		failures   int
+		hookStatus int
+		want       AlertEvaluation
+		wantEvents []string // 本步累计收到的通知
+		notified   bool     // 进行中（或最近解决）的告警是否记录了送达
+		notifyErr  bool
+	}{
+		{name: "below threshold", failures: 3, want: AlertEvaluation{}},
+		{name: "fires but delivery fails", failures: 4, hookStatus: http.StatusServiceUnavailable,
+			want: AlertEvaluation{Fired: 1, Firing: 1}, wantEvents: []string{NotifyFiring}, notifyErr: true},
+		{name: "retried while firing", failures: 5,
+			want: AlertEvaluation{Firing: 1}, wantEvents: []string{NotifyFiring, NotifyFiring}, notified: true},
+		{name: "deduplicated", failures: 6,
+			want: AlertEvaluation{Firing: 1}, wantEvents: []string{NotifyFiring, NotifyFiring}, notified: true},
+		{name: "resolves", failures: 0,
+			want: AlertEvaluation{Resolved: 1}, wantEvents: []string{NotifyFiring, NotifyFiring, NotifyResolved}, notified: true},
+		{name: "stays quiet", failures: 0,
+			want: AlertEvaluation{}, wantEvents: []string{NotifyFiring, NotifyFiring, NotifyResolved}, notified: true},
+	}
+	for _, st := range steps {
+		logins.set(st.failures)
+		rec.setStatus(st.hookStatus)
+		res, err := a.Evaluate(ctx)
+		if err != nil {
+			t.Fatalf("%s: %v", st.name, err)
+		}
+		st.want.Errors = []string{}
+		if !reflect.DeepEqual(*res, st.want) {
+			t.Errorf("%s: result = %+v, want %+v", st.name, *res, st.want)
+		}
+		if got := rec.events(); !reflect.DeepEqual(got, st.wantEvents) {
+			t.Errorf("%s: events = %v, want %v", st.name, got, st.wantEvents)
+		}
+		alerts, err := a.ListAlerts(ctx, repository.AlertFilter{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(st.wantEvents) == 0 {
+			if len(alerts) != 0 {
+				t.Errorf("%s: unexpected alerts %+v", st.name, alerts)
+			}
+			continue
+		}
+		if len(alerts) != 1 {
+			t.Fatalf("%s: got %d alerts, want 1", st.name, len(alerts))
+		}
+		al := alerts[0]
+		if (al.NotifiedAt != nil) != st.notified || (al.NotifyError != "") != st.notifyErr {
+			t.Errorf("%s: notified_at = %v, notify_error = %q", st.name, al.NotifiedAt, al.NotifyError)
+		}
+		if al.Key != "logins" || al.Severity != models.AlertSeverityWarning {
+			t.Errorf("%s: alert = %+v", st.name, al)
+		}
+	}
+}
+
+// TestEvaluateQuota 检查地址使用率规则，以及停用规则、检查出错时对进行中告警的处理
+func TestEvaluateQuota(t *testing.T) {
+	ctx := context.Background()
+	a := newTestAlertService(t, nil)
+	store := a.store
+
+	// /29 除去服务端共 5 个可分配地址
+	it := &models.WireGuardInterface{Name: "wgalert0", Address: "10.30.0.1/29", ListenPort: 51840, Mode: "server"}
+	if err := store.Interfaces().Create(ctx, it); err != nil {
+		t.Fatal(err)
+	}
+	for _, ip := range []string{"10.30.0.2", "10.30.0.3", "10.30.0.4", "10.30.0.5"} {
+		if err := store.Peers().Create(ctx, &models.WireGuardPeer{InterfaceID: it.ID, Name: ip, IP: ip, PublicKey: ip}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	quota, err := a.CreateRule(ctx, models.AlertRuleRequest{Name: "space", Type: models.AlertQuota,
+		Threshold: ptr(75.0), InterfaceID: &it.ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	logins, err := a.CreateRule(ctx, models.AlertRuleRequest{Name: "logins", Type: models.AlertFailedLogins})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := a.Evaluate(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 没有 LoginFailureCounter 时 failed_logins 规则报错，不影响其他规则
+	if res.Fired != 1 || res.Firing != 1 || len(res.Errors) != 1 || !strings.Contains(res.Errors[0], `"logins"`) {
+		t.Fatalf("first evaluation = %+v", res)
+	}
+	alerts, err := a.ListAlerts(ctx, repository.AlertFilter{Status: models.AlertStatusFiring})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(alerts) != 1 || alerts[0].Key != fmt.Sprintf("interface:%d:10.30.0.0/29", it.ID) || alerts[0].RuleID != quota.ID {
+		t.Fatalf("firing alerts = %+v", alerts)
+	}
+	if err := a.DeleteRule(ctx, logins.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	// 停用规则后其告警直接解决
+	if _, err := a.UpdateRule(ctx, quota.ID, models.AlertRuleRequest{Name: "space", Type: models.AlertQuota,
+		Enabled: ptr(false), InterfaceID: &it.ID}); err != nil {
+		t.Fatal(err)
+	}
+	res, err = a.Evaluate(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Resolved != 1 || res.Firing != 0 || len(res.Errors) != 0 {
+		t.Fatalf("after disabling = %+v", res)
+	}
+	alerts, err = a.ListAlerts(ctx, repository.AlertFilter{Status: models.AlertStatusResolved})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(alerts) != 1 || alerts[0].ResolvedAt == nil {
+		t.Fatalf("resolved alerts = %+v", alerts)
+	}
+}
+
+func TestDeleteNotifierDetachesRules(t *testing.T) {
+	ctx := context.Background()
+	a := newTestAlertService(t, nil)
+	var ids []int
+	for _, name := range []string{"a", "b"} {
+		n, err := a.CreateNotifier(ctx, models.NotifierRequest{Name: name, Type: models.NotifierWebhook,
+			Settings: map[string]string{"url": "http://127.0.0.1:1/" + name}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, n.ID)
+	}
+	ar, err := a.CreateRule(ctx, models.AlertRuleRequest{Name: "q", Type: models.AlertQuota, NotifierIDs: ids})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := a.DeleteNotifier(ctx, ids[0]); err != nil {
+		t.Fatal(err)
+	}
+	got, err := a.GetRule(ctx, ar.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got.NotifierIDs, ids[1:]) {
+		t.Errorf("notifier_ids = %v, want %v", got.NotifierIDs, ids[1:])
+	}
+	if err := a.DeleteNotifier(ctx, ids[0]); !errors.Is(err, ErrNotFound) {
+		t.Errorf("second delete err = %v", err)
+	}
+}
@@ -3,6 +3,7 @@ package services
 import (
 	"database/sql"
 	"fmt"
+	"sync"
 	"time"
 
 	"backend/models"
@@ -10,14 +11,21 @@ import (
 	"golang.org/x/crypto/bcrypt"
 )
 
+// 登录失败记录的保留时长（供告警统计）
+const failedLoginRetention = 24 * time.Hour
+
 type AuthService struct {
 	db        *sql.DB
 	jwtSecret []byte
+
+	failMu   sync.Mutex
+	failures []time.Time // 最近的登录失败时间（升序）
 }
 
 type Claims struct {
 	UserID   int    `json:"user_id"`
 	Username string `json:"username"`
+	Role     string `json:"role"`
 	jwt.RegisteredClaims
 }
 
@@ -31,12 +39,13 @@ func NewAuthService(db *sql.DB, jwtSecret string) *AuthService {
 func (s *AuthService) Login(req models.LoginRequest) (*models.LoginResponse, error) {
 	// Get user from database
 	var user models.User
-	query := "SELECT id, username, password_hash, created_at FROM users WHERE username = ?"
+	query := "SELECT id, username, password_hash, role, created_at FROM users WHERE username = ?"
 	err := s.db.QueryRow(query, req.Username).Scan(
-		&user.ID, &user.Username, &user.PasswordHash, &user.CreatedAt,
+		&user.ID, &user.Username, &user.PasswordHash, &user.Role, &user.CreatedAt,
 	)
 	if err != nil {
 		if err == sql.ErrNoRows {
+			s.recordFailedLogin()
 			return nil, fmt.Errorf("invalid username or password")
 		}
 		return nil, fmt.Errorf("failed to get user: %v", err)
@@ -45,11 +54,12 @@ func (s *AuthService) Login(req models.LoginRequest) (*models.LoginResponse, err
 	// Check password
 	err = bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(req.Password))
 	if err != nil {
+		s.recordFailedLogin()
 		return nil, fmt.Errorf("invalid username or password")
 	}
 
 	// Generate JWT token
-	token, err := s.GenerateToken(user.ID, user.Username)
+	token, err := s.GenerateToken(user.ID, user.Username, user.Role)
 	if err != nil {
 		return nil, fmt.Errorf("failed to generate token: %v", err)
 	}
@@ -60,10 +70,33 @@ func (s *AuthService) Login(req models.LoginRequest) (*models.LoginResponse, err
 	}, nil
 }
 
-func (s *AuthService) GenerateToken(userID int, username string) (string, error) {
+func (s *AuthService) recordFailedLogin() {
+	s.failMu.Lock()
+	defer s.failMu.Unlock()
+	now := time.Now()
+	cut := 0
+	for cut < len(s.failures) && now.Sub(s.failures[cut]) > failedLoginRetention {
+		cut++
+	}
+	s.failures = append(s.failures[cut:], now)
+}
+
+// FailedLogins 返回 since 之后的登录失败次数（仅统计本进程启动后、24 小时内的记录）
+func (s *AuthService) FailedLogins(since time.Time) int {
+	s.failMu.Lock()
+	defer s.failMu.Unlock()
+	n := 0
+	for i := len(s.failures) - 1; i >= 0 && s.failures[i].After(since); i-- {
+		n++
+	}
+	return n
+}
+
+func (s *AuthService) GenerateToken(userID int, username, role string) (string, error) {
 	claims := Claims{
 		UserID:   userID,
 		Username: username,
+		Role:     role,
 		RegisteredClaims: jwt.RegisteredClaims{
 			ExpiresAt: jwt.NewNumericDate(time.Now().Add(24 * time.Hour)),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
@@ -115,8 +148,8 @@ func (s *AuthService) CreateUser(username, password string) (*models.User, error
 
 	// Get created user
 	var user models.User
-	query = "SELECT id, username, created_at FROM users WHERE id = ?"
-	err = s.db.QueryRow(query, id).Scan(&user.ID, &user.Username, &user.CreatedAt)
+	query = "SELECT id, username, role, created_at FROM users WHERE id = ?"
+	err = s.db.QueryRow(query, id).Scan(&user.ID, &user.Username, &user.Role, &user.CreatedAt)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get created user: %v", err)
 	}
@@ -126,8 +159,8 @@ func (s *AuthService) CreateUser(username, password string) (*models.User, error
 
 func (s *AuthService) GetUser(id int) (*models.User, error) {
 	var user models.User
-	query := "SELECT id, username, created_at FROM users WHERE id = ?"
-	err := s.db.QueryRow(query, id).Scan(&user.ID, &user.Username, &user.CreatedAt)
+	query := "SELECT id, username, role, created_at FROM users WHERE id = ?"
+	err := s.db.QueryRow(query, id).Scan(&user.ID, &user.Username, &user.Role, &user.CreatedAt)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, fmt.Errorf("user not found")
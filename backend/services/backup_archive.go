@@ -0,0 +1,379 @@
+package services
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/scrypt"
+)
+
+/* -------------------- 备份归档格式 --------------------
+ * tar.gz:
+ *   manifest.json          版本、时间、库文件校验和
+ *   wireguard.db           在线备份得到的 SQLite 快照
+ *   wireguard/<name>.conf  各接口导出的 wg-quick 配置（含明文私钥，仅在口令加密的归档中）
+ * 指定口令时整个 tar.gz 再经 scrypt + AES-256-GCM 分块加密，文件头为 backupMagic：
+ *   magic | salt | nonce 前缀 | 分块...
+ * 每块明文 backupChunkSize 字节（最后一块更短，可为空），nonce = 前缀 | 块序号 | 是否最后一块，
+ * 截断或调换分块都无法通过认证。旧版 backupMagicV1 为整体单次加密，只在恢复时兼容读取
+ */
+
+const (
+	backupVersion   = 1
+	backupManifest  = "manifest.json"
+	backupDBFile    = "wireguard.db"
+	backupConfDir   = "wireguard"
+	backupMagic     = "WGMBAK2\n"
+	backupMagicV1   = "WGMBAK1\n"
+	backupSaltSize  = 16
+	backupChunkSize = 64 << 10
+	maxArchiveEntry = 512 << 20 // 单个条目上限，防止解压炸弹
+	maxArchiveSize  = 2 * maxArchiveEntry
+)
+
+type BackupManifest struct {
+	Version    int       `json:"version"`
+	CreatedAt  time.Time `json:"created_at"`
+	DBSHA256   string    `json:"db_sha256"`
+	Interfaces []string  `json:"interfaces"`
+	KeyID      string    `json:"key_id,omitempty"` // 库内私钥所用主密钥；为空表示明文
+	Encrypted  bool      `json:"encrypted"`        // 归档本身是否口令加密
+	Warnings   []string  `json:"warnings,omitempty"`
+}
+
+func fileSHA256(p string) (string, error) {
+	f, err := os.Open(p)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// writeArchive 以流的方式写出 tar.gz；库文件直接从磁盘拷贝，不整体读入内存
+func writeArchive(w io.Writer, dbPath string, confs map[string]string, m *BackupManifest) error {
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+
+	add := func(name string, mode int64, size int64, r io.Reader) error {
+		if err := tw.WriteHeader(&tar.Header{
+			Name: name, Mode: mode, Size: size, ModTime: m.CreatedAt,
+		}); err != nil {
+			return err
+		}
+		_, err := io.Copy(tw, r)
+		return err
+	}
+
+	mb, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := add(backupManifest, 0o644, int64(len(mb)), bytes.NewReader(mb)); err != nil {
+		return err
+	}
+	f, err := os.Open(dbPath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	if err := add(backupDBFile, 0o600, info.Size(), f); err != nil {
+		return err
+	}
+	for name, conf := range confs {
+		if err := add(path.Join(backupConfDir, name+".conf"), 0o600, int64(len(conf)), strings.NewReader(conf)); err != nil {
+			return err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return gz.Close()
+}
+
+// extractArchive 从 r 流式解包到 dir，返回 manifest；只接受白名单内的条目，解出的总量不超过 maxArchiveSize
+func extractArchive(r io.Reader, dir string) (*BackupManifest, error) {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, fmt.Errorf("%w: not a backup archive: %v", ErrBadRequest, err)
+	}
+	defer gz.Close()
+	tr := tar.NewReader(gz)
+
+	var m *BackupManifest
+	var total int64
+	for {
+		h, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w: corrupt archive: %v", ErrBadRequest, err)
+		}
+		if h.Typeflag != tar.TypeReg {
+			continue
+		}
+		name := path.Clean(h.Name)
+		switch {
+		case name == backupManifest, name == backupDBFile:
+		case path.Dir(name) == backupConfDir && strings.HasSuffix(name, ".conf"):
+		default:
+			return nil, fmt.Errorf("%w: unexpected archive entry %q", ErrBadRequest, h.Name)
+		}
+		if h.Size > maxArchiveEntry {
+			return nil, fmt.Errorf("%w: archive entry %q too large", ErrBadRequest, h.Name)
+		}
+		if total += h.Size; total > maxArchiveSize {
+			return nil, fmt.Errorf("%w: archive too large (limit %d MiB)", ErrBadRequest, maxArchiveSize>>20)
+		}
+		if name == backupManifest {
+			body, err := io.ReadAll(io.LimitReader(tr, maxArchiveEntry))
+			if err != nil {
+				return nil, fmt.Errorf("%w: corrupt archive: %v", ErrBadRequest, err)
+			}
+			m = &BackupManifest{}
+			if err := json.Unmarshal(body, m); err != nil {
+				return nil, fmt.Errorf("%w: bad manifest: %v", ErrBadRequest, err)
+			}
+			continue
+		}
+		dst := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(dst), 0o700); err != nil {
+			return nil, err
+		}
+		if err := extractFile(dst, io.LimitReader(tr, maxArchiveEntry)); err != nil {
+			return nil, err
+		}
+	}
+	if m == nil {
+		return nil, fmt.Errorf("%w: archive has no manifest", ErrBadRequest)
+	}
+	if m.Version != backupVersion {
+		return nil, fmt.Errorf("%w: unsupported backup version %d", ErrBadRequest, m.Version)
+	}
+	return m, nil
+}
+
+func extractFile(dst string, r io.Reader) error {
+	f, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o600)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(f, r); err != nil {
+		f.Close()
+		// 解密认证失败等输入错误原样返回（已是 ErrBadRequest）
+		if errors.Is(err, ErrBadRequest) {
+			return err
+		}
+		return fmt.Errorf("%w: corrupt archive: %v", ErrBadRequest, err)
+	}
+	return f.Close()
+}
+
+func passphraseKey(passphrase string, salt []byte) ([]byte, error) {
+	return scrypt.Key([]byte(passphrase), salt, 1<<15, 8, 1, 32)
+}
+
+func newArchiveAEAD(passphrase string, salt []byte) (cipher.AEAD, error) {
+	key, err := passphraseKey(passphrase, salt)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// archiveNonce 由前缀、块序号与最后一块标记组成
+func archiveNonce(aead cipher.AEAD, prefix []byte, seq uint32, last bool) []byte {
+	nonce := make([]byte, aead.NonceSize())
+	copy(nonce, prefix)
+	binary.BigEndian.PutUint32(nonce[len(prefix):], seq)
+	if last {
+		nonce[len(nonce)-1] = 1
+	}
+	return nonce
+}
+
+// archiveEncrypter 把写入的明文按块加密后写到 w；Close 写出最后一块（不关闭 w）
+type archiveEncrypter struct {
+	w      io.Writer
+	aead   cipher.AEAD
+	header []byte // 作为每块的附加认证数据
+	prefix []byte
+	seq    uint32
+	buf    []byte
+}
+
+func newArchiveEncrypter(w io.Writer, passphrase string) (io.WriteCloser, error) {
+	salt := make([]byte, backupSaltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	aead, err := newArchiveAEAD(passphrase, salt)
+	if err != nil {
+		return nil, err
+	}
+	prefix := make([]byte, aead.NonceSize()-5)
+	if _, err := rand.Read(prefix); err != nil {
+		return nil, err
+	}
+	header := append(append([]byte(backupMagic), salt...), prefix...)
+	if _, err := w.Write(header); err != nil {
+		return nil, err
+	}
+	return &archiveEncrypter{w: w, aead: aead, header: header, prefix: prefix, buf: make([]byte, 0, backupChunkSize)}, nil
+}
+
+func (e *archiveEncrypter) Write(p []byte) (int, error) {
+	n := len(p)
+	for len(p) > 0 {
+		// 满块等到有后续数据才写出：最后一块必须短于 backupChunkSize，读端据此识别结尾
+		if len(e.buf) == backupChunkSize {
+			if err := e.flush(false); err != nil {
+				return 0, err
+			}
+		}
+		k := min(backupChunkSize-len(e.buf), len(p))
+		e.buf = append(e.buf, p[:k]...)
+		p = p[k:]
+	}
+	return n, nil
+}
+
+func (e *archiveEncrypter) flush(last bool) error {
+	if e.seq == math.MaxUint32 {
+		return errors.New("archive too large to encrypt")
+	}
+	out := e.aead.Seal(nil, archiveNonce(e.aead, e.prefix, e.seq, last), e.buf, e.header)
+	e.seq++
+	e.buf = e.buf[:0]
+	_, err := e.w.Write(out)
+	return err
+}
+
+func (e *archiveEncrypter) Close() error {
+	if len(e.buf) == backupChunkSize {
+		if err := e.flush(false); err != nil {
+			return err
+		}
+	}
+	return e.flush(true)
+}
+
+// archiveDecrypter 逐块解密并认证；最后一块缺失、被截断或被调换时返回 ErrBadRequest
+type archiveDecrypter struct {
+	r      io.Reader
+	aead   cipher.AEAD
+	header []byte
+	prefix []byte
+	seq    uint32
+	raw    []byte
+	buf    []byte // 尚未读出的明文
+	done   bool
+}
+
+// newArchiveDecrypter 读取 r 开头的文件头（magic 已由调用方确认）
+func newArchiveDecrypter(r io.Reader, passphrase string) (io.Reader, error) {
+	if passphrase == "" {
+		return nil, fmt.Errorf("%w: archive is encrypted, passphrase required", ErrBadRequest)
+	}
+	salt := make([]byte, len(backupMagic)+backupSaltSize)
+	if _, err := io.ReadFull(r, salt); err != nil {
+		return nil, fmt.Errorf("%w: truncated archive", ErrBadRequest)
+	}
+	salt = salt[len(backupMagic):]
+	aead, err := newArchiveAEAD(passphrase, salt)
+	if err != nil {
+		return nil, err
+	}
+	prefix := make([]byte, aead.NonceSize()-5)
+	if _, err := io.ReadFull(r, prefix); err != nil {
+		return nil, fmt.Errorf("%w: truncated archive", ErrBadRequest)
+	}
+	header := append(append([]byte(backupMagic), salt...), prefix...)
+	return &archiveDecrypter{
+		r: r, aead: aead, header: header, prefix: prefix,
+		raw: make([]byte, backupChunkSize+aead.Overhead()),
+	}, nil
+}
+
+func (d *archiveDecrypter) Read(p []byte) (int, error) {
+	for len(d.buf) == 0 {
+		if d.done {
+			return 0, io.EOF
+		}
+		n, err := io.ReadFull(d.r, d.raw)
+		last := false
+		switch {
+		case err == nil:
+		case errors.Is(err, io.EOF), errors.Is(err, io.ErrUnexpectedEOF):
+			last = true
+		default:
+			return 0, err
+		}
+		if n < d.aead.Overhead() {
+			return 0, fmt.Errorf("%w: truncated archive", ErrBadRequest)
+		}
+		pt, err := d.aead.Open(d.raw[:0], archiveNonce(d.aead, d.prefix, d.seq, last), d.raw[:n], d.header)
+		if err != nil {
+			return 0, fmt.Errorf("%w: wrong passphrase or corrupt archive", ErrBadRequest)
+		}
+		d.seq++
+		d.buf, d.done = pt, last
+	}
+	n := copy(p, d.buf)
+	d.buf = d.buf[n:]
+	return n, nil
+}
+
+// decryptArchiveV1 解密旧版整体加密的归档（magic | salt | nonce | ciphertext），需要整体读入
+func decryptArchiveV1(data []byte, passphrase string) ([]byte, error) {
+	if passphrase == "" {
+		return nil, fmt.Errorf("%w: archive is encrypted, passphrase required", ErrBadRequest)
+	}
+	data = data[len(backupMagicV1):]
+	if len(data) < backupSaltSize {
+		return nil, fmt.Errorf("%w: truncated archive", ErrBadRequest)
+	}
+	aead, err := newArchiveAEAD(passphrase, data[:backupSaltSize])
+	if err != nil {
+		return nil, err
+	}
+	data = data[backupSaltSize:]
+	if len(data) < aead.NonceSize() {
+		return nil, fmt.Errorf("%w: truncated archive", ErrBadRequest)
+	}
+	pt, err := aead.Open(nil, data[:aead.NonceSize()], data[aead.NonceSize():], []byte(backupMagicV1))
+	if err != nil {
+		return nil, fmt.Errorf("%w: wrong passphrase or corrupt archive", ErrBadRequest)
+	}
+	return pt, nil
+}
@@ -0,0 +1,216 @@
+package services
+
+import (
+	"archive/tar"
+	"backend/database"
+	"backend/models"
+	"backend/repository"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/rand"
+	"errors"
+	"io"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestArchiveEncryption(t *testing.T) {
+	sizes := []int{0, 1, backupChunkSize - 1, backupChunkSize, backupChunkSize + 1, 3 * backupChunkSize}
+	for _, size := range sizes {
+		plain := make([]byte, size)
+		rand.Read(plain)
+
+		var buf bytes.Buffer
+		enc, err := newArchiveEncrypter(&buf, "correct horse")
+		if err != nil {
+			t.Fatal(err)
+		}
+		// 分成不规则的小段写入，覆盖块边界
+		for p := plain; len(p) > 0; {
+			k := min(len(p), 1000+len(p)%7777)
+			if _, err := enc.Write(p[:k]); err != nil {
+				t.Fatal(err)
+			}
+			p = p[k:]
+		}
+		if err := enc.Close(); err != nil {
+			t.Fatal(err)
+		}
+		sealed := buf.Bytes()
+
+		open := func(data []byte, pass string) ([]byte, error) {
+			r, err := newArchiveDecrypter(bytes.NewReader(data), pass)
+			if err != nil {
+				return nil, err
+			}
+			return io.ReadAll(r)
+		}
+		got, err := open(sealed, "correct horse")
+		if err != nil {
+			t.Fatalf("size %d: %v", size, err)
+		}
+		if !bytes.Equal(got, plain) {
+			t.Fatalf("size %d: round trip mismatch", size)
+		}
+
+		header := len(backupMagic) + backupSaltSize + 7
+		chunk := backupChunkSize + 16
+		bad := map[string][]byte{
+			"wrong passphrase": sealed,
+			"flipped bit":      flipLastByte(sealed),
+			"truncated":        sealed[:len(sealed)-1],
+		}
+		if size >= backupChunkSize {
+			// 在块边界截断：剩下的最后一块没有结尾标记
+			bad["dropped final chunk"] = sealed[:header+chunk]
+		}
+		for name, data := range bad {
+			pass := "correct horse"
+			if name == "wrong passphrase" {
+				pass = "battery staple"
+			}
+			if _, err := open(data, pass); !errors.Is(err, ErrBadRequest) {
+				t.Errorf("size %d, %s: err = %v, want ErrBadRequest", size, name, err)
+			}
+		}
+	}
+	if _, err := newArchiveDecrypter(strings.NewReader(backupMagic), ""); !errors.Is(err, ErrBadRequest) {
+		t.Errorf("missing passphrase: err = %v", err)
+	}
+}
+
+func flipLastByte(b []byte) []byte {
+	out := slices.Clone(b)
+	out[len(out)-1] ^= 1
+	return out
+}
+
+func TestExtractArchiveRejects(t *testing.T) {
+	build := func(entries map[string]string) []byte {
+		var buf bytes.Buffer
+		gz := gzip.NewWriter(&buf)
+		tw := tar.NewWriter(gz)
+		for name, body := range entries {
+			tw.WriteHeader(&tar.Header{Name: name, Mode: 0o600, Size: int64(len(body))})
+			tw.Write([]byte(body))
+		}
+		tw.Close()
+		gz.Close()
+		return buf.Bytes()
+	}
+	manifest := `{"version":1}`
+	tests := []struct {
+		name    string
+		data    []byte
+		wantErr bool
+	}{
+		{name: "minimal", data: build(map[string]string{backupManifest: manifest, backupDBFile: "db"})},
+		{name: "conf entry", data: build(map[string]string{backupManifest: manifest, "wireguard/wg0.conf": "x"})},
+		{name: "path traversal", data: build(map[string]string{backupManifest: manifest, "../evil": "x"}), wantErr: true},
+		{name: "nested conf", data: build(map[string]string{backupManifest: manifest, "wireguard/a/b.conf": "x"}), wantErr: true},
+		{name: "no manifest", data: build(map[string]string{backupDBFile: "db"}), wantErr: true},
+		{name: "future version", data: build(map[string]string{backupManifest: `{"version":9}`}), wantErr: true},
+		{name: "not gzip", data: []byte("plain text"), wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := extractArchive(bytes.NewReader(tt.data), t.TempDir())
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil && !errors.Is(err, ErrBadRequest) {
+				t.Fatalf("err = %v, want ErrBadRequest", err)
+			}
+		})
+	}
+}
+
+// TestBackupRoundTrip 备份并恢复 SQLite 库；只有口令加密的归档才带 .conf（含私钥）
+func TestBackupRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	db, err := database.Initialize(filepath.Join(t.TempDir(), "wg.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	store := repository.NewSQLStore(db)
+	wg := NewWireGuardServiceWithStore(store)
+	wg.SetFirewall(nil)
+	wg.SetNetworkBackend(nil)
+	wg.SetHooks(false, 0)
+	t.Cleanup(func() { wg.Close() })
+	svc := NewBackupService(db, store, nil, wg, "")
+
+	it := &models.WireGuardInterface{Name: "wgbak0", PrivateKey: "cHJpdmF0ZQ==", PublicKey: "pub", ListenPort: 51860,
+		Address: "10.50.0.1/24", CIDR: "10.50.0.0/24", ServerIP: "10.50.0.1", Mode: "server"}
+	if err := store.Interfaces().Create(ctx, it); err != nil {
+		t.Fatal(err)
+	}
+
+	entries := func(data []byte, pass string) []string {
+		t.Helper()
+		r, err := archiveReader(bytes.NewReader(data), pass)
+		if err != nil {
+			t.Fatal(err)
+		}
+		gz, err := gzip.NewReader(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var names []string
+		tr := tar.NewReader(gz)
+		for {
+			h, err := tr.Next()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			names = append(names, h.Name)
+		}
+		return names
+	}
+
+	var plain, sealed bytes.Buffer
+	m, err := svc.CreateBackup(ctx, &plain, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := entries(plain.Bytes(), ""); !slices.Equal(got, []string{backupManifest, backupDBFile}) {
+		t.Errorf("unencrypted entries = %v", got)
+	}
+	if len(m.Warnings) != 1 || !slices.Equal(m.Interfaces, []string{"wgbak0"}) {
+		t.Errorf("manifest = %+v", m)
+	}
+	if _, err := svc.CreateBackup(ctx, &sealed, "s3cret"); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasPrefix(sealed.Bytes(), []byte(backupMagic)) {
+		t.Fatal("encrypted archive has no magic")
+	}
+	if got := entries(sealed.Bytes(), "s3cret"); !slices.Equal(got, []string{backupManifest, backupDBFile, "wireguard/wgbak0.conf"}) {
+		t.Errorf("encrypted entries = %v", got)
+	}
+
+	// 备份后删除接口，恢复后应回来
+	if err := store.Interfaces().Delete(ctx, it.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := svc.Restore(ctx, bytes.NewReader(sealed.Bytes()), "wrong"); !errors.Is(err, ErrBadRequest) {
+		t.Fatalf("restore with wrong passphrase: err = %v", err)
+	}
+	if _, err := svc.Restore(ctx, bytes.NewReader(sealed.Bytes()), "s3cret"); err != nil {
+		t.Fatal(err)
+	}
+	got, err := store.Interfaces().GetByName(ctx, "wgbak0")
+	if err != nil {
+		t.Fatalf("interface not restored: %v", err)
+	}
+	if got.PrivateKey != it.PrivateKey {
+		t.Errorf("private key = %q", got.PrivateKey)
+	}
+}
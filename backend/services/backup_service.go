@@ -0,0 +1,413 @@
+package services
+
+import (
+	"backend/database"
+	"backend/keystore"
+	"backend/repository"
+	"bufio"
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+type BackupService struct {
+	db    *sql.DB
+	store *repository.SQLStore
+	keys  *keystore.Keyring
+	wg    *WireGuardService
+	dir   string // 定时备份目录；为空则不落盘
+
+	mu sync.Mutex // 串行化备份与恢复
+}
+
+func NewBackupService(db *sql.DB, store *repository.SQLStore, keys *keystore.Keyring, wg *WireGuardService, dir string) *BackupService {
+	return &BackupService{db: db, store: store, keys: keys, wg: wg, dir: dir}
+}
+
+type BackupFile struct {
+	Name      string    `json:"name"`
+	Size      int64     `json:"size"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type RestoreResult struct {
+	Manifest   *BackupManifest `json:"manifest"`
+	Stopped    []string        `json:"stopped"`
+	Reapplied  []string        `json:"reapplied"`
+	Errors     []string        `json:"errors,omitempty"`
+	SafetyCopy string          `json:"safety_copy,omitempty"` // 恢复前自动备份的文件名
+}
+
+/* -------------------- 备份 -------------------- */
+
+// CreateBackup 生成一致性快照归档写入 w；passphrase 非空时加密
+func (s *BackupService) CreateBackup(ctx context.Context, w io.Writer, passphrase string) (*BackupManifest, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.createBackup(ctx, w, passphrase)
+}
+
+func (s *BackupService) createBackup(ctx context.Context, w io.Writer, passphrase string) (*BackupManifest, error) {
+	tmp, err := os.MkdirTemp("", "wg-backup-*")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(tmp)
+
+	// 1) SQLite 在线备份：不阻塞运行中的读写
+	dbPath := filepath.Join(tmp, backupDBFile)
+	if err := database.BackupTo(ctx, s.db, dbPath); err != nil {
+		return nil, fmt.Errorf("sqlite backup: %w", err)
+	}
+	sum, err := fileSHA256(dbPath)
+	if err != nil {
+		return nil, err
+	}
+
+	m := &BackupManifest{
+		Version:    backupVersion,
+		CreatedAt:  time.Now().UTC(),
+		DBSHA256:   sum,
+		Interfaces: []string{},
+		Encrypted:  passphrase != "",
+	}
+	if s.keys != nil {
+		m.KeyID = s.keys.CurrentID()
+	}
+
+	// 2) 导出各接口 .conf（从快照读，保证与库一致）
+	snap, err := sql.Open("sqlite3", dbPath)
+	if err != nil {
+		return nil, err
+	}
+	defer snap.Close()
+	snapWG := NewWireGuardServiceWithStore(s.snapshotStore(snap))
+	defer snapWG.Close()
+	ifaces, err := snapWG.GetInterfaces()
+	if err != nil {
+		return nil, fmt.Errorf("read snapshot: %w", err)
+	}
+	confs := make(map[string]string, len(ifaces))
+	if passphrase == "" && len(ifaces) > 0 {
+		// .conf 含明文私钥；恢复时会由库重新生成，不加密的归档里不放
+		m.Warnings = append(m.Warnings, "interface .conf files omitted: they contain plaintext private keys and the archive has no passphrase")
+	}
+	for _, it := range ifaces {
+		m.Interfaces = append(m.Interfaces, it.Name)
+		if passphrase == "" {
+			continue
+		}
+		conf, err := snapWG.GetInterfaceConfig(it.ID)
+		if err != nil {
+			m.Warnings = append(m.Warnings, fmt.Sprintf("%s: export conf: %v", it.Name, err))
+			continue
+		}
+		confs[it.Name] = conf
+	}
+
+	// 3) 打包（可选加密），直接流向 w
+	if passphrase == "" {
+		if err := writeArchive(w, dbPath, confs, m); err != nil {
+			return nil, fmt.Errorf("write archive: %w", err)
+		}
+		return m, nil
+	}
+	enc, err := newArchiveEncrypter(w, passphrase)
+	if err != nil {
+		return nil, fmt.Errorf("encrypt archive: %w", err)
+	}
+	if err := writeArchive(enc, dbPath, confs, m); err != nil {
+		return nil, fmt.Errorf("write archive: %w", err)
+	}
+	if err := enc.Close(); err != nil {
+		return nil, fmt.Errorf("encrypt archive: %w", err)
+	}
+	return m, nil
+}
+
+func (s *BackupService) snapshotStore(db *sql.DB) *repository.SQLStore {
+	st := repository.NewSQLStore(db)
+	if s.keys != nil {
+		st = st.WithCipher(s.keys)
+	}
+	return st
+}
+
+// 写入备份目录，文件名带时间戳
+func (s *BackupService) writeBackupFile(ctx context.Context, prefix, passphrase string) (string, error) {
+	if s.dir == "" {
+		return "", fmt.Errorf("%w: backup directory not configured (set BACKUP_DIR)", ErrBadRequest)
+	}
+	if err := os.MkdirAll(s.dir, 0o700); err != nil {
+		return "", err
+	}
+	ext := ".tar.gz"
+	if passphrase != "" {
+		ext = ".tar.gz.enc"
+	}
+	name := prefix + time.Now().UTC().Format("20060102-150405") + ext
+	tmp, err := os.CreateTemp(s.dir, ".tmp-"+name)
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := s.createBackup(ctx, tmp, passphrase); err != nil {
+		tmp.Close()
+		return "", err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return "", err
+	}
+	if err := tmp.Close(); err != nil {
+		return "", err
+	}
+	if err := os.Chmod(tmp.Name(), 0o600); err != nil {
+		return "", err
+	}
+	if err := os.Rename(tmp.Name(), filepath.Join(s.dir, name)); err != nil {
+		return "", err
+	}
+	return name, nil
+}
+
+// ListBackups 列出备份目录中的归档（新在前）
+func (s *BackupService) ListBackups() ([]BackupFile, error) {
+	if s.dir == "" {
+		return []BackupFile{}, nil
+	}
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return []BackupFile{}, nil
+		}
+		return nil, err
+	}
+	list := []BackupFile{}
+	for _, e := range entries {
+		if e.IsDir() || strings.HasPrefix(e.Name(), ".") || !strings.Contains(e.Name(), ".tar.gz") {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			continue
+		}
+		list = append(list, BackupFile{Name: e.Name(), Size: info.Size(), CreatedAt: info.ModTime()})
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].CreatedAt.After(list[j].CreatedAt) })
+	return list, nil
+}
+
+// prune 只保留最近 keep 份定时备份（前缀 auto-）
+func (s *BackupService) prune(keep int) error {
+	list, err := s.ListBackups()
+	if err != nil {
+		return err
+	}
+	n := 0
+	for _, b := range list {
+		if !strings.HasPrefix(b.Name, "auto-") {
+			continue
+		}
+		n++
+		if n > keep {
+			if err := os.Remove(filepath.Join(s.dir, b.Name)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// RunSchedule 按 interval 定时备份到备份目录并按 retention 清理，直到 ctx 结束
+func (s *BackupService) RunSchedule(ctx context.Context, interval time.Duration, retention int, passphrase string) {
+	if interval <= 0 || s.dir == "" {
+		return
+	}
+	if retention <= 0 {
+		retention = 7
+	}
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			s.mu.Lock()
+			name, err := s.writeBackupFile(ctx, "auto-", passphrase)
+			if err == nil {
+				err = s.prune(retention)
+			}
+			s.mu.Unlock()
+			if err != nil {
+				log.Printf("[backup] scheduled backup failed: %v", err)
+				continue
+			}
+			log.Printf("[backup] scheduled backup written: %s", name)
+		}
+	}
+}
+
+/* -------------------- 恢复 -------------------- */
+
+// Restore 校验归档 -> 停止运行中的接口 -> 整库替换 -> 重新下发原本在运行的接口
+func (s *BackupService) Restore(ctx context.Context, r io.Reader, passphrase string) (*RestoreResult, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	src, err := archiveReader(r, passphrase)
+	if err != nil {
+		return nil, err
+	}
+
+	tmp, err := os.MkdirTemp("", "wg-restore-*")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(tmp)
+
+	// 1) 边解密边解包到临时目录，再校验
+	m, err := extractArchive(src, tmp)
+	if err != nil {
+		return nil, err
+	}
+	dbPath := filepath.Join(tmp, backupDBFile)
+	sum, err := fileSHA256(dbPath)
+	if err != nil {
+		return nil, fmt.Errorf("%w: archive has no database", ErrBadRequest)
+	}
+	if sum != m.DBSHA256 {
+		return nil, fmt.Errorf("%w: database checksum mismatch", ErrBadRequest)
+	}
+	if err := database.Verify(ctx, dbPath); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrBadRequest, err)
+	}
+	if err := s.checkRestorable(ctx, dbPath); err != nil {
+		return nil, err
+	}
+
+	res := &RestoreResult{Manifest: m, Stopped: []string{}, Reapplied: []string{}}
+
+	// 2) 恢复前先留一份当前状态，便于回退
+	if s.dir != "" {
+		if name, err := s.writeBackupFile(ctx, "pre-restore-", ""); err == nil {
+			res.SafetyCopy = name
+		} else {
+			res.Errors = append(res.Errors, fmt.Sprintf("safety backup: %v", err))
+		}
+	}
+
+	// 3) 停止当前运行中的接口
+	current, err := s.wg.GetInterfaces()
+	if err != nil {
+		return nil, err
+	}
+	for _, it := range current {
+		if it.Status != "running" {
+			continue
+		}
+		if err := s.wg.StopInterface(it.ID); err != nil {
+			res.Errors = append(res.Errors, fmt.Sprintf("stop %s: %v", it.Name, err))
+			continue
+		}
+		res.Stopped = append(res.Stopped, it.Name)
+	}
+
+	// 4) 整库替换 + 迁移到当前 schema / 主密钥
+	if err := database.RestoreFrom(ctx, s.db, dbPath); err != nil {
+		return nil, fmt.Errorf("swap database: %w", err)
+	}
+	s.wg.resetIPAMCache()
+	if err := database.Migrate(s.db); err != nil {
+		res.Errors = append(res.Errors, fmt.Sprintf("migrate: %v", err))
+	}
+	if s.keys != nil {
+		if _, err := s.store.RewrapSecrets(ctx, false); err != nil {
+			res.Errors = append(res.Errors, fmt.Sprintf("rewrap secrets: %v", err))
+		}
+	}
+
+	// 5) 备份中标记为 running 的接口重新启动（含 PreUp/PostUp 与防火墙规则），并同步 .conf
+	restored, err := s.wg.GetInterfaces()
+	if err != nil {
+		return nil, err
+	}
+	kept := map[string]bool{}
+	for _, it := range restored {
+		kept[it.Name] = true
+		s.wg.syncConfFile(it.ID)
+	}
+	for _, it := range current {
+		if !kept[it.Name] {
+			s.wg.removeConfFile(it.Name)
+		}
+	}
+	for _, it := range restored {
+		if it.Status != "running" {
+			continue
+		}
+		if err := s.wg.StartInterface(it.ID); err != nil {
+			res.Errors = append(res.Errors, fmt.Sprintf("start %s: %v", it.Name, err))
+			continue
+		}
+		res.Reapplied = append(res.Reapplied, it.Name)
+	}
+	return res, nil
+}
+
+// archiveReader 按文件头返回 tar.gz 明文流：口令加密的归档边读边解密；
+// 旧版整体加密格式只能整体读入解密（仍受 maxArchiveSize 限制）
+func archiveReader(r io.Reader, passphrase string) (io.Reader, error) {
+	br := bufio.NewReader(r)
+	head, _ := br.Peek(len(backupMagic))
+	switch string(head) {
+	case backupMagic:
+		return newArchiveDecrypter(br, passphrase)
+	case backupMagicV1:
+		// 多读 1 字节判断是否超限，避免截断后的归档报出难以理解的错误
+		data, err := io.ReadAll(io.LimitReader(br, maxArchiveSize+1))
+		if err != nil {
+			return nil, err
+		}
+		if len(data) > maxArchiveSize {
+			return nil, fmt.Errorf("%w: archive too large (limit %d MiB)", ErrBadRequest, maxArchiveSize>>20)
+		}
+		pt, err := decryptArchiveV1(data, passphrase)
+		if err != nil {
+			return nil, err
+		}
+		return bytes.NewReader(pt), nil
+	}
+	return br, nil
+}
+
+// checkRestorable 在临时副本上迁移 schema 并读取全部私钥，确认当前主密钥能解密
+func (s *BackupService) checkRestorable(ctx context.Context, dbPath string) error {
+	db, err := sql.Open("sqlite3", dbPath)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	if err := database.Migrate(db); err != nil {
+		return fmt.Errorf("%w: migrate backup schema: %v", ErrBadRequest, err)
+	}
+	st := s.snapshotStore(db)
+	if _, err := st.Interfaces().List(ctx); err != nil {
+		return fmt.Errorf("%w: read backup interfaces: %v", ErrBadRequest, err)
+	}
+	if _, err := st.Peers().List(ctx); err != nil {
+		return fmt.Errorf("%w: read backup peers: %v", ErrBadRequest, err)
+	}
+	return nil
+}
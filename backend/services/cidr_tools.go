@@ -0,0 +1,56 @@
+package services
+
+import (
+	"backend/cidrset"
+	"backend/models"
+	"fmt"
+	"net/netip"
+	"strings"
+)
+
+/* -------------------- CIDR 工具 -------------------- */
+
+// SubtractCIDRs 计算 base - exclude，结果合并为最少前缀；供前端预览路由排除效果
+func SubtractCIDRs(req *models.CIDRSubtractRequest) (*models.CIDRSubtractResponse, error) {
+	base, err := parseCIDRItems(req.Base)
+	if err != nil {
+		return nil, fmt.Errorf("%w: base: %v", ErrBadRequest, err)
+	}
+	if len(base) == 0 {
+		base = defaultRoutes
+	}
+	exclude, err := parseCIDRItems(req.Exclude)
+	if err != nil {
+		return nil, fmt.Errorf("%w: exclude: %v", ErrBadRequest, err)
+	}
+
+	out := cidrset.Strings(cidrset.Subtract(base, exclude))
+	return &models.CIDRSubtractResponse{Result: out, Count: len(out)}, nil
+}
+
+// parseCIDRItems 解析 CIDR / 地址 / "a-b" 区间；单个元素内也允许逗号分隔
+func parseCIDRItems(items []string) ([]netip.Prefix, error) {
+	var out []netip.Prefix
+	for _, item := range items {
+		for _, x := range strings.Split(item, ",") {
+			x = strings.TrimSpace(x)
+			if x == "" {
+				continue
+			}
+			if strings.Contains(x, "-") {
+				r, err := cidrset.ParseRange(x)
+				if err != nil {
+					return nil, err
+				}
+				out = append(out, r.Prefixes()...)
+				continue
+			}
+			p, err := cidrset.ParsePrefix(x)
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, p)
+		}
+	}
+	return out, nil
+}
@@ -0,0 +1,719 @@
+package services
+
+import (
+	"backend/cidrset"
+	"backend/models"
+	"backend/repository"
+	"backend/wgconf"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/netip"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.zx2c4.com/wireguard/wgctrl"
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+)
+
+const (
+	defaultClientAllowedIPs = "0.0.0.0/0, ::/0"
+	clientFwMarkBase        = 51820 // 自动 fwmark / 策略路由表 = 51820 + 接口 ID
+	// 超过该时间没有握手视为断开（WireGuard 的 REJECT_AFTER_TIME）
+	clientHandshakeTimeout       = 180 * time.Second
+	defaultClientMonitorInterval = 30 * time.Second
+)
+
+// wgClient 返回（按需创建）wgctrl 客户端
+func (s *WireGuardService) wgClient() (*wgctrl.Client, error) {
+	s.clientMu.Lock()
+	defer s.clientMu.Unlock()
+	if s.client == nil {
+		c, err := wgctrl.New()
+		if err != nil {
+			return nil, fmt.Errorf("wgctrl new: %w", err)
+		}
+		s.client = c
+	}
+	return s.client, nil
+}
+
+/* -------------------- 远端配置 -------------------- */
+
+// GetClientRemote 返回客户端模式接口的远端；未设置返回 ErrNotFound
+func (s *WireGuardService) GetClientRemote(ctx context.Context, id int) (*models.ClientRemote, error) {
+	it, err := s.store.Interfaces().Get(ctx, id)
+	if err != nil {
+		return nil, mapRepoErr(err, "interface")
+	}
+	if it.Mode != models.InterfaceModeClient {
+		return nil, fmt.Errorf("%w: interface %s is not in client mode", ErrBadRequest, it.Name)
+	}
+	r, err := s.store.Remotes().Get(ctx, id)
+	if err != nil {
+		return nil, mapRepoErr(err, "interface remote")
+	}
+	return r, nil
+}
+
+// SetClientRemote 整体替换远端；接口在运行时立即重新下发
+func (s *WireGuardService) SetClientRemote(ctx context.Context, id int, req *models.ClientRemoteRequest) (*models.ClientRemote, error) {
+	it, err := s.store.Interfaces().Get(ctx, id)
+	if err != nil {
+		return nil, mapRepoErr(err, "interface")
+	}
+	if it.Mode != models.InterfaceModeClient {
+		return nil, fmt.Errorf("%w: interface %s is not in client mode", ErrBadRequest, it.Name)
+	}
+	cur, err := s.store.Remotes().Get(ctx, id)
+	if err != nil && !errors.Is(err, repository.ErrNotFound) {
+		return nil, err
+	}
+	r, err := normalizeClientRemote(id, cur, req)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.store.Remotes().Save(ctx, r); err != nil {
+		return nil, mapRepoErr(err, "interface remote")
+	}
+	s.syncConfFile(id)
+	if it.Status == "running" {
+		if err := s.ApplyInterfaceConfig(id); err != nil {
+			log.Printf("[client] apply %s after remote update: %v", it.Name, err)
+		}
+	}
+	return s.store.Remotes().Get(ctx, id)
+}
+
+// normalizeClientRemote 校验请求并生成远端配置；cur 为现有配置（可为 nil），PresharedKey 为 nil 时沿用
+func normalizeClientRemote(interfaceID int, cur *models.ClientRemote, req *models.ClientRemoteRequest) (*models.ClientRemote, error) {
+	r := &models.ClientRemote{InterfaceID: interfaceID}
+
+	r.PublicKey = strings.TrimSpace(req.PublicKey)
+	if _, err := parseWGPublicKey(r.PublicKey); err != nil {
+		return nil, fmt.Errorf("%w: public_key: %v", ErrBadRequest, err)
+	}
+	switch {
+	case req.PresharedKey != nil:
+		r.PresharedKey = strings.TrimSpace(*req.PresharedKey)
+	case cur != nil:
+		r.PresharedKey = cur.PresharedKey
+	}
+	if r.PresharedKey != "" {
+		if _, err := wgtypes.ParseKey(r.PresharedKey); err != nil {
+			return nil, fmt.Errorf("%w: preshared_key: %v", ErrBadRequest, err)
+		}
+	}
+
+	r.Endpoint = strings.TrimSpace(req.Endpoint)
+	host, port, err := net.SplitHostPort(r.Endpoint)
+	if n, perr := strconv.Atoi(port); err != nil || host == "" || perr != nil || n < 1 || n > 65535 {
+		return nil, fmt.Errorf("%w: endpoint %q: expect host:port", ErrBadRequest, r.Endpoint)
+	}
+
+	allowed := strings.TrimSpace(req.AllowedIPs)
+	if allowed == "" {
+		allowed = defaultClientAllowedIPs
+	}
+	if r.AllowedIPs, err = normalizeCIDRList("allowed_ips", allowed); err != nil {
+		return nil, err
+	}
+
+	r.PersistentKeepalive = 25
+	if req.PersistentKeepalive != nil {
+		if *req.PersistentKeepalive < 0 || *req.PersistentKeepalive > 65535 {
+			return nil, fmt.Errorf("%w: persistent_keepalive must be 0-65535", ErrBadRequest)
+		}
+		r.PersistentKeepalive = *req.PersistentKeepalive
+	}
+
+	if r.Table, err = normalizeRouteTable(req.Table); err != nil {
+		return nil, err
+	}
+	if req.FwMark < 0 || int64(req.FwMark) > int64(^uint32(0)) {
+		return nil, fmt.Errorf("%w: fwmark out of range", ErrBadRequest)
+	}
+	r.FwMark = req.FwMark
+	return r, nil
+}
+
+// normalizeRouteTable 接受 auto / off / 路由表编号（同 wg-quick，main 视为 254）
+func normalizeRouteTable(t string) (string, error) {
+	t = strings.ToLower(strings.TrimSpace(t))
+	switch t {
+	case "":
+		return models.RouteTableAuto, nil
+	case models.RouteTableAuto, models.RouteTableOff:
+		return t, nil
+	case "main":
+		return "254", nil
+	}
+	n, err := strconv.ParseUint(t, 10, 32)
+	if err != nil || n == 0 {
+		return "", fmt.Errorf("%w: table must be auto, off or a routing table number", ErrBadRequest)
+	}
+	return strconv.FormatUint(n, 10), nil
+}
+
+/* -------------------- 路由策略 -------------------- */
+
+// clientRouting 是客户端接口需要的路由：Table=auto 时默认路由放进独立的策略表，其余网段进 main
+type clientRouting struct {
+	FwMark      int            // 写入设备的 fwmark，0 表示不设置
+	Main        []netip.Prefix // main 表中的路由
+	Table       string         // 策略 / 指定路由表；空表示没有
+	TableRoutes []netip.Prefix
+	PolicyFams  []string // 需要 fwmark 策略规则的地址族（"-4" / "-6"）
+}
+
+func clientRoutes(it *models.WireGuardInterface, r *models.ClientRemote) clientRouting {
+	rt := clientRouting{FwMark: r.FwMark}
+	allowed, _ := cidrset.Parse(r.AllowedIPs)
+	switch r.Table {
+	case models.RouteTableOff:
+	case models.RouteTableAuto, "":
+		mark := r.FwMark
+		if mark == 0 {
+			mark = clientFwMarkBase + it.ID
+		}
+		for _, p := range allowed {
+			if p.Bits() != 0 {
+				rt.Main = append(rt.Main, p)
+				continue
+			}
+			rt.Table, rt.FwMark = strconv.Itoa(mark), mark
+			rt.TableRoutes = append(rt.TableRoutes, p)
+			if p.Addr().Is4() {
+				rt.PolicyFams = append(rt.PolicyFams, "-4")
+			} else {
+				rt.PolicyFams = append(rt.PolicyFams, "-6")
+			}
+		}
+	default:
+		rt.Table, rt.TableRoutes = r.Table, allowed
+	}
+	return rt
+}
+
+/* -------------------- 下发 / 拆除 -------------------- */
+
+// resolveEndpoint 解析 host:port；主机名取第一个 IPv4 地址，没有时取 IPv6
+func resolveEndpoint(ctx context.Context, ep string) (*net.UDPAddr, error) {
+	host, port, err := net.SplitHostPort(ep)
+	if err != nil {
+		return nil, fmt.Errorf("endpoint %q: %w", ep, err)
+	}
+	n, err := strconv.Atoi(port)
+	if err != nil {
+		return nil, fmt.Errorf("endpoint %q: invalid port", ep)
+	}
+	if a, err := netip.ParseAddr(host); err == nil {
+		return net.UDPAddrFromAddrPort(netip.AddrPortFrom(a, uint16(n))), nil
+	}
+	addrs, err := net.DefaultResolver.LookupNetIP(ctx, "ip", host)
+	if err != nil {
+		return nil, fmt.Errorf("resolve %s: %w", host, err)
+	}
+	if len(addrs) == 0 {
+		return nil, fmt.Errorf("resolve %s: no addresses", host)
+	}
+	pick := addrs[0]
+	for _, a := range addrs {
+		if a.Unmap().Is4() {
+			pick = a
+			break
+		}
+	}
+	return net.UDPAddrFromAddrPort(netip.AddrPortFrom(pick.Unmap(), uint16(n))), nil
+}
+
+// applyClientInterface 下发客户端模式接口：唯一的远端 peer、地址、路由与 fwmark 策略
+func (s *WireGuardService) applyClientInterface(ctx context.Context, iface *models.WireGuardInterface, priv *wgtypes.Key) error {
+	r, err := s.store.Remotes().Get(ctx, iface.ID)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return fmt.Errorf("%w: client interface %s has no remote configured", ErrBadRequest, iface.Name)
+		}
+		return err
+	}
+	pub, err := parseWGPublicKey(r.PublicKey)
+	if err != nil {
+		return fmt.Errorf("remote pubkey: %w", err)
+	}
+	allowed, err := parseAllowedIPs(r.AllowedIPs)
+	if err != nil {
+		return fmt.Errorf("remote allowedIPs: %w", err)
+	}
+	ep, err := resolveEndpoint(ctx, r.Endpoint)
+	if err != nil {
+		return err
+	}
+	pc := wgtypes.PeerConfig{
+		PublicKey:                   *pub,
+		ReplaceAllowedIPs:           true,
+		AllowedIPs:                  allowed,
+		PersistentKeepaliveInterval: durationPtrSeconds(r.PersistentKeepalive),
+		Endpoint:                    ep,
+	}
+	if r.PresharedKey != "" {
+		k, err := wgtypes.ParseKey(r.PresharedKey)
+		if err != nil {
+			return fmt.Errorf("remote preshared key: %w", err)
+		}
+		pc.PresharedKey = &k
+	}
+
+	rt := clientRoutes(iface, r)
+	cfg := wgtypes.Config{
+		PrivateKey:   priv,
+		ReplacePeers: true,
+		Peers:        []wgtypes.PeerConfig{pc},
+		FirewallMark: intPtr(rt.FwMark),
+	}
+	if iface.ListenPort > 0 {
+		cfg.ListenPort = intPtr(iface.ListenPort)
+	}
+	c, err := s.wgClient()
+	if err != nil {
+		return err
+	}
+	if err := c.ConfigureDevice(iface.Name, cfg); err != nil {
+		return fmt.Errorf("configure device: %w", err)
+	}
+
+	if err := ipAddrReplace(iface.Name, iface.Address); err != nil {
+		return err
+	}
+	if err := ipSetMTU(iface.Name, iface.MTU); err != nil {
+		return err
+	}
+	if err := ipLinkUp(iface.Name); err != nil {
+		return err
+	}
+	if err := ipRouteSync(iface.Name, "", rt.Main); err != nil {
+		return err
+	}
+	if rt.Table != "" {
+		if err := ipRouteSync(iface.Name, rt.Table, rt.TableRoutes); err != nil {
+			return err
+		}
+	}
+	if len(rt.PolicyFams) > 0 {
+		if err := ipPolicyRules(rt.FwMark, rt.PolicyFams); err != nil {
+			return err
+		}
+	}
+
+	_ = s.store.Interfaces().SetStatus(ctx, iface.ID, "running")
+	s.resetClientHealth(iface.ID)
+	return s.applyGatewayRules(ctx, iface.ID)
+}
+
+// downClientInterface 删除客户端接口的 fwmark 策略规则（路由随链路删除）
+func (s *WireGuardService) downClientInterface(ctx context.Context, iface *models.WireGuardInterface) {
+	s.dropClientHealth(iface.ID)
+	r, err := s.store.Remotes().Get(ctx, iface.ID)
+	if err != nil {
+		return
+	}
+	rt := clientRoutes(iface, r)
+	if len(rt.PolicyFams) == 0 {
+		return
+	}
+	// 其他运行中的客户端接口仍在用策略路由时保留共用的 suppress_prefixlength 规则
+	keepShared := false
+	if list, err := s.store.Interfaces().List(ctx); err == nil {
+		for i := range list {
+			o := &list[i]
+			if o.ID == iface.ID || o.Mode != models.InterfaceModeClient || o.Status != "running" {
+				continue
+			}
+			if or, err := s.store.Remotes().Get(ctx, o.ID); err == nil && len(clientRoutes(o, or).PolicyFams) > 0 {
+				keepShared = true
+				break
+			}
+		}
+	}
+	ipPolicyRulesDel(rt.FwMark, keepShared)
+}
+
+// clientConfFile 组装客户端模式接口的 wg-quick 配置
+func (s *WireGuardService) clientConfFile(ctx context.Context, iface *models.WireGuardInterface) (*wgconf.File, error) {
+	if strings.TrimSpace(iface.PrivateKey) == "" {
+		return nil, errors.New("interface private key missing")
+	}
+	f := &wgconf.File{
+		Interface: wgconf.Interface{
+			PrivateKey: strings.TrimSpace(iface.PrivateKey),
+			Address:    splitCSV(iface.Address),
+			ListenPort: iface.ListenPort,
+			MTU:        iface.MTU,
+			DNS:        splitCSV(iface.DNS),
+			PreUp:      hookLines(iface.PreUp),
+			PostUp:     hookLines(iface.PostUp),
+			PreDown:    hookLines(iface.PreDown),
+			PostDown:   hookLines(iface.PostDown),
+		},
+	}
+	r, err := s.store.Remotes().Get(ctx, iface.ID)
+	if errors.Is(err, repository.ErrNotFound) {
+		return f, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if r.Table != models.RouteTableAuto {
+		f.Interface.Table = r.Table
+	}
+	if r.FwMark != 0 {
+		f.Interface.FwMark = strconv.Itoa(r.FwMark)
+	}
+	f.Peers = []wgconf.Peer{{
+		PublicKey:           r.PublicKey,
+		PresharedKey:        r.PresharedKey,
+		AllowedIPs:          splitCSV(r.AllowedIPs),
+		Endpoint:            r.Endpoint,
+		PersistentKeepalive: r.PersistentKeepalive,
+	}}
+	return f, nil
+}
+
+/* -------------------- 握手监控与重连 -------------------- */
+
+// clientHealth 是客户端接口的监控状态，只保存在内存中（服务重启后重新计）
+type clientHealth struct {
+	since         time.Time // 本次下发的时间，握手超时从这里起算
+	unhealthy     bool
+	reconnects    int
+	lastReconnect time.Time
+}
+
+func (s *WireGuardService) resetClientHealth(id int) {
+	s.clientMu.Lock()
+	defer s.clientMu.Unlock()
+	if s.clients == nil {
+		s.clients = map[int]*clientHealth{}
+	}
+	s.clients[id] = &clientHealth{since: time.Now()}
+}
+
+func (s *WireGuardService) dropClientHealth(id int) {
+	s.clientMu.Lock()
+	defer s.clientMu.Unlock()
+	delete(s.clients, id)
+}
+
+// clientHealthOf 返回监控状态的副本；没有记录时（如服务重启后）从现在起算
+func (s *WireGuardService) clientHealthOf(id int) clientHealth {
+	s.clientMu.Lock()
+	defer s.clientMu.Unlock()
+	if s.clients == nil {
+		s.clients = map[int]*clientHealth{}
+	}
+	h, ok := s.clients[id]
+	if !ok {
+		h = &clientHealth{since: time.Now()}
+		s.clients[id] = h
+	}
+	return *h
+}
+
+func (s *WireGuardService) updateClientHealth(id int, fn func(h *clientHealth)) {
+	s.clientMu.Lock()
+	defer s.clientMu.Unlock()
+	if h, ok := s.clients[id]; ok {
+		fn(h)
+	}
+}
+
+// remotePeer 读取设备中远端 peer 的实时状态
+func (s *WireGuardService) remotePeer(name, publicKey string) (*wgtypes.Peer, error) {
+	c, err := s.wgClient()
+	if err != nil {
+		return nil, err
+	}
+	dev, err := c.Device(name)
+	if err != nil {
+		return nil, err
+	}
+	for i := range dev.Peers {
+		if dev.Peers[i].PublicKey.String() == publicKey {
+			return &dev.Peers[i], nil
+		}
+	}
+	return nil, fmt.Errorf("remote peer not configured on %s", name)
+}
+
+// GetClientStatus 返回客户端模式接口的握手健康与重连情况
+func (s *WireGuardService) GetClientStatus(ctx context.Context, id int) (*models.ClientStatus, error) {
+	r, err := s.GetClientRemote(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	it, err := s.store.Interfaces().Get(ctx, id)
+	if err != nil {
+		return nil, mapRepoErr(err, "interface")
+	}
+	st := &models.ClientStatus{InterfaceID: id, Endpoint: r.Endpoint}
+	if it.Status != "running" {
+		return st, nil
+	}
+	st.Running = true
+	h := s.clientHealthOf(id)
+	st.Reconnects = h.reconnects
+	if !h.lastReconnect.IsZero() {
+		t := h.lastReconnect
+		st.LastReconnect = &t
+	}
+	p, err := s.remotePeer(it.Name, r.PublicKey)
+	if err != nil {
+		return st, nil // 链路不在（被外部删除）时只返回配置
+	}
+	if p.Endpoint != nil {
+		st.ResolvedEndpoint = p.Endpoint.String()
+	}
+	if !p.LastHandshakeTime.IsZero() {
+		t := p.LastHandshakeTime
+		st.LastHandshake = &t
+		st.Healthy = time.Since(t) < clientHandshakeTimeout
+	}
+	st.BytesReceived, st.BytesSent = p.ReceiveBytes, p.TransmitBytes
+	return st, nil
+}
+
+// RunClientMonitor 定时检查运行中的客户端接口：握手超时后重新解析 endpoint，地址变化时只更新该 peer
+func (s *WireGuardService) RunClientMonitor(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		interval = defaultClientMonitorInterval
+	}
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			s.checkClients(ctx)
+		}
+	}
+}
+
+func (s *WireGuardService) checkClients(ctx context.Context) {
+	list, err := s.store.Interfaces().List(ctx)
+	if err != nil {
+		log.Printf("[client] list interfaces: %v", err)
+		return
+	}
+	for i := range list {
+		it := &list[i]
+		if it.Mode != models.InterfaceModeClient || it.Status != "running" {
+			continue
+		}
+		if err := s.checkClient(ctx, it); err != nil {
+			log.Printf("[client] %s: %v", it.Name, err)
+		}
+	}
+}
+
+func (s *WireGuardService) checkClient(ctx context.Context, it *models.WireGuardInterface) error {
+	r, err := s.store.Remotes().Get(ctx, it.ID)
+	if err != nil {
+		return err
+	}
+	p, err := s.remotePeer(it.Name, r.PublicKey)
+	if err != nil {
+		return err
+	}
+	h := s.clientHealthOf(it.ID)
+	last := p.LastHandshakeTime
+	if last.Before(h.since) {
+		last = h.since // 刚下发：给一次完整的握手超时
+	}
+	if time.Since(last) < clientHandshakeTimeout {
+		if h.unhealthy {
+			s.updateClientHealth(it.ID, func(h *clientHealth) { h.unhealthy = false })
+			s.recordEvent(ctx, it.ID, models.EventHandshake, true,
+				fmt.Sprintf("handshake with %s restored", r.Endpoint), "")
+		}
+		return nil
+	}
+
+	// 握手超时：重新解析 endpoint（对端换了地址的常见原因）
+	var cur string
+	if p.Endpoint != nil {
+		cur = p.Endpoint.String()
+	}
+	ep, rerr := resolveEndpoint(ctx, r.Endpoint)
+	switch {
+	case rerr != nil:
+		if !h.unhealthy {
+			s.recordEvent(ctx, it.ID, models.EventHandshake, false,
+				fmt.Sprintf("no handshake since %s; re-resolving %s failed: %v", describeHandshake(p.LastHandshakeTime), r.Endpoint, rerr), "")
+		}
+	case ep.String() != cur:
+		c, err := s.wgClient()
+		if err != nil {
+			return err
+		}
+		err = c.ConfigureDevice(it.Name, wgtypes.Config{Peers: []wgtypes.PeerConfig{{
+			PublicKey:  p.PublicKey,
+			UpdateOnly: true,
+			Endpoint:   ep,
+		}}})
+		if err != nil {
+			s.recordEvent(ctx, it.ID, models.EventHandshake, false,
+				fmt.Sprintf("update endpoint %s -> %s failed: %v", cur, ep, err), "")
+			return err
+		}
+		s.updateClientHealth(it.ID, func(h *clientHealth) {
+			h.reconnects++
+			h.lastReconnect = time.Now()
+			h.since = time.Now() // 新地址同样给一次完整的握手超时
+		})
+		s.recordEvent(ctx, it.ID, models.EventHandshake, true,
+			fmt.Sprintf("no handshake since %s; %s re-resolved, endpoint %s -> %s", describeHandshake(p.LastHandshakeTime), r.Endpoint, cur, ep), "")
+	default:
+		if !h.unhealthy {
+			s.recordEvent(ctx, it.ID, models.EventHandshake, false,
+				fmt.Sprintf("no handshake since %s; endpoint %s unchanged (%s)", describeHandshake(p.LastHandshakeTime), r.Endpoint, cur), "")
+		}
+	}
+	s.updateClientHealth(it.ID, func(h *clientHealth) { h.unhealthy = true })
+	return nil
+}
+
+func describeHandshake(t time.Time) string {
+	if t.IsZero() {
+		return "start"
+	}
+	return t.UTC().Format(time.RFC3339)
+}
+
+/* -------------------- 模式约束 -------------------- */
+
+// checkPeerHost 客户端模式接口只有一个远端（/remote），不能再添加 peer
+func checkPeerHost(it *models.WireGuardInterface) error {
+	if it.Mode == models.InterfaceModeClient {
+		return fmt.Errorf("%w: interface %s is in client mode; configure its remote instead of adding peers", ErrBadRequest, it.Name)
+	}
+	return nil
+}
+
+// checkModeChange 在事务内校验模式切换：改为客户端模式前须先删除所有 peer；改回服务端模式时丢弃远端配置
+func checkModeChange(ctx context.Context, tx repository.Store, it *models.WireGuardInterface) error {
+	cur, err := tx.Interfaces().Get(ctx, it.ID)
+	if err != nil {
+		return mapRepoErr(err, "interface")
+	}
+	if cur.Mode == it.Mode {
+		return nil
+	}
+	if it.Mode == models.InterfaceModeClient {
+		peers, err := tx.Peers().ListByInterface(ctx, it.ID)
+		if err != nil {
+			return err
+		}
+		if len(peers) > 0 {
+			return fmt.Errorf("%w: interface %s has %d peers; remove them before switching to client mode", ErrConflict, it.Name, len(peers))
+		}
+		return nil
+	}
+	return tx.Remotes().Delete(ctx, it.ID)
+}
+
+/* -------------------- 导入 -------------------- */
+
+// remoteFromConf 把客户端配置（如 VPN 服务商下发的 .conf）中唯一的 [Peer] 转为远端
+func remoteFromConf(conf *wgconf.File) (*models.ClientRemote, error) {
+	if len(conf.Peers) != 1 {
+		return nil, fmt.Errorf("%w: client mode expects exactly one [Peer], got %d", ErrBadRequest, len(conf.Peers))
+	}
+	cp := conf.Peers[0]
+	if cp.Endpoint == "" {
+		return nil, fmt.Errorf("%w: [Peer] Endpoint is required in client mode", ErrBadRequest)
+	}
+	req := &models.ClientRemoteRequest{
+		PublicKey:           cp.PublicKey,
+		PresharedKey:        &cp.PresharedKey,
+		Endpoint:            cp.Endpoint,
+		AllowedIPs:          strings.Join(cp.AllowedIPs, ", "),
+		PersistentKeepalive: &cp.PersistentKeepalive,
+		Table:               conf.Interface.Table,
+	}
+	if fm := strings.TrimSpace(conf.Interface.FwMark); fm != "" && fm != "off" {
+		n, err := strconv.ParseUint(fm, 0, 32)
+		if err != nil {
+			return nil, fmt.Errorf("%w: invalid FwMark %q", ErrBadRequest, fm)
+		}
+		req.FwMark = int(n)
+	}
+	return normalizeClientRemote(0, nil, req)
+}
+
+// importRemote 按导入策略写入远端，结果作为一行 peer 记录在报告中
+func importRemote(ctx context.Context, tx repository.Store, it *models.WireGuardInterface,
+	r *models.ClientRemote, exists bool, policy string, rep *ImportReport) error {
+	res := ImportPeerResult{Name: "remote", PublicKey: r.PublicKey, Action: "create"}
+	r.InterfaceID = it.ID
+	cur, err := tx.Remotes().Get(ctx, it.ID)
+	switch {
+	case errors.Is(err, repository.ErrNotFound):
+	case err != nil:
+		return err
+	case policy == ImportSkip && exists:
+		res.Action = "skip"
+	default:
+		res.Action = "update"
+		res.Fields = remoteChanges(cur, r)
+		if len(res.Fields) == 0 {
+			res.Action = "unchanged"
+		}
+	}
+	rep.Peers = append(rep.Peers, res)
+	if res.Action == "skip" || res.Action == "unchanged" {
+		return nil
+	}
+	return tx.Remotes().Save(ctx, r)
+}
+
+func remoteChanges(a, b *models.ClientRemote) []string {
+	var fields []string
+	for _, f := range []struct {
+		name string
+		diff bool
+	}{
+		{"public_key", a.PublicKey != b.PublicKey},
+		{"preshared_key", a.PresharedKey != b.PresharedKey},
+		{"endpoint", a.Endpoint != b.Endpoint},
+		{"allowed_ips", a.AllowedIPs != b.AllowedIPs},
+		{"persistent_keepalive", a.PersistentKeepalive != b.PersistentKeepalive},
+		{"table", a.Table != b.Table},
+		{"fwmark", a.FwMark != b.FwMark},
+	} {
+		if f.diff {
+			fields = append(fields, f.name)
+		}
+	}
+	return fields
+}
+
+// freeListenPort 为没有 ListenPort 的客户端配置选一个未被其他接口占用的端口
+func freeListenPort(ctx context.Context, store repository.Store) (int, error) {
+	list, err := store.Interfaces().List(ctx)
+	if err != nil {
+		return 0, err
+	}
+	used := map[int]bool{}
+	for _, it := range list {
+		used[it.ListenPort] = true
+	}
+	for p := 51820; p <= 65535; p++ {
+		if !used[p] {
+			return p, nil
+		}
+	}
+	return 0, fmt.Errorf("%w: no free listen port", ErrConflict)
+}
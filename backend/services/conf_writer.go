@@ -0,0 +1,220 @@
+package services
+
+import (
+	"backend/models"
+	"backend/repository"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// 写出文件的头部说明；计入校验和
+const confHeader = "# Managed by wg-manager. Manual edits are detected and will not be overwritten.\n\n"
+
+// ConfDriftError 表示磁盘上的 .conf 被手工修改过（或不是本管理器写出的），拒绝覆盖
+type ConfDriftError struct {
+	Path string
+	Diff string // 磁盘内容 -> 将要写出的内容
+}
+
+func (e *ConfDriftError) Error() string {
+	return fmt.Sprintf("%s was modified outside the manager, refusing to overwrite", e.Path)
+}
+
+func (e *ConfDriftError) Unwrap() error { return ErrConflict }
+
+type ConfFileStatus struct {
+	Path       string     `json:"path"`
+	Exists     bool       `json:"exists"`
+	Managed    bool       `json:"managed"`     // 有本管理器的写出记录
+	InSync     bool       `json:"in_sync"`     // 磁盘内容与当前配置一致
+	HandEdited bool       `json:"hand_edited"` // 磁盘内容与最后一次写出不一致
+	WrittenAt  *time.Time `json:"written_at,omitempty"`
+	Diff       string     `json:"diff,omitempty"`
+	Backup     string     `json:"backup,omitempty"` // 本次写入前保留的旧文件
+}
+
+// ConfWriter 把接口配置以 wg-quick 格式写入 <dir>/<name>.conf
+type ConfWriter struct {
+	dir   string
+	store repository.Store
+	mu    sync.Mutex
+}
+
+func NewConfWriter(dir string, store repository.Store) *ConfWriter {
+	return &ConfWriter{dir: dir, store: store}
+}
+
+// path 返回 <dir>/<name>.conf；不是合法接口名（如含 "/" 或 ".."）时拒绝，避免写到目录之外
+func (w *ConfWriter) path(name string) (string, error) {
+	if err := checkInterfaceName(name); err != nil {
+		return "", err
+	}
+	return filepath.Join(w.dir, name+".conf"), nil
+}
+
+func sha256Hex(b []byte) string {
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
+
+// inspect 读取磁盘现状；rendered 为将要写出的完整内容
+func (w *ConfWriter) inspect(ctx context.Context, name, rendered string) (*ConfFileStatus, []byte, error) {
+	path, err := w.path(name)
+	if err != nil {
+		return nil, nil, err
+	}
+	st := &ConfFileStatus{Path: path}
+	cur, err := os.ReadFile(st.Path)
+	switch {
+	case err == nil:
+		st.Exists = true
+	case errors.Is(err, os.ErrNotExist):
+	default:
+		return nil, nil, err
+	}
+
+	rec, err := w.store.RenderedConfigs().Get(ctx, name)
+	switch {
+	case err == nil:
+		st.Managed = true
+		t := rec.WrittenAt
+		st.WrittenAt = &t
+	case errors.Is(err, repository.ErrNotFound):
+	default:
+		return nil, nil, err
+	}
+
+	st.InSync = st.Exists && string(cur) == rendered
+	// 没有写出记录的现存文件同样视为手工维护
+	st.HandEdited = st.Exists && (rec == nil || rec.SHA256 != sha256Hex(cur))
+	if !st.InSync {
+		st.Diff = unifiedDiff(st.Path+" (on disk)", st.Path+" (managed)", string(cur), rendered)
+	}
+	return st, cur, nil
+}
+
+// Status 对比磁盘文件与 content 对应的渲染结果
+func (w *ConfWriter) Status(ctx context.Context, name, content string) (*ConfFileStatus, error) {
+	st, _, err := w.inspect(ctx, name, confHeader+content)
+	return st, err
+}
+
+// Write 原子写入 <name>.conf；文件被手工修改时返回 *ConfDriftError，force 为 true 时备份后覆盖
+func (w *ConfWriter) Write(ctx context.Context, name, content string, force bool) (*ConfFileStatus, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	rendered := confHeader + content
+	st, cur, err := w.inspect(ctx, name, rendered)
+	if err != nil {
+		return nil, err
+	}
+	if st.InSync {
+		// 内容一致（可能是手工改成了同样的内容），只刷新记录
+		st.HandEdited, st.Managed = false, true
+		return st, w.record(ctx, name, []byte(rendered))
+	}
+	if st.HandEdited && !force {
+		return st, &ConfDriftError{Path: st.Path, Diff: st.Diff}
+	}
+
+	if err := os.MkdirAll(w.dir, 0o700); err != nil {
+		return nil, err
+	}
+	if st.Exists {
+		st.Backup = st.Path + ".bak"
+		if err := writeFileAtomic(st.Backup, cur, 0o600); err != nil {
+			return nil, fmt.Errorf("backup %s: %w", st.Path, err)
+		}
+	}
+	if err := writeFileAtomic(st.Path, []byte(rendered), 0o600); err != nil {
+		return nil, err
+	}
+	if err := w.record(ctx, name, []byte(rendered)); err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	st.Exists, st.Managed, st.InSync, st.HandEdited, st.WrittenAt = true, true, true, false, &now
+	st.Diff = ""
+	return st, nil
+}
+
+// Remove 删除 <name>.conf（先备份）；手工修改过的文件同样需要 force
+func (w *ConfWriter) Remove(ctx context.Context, name string, force bool) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	st, cur, err := w.inspect(ctx, name, "")
+	if err != nil {
+		return err
+	}
+	if st.Exists {
+		if st.HandEdited && !force {
+			return &ConfDriftError{Path: st.Path, Diff: st.Diff}
+		}
+		if err := writeFileAtomic(st.Path+".bak", cur, 0o600); err != nil {
+			return fmt.Errorf("backup %s: %w", st.Path, err)
+		}
+		if err := os.Remove(st.Path); err != nil {
+			return err
+		}
+		if err := syncDir(w.dir); err != nil {
+			return err
+		}
+	}
+	return w.store.RenderedConfigs().Delete(ctx, name)
+}
+
+func (w *ConfWriter) record(ctx context.Context, name string, data []byte) error {
+	return w.store.RenderedConfigs().Upsert(ctx, &models.RenderedConfig{
+		Name:      name,
+		SHA256:    sha256Hex(data),
+		WrittenAt: time.Now(),
+	})
+}
+
+// writeFileAtomic 写临时文件 -> fsync -> rename -> fsync 目录，读者只会看到旧文件或完整的新文件
+func writeFileAtomic(path string, data []byte, perm os.FileMode) error {
+	dir := filepath.Dir(path)
+	tmp, err := os.CreateTemp(dir, "."+filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name()) // rename 成功后为 no-op
+
+	if err := tmp.Chmod(perm); err != nil {
+		tmp.Close()
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return err
+	}
+	return syncDir(dir)
+}
+
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
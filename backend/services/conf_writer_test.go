@@ -0,0 +1,63 @@
+package services
+
+import (
+	"backend/models"
+	"backend/repository"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestInterfaceNameValidation 确认接口名无法把 .conf 写到目录之外
+func TestInterfaceNameValidation(t *testing.T) {
+	root := t.TempDir()
+	dir := filepath.Join(root, "wireguard")
+	w := NewConfWriter(dir, repository.NewMemoryStore())
+	wg := newTestService(t)
+
+	tests := []struct {
+		name    string
+		wantErr bool
+	}{
+		{name: "wg0"},
+		{name: "wg-office.2"},
+		{name: "", wantErr: true},
+		{name: "..", wantErr: true},
+		{name: "../x", wantErr: true},
+		{name: "../../etc/x", wantErr: true},
+		{name: "a/b", wantErr: true},
+		{name: "wg0 ", wantErr: true},
+		{name: "waytoolonginterface", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := w.Write(context.Background(), tt.name, "[Interface]\n", false)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Write err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr {
+				return
+			}
+			if !errors.Is(err, ErrBadRequest) {
+				t.Fatalf("Write err = %v, want ErrBadRequest", err)
+			}
+			_, err = wg.CreateInterface(models.CreateInterfaceRequest{Name: tt.name, Address: "10.77.0.1/24", ListenPort: 51877})
+			if !errors.Is(err, ErrBadRequest) {
+				t.Fatalf("CreateInterface err = %v, want ErrBadRequest", err)
+			}
+			_, err = wg.UpdateInterface(1, models.UpdateInterfaceRequest{Name: tt.name, Address: "10.77.0.1/24", ListenPort: 51877})
+			if !errors.Is(err, ErrBadRequest) {
+				t.Fatalf("UpdateInterface err = %v, want ErrBadRequest", err)
+			}
+		})
+	}
+	entries, err := os.ReadDir(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Name() != "wireguard" {
+		t.Errorf("files outside the conf dir: %v", entries)
+	}
+}
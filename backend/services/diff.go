@@ -0,0 +1,112 @@
+package services
+
+import (
+	"fmt"
+	"strings"
+)
+
+// 超过该行数不做逐行对比，避免 O(n*m) 的内存占用
+const maxDiffLines = 4000
+
+// unifiedDiff 生成按行的 unified diff（3 行上下文）；内容相同返回空串
+func unifiedDiff(fromName, toName, from, to string) string {
+	if from == to {
+		return ""
+	}
+	a := splitLines(from)
+	b := splitLines(to)
+	if len(a) > maxDiffLines || len(b) > maxDiffLines {
+		return fmt.Sprintf("--- %s\n+++ %s\n@@ files too large to diff (%d vs %d lines) @@\n", fromName, toName, len(a), len(b))
+	}
+
+	// LCS 长度表：lcs[i][j] = a[i:] 与 b[j:] 的最长公共子序列
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	type op struct {
+		kind byte // ' ' / '-' / '+'
+		text string
+		ai   int // 该行在 a 中的行号（0 起）
+		bi   int
+	}
+	var ops []op
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			ops = append(ops, op{' ', a[i], i, j})
+			i++
+			j++
+		case j < len(b) && (i == len(a) || lcs[i][j+1] >= lcs[i+1][j]):
+			ops = append(ops, op{'+', b[j], i, j})
+			j++
+		default:
+			ops = append(ops, op{'-', a[i], i, j})
+			i++
+		}
+	}
+
+	const ctx = 3
+	var out strings.Builder
+	fmt.Fprintf(&out, "--- %s\n+++ %s\n", fromName, toName)
+	for k := 0; k < len(ops); {
+		if ops[k].kind == ' ' {
+			k++
+			continue
+		}
+		// 找出本段变更的范围，相距不超过 2*ctx 的变更合并为一个 hunk
+		start := max(k-ctx, 0)
+		end := k
+		for end < len(ops) {
+			if ops[end].kind != ' ' {
+				end++
+				continue
+			}
+			n := end
+			for n < len(ops) && ops[n].kind == ' ' {
+				n++
+			}
+			if n == len(ops) || n-end > 2*ctx {
+				break
+			}
+			end = n
+		}
+		end = min(end+ctx, len(ops))
+
+		aStart, bStart, aLen, bLen := ops[start].ai, ops[start].bi, 0, 0
+		for _, o := range ops[start:end] {
+			if o.kind != '+' {
+				aLen++
+			}
+			if o.kind != '-' {
+				bLen++
+			}
+		}
+		fmt.Fprintf(&out, "@@ -%d,%d +%d,%d @@\n", aStart+1, aLen, bStart+1, bLen)
+		for _, o := range ops[start:end] {
+			out.WriteByte(o.kind)
+			out.WriteString(o.text)
+			out.WriteByte('\n')
+		}
+		k = end
+	}
+	return out.String()
+}
+
+func splitLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(s, "\n"), "\n")
+}
@@ -0,0 +1,182 @@
+package services
+
+import (
+	"backend/models"
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"net/netip"
+	"strings"
+	"time"
+
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+)
+
+const (
+	defaultEndpointResolveInterval = time.Minute
+	// 最近握手在该时间内的 peer 不重新解析（同 wireguard-tools 的 reresolve-dns.sh）
+	endpointResolveHandshakeAge = 135 * time.Second
+)
+
+// EndpointChange 是一次重新解析的结果；只报告地址变化或解析失败的 peer
+type EndpointChange struct {
+	PeerID   int    `json:"peer_id"`
+	PeerName string `json:"peer_name"`
+	Endpoint string `json:"endpoint"` // 配置的 host:port
+	From     string `json:"from"`     // 内核中原来的地址
+	To       string `json:"to,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+
+// endpointHasHostname 判断 endpoint 是否为主机名（地址字面量无需重新解析）
+func endpointHasHostname(ep string) bool {
+	host, _, err := net.SplitHostPort(strings.TrimSpace(ep))
+	if err != nil || host == "" {
+		return false
+	}
+	_, err = netip.ParseAddr(host)
+	return err != nil
+}
+
+// RunEndpointResolver 定时重新解析运行中接口上以主机名配置 endpoint 的 peer（动态 DNS）
+func (s *WireGuardService) RunEndpointResolver(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		interval = defaultEndpointResolveInterval
+	}
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			s.resolveAllEndpoints(ctx)
+		}
+	}
+}
+
+func (s *WireGuardService) resolveAllEndpoints(ctx context.Context) {
+	list, err := s.store.Interfaces().List(ctx)
+	if err != nil {
+		log.Printf("[endpoint] list interfaces: %v", err)
+		return
+	}
+	for i := range list {
+		it := &list[i]
+		if it.Status != "running" || it.Mode == models.InterfaceModeClient {
+			continue // 客户端模式的远端由握手监控负责
+		}
+		if _, err := s.reresolveEndpoints(ctx, it, false); err != nil {
+			log.Printf("[endpoint] %s: %v", it.Name, err)
+		}
+	}
+}
+
+// ReresolveEndpoints 立即重新解析接口上全部主机名 endpoint（不看最近握手）
+func (s *WireGuardService) ReresolveEndpoints(ctx context.Context, interfaceID int) ([]EndpointChange, error) {
+	it, err := s.store.Interfaces().Get(ctx, interfaceID)
+	if err != nil {
+		return nil, mapRepoErr(err, "interface")
+	}
+	if it.Mode == models.InterfaceModeClient {
+		return nil, fmt.Errorf("%w: interface %s is in client mode; its remote is re-resolved by the handshake monitor", ErrBadRequest, it.Name)
+	}
+	if it.Status != "running" {
+		return nil, fmt.Errorf("%w: interface %s is not running", ErrConflict, it.Name)
+	}
+	changes, err := s.reresolveEndpoints(ctx, it, true)
+	if err != nil {
+		return nil, err
+	}
+	if changes == nil {
+		changes = []EndpointChange{}
+	}
+	return changes, nil
+}
+
+// reresolveEndpoints 解析主机名 endpoint，地址与内核中不同时只更新该 peer 的 endpoint；
+// force 为 false 时跳过最近握手过的 peer（连接正常，无需打扰）
+func (s *WireGuardService) reresolveEndpoints(ctx context.Context, it *models.WireGuardInterface, force bool) ([]EndpointChange, error) {
+	peers, err := s.store.Peers().ListByInterface(ctx, it.ID)
+	if err != nil {
+		return nil, err
+	}
+	var todo []models.WireGuardPeer
+	for _, p := range peers {
+		if !p.Disabled && endpointHasHostname(p.Endpoint) {
+			todo = append(todo, p)
+		}
+	}
+	if len(todo) == 0 {
+		return nil, nil
+	}
+
+	c, err := s.wgClient()
+	if err != nil {
+		return nil, err
+	}
+	dev, err := c.Device(it.Name)
+	if err != nil {
+		return nil, fmt.Errorf("read device: %w", err)
+	}
+	live := make(map[string]*wgtypes.Peer, len(dev.Peers))
+	for i := range dev.Peers {
+		live[dev.Peers[i].PublicKey.String()] = &dev.Peers[i]
+	}
+
+	var changes []EndpointChange
+	for _, p := range todo {
+		kp, ok := live[p.PublicKey]
+		if !ok {
+			continue // 尚未下发（如刚创建、等待 apply）
+		}
+		if !force && !kp.LastHandshakeTime.IsZero() && time.Since(kp.LastHandshakeTime) < endpointResolveHandshakeAge {
+			continue
+		}
+		ch := EndpointChange{PeerID: p.ID, PeerName: p.Name, Endpoint: p.Endpoint}
+		if kp.Endpoint != nil {
+			ch.From = kp.Endpoint.String()
+		}
+		ua, err := resolveEndpoint(ctx, p.Endpoint)
+		if err != nil {
+			ch.Error = err.Error()
+			changes = append(changes, ch)
+			continue
+		}
+		ch.To = ua.String()
+		if ch.To == ch.From {
+			if p.ResolvedEndpoint != ch.To {
+				_ = s.store.Peers().SetResolvedEndpoint(ctx, p.ID, ch.To)
+			}
+			continue
+		}
+
+		err = c.ConfigureDevice(it.Name, wgtypes.Config{Peers: []wgtypes.PeerConfig{{
+			PublicKey:  kp.PublicKey,
+			UpdateOnly: true,
+			Endpoint:   ua,
+		}}})
+		if err != nil {
+			ch.Error = fmt.Sprintf("update endpoint: %v", err)
+			s.recordEvent(ctx, it.ID, models.EventEndpoint, false,
+				fmt.Sprintf("peer %s: %s re-resolved to %s, update failed: %v", p.Name, p.Endpoint, ch.To, err), "")
+			changes = append(changes, ch)
+			continue
+		}
+		if err := s.store.Peers().SetResolvedEndpoint(ctx, p.ID, ch.To); err != nil {
+			log.Printf("[endpoint] peer %d: %v", p.ID, err)
+		}
+		s.recordEvent(ctx, it.ID, models.EventEndpoint, true,
+			fmt.Sprintf("peer %s: %s re-resolved, endpoint %s -> %s", p.Name, p.Endpoint, orNone(ch.From), ch.To), "")
+		changes = append(changes, ch)
+	}
+	return changes, nil
+}
+
+func orNone(s string) string {
+	if s == "" {
+		return "(none)"
+	}
+	return s
+}
@@ -0,0 +1,495 @@
+package services
+
+import (
+	"backend/cidrset"
+	"backend/models"
+	"backend/repository"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/netip"
+	"os/exec"
+	"strings"
+)
+
+/* -------------------- nftables 后端 -------------------- */
+
+// firewallTable 是管理器独占的 nftables 表；每次整体重建，不触碰其他表
+const firewallTable = "wg_manager"
+
+// Firewall 把规则下发到内核；默认实现调用 nft，非 Linux 环境或测试时可替换/关闭
+type Firewall interface {
+	// Apply 原子地执行一段 nft 脚本（nft -f）
+	Apply(script string) error
+	// Ruleset 返回内核中管理表的当前内容；表不存在时返回空串
+	Ruleset() (string, error)
+	// ForwardConflicts 列出其他表中 policy drop 的 forward 链；管理表里的 accept 只在本表生效，
+	// 数据包仍会被这些链丢弃（如 docker/ufw 把 iptables FORWARD 策略设为 DROP）
+	ForwardConflicts() ([]string, error)
+}
+
+type nftFirewall struct{}
+
+func NewNFTFirewall() Firewall { return nftFirewall{} }
+
+func (nftFirewall) Apply(script string) error {
+	cmd := exec.Command("nft", "-f", "-")
+	cmd.Stdin = strings.NewReader(script)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("nft -f: %w (%s)", err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+func (nftFirewall) Ruleset() (string, error) {
+	out, err := exec.Command("nft", "list", "table", "inet", firewallTable).CombinedOutput()
+	if err != nil {
+		if strings.Contains(string(out), "No such file or directory") {
+			return "", nil
+		}
+		return "", fmt.Errorf("nft list table: %v (%s)", err, strings.TrimSpace(string(out)))
+	}
+	return string(out), nil
+}
+
+func (nftFirewall) ForwardConflicts() ([]string, error) {
+	out, err := exec.Command("nft", "list", "chains").CombinedOutput()
+	if err != nil {
+		return nil, fmt.Errorf("nft list chains: %v (%s)", err, strings.TrimSpace(string(out)))
+	}
+	conflicts := forwardDropChains(string(out))
+	// iptables-legacy 的规则不在 nftables 中，nft 看不到，单独检查
+	if out, err := exec.Command("iptables-legacy", "-S", "FORWARD").Output(); err == nil {
+		if strings.Contains(string(out), "-P FORWARD DROP") {
+			conflicts = append(conflicts, "iptables-legacy filter FORWARD")
+		}
+	}
+	return conflicts, nil
+}
+
+// forwardDropChains 从 nft list chains 的输出中找出管理表以外 hook forward 且 policy drop 的链
+func forwardDropChains(listing string) []string {
+	var out []string
+	var table, chain string
+	for _, line := range strings.Split(listing, "\n") {
+		f := strings.Fields(line)
+		switch {
+		case len(f) >= 3 && f[0] == "table":
+			table, chain = f[1]+" "+f[2], ""
+		case len(f) >= 2 && f[0] == "chain":
+			chain = f[1]
+		case chain != "" && table != "inet "+firewallTable &&
+			strings.Contains(line, "hook forward") && strings.Contains(line, "policy drop"):
+			out = append(out, table+" "+chain)
+		}
+	}
+	return out
+}
+
+// SetFirewall 替换防火墙后端；nil 表示不管理 NAT/转发规则（设置仍可保存）
+func (s *WireGuardService) SetFirewall(f Firewall) {
+	s.firewall = f
+}
+
+/* -------------------- 规则生成 -------------------- */
+
+// firewallPlan 是管理表的全部内容：具名集合、ACL 链及两条基础链的规则
+type firewallPlan struct {
+	Sets    []string   // 完整的 set 定义
+	Chains  []nftChain // 普通链（每个接口一条 ACL 链）
+	ACL     []string   // forward 链开头的 ACL 跳转，先于网关规则
+	Forward []string
+	NAT     []string
+}
+
+// nftChain 是不挂钩子的普通链，只能被跳转
+type nftChain struct {
+	Name  string
+	Rules []string
+}
+
+func (p *firewallPlan) add(r *gatewayRules) {
+	p.Forward = append(p.Forward, r.Forward...)
+	p.NAT = append(p.NAT, r.NAT...)
+}
+
+func (p *firewallPlan) empty() bool {
+	return len(p.ACL)+len(p.Forward)+len(p.NAT) == 0
+}
+
+// script 生成整张管理表：先声明再删除（表不存在时 delete 也不报错），然后重建；
+// nft -f 在一个事务内执行整段脚本，重复下发结果相同，没有规则时只删表
+func (p *firewallPlan) script() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "table inet %s {}\ndelete table inet %s\n", firewallTable, firewallTable)
+	if p.empty() {
+		return b.String()
+	}
+	fmt.Fprintf(&b, "table inet %s {\n", firewallTable)
+	for _, set := range p.Sets {
+		b.WriteString(set)
+	}
+	for _, c := range p.Chains {
+		b.WriteString("\tchain " + c.Name + " {\n")
+		for _, r := range c.Rules {
+			b.WriteString("\t\t" + r + "\n")
+		}
+		b.WriteString("\t}\n")
+	}
+	// 基础链策略为 accept：这里只加规则，不改变主机原有的转发策略
+	b.WriteString("\tchain forward {\n\t\ttype filter hook forward priority filter; policy accept;\n")
+	for _, r := range append(append([]string{}, p.ACL...), p.Forward...) {
+		b.WriteString("\t\t" + r + "\n")
+	}
+	b.WriteString("\t}\n")
+	b.WriteString("\tchain postrouting {\n\t\ttype nat hook postrouting priority srcnat; policy accept;\n")
+	for _, r := range p.NAT {
+		b.WriteString("\t\t" + r + "\n")
+	}
+	b.WriteString("\t}\n}\n")
+	return b.String()
+}
+
+// gatewayRules 是单个接口生成的规则
+type gatewayRules struct {
+	Forward []string `json:"forward"`
+	NAT     []string `json:"nat"`
+}
+
+// nftFamily 返回前缀对应的 nft 地址匹配关键字
+func nftFamily(p netip.Prefix) string {
+	if p.Addr().Is4() {
+		return "ip"
+	}
+	return "ip6"
+}
+
+// nftSet 把同一地址族的前缀写成 nft 的匿名集合
+func nftSet(ps []netip.Prefix) string {
+	if len(ps) == 1 {
+		return ps[0].String()
+	}
+	return "{ " + strings.Join(cidrset.Strings(ps), ", ") + " }"
+}
+
+// renderGatewayRules 生成接口的转发与 NAT 规则；每条规则带接口名注释，便于在 nft list 中辨认
+func renderGatewayRules(it *models.WireGuardInterface, g *models.InterfaceGateway) (*gatewayRules, error) {
+	// 接口名直接写入 nft 脚本，必须是合法网卡名
+	if !ifaceNameRe.MatchString(it.Name) {
+		return nil, fmt.Errorf("%w: invalid interface name %q", ErrBadRequest, it.Name)
+	}
+	fams, err := parseInterfaceAddress(it.Address)
+	if err != nil {
+		return nil, err
+	}
+	lanSrc := g.LANCIDRs
+	if strings.TrimSpace(lanSrc) == "" {
+		lanSrc = defaultLANExcluded
+	}
+	lan, err := cidrset.Parse(lanSrc)
+	if err != nil {
+		return nil, fmt.Errorf("%w: lan_cidrs: %v", ErrBadRequest, err)
+	}
+
+	wg := fmt.Sprintf("%q", it.Name)
+	comment := fmt.Sprintf(" comment %q", it.Name)
+	out := &gatewayRules{}
+
+	// 1) WG 网段 <-> LAN：两个方向都处理，同接口 peer 之间的流量不受影响
+	verdict := "accept"
+	if g.LANForward == models.ForwardDeny {
+		verdict = "drop"
+	}
+	for _, fam := range []string{"ip", "ip6"} {
+		var ps []netip.Prefix
+		for _, p := range lan {
+			if nftFamily(p) == fam {
+				ps = append(ps, p)
+			}
+		}
+		if len(ps) == 0 {
+			continue
+		}
+		set := nftSet(ps)
+		out.Forward = append(out.Forward,
+			fmt.Sprintf("iifname %s oifname != %s %s daddr %s %s%s", wg, wg, fam, set, verdict, comment),
+			fmt.Sprintf("iifname != %s oifname %s %s saddr %s %s%s", wg, wg, fam, set, verdict, comment),
+		)
+	}
+
+	// 2) 出口 NAT：放行 WG -> 出口及回程，并对 WG 网段做 masquerade
+	if g.Masquerade {
+		egressOut, egressIn := "oifname != "+wg, "iifname != "+wg
+		if g.EgressInterface != "" {
+			egressOut = fmt.Sprintf("oifname %q", g.EgressInterface)
+			egressIn = fmt.Sprintf("iifname %q", g.EgressInterface)
+		}
+		out.Forward = append(out.Forward,
+			fmt.Sprintf("iifname %s %s accept%s", wg, egressOut, comment),
+			fmt.Sprintf("%s oifname %s ct state established,related accept%s", egressIn, wg, comment),
+		)
+		for _, f := range fams {
+			p := f.Prefix.Masked()
+			out.NAT = append(out.NAT,
+				fmt.Sprintf("%s saddr %s %s masquerade%s", nftFamily(p), p, egressOut, comment))
+		}
+	}
+	return out, nil
+}
+
+/* -------------------- 同步 -------------------- */
+
+// firewallPlan 汇总运行中接口的 ACL 与网关规则；既没有网关设置也没有 ACL 规则的接口不生成规则
+func (s *WireGuardService) firewallPlan(ctx context.Context) (*firewallPlan, error) {
+	ifaces, err := s.store.Interfaces().List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	plan := &firewallPlan{}
+	for i := range ifaces {
+		it := &ifaces[i]
+		if it.Status != "running" {
+			continue
+		}
+		g, err := s.store.Gateways().Get(ctx, it.ID)
+		switch {
+		case err == nil:
+		case errors.Is(err, repository.ErrNotFound):
+			g = nil
+		default:
+			return nil, err
+		}
+		rules, err := s.store.ACLs().List(ctx, it.ID)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(rules) > 0 || (g != nil && g.ACLDefault == models.ForwardDeny) {
+			peers, err := s.store.Peers().ListByInterface(ctx, it.ID)
+			if err != nil {
+				return nil, err
+			}
+			groups, err := aclGroupMembers(ctx, s.store, rules)
+			if err != nil {
+				return nil, err
+			}
+			if err := renderACL(plan, it, g, peers, groups, rules); err != nil {
+				return nil, fmt.Errorf("interface %s: %w", it.Name, err)
+			}
+		}
+		if g != nil {
+			r, err := renderGatewayRules(it, g)
+			if err != nil {
+				return nil, fmt.Errorf("interface %s: %w", it.Name, err)
+			}
+			plan.add(r)
+		}
+	}
+	return plan, nil
+}
+
+// syncFirewall 按 DB 中运行中的接口及其网关、ACL 设置重建管理表
+func (s *WireGuardService) syncFirewall(ctx context.Context) error {
+	if s.firewall == nil {
+		return nil
+	}
+	s.fwMu.Lock()
+	defer s.fwMu.Unlock()
+
+	plan, err := s.firewallPlan(ctx)
+	if err != nil {
+		return err
+	}
+	err = s.firewall.Apply(plan.script())
+	if plan.empty() && errors.Is(err, exec.ErrNotFound) {
+		// 没装 nft 也就不可能有旧表，无需删除
+		return nil
+	}
+	return err
+}
+
+// refreshFirewall 在 peer 增改后重建管理表（ACL 集合按 peer 隧道地址生成）；接口未运行时无需处理，失败只记日志
+func (s *WireGuardService) refreshFirewall(interfaceID int) {
+	ctx := context.Background()
+	if it, err := s.store.Interfaces().Get(ctx, interfaceID); err != nil || it.Status != "running" {
+		return
+	}
+	if err := s.syncFirewall(ctx); err != nil {
+		log.Printf("[firewall] sync failed: %v", err)
+	}
+}
+
+// applyGatewayRules 在接口启动后同步管理表；只有该接口配置过网关或 ACL 时失败才算启动失败，
+// 否则（如主机没有 nft）只记日志
+func (s *WireGuardService) applyGatewayRules(ctx context.Context, interfaceID int) error {
+	err := s.syncFirewall(ctx)
+	if err == nil {
+		return nil
+	}
+	_, gerr := s.store.Gateways().Get(ctx, interfaceID)
+	rules, _ := s.store.ACLs().List(ctx, interfaceID)
+	if gerr == nil || len(rules) > 0 {
+		return fmt.Errorf("firewall: %w", err)
+	}
+	log.Printf("[firewall] sync failed: %v", err)
+	return nil
+}
+
+// syncRunning 在网关/ACL 设置变更后重建管理表；接口未运行时规则本就不在表中
+func (s *WireGuardService) syncRunning(ctx context.Context, it *models.WireGuardInterface) error {
+	if it.Status != "running" {
+		return nil
+	}
+	return s.syncFirewall(ctx)
+}
+
+// SyncFirewall 立即按当前状态重建管理表（手工清理过规则后可调用）
+func (s *WireGuardService) SyncFirewall(ctx context.Context) (*FirewallStatus, error) {
+	if s.firewall == nil {
+		return nil, fmt.Errorf("%w: firewall management is disabled", ErrBadRequest)
+	}
+	if err := s.syncFirewall(ctx); err != nil {
+		return nil, err
+	}
+	return s.GetFirewallStatus(ctx)
+}
+
+// CheckFirewallConflicts 启动时检查其他表的 forward 丢弃策略，存在时记录警告
+func (s *WireGuardService) CheckFirewallConflicts() {
+	if s.firewall == nil {
+		return
+	}
+	conflicts, err := s.firewall.ForwardConflicts()
+	if err != nil {
+		log.Printf("[firewall] check forward policies: %v", err)
+		return
+	}
+	for _, c := range conflicts {
+		log.Printf("[firewall] warning: chain %s drops forwarded packets by default; "+
+			"rules in inet %s cannot override it, allow the wg interfaces there as well", c, firewallTable)
+	}
+}
+
+// FirewallStatus 对比按 DB 生成的脚本与内核中的管理表
+type FirewallStatus struct {
+	Managed bool   `json:"managed"`
+	Table   string `json:"table"`
+	Script  string `json:"script"`          // 按当前 DB 生成、会被 nft -f 执行的脚本
+	Live    string `json:"live"`            // nft list table 的输出；表不存在为空
+	Error   string `json:"error,omitempty"` // 读取内核表失败的原因
+	// 其他表中会丢弃转发流量的 forward 链（管理表的 accept 无法覆盖，需另行放行 wg 接口）
+	Conflicts []string `json:"conflicts,omitempty"`
+}
+
+func (s *WireGuardService) GetFirewallStatus(ctx context.Context) (*FirewallStatus, error) {
+	plan, err := s.firewallPlan(ctx)
+	if err != nil {
+		return nil, err
+	}
+	st := &FirewallStatus{
+		Managed: s.firewall != nil,
+		Table:   "inet " + firewallTable,
+		Script:  plan.script(),
+	}
+	if s.firewall != nil {
+		if st.Live, err = s.firewall.Ruleset(); err != nil {
+			st.Error = err.Error()
+		}
+		st.Conflicts, _ = s.firewall.ForwardConflicts()
+	}
+	return st, nil
+}
+
+/* -------------------- 网关设置 -------------------- */
+
+// GatewayStatus 是接口的网关设置及其生成的规则
+type GatewayStatus struct {
+	Gateway    models.InterfaceGateway `json:"gateway"`
+	Configured bool                    `json:"configured"` // 是否保存过设置；未保存时不生成任何规则
+	Managed    bool                    `json:"managed"`    // 是否启用防火墙管理
+	Active     bool                    `json:"active"`     // 接口运行中，规则应已在管理表中
+	Rules      gatewayRules            `json:"rules"`
+}
+
+func normalizeGateway(interfaceID int, req *models.InterfaceGatewayRequest) (*models.InterfaceGateway, error) {
+	g := &models.InterfaceGateway{
+		InterfaceID:     interfaceID,
+		Masquerade:      req.Masquerade,
+		EgressInterface: strings.TrimSpace(req.EgressInterface),
+		LANForward:      strings.ToLower(strings.TrimSpace(req.LANForward)),
+		ACLDefault:      strings.ToLower(strings.TrimSpace(req.ACLDefault)),
+	}
+	if g.EgressInterface != "" && !ifaceNameRe.MatchString(g.EgressInterface) {
+		return nil, fmt.Errorf("%w: invalid egress interface %q", ErrBadRequest, g.EgressInterface)
+	}
+	switch g.LANForward {
+	case "":
+		g.LANForward = models.ForwardAllow
+	case models.ForwardAllow, models.ForwardDeny:
+	default:
+		return nil, fmt.Errorf("%w: lan_forward must be %q or %q", ErrBadRequest, models.ForwardAllow, models.ForwardDeny)
+	}
+	switch g.ACLDefault {
+	case "":
+		g.ACLDefault = models.ForwardAllow
+	case models.ForwardAllow, models.ForwardDeny:
+	default:
+		return nil, fmt.Errorf("%w: acl_default must be %q or %q", ErrBadRequest, models.ForwardAllow, models.ForwardDeny)
+	}
+	lan, err := cidrset.Parse(req.LANCIDRs)
+	if err != nil {
+		return nil, fmt.Errorf("%w: lan_cidrs: %v", ErrBadRequest, err)
+	}
+	g.LANCIDRs = strings.Join(cidrset.Strings(lan), ", ")
+	return g, nil
+}
+
+func (s *WireGuardService) GetGateway(ctx context.Context, interfaceID int) (*GatewayStatus, error) {
+	it, err := s.store.Interfaces().Get(ctx, interfaceID)
+	if err != nil {
+		return nil, mapRepoErr(err, "interface")
+	}
+	st := &GatewayStatus{Managed: s.firewall != nil}
+	g, err := s.store.Gateways().Get(ctx, interfaceID)
+	switch {
+	case err == nil:
+		st.Gateway, st.Configured = *g, true
+	case errors.Is(err, repository.ErrNotFound):
+		st.Gateway = models.InterfaceGateway{InterfaceID: interfaceID, LANForward: models.ForwardAllow, ACLDefault: models.ForwardAllow}
+		return st, nil
+	default:
+		return nil, err
+	}
+
+	r, err := renderGatewayRules(it, g)
+	if err != nil {
+		return nil, err
+	}
+	st.Rules = *r
+	st.Active = st.Managed && it.Status == "running"
+	return st, nil
+}
+
+// SaveGateway 覆盖接口的网关设置；接口运行中时立即重建管理表
+func (s *WireGuardService) SaveGateway(ctx context.Context, interfaceID int, req *models.InterfaceGatewayRequest) (*GatewayStatus, error) {
+	g, err := normalizeGateway(interfaceID, req)
+	if err != nil {
+		return nil, err
+	}
+	it, err := s.store.Interfaces().Get(ctx, interfaceID)
+	if err != nil {
+		return nil, mapRepoErr(err, "interface")
+	}
+	// 先校验能否生成规则，避免存下无法下发的设置
+	if _, err := renderGatewayRules(it, g); err != nil {
+		return nil, err
+	}
+	if err := s.store.Gateways().Save(ctx, g); err != nil {
+		return nil, mapRepoErr(err, "interface")
+	}
+	if err := s.syncRunning(ctx, it); err != nil {
+		return nil, fmt.Errorf("gateway saved but firewall apply failed: %w", err)
+	}
+	return s.GetGateway(ctx, interfaceID)
+}
@@ -0,0 +1,43 @@
+package services
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestForwardDropChains(t *testing.T) {
+	listing := `table ip filter {
+	chain INPUT {
+		type filter hook input priority filter; policy drop;
+	}
+	chain FORWARD {
+		type filter hook forward priority filter; policy drop;
+	}
+	chain DOCKER {
+	}
+}
+table ip6 filter {
+	chain FORWARD {
+		type filter hook forward priority filter; policy accept;
+	}
+}
+table inet wg_manager {
+	chain forward {
+		type filter hook forward priority filter; policy drop;
+	}
+}
+table inet ufw {
+	chain ufw-forward {
+		type filter hook forward priority filter + 10; policy drop;
+	}
+}
+`
+	got := forwardDropChains(listing)
+	want := []string{"ip filter FORWARD", "inet ufw ufw-forward"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("forwardDropChains = %v, want %v", got, want)
+	}
+	if got := forwardDropChains(""); got != nil {
+		t.Fatalf("empty listing = %v", got)
+	}
+}
@@ -0,0 +1,158 @@
+package services
+
+import (
+	"backend/models"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+const (
+	defaultHookTimeout = 30 * time.Second
+	maxHookOutput      = 16 << 10 // 事件中保留的输出字节数
+	maxHookScript      = 8 << 10  // 单个 hook 字段的长度上限
+)
+
+// SetHooks 设置是否执行接口的 PreUp/PostUp/PreDown/PostDown 以及单条命令的超时（<=0 取默认）
+func (s *WireGuardService) SetHooks(enabled bool, timeout time.Duration) {
+	if timeout <= 0 {
+		timeout = defaultHookTimeout
+	}
+	s.hooksDisabled, s.hookTimeout = !enabled, timeout
+}
+
+// normalizeHook 去掉空行与首尾空白；命令按行执行
+func normalizeHook(field, script string) (string, error) {
+	if len(script) > maxHookScript {
+		return "", fmt.Errorf("%w: %s is too long (max %d bytes)", ErrBadRequest, field, maxHookScript)
+	}
+	if strings.ContainsRune(script, 0) {
+		return "", fmt.Errorf("%w: %s contains a NUL byte", ErrBadRequest, field)
+	}
+	return strings.Join(hookLines(script), "\n"), nil
+}
+
+func hookLines(script string) []string {
+	var out []string
+	for _, l := range strings.Split(strings.ReplaceAll(script, "\r\n", "\n"), "\n") {
+		if l = strings.TrimSpace(l); l != "" {
+			out = append(out, l)
+		}
+	}
+	return out
+}
+
+// applyHooks 把请求中的 hook 合并到接口，返回变更的字段
+func applyHooks(it *models.WireGuardInterface, h models.InterfaceHooks) ([]string, error) {
+	var fields []string
+	for _, f := range []struct {
+		name string
+		req  *string
+		dst  *string
+	}{
+		{"pre_up", h.PreUp, &it.PreUp},
+		{"post_up", h.PostUp, &it.PostUp},
+		{"pre_down", h.PreDown, &it.PreDown},
+		{"post_down", h.PostDown, &it.PostDown},
+	} {
+		if f.req == nil {
+			continue
+		}
+		v, err := normalizeHook(f.name, *f.req)
+		if err != nil {
+			return nil, err
+		}
+		if v != *f.dst {
+			*f.dst = v
+			fields = append(fields, f.name)
+		}
+	}
+	return fields, nil
+}
+
+// recordEvent 写入接口事件日志；失败只记日志
+func (s *WireGuardService) recordEvent(ctx context.Context, interfaceID int, kind string, success bool, message, output string) {
+	e := &models.InterfaceEvent{InterfaceID: interfaceID, Kind: kind, Message: message, Output: output, Success: success}
+	if err := s.store.Events().Add(ctx, e); err != nil {
+		log.Printf("[event] interface %d: %v", interfaceID, err)
+	}
+}
+
+// GetInterfaceEvents 返回接口最近的事件（默认 100 条）
+func (s *WireGuardService) GetInterfaceEvents(ctx context.Context, id, limit int) ([]models.InterfaceEvent, error) {
+	if _, err := s.store.Interfaces().Get(ctx, id); err != nil {
+		return nil, mapRepoErr(err, "interface")
+	}
+	if limit <= 0 || limit > 500 {
+		limit = 100
+	}
+	list, err := s.store.Events().List(ctx, id, limit)
+	if err != nil {
+		return nil, err
+	}
+	if list == nil {
+		list = []models.InterfaceEvent{}
+	}
+	return list, nil
+}
+
+// runHooks 按行执行一个阶段的 hook（同 wg-quick：%i 替换为接口名，首条失败即停止），每条命令的结果写入事件日志
+func (s *WireGuardService) runHooks(ctx context.Context, it *models.WireGuardInterface, stage, script string) error {
+	lines := hookLines(script)
+	if len(lines) == 0 {
+		return nil
+	}
+	if s.hooksDisabled {
+		s.recordEvent(ctx, it.ID, models.EventHook, false,
+			fmt.Sprintf("%s skipped: hooks are disabled (WG_DISABLE_HOOKS)", stage), "")
+		return nil
+	}
+	// 接口名会被替换进 shell 命令，只允许安全字符（非管理员也能改名）
+	if !ifaceNameRe.MatchString(it.Name) {
+		return fmt.Errorf("%w: refusing to run %s hooks for interface name %q", ErrBadRequest, stage, it.Name)
+	}
+	timeout := s.hookTimeout
+	if timeout <= 0 {
+		timeout = defaultHookTimeout
+	}
+
+	for _, line := range lines {
+		cmdline := strings.ReplaceAll(line, "%i", it.Name)
+		cctx, cancel := context.WithTimeout(ctx, timeout)
+		cmd := exec.CommandContext(cctx, "sh", "-c", cmdline)
+		cmd.WaitDelay = time.Second // 子进程继承了输出管道时不无限等待
+		start := time.Now()
+		out, err := cmd.CombinedOutput()
+		cancel()
+
+		elapsed := time.Since(start).Round(time.Millisecond)
+		output := string(out)
+		if len(output) > maxHookOutput {
+			output = output[:maxHookOutput] + "\n...(truncated)"
+		}
+		var status string
+		switch {
+		case err == nil:
+			status = "exit 0"
+		case errors.Is(cctx.Err(), context.DeadlineExceeded):
+			status = fmt.Sprintf("timed out after %s", timeout)
+		default:
+			var ee *exec.ExitError
+			if errors.As(err, &ee) {
+				status = fmt.Sprintf("exit %d", ee.ExitCode())
+			} else {
+				status = err.Error()
+			}
+		}
+		s.recordEvent(ctx, it.ID, models.EventHook, err == nil,
+			fmt.Sprintf("%s: %s (%s, %s)", stage, cmdline, status, elapsed), output)
+		if err != nil {
+			return fmt.Errorf("%s hook %q failed: %s", stage, cmdline, status)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,598 @@
+package services
+
+import (
+	"backend/models"
+	"backend/repository"
+	"backend/wgconf"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// 对已存在的接口/peer 的处理策略
+const (
+	ImportSkip      = "skip"      // 已存在的不动，只新增缺少的 peer
+	ImportMerge     = "merge"     // 用文件中的值更新已存在的接口与 peer，不删除
+	ImportOverwrite = "overwrite" // 以文件为准：更新接口、peer，并删除文件中没有的 peer
+)
+
+type ImportOptions struct {
+	Name   string `json:"name"`   // 接口名；为空取 [Interface] 的名称注释或文件名
+	Policy string `json:"policy"` // skip | merge | overwrite，默认 skip
+	DryRun bool   `json:"dry_run"`
+	Mode   string `json:"mode"` // server（默认）| client：客户端模式把唯一的 [Peer] 作为远端
+}
+
+type ImportPeerResult struct {
+	Name      string   `json:"name"`
+	PublicKey string   `json:"public_key"`
+	IP        string   `json:"ip"`
+	Action    string   `json:"action"` // create | update | skip | delete | unchanged
+	Fields    []string `json:"fields,omitempty"`
+}
+
+type ImportReport struct {
+	Interface string             `json:"interface"`
+	Action    string             `json:"action"` // create | update | skip | unchanged
+	Fields    []string           `json:"fields,omitempty"`
+	Peers     []ImportPeerResult `json:"peers"`
+	Warnings  []string           `json:"warnings,omitempty"`
+	DryRun    bool               `json:"dry_run"`
+	Applied   bool               `json:"applied"` // 已重新下发到内核
+}
+
+type ImportService struct {
+	store   repository.Store
+	wg      *WireGuardService
+	confDir string // API 按路径导入时只允许该目录下的文件
+}
+
+func NewImportService(store repository.Store, wg *WireGuardService, confDir string) *ImportService {
+	return &ImportService{store: store, wg: wg, confDir: confDir}
+}
+
+// dry-run 时用于回滚事务的哨兵错误
+var errImportDryRun = errors.New("import dry run")
+
+// Linux 网卡名：最长 15 字节，不含空白与 '/'
+var ifaceNameRe = regexp.MustCompile(`^[A-Za-z0-9_=+.-]{1,15}$`)
+
+// ImportFile 从本地路径导入
+func (s *ImportService) ImportFile(ctx context.Context, path string, opts ImportOptions) (*ImportReport, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if opts.Name == "" {
+		opts.Name = strings.TrimSuffix(filepath.Base(path), ".conf")
+	}
+	return s.Import(ctx, data, opts)
+}
+
+// ImportFromConfDir 导入配置目录下的文件；path 可为文件名或目录内的绝对路径
+func (s *ImportService) ImportFromConfDir(ctx context.Context, path string, opts ImportOptions) (*ImportReport, error) {
+	if s.confDir == "" {
+		return nil, fmt.Errorf("%w: config directory not configured (set WG_CONF_DIR)", ErrBadRequest)
+	}
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(s.confDir, path)
+	}
+	path = filepath.Clean(path)
+	if filepath.Dir(path) != filepath.Clean(s.confDir) || filepath.Ext(path) != ".conf" {
+		return nil, fmt.Errorf("%w: only *.conf files in %s can be imported by path", ErrBadRequest, s.confDir)
+	}
+	rep, err := s.ImportFile(ctx, path, opts)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, path)
+	}
+	return rep, err
+}
+
+// ImportDir 导入目录下所有 *.conf（用于启动时同步），单个文件失败不影响其它文件
+func (s *ImportService) ImportDir(ctx context.Context, dir string, opts ImportOptions) ([]ImportReport, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.conf"))
+	if err != nil {
+		return nil, err
+	}
+	var reports []ImportReport
+	for _, path := range files {
+		o := opts
+		o.Name = ""
+		rep, err := s.ImportFile(ctx, path, o)
+		if err != nil {
+			log.Printf("[import] %s: %v", path, err)
+			continue
+		}
+		reports = append(reports, *rep)
+	}
+	return reports, nil
+}
+
+// Import 解析 wg-quick 配置并按策略写入；DryRun 时在事务内完整执行后回滚，返回的报告即预览
+func (s *ImportService) Import(ctx context.Context, data []byte, opts ImportOptions) (*ImportReport, error) {
+	conf, err := wgconf.Parse(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("%w: parse config: %v", ErrBadRequest, err)
+	}
+
+	switch opts.Policy {
+	case "":
+		opts.Policy = ImportSkip
+	case ImportSkip, ImportMerge, ImportOverwrite:
+	default:
+		return nil, fmt.Errorf("%w: unknown policy %q (skip, merge, overwrite)", ErrBadRequest, opts.Policy)
+	}
+	name := strings.TrimSpace(opts.Name)
+	if name == "" {
+		name = conf.Name
+	}
+	if !ifaceNameRe.MatchString(name) {
+		return nil, fmt.Errorf("%w: invalid interface name %q", ErrBadRequest, name)
+	}
+	mode := strings.ToLower(strings.TrimSpace(opts.Mode))
+	switch mode {
+	case "":
+		mode = models.InterfaceModeServer
+	case models.InterfaceModeServer, models.InterfaceModeClient:
+	default:
+		return nil, fmt.Errorf("%w: unsupported interface mode %q", ErrBadRequest, mode)
+	}
+
+	want, warnings, err := interfaceFromConf(name, conf, mode)
+	if err != nil {
+		return nil, err
+	}
+	var remote *models.ClientRemote
+	if mode == models.InterfaceModeClient {
+		if remote, err = remoteFromConf(conf); err != nil {
+			return nil, err
+		}
+	} else {
+		if conf.Interface.Table != "" {
+			warnings = append(warnings, "Table is not supported and was ignored")
+		}
+		if conf.Interface.FwMark != "" {
+			warnings = append(warnings, "FwMark is not supported and was ignored")
+		}
+	}
+	if s.wg.hooksDisabled && want.PreUp+want.PostUp+want.PreDown+want.PostDown != "" {
+		warnings = append(warnings, "PreUp/PostUp/PreDown/PostDown were imported but will not run: hooks are disabled (WG_DISABLE_HOOKS)")
+	}
+
+	var rep *ImportReport
+	var ifaceID int
+	err = s.store.WithTx(ctx, func(tx repository.Store) error {
+		rep = &ImportReport{Interface: name, Peers: []ImportPeerResult{}, Warnings: warnings, DryRun: opts.DryRun}
+		id, err := s.importTx(ctx, tx, conf, want, remote, opts.Policy, rep)
+		if err != nil {
+			return err
+		}
+		ifaceID = id
+		if opts.DryRun {
+			return errImportDryRun
+		}
+		return nil
+	})
+	if err != nil && !errors.Is(err, errImportDryRun) {
+		return nil, mapRepoErr(err, "interface name, listen port or peer ip")
+	}
+	if opts.DryRun {
+		return rep, nil
+	}
+	s.wg.syncConfFile(ifaceID)
+
+	// 接口在运行且有变更时重新下发
+	if rep.Action == "create" || rep.Action == "update" || peersChanged(rep.Peers) {
+		if it, err := s.wg.GetInterface(ifaceID); err == nil && it.Status == "running" {
+			if err := s.wg.ApplyInterfaceConfig(ifaceID); err != nil {
+				rep.Warnings = append(rep.Warnings, fmt.Sprintf("apply %s: %v", name, err))
+			} else {
+				rep.Applied = true
+			}
+		}
+	}
+	return rep, nil
+}
+
+func peersChanged(peers []ImportPeerResult) bool {
+	for _, p := range peers {
+		if p.Action != "unchanged" && p.Action != "skip" {
+			return true
+		}
+	}
+	return false
+}
+
+// interfaceFromConf 把 [Interface] 段转换为模型；无法落库的字段记为警告。
+// 客户端模式的 ListenPort 可省略（导入时另选空闲端口）
+func interfaceFromConf(name string, conf *wgconf.File, mode string) (*models.WireGuardInterface, []string, error) {
+	ci := conf.Interface
+	warnings := append([]string{}, conf.Warnings...)
+
+	if ci.PrivateKey == "" {
+		return nil, nil, fmt.Errorf("%w: [Interface] PrivateKey is required", ErrBadRequest)
+	}
+	priv, err := parseWGPrivateKey(ci.PrivateKey)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: %v", ErrBadRequest, err)
+	}
+	if len(ci.Address) == 0 {
+		return nil, nil, fmt.Errorf("%w: [Interface] Address is required", ErrBadRequest)
+	}
+	if ci.ListenPort < 0 || ci.ListenPort > 65535 || (ci.ListenPort == 0 && mode != models.InterfaceModeClient) {
+		return nil, nil, fmt.Errorf("%w: [Interface] ListenPort is required", ErrBadRequest)
+	}
+	// 每个地址族取第一个 Address（双栈时 IPv4 + IPv6），其余忽略
+	var address, extra []string
+	v4, v6 := false, false
+	for _, a := range ci.Address {
+		p, err := netip.ParsePrefix(a)
+		if err != nil {
+			return nil, nil, fmt.Errorf("%w: invalid Address %q", ErrBadRequest, a)
+		}
+		if is4 := p.Addr().Unmap().Is4(); (is4 && v4) || (!is4 && v6) {
+			extra = append(extra, a)
+			continue
+		} else if is4 {
+			v4 = true
+		} else {
+			v6 = true
+		}
+		address = append(address, a)
+	}
+	if len(extra) > 0 {
+		warnings = append(warnings, fmt.Sprintf("only one Address per address family is used, ignored: %s",
+			strings.Join(extra, ", ")))
+	}
+	cidr, serverIP, err := deriveCIDR(strings.Join(address, ", "))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return &models.WireGuardInterface{
+		Name:       name,
+		PrivateKey: priv.String(),
+		PublicKey:  priv.PublicKey().String(),
+		Address:    strings.Join(address, ", "),
+		ListenPort: ci.ListenPort,
+		DNS:        strings.Join(ci.DNS, ", "),
+		MTU:        ci.MTU,
+		CIDR:       cidr,
+		ServerIP:   serverIP,
+		Status:     "stopped",
+		Mode:       mode,
+		PreUp:      strings.Join(ci.PreUp, "\n"),
+		PostUp:     strings.Join(ci.PostUp, "\n"),
+		PreDown:    strings.Join(ci.PreDown, "\n"),
+		PostDown:   strings.Join(ci.PostDown, "\n"),
+	}, warnings, nil
+}
+
+func (s *ImportService) importTx(
+	ctx context.Context, tx repository.Store, conf *wgconf.File,
+	want *models.WireGuardInterface, remote *models.ClientRemote, policy string, rep *ImportReport,
+) (int, error) {
+	it, err := tx.Interfaces().GetByName(ctx, want.Name)
+	exists := err == nil
+	if err != nil && !errors.Is(err, repository.ErrNotFound) {
+		return 0, err
+	}
+	if exists && it.Mode != want.Mode {
+		return 0, fmt.Errorf("%w: interface %s exists in %s mode", ErrConflict, it.Name, it.Mode)
+	}
+	if want.ListenPort == 0 {
+		if exists {
+			want.ListenPort = it.ListenPort
+		} else if want.ListenPort, err = freeListenPort(ctx, tx); err != nil {
+			return 0, err
+		}
+	}
+
+	// 新建或改地址时检查网段冲突；同名的内核链路（如 wg-quick 拉起的）自身路由不算冲突
+	if !exists || (policy != ImportSkip && it.Address != want.Address) {
+		fams, err := interfaceFamilies(want)
+		if err != nil {
+			return 0, err
+		}
+		selfID := 0
+		if exists {
+			selfID = it.ID
+		}
+		if err := s.wg.checkSubnetConflicts(ctx, tx, selfID, want.Name, fams); err != nil {
+			return 0, err
+		}
+	}
+
+	switch {
+	case !exists:
+		rep.Action = "create"
+		it = want
+		if it.DNS == "" {
+			it.DNS = "8.8.8.8"
+		}
+		if it.MTU == 0 {
+			it.MTU = 1420
+		}
+		if err := tx.Interfaces().Create(ctx, it); err != nil {
+			return 0, err
+		}
+	case policy == ImportSkip:
+		rep.Action = "skip"
+	default:
+		fields := mergeInterface(it, want, policy == ImportOverwrite)
+		rep.Action = "unchanged"
+		if len(fields) > 0 {
+			rep.Action, rep.Fields = "update", fields
+			if err := tx.Interfaces().Update(ctx, it); err != nil {
+				return 0, err
+			}
+		}
+	}
+
+	if remote != nil {
+		if err := importRemote(ctx, tx, it, remote, exists, policy, rep); err != nil {
+			return 0, err
+		}
+		return it.ID, nil
+	}
+	if err := s.importPeers(ctx, tx, conf, it, exists, policy, rep); err != nil {
+		return 0, err
+	}
+	return it.ID, nil
+}
+
+// mergeInterface 把 want 中的值合并到 it，返回变更的字段；overwrite 时缺省值也覆盖
+func mergeInterface(it, want *models.WireGuardInterface, overwrite bool) []string {
+	var fields []string
+	if it.PrivateKey != want.PrivateKey {
+		it.PrivateKey, it.PublicKey = want.PrivateKey, want.PublicKey
+		fields = append(fields, "private_key")
+	}
+	if it.Address != want.Address {
+		it.Address, it.CIDR, it.ServerIP = want.Address, want.CIDR, want.ServerIP
+		fields = append(fields, "address")
+	}
+	if it.ListenPort != want.ListenPort {
+		it.ListenPort = want.ListenPort
+		fields = append(fields, "listen_port")
+	}
+	dns, mtu := want.DNS, want.MTU
+	if overwrite {
+		if dns == "" {
+			dns = "8.8.8.8"
+		}
+		if mtu == 0 {
+			mtu = 1420
+		}
+	}
+	if dns != "" && it.DNS != dns {
+		it.DNS = dns
+		fields = append(fields, "dns")
+	}
+	if mtu != 0 && it.MTU != mtu {
+		it.MTU = mtu
+		fields = append(fields, "mtu")
+	}
+	// hook：文件中有的覆盖；overwrite 时文件中没有的也清空
+	for _, h := range []struct {
+		name      string
+		dst, from *string
+	}{
+		{"pre_up", &it.PreUp, &want.PreUp},
+		{"post_up", &it.PostUp, &want.PostUp},
+		{"pre_down", &it.PreDown, &want.PreDown},
+		{"post_down", &it.PostDown, &want.PostDown},
+	} {
+		if (*h.from != "" || overwrite) && *h.dst != *h.from {
+			*h.dst = *h.from
+			fields = append(fields, h.name)
+		}
+	}
+	return fields
+}
+
+// tunnelIPFromAllowed 取 AllowedIPs 中落在接口各网段内的主机路由作为 peer 隧道 IP（每个地址族第一个）
+func tunnelIPFromAllowed(allowed []string, fams []addrFamily) string {
+	var hosts []string
+	for _, a := range allowed {
+		p, err := netip.ParsePrefix(strings.TrimSpace(a))
+		if err != nil || !p.IsSingleIP() {
+			continue
+		}
+		hosts = append(hosts, p.Addr().String())
+	}
+	return fittingPeerIP(fams, strings.Join(hosts, ","))
+}
+
+// freeIPs 去掉已被占用的地址
+func freeIPs(ips string, used map[string]struct{}) string {
+	var out []string
+	for _, ip := range splitCSV(ips) {
+		if _, taken := used[ip]; !taken {
+			out = append(out, ip)
+		}
+	}
+	return strings.Join(out, ", ")
+}
+
+func (s *ImportService) importPeers(
+	ctx context.Context, tx repository.Store, conf *wgconf.File,
+	it *models.WireGuardInterface, exists bool, policy string, rep *ImportReport,
+) error {
+	fams, err := interfaceFamilies(it)
+	if err != nil {
+		return err
+	}
+
+	var current []models.WireGuardPeer
+	if exists {
+		if current, err = tx.Peers().ListByInterface(ctx, it.ID); err != nil {
+			return err
+		}
+	}
+	byKey := make(map[string]*models.WireGuardPeer, len(current))
+	for i := range current {
+		byKey[current[i].PublicKey] = &current[i]
+	}
+	var ips []string
+	for _, p := range current {
+		ips = append(ips, p.IP)
+	}
+	view, err := s.wg.loadIPAMView(ctx, tx, it.ID, fams, ips)
+	if err != nil {
+		return err
+	}
+	used := view.used
+
+	seen := map[string]bool{}
+	for i, cp := range conf.Peers {
+		if cp.PublicKey == "" {
+			rep.Warnings = append(rep.Warnings, fmt.Sprintf("peer #%d has no PublicKey, skipped", i+1))
+			continue
+		}
+		pub, err := parseWGPublicKey(cp.PublicKey)
+		if err != nil {
+			return fmt.Errorf("%w: peer #%d: %v", ErrBadRequest, i+1, err)
+		}
+		key := pub.String()
+		if seen[key] {
+			rep.Warnings = append(rep.Warnings, fmt.Sprintf("peer #%d duplicates public key %s, skipped", i+1, key))
+			continue
+		}
+		seen[key] = true
+		if cp.PresharedKey != "" {
+			if _, err := parseWGPrivateKey(cp.PresharedKey); err != nil {
+				return fmt.Errorf("%w: peer #%d: invalid preshared key", ErrBadRequest, i+1)
+			}
+		}
+		allowed := strings.Join(cp.AllowedIPs, ", ")
+		if _, err := parseAllowedIPs(allowed); err != nil {
+			return fmt.Errorf("%w: peer #%d: %v", ErrBadRequest, i+1, err)
+		}
+		if containsDefaultRoute(allowed) {
+			// 服务端 AllowedIPs 不接受默认路由，去掉后退回隧道 IP 的主机路由
+			var rest []string
+			for _, a := range cp.AllowedIPs {
+				if !containsDefaultRoute(a) {
+					rest = append(rest, a)
+				}
+			}
+			allowed = strings.Join(rest, ", ")
+			rep.Warnings = append(rep.Warnings, fmt.Sprintf("peer %s: default route removed from AllowedIPs", key))
+		}
+		keepalive := cp.PersistentKeepalive
+
+		if p, ok := byKey[key]; ok {
+			res := ImportPeerResult{Name: p.Name, PublicKey: key, IP: p.IP, Action: "skip"}
+			if policy != ImportSkip {
+				oldIP := p.IP
+				fields := mergePeer(p, cp, allowed, keepalive, fams, used)
+				res.Name, res.IP, res.Action = p.Name, p.IP, "unchanged"
+				if len(fields) > 0 {
+					res.Action, res.Fields = "update", fields
+					if err := tx.Peers().Update(ctx, p); err != nil {
+						return err
+					}
+					if err := s.wg.quarantineIPs(ctx, tx, it.ID, p.Name, oldIP, p.IP); err != nil {
+						return err
+					}
+				}
+			}
+			rep.Peers = append(rep.Peers, res)
+			continue
+		}
+
+		// 新 peer：隧道 IP 取自 AllowedIPs，没有则分配
+		found := freeIPs(tunnelIPFromAllowed(cp.AllowedIPs, fams), used)
+		ip, err := view.assign("", found)
+		if err != nil {
+			return fmt.Errorf("peer %s: %w", key, err)
+		}
+		if !peerIPComplete(fams, found) {
+			rep.Warnings = append(rep.Warnings, fmt.Sprintf("peer %s: AllowedIPs has no free tunnel address for every address family, using %s", key, ip))
+		}
+		if allowed == "" || allowed == hostCIDR(found) {
+			// 只有主机路由时跟随实际地址（含补分配的地址族）
+			allowed = hostCIDR(ip)
+		}
+		name := strings.TrimSpace(cp.Name)
+		if name == "" {
+			name = "peer-" + splitCSV(ip)[0]
+		}
+		p := &models.WireGuardPeer{
+			InterfaceID:         it.ID,
+			Name:                name,
+			PublicKey:           key,
+			PresharedKey:        cp.PresharedKey,
+			IP:                  ip,
+			AllowedIPs:          allowed,
+			Endpoint:            cp.Endpoint,
+			PersistentKeepalive: keepalive,
+		}
+		if err := tx.Peers().Create(ctx, p); err != nil {
+			return err
+		}
+		rep.Peers = append(rep.Peers, ImportPeerResult{Name: name, PublicKey: key, IP: ip, Action: "create"})
+	}
+
+	// overwrite：删除文件中没有的 peer
+	if policy == ImportOverwrite {
+		for _, p := range current {
+			if seen[p.PublicKey] {
+				continue
+			}
+			if err := tx.Peers().Delete(ctx, p.ID); err != nil {
+				return err
+			}
+			if err := s.wg.quarantineIPs(ctx, tx, it.ID, p.Name, p.IP, ""); err != nil {
+				return err
+			}
+			rep.Peers = append(rep.Peers, ImportPeerResult{Name: p.Name, PublicKey: p.PublicKey, IP: p.IP, Action: "delete"})
+		}
+	}
+	return nil
+}
+
+// mergePeer 用配置中的值更新已有 peer，返回变更的字段
+func mergePeer(p *models.WireGuardPeer, cp wgconf.Peer, allowed string, keepalive int, fams []addrFamily, used map[string]struct{}) []string {
+	var fields []string
+	if name := strings.TrimSpace(cp.Name); name != "" && name != p.Name {
+		p.Name = name
+		fields = append(fields, "name")
+	}
+	if allowed != "" && allowed != p.AllowedIPs {
+		p.AllowedIPs = allowed
+		fields = append(fields, "allowed_ips")
+		// 隧道 IP 跟随 AllowedIPs
+		if ip := tunnelIPFromAllowed(cp.AllowedIPs, fams); peerIPComplete(fams, ip) && ip != p.IP {
+			releaseUsed(used, p.IP)
+			if freeIPs(ip, used) == ip {
+				markUsed(used, ip)
+				p.IP = ip
+				fields = append(fields, "ip")
+			} else {
+				markUsed(used, p.IP)
+			}
+		}
+	}
+	if cp.PresharedKey != p.PresharedKey {
+		p.PresharedKey = cp.PresharedKey
+		fields = append(fields, "preshared_key")
+	}
+	if cp.Endpoint != p.Endpoint {
+		p.Endpoint = cp.Endpoint
+		fields = append(fields, "endpoint")
+	}
+	if keepalive != p.PersistentKeepalive {
+		p.PersistentKeepalive = keepalive
+		fields = append(fields, "persistent_keepalive")
+	}
+	return fields
+}
@@ -0,0 +1,876 @@
+package services
+
+import (
+	"backend/cidrset"
+	"backend/ipam"
+	"backend/models"
+	"backend/repository"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"net/netip"
+	"slices"
+	"strings"
+	"time"
+)
+
+// 默认隔离期：客户端缓存的旧配置、路由与防火墙规则大多在一天内失效
+const defaultIPQuarantine = 24 * time.Hour
+
+// SetIPQuarantine 设置释放地址的隔离期；<= 0 关闭隔离
+func (s *WireGuardService) SetIPQuarantine(d time.Duration) {
+	s.ipQuarantine = d
+}
+
+// SetRandomIPv6 为 true 时 IPv6 地址在网段（或地址池）内随机分配，避免地址可被枚举；IPv4 始终顺序分配
+func (s *WireGuardService) SetRandomIPv6(on bool) {
+	s.randomIPv6 = on
+}
+
+/* -------------------- 分配视图 -------------------- */
+
+// ipamView 是分配所需的接口地址视图，分配结果回写到 used；
+// CreatePeer 经 leaseIPAMView 跨事务复用，批量操作在各自事务内构建
+type ipamView struct {
+	fams        []addrFamily
+	pools       []models.IPPool
+	poolRanges  map[string][]netip.Prefix
+	pooled      []netip.Prefix // 所有地址池的并集；未指定池时不从这里分配
+	reserved    []netip.Prefix
+	quarantined map[string]time.Time
+	used        map[string]struct{}
+	random6     bool
+
+	// 按地址族缓存的空闲区间（网段减去已用、隔离与特殊地址；地址池与保留地址由候选网段过滤），
+	// 首次分配时构建；调用方可能直接修改 used，因此取出的地址仍以 taken 为准
+	free []*ipam.FreeList
+	// spansOnly 表示空闲区间由持久化的快照恢复：used 只含本视图分配的地址，其余已用地址以空闲区间为准
+	spansOnly bool
+}
+
+// loadIPAMView 读取接口的地址池、保留地址与隔离期地址；peerIPs 为已占用的 peer 地址
+func (s *WireGuardService) loadIPAMView(ctx context.Context, tx repository.Store, interfaceID int, fams []addrFamily, peerIPs []string) (*ipamView, error) {
+	v := &ipamView{
+		fams:        fams,
+		poolRanges:  map[string][]netip.Prefix{},
+		quarantined: map[string]time.Time{},
+		used:        usedAddrSet(fams, peerIPs),
+		random6:     s.randomIPv6,
+	}
+
+	pools, err := tx.IPAM().ListPools(ctx, interfaceID)
+	if err != nil {
+		return nil, err
+	}
+	v.pools = pools
+	for _, p := range pools {
+		ranges, err := parseCIDRItems(splitCSV(p.Ranges))
+		if err != nil {
+			return nil, fmt.Errorf("ip pool %s: %w", p.Name, err)
+		}
+		v.poolRanges[p.Name] = cidrset.Union(ranges)
+		v.pooled = append(v.pooled, ranges...)
+	}
+	v.pooled = cidrset.Union(v.pooled)
+
+	res, err := tx.IPAM().ListReservations(ctx, interfaceID)
+	if err != nil {
+		return nil, err
+	}
+	for _, r := range res {
+		ps, err := parseCIDRItems(splitCSV(r.Addresses))
+		if err != nil {
+			return nil, fmt.Errorf("ip reservation %d: %w", r.ID, err)
+		}
+		v.reserved = append(v.reserved, ps...)
+	}
+	v.reserved = cidrset.Union(v.reserved)
+
+	qs, err := tx.IPAM().ListQuarantine(ctx, interfaceID, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	for _, q := range qs {
+		v.quarantined[q.IP] = q.Until
+	}
+	return v, nil
+}
+
+/* -------------------- 分配视图缓存 -------------------- */
+
+// ipamCacheEntry 缓存接口的分配视图（含各地址族的空闲区间），只在地址占用变化后重建。
+// version 取自 ipam_versions：任何写入路径改动 peer 地址、地址池、保留或隔离地址都会使其递增
+type ipamCacheEntry struct {
+	version int64
+	fams    []addrFamily
+	expires time.Time // 最早到期的隔离地址，到期后重建；零值表示没有隔离地址
+	view    *ipamView
+	leases  int // 尚未结束的租用数；只有独占视图的事务才把空闲区间的变化写入快照
+}
+
+// ipamLease 是一次事务对缓存视图的使用；提交后由 done 把本事务的写入记入缓存版本
+type ipamLease struct {
+	s       *WireGuardService
+	id      int
+	e       *ipamCacheEntry
+	version int64 // 读取时的版本号
+	next    int64 // 本事务写入后的版本号
+
+	// 本次分配引起的空闲区间变化，由 written 增量写入快照
+	set, removed []models.IPAMFreeSpan
+}
+
+// leaseIPAMView 在接口的缓存视图上执行 fn：版本号与网段未变时直接复用，否则经 loadIPAMEntry 重新加载。
+// fn 在 ipamMu 下执行，分配结果直接记入缓存视图；事务失败时 done 丢弃缓存
+func (s *WireGuardService) leaseIPAMView(ctx context.Context, tx repository.Store, interfaceID int, fams []addrFamily, fn func(v *ipamView) error) (*ipamLease, error) {
+	ver, err := tx.IPAM().Version(ctx, interfaceID)
+	if err != nil {
+		return nil, err
+	}
+	s.ipamMu.Lock()
+	e := s.ipamCache[interfaceID]
+	s.ipamMu.Unlock()
+
+	if e == nil || e.version != ver || !slices.Equal(e.fams, fams) || (!e.expires.IsZero() && !time.Now().Before(e.expires)) {
+		if e, err = s.loadIPAMEntry(ctx, tx, interfaceID, fams, ver); err != nil {
+			return nil, err
+		}
+		s.ipamMu.Lock()
+		if s.ipamCache == nil {
+			s.ipamCache = map[int]*ipamCacheEntry{}
+		}
+		s.ipamCache[interfaceID] = e
+		s.ipamMu.Unlock()
+	}
+
+	l := &ipamLease{s: s, id: interfaceID, e: e, version: ver}
+	s.ipamMu.Lock()
+	e.leases++
+	err = fn(e.view)
+	if err == nil {
+		l.set, l.removed = e.view.changes()
+	}
+	s.ipamMu.Unlock()
+	if err != nil {
+		l.done(false)
+		return nil, err
+	}
+	return l, nil
+}
+
+// loadIPAMEntry 构建接口的缓存视图：持久化的空闲区间快照与版本号、网段一致且隔离地址未到期时直接恢复，
+// 不读取已用地址；否则读取全部已用地址重建，并在同一事务中写回快照
+func (s *WireGuardService) loadIPAMEntry(ctx context.Context, tx repository.Store, interfaceID int, fams []addrFamily, ver int64) (*ipamCacheEntry, error) {
+	key := familiesKey(fams)
+	var v *ipamView
+	st, err := tx.IPAM().GetFreeState(ctx, interfaceID)
+	switch {
+	case err == nil && st.Version == ver && st.Families == key && (st.Expires.IsZero() || time.Now().Before(st.Expires)):
+		spans, err := tx.IPAM().ListFreeSpans(ctx, interfaceID)
+		if err != nil {
+			return nil, err
+		}
+		if v, err = s.loadIPAMView(ctx, tx, interfaceID, fams, nil); err != nil {
+			return nil, err
+		}
+		if err := v.restore(spans); err != nil {
+			log.Printf("[ipam] interface %d: discard free span snapshot: %v", interfaceID, err)
+			v = nil
+		}
+	case err != nil && !errors.Is(err, repository.ErrNotFound):
+		return nil, err
+	}
+
+	e := &ipamCacheEntry{version: ver, fams: fams}
+	if v == nil {
+		ips, err := tx.Peers().UsedIPs(ctx, interfaceID)
+		if err != nil {
+			return nil, err
+		}
+		if v, err = s.loadIPAMView(ctx, tx, interfaceID, fams, ips); err != nil {
+			return nil, err
+		}
+		e.view = v
+		e.expires = v.nextExpiry()
+		st := &models.IPAMFreeState{InterfaceID: interfaceID, Version: ver, Families: key, Expires: e.expires}
+		if err := tx.IPAM().SaveFreeSpans(ctx, st, v.snapshot()); err != nil {
+			return nil, err
+		}
+		return e, nil
+	}
+	e.view = v
+	e.expires = v.nextExpiry()
+	return e, nil
+}
+
+// familiesKey 是接口网段与服务端地址的指纹，网段变化后快照作废
+func familiesKey(fams []addrFamily) string {
+	parts := make([]string, len(fams))
+	for i, f := range fams {
+		parts[i] = f.Prefix.String() + " " + f.Server.String()
+	}
+	return strings.Join(parts, ", ")
+}
+
+// written 在事务写入 peer 之后读取新的版本号，并把本次分配的空闲区间变化写入快照。
+// 只有本事务独占缓存视图、快照恰为读取时的版本，变化才正好对应本事务的写入；否则跳过，快照落后于
+// 版本号，下次加载时重建
+func (l *ipamLease) written(ctx context.Context, tx repository.Store) error {
+	v, err := tx.IPAM().Version(ctx, l.id)
+	if err != nil {
+		return err
+	}
+	l.next = v
+	s := l.s
+	s.ipamMu.Lock()
+	exclusive := s.ipamCache[l.id] == l.e && l.e.version == l.version && l.e.leases == 1
+	st := &models.IPAMFreeState{InterfaceID: l.id, Version: v, Families: familiesKey(l.e.fams), Expires: l.e.expires}
+	s.ipamMu.Unlock()
+	if !exclusive {
+		return nil
+	}
+	_, err = tx.IPAM().PatchFreeSpans(ctx, l.version, st, l.set, l.removed)
+	return err
+}
+
+// done 在事务结束后调用：提交成功且期间没有别的写入时，缓存视图即为新版本；
+// 否则丢弃（视图里可能有未提交的分配），下次重建
+func (l *ipamLease) done(committed bool) {
+	if l == nil {
+		return
+	}
+	s := l.s
+	s.ipamMu.Lock()
+	defer s.ipamMu.Unlock()
+	l.e.leases--
+	if s.ipamCache[l.id] != l.e {
+		return
+	}
+	if committed && l.next != 0 && l.e.version == l.version {
+		l.e.version = l.next
+		return
+	}
+	delete(s.ipamCache, l.id)
+}
+
+// resetIPAMCache 丢弃全部缓存视图；整库替换（恢复备份）后调用，版本号不再可比
+func (s *WireGuardService) resetIPAMCache() {
+	s.ipamMu.Lock()
+	s.ipamCache = nil
+	s.ipamMu.Unlock()
+}
+
+// special 判断地址是否为网段的网络地址、IPv4 广播地址或服务端地址
+func (v *ipamView) special(a netip.Addr) bool {
+	i := familyOf(v.fams, a)
+	if i < 0 {
+		return true
+	}
+	f := v.fams[i]
+	if a == f.Server || a == f.Prefix.Addr() {
+		return true
+	}
+	return a.Is4() && f.Prefix.Bits() < 31 && a == cidrset.RangeOf(f.Prefix).Last
+}
+
+func (v *ipamView) taken(a netip.Addr) bool {
+	if _, ok := v.used[a.String()]; ok {
+		return true
+	}
+	if _, ok := v.quarantined[a.String()]; ok {
+		return true
+	}
+	return v.special(a)
+}
+
+// candidates 返回某地址族可自动分配的网段：指定池且池在该地址族有地址段时取池，
+// 否则取池外地址；均已扣除保留地址
+func (v *ipamView) candidates(pool string, i int) []netip.Prefix {
+	f := v.fams[i]
+	var out []netip.Prefix
+	for _, r := range v.poolRanges[pool] {
+		if f.Prefix.Overlaps(r) {
+			out = append(out, r)
+		}
+	}
+	if pool == "" || len(out) == 0 {
+		out = cidrset.Subtract([]netip.Prefix{f.Prefix}, v.pooled)
+	}
+	return cidrset.Subtract(out, v.reserved)
+}
+
+// freeList 返回地址族 i 的空闲区间，首次使用时由已用、隔离与特殊地址构建
+func (v *ipamView) freeList(i int) *ipam.FreeList {
+	if v.free == nil {
+		v.free = make([]*ipam.FreeList, len(v.fams))
+	}
+	if v.free[i] != nil {
+		return v.free[i]
+	}
+	taken := make([]netip.Addr, 0, len(v.used)+len(v.quarantined)+3)
+	for ip := range v.used {
+		if a, err := netip.ParseAddr(ip); err == nil {
+			taken = append(taken, a)
+		}
+	}
+	for ip := range v.quarantined {
+		if a, err := netip.ParseAddr(ip); err == nil {
+			taken = append(taken, a)
+		}
+	}
+	for _, f := range v.fams {
+		taken = append(taken, f.Server, f.Prefix.Addr())
+		if f.Prefix.Addr().Is4() && f.Prefix.Bits() < 31 {
+			taken = append(taken, cidrset.RangeOf(f.Prefix).Last)
+		}
+	}
+	v.free[i] = ipam.NewFreeList([]netip.Prefix{v.fams[i].Prefix}, taken)
+	return v.free[i]
+}
+
+// snapshot 构建全部地址族的空闲区间并导出，之后开始记录变化（见 changes）
+func (v *ipamView) snapshot() []models.IPAMFreeSpan {
+	var out []models.IPAMFreeSpan
+	for i := range v.fams {
+		fl := v.freeList(i)
+		for _, sp := range fl.Snapshot() {
+			out = append(out, models.IPAMFreeSpan{Family: i, First: sp.First.String(), Last: sp.Last.String()})
+		}
+		fl.Track()
+	}
+	return out
+}
+
+// restore 由快照恢复各地址族的空闲区间；区间不属于对应地址族时返回错误
+func (v *ipamView) restore(spans []models.IPAMFreeSpan) error {
+	byFam := make([][]ipam.Span, len(v.fams))
+	for _, sp := range spans {
+		first, err1 := netip.ParseAddr(sp.First)
+		last, err2 := netip.ParseAddr(sp.Last)
+		if err := errors.Join(err1, err2); err != nil {
+			return err
+		}
+		if sp.Family < 0 || sp.Family >= len(v.fams) ||
+			!v.fams[sp.Family].Prefix.Contains(first) || !v.fams[sp.Family].Prefix.Contains(last) || last.Less(first) {
+			return fmt.Errorf("span %s-%s does not fit family %d", first, last, sp.Family)
+		}
+		byFam[sp.Family] = append(byFam[sp.Family], ipam.Span{First: first, Last: last})
+	}
+	v.free = make([]*ipam.FreeList, len(v.fams))
+	for i, list := range byFam {
+		v.free[i] = ipam.FromSpans(list)
+		v.free[i].Track()
+	}
+	v.spansOnly = true
+	return nil
+}
+
+// changes 取出自上次调用以来各地址族空闲区间的变化
+func (v *ipamView) changes() (set, removed []models.IPAMFreeSpan) {
+	for i, fl := range v.free {
+		if fl == nil {
+			continue
+		}
+		s, r := fl.Changes()
+		for _, sp := range s {
+			set = append(set, models.IPAMFreeSpan{Family: i, First: sp.First.String(), Last: sp.Last.String()})
+		}
+		for _, a := range r {
+			removed = append(removed, models.IPAMFreeSpan{Family: i, First: a.String()})
+		}
+	}
+	return set, removed
+}
+
+// nextExpiry 返回最早到期的隔离地址的到期时间；没有隔离地址时为零值
+func (v *ipamView) nextExpiry() time.Time {
+	var out time.Time
+	for _, until := range v.quarantined {
+		if out.IsZero() || until.Before(out) {
+			out = until
+		}
+	}
+	return out
+}
+
+// assigned 判断地址是否已分配给 peer：视图由快照恢复时，不在空闲区间、也不是隔离或特殊地址即为已分配
+func (v *ipamView) assigned(a netip.Addr) bool {
+	if _, ok := v.used[a.String()]; ok {
+		return true
+	}
+	if !v.spansOnly || v.special(a) {
+		return false
+	}
+	if _, ok := v.quarantined[a.String()]; ok {
+		return false
+	}
+	return !v.freeList(familyOf(v.fams, a)).Contains(a)
+}
+
+// allocate 从候选网段取一个空闲地址：IPv6 按配置随机，否则取最小的空闲地址
+func (v *ipamView) allocate(pool string, i int) (netip.Addr, error) {
+	ranges := v.candidates(pool, i)
+	fl := v.freeList(i)
+	for {
+		var a netip.Addr
+		if v.random6 && v.fams[i].Prefix.Addr().Is6() {
+			var err error
+			if a, err = fl.RandomIn(ranges, nil); err != nil {
+				return netip.Addr{}, err
+			}
+		} else {
+			var ok bool
+			if a, ok = fl.FirstIn(ranges); !ok {
+				return netip.Addr{}, ipam.ErrNoAvailableIP
+			}
+		}
+		fl.Take(a)
+		if !v.taken(a) {
+			return a, nil
+		}
+	}
+}
+
+// checkStatic 校验显式指定的地址：未被占用、未保留、不在隔离期
+func (v *ipamView) checkStatic(ips string) error {
+	for _, a := range peerAddrs(ips) {
+		if v.assigned(a) {
+			return fmt.Errorf("%w: ip %s is already assigned", ErrConflict, a)
+		}
+		if cidrset.ContainsAddr(v.reserved, a) {
+			return fmt.Errorf("%w: ip %s is reserved", ErrConflict, a)
+		}
+		if until, ok := v.quarantined[a.String()]; ok {
+			return fmt.Errorf("%w: ip %s is quarantined until %s (release it first)",
+				ErrConflict, a, until.Local().Format(time.RFC3339))
+		}
+	}
+	return nil
+}
+
+// assign 保留 keep 中合法的地址，为缺失的地址族按池分配；整体成功或整体失败，成功后记入 used
+func (v *ipamView) assign(pool, keep string) (string, error) {
+	if _, ok := v.poolRanges[pool]; pool != "" && !ok {
+		return "", fmt.Errorf("%w: ip pool %q does not exist on this interface", ErrBadRequest, pool)
+	}
+	have, err := fitPeerIP(v.fams, keep)
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrBadRequest, err)
+	}
+
+	out := make([]string, len(v.fams))
+	var fresh []string
+	for i, f := range v.fams {
+		if have[i].IsValid() {
+			// 显式地址同样从空闲区间中扣除，避免之后被自动分配（及写入快照）
+			if v.free != nil && v.free[i] != nil {
+				v.free[i].Take(have[i])
+			}
+			out[i] = have[i].String()
+			continue
+		}
+		a, err := v.allocate(pool, i)
+		if err != nil {
+			for _, x := range fresh {
+				delete(v.used, x)
+			}
+			if errors.Is(err, ipam.ErrNoAvailableIP) {
+				if pool != "" {
+					return "", fmt.Errorf("%w: no available ip in pool %s (%s)", ErrConflict, pool, f.Prefix)
+				}
+				return "", fmt.Errorf("%w: no available ip in %s", ErrConflict, f.Prefix)
+			}
+			return "", err
+		}
+		v.used[a.String()] = struct{}{}
+		fresh = append(fresh, a.String())
+		out[i] = a.String()
+	}
+	markUsed(v.used, strings.Join(out, ","))
+	return strings.Join(out, ", "), nil
+}
+
+// poolOf 返回地址所在的地址池名
+func (v *ipamView) poolOf(a netip.Addr) string {
+	for _, p := range v.pools {
+		if cidrset.ContainsAddr(v.poolRanges[p.Name], a) {
+			return p.Name
+		}
+	}
+	return ""
+}
+
+/* -------------------- 隔离期 -------------------- */
+
+// quarantineIPs 把释放的地址放入隔离期；keep 中仍在使用的地址跳过（peer 改址时只隔离旧地址）
+func (s *WireGuardService) quarantineIPs(ctx context.Context, tx repository.Store, interfaceID int, peerName, released, keep string) error {
+	if s.ipQuarantine <= 0 {
+		return nil
+	}
+	still := map[string]bool{}
+	for _, a := range peerAddrs(keep) {
+		still[a.String()] = true
+	}
+	now := time.Now()
+	for _, a := range peerAddrs(released) {
+		if still[a.String()] {
+			continue
+		}
+		q := &models.QuarantinedIP{
+			InterfaceID: interfaceID,
+			IP:          a.String(),
+			PeerName:    peerName,
+			ReleasedAt:  now,
+			Until:       now.Add(s.ipQuarantine),
+		}
+		if err := tx.IPAM().Quarantine(ctx, q); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ReleaseQuarantinedIP 提前结束地址的隔离期
+func (s *WireGuardService) ReleaseQuarantinedIP(ctx context.Context, interfaceID int, ip string) error {
+	a, err := netip.ParseAddr(strings.TrimSpace(ip))
+	if err != nil {
+		return fmt.Errorf("%w: invalid ip %q", ErrBadRequest, ip)
+	}
+	if _, err := s.GetInterface(interfaceID); err != nil {
+		return err
+	}
+	return s.store.IPAM().Unquarantine(ctx, interfaceID, a.Unmap().String())
+}
+
+/* -------------------- 地址池 / 保留地址（CRUD） -------------------- */
+
+// parseInterfaceRanges 解析地址列表并确认全部落在接口网段内；返回规整后的文本与前缀
+func parseInterfaceRanges(field, s string, fams []addrFamily) (string, []netip.Prefix, error) {
+	items := splitCSV(s)
+	ps, err := parseCIDRItems(items)
+	if err != nil {
+		return "", nil, fmt.Errorf("%w: %s: %v", ErrBadRequest, field, err)
+	}
+	if len(ps) == 0 {
+		return "", nil, fmt.Errorf("%w: %s is required", ErrBadRequest, field)
+	}
+	nets := make([]netip.Prefix, len(fams))
+	for i, f := range fams {
+		nets[i] = f.Prefix
+	}
+	for _, p := range ps {
+		if !cidrset.ContainsPrefix(nets, p) {
+			return "", nil, fmt.Errorf("%w: %s: %s is outside the interface subnets", ErrBadRequest, field, p)
+		}
+	}
+	return strings.Join(items, ", "), ps, nil
+}
+
+func (s *WireGuardService) ListIPPools(ctx context.Context, interfaceID int) ([]models.IPPool, error) {
+	if _, err := s.GetInterface(interfaceID); err != nil {
+		return nil, err
+	}
+	list, err := s.store.IPAM().ListPools(ctx, interfaceID)
+	if err != nil {
+		return nil, err
+	}
+	if list == nil {
+		list = []models.IPPool{}
+	}
+	return list, nil
+}
+
+// SaveIPPool 创建（poolID 为 0）或更新地址池；同一接口的地址池不能重叠
+func (s *WireGuardService) SaveIPPool(ctx context.Context, interfaceID, poolID int, req *models.IPPoolRequest) (*models.IPPool, error) {
+	name := strings.TrimSpace(req.Name)
+	if name == "" {
+		return nil, fmt.Errorf("%w: name is required", ErrBadRequest)
+	}
+	var out *models.IPPool
+	err := s.store.WithTx(ctx, func(tx repository.Store) error {
+		it, err := tx.Interfaces().Get(ctx, interfaceID)
+		if err != nil {
+			return mapRepoErr(err, "interface")
+		}
+		fams, err := interfaceFamilies(it)
+		if err != nil {
+			return err
+		}
+		ranges, ps, err := parseInterfaceRanges("ranges", req.Ranges, fams)
+		if err != nil {
+			return err
+		}
+		pools, err := tx.IPAM().ListPools(ctx, interfaceID)
+		if err != nil {
+			return err
+		}
+		for _, other := range pools {
+			if other.ID == poolID {
+				continue
+			}
+			ops, err := parseCIDRItems(splitCSV(other.Ranges))
+			if err != nil {
+				return err
+			}
+			if cidrset.Size(cidrset.Subtract(ps, ops)).Cmp(cidrset.Size(cidrset.Union(ps))) != 0 {
+				return fmt.Errorf("%w: ranges overlap ip pool %s", ErrConflict, other.Name)
+			}
+		}
+
+		p := &models.IPPool{ID: poolID, InterfaceID: interfaceID, Name: name, Ranges: ranges,
+			Description: strings.TrimSpace(req.Description)}
+		if poolID == 0 {
+			err = tx.IPAM().CreatePool(ctx, p)
+		} else {
+			var cur *models.IPPool
+			if cur, err = tx.IPAM().GetPool(ctx, poolID); err == nil && cur.InterfaceID != interfaceID {
+				err = repository.ErrNotFound
+			}
+			if err == nil {
+				err = tx.IPAM().UpdatePool(ctx, p)
+			}
+		}
+		if err != nil {
+			return mapRepoErr(err, "ip pool")
+		}
+		out, err = tx.IPAM().GetPool(ctx, p.ID)
+		return err
+	})
+	return out, err
+}
+
+func (s *WireGuardService) DeleteIPPool(ctx context.Context, interfaceID, poolID int) error {
+	return s.store.WithTx(ctx, func(tx repository.Store) error {
+		p, err := tx.IPAM().GetPool(ctx, poolID)
+		if err != nil || p.InterfaceID != interfaceID {
+			return mapRepoErr(repository.ErrNotFound, "ip pool")
+		}
+		return mapRepoErr(tx.IPAM().DeletePool(ctx, poolID), "ip pool")
+	})
+}
+
+func (s *WireGuardService) ListIPReservations(ctx context.Context, interfaceID int) ([]models.IPReservation, error) {
+	if _, err := s.GetInterface(interfaceID); err != nil {
+		return nil, err
+	}
+	list, err := s.store.IPAM().ListReservations(ctx, interfaceID)
+	if err != nil {
+		return nil, err
+	}
+	if list == nil {
+		list = []models.IPReservation{}
+	}
+	return list, nil
+}
+
+// CreateIPReservation 保留地址；与已分配给 peer 的地址重叠时拒绝
+func (s *WireGuardService) CreateIPReservation(ctx context.Context, interfaceID int, req *models.IPReservationRequest) (*models.IPReservation, error) {
+	var out *models.IPReservation
+	err := s.store.WithTx(ctx, func(tx repository.Store) error {
+		it, err := tx.Interfaces().Get(ctx, interfaceID)
+		if err != nil {
+			return mapRepoErr(err, "interface")
+		}
+		fams, err := interfaceFamilies(it)
+		if err != nil {
+			return err
+		}
+		addrs, ps, err := parseInterfaceRanges("addresses", req.Addresses, fams)
+		if err != nil {
+			return err
+		}
+		peers, err := tx.Peers().ListByInterface(ctx, interfaceID)
+		if err != nil {
+			return err
+		}
+		for _, p := range peers {
+			for _, a := range peerAddrs(p.IP) {
+				if cidrset.ContainsAddr(ps, a) {
+					return fmt.Errorf("%w: %s is assigned to peer %s", ErrConflict, a, p.Name)
+				}
+			}
+		}
+		r := &models.IPReservation{InterfaceID: interfaceID, Addresses: addrs, Note: strings.TrimSpace(req.Note)}
+		if err := tx.IPAM().CreateReservation(ctx, r); err != nil {
+			return mapRepoErr(err, "ip reservation")
+		}
+		list, err := tx.IPAM().ListReservations(ctx, interfaceID)
+		if err != nil {
+			return err
+		}
+		for i := range list {
+			if list[i].ID == r.ID {
+				out = &list[i]
+			}
+		}
+		return nil
+	})
+	return out, err
+}
+
+func (s *WireGuardService) DeleteIPReservation(ctx context.Context, interfaceID, id int) error {
+	return s.store.WithTx(ctx, func(tx repository.Store) error {
+		list, err := tx.IPAM().ListReservations(ctx, interfaceID)
+		if err != nil {
+			return err
+		}
+		for _, r := range list {
+			if r.ID == id {
+				return mapRepoErr(tx.IPAM().DeleteReservation(ctx, id), "ip reservation")
+			}
+		}
+		return mapRepoErr(repository.ErrNotFound, "ip reservation")
+	})
+}
+
+/* -------------------- 使用率 -------------------- */
+
+// IPAMCounts 是一组地址的使用情况；数量用十进制字符串，IPv6 网段可能超出 int64
+type IPAMCounts struct {
+	Size        string  `json:"size"` // 可分配地址数（不含网络/广播/服务端地址）
+	Assigned    int     `json:"assigned"`
+	Reserved    string  `json:"reserved"`
+	Quarantined int     `json:"quarantined"`
+	Free        string  `json:"free"`
+	Utilization float64 `json:"utilization"` // 百分比：(size - free) / size
+}
+
+type IPAMFamilyUsage struct {
+	CIDR     string `json:"cidr"`
+	ServerIP string `json:"server_ip"`
+	IPAMCounts
+}
+
+type IPAMPoolUsage struct {
+	models.IPPool
+	IPAMCounts
+}
+
+type IPAssignment struct {
+	PeerID int    `json:"peer_id"`
+	Name   string `json:"name"`
+	IP     string `json:"ip"`
+	Pool   string `json:"pool,omitempty"`
+}
+
+type IPAMUsage struct {
+	InterfaceID  int                    `json:"interface_id"`
+	Interface    string                 `json:"interface"`
+	Families     []IPAMFamilyUsage      `json:"families"`
+	Pools        []IPAMPoolUsage        `json:"pools"`
+	Reservations []models.IPReservation `json:"reservations"`
+	Quarantine   []models.QuarantinedIP `json:"quarantine"`
+	Assignments  []IPAssignment         `json:"assignments"`
+}
+
+// GetIPAMUsage 汇总接口各地址族与地址池的使用率
+func (s *WireGuardService) GetIPAMUsage(ctx context.Context, interfaceID int) (*IPAMUsage, error) {
+	it, err := s.GetInterface(interfaceID)
+	if err != nil {
+		return nil, err
+	}
+	fams, err := interfaceFamilies(it)
+	if err != nil {
+		return nil, err
+	}
+	peers, err := s.store.Peers().ListByInterface(ctx, interfaceID)
+	if err != nil {
+		return nil, err
+	}
+	v, err := s.loadIPAMView(ctx, s.store, interfaceID, fams, nil)
+	if err != nil {
+		return nil, err
+	}
+	res, err := s.store.IPAM().ListReservations(ctx, interfaceID)
+	if err != nil {
+		return nil, err
+	}
+	qs, err := s.store.IPAM().ListQuarantine(ctx, interfaceID, time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	u := &IPAMUsage{
+		InterfaceID:  it.ID,
+		Interface:    it.Name,
+		Families:     []IPAMFamilyUsage{},
+		Pools:        []IPAMPoolUsage{},
+		Reservations: res,
+		Quarantine:   qs,
+		Assignments:  []IPAssignment{},
+	}
+	if u.Reservations == nil {
+		u.Reservations = []models.IPReservation{}
+	}
+	if u.Quarantine == nil {
+		u.Quarantine = []models.QuarantinedIP{}
+	}
+
+	var assigned []netip.Addr
+	for _, p := range peers {
+		as := peerAddrs(p.IP)
+		assigned = append(assigned, as...)
+		pool := ""
+		if len(as) > 0 {
+			pool = v.poolOf(as[0])
+		}
+		u.Assignments = append(u.Assignments, IPAssignment{PeerID: p.ID, Name: p.Name, IP: p.IP, Pool: pool})
+	}
+
+	for _, f := range fams {
+		u.Families = append(u.Families, IPAMFamilyUsage{
+			CIDR:       f.Prefix.String(),
+			ServerIP:   f.Server.String(),
+			IPAMCounts: v.count([]netip.Prefix{f.Prefix}, assigned),
+		})
+	}
+	for _, p := range v.pools {
+		u.Pools = append(u.Pools, IPAMPoolUsage{IPPool: p, IPAMCounts: v.count(v.poolRanges[p.Name], assigned)})
+	}
+	return u, nil
+}
+
+// count 统计 set 内的地址使用情况
+func (v *ipamView) count(set []netip.Prefix, assigned []netip.Addr) IPAMCounts {
+	// 去掉网络/广播/服务端地址
+	var specials []netip.Prefix
+	for _, f := range v.fams {
+		specials = append(specials, netip.PrefixFrom(f.Server, f.Server.BitLen()), netip.PrefixFrom(f.Prefix.Addr(), f.Prefix.Addr().BitLen()))
+		if f.Prefix.Addr().Is4() && f.Prefix.Bits() < 31 {
+			last := cidrset.RangeOf(f.Prefix).Last
+			specials = append(specials, netip.PrefixFrom(last, 32))
+		}
+	}
+	usable := cidrset.Subtract(set, specials)
+	open := cidrset.Subtract(usable, v.reserved)
+
+	size := cidrset.Size(usable)
+	reserved := new(big.Int).Sub(size, cidrset.Size(open))
+	var c IPAMCounts
+	inUse := map[string]bool{}
+	for _, a := range assigned {
+		if cidrset.ContainsAddr(usable, a) {
+			c.Assigned++
+			inUse[a.String()] = true
+		}
+	}
+	for ip := range v.quarantined {
+		if a, err := netip.ParseAddr(ip); err == nil && !inUse[ip] && cidrset.ContainsAddr(open, a) {
+			c.Quarantined++
+		}
+	}
+
+	free := new(big.Int).Sub(cidrset.Size(open), big.NewInt(int64(c.Assigned+c.Quarantined)))
+	if free.Sign() < 0 {
+		free.SetInt64(0)
+	}
+	c.Size, c.Reserved, c.Free = size.String(), reserved.String(), free.String()
+	if size.Sign() > 0 {
+		used := new(big.Float).SetInt(new(big.Int).Sub(size, free))
+		pct, _ := new(big.Float).Quo(used, new(big.Float).SetInt(size)).Float64()
+		c.Utilization = float64(int64(pct*10000+0.5)) / 100
+	}
+	return c
+}
@@ -0,0 +1,140 @@
+package services
+
+import (
+	"backend/models"
+	"context"
+	"errors"
+	"testing"
+)
+
+// TestIPAMViewCache 确认缓存的分配视图能感知绕过 CreatePeer 的写入
+func TestIPAMViewCache(t *testing.T) {
+	ctx := context.Background()
+	wg := newTestService(t)
+	wg.SetIPQuarantine(0)
+	store := wg.store
+
+	it := &models.WireGuardInterface{Name: "wgipam0", Address: "10.20.0.1/24", ListenPort: 51830, Mode: "server"}
+	if err := store.Interfaces().Create(ctx, it); err != nil {
+		t.Fatalf("create interface: %v", err)
+	}
+	var firstID int
+
+	steps := []struct {
+		name     string
+		external func() error // 在本次 CreatePeer 之前直接写仓储
+		want     string
+	}{
+		{name: "cold cache", want: "10.20.0.2"},
+		{name: "warm cache", want: "10.20.0.3"},
+		{
+			name: "peer inserted elsewhere",
+			external: func() error {
+				return store.Peers().Create(ctx, &models.WireGuardPeer{InterfaceID: it.ID, Name: "ext", IP: "10.20.0.4", PublicKey: "ext"})
+			},
+			want: "10.20.0.5",
+		},
+		{
+			name:     "peer deleted elsewhere",
+			external: func() error { return store.Peers().Delete(ctx, firstID) },
+			want:     "10.20.0.2",
+		},
+		{
+			name: "reservation added",
+			external: func() error {
+				return store.IPAM().CreateReservation(ctx, &models.IPReservation{InterfaceID: it.ID, Addresses: "10.20.0.6-10.20.0.9"})
+			},
+			want: "10.20.0.10",
+		},
+	}
+	for i, st := range steps {
+		if st.external != nil {
+			if err := st.external(); err != nil {
+				t.Fatalf("%s: %v", st.name, err)
+			}
+		}
+		p, err := wg.CreatePeer(ctx, &models.CreatePeerRequest{InterfaceID: uint(it.ID), Name: "p" + string(rune('a'+i))})
+		if err != nil {
+			t.Fatalf("%s: create peer: %v", st.name, err)
+		}
+		if i == 0 {
+			firstID = p.ID
+		}
+		if p.IP != st.want {
+			t.Errorf("%s: got %s, want %s", st.name, p.IP, st.want)
+		}
+		// 本次写入已记入缓存版本，下一次分配不需要重建
+		ver, _ := store.IPAM().Version(ctx, it.ID)
+		if e := wg.ipamCache[it.ID]; e == nil || e.version != ver {
+			t.Errorf("%s: cached view is stale after create (db version %d)", st.name, ver)
+		}
+	}
+}
+
+// TestIPAMSnapshot 确认重启后从持久化的空闲区间恢复分配视图，且与已用地址一致
+func TestIPAMSnapshot(t *testing.T) {
+	ctx := context.Background()
+	wg := newTestService(t)
+	wg.SetIPQuarantine(0)
+	wg.SetRandomIPv6(false)
+	store := wg.store
+
+	it := &models.WireGuardInterface{Name: "wgsnap0", Address: "10.21.0.1/24, fd21::1/64", ListenPort: 51831, Mode: "server"}
+	if err := store.Interfaces().Create(ctx, it); err != nil {
+		t.Fatalf("create interface: %v", err)
+	}
+	create := func(w *WireGuardService, name, ip string) (*models.WireGuardPeer, error) {
+		req := &models.CreatePeerRequest{InterfaceID: uint(it.ID), Name: name}
+		if ip != "" {
+			req.IP = &ip
+		}
+		return w.CreatePeer(ctx, req)
+	}
+	for _, name := range []string{"a", "b"} {
+		if _, err := create(wg, name, ""); err != nil {
+			t.Fatalf("create %s: %v", name, err)
+		}
+	}
+	if _, err := create(wg, "static", "10.21.0.4, fd21::4"); err != nil {
+		t.Fatalf("create static: %v", err)
+	}
+	ver, _ := store.IPAM().Version(ctx, it.ID)
+	if st, err := store.IPAM().GetFreeState(ctx, it.ID); err != nil || st.Version != ver {
+		t.Fatalf("snapshot not kept up to date: %+v, %v (db version %d)", st, err, ver)
+	}
+
+	// 模拟重启：新的服务实例没有内存缓存
+	restarted := NewWireGuardServiceWithStore(store)
+	restarted.SetFirewall(nil)
+	restarted.SetNetworkBackend(nil)
+	restarted.SetHooks(false, 0)
+	restarted.SetIPQuarantine(0)
+	restarted.SetRandomIPv6(false)
+	t.Cleanup(func() { restarted.Close() })
+
+	if _, err := create(restarted, "dup", "10.21.0.2"); !errors.Is(err, ErrConflict) {
+		t.Fatalf("static ip held by a peer: got %v, want conflict", err)
+	}
+	p, err := create(restarted, "c", "")
+	if err != nil {
+		t.Fatalf("create after restart: %v", err)
+	}
+	if p.IP != "10.21.0.5, fd21::5" {
+		t.Errorf("after restart got %s, want 10.21.0.5, fd21::5", p.IP)
+	}
+	if e := restarted.ipamCache[it.ID]; e == nil || !e.view.spansOnly {
+		t.Errorf("view was rebuilt from used addresses instead of the snapshot")
+	}
+
+	// 绕过缓存的写入使快照过期，下一次分配重建
+	if err := store.Peers().Delete(ctx, p.ID); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	restarted.resetIPAMCache()
+	if p, err = create(restarted, "d", ""); err != nil || p.IP != "10.21.0.5, fd21::5" {
+		t.Fatalf("create after external delete: %v, %v", p, err)
+	}
+	if e := restarted.ipamCache[it.ID]; e == nil || e.view.spansOnly {
+		t.Errorf("stale snapshot was used")
+	}
+}
@@ -0,0 +1,186 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/netip"
+	"os/exec"
+	"strings"
+)
+
+/* -------------------- 内核链路操作（ip 命令） -------------------- */
+
+func runShell(cmd string) ([]byte, error) {
+	return exec.Command("bash", "-lc", cmd).CombinedOutput()
+}
+
+func ipEnsureLink(name string) error {
+	// 已存在则忽略错误
+	if out, err := runShell(fmt.Sprintf(`ip link show %q`, name)); err == nil && len(out) > 0 {
+		return nil
+	}
+	// 创建 wireguard 链路
+	if out, err := runShell(fmt.Sprintf(`ip link add dev %q type wireguard`, name)); err != nil {
+		return fmt.Errorf("ip link add %s: %v (%s)", name, err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+func ipSetMTU(name string, mtu int) error {
+	if mtu <= 0 {
+		return nil
+	}
+	if out, err := runShell(fmt.Sprintf(`ip link set dev %q mtu %d`, name, mtu)); err != nil {
+		return fmt.Errorf("ip set mtu: %v (%s)", err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// ipAddrReplace 设置接口地址；address 可为逗号分隔的多个 CIDR（双栈）
+func ipAddrReplace(name, address string) error {
+	for _, cidr := range strings.Split(address, ",") {
+		cidr = strings.TrimSpace(cidr)
+		if cidr == "" {
+			continue
+		}
+		if out, err := runShell(fmt.Sprintf(`ip address replace %s dev %q`, cidr, name)); err != nil {
+			return fmt.Errorf("ip addr replace %s: %v (%s)", cidr, err, strings.TrimSpace(string(out)))
+		}
+	}
+	return nil
+}
+
+func ipAddrDel(name, cidr string) error {
+	if out, err := runShell(fmt.Sprintf(`ip address del %s dev %q`, cidr, name)); err != nil {
+		return fmt.Errorf("ip addr del %s: %v (%s)", cidr, err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+func ipLinkUp(name string) error {
+	if out, err := runShell(fmt.Sprintf(`ip link set up dev %q`, name)); err != nil {
+		return fmt.Errorf("ip link up: %v (%s)", err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+func ipLinkDown(name string) error {
+	if out, err := runShell(fmt.Sprintf(`ip link set down dev %q`, name)); err != nil {
+		return fmt.Errorf("ip link down: %v (%s)", err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+func ipLinkDel(name string) error {
+	if out, err := runShell(fmt.Sprintf(`ip link del dev %q`, name)); err != nil {
+		return fmt.Errorf("ip link del: %v (%s)", err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// tableArgs 是 ip route 的 table 参数；空表示 main
+func tableArgs(table string) string {
+	if table == "" {
+		return ""
+	}
+	return " table " + table
+}
+
+// ipStaticRoutes 列出设备上 proto static 的路由（由本程序安装），table 为空表示 main
+func ipStaticRoutes(name, table string) ([]netip.Prefix, error) {
+	var out []netip.Prefix
+	for _, fam := range []string{"-4", "-6"} {
+		args := []string{"-j", fam, "route", "show", "dev", name, "proto", "static"}
+		if table != "" {
+			args = append(args, "table", table)
+		}
+		raw, err := exec.Command("ip", args...).Output()
+		if err != nil {
+			return nil, fmt.Errorf("ip route show dev %s: %w", name, err)
+		}
+		var rows []struct {
+			Dst string `json:"dst"`
+		}
+		if err := json.Unmarshal(raw, &rows); err != nil {
+			return nil, fmt.Errorf("ip route show dev %s: %w", name, err)
+		}
+		for _, r := range rows {
+			switch {
+			case r.Dst == "default" && fam == "-4":
+				out = append(out, netip.MustParsePrefix("0.0.0.0/0"))
+			case r.Dst == "default":
+				out = append(out, netip.MustParsePrefix("::/0"))
+			default:
+				if p, err := netip.ParsePrefix(r.Dst); err == nil {
+					out = append(out, p)
+				} else if a, err := netip.ParseAddr(r.Dst); err == nil {
+					out = append(out, netip.PrefixFrom(a, a.BitLen()))
+				}
+			}
+		}
+	}
+	return out, nil
+}
+
+// ipRouteSync 让设备在 table 中的 static 路由与 want 一致：缺的 replace，多的删除
+func ipRouteSync(name, table string, want []netip.Prefix) error {
+	have, err := ipStaticRoutes(name, table)
+	if err != nil {
+		return err
+	}
+	keep := make(map[netip.Prefix]bool, len(want))
+	for _, p := range want {
+		keep[p] = true
+		if out, err := runShell(fmt.Sprintf(`ip route replace %s dev %q proto static%s`, p, name, tableArgs(table))); err != nil {
+			return fmt.Errorf("ip route replace %s: %v (%s)", p, err, strings.TrimSpace(string(out)))
+		}
+	}
+	for _, p := range have {
+		if keep[p] {
+			continue
+		}
+		if out, err := runShell(fmt.Sprintf(`ip route del %s dev %q proto static%s`, p, name, tableArgs(table))); err != nil {
+			return fmt.Errorf("ip route del %s: %v (%s)", p, err, strings.TrimSpace(string(out)))
+		}
+	}
+	return nil
+}
+
+// ipPolicyRules 同 wg-quick 的 Table=auto 默认路由：未打 fwmark 的流量查 table，
+// main 表中除默认路由外的路由仍优先（suppress_prefixlength 0）；fams 为 "-4" / "-6"
+func ipPolicyRules(table int, fams []string) error {
+	for _, fam := range fams {
+		rules, err := runShell(fmt.Sprintf(`ip %s rule show`, fam))
+		if err != nil {
+			return fmt.Errorf("ip rule show: %v (%s)", err, strings.TrimSpace(string(rules)))
+		}
+		cmds := []string{}
+		if !strings.Contains(string(rules), fmt.Sprintf("lookup %d", table)) {
+			cmds = append(cmds, fmt.Sprintf(`ip %s rule add not fwmark %d table %d`, fam, table, table))
+		}
+		if !strings.Contains(string(rules), "from all lookup main suppress_prefixlength 0") {
+			cmds = append(cmds, fmt.Sprintf(`ip %s rule add table main suppress_prefixlength 0`, fam))
+		}
+		if fam == "-4" {
+			// 回包按 fwmark 做反向路径校验
+			cmds = append(cmds, `sysctl -q net.ipv4.conf.all.src_valid_mark=1`)
+		}
+		for _, c := range cmds {
+			if out, err := runShell(c); err != nil {
+				return fmt.Errorf("%s: %v (%s)", c, err, strings.TrimSpace(string(out)))
+			}
+		}
+	}
+	return nil
+}
+
+// ipPolicyRulesDel 删除 ipPolicyRules 添加的规则，不存在时忽略；
+// suppress_prefixlength 规则为各接口共用，keepShared 时保留
+func ipPolicyRulesDel(table int, keepShared bool) {
+	for _, fam := range []string{"-4", "-6"} {
+		_, _ = runShell(fmt.Sprintf(`while ip %[1]s rule show | grep -q "lookup %[2]d"; do ip %[1]s rule del table %[2]d || break; done`, fam, table))
+		if !keepShared {
+			_, _ = runShell(fmt.Sprintf(`while ip %[1]s rule show | grep -q "from all lookup main suppress_prefixlength 0"; do ip %[1]s rule del table main suppress_prefixlength 0 || break; done`, fam))
+		}
+	}
+}
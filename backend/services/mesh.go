@@ -0,0 +1,476 @@
+package services
+
+import (
+	"backend/models"
+	"backend/repository"
+	"backend/wgconf"
+	"context"
+	"fmt"
+	"net"
+	"net/netip"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 成员名用作配置注释与打包目录名，限制为简单标识符
+var meshMemberNameRe = regexp.MustCompile(`^[A-Za-z0-9_.-]{1,64}$`)
+
+const (
+	defaultMeshListenPort = 51820
+	defaultMeshMTU        = 1420
+	defaultMeshKeepalive  = 25
+)
+
+// normalizeMeshNetwork 校验 mesh 网段：每个地址族一个 CIDR，返回规整后的网段与地址族
+func normalizeMeshNetwork(network string) (string, []addrFamily, error) {
+	fams, err := parseInterfaceAddress(network)
+	if err != nil {
+		return "", nil, err
+	}
+	nets := make([]string, len(fams))
+	for i, f := range fams {
+		if f.Prefix.Bits() > f.Prefix.Addr().BitLen()-2 {
+			return "", nil, fmt.Errorf("%w: network %s is too small", ErrBadRequest, f.Prefix)
+		}
+		// 网络地址不分配给成员（同接口的 server 地址），这里统一按网段存
+		fams[i].Server = f.Prefix.Addr()
+		nets[i] = f.Prefix.String()
+	}
+	return strings.Join(nets, ", "), fams, nil
+}
+
+func meshFamilies(m *models.Mesh) ([]addrFamily, error) {
+	_, fams, err := normalizeMeshNetwork(m.Network)
+	if err != nil {
+		return nil, fmt.Errorf("mesh %s: %w", m.Name, err)
+	}
+	return fams, nil
+}
+
+// meshIPAM 构造 mesh 的地址分配视图：没有地址池、保留与隔离期，只扣除已分配给成员的地址
+func (s *WireGuardService) meshIPAM(fams []addrFamily, members []models.MeshMember, skipID int) *ipamView {
+	var ips []string
+	for _, x := range members {
+		if x.ID != skipID {
+			ips = append(ips, x.IP)
+		}
+	}
+	return &ipamView{
+		fams:        fams,
+		poolRanges:  map[string][]netip.Prefix{},
+		quarantined: map[string]time.Time{},
+		used:        usedAddrSet(fams, ips),
+		random6:     s.randomIPv6,
+	}
+}
+
+func validPort(field string, p *int, allowZero bool) error {
+	if p == nil {
+		return nil
+	}
+	if *p < 0 || *p > 65535 || (*p == 0 && !allowZero) {
+		return fmt.Errorf("%w: %s must be 1-65535", ErrBadRequest, field)
+	}
+	return nil
+}
+
+/* -------------------- mesh（CRUD） -------------------- */
+
+func (s *WireGuardService) ListMeshes(ctx context.Context) ([]models.Mesh, error) {
+	list, err := s.store.Meshes().List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if list == nil {
+		list = []models.Mesh{}
+	}
+	return list, nil
+}
+
+func (s *WireGuardService) GetMesh(ctx context.Context, id int) (*models.Mesh, error) {
+	m, err := s.store.Meshes().Get(ctx, id)
+	if err != nil {
+		return nil, mapRepoErr(err, "mesh")
+	}
+	return m, nil
+}
+
+// applyMeshRequest 把请求合并到 m；数值字段为 nil 时保留原值（新建时为默认值）
+func applyMeshRequest(m *models.Mesh, req *models.MeshRequest) error {
+	name := strings.TrimSpace(req.Name)
+	if !ifaceNameRe.MatchString(name) {
+		// 成员配置以 mesh 名作为 wg-quick 接口名（<name>.conf）
+		return fmt.Errorf("%w: invalid mesh name %q (must be a valid interface name)", ErrBadRequest, name)
+	}
+	network, _, err := normalizeMeshNetwork(req.Network)
+	if err != nil {
+		return err
+	}
+	if err := validPort("listen_port", req.ListenPort, false); err != nil {
+		return err
+	}
+	if req.MTU != nil && (*req.MTU < 1280 || *req.MTU > 9000) {
+		return fmt.Errorf("%w: mtu must be 1280-9000", ErrBadRequest)
+	}
+	if req.PersistentKeepalive != nil && (*req.PersistentKeepalive < 0 || *req.PersistentKeepalive > 65535) {
+		return fmt.Errorf("%w: persistent_keepalive must be 0-65535", ErrBadRequest)
+	}
+	m.Name, m.Network = name, network
+	if req.ListenPort != nil {
+		m.ListenPort = *req.ListenPort
+	}
+	if req.MTU != nil {
+		m.MTU = *req.MTU
+	}
+	if req.PersistentKeepalive != nil {
+		m.PersistentKeepalive = *req.PersistentKeepalive
+	}
+	return nil
+}
+
+func (s *WireGuardService) CreateMesh(ctx context.Context, req *models.MeshRequest) (*models.Mesh, error) {
+	m := &models.Mesh{ListenPort: defaultMeshListenPort, MTU: defaultMeshMTU, PersistentKeepalive: defaultMeshKeepalive}
+	if err := applyMeshRequest(m, req); err != nil {
+		return nil, err
+	}
+	if err := s.store.Meshes().Create(ctx, m); err != nil {
+		return nil, mapRepoErr(err, "mesh")
+	}
+	return s.GetMesh(ctx, m.ID)
+}
+
+// UpdateMesh 修改 mesh；网段变化时成员尽量沿用原地址，不在新网段内的重新分配
+func (s *WireGuardService) UpdateMesh(ctx context.Context, id int, req *models.MeshRequest) (*models.Mesh, error) {
+	err := s.store.WithTx(ctx, func(tx repository.Store) error {
+		m, err := tx.Meshes().Get(ctx, id)
+		if err != nil {
+			return mapRepoErr(err, "mesh")
+		}
+		before := *m
+		if err := applyMeshRequest(m, req); err != nil {
+			return err
+		}
+		if *m == before {
+			return nil
+		}
+		if m.Network != before.Network {
+			if err := s.renumberMesh(ctx, tx, m); err != nil {
+				return err
+			}
+		}
+		m.Revision++
+		return mapRepoErr(tx.Meshes().Update(ctx, m), "mesh")
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s.GetMesh(ctx, id)
+}
+
+// renumberMesh 把成员地址换到 m 的新网段：先保留仍然合法的地址，再为其余成员分配
+func (s *WireGuardService) renumberMesh(ctx context.Context, tx repository.Store, m *models.Mesh) error {
+	fams, err := meshFamilies(m)
+	if err != nil {
+		return err
+	}
+	members, err := tx.Meshes().Members(ctx, m.ID)
+	if err != nil {
+		return err
+	}
+	keep := make([]string, len(members))
+	for i := range members {
+		keep[i] = fittingPeerIP(fams, members[i].IP)
+	}
+	// 先占住保留下来的地址，避免被其他成员分走
+	view := s.meshIPAM(fams, nil, 0)
+	for _, ip := range keep {
+		if err := view.checkStatic(ip); err != nil {
+			return err
+		}
+		markUsed(view.used, ip)
+	}
+	for i := range members {
+		x := &members[i]
+		releaseUsed(view.used, keep[i])
+		ip, err := view.assign("", keep[i])
+		if err != nil {
+			return err
+		}
+		if ip == x.IP {
+			continue
+		}
+		x.IP = ip
+		if err := tx.Meshes().UpdateMember(ctx, x); err != nil {
+			return mapRepoErr(err, "mesh member")
+		}
+	}
+	return nil
+}
+
+func (s *WireGuardService) DeleteMesh(ctx context.Context, id int) error {
+	return mapRepoErr(s.store.Meshes().Delete(ctx, id), "mesh")
+}
+
+/* -------------------- 成员 -------------------- */
+
+func (s *WireGuardService) ListMeshMembers(ctx context.Context, meshID int) ([]models.MeshMember, error) {
+	if _, err := s.GetMesh(ctx, meshID); err != nil {
+		return nil, err
+	}
+	list, err := s.store.Meshes().Members(ctx, meshID)
+	if err != nil {
+		return nil, err
+	}
+	if list == nil {
+		list = []models.MeshMember{}
+	}
+	return list, nil
+}
+
+// getMeshMember 读取成员并确认属于该 mesh
+func getMeshMember(ctx context.Context, store repository.Store, meshID, memberID int) (*models.MeshMember, error) {
+	x, err := store.Meshes().GetMember(ctx, memberID)
+	if err != nil {
+		return nil, mapRepoErr(err, "mesh member")
+	}
+	if x.MeshID != meshID {
+		return nil, fmt.Errorf("%w: mesh member", ErrNotFound)
+	}
+	return x, nil
+}
+
+func (s *WireGuardService) GetMeshMember(ctx context.Context, meshID, memberID int) (*models.MeshMember, error) {
+	return getMeshMember(ctx, s.store, meshID, memberID)
+}
+
+// CreateMeshMember 加入成员：分配地址、按需生成密钥对，并递增 mesh 的 revision（所有成员配置随之变化）
+func (s *WireGuardService) CreateMeshMember(ctx context.Context, meshID int, req *models.MeshMemberRequest) (*models.MeshMember, error) {
+	x := &models.MeshMember{MeshID: meshID}
+	if req.PublicKey == nil {
+		req.PublicKey = new(string)
+	}
+	var id int
+	err := s.store.WithTx(ctx, func(tx repository.Store) error {
+		if err := s.saveMeshMember(ctx, tx, x, req); err != nil {
+			return err
+		}
+		id = x.ID
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s.GetMeshMember(ctx, meshID, id)
+}
+
+// UpdateMeshMember 修改成员；public_key 为 nil 保留原密钥，空串改由管理端重新生成
+func (s *WireGuardService) UpdateMeshMember(ctx context.Context, meshID, memberID int, req *models.MeshMemberRequest) (*models.MeshMember, error) {
+	err := s.store.WithTx(ctx, func(tx repository.Store) error {
+		x, err := getMeshMember(ctx, tx, meshID, memberID)
+		if err != nil {
+			return err
+		}
+		return s.saveMeshMember(ctx, tx, x, req)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s.GetMeshMember(ctx, meshID, memberID)
+}
+
+func (s *WireGuardService) saveMeshMember(ctx context.Context, tx repository.Store, x *models.MeshMember, req *models.MeshMemberRequest) error {
+	m, err := tx.Meshes().Get(ctx, x.MeshID)
+	if err != nil {
+		return mapRepoErr(err, "mesh")
+	}
+	fams, err := meshFamilies(m)
+	if err != nil {
+		return err
+	}
+
+	name := strings.TrimSpace(req.Name)
+	if !meshMemberNameRe.MatchString(name) {
+		return fmt.Errorf("%w: invalid member name %q (letters, digits, '_', '.', '-', up to 64)", ErrBadRequest, name)
+	}
+	endpoint, err := normalizeInterfaceEndpoint(req.Endpoint)
+	if err != nil {
+		return err
+	}
+	if endpoint == "" {
+		return fmt.Errorf("%w: endpoint is required", ErrBadRequest)
+	}
+	if err := validPort("listen_port", req.ListenPort, true); err != nil {
+		return err
+	}
+	before := *x
+	x.Name, x.Endpoint = name, endpoint
+	if req.ListenPort != nil {
+		x.ListenPort = *req.ListenPort
+	}
+
+	// 密钥：显式公钥表示节点自带私钥；空串由管理端生成
+	if req.PublicKey != nil {
+		if pub := strings.TrimSpace(*req.PublicKey); pub != "" {
+			if _, err := parseWGPublicKey(pub); err != nil {
+				return fmt.Errorf("%w: %v", ErrBadRequest, err)
+			}
+			if pub != x.PublicKey {
+				x.PublicKey, x.PrivateKey = pub, ""
+			}
+		} else {
+			priv, pub, err := s.GenerateKeyPair()
+			if err != nil {
+				return err
+			}
+			x.PrivateKey, x.PublicKey = priv, pub
+		}
+	}
+
+	// 地址：显式指定的校验后使用，缺失的地址族自动分配
+	members, err := tx.Meshes().Members(ctx, x.MeshID)
+	if err != nil {
+		return err
+	}
+	view := s.meshIPAM(fams, members, x.ID)
+	keep := x.IP
+	if req.IP != nil {
+		keep = strings.TrimSpace(*req.IP)
+		if err := view.checkStatic(keep); err != nil {
+			return err
+		}
+	}
+	if x.IP, err = view.assign("", keep); err != nil {
+		return err
+	}
+
+	if x.ID == 0 {
+		if err := tx.Meshes().CreateMember(ctx, x); err != nil {
+			return mapRepoErr(err, "mesh member name or public key")
+		}
+	} else {
+		if *x == before {
+			return nil
+		}
+		if err := tx.Meshes().UpdateMember(ctx, x); err != nil {
+			return mapRepoErr(err, "mesh member name or public key")
+		}
+	}
+	return mapRepoErr(tx.Meshes().Bump(ctx, x.MeshID), "mesh")
+}
+
+// DeleteMeshMember 移除成员并递增 revision；其余成员需重新下载配置
+func (s *WireGuardService) DeleteMeshMember(ctx context.Context, meshID, memberID int) error {
+	return s.store.WithTx(ctx, func(tx repository.Store) error {
+		if _, err := getMeshMember(ctx, tx, meshID, memberID); err != nil {
+			return err
+		}
+		if err := tx.Meshes().DeleteMember(ctx, memberID); err != nil {
+			return mapRepoErr(err, "mesh member")
+		}
+		return mapRepoErr(tx.Meshes().Bump(ctx, meshID), "mesh")
+	})
+}
+
+/* -------------------- 成员配置 -------------------- */
+
+// endpointWithPort 为不带端口的 host 补上端口
+func endpointWithPort(ep string, port int) string {
+	if _, _, err := net.SplitHostPort(ep); err == nil {
+		return ep
+	}
+	return net.JoinHostPort(ep, strconv.Itoa(port))
+}
+
+func meshListenPort(m *models.Mesh, x *models.MeshMember) int {
+	if x.ListenPort > 0 {
+		return x.ListenPort
+	}
+	return m.ListenPort
+}
+
+// meshMemberConf 生成成员的 wg-quick 配置：其余所有成员各为一个 [Peer]，AllowedIPs 为其隧道地址
+func meshMemberConf(m *models.Mesh, fams []addrFamily, members []models.MeshMember, self *models.MeshMember) *wgconf.File {
+	f := &wgconf.File{
+		Name: self.Name,
+		Interface: wgconf.Interface{
+			PrivateKey: self.PrivateKey,
+			Address:    peerInterfaceAddress(fams, self.IP),
+			ListenPort: meshListenPort(m, self),
+			MTU:        m.MTU,
+		},
+		Peers: []wgconf.Peer{},
+	}
+	for i := range members {
+		o := &members[i]
+		if o.ID == self.ID {
+			continue
+		}
+		f.Peers = append(f.Peers, wgconf.Peer{
+			Name:                o.Name,
+			PublicKey:           o.PublicKey,
+			AllowedIPs:          splitCSV(hostCIDR(o.IP)),
+			Endpoint:            endpointWithPort(o.Endpoint, meshListenPort(m, o)),
+			PersistentKeepalive: m.PersistentKeepalive,
+		})
+	}
+	return f
+}
+
+func (s *WireGuardService) loadMesh(ctx context.Context, meshID int) (*models.Mesh, []addrFamily, []models.MeshMember, error) {
+	m, err := s.GetMesh(ctx, meshID)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	fams, err := meshFamilies(m)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	members, err := s.store.Meshes().Members(ctx, meshID)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	return m, fams, members, nil
+}
+
+// ExportMeshMemberConfig 生成单个成员的配置，文件名为 <mesh>.conf（wg-quick up <mesh>）；
+// 节点自带私钥时 PrivateKey 留空，需在节点上填写
+func (s *WireGuardService) ExportMeshMemberConfig(ctx context.Context, meshID, memberID int) (*PeerConfigExport, *models.Mesh, error) {
+	m, fams, members, err := s.loadMesh(ctx, meshID)
+	if err != nil {
+		return nil, nil, err
+	}
+	for i := range members {
+		if members[i].ID == memberID {
+			f := meshMemberConf(m, fams, members, &members[i])
+			return &PeerConfigExport{
+				Filename:    m.Name + ".conf",
+				ContentType: "text/plain; charset=utf-8",
+				Data:        []byte(wgconf.Render(f)),
+			}, m, nil
+		}
+	}
+	return nil, nil, fmt.Errorf("%w: mesh member", ErrNotFound)
+}
+
+// ExportMeshConfigs 打包全部成员的配置：<member>/<mesh>.conf
+func (s *WireGuardService) ExportMeshConfigs(ctx context.Context, meshID int) ([]byte, *models.Mesh, error) {
+	m, fams, members, err := s.loadMesh(ctx, meshID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(members) == 0 {
+		return nil, nil, fmt.Errorf("%w: mesh %s has no members", ErrBadRequest, m.Name)
+	}
+	files := make(map[string][]byte, len(members))
+	for i := range members {
+		f := meshMemberConf(m, fams, members, &members[i])
+		files[members[i].Name+"/"+m.Name+".conf"] = []byte(wgconf.Render(f))
+	}
+	data, err := zipFiles(files)
+	if err != nil {
+		return nil, nil, fmt.Errorf("build mesh archive: %w", err)
+	}
+	return data, m, nil
+}
@@ -0,0 +1,267 @@
+package services
+
+import (
+	"backend/cidrset"
+	"backend/models"
+	"backend/repository"
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/netip"
+	"os/exec"
+	"strings"
+)
+
+/* -------------------- 主机网络后端 -------------------- */
+
+// HostRoute 是主机路由表中的一条路由
+type HostRoute struct {
+	Dst      netip.Prefix `json:"dst"`
+	Dev      string       `json:"dev"`
+	Protocol string       `json:"protocol,omitempty"`
+}
+
+// NetworkBackend 读取主机网络状态；默认实现调用 ip 命令，非 Linux 环境或测试时可替换/关闭
+type NetworkBackend interface {
+	Routes() ([]HostRoute, error)
+}
+
+// ipCommandBackend 通过 `ip -j route` 读取 main 表
+type ipCommandBackend struct{}
+
+func NewIPCommandBackend() NetworkBackend { return ipCommandBackend{} }
+
+func (ipCommandBackend) Routes() ([]HostRoute, error) {
+	var out []HostRoute
+	for _, fam := range []string{"-4", "-6"} {
+		// 只取 stdout：JSON 输出不能混入 shell 或 ip 的告警
+		raw, err := exec.Command("ip", "-j", fam, "route", "show", "table", "main").Output()
+		if err != nil {
+			return nil, fmt.Errorf("ip route: %w", err)
+		}
+		var rows []struct {
+			Dst      string `json:"dst"`
+			Dev      string `json:"dev"`
+			Protocol string `json:"protocol"`
+		}
+		if err := json.Unmarshal(raw, &rows); err != nil {
+			return nil, fmt.Errorf("ip route: %w", err)
+		}
+		for _, r := range rows {
+			if r.Dst == "" || r.Dst == "default" {
+				continue
+			}
+			p, err := cidrset.ParsePrefix(r.Dst)
+			if err != nil {
+				continue
+			}
+			out = append(out, HostRoute{Dst: p, Dev: r.Dev, Protocol: r.Protocol})
+		}
+	}
+	return out, nil
+}
+
+// SetNetworkBackend 替换主机网络后端；nil 关闭主机路由检查
+func (s *WireGuardService) SetNetworkBackend(b NetworkBackend) {
+	s.network = b
+}
+
+/* -------------------- 网段冲突检查 -------------------- */
+
+// 这些网段不视为冲突：链路本地、组播
+var ignoredHostRoutes = []netip.Prefix{
+	netip.MustParsePrefix("fe80::/10"),
+	netip.MustParsePrefix("ff00::/8"),
+	netip.MustParsePrefix("224.0.0.0/4"),
+}
+
+// usedSubnet 是已被占用的网段及其来源，用于冲突提示
+type usedSubnet struct {
+	Prefix netip.Prefix
+	Source string
+	PeerID int // site peer 的 routed_subnets：所属 peer，否则为 0
+}
+
+// usedSubnets 汇总其他 WireGuard 接口的网段与本端局域网、各 site peer 路由的局域网与主机路由；
+// self 为正在创建/修改的接口名（其自身路由不算冲突）
+func (s *WireGuardService) usedSubnets(ctx context.Context, store repository.Store, selfID int, selfName string) ([]usedSubnet, error) {
+	list, err := store.Interfaces().List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	managed := map[string]bool{selfName: true}
+	var out []usedSubnet
+	for _, it := range list {
+		managed[it.Name] = true
+		if it.ID == selfID {
+			continue
+		}
+		fams, err := parseInterfaceAddress(it.Address)
+		if err != nil {
+			continue
+		}
+		for _, f := range fams {
+			out = append(out, usedSubnet{Prefix: f.Prefix, Source: "interface " + it.Name})
+		}
+		local, _ := cidrset.Parse(it.LocalSubnets)
+		for _, l := range local {
+			out = append(out, usedSubnet{Prefix: l, Source: "local subnet of interface " + it.Name})
+		}
+	}
+	peers, err := store.Peers().List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range peers {
+		if p.Type != models.PeerTypeSite {
+			continue
+		}
+		ps, _ := cidrset.Parse(p.RoutedSubnets)
+		for _, sn := range ps {
+			out = append(out, usedSubnet{Prefix: sn, Source: fmt.Sprintf("site peer %s on %s", p.Name, p.InterfaceName), PeerID: p.ID})
+		}
+	}
+
+	if s.network == nil {
+		return out, nil
+	}
+	routes, err := s.network.Routes()
+	if err != nil {
+		// 读不到路由表（无 ip 命令、无权限）时只检查接口之间的冲突
+		log.Printf("[ipam] host routes unavailable: %v", err)
+		return out, nil
+	}
+	for _, r := range routes {
+		// 受管接口的路由由上面的接口网段覆盖；接口运行时内核会为其网段加路由
+		if managed[r.Dev] || cidrset.ContainsPrefix(ignoredHostRoutes, r.Dst) {
+			continue
+		}
+		out = append(out, usedSubnet{Prefix: r.Dst, Source: "host route dev " + r.Dev})
+	}
+	return out, nil
+}
+
+// checkSubnetConflicts 拒绝与其他接口网段或主机路由重叠的地址
+func (s *WireGuardService) checkSubnetConflicts(ctx context.Context, store repository.Store, selfID int, selfName string, fams []addrFamily) error {
+	used, err := s.usedSubnets(ctx, store, selfID, selfName)
+	if err != nil {
+		return err
+	}
+	for _, f := range fams {
+		for _, u := range used {
+			if f.Prefix.Overlaps(u.Prefix) {
+				return fmt.Errorf("%w: address %s overlaps %s (%s)", ErrConflict, f.Prefix, u.Source, u.Prefix)
+			}
+		}
+	}
+	return nil
+}
+
+/* -------------------- 空闲网段建议 -------------------- */
+
+var (
+	privateV4 = []netip.Prefix{
+		netip.MustParsePrefix("10.0.0.0/8"),
+		netip.MustParsePrefix("172.16.0.0/12"),
+		netip.MustParsePrefix("192.168.0.0/16"),
+	}
+)
+
+// SubnetSuggestion 是建议的接口地址；Address 可直接用于创建接口
+type SubnetSuggestion struct {
+	Address string   `json:"address"`
+	CIDRs   []string `json:"cidrs"`
+}
+
+// SuggestSubnet 在私有地址中找一个不与现有接口、主机路由重叠的网段。
+// family 为 "4" / "6" / "dual"；bits4、bits6 为前缀长度（0 取默认 /24、/64）
+func (s *WireGuardService) SuggestSubnet(ctx context.Context, family string, bits4, bits6 int) (*SubnetSuggestion, error) {
+	if bits4 == 0 {
+		bits4 = 24
+	}
+	if bits6 == 0 {
+		bits6 = 64
+	}
+	if bits4 < 8 || bits4 > 30 {
+		return nil, fmt.Errorf("%w: ipv4 prefix length must be between 8 and 30", ErrBadRequest)
+	}
+	if bits6 < 48 || bits6 > 126 {
+		return nil, fmt.Errorf("%w: ipv6 prefix length must be between 48 and 126", ErrBadRequest)
+	}
+
+	used, err := s.usedSubnets(ctx, s.store, 0, "")
+	if err != nil {
+		return nil, err
+	}
+	taken := make([]netip.Prefix, len(used))
+	for i, u := range used {
+		taken[i] = u.Prefix
+	}
+
+	var nets []netip.Prefix
+	switch strings.TrimSpace(family) {
+	case "", "4":
+		p, err := freeSubnet(privateV4, taken, bits4)
+		if err != nil {
+			return nil, err
+		}
+		nets = append(nets, p)
+	case "6":
+		p, err := freeULA(taken, bits6)
+		if err != nil {
+			return nil, err
+		}
+		nets = append(nets, p)
+	case "dual":
+		p4, err := freeSubnet(privateV4, taken, bits4)
+		if err != nil {
+			return nil, err
+		}
+		p6, err := freeULA(taken, bits6)
+		if err != nil {
+			return nil, err
+		}
+		nets = append(nets, p4, p6)
+	default:
+		return nil, fmt.Errorf("%w: family must be 4, 6 or dual", ErrBadRequest)
+	}
+
+	out := &SubnetSuggestion{}
+	var addrs []string
+	for _, p := range nets {
+		out.CIDRs = append(out.CIDRs, p.String())
+		// 服务端取网段内第一个可用地址
+		addrs = append(addrs, netip.PrefixFrom(p.Addr().Next(), p.Bits()).String())
+	}
+	out.Address = strings.Join(addrs, ", ")
+	return out, nil
+}
+
+// freeSubnet 返回 pools 中去掉 taken 后第一个 /bits 网段
+func freeSubnet(pools, taken []netip.Prefix, bits int) (netip.Prefix, error) {
+	for _, p := range cidrset.Subtract(pools, taken) {
+		// Subtract 的结果是对齐的前缀，比所需网段大时取其开头
+		if p.Bits() <= bits {
+			return netip.PrefixFrom(p.Addr(), bits), nil
+		}
+	}
+	return netip.Prefix{}, fmt.Errorf("%w: no free /%d private subnet", ErrConflict, bits)
+}
+
+// freeULA 按 RFC 4193 随机生成 Global ID 得到 /48，再取其中第一个空闲的 /bits
+func freeULA(taken []netip.Prefix, bits int) (netip.Prefix, error) {
+	for try := 0; try < 16; try++ {
+		var b [16]byte
+		b[0] = 0xfd
+		if _, err := rand.Read(b[1:6]); err != nil {
+			return netip.Prefix{}, err
+		}
+		site := netip.PrefixFrom(netip.AddrFrom16(b), 48)
+		if p, err := freeSubnet([]netip.Prefix{site}, taken, bits); err == nil {
+			return p, nil
+		}
+	}
+	return netip.Prefix{}, fmt.Errorf("%w: no free /%d ULA subnet", ErrConflict, bits)
+}
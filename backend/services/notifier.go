@@ -0,0 +1,341 @@
+package services
+
+import (
+	"backend/models"
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"net/mail"
+	"net/smtp"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const notifyTimeout = 15 * time.Second
+
+// 通知事件
+const (
+	NotifyFiring   = "firing"
+	NotifyResolved = "resolved"
+	NotifyTest     = "test"
+)
+
+// AlertMessage 是投递给通知渠道的内容；测试消息的 Alert 为 nil
+type AlertMessage struct {
+	Event   string        `json:"event"`
+	Subject string        `json:"subject"`
+	Text    string        `json:"text"`
+	Alert   *models.Alert `json:"alert,omitempty"`
+}
+
+// NotifySender 把消息投递到一个通知渠道
+type NotifySender interface {
+	Send(ctx context.Context, msg AlertMessage) error
+}
+
+// NotifierFactory 按渠道配置构造 NotifySender，配置不合法时返回 ErrBadRequest
+type NotifierFactory func(n *models.Notifier) (NotifySender, error)
+
+var notifierFactories = map[string]NotifierFactory{
+	models.NotifierWebhook:  newWebhookSender,
+	models.NotifierSMTP:     newSMTPSender,
+	models.NotifierTelegram: newTelegramSender,
+}
+
+// RegisterNotifier 注册（或替换）一种通知渠道类型；需在服务启动前调用
+func RegisterNotifier(typ string, f NotifierFactory) {
+	notifierFactories[typ] = f
+}
+
+func newNotifySender(n *models.Notifier) (NotifySender, error) {
+	f, ok := notifierFactories[n.Type]
+	if !ok {
+		return nil, fmt.Errorf("%w: unknown notifier type %q", ErrBadRequest, n.Type)
+	}
+	return f(n)
+}
+
+// httpURL 校验 http(s) 地址
+func httpURL(field, raw string) (*url.URL, error) {
+	u, err := url.Parse(strings.TrimSpace(raw))
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("%w: %s must be an http(s) URL", ErrBadRequest, field)
+	}
+	return u, nil
+}
+
+// postJSON 发送 JSON 并返回响应体；错误中不带 URL（可能含 token）
+func postJSON(ctx context.Context, target string, body []byte, header http.Header) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, target, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		var ue *url.Error
+		if errors.As(err, &ue) {
+			err = ue.Err
+		}
+		return nil, err
+	}
+	defer resp.Body.Close()
+	out, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return out, fmt.Errorf("HTTP %d: %s", resp.StatusCode, strings.TrimSpace(string(out)))
+	}
+	return out, nil
+}
+
+/* -------------------- webhook -------------------- */
+
+// webhookSender 以 JSON POST 整条消息；配置了 secret 时在 X-Signature-256 中带 sha256=<HMAC>
+type webhookSender struct {
+	url    string
+	secret string
+}
+
+func newWebhookSender(n *models.Notifier) (NotifySender, error) {
+	u, err := httpURL("url", n.Settings["url"])
+	if err != nil {
+		return nil, err
+	}
+	return &webhookSender{url: u.String(), secret: n.Secret}, nil
+}
+
+func (w *webhookSender) Send(ctx context.Context, msg AlertMessage) error {
+	body, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	h := http.Header{}
+	h.Set("X-Alert-Event", msg.Event)
+	if w.secret != "" {
+		mac := hmac.New(sha256.New, []byte(w.secret))
+		mac.Write(body)
+		h.Set("X-Signature-256", "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	}
+	if _, err := postJSON(ctx, w.url, body, h); err != nil {
+		return fmt.Errorf("webhook: %w", err)
+	}
+	return nil
+}
+
+/* -------------------- SMTP -------------------- */
+
+const (
+	smtpTLSStartTLS = "starttls" // 明文连接后升级（默认，端口 587）
+	smtpTLSImplicit = "tls"      // 直接 TLS（端口 465）
+	smtpTLSNone     = "none"     // 不加密，仅用于本机中继或测试
+)
+
+type smtpSender struct {
+	host     string
+	addr     string
+	tlsMode  string
+	username string
+	password string
+	from     string
+	to       []string
+}
+
+func newSMTPSender(n *models.Notifier) (NotifySender, error) {
+	s := &smtpSender{
+		host:     strings.TrimSpace(n.Settings["host"]),
+		tlsMode:  strings.ToLower(strings.TrimSpace(n.Settings["tls"])),
+		username: strings.TrimSpace(n.Settings["username"]),
+		password: n.Secret,
+	}
+	if s.host == "" {
+		return nil, fmt.Errorf("%w: host is required", ErrBadRequest)
+	}
+	port := 587
+	switch s.tlsMode {
+	case "", smtpTLSStartTLS:
+		s.tlsMode = smtpTLSStartTLS
+	case smtpTLSImplicit:
+		port = 465
+	case smtpTLSNone:
+		port = 25
+	default:
+		return nil, fmt.Errorf("%w: tls must be starttls, tls or none", ErrBadRequest)
+	}
+	if v := strings.TrimSpace(n.Settings["port"]); v != "" {
+		p, err := strconv.Atoi(v)
+		if err != nil || p < 1 || p > 65535 {
+			return nil, fmt.Errorf("%w: invalid port %q", ErrBadRequest, v)
+		}
+		port = p
+	}
+	s.addr = net.JoinHostPort(s.host, strconv.Itoa(port))
+
+	from, err := mail.ParseAddress(n.Settings["from"])
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid from address", ErrBadRequest)
+	}
+	s.from = from.Address
+	for _, x := range strings.Split(n.Settings["to"], ",") {
+		if x = strings.TrimSpace(x); x == "" {
+			continue
+		}
+		a, err := mail.ParseAddress(x)
+		if err != nil {
+			return nil, fmt.Errorf("%w: invalid to address %q", ErrBadRequest, x)
+		}
+		s.to = append(s.to, a.Address)
+	}
+	if len(s.to) == 0 {
+		return nil, fmt.Errorf("%w: to is required", ErrBadRequest)
+	}
+	return s, nil
+}
+
+func (s *smtpSender) Send(ctx context.Context, msg AlertMessage) error {
+	if err := s.send(ctx, msg); err != nil {
+		return fmt.Errorf("smtp: %w", err)
+	}
+	return nil
+}
+
+func (s *smtpSender) send(ctx context.Context, msg AlertMessage) error {
+	d := &net.Dialer{}
+	conn, err := d.DialContext(ctx, "tcp", s.addr)
+	if err != nil {
+		return err
+	}
+	if dl, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(dl)
+	}
+	if s.tlsMode == smtpTLSImplicit {
+		conn = tls.Client(conn, &tls.Config{ServerName: s.host})
+	}
+	c, err := smtp.NewClient(conn, s.host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer c.Close()
+
+	if s.tlsMode == smtpTLSStartTLS {
+		if ok, _ := c.Extension("STARTTLS"); !ok {
+			return errors.New("server does not support STARTTLS (set tls=none to send unencrypted)")
+		}
+		if err := c.StartTLS(&tls.Config{ServerName: s.host}); err != nil {
+			return err
+		}
+	}
+	if s.username != "" {
+		if err := c.Auth(smtp.PlainAuth("", s.username, s.password, s.host)); err != nil {
+			return err
+		}
+	}
+	if err := c.Mail(s.from); err != nil {
+		return err
+	}
+	for _, to := range s.to {
+		if err := c.Rcpt(to); err != nil {
+			return err
+		}
+	}
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(s.message(msg)); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return c.Quit()
+}
+
+func (s *smtpSender) message(msg AlertMessage) []byte {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "From: %s\r\n", s.from)
+	fmt.Fprintf(&b, "To: %s\r\n", strings.Join(s.to, ", "))
+	fmt.Fprintf(&b, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", msg.Subject))
+	fmt.Fprintf(&b, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	b.WriteString("Content-Transfer-Encoding: 8bit\r\n\r\n")
+	for _, line := range strings.Split(msg.Text, "\n") {
+		// 统一为 CRLF；行首的 "." 由 smtp 的 DotWriter 转义
+		b.WriteString(strings.TrimRight(line, "\r"))
+		b.WriteString("\r\n")
+	}
+	return b.Bytes()
+}
+
+/* -------------------- Telegram 风格的 bot API -------------------- */
+
+const defaultTelegramAPI = "https://api.telegram.org"
+
+// telegramSender 调用 <api_url>/bot<token>/sendMessage；api_url 可指向兼容的自建服务
+type telegramSender struct {
+	endpoint string
+	chatID   string
+}
+
+func newTelegramSender(n *models.Notifier) (NotifySender, error) {
+	api := n.Settings["api_url"]
+	if strings.TrimSpace(api) == "" {
+		api = defaultTelegramAPI
+	}
+	u, err := httpURL("api_url", api)
+	if err != nil {
+		return nil, err
+	}
+	chatID := strings.TrimSpace(n.Settings["chat_id"])
+	if chatID == "" {
+		return nil, fmt.Errorf("%w: chat_id is required", ErrBadRequest)
+	}
+	if strings.TrimSpace(n.Secret) == "" {
+		return nil, fmt.Errorf("%w: secret (bot token) is required", ErrBadRequest)
+	}
+	return &telegramSender{
+		endpoint: strings.TrimRight(u.String(), "/") + "/bot" + url.PathEscape(strings.TrimSpace(n.Secret)) + "/sendMessage",
+		chatID:   chatID,
+	}, nil
+}
+
+func (t *telegramSender) Send(ctx context.Context, msg AlertMessage) error {
+	body, err := json.Marshal(map[string]any{
+		"chat_id":                  t.chatID,
+		"text":                     msg.Subject + "\n\n" + msg.Text,
+		"disable_web_page_preview": true,
+	})
+	if err != nil {
+		return err
+	}
+	out, err := postJSON(ctx, t.endpoint, body, nil)
+	if err != nil {
+		return fmt.Errorf("telegram: %w", err)
+	}
+	var res struct {
+		OK          bool   `json:"ok"`
+		Description string `json:"description"`
+	}
+	if err := json.Unmarshal(out, &res); err != nil {
+		return fmt.Errorf("telegram: invalid response: %w", err)
+	}
+	if !res.OK {
+		return fmt.Errorf("telegram: %s", res.Description)
+	}
+	return nil
+}
@@ -0,0 +1,338 @@
+package services
+
+import (
+	"backend/models"
+	"bufio"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/textproto"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestNewNotifySenderValidation(t *testing.T) {
+	tests := []struct {
+		name    string
+		n       models.Notifier
+		wantErr bool
+	}{
+		{name: "unknown type", n: models.Notifier{Type: "pager"}, wantErr: true},
+		{name: "webhook", n: models.Notifier{Type: models.NotifierWebhook, Settings: map[string]string{"url": "https://hooks.example.com/x"}}},
+		{name: "webhook without url", n: models.Notifier{Type: models.NotifierWebhook}, wantErr: true},
+		{name: "webhook ftp url", n: models.Notifier{Type: models.NotifierWebhook, Settings: map[string]string{"url": "ftp://example.com"}}, wantErr: true},
+		{name: "telegram", n: models.Notifier{Type: models.NotifierTelegram, Secret: "123:abc", Settings: map[string]string{"chat_id": "42"}}},
+		{name: "telegram without token", n: models.Notifier{Type: models.NotifierTelegram, Settings: map[string]string{"chat_id": "42"}}, wantErr: true},
+		{name: "telegram without chat", n: models.Notifier{Type: models.NotifierTelegram, Secret: "123:abc"}, wantErr: true},
+		{name: "smtp", n: models.Notifier{Type: models.NotifierSMTP, Settings: map[string]string{"host": "mail.example.com", "from": "wg@example.com", "to": "a@example.com, Ops <ops@example.com>"}}},
+		{name: "smtp without host", n: models.Notifier{Type: models.NotifierSMTP, Settings: map[string]string{"from": "wg@example.com", "to": "a@example.com"}}, wantErr: true},
+		{name: "smtp bad tls", n: models.Notifier{Type: models.NotifierSMTP, Settings: map[string]string{"host": "m", "tls": "ssl", "from": "wg@example.com", "to": "a@example.com"}}, wantErr: true},
+		{name: "smtp bad port", n: models.Notifier{Type: models.NotifierSMTP, Settings: map[string]string{"host": "m", "port": "70000", "from": "wg@example.com", "to": "a@example.com"}}, wantErr: true},
+		{name: "smtp bad from", n: models.Notifier{Type: models.NotifierSMTP, Settings: map[string]string{"host": "m", "from": "nobody", "to": "a@example.com"}}, wantErr: true},
+		{name: "smtp without to", n: models.Notifier{Type: models.NotifierSMTP, Settings: map[string]string{"host": "m", "from": "wg@example.com", "to": " , "}}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := newNotifySender(&tt.n)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil && !errors.Is(err, ErrBadRequest) {
+				t.Fatalf("err = %v, want ErrBadRequest", err)
+			}
+		})
+	}
+}
+
+// hookRecorder 是记录收到的 webhook 请求的测试服务端；status 非 0 时以该状态码应答
+type hookRecorder struct {
+	mu       sync.Mutex
+	status   int
+	requests []hookRequest
+}
+
+type hookRequest struct {
+	header http.Header
+	body   []byte
+	msg    AlertMessage
+}
+
+func newHookServer(t *testing.T) (*hookRecorder, *httptest.Server) {
+	t.Helper()
+	rec := &hookRecorder{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		var msg AlertMessage
+		_ = json.Unmarshal(body, &msg)
+		rec.mu.Lock()
+		defer rec.mu.Unlock()
+		rec.requests = append(rec.requests, hookRequest{header: r.Header.Clone(), body: body, msg: msg})
+		if rec.status != 0 {
+			http.Error(w, "unavailable", rec.status)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return rec, srv
+}
+
+func (h *hookRecorder) setStatus(code int) {
+	h.mu.Lock()
+	h.status = code
+	h.mu.Unlock()
+}
+
+func (h *hookRecorder) events() []string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	var out []string
+	for _, r := range h.requests {
+		out = append(out, r.msg.Event)
+	}
+	return out
+}
+
+func TestWebhookSender(t *testing.T) {
+	rec, srv := newHookServer(t)
+	msg := AlertMessage{Event: NotifyFiring, Subject: "disk low", Text: "10% free",
+		Alert: &models.Alert{ID: 3, RuleName: "disk", Key: "path:/"}}
+
+	tests := []struct {
+		name    string
+		secret  string
+		status  int
+		wantErr string
+	}{
+		{name: "signed", secret: "s3cret"},
+		{name: "unsigned"},
+		{name: "server error", status: http.StatusBadGateway, wantErr: "HTTP 502"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec.setStatus(tt.status)
+			s, err := newWebhookSender(&models.Notifier{Type: models.NotifierWebhook, Secret: tt.secret,
+				Settings: map[string]string{"url": srv.URL + "/hook"}})
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = s.Send(context.Background(), msg)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("err = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			rec.mu.Lock()
+			got := rec.requests[len(rec.requests)-1]
+			rec.mu.Unlock()
+			if ct := got.header.Get("Content-Type"); ct != "application/json" {
+				t.Errorf("Content-Type = %q", ct)
+			}
+			if ev := got.header.Get("X-Alert-Event"); ev != NotifyFiring {
+				t.Errorf("X-Alert-Event = %q", ev)
+			}
+			if got.msg.Subject != msg.Subject || got.msg.Alert == nil || got.msg.Alert.Key != "path:/" {
+				t.Errorf("payload = %+v", got.msg)
+			}
+			sig := got.header.Get("X-Signature-256")
+			if tt.secret == "" {
+				if sig != "" {
+					t.Errorf("unexpected signature %q", sig)
+				}
+				return
+			}
+			mac := hmac.New(sha256.New, []byte(tt.secret))
+			mac.Write(got.body)
+			if want := "sha256=" + hex.EncodeToString(mac.Sum(nil)); sig != want {
+				t.Errorf("X-Signature-256 = %q, want %q", sig, want)
+			}
+		})
+	}
+}
+
+func TestTelegramSender(t *testing.T) {
+	tests := []struct {
+		name    string
+		reply   string
+		status  int
+		wantErr string
+	}{
+		{name: "ok", reply: `{"ok":true,"result":{}}`},
+		{name: "rejected", reply: `{"ok":false,"description":"chat not found"}`, wantErr: "chat not found"},
+		{name: "not json", reply: `<html>`, wantErr: "invalid response"},
+		{name: "unauthorized", reply: `{"ok":false}`, status: http.StatusUnauthorized, wantErr: "HTTP 401"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var path string
+			var body map[string]any
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				path = r.URL.Path
+				_ = json.NewDecoder(r.Body).Decode(&body)
+				if tt.status != 0 {
+					w.WriteHeader(tt.status)
+				}
+				io.WriteString(w, tt.reply)
+			}))
+			defer srv.Close()
+
+			s, err := newTelegramSender(&models.Notifier{Type: models.NotifierTelegram, Secret: "123:abc",
+				Settings: map[string]string{"api_url": srv.URL + "/", "chat_id": "-1001"}})
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = s.Send(context.Background(), AlertMessage{Event: NotifyTest, Subject: "hello", Text: "world"})
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("err = %v, want %q", err, tt.wantErr)
+				}
+				if strings.Contains(err.Error(), "123:abc") {
+					t.Fatalf("error leaks the bot token: %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if path != "/bot123:abc/sendMessage" {
+				t.Errorf("path = %q", path)
+			}
+			if body["chat_id"] != "-1001" || body["text"] != "hello\n\nworld" {
+				t.Errorf("body = %v", body)
+			}
+		})
+	}
+}
+
+// smtpCapture 是一次 SMTP 会话中收到的信封与正文
+type smtpCapture struct {
+	from string
+	to   []string
+	data string
+}
+
+// startSMTPServer 在本机起一个只接受一次会话的最小 SMTP 服务端；extensions 为 EHLO 通告的扩展
+func startSMTPServer(t *testing.T, extensions ...string) (string, <-chan smtpCapture) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	done := make(chan smtpCapture, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		tp := textproto.NewConn(conn)
+		var c smtpCapture
+		tp.PrintfLine("220 localhost test SMTP")
+		for {
+			line, err := tp.ReadLine()
+			if err != nil {
+				return
+			}
+			cmd, arg, _ := strings.Cut(line, " ")
+			switch strings.ToUpper(cmd) {
+			case "EHLO", "HELO":
+				lines := append([]string{"localhost"}, extensions...)
+				for i, l := range lines {
+					sep := "-"
+					if i == len(lines)-1 {
+						sep = " "
+					}
+					tp.PrintfLine("250%s%s", sep, l)
+				}
+			case "MAIL":
+				c.from = strings.Trim(strings.TrimPrefix(strings.Fields(arg)[0], "FROM:"), "<>")
+				tp.PrintfLine("250 OK")
+			case "RCPT":
+				c.to = append(c.to, strings.Trim(strings.TrimPrefix(arg, "TO:"), "<>"))
+				tp.PrintfLine("250 OK")
+			case "DATA":
+				tp.PrintfLine("354 go ahead")
+				b, err := io.ReadAll(tp.DotReader())
+				if err != nil {
+					return
+				}
+				c.data = string(b)
+				tp.PrintfLine("250 queued")
+			case "QUIT":
+				tp.PrintfLine("221 bye")
+				done <- c
+				return
+			default:
+				tp.PrintfLine("502 not implemented")
+			}
+		}
+	}()
+	return ln.Addr().String(), done
+}
+
+func TestSMTPSender(t *testing.T) {
+	tests := []struct {
+		name       string
+		tls        string
+		extensions []string
+		wantErr    string
+	}{
+		{name: "plain relay", tls: smtpTLSNone, extensions: []string{"8BITMIME"}},
+		{name: "starttls not offered", tls: smtpTLSStartTLS, wantErr: "does not support STARTTLS"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			addr, done := startSMTPServer(t, tt.extensions...)
+			host, port, _ := net.SplitHostPort(addr)
+			s, err := newSMTPSender(&models.Notifier{Type: models.NotifierSMTP, Settings: map[string]string{
+				"host": host, "port": port, "tls": tt.tls,
+				"from": "WireGuard <wg@example.com>", "to": "ops@example.com, oncall@example.com",
+			}})
+			if err != nil {
+				t.Fatal(err)
+			}
+			msg := AlertMessage{Event: NotifyFiring, Subject: "peer 节点 offline", Text: "line one\n.dot line\r\nlast"}
+			err = s.Send(context.Background(), msg)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("err = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			c := <-done
+			if c.from != "wg@example.com" || strings.Join(c.to, ",") != "ops@example.com,oncall@example.com" {
+				t.Errorf("envelope = %q -> %q", c.from, c.to)
+			}
+			r, err := textproto.NewReader(bufio.NewReader(strings.NewReader(c.data))).ReadMIMEHeader()
+			if err != nil {
+				t.Fatalf("parse headers: %v\n%s", err, c.data)
+			}
+			if got := r.Get("Subject"); got != "=?utf-8?q?peer_=E8=8A=82=E7=82=B9_offline?=" {
+				t.Errorf("Subject = %q", got)
+			}
+			if got := r.Get("To"); got != "ops@example.com, oncall@example.com" {
+				t.Errorf("To = %q", got)
+			}
+			_, body, _ := strings.Cut(c.data, "\n\n")
+			if body != "line one\n.dot line\nlast\n" {
+				t.Errorf("body = %q", body)
+			}
+		})
+	}
+}
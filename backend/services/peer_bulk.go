@@ -0,0 +1,472 @@
+package services
+
+import (
+	"backend/models"
+	"backend/repository"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+
+	qrcode "github.com/skip2/go-qrcode"
+)
+
+const (
+	BulkAtomic  = "atomic"
+	BulkPartial = "partial"
+
+	// 单次批量上限，避免一次请求生成过大的 zip
+	maxBulkPeers = 1000
+)
+
+type BulkPeerResult struct {
+	Row    int    `json:"row"` // 1 起
+	Name   string `json:"name"`
+	PeerID int    `json:"peer_id,omitempty"`
+	IP     string `json:"ip,omitempty"`
+	Error  string `json:"error,omitempty"`
+	// 仅提供了公钥的 peer 无法生成客户端配置
+	NoConfig bool `json:"no_config,omitempty"`
+}
+
+type BulkPeerReport struct {
+	InterfaceID int              `json:"interface_id"`
+	Mode        string           `json:"mode"`
+	Created     int              `json:"created"`
+	Failed      int              `json:"failed"`
+	Applied     bool             `json:"applied"`
+	ApplyError  string           `json:"apply_error,omitempty"`
+	Results     []BulkPeerResult `json:"results"`
+}
+
+// ParseBulkPeersCSV 解析 CSV：首行为表头，必须含 name 列；
+// 可选列 allowed_ips / endpoint / persistent_keepalive / public_key /
+// client_allowed_ips / routing_profile_id / excluded_ips / ip / pool / groups（大小写不敏感，顺序任意）；
+// groups 中多个分组以 ";" 或 "," 分隔
+func ParseBulkPeersCSV(r io.Reader) ([]models.BulkPeerEntry, error) {
+	cr := csv.NewReader(r)
+	cr.TrimLeadingSpace = true
+	cr.FieldsPerRecord = -1
+	cr.Comment = '#'
+
+	header, err := cr.Read()
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil, fmt.Errorf("%w: empty csv", ErrBadRequest)
+		}
+		return nil, fmt.Errorf("%w: csv: %v", ErrBadRequest, err)
+	}
+	col := map[string]int{}
+	for i, h := range header {
+		h = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(h, "\ufeff")))
+		switch h {
+		case "name", "allowed_ips", "endpoint", "persistent_keepalive", "public_key",
+			"client_allowed_ips", "routing_profile_id", "excluded_ips", "ip", "pool", "groups":
+			col[h] = i
+		default:
+			return nil, fmt.Errorf("%w: csv: unknown column %q", ErrBadRequest, h)
+		}
+	}
+	if _, ok := col["name"]; !ok {
+		return nil, fmt.Errorf("%w: csv: missing \"name\" column", ErrBadRequest)
+	}
+
+	field := func(rec []string, key string) *string {
+		i, ok := col[key]
+		if !ok || i >= len(rec) {
+			return nil
+		}
+		v := strings.TrimSpace(rec[i])
+		if v == "" {
+			return nil
+		}
+		return &v
+	}
+
+	var out []models.BulkPeerEntry
+	for {
+		rec, err := cr.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w: csv: %v", ErrBadRequest, err)
+		}
+		e := models.BulkPeerEntry{
+			AllowedIPs:       field(rec, "allowed_ips"),
+			Endpoint:         field(rec, "endpoint"),
+			PublicKey:        field(rec, "public_key"),
+			ClientAllowedIPs: field(rec, "client_allowed_ips"),
+			ExcludedIPs:      field(rec, "excluded_ips"),
+			IP:               field(rec, "ip"),
+			Pool:             field(rec, "pool"),
+		}
+		if v := field(rec, "name"); v != nil {
+			e.Name = *v
+		}
+		if v := field(rec, "groups"); v != nil {
+			for _, g := range strings.FieldsFunc(*v, func(r rune) bool { return r == ';' || r == ',' }) {
+				if g = strings.TrimSpace(g); g != "" {
+					e.Groups = append(e.Groups, g)
+				}
+			}
+		}
+		if v := field(rec, "persistent_keepalive"); v != nil {
+			n, err := strconv.Atoi(*v)
+			if err != nil {
+				line, _ := cr.FieldPos(col["persistent_keepalive"])
+				return nil, fmt.Errorf("%w: csv line %d: bad persistent_keepalive %q", ErrBadRequest, line, *v)
+			}
+			e.PersistentKeepalive = &n
+		}
+		if v := field(rec, "routing_profile_id"); v != nil {
+			n, err := strconv.Atoi(*v)
+			if err != nil {
+				line, _ := cr.FieldPos(col["routing_profile_id"])
+				return nil, fmt.Errorf("%w: csv line %d: bad routing_profile_id %q", ErrBadRequest, line, *v)
+			}
+			e.RoutingProfileID = &n
+		}
+		out = append(out, e)
+	}
+	return out, nil
+}
+
+// ParseBulkPeersJSON 接受 BulkCreatePeersRequest 或单纯的行数组
+func ParseBulkPeersJSON(data []byte, req *models.BulkCreatePeersRequest) error {
+	trimmed := strings.TrimSpace(string(data))
+	if strings.HasPrefix(trimmed, "[") {
+		return json.Unmarshal(data, &req.Peers)
+	}
+	interfaceID, mode := req.InterfaceID, req.Mode
+	if err := json.Unmarshal(data, req); err != nil {
+		return err
+	}
+	// 表单字段优先于文件内容
+	if interfaceID != 0 {
+		req.InterfaceID = interfaceID
+	}
+	if mode != "" {
+		req.Mode = mode
+	}
+	return nil
+}
+
+type bulkRow struct {
+	res           *BulkPeerResult
+	entry         models.BulkPeerEntry
+	pub, priv     string
+	clientAllowed string
+	excluded      string
+}
+
+// BulkCreatePeers 在同一事务内为多行分配 IP 并创建 peer，最后只下发一次接口配置。
+// atomic 模式下任一行失败则整体回滚（返回错误与逐行结果）；partial 模式下跳过失败行
+func (s *WireGuardService) BulkCreatePeers(ctx context.Context, req *models.BulkCreatePeersRequest) (*BulkPeerReport, error) {
+	mode := strings.ToLower(strings.TrimSpace(req.Mode))
+	if mode == "" {
+		mode = BulkAtomic
+	}
+	if mode != BulkAtomic && mode != BulkPartial {
+		return nil, fmt.Errorf("%w: mode must be %q or %q", ErrBadRequest, BulkAtomic, BulkPartial)
+	}
+
+	entries := make([]models.BulkPeerEntry, 0, len(req.Names)+len(req.Peers))
+	for _, n := range req.Names {
+		entries = append(entries, models.BulkPeerEntry{Name: n})
+	}
+	entries = append(entries, req.Peers...)
+	if len(entries) == 0 {
+		return nil, fmt.Errorf("%w: no peers given", ErrBadRequest)
+	}
+	if len(entries) > maxBulkPeers {
+		return nil, fmt.Errorf("%w: at most %d peers per request", ErrBadRequest, maxBulkPeers)
+	}
+
+	rep := &BulkPeerReport{InterfaceID: int(req.InterfaceID), Mode: mode, Results: make([]BulkPeerResult, len(entries))}
+
+	// 1) 逐行校验 + 生成密钥（事务外完成，缩短持锁时间）
+	rows := make([]*bulkRow, 0, len(entries))
+	seen := map[string]int{}
+	seenKeys := map[string]int{} // 行内提供的公钥 -> 行号
+	for i, e := range entries {
+		e.Name = strings.TrimSpace(e.Name)
+		if e.AllowedIPs == nil {
+			e.AllowedIPs = req.AllowedIPs
+		}
+		if e.Endpoint == nil {
+			e.Endpoint = req.Endpoint
+		}
+		if e.PersistentKeepalive == nil {
+			e.PersistentKeepalive = req.PersistentKeepalive
+		}
+		if e.ClientAllowedIPs == nil {
+			e.ClientAllowedIPs = req.ClientAllowedIPs
+		}
+		if e.RoutingProfileID == nil {
+			e.RoutingProfileID = req.RoutingProfileID
+		}
+		if e.ExcludedIPs == nil {
+			e.ExcludedIPs = req.ExcludedIPs
+		}
+		if e.Pool == nil {
+			e.Pool = req.Pool
+		}
+		if e.Groups == nil {
+			e.Groups = req.Groups
+		}
+		res := &rep.Results[i]
+		res.Row, res.Name = i+1, e.Name
+
+		row := &bulkRow{res: res, entry: e}
+		if err := s.prepareBulkRow(row, seen, seenKeys); err != nil {
+			res.Error = err.Error()
+			continue
+		}
+		seen[e.Name] = i + 1
+		if res.NoConfig {
+			seenKeys[row.pub] = i + 1
+		}
+		rows = append(rows, row)
+	}
+	if mode == BulkAtomic && len(rows) != len(entries) {
+		rep.tally()
+		return rep, fmt.Errorf("%w: %d of %d rows are invalid, nothing was created", ErrBadRequest, rep.Failed, len(entries))
+	}
+
+	// 2) 同一事务内分配 IP 并插入
+	errAtomic := errors.New("bulk row failed")
+	err := s.store.WithTx(ctx, func(tx repository.Store) error {
+		iface, err := tx.Interfaces().Get(ctx, int(req.InterfaceID))
+		if err != nil {
+			return mapRepoErr(err, "interface")
+		}
+		if err := checkPeerHost(iface); err != nil {
+			return err
+		}
+		if err := ensureInterfaceCIDR(ctx, tx, iface); err != nil {
+			return err
+		}
+		fams, err := interfaceFamilies(iface)
+		if err != nil {
+			return err
+		}
+		ips, err := tx.Peers().UsedIPs(ctx, iface.ID)
+		if err != nil {
+			return err
+		}
+		view, err := s.loadIPAMView(ctx, tx, iface.ID, fams, ips)
+		if err != nil {
+			return err
+		}
+
+		for _, row := range rows {
+			if err := createBulkPeer(ctx, tx, iface, view, row); err != nil {
+				row.res.Error = err.Error()
+				if mode == BulkAtomic {
+					return errAtomic
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		if errors.Is(err, errAtomic) {
+			for _, row := range rows {
+				row.res.PeerID, row.res.IP = 0, ""
+			}
+			rep.tally()
+			return rep, fmt.Errorf("%w: %d of %d rows failed, nothing was created", ErrConflict, rep.Failed, len(entries))
+		}
+		return nil, err
+	}
+	rep.tally()
+
+	// 3) 只下发一次；接口未运行时仅落盘
+	if rep.Created > 0 {
+		if it, err := s.GetInterface(int(req.InterfaceID)); err == nil && it.Status == "running" {
+			if err := s.ApplyInterfaceConfig(it.ID); err != nil {
+				rep.ApplyError = err.Error()
+			} else {
+				rep.Applied = true
+			}
+		}
+		s.syncConfFile(int(req.InterfaceID))
+	}
+	return rep, nil
+}
+
+func (s *WireGuardService) prepareBulkRow(row *bulkRow, seen, seenKeys map[string]int) error {
+	e := row.entry
+	if e.Name == "" {
+		return errors.New("name is required")
+	}
+	if prev, dup := seen[e.Name]; dup {
+		return fmt.Errorf("duplicate name (also on row %d)", prev)
+	}
+	for _, g := range e.Groups {
+		if _, err := normalizeGroupName(g); err != nil {
+			return err
+		}
+	}
+	if e.PersistentKeepalive != nil && (*e.PersistentKeepalive < 0 || *e.PersistentKeepalive > 65535) {
+		return errors.New("persistent_keepalive out of range")
+	}
+	if e.AllowedIPs != nil && strings.TrimSpace(*e.AllowedIPs) != "" {
+		if err := validateServerAllowedIPs(*e.AllowedIPs); err != nil {
+			return err
+		}
+	}
+	if e.ClientAllowedIPs != nil {
+		v, err := normalizeClientAllowedIPs(*e.ClientAllowedIPs)
+		if err != nil {
+			return err
+		}
+		row.clientAllowed = v
+	}
+	if e.ExcludedIPs != nil {
+		v, err := normalizeExcludedIPs(*e.ExcludedIPs)
+		if err != nil {
+			return err
+		}
+		row.excluded = v
+	}
+	if e.PublicKey != nil && strings.TrimSpace(*e.PublicKey) != "" {
+		row.pub = strings.TrimSpace(*e.PublicKey)
+		if _, err := parseWGPublicKey(row.pub); err != nil {
+			return err
+		}
+		// 同一批次内重复的公钥在内核中是同一个 peer
+		if prev, dup := seenKeys[row.pub]; dup {
+			return fmt.Errorf("duplicate public_key (also on row %d)", prev)
+		}
+		row.res.NoConfig = true
+		return nil
+	}
+	priv, pub, err := s.GenerateKeyPair()
+	if err != nil {
+		return fmt.Errorf("generate private key failed: %v", err)
+	}
+	row.pub, row.priv = pub, priv
+	return nil
+}
+
+// createBulkPeer 分配 IP 并插入一行；失败时不占用 view 中的地址
+func createBulkPeer(ctx context.Context, tx repository.Store, iface *models.WireGuardInterface,
+	view *ipamView, row *bulkRow) error {
+	e := row.entry
+	profileID, err := checkRoutingProfileID(ctx, tx, e.RoutingProfileID)
+	if err != nil {
+		return err
+	}
+	// 生成的密钥对不会重复，只需检查行内提供的公钥
+	if row.res.NoConfig {
+		if err := checkPeerPublicKey(ctx, tx, iface.ID, 0, row.pub); err != nil {
+			return err
+		}
+	}
+	groupIDs, err := resolvePeerGroups(ctx, tx, e.Groups)
+	if err != nil {
+		return err
+	}
+	static := strings.TrimSpace(strFromPtr(e.IP))
+	if err := view.checkStatic(static); err != nil {
+		return err
+	}
+	ipStr, err := view.assign(strings.TrimSpace(strFromPtr(e.Pool)), static)
+	if err != nil {
+		return err
+	}
+
+	keepalive := 25
+	if e.PersistentKeepalive != nil && *e.PersistentKeepalive > 0 {
+		keepalive = *e.PersistentKeepalive
+	}
+	allowed := hostCIDR(ipStr)
+	if e.AllowedIPs != nil && strings.TrimSpace(*e.AllowedIPs) != "" {
+		allowed = strings.TrimSpace(*e.AllowedIPs)
+	}
+
+	p := &models.WireGuardPeer{
+		InterfaceID:         iface.ID,
+		Name:                e.Name,
+		IP:                  ipStr,
+		AllowedIPs:          allowed,
+		Endpoint:            strings.TrimSpace(strFromPtr(e.Endpoint)),
+		PersistentKeepalive: keepalive,
+		ClientAllowedIPs:    row.clientAllowed,
+		RoutingProfileID:    profileID,
+		ExcludedIPs:         row.excluded,
+		PublicKey:           row.pub,
+		PrivateKey:          row.priv,
+	}
+	if err := tx.Peers().Create(ctx, p); err != nil {
+		releaseUsed(view.used, ipStr)
+		return mapRepoErr(err, "peer")
+	}
+	if len(groupIDs) > 0 {
+		if err := tx.PeerGroups().SetPeerGroups(ctx, p.ID, groupIDs); err != nil {
+			return err
+		}
+	}
+	row.res.PeerID, row.res.IP = p.ID, ipStr
+	return nil
+}
+
+func (r *BulkPeerReport) tally() {
+	r.Created, r.Failed = 0, 0
+	for _, res := range r.Results {
+		if res.Error != "" {
+			r.Failed++
+		} else if res.PeerID != 0 {
+			r.Created++
+		}
+	}
+}
+
+/* -------------------- 打包 -------------------- */
+
+var unsafeFileChars = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// BulkArchive 把已创建 peer 的 .conf 与二维码 PNG 打包；results.json 附带逐行结果
+func (s *WireGuardService) BulkArchive(rep *BulkPeerReport) ([]byte, error) {
+	files := map[string][]byte{}
+	for i := range rep.Results {
+		res := &rep.Results[i]
+		if res.PeerID == 0 || res.NoConfig {
+			continue
+		}
+		conf, err := s.GetPeerConfig(res.PeerID, false)
+		if err != nil {
+			res.Error = fmt.Sprintf("peer created, export config: %v", err)
+			continue
+		}
+		png, err := qrcode.Encode(conf, qrcode.Medium, 512)
+		if err != nil {
+			return nil, fmt.Errorf("qr code for %s: %w", res.Name, err)
+		}
+
+		base := strings.Trim(unsafeFileChars.ReplaceAllString(res.Name, "_"), "._")
+		if base == "" {
+			base = "peer"
+		}
+		// 清洗后可能重名，追加 peer ID 区分
+		if _, dup := files[base+".conf"]; dup {
+			base = fmt.Sprintf("%s-%d", base, res.PeerID)
+		}
+		files[base+".conf"] = []byte(conf)
+		files[base+".png"] = png
+	}
+
+	manifest, err := json.MarshalIndent(rep, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	files["results.json"] = manifest
+	return zipFiles(files)
+}
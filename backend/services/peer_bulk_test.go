@@ -0,0 +1,96 @@
+package services
+
+import (
+	"backend/models"
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+)
+
+func TestParseBulkPeersCSVGroups(t *testing.T) {
+	entries, err := ParseBulkPeersCSV(strings.NewReader("name,groups\nalice,\"ops, dev\"\nbob,ops;lab\ncarol,\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := [][]string{entries[0].Groups, entries[1].Groups, entries[2].Groups}
+	want := [][]string{{"ops", "dev"}, {"ops", "lab"}, nil}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("groups = %q, want %q", got, want)
+	}
+}
+
+// TestBulkCreatePeerKeysAndGroups 检查批量创建对公钥冲突（库内与批次内）和分组的处理
+func TestBulkCreatePeerKeysAndGroups(t *testing.T) {
+	ctx := context.Background()
+	wg := newTestService(t)
+	it := &models.WireGuardInterface{Name: "wgbulk0", Address: "10.40.0.1/24", ListenPort: 51850, Mode: "server"}
+	if err := wg.store.Interfaces().Create(ctx, it); err != nil {
+		t.Fatal(err)
+	}
+	key := func() string {
+		k, err := wgtypes.GeneratePrivateKey()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return k.PublicKey().String()
+	}
+	existing, shared := key(), key()
+	if err := wg.store.Peers().Create(ctx, &models.WireGuardPeer{InterfaceID: it.ID, Name: "old", IP: "10.40.0.2", PublicKey: existing}); err != nil {
+		t.Fatal(err)
+	}
+
+	req := &models.BulkCreatePeersRequest{
+		InterfaceID: uint(it.ID),
+		Mode:        BulkPartial,
+		Groups:      []string{"laptops"},
+		Peers: []models.BulkPeerEntry{
+			{Name: "a"},
+			{Name: "b", PublicKey: &shared, Groups: []string{"ops", "lab"}},
+			{Name: "c", PublicKey: &shared},
+			{Name: "d", PublicKey: &existing},
+			{Name: "e", Groups: []string{"bad name!"}},
+		},
+	}
+	rep, err := wg.BulkCreatePeers(ctx, req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantErr := []string{"", "", "duplicate public_key (also on row 2)", `public key already used by peer "old"`, "group"}
+	for i, res := range rep.Results {
+		if (wantErr[i] == "") != (res.Error == "") || !strings.Contains(res.Error, wantErr[i]) {
+			t.Errorf("row %d error = %q, want %q", i+1, res.Error, wantErr[i])
+		}
+	}
+	if rep.Created != 2 || rep.Failed != 3 {
+		t.Fatalf("created %d, failed %d", rep.Created, rep.Failed)
+	}
+
+	wantGroups := map[string][]string{"a": {"laptops"}, "b": {"lab", "ops"}}
+	for _, res := range rep.Results[:2] {
+		p, err := wg.GetPeer(res.PeerID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(p.Groups, wantGroups[p.Name]) {
+			t.Errorf("peer %s groups = %v, want %v", p.Name, p.Groups, wantGroups[p.Name])
+		}
+	}
+
+	// atomic 模式下与库内公钥冲突的一行使整批回滚
+	req = &models.BulkCreatePeersRequest{InterfaceID: uint(it.ID), Peers: []models.BulkPeerEntry{
+		{Name: "f"}, {Name: "g", PublicKey: &shared},
+	}}
+	if _, err := wg.BulkCreatePeers(ctx, req); err == nil {
+		t.Fatal("atomic batch with a taken public key succeeded")
+	}
+	peers, err := wg.store.Peers().ListByInterface(ctx, it.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(peers) != 3 {
+		t.Errorf("got %d peers after rolled back batch, want 3", len(peers))
+	}
+}
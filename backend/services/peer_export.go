@@ -0,0 +1,141 @@
+package services
+
+import (
+	"archive/zip"
+	"backend/wgconf"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// 客户端配置导出格式
+const (
+	FormatWGQuick        = "wg-quick"
+	FormatNetworkManager = "nm"
+	FormatSystemd        = "systemd"
+	FormatOpenWrt        = "openwrt"
+	FormatJSON           = "json"
+)
+
+var exportFormatAliases = map[string]string{
+	"":               FormatWGQuick,
+	"wg-quick":       FormatWGQuick,
+	"wg":             FormatWGQuick,
+	"conf":           FormatWGQuick,
+	"nm":             FormatNetworkManager,
+	"networkmanager": FormatNetworkManager,
+	"nmconnection":   FormatNetworkManager,
+	"systemd":        FormatSystemd,
+	"networkd":       FormatSystemd,
+	"openwrt":        FormatOpenWrt,
+	"uci":            FormatOpenWrt,
+	"json":           FormatJSON,
+}
+
+// PeerConfigExport 是一次导出的结果，handler 直接作为附件返回
+type PeerConfigExport struct {
+	Filename    string
+	ContentType string
+	Data        []byte
+}
+
+// peerConfigJSON 是 format=json 的输出结构
+type peerConfigJSON struct {
+	InterfaceName string `json:"interface_name"`
+	*wgconf.File
+}
+
+// ExportPeerConfig 按 format 导出客户端配置；所有格式都由同一个配置模型生成
+func (s *WireGuardService) ExportPeerConfig(peerID int, regenerate bool, format string) (*PeerConfigExport, error) {
+	fmtName, ok := exportFormatAliases[strings.ToLower(strings.TrimSpace(format))]
+	if !ok {
+		return nil, fmt.Errorf("%w: unknown format %q (wg-quick, nm, systemd, openwrt, json)", ErrBadRequest, format)
+	}
+
+	f, iface, err := s.peerConfFile(peerID, regenerate)
+	if err != nil {
+		return nil, err
+	}
+	// 客户端上的接口名沿用服务端接口名
+	ifname := iface.Name
+	base := "wg-peer"
+
+	switch fmtName {
+	case FormatNetworkManager:
+		return &PeerConfigExport{
+			Filename:    base + ".nmconnection",
+			ContentType: "text/plain; charset=utf-8",
+			Data:        []byte(wgconf.RenderNetworkManager(f, ifname)),
+		}, nil
+
+	case FormatSystemd:
+		netdev, network := wgconf.RenderSystemd(f, ifname)
+		data, err := zipFiles(map[string][]byte{
+			ifname + ".netdev":  []byte(netdev),
+			ifname + ".network": []byte(network),
+		})
+		if err != nil {
+			return nil, err
+		}
+		return &PeerConfigExport{
+			Filename:    base + "-systemd.zip",
+			ContentType: "application/zip",
+			Data:        data,
+		}, nil
+
+	case FormatOpenWrt:
+		return &PeerConfigExport{
+			Filename:    base + ".uci",
+			ContentType: "text/plain; charset=utf-8",
+			Data:        []byte(wgconf.RenderOpenWrt(f, ifname)),
+		}, nil
+
+	case FormatJSON:
+		data, err := json.MarshalIndent(peerConfigJSON{InterfaceName: ifname, File: f}, "", "  ")
+		if err != nil {
+			return nil, err
+		}
+		return &PeerConfigExport{
+			Filename:    base + ".json",
+			ContentType: "application/json",
+			Data:        data,
+		}, nil
+	}
+
+	return &PeerConfigExport{
+		Filename:    base + ".conf",
+		ContentType: "text/plain; charset=utf-8",
+		Data:        []byte(wgconf.Render(f)),
+	}, nil
+}
+
+// zipFiles 按文件名顺序打包；条目权限 0600（内容含私钥）
+func zipFiles(files map[string][]byte) ([]byte, error) {
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	now := time.Now()
+	for _, name := range names {
+		hdr := &zip.FileHeader{Name: name, Method: zip.Deflate, Modified: now}
+		hdr.SetMode(0o600)
+		w, err := zw.CreateHeader(hdr)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := w.Write(files[name]); err != nil {
+			return nil, err
+		}
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
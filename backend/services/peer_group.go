@@ -0,0 +1,348 @@
+package services
+
+import (
+	"backend/models"
+	"backend/repository"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// 分组名同时用作 ?tag= 过滤参数，限制为简单标识符
+var groupNameRe = regexp.MustCompile(`^[A-Za-z0-9_.-]{1,64}$`)
+
+func normalizeGroupName(name string) (string, error) {
+	name = strings.TrimSpace(name)
+	if !groupNameRe.MatchString(name) {
+		return "", fmt.Errorf("%w: invalid group name %q (letters, digits, '_', '.', '-', up to 64)", ErrBadRequest, name)
+	}
+	return name, nil
+}
+
+/* -------------------- 分组（CRUD） -------------------- */
+
+func (s *WireGuardService) ListPeerGroups(ctx context.Context) ([]models.PeerGroup, error) {
+	list, err := s.store.PeerGroups().List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if list == nil {
+		list = []models.PeerGroup{}
+	}
+	return list, nil
+}
+
+func (s *WireGuardService) GetPeerGroup(ctx context.Context, id int) (*models.PeerGroup, error) {
+	g, err := s.store.PeerGroups().Get(ctx, id)
+	if err != nil {
+		return nil, mapRepoErr(err, "peer group")
+	}
+	return g, nil
+}
+
+func (s *WireGuardService) CreatePeerGroup(ctx context.Context, req *models.PeerGroupRequest) (*models.PeerGroup, error) {
+	name, err := normalizeGroupName(req.Name)
+	if err != nil {
+		return nil, err
+	}
+	g := &models.PeerGroup{Name: name, Description: strings.TrimSpace(req.Description)}
+	if err := s.store.PeerGroups().Create(ctx, g); err != nil {
+		return nil, mapRepoErr(err, "peer group")
+	}
+	return s.GetPeerGroup(ctx, g.ID)
+}
+
+func (s *WireGuardService) UpdatePeerGroup(ctx context.Context, id int, req *models.PeerGroupRequest) (*models.PeerGroup, error) {
+	name, err := normalizeGroupName(req.Name)
+	if err != nil {
+		return nil, err
+	}
+	g := &models.PeerGroup{ID: id, Name: name, Description: strings.TrimSpace(req.Description)}
+	if err := s.store.PeerGroups().Update(ctx, g); err != nil {
+		return nil, mapRepoErr(err, "peer group")
+	}
+	return s.GetPeerGroup(ctx, id)
+}
+
+// DeletePeerGroup 删除分组；仍被 ACL 规则引用时拒绝，避免规则悄悄变成对全部 peer 生效
+func (s *WireGuardService) DeletePeerGroup(ctx context.Context, id int) error {
+	return s.store.WithTx(ctx, func(tx repository.Store) error {
+		if _, err := tx.PeerGroups().Get(ctx, id); err != nil {
+			return mapRepoErr(err, "peer group")
+		}
+		rules, err := groupACLRules(ctx, tx, id)
+		if err != nil {
+			return err
+		}
+		if len(rules) > 0 {
+			return fmt.Errorf("%w: peer group is used by %d acl rule(s)", ErrConflict, len(rules))
+		}
+		return mapRepoErr(tx.PeerGroups().Delete(ctx, id), "peer group")
+	})
+}
+
+// groupACLRules 返回以该分组为源的 ACL 规则
+func groupACLRules(ctx context.Context, store repository.Store, groupID int) ([]models.ACLRule, error) {
+	ifaces, err := store.Interfaces().List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var out []models.ACLRule
+	for _, it := range ifaces {
+		rules, err := store.ACLs().List(ctx, it.ID)
+		if err != nil {
+			return nil, err
+		}
+		for _, r := range rules {
+			if r.GroupID != nil && *r.GroupID == groupID {
+				out = append(out, r)
+			}
+		}
+	}
+	return out, nil
+}
+
+/* -------------------- 成员 -------------------- */
+
+// GetPeerGroupMembers 返回分组内的 peer（含所属分组）
+func (s *WireGuardService) GetPeerGroupMembers(ctx context.Context, id int) ([]models.WireGuardPeer, error) {
+	if _, err := s.GetPeerGroup(ctx, id); err != nil {
+		return nil, err
+	}
+	ids, err := s.store.PeerGroups().Members(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	peers := []models.WireGuardPeer{}
+	for _, pid := range ids {
+		p, err := s.store.Peers().Get(ctx, pid)
+		if err != nil {
+			return nil, mapRepoErr(err, "peer")
+		}
+		peers = append(peers, *p)
+	}
+	if err := s.fillPeerGroups(ctx, peers); err != nil {
+		return nil, err
+	}
+	return peers, nil
+}
+
+// SetPeerGroupMembers 加入成员（replace 为 true 时整体替换）；peer 必须存在
+func (s *WireGuardService) SetPeerGroupMembers(ctx context.Context, id int, peerIDs []int, replace bool) ([]models.WireGuardPeer, error) {
+	err := s.store.WithTx(ctx, func(tx repository.Store) error {
+		if _, err := tx.PeerGroups().Get(ctx, id); err != nil {
+			return mapRepoErr(err, "peer group")
+		}
+		for _, pid := range peerIDs {
+			if _, err := tx.Peers().Get(ctx, pid); err != nil {
+				if errors.Is(err, repository.ErrNotFound) {
+					return fmt.Errorf("%w: peer %d does not exist", ErrBadRequest, pid)
+				}
+				return err
+			}
+		}
+		if replace {
+			return tx.PeerGroups().SetMembers(ctx, id, peerIDs)
+		}
+		return tx.PeerGroups().AddMembers(ctx, id, peerIDs)
+	})
+	if err != nil {
+		return nil, err
+	}
+	s.refreshGroupFirewall(ctx, id)
+	return s.GetPeerGroupMembers(ctx, id)
+}
+
+func (s *WireGuardService) RemovePeerGroupMember(ctx context.Context, id, peerID int) error {
+	if _, err := s.GetPeerGroup(ctx, id); err != nil {
+		return err
+	}
+	if err := s.store.PeerGroups().RemoveMember(ctx, id, peerID); err != nil {
+		return mapRepoErr(err, "group member")
+	}
+	s.refreshGroupFirewall(ctx, id)
+	return nil
+}
+
+// refreshGroupFirewall 在成员变化后重建管理表（分组 ACL 的源集合按成员生成）；失败只记日志
+func (s *WireGuardService) refreshGroupFirewall(ctx context.Context, groupID int) {
+	rules, err := groupACLRules(ctx, s.store, groupID)
+	if err != nil || len(rules) == 0 {
+		return
+	}
+	if err := s.syncFirewall(ctx); err != nil {
+		log.Printf("[firewall] sync failed: %v", err)
+	}
+}
+
+/* -------------------- peer 上的分组（标签） -------------------- */
+
+// resolvePeerGroups 把分组名解析为 ID，不存在的分组自动创建
+func resolvePeerGroups(ctx context.Context, tx repository.Store, names []string) ([]int, error) {
+	var ids []int
+	for _, raw := range names {
+		name, err := normalizeGroupName(raw)
+		if err != nil {
+			return nil, err
+		}
+		g, err := tx.PeerGroups().GetByName(ctx, name)
+		if errors.Is(err, repository.ErrNotFound) {
+			g = &models.PeerGroup{Name: name}
+			err = tx.PeerGroups().Create(ctx, g)
+		}
+		if err != nil {
+			return nil, mapRepoErr(err, "peer group")
+		}
+		if !slices.Contains(ids, g.ID) {
+			ids = append(ids, g.ID)
+		}
+	}
+	return ids, nil
+}
+
+// fillPeerGroups 补齐 peers 的分组名
+func (s *WireGuardService) fillPeerGroups(ctx context.Context, peers []models.WireGuardPeer) error {
+	m, err := s.store.PeerGroups().Memberships(ctx)
+	if err != nil {
+		return err
+	}
+	for i := range peers {
+		peers[i].Groups = m[peers[i].ID]
+		if peers[i].Groups == nil {
+			peers[i].Groups = []string{}
+		}
+	}
+	return nil
+}
+
+// FilterPeersByGroup 只保留属于分组 name 的 peer（peers 需已补齐分组）
+func FilterPeersByGroup(peers []models.WireGuardPeer, name string) []models.WireGuardPeer {
+	out := []models.WireGuardPeer{}
+	for _, p := range peers {
+		if slices.Contains(p.Groups, name) {
+			out = append(out, p)
+		}
+	}
+	return out
+}
+
+/* -------------------- 批量操作 -------------------- */
+
+// GroupBulkReport 是分组批量操作的结果
+type GroupBulkReport struct {
+	GroupID    int      `json:"group_id"`
+	Action     string   `json:"action"`
+	Updated    []int    `json:"updated"`               // 实际变更的 peer
+	Applied    []string `json:"applied,omitempty"`     // 已重新下发的运行中接口
+	ApplyError []string `json:"apply_error,omitempty"` // 下发失败的接口及原因（DB 已更新）
+}
+
+// BulkPeerGroup 对分组内全部 peer 执行同一操作（同一事务），随后重写 .conf 并重新下发受影响的运行中接口
+func (s *WireGuardService) BulkPeerGroup(ctx context.Context, id int, req *models.PeerGroupBulkRequest) (*GroupBulkReport, error) {
+	action := strings.ToLower(strings.TrimSpace(req.Action))
+	rep := &GroupBulkReport{GroupID: id, Action: action, Updated: []int{}}
+
+	var apply func(p *models.WireGuardPeer) bool
+	kernel := true // 是否影响服务端配置
+	switch action {
+	case models.GroupActionDisable, models.GroupActionEnable:
+		disabled := action == models.GroupActionDisable
+		apply = func(p *models.WireGuardPeer) bool {
+			if p.Disabled == disabled {
+				return false
+			}
+			p.Disabled = disabled
+			return true
+		}
+	case models.GroupActionKeepalive:
+		if req.PersistentKeepalive == nil || *req.PersistentKeepalive < 0 || *req.PersistentKeepalive > 65535 {
+			return nil, fmt.Errorf("%w: persistent_keepalive (0-65535) is required", ErrBadRequest)
+		}
+		ka := *req.PersistentKeepalive
+		apply = func(p *models.WireGuardPeer) bool {
+			if p.PersistentKeepalive == ka {
+				return false
+			}
+			p.PersistentKeepalive = ka
+			return true
+		}
+	case models.GroupActionRoutingProfile:
+		if req.RoutingProfileID == nil {
+			return nil, fmt.Errorf("%w: routing_profile_id is required (0 clears it)", ErrBadRequest)
+		}
+		kernel = false // 只影响客户端配置
+	default:
+		return nil, fmt.Errorf("%w: action must be one of %s, %s, %s, %s", ErrBadRequest,
+			models.GroupActionDisable, models.GroupActionEnable, models.GroupActionKeepalive, models.GroupActionRoutingProfile)
+	}
+
+	touched := map[int]bool{}
+	err := s.store.WithTx(ctx, func(tx repository.Store) error {
+		if _, err := tx.PeerGroups().Get(ctx, id); err != nil {
+			return mapRepoErr(err, "peer group")
+		}
+		if action == models.GroupActionRoutingProfile {
+			profileID, err := checkRoutingProfileID(ctx, tx, req.RoutingProfileID)
+			if err != nil {
+				return err
+			}
+			apply = func(p *models.WireGuardPeer) bool {
+				if (p.RoutingProfileID == nil) == (profileID == nil) &&
+					(profileID == nil || *p.RoutingProfileID == *profileID) {
+					return false
+				}
+				p.RoutingProfileID = profileID
+				return true
+			}
+		}
+		ids, err := tx.PeerGroups().Members(ctx, id)
+		if err != nil {
+			return err
+		}
+		for _, pid := range ids {
+			p, err := tx.Peers().Get(ctx, pid)
+			if err != nil {
+				return mapRepoErr(err, "peer")
+			}
+			if !apply(p) {
+				continue
+			}
+			if err := tx.Peers().Update(ctx, p); err != nil {
+				return mapRepoErr(err, "peer")
+			}
+			rep.Updated = append(rep.Updated, p.ID)
+			touched[p.InterfaceID] = true
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if !kernel {
+		return rep, nil
+	}
+
+	ifaceIDs := make([]int, 0, len(touched))
+	for iid := range touched {
+		ifaceIDs = append(ifaceIDs, iid)
+	}
+	sort.Ints(ifaceIDs)
+	for _, iid := range ifaceIDs {
+		s.syncConfFile(iid)
+		it, err := s.store.Interfaces().Get(ctx, iid)
+		if err != nil || it.Status != "running" {
+			continue
+		}
+		if err := s.ApplyInterfaceConfig(iid); err != nil {
+			rep.ApplyError = append(rep.ApplyError, fmt.Sprintf("%s: %v", it.Name, err))
+			continue
+		}
+		rep.Applied = append(rep.Applied, it.Name)
+	}
+	return rep, nil
+}
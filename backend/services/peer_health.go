@@ -0,0 +1,393 @@
+package services
+
+import (
+	"backend/models"
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+)
+
+const (
+	defaultPeerOnlineThreshold  = 180 * time.Second
+	defaultPeerMonitorInterval  = 30 * time.Second
+	defaultPeerSessionRetention = 90 * 24 * time.Hour
+	defaultPeerHealthWindow     = 7 * 24 * time.Hour
+	maxPeerHealthWindow         = 366 * 24 * time.Hour
+
+	peerStatusConnected    = "connected"
+	peerStatusDisconnected = "disconnected"
+)
+
+// PeerHealthPolicy 是 peer 在线判定、stale 检测与在线时段保留的设置
+type PeerHealthPolicy struct {
+	OnlineThreshold  time.Duration // 最近握手在该时间内视为在线
+	StaleAfter       time.Duration // 超过该时间未连接视为 stale，0 关闭
+	AutoDisable      bool          // 自动停用运行中接口上 stale 的 peer
+	SessionRetention time.Duration // 已结束的在线时段保留多久，0 不清理
+}
+
+// SetPeerHealthPolicy 设置在线判定与 stale 策略；OnlineThreshold 为 0 时取默认 180s
+func (s *WireGuardService) SetPeerHealthPolicy(p PeerHealthPolicy) {
+	if p.OnlineThreshold <= 0 {
+		p.OnlineThreshold = defaultPeerOnlineThreshold
+	}
+	s.health = p
+}
+
+// peerOnline 判断握手时间是否仍在在线阈值内
+func (s *WireGuardService) peerOnline(hs time.Time, now time.Time) bool {
+	return !hs.IsZero() && now.Sub(hs) <= s.health.OnlineThreshold
+}
+
+// peerStale 判断 peer 是否超过设定时间未连接；从未握手的从创建时间起算
+func (s *WireGuardService) peerStale(p *models.WireGuardPeer, now time.Time) bool {
+	if s.health.StaleAfter <= 0 {
+		return false
+	}
+	ref := p.CreatedAt
+	if p.LastHandshake != nil {
+		ref = *p.LastHandshake
+	}
+	return now.Sub(ref) > s.health.StaleAfter
+}
+
+// fillPeerHealth 填充当前在线时段的开始时间与 stale 标记
+func (s *WireGuardService) fillPeerHealth(ctx context.Context, list []models.WireGuardPeer) error {
+	open, err := s.store.PeerSessions().ListOpen(ctx)
+	if err != nil {
+		return err
+	}
+	since := make(map[int]time.Time, len(open))
+	for _, ps := range open {
+		since[ps.PeerID] = ps.StartedAt
+	}
+	now := time.Now()
+	for i := range list {
+		p := &list[i]
+		if t, ok := since[p.ID]; ok {
+			p.OnlineSince = &t
+		}
+		p.Stale = s.peerStale(p, now)
+	}
+	return nil
+}
+
+/* -------------------- 在线监控 -------------------- */
+
+// RunPeerMonitor 定时采样内核中的握手时间：记录上下线时段与最近握手，处理 stale peer，清理过期时段
+func (s *WireGuardService) RunPeerMonitor(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		interval = defaultPeerMonitorInterval
+	}
+	s.samplePeerHealth(ctx, time.Now())
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-t.C:
+			s.samplePeerHealth(ctx, now)
+		}
+	}
+}
+
+func (s *WireGuardService) samplePeerHealth(ctx context.Context, now time.Time) {
+	peers, err := s.store.Peers().List(ctx)
+	if err != nil {
+		log.Printf("[peer-health] list peers: %v", err)
+		return
+	}
+	// 读不到内核状态时不改动时段，避免把所有 peer 误判为下线
+	if live, err := s.livePeers(); err != nil {
+		log.Printf("[peer-health] read devices: %v", err)
+	} else if err := s.trackPeerSessions(ctx, peers, live, now); err != nil {
+		log.Printf("[peer-health] track sessions: %v", err)
+	}
+	s.disableStalePeers(ctx, peers, now)
+	if s.health.SessionRetention > 0 {
+		if err := s.store.PeerSessions().Prune(ctx, now.Add(-s.health.SessionRetention)); err != nil {
+			log.Printf("[peer-health] %v", err)
+		}
+	}
+}
+
+// livePeers 以 "接口名|公钥" 为键返回内核中的 peer
+func (s *WireGuardService) livePeers() (map[string]wgtypes.Peer, error) {
+	c, err := s.wgClient()
+	if err != nil {
+		return nil, err
+	}
+	devs, err := c.Devices()
+	if err != nil {
+		return nil, err
+	}
+	live := map[string]wgtypes.Peer{}
+	for _, d := range devs {
+		for _, pr := range d.Peers {
+			live[d.Name+"|"+pr.PublicKey.String()] = pr
+		}
+	}
+	return live, nil
+}
+
+// trackPeerSessions 对比握手时间与未结束的时段：上线时开始新时段，下线时结束时段；
+// 同时把最近握手与状态写回 wireguard_peers（内核重启清零后仍保留 last seen）
+func (s *WireGuardService) trackPeerSessions(ctx context.Context, peers []models.WireGuardPeer, live map[string]wgtypes.Peer, now time.Time) error {
+	open, err := s.store.PeerSessions().ListOpen(ctx)
+	if err != nil {
+		return err
+	}
+	openBy := make(map[int]models.PeerSession, len(open))
+	for _, ps := range open {
+		openBy[ps.PeerID] = ps
+	}
+
+	for i := range peers {
+		p := &peers[i]
+		var hs time.Time
+		if kp, ok := live[p.InterfaceName+"|"+p.PublicKey]; ok {
+			hs = kp.LastHandshakeTime
+		}
+		online := !p.Disabled && s.peerOnline(hs, now)
+		status := peerStatusDisconnected
+		if online {
+			status = peerStatusConnected
+		}
+
+		last, newer := p.LastHandshake, false
+		if !hs.IsZero() && (last == nil || hs.After(*last)) {
+			t := hs
+			last, newer = &t, true
+		}
+		if newer || p.Status != status {
+			if err := s.store.Peers().SetHandshake(ctx, p.ID, status, last); err != nil {
+				return err
+			}
+		}
+		p.LastHandshake, p.Status = last, status // 后面的 stale 检查用最新的握手时间
+
+		cur, isOpen := openBy[p.ID]
+		switch {
+		case online && !isOpen:
+			ps := &models.PeerSession{PeerID: p.ID, InterfaceID: p.InterfaceID, StartedAt: hs}
+			if err := s.store.PeerSessions().Open(ctx, ps); err != nil {
+				return err
+			}
+		case !online && isOpen:
+			// 在线持续到最后一次握手后的阈值为止，而不是发现下线的采样时刻
+			end := now
+			if last != nil && last.Add(s.health.OnlineThreshold).Before(end) {
+				end = last.Add(s.health.OnlineThreshold)
+			}
+			if end.Before(cur.StartedAt) {
+				end = cur.StartedAt
+			}
+			if err := s.store.PeerSessions().Close(ctx, p.ID, end); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// disableStalePeers 按策略停用运行中接口上 stale 的 peer；最近修改过（如刚被重新启用）的 peer 重新计时
+func (s *WireGuardService) disableStalePeers(ctx context.Context, peers []models.WireGuardPeer, now time.Time) {
+	if !s.health.AutoDisable || s.health.StaleAfter <= 0 {
+		return
+	}
+	ifaces, err := s.store.Interfaces().List(ctx)
+	if err != nil {
+		log.Printf("[peer-health] list interfaces: %v", err)
+		return
+	}
+	// 接口停着时 peer 本来就连不上，不算 stale
+	running := map[int]bool{}
+	for _, it := range ifaces {
+		running[it.ID] = it.Status == "running"
+	}
+
+	touched := map[int]bool{}
+	for i := range peers {
+		p := &peers[i]
+		if p.Disabled || !running[p.InterfaceID] || !s.peerStale(p, now) || now.Sub(p.UpdatedAt) <= s.health.StaleAfter {
+			continue
+		}
+		cur, err := s.store.Peers().Get(ctx, p.ID)
+		if err != nil {
+			continue // 采样后被删除
+		}
+		cur.Disabled = true
+		if err := s.store.Peers().Update(ctx, cur); err != nil {
+			log.Printf("[peer-health] disable peer %d: %v", p.ID, err)
+			continue
+		}
+		seen := "never connected"
+		if p.LastHandshake != nil {
+			seen = "last seen " + p.LastHandshake.UTC().Format(time.RFC3339)
+		}
+		s.recordEvent(ctx, p.InterfaceID, models.EventStale, true,
+			fmt.Sprintf("peer %s disabled: %s (stale after %s)", p.Name, seen, formatDays(s.health.StaleAfter)), "")
+		touched[p.InterfaceID] = true
+	}
+
+	ids := make([]int, 0, len(touched))
+	for iid := range touched {
+		ids = append(ids, iid)
+	}
+	sort.Ints(ids)
+	for _, iid := range ids {
+		s.syncConfFile(iid)
+		if err := s.ApplyInterfaceConfig(iid); err != nil {
+			log.Printf("[peer-health] apply interface %d after disabling stale peers: %v", iid, err)
+		}
+	}
+}
+
+// formatDays 整天数的时长显示为 "30d"，其余按 Duration 显示
+func formatDays(d time.Duration) string {
+	if d%(24*time.Hour) == 0 {
+		return strconv.Itoa(int(d/(24*time.Hour))) + "d"
+	}
+	return d.String()
+}
+
+/* -------------------- 在线率报告 -------------------- */
+
+// parseHealthWindow 解析统计窗口：支持 Go duration（如 12h）与天数（如 7d），空串取 7 天
+func parseHealthWindow(w string) (time.Duration, error) {
+	w = strings.TrimSpace(w)
+	if w == "" {
+		return defaultPeerHealthWindow, nil
+	}
+	var d time.Duration
+	if n, ok := strings.CutSuffix(w, "d"); ok {
+		days, err := strconv.Atoi(n)
+		if err != nil {
+			return 0, fmt.Errorf("%w: window %q: expect a duration like 24h or 7d", ErrBadRequest, w)
+		}
+		d = time.Duration(days) * 24 * time.Hour
+	} else {
+		var err error
+		if d, err = time.ParseDuration(w); err != nil {
+			return 0, fmt.Errorf("%w: window %q: expect a duration like 24h or 7d", ErrBadRequest, w)
+		}
+	}
+	if d <= 0 || d > maxPeerHealthWindow {
+		return 0, fmt.Errorf("%w: window must be between 1s and 366d", ErrBadRequest)
+	}
+	return d, nil
+}
+
+// GetPeerHealth 返回 peer 在统计窗口内的在线时段与在线率
+func (s *WireGuardService) GetPeerHealth(ctx context.Context, id int, window string) (*models.PeerHealth, error) {
+	d, err := parseHealthWindow(window)
+	if err != nil {
+		return nil, err
+	}
+	p, err := s.store.Peers().Get(ctx, id)
+	if err != nil {
+		return nil, mapRepoErr(err, "peer")
+	}
+	now := time.Now()
+	start := now.Add(-d)
+	sessions, err := s.store.PeerSessions().ListByPeer(ctx, id, start)
+	if err != nil {
+		return nil, err
+	}
+	h := s.peerHealth(p, sessions, start, now)
+	return &h, nil
+}
+
+// ListPeerHealth 返回全部（interfaceID 非 0 时为该接口下）peer 的在线率，按在线率升序
+func (s *WireGuardService) ListPeerHealth(ctx context.Context, interfaceID int, window string) ([]models.PeerHealth, error) {
+	d, err := parseHealthWindow(window)
+	if err != nil {
+		return nil, err
+	}
+	var peers []models.WireGuardPeer
+	if interfaceID != 0 {
+		if _, err := s.store.Interfaces().Get(ctx, interfaceID); err != nil {
+			return nil, mapRepoErr(err, "interface")
+		}
+		peers, err = s.store.Peers().ListByInterface(ctx, interfaceID)
+	} else {
+		peers, err = s.store.Peers().List(ctx)
+	}
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	start := now.Add(-d)
+	sessions, err := s.store.PeerSessions().ListSince(ctx, start)
+	if err != nil {
+		return nil, err
+	}
+	byPeer := map[int][]models.PeerSession{}
+	for _, ps := range sessions {
+		byPeer[ps.PeerID] = append(byPeer[ps.PeerID], ps)
+	}
+
+	out := make([]models.PeerHealth, 0, len(peers))
+	for i := range peers {
+		out = append(out, s.peerHealth(&peers[i], byPeer[peers[i].ID], start, now))
+	}
+	sort.SliceStable(out, func(i, j int) bool { return out[i].Availability < out[j].Availability })
+	return out, nil
+}
+
+// peerHealth 汇总窗口 [start, now] 内的在线时长；peer 在窗口内创建时只统计创建之后的部分
+func (s *WireGuardService) peerHealth(p *models.WireGuardPeer, sessions []models.PeerSession, start, now time.Time) models.PeerHealth {
+	h := models.PeerHealth{
+		PeerID:        p.ID,
+		PeerName:      p.Name,
+		InterfaceID:   p.InterfaceID,
+		InterfaceName: p.InterfaceName,
+		LastSeen:      p.LastHandshake,
+		Stale:         s.peerStale(p, now),
+		Disabled:      p.Disabled,
+		WindowStart:   start,
+		WindowEnd:     now,
+		Sessions:      []models.PeerSession{},
+	}
+	from := start
+	if p.CreatedAt.After(from) {
+		from = p.CreatedAt
+	}
+
+	var online time.Duration
+	for _, ps := range sessions {
+		end := now
+		if ps.EndedAt != nil {
+			end = *ps.EndedAt
+		} else {
+			t := ps.StartedAt
+			h.Online, h.OnlineSince = true, &t
+		}
+		ps.Duration = int64(end.Sub(ps.StartedAt) / time.Second)
+		h.Sessions = append(h.Sessions, ps)
+
+		a, b := ps.StartedAt, end
+		if a.Before(from) {
+			a = from
+		}
+		if b.After(now) {
+			b = now
+		}
+		if b.After(a) {
+			online += b.Sub(a)
+		}
+	}
+	h.OnlineSeconds = int64(online / time.Second)
+	if span := now.Sub(from); span > 0 {
+		h.Availability = math.Round(float64(online)/float64(span)*10000) / 100
+	}
+	return h
+}
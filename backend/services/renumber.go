@@ -0,0 +1,446 @@
+package services
+
+import (
+	"backend/cidrset"
+	"backend/models"
+	"backend/repository"
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/netip"
+	"strings"
+	"time"
+)
+
+// 预演时用于回滚事务
+var errRenumberDryRun = errors.New("renumber dry run")
+
+// RenumberPeer 是单个 peer 的改址结果
+type RenumberPeer struct {
+	PeerID int    `json:"peer_id"`
+	Name   string `json:"name"`
+	OldIP  string `json:"old_ip"`
+	NewIP  string `json:"new_ip"`
+	// 每个保留下来的地址族都沿用了原主机偏移（10.8.0.23 -> 10.9.0.23）
+	OffsetKept bool `json:"offset_kept"`
+	// 客户端配置（Address / AllowedIPs / Endpoint）有变化，需要重新下发
+	NeedsNewConfig bool `json:"needs_new_config"`
+	// 服务端持有私钥，可直接重新下载配置；否则需客户端手动修改
+	ConfigAvailable bool `json:"config_available"`
+}
+
+type RenumberReport struct {
+	InterfaceID    int            `json:"interface_id"`
+	Interface      string         `json:"interface"`
+	OldAddress     string         `json:"old_address"`
+	NewAddress     string         `json:"new_address"`
+	DryRun         bool           `json:"dry_run"`
+	Peers          []RenumberPeer `json:"peers"`
+	NeedsNewConfig []string       `json:"needs_new_config"` // 需要重新下发配置的 peer 名
+	Applied        bool           `json:"applied"`
+	ApplyError     string         `json:"apply_error,omitempty"`
+}
+
+/* -------------------- 对外入口 -------------------- */
+
+// RenumberInterface 把接口换到新网段：peer 地址尽量保持主机偏移，其余重新分配；
+// 同步 allowed_ips、地址池与保留地址，重写 .conf 并在接口运行时重新下发内核
+func (s *WireGuardService) RenumberInterface(ctx context.Context, id int, req *models.RenumberInterfaceRequest) (*RenumberReport, error) {
+	address := strings.Join(splitCSV(req.Address), ", ")
+	var rep *RenumberReport
+	var oldAddress string
+	err := s.store.WithTx(ctx, func(tx repository.Store) error {
+		it, err := tx.Interfaces().Get(ctx, id)
+		if err != nil {
+			return mapRepoErr(err, "interface")
+		}
+		oldAddress = it.Address
+		if rep, err = s.renumberTx(ctx, tx, it, address); err != nil {
+			return err
+		}
+		if err := tx.Interfaces().Update(ctx, it); err != nil {
+			return mapRepoErr(err, "interface")
+		}
+		if req.DryRun {
+			return errRenumberDryRun
+		}
+		return nil
+	})
+	if errors.Is(err, errRenumberDryRun) {
+		rep.DryRun = true
+		return rep, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.reapplyRenumbered(id, oldAddress); err != nil {
+		rep.ApplyError = err.Error()
+	} else if it, err := s.GetInterface(id); err == nil && it.Status == "running" {
+		rep.Applied = true
+	}
+	return rep, nil
+}
+
+// reapplyRenumbered 重写 .conf；接口运行中时删除旧地址并重新下发
+func (s *WireGuardService) reapplyRenumbered(id int, oldAddress string) error {
+	s.syncConfFile(id)
+	it, err := s.GetInterface(id)
+	if err != nil || it.Status != "running" {
+		return err
+	}
+	keep := map[string]bool{}
+	for _, x := range splitCSV(it.Address) {
+		keep[x] = true
+	}
+	for _, x := range splitCSV(oldAddress) {
+		if !keep[x] {
+			_ = ipAddrDel(it.Name, x)
+		}
+	}
+	return s.ApplyInterfaceConfig(id)
+}
+
+/* -------------------- 改址 -------------------- */
+
+// renumberTx 在事务内完成改址，并把 it 的 address/cidr/server_ip 改为新值（由调用方写回）
+func (s *WireGuardService) renumberTx(ctx context.Context, tx repository.Store, it *models.WireGuardInterface, address string) (*RenumberReport, error) {
+	newFams, err := parseInterfaceAddress(address)
+	if err != nil {
+		return nil, err
+	}
+	oldFams, err := interfaceFamilies(it)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.checkSubnetConflicts(ctx, tx, it.ID, it.Name, newFams); err != nil {
+		return nil, err
+	}
+	// 新地址族 i 对应的旧地址族下标；新增的地址族为 -1
+	from := make([]int, len(newFams))
+	for i, nf := range newFams {
+		from[i] = -1
+		for j, of := range oldFams {
+			if of.Server.Is4() == nf.Server.Is4() {
+				from[i] = j
+			}
+		}
+	}
+
+	rep := &RenumberReport{
+		InterfaceID:    it.ID,
+		Interface:      it.Name,
+		OldAddress:     it.Address,
+		NewAddress:     address,
+		Peers:          []RenumberPeer{},
+		NeedsNewConfig: []string{},
+	}
+
+	// 1) 地址池、保留地址按相同偏移平移；放不进新网段时拒绝
+	if err := s.renumberIPAM(ctx, tx, it.ID, oldFams, newFams); err != nil {
+		return nil, err
+	}
+
+	// 2) peer 地址：先保持偏移，冲突或放不下的再分配
+	peers, err := tx.Peers().ListByInterface(ctx, it.ID)
+	if err != nil {
+		return nil, err
+	}
+	res, err := tx.IPAM().ListReservations(ctx, it.ID)
+	if err != nil {
+		return nil, err
+	}
+	var reserved []netip.Prefix
+	for _, r := range res {
+		ps, err := parseCIDRItems(splitCSV(r.Addresses))
+		if err != nil {
+			return nil, err
+		}
+		reserved = append(reserved, ps...)
+	}
+
+	probe := &ipamView{fams: newFams}
+	claimed := map[string]bool{}
+	keep := make([]string, len(peers))
+	kept := make([]bool, len(peers))
+	for k, p := range peers {
+		old := peerAddrs(p.IP)
+		var ips []string
+		kept[k] = true
+		for i := range newFams {
+			j := from[i]
+			if j < 0 {
+				continue
+			}
+			var a netip.Addr
+			for _, x := range old {
+				if oldFams[j].Prefix.Contains(x) {
+					a = x
+				}
+			}
+			if !a.IsValid() {
+				continue
+			}
+			b, ok := translateAddr(a, oldFams[j].Prefix, newFams[i].Prefix)
+			if !ok || probe.special(b) || claimed[b.String()] || cidrset.ContainsAddr(reserved, b) {
+				kept[k] = false
+				continue
+			}
+			claimed[b.String()] = true
+			ips = append(ips, b.String())
+		}
+		keep[k] = strings.Join(ips, ", ")
+	}
+
+	view, err := s.loadIPAMView(ctx, tx, it.ID, newFams, keep)
+	if err != nil {
+		return nil, err
+	}
+	want := make([]string, len(peers))
+	for k, p := range peers {
+		pool := ""
+		if as := peerAddrs(keep[k]); len(as) > 0 {
+			pool = view.poolOf(as[0])
+		}
+		ip, err := view.assign(pool, keep[k])
+		if err != nil {
+			if errors.Is(err, ErrConflict) {
+				return nil, fmt.Errorf("%w: %s cannot fit all %d peers: %v", ErrConflict, address, len(peers), err)
+			}
+			return nil, fmt.Errorf("peer %s: %w", p.Name, err)
+		}
+		want[k] = ip
+	}
+
+	// 3) 写回：先把要改的 peer 换成占位地址，避免新旧网段重叠时逐条更新撞上唯一约束
+	oldIt := *it
+	cidr, serverIP, err := deriveCIDR(address)
+	if err != nil {
+		return nil, err
+	}
+	it.Address, it.CIDR, it.ServerIP = address, cidr, serverIP
+
+	changed := make([]models.WireGuardPeer, 0, len(peers))
+	for k, p := range peers {
+		np := p
+		np.IP = want[k]
+		np.AllowedIPs = swapRoutes(p.AllowedIPs, p.IP, np.IP, oldFams, newFams)
+		np.ClientAllowedIPs = swapRoutes(p.ClientAllowedIPs, "", "", oldFams, newFams)
+
+		before, err := s.clientSignature(ctx, &oldIt, oldFams, &p)
+		if err != nil {
+			return nil, err
+		}
+		after, err := s.clientSignature(ctx, it, newFams, &np)
+		if err != nil {
+			return nil, err
+		}
+		r := RenumberPeer{
+			PeerID:          p.ID,
+			Name:            p.Name,
+			OldIP:           p.IP,
+			NewIP:           np.IP,
+			OffsetKept:      kept[k],
+			NeedsNewConfig:  before != after,
+			ConfigAvailable: strings.TrimSpace(p.PrivateKey) != "",
+		}
+		rep.Peers = append(rep.Peers, r)
+		if r.NeedsNewConfig {
+			rep.NeedsNewConfig = append(rep.NeedsNewConfig, p.Name)
+		}
+		if np.IP != p.IP || np.AllowedIPs != p.AllowedIPs || np.ClientAllowedIPs != p.ClientAllowedIPs {
+			changed = append(changed, np)
+		}
+	}
+	for _, np := range changed {
+		tmp := np
+		tmp.IP = fmt.Sprintf("renumber-%d", np.ID)
+		if err := tx.Peers().Update(ctx, &tmp); err != nil {
+			return nil, mapRepoErr(err, "peer")
+		}
+	}
+	for i := range changed {
+		if err := tx.Peers().Update(ctx, &changed[i]); err != nil {
+			return nil, mapRepoErr(err, "peer")
+		}
+	}
+	return rep, nil
+}
+
+// renumberIPAM 平移地址池与保留地址，并清掉旧网段的隔离期地址
+func (s *WireGuardService) renumberIPAM(ctx context.Context, tx repository.Store, interfaceID int, oldFams, newFams []addrFamily) error {
+	pools, err := tx.IPAM().ListPools(ctx, interfaceID)
+	if err != nil {
+		return err
+	}
+	for _, p := range pools {
+		ranges, err := translateItems(p.Ranges, oldFams, newFams)
+		if err != nil {
+			return fmt.Errorf("%w: ip pool %s: %v", ErrConflict, p.Name, err)
+		}
+		if ranges == "" {
+			return fmt.Errorf("%w: ip pool %s has no ranges left in the new subnet", ErrConflict, p.Name)
+		}
+		if ranges != p.Ranges {
+			p.Ranges = ranges
+			if err := tx.IPAM().UpdatePool(ctx, &p); err != nil {
+				return mapRepoErr(err, "ip pool")
+			}
+		}
+	}
+
+	res, err := tx.IPAM().ListReservations(ctx, interfaceID)
+	if err != nil {
+		return err
+	}
+	for _, r := range res {
+		addrs, err := translateItems(r.Addresses, oldFams, newFams)
+		if err != nil {
+			return fmt.Errorf("%w: ip reservation %d: %v", ErrConflict, r.ID, err)
+		}
+		if addrs == r.Addresses {
+			continue
+		}
+		if addrs == "" {
+			// 地址族被移除
+			if err := tx.IPAM().DeleteReservation(ctx, r.ID); err != nil {
+				return mapRepoErr(err, "ip reservation")
+			}
+			continue
+		}
+		r.Addresses = addrs
+		if err := tx.IPAM().UpdateReservation(ctx, &r); err != nil {
+			return mapRepoErr(err, "ip reservation")
+		}
+	}
+
+	qs, err := tx.IPAM().ListQuarantine(ctx, interfaceID, time.Now())
+	if err != nil {
+		return err
+	}
+	for _, q := range qs {
+		if a, err := netip.ParseAddr(q.IP); err != nil || familyOf(newFams, a) < 0 {
+			if err := tx.IPAM().Unquarantine(ctx, interfaceID, q.IP); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// clientSignature 汇总客户端配置中受改址影响的部分，用于判断是否需要重新下发
+func (s *WireGuardService) clientSignature(ctx context.Context, it *models.WireGuardInterface, fams []addrFamily, p *models.WireGuardPeer) (string, error) {
+	allowed, err := s.clientAllowedIPs(ctx, p, clientTunnelCIDRs(it, fams, p))
+	if err != nil {
+		return "", fmt.Errorf("peer %s: %w", p.Name, err)
+	}
+	return strings.Join(peerInterfaceAddress(fams, p.IP), ",") + "|" +
+		strings.Join(allowed, ",") + "|" + interfaceEndpoint(it, fams), nil
+}
+
+/* -------------------- 地址平移 -------------------- */
+
+func addrBig(a netip.Addr) *big.Int {
+	return new(big.Int).SetBytes(a.AsSlice())
+}
+
+// translateAddr 保持主机偏移把 a 从 from 网段映射到 to 网段；偏移超出 to 时返回 false
+func translateAddr(a netip.Addr, from, to netip.Prefix) (netip.Addr, bool) {
+	if a.Is4() != to.Addr().Is4() {
+		return netip.Addr{}, false
+	}
+	off := new(big.Int).Sub(addrBig(a), addrBig(from.Masked().Addr()))
+	if off.Sign() < 0 || off.Cmp(cidrset.Size([]netip.Prefix{to})) >= 0 {
+		return netip.Addr{}, false
+	}
+	b := off.Add(off, addrBig(to.Masked().Addr())).FillBytes(make([]byte, a.BitLen()/8))
+	out, _ := netip.AddrFromSlice(b)
+	return out, true
+}
+
+// translateItems 平移地址列表（CIDR / 裸地址 / a-b 区间），保留原写法；
+// 属于被移除地址族的项丢弃，放不进新网段时报错
+func translateItems(s string, oldFams, newFams []addrFamily) (string, error) {
+	var out []string
+	for _, item := range splitCSV(s) {
+		var first, last netip.Addr
+		bits := -1
+		if strings.Contains(item, "-") {
+			r, err := cidrset.ParseRange(item)
+			if err != nil {
+				return "", err
+			}
+			first, last = r.First, r.Last
+		} else {
+			p, err := cidrset.ParsePrefix(item)
+			if err != nil {
+				return "", err
+			}
+			first, last, bits = p.Addr(), cidrset.RangeOf(p).Last, p.Bits()
+		}
+		j := familyOf(oldFams, first)
+		if j < 0 {
+			return "", fmt.Errorf("%s is outside the current subnets", item)
+		}
+		i := -1
+		for k, nf := range newFams {
+			if nf.Server.Is4() == first.Is4() {
+				i = k
+			}
+		}
+		if i < 0 {
+			continue // 地址族被移除
+		}
+		a, ok1 := translateAddr(first, oldFams[j].Prefix, newFams[i].Prefix)
+		b, ok2 := translateAddr(last, oldFams[j].Prefix, newFams[i].Prefix)
+		if !ok1 || !ok2 {
+			return "", fmt.Errorf("%s does not fit %s", item, newFams[i].Prefix)
+		}
+		switch {
+		case bits < 0:
+			out = append(out, a.String()+"-"+b.String())
+		case bits == a.BitLen():
+			out = append(out, a.String())
+		default:
+			out = append(out, netip.PrefixFrom(a, bits).String())
+		}
+	}
+	return strings.Join(out, ", "), nil
+}
+
+// swapRoutes 把路由列表中旧 peer 地址的主机路由换成新地址的，旧接口网段换成新网段；其余保持不变
+func swapRoutes(list, oldIP, newIP string, oldFams, newFams []addrFamily) string {
+	if strings.TrimSpace(list) == "" {
+		return list
+	}
+	if list == hostCIDR(oldIP) {
+		// 默认值：跟随新地址（含新增的地址族）
+		return hostCIDR(newIP)
+	}
+	repl := map[string]string{}
+	olds, news := peerAddrs(oldIP), peerAddrs(newIP)
+	for _, o := range olds {
+		for _, n := range news {
+			if o.Is4() == n.Is4() {
+				repl[netip.PrefixFrom(o, o.BitLen()).String()] = netip.PrefixFrom(n, n.BitLen()).String()
+			}
+		}
+	}
+	for _, of := range oldFams {
+		for _, nf := range newFams {
+			if of.Server.Is4() == nf.Server.Is4() {
+				repl[of.Prefix.String()] = nf.Prefix.String()
+			}
+		}
+	}
+	items := splitCSV(list)
+	for i, x := range items {
+		if p, err := cidrset.ParsePrefix(x); err == nil {
+			if y, ok := repl[p.String()]; ok {
+				items[i] = y
+			}
+		}
+	}
+	return strings.Join(items, ", ")
+}
@@ -0,0 +1,181 @@
+package services
+
+import (
+	"backend/models"
+	"context"
+	"errors"
+	"net/netip"
+	"testing"
+)
+
+func TestTranslateAddr(t *testing.T) {
+	tests := []struct {
+		addr, from, to string
+		want           string // 空表示放不下
+	}{
+		{"10.8.0.23", "10.8.0.0/24", "10.9.0.0/24", "10.9.0.23"},
+		{"10.8.0.23", "10.8.0.0/24", "172.16.4.0/22", "172.16.4.23"},
+		{"10.8.1.5", "10.8.0.0/16", "10.9.0.0/16", "10.9.1.5"},
+		{"10.8.0.200", "10.8.0.0/24", "10.9.0.0/25", ""},
+		{"10.8.0.127", "10.8.0.0/24", "10.9.0.0/25", "10.9.0.127"},
+		{"fd00::1:2", "fd00::/64", "fd01:0:0:5::/64", "fd01::5:0:0:1:2"},
+		{"fd00::ff02", "fd00::/64", "fd01::/112", "fd01::ff02"},
+		{"fd00::1:2", "fd00::/64", "fd01::/112", ""},
+		{"10.8.0.23", "10.8.0.0/24", "fd00::/64", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.addr+"->"+tt.to, func(t *testing.T) {
+			a, ok := translateAddr(netip.MustParseAddr(tt.addr), netip.MustParsePrefix(tt.from), netip.MustParsePrefix(tt.to))
+			got := ""
+			if ok {
+				got = a.String()
+			}
+			if got != tt.want {
+				t.Fatalf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTranslateItems(t *testing.T) {
+	fams := func(s string) []addrFamily {
+		out, err := parseInterfaceAddress(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return out
+	}
+	tests := []struct {
+		name     string
+		items    string
+		old, new string
+		want     string
+		wantErr  bool
+	}{
+		{"cidr keeps length", "10.8.0.16/28", "10.8.0.1/24", "10.9.0.1/24", "10.9.0.16/28", false},
+		{"bare address", "10.8.0.7", "10.8.0.1/24", "10.9.0.1/24", "10.9.0.7", false},
+		{"range keeps form", "10.8.0.100-10.8.0.110", "10.8.0.1/24", "10.9.0.1/24", "10.9.0.100-10.9.0.110", false},
+		{"mixed list", "10.8.0.7, fd00::10/124", "10.8.0.1/24, fd00::1/64", "10.9.0.1/24, fd09::1/64", "10.9.0.7, fd09::10/124", false},
+		{"removed family dropped", "10.8.0.7, fd00::10", "10.8.0.1/24, fd00::1/64", "10.9.0.1/24", "10.9.0.7", false},
+		{"does not fit", "10.8.0.200-10.8.0.210", "10.8.0.1/24", "10.9.0.1/25", "", true},
+		{"outside old subnet", "192.168.0.1", "10.8.0.1/24", "10.9.0.1/24", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := translateItems(tt.items, fams(tt.old), fams(tt.new))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Fatalf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRenumberInterface(t *testing.T) {
+	type peerWant struct {
+		ip, allowed string
+		kept        bool
+	}
+	tests := []struct {
+		name    string
+		address string
+		dryRun  bool
+		peers   map[string]peerWant
+		pool    string
+		res     string
+		wantErr error
+	}{
+		{
+			name:    "smaller subnet keeps offsets that fit",
+			address: "10.9.0.1/25",
+			peers: map[string]peerWant{
+				"a": {"10.9.0.23", "10.9.0.23/32", true},
+				"b": {"10.9.0.3", "10.9.0.3/32", false}, // .200 放不进 /25，按池外首个空闲地址重新分配
+				"c": {"10.9.0.2", "10.9.0.2/32, 192.168.5.0/24", true},
+			},
+			pool: "10.9.0.16/28",
+			res:  "10.9.0.100-10.9.0.110",
+		},
+		{
+			name:    "dry run leaves the store untouched",
+			address: "10.9.0.1/24",
+			dryRun:  true,
+			peers: map[string]peerWant{
+				"a": {"10.8.0.23", "10.8.0.23/32", true},
+				"b": {"10.8.0.200", "10.8.0.200/32", true},
+				"c": {"10.8.0.2", "10.8.0.2/32, 192.168.5.0/24", true},
+			},
+			pool: "10.8.0.16/28",
+			res:  "10.8.0.100-10.8.0.110",
+		},
+		{
+			name:    "pool does not fit",
+			address: "10.9.0.1/29",
+			wantErr: ErrConflict,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			wg := newTestService(t)
+			st := wg.store
+			it := &models.WireGuardInterface{Name: "wgrenum0", Address: "10.8.0.1/24", ListenPort: 51850, Mode: "server"}
+			if err := st.Interfaces().Create(ctx, it); err != nil {
+				t.Fatal(err)
+			}
+			for _, p := range []models.WireGuardPeer{
+				{Name: "a", IP: "10.8.0.23", AllowedIPs: "10.8.0.23/32"},
+				{Name: "b", IP: "10.8.0.200", AllowedIPs: "10.8.0.200/32"},
+				{Name: "c", IP: "10.8.0.2", AllowedIPs: "10.8.0.2/32, 192.168.5.0/24"},
+			} {
+				p.InterfaceID, p.PublicKey = it.ID, p.Name
+				if err := st.Peers().Create(ctx, &p); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := st.IPAM().CreatePool(ctx, &models.IPPool{InterfaceID: it.ID, Name: "laptops", Ranges: "10.8.0.16/28"}); err != nil {
+				t.Fatal(err)
+			}
+			if err := st.IPAM().CreateReservation(ctx, &models.IPReservation{InterfaceID: it.ID, Addresses: "10.8.0.100-10.8.0.110"}); err != nil {
+				t.Fatal(err)
+			}
+
+			rep, err := wg.RenumberInterface(ctx, it.ID, &models.RenumberInterfaceRequest{Address: tt.address, DryRun: tt.dryRun})
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("got %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("renumber: %v", err)
+			}
+			if rep.DryRun != tt.dryRun {
+				t.Fatalf("dry_run = %v", rep.DryRun)
+			}
+			for _, rp := range rep.Peers {
+				if want := tt.peers[rp.Name]; rp.OffsetKept != want.kept {
+					t.Errorf("%s: offset_kept = %v, want %v", rp.Name, rp.OffsetKept, want.kept)
+				}
+			}
+
+			peers, err := st.Peers().ListByInterface(ctx, it.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, p := range peers {
+				want := tt.peers[p.Name]
+				if p.IP != want.ip || p.AllowedIPs != want.allowed {
+					t.Errorf("%s: got ip %q allowed %q, want %q %q", p.Name, p.IP, p.AllowedIPs, want.ip, want.allowed)
+				}
+			}
+			pools, _ := st.IPAM().ListPools(ctx, it.ID)
+			res, _ := st.IPAM().ListReservations(ctx, it.ID)
+			if len(pools) != 1 || pools[0].Ranges != tt.pool || len(res) != 1 || res[0].Addresses != tt.res {
+				t.Errorf("ipam: pools %+v reservations %+v", pools, res)
+			}
+		})
+	}
+}
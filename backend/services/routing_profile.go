@@ -0,0 +1,262 @@
+package services
+
+import (
+	"backend/cidrset"
+	"backend/models"
+	"backend/repository"
+	"context"
+	"errors"
+	"fmt"
+	"net/netip"
+	"strings"
+)
+
+// full_except_lan 未指定 Excluded 时排除的网段：RFC1918、链路本地、IPv6 ULA / 链路本地
+const defaultLANExcluded = "10.0.0.0/8, 172.16.0.0/12, 192.168.0.0/16, 169.254.0.0/16, fc00::/7, fe80::/10"
+
+var defaultRoutes = []netip.Prefix{netip.MustParsePrefix("0.0.0.0/0"), netip.MustParsePrefix("::/0")}
+
+/* -------------------- 路由模板（CRUD） -------------------- */
+
+func normalizeRoutingProfile(req *models.RoutingProfileRequest) (*models.RoutingProfile, error) {
+	rp := &models.RoutingProfile{
+		Name:        strings.TrimSpace(req.Name),
+		Kind:        strings.ToLower(strings.TrimSpace(req.Kind)),
+		Description: strings.TrimSpace(req.Description),
+	}
+	if rp.Name == "" {
+		return nil, fmt.Errorf("%w: name is required", ErrBadRequest)
+	}
+
+	routes, err := cidrset.Parse(req.Routes)
+	if err != nil {
+		return nil, fmt.Errorf("%w: routes: %v", ErrBadRequest, err)
+	}
+	excluded, err := cidrset.Parse(req.Excluded)
+	if err != nil {
+		return nil, fmt.Errorf("%w: excluded: %v", ErrBadRequest, err)
+	}
+
+	switch rp.Kind {
+	case models.RoutingFull:
+	case models.RoutingSplit:
+		if len(routes) == 0 {
+			return nil, fmt.Errorf("%w: split profile needs at least one route", ErrBadRequest)
+		}
+		rp.Routes = strings.Join(cidrset.Strings(routes), ", ")
+	case models.RoutingFullExceptLAN:
+		rp.Excluded = strings.Join(cidrset.Strings(excluded), ", ")
+	default:
+		return nil, fmt.Errorf("%w: kind must be %q, %q or %q", ErrBadRequest,
+			models.RoutingFull, models.RoutingSplit, models.RoutingFullExceptLAN)
+	}
+	return rp, nil
+}
+
+func (s *WireGuardService) ListRoutingProfiles() ([]models.RoutingProfile, error) {
+	list, err := s.store.RoutingProfiles().List(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	if list == nil {
+		list = []models.RoutingProfile{}
+	}
+	return list, nil
+}
+
+func (s *WireGuardService) GetRoutingProfile(id int) (*models.RoutingProfile, error) {
+	rp, err := s.store.RoutingProfiles().Get(context.Background(), id)
+	if err != nil {
+		return nil, mapRepoErr(err, "routing profile")
+	}
+	return rp, nil
+}
+
+func (s *WireGuardService) CreateRoutingProfile(ctx context.Context, req *models.RoutingProfileRequest) (*models.RoutingProfile, error) {
+	rp, err := normalizeRoutingProfile(req)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.store.RoutingProfiles().Create(ctx, rp); err != nil {
+		return nil, mapRepoErr(err, "routing profile")
+	}
+	return s.GetRoutingProfile(rp.ID)
+}
+
+func (s *WireGuardService) UpdateRoutingProfile(ctx context.Context, id int, req *models.RoutingProfileRequest) (*models.RoutingProfile, error) {
+	rp, err := normalizeRoutingProfile(req)
+	if err != nil {
+		return nil, err
+	}
+	rp.ID = id
+	if err := s.store.RoutingProfiles().Update(ctx, rp); err != nil {
+		return nil, mapRepoErr(err, "routing profile")
+	}
+	return s.GetRoutingProfile(id)
+}
+
+// DeleteRoutingProfile 删除模板；仍被 peer 引用时拒绝，避免客户端路由悄悄变化
+func (s *WireGuardService) DeleteRoutingProfile(ctx context.Context, id int) error {
+	return s.store.WithTx(ctx, func(tx repository.Store) error {
+		if _, err := tx.RoutingProfiles().Get(ctx, id); err != nil {
+			return mapRepoErr(err, "routing profile")
+		}
+		peers, err := tx.Peers().List(ctx)
+		if err != nil {
+			return err
+		}
+		n := 0
+		for _, p := range peers {
+			if p.RoutingProfileID != nil && *p.RoutingProfileID == id {
+				n++
+			}
+		}
+		if n > 0 {
+			return fmt.Errorf("%w: routing profile is used by %d peer(s)", ErrConflict, n)
+		}
+		return mapRepoErr(tx.RoutingProfiles().Delete(ctx, id), "routing profile")
+	})
+}
+
+/* -------------------- 客户端 AllowedIPs 计算 -------------------- */
+
+// profileAllowedIPs 按模板计算客户端 AllowedIPs；tunnelCIDR 为接口网段（双栈时逗号分隔），分流与排除时始终保留
+func profileAllowedIPs(rp *models.RoutingProfile, tunnelCIDR string) ([]string, error) {
+	tunnel, err := cidrset.Parse(tunnelCIDR)
+	if err != nil {
+		return nil, err
+	}
+
+	switch rp.Kind {
+	case models.RoutingFull:
+		return cidrset.Strings(defaultRoutes), nil
+
+	case models.RoutingSplit:
+		routes, err := cidrset.Parse(rp.Routes)
+		if err != nil {
+			return nil, err
+		}
+		out := cidrset.Strings(tunnel)
+		seen := map[string]bool{}
+		for _, x := range out {
+			seen[x] = true
+		}
+		for _, r := range cidrset.Strings(routes) {
+			if !seen[r] {
+				seen[r] = true
+				out = append(out, r)
+			}
+		}
+		return out, nil
+
+	case models.RoutingFullExceptLAN:
+		excl := rp.Excluded
+		if strings.TrimSpace(excl) == "" {
+			excl = defaultLANExcluded
+		}
+		excluded, err := cidrset.Parse(excl)
+		if err != nil {
+			return nil, err
+		}
+		// 接口网段常落在私有地址内，排除后再单独加回
+		rest := cidrset.Subtract(defaultRoutes, excluded)
+		return cidrset.Strings(cidrset.Union(append(tunnel, rest...))), nil
+	}
+	return nil, fmt.Errorf("unknown routing profile kind %q", rp.Kind)
+}
+
+// clientAllowedIPs 决定客户端配置中的 AllowedIPs：peer 显式值 > 路由模板 > 接口网段，
+// 再扣除 peer 的 excluded_ips
+func (s *WireGuardService) clientAllowedIPs(ctx context.Context, p *models.WireGuardPeer, tunnelCIDR string) ([]string, error) {
+	allowed, err := s.baseClientAllowedIPs(ctx, p, tunnelCIDR)
+	if err != nil {
+		return nil, err
+	}
+	return excludeAllowedIPs(allowed, p.ExcludedIPs)
+}
+
+func (s *WireGuardService) baseClientAllowedIPs(ctx context.Context, p *models.WireGuardPeer, tunnelCIDR string) ([]string, error) {
+	if v := strings.TrimSpace(p.ClientAllowedIPs); v != "" {
+		return splitCSV(v), nil
+	}
+	if p.RoutingProfileID != nil {
+		rp, err := s.store.RoutingProfiles().Get(ctx, *p.RoutingProfileID)
+		if err != nil {
+			return nil, mapRepoErr(err, "routing profile")
+		}
+		return profileAllowedIPs(rp, tunnelCIDR)
+	}
+	return splitCSV(tunnelCIDR), nil
+}
+
+// excludeAllowedIPs 从 allowed 中扣除 excluded；未设置排除时原样返回，保持列表顺序
+func excludeAllowedIPs(allowed []string, excluded string) ([]string, error) {
+	if strings.TrimSpace(excluded) == "" {
+		return allowed, nil
+	}
+	base, err := cidrset.Parse(strings.Join(allowed, ","))
+	if err != nil {
+		return nil, err
+	}
+	excl, err := cidrset.Parse(excluded)
+	if err != nil {
+		return nil, fmt.Errorf("%w: excluded_ips: %v", ErrBadRequest, err)
+	}
+	rest := cidrset.Subtract(base, excl)
+	if len(rest) == 0 {
+		return nil, fmt.Errorf("%w: excluded_ips removes every client route", ErrBadRequest)
+	}
+	return cidrset.Strings(rest), nil
+}
+
+/* -------------------- 校验 -------------------- */
+
+// validateServerAllowedIPs 校验服务端 AllowedIPs（路由到该 peer 的网段）；
+// 默认路由会把服务器的全部流量引向单个 peer，属于客户端设置，直接拒绝而不是悄悄改写
+func validateServerAllowedIPs(s string) error {
+	if _, err := parseAllowedIPs(s); err != nil {
+		return fmt.Errorf("%w: allowed_ips: %v", ErrBadRequest, err)
+	}
+	if containsDefaultRoute(s) {
+		return fmt.Errorf("%w: allowed_ips is the server-side route to this peer and cannot contain a default route; "+
+			"use client_allowed_ips or a routing profile for full tunnel", ErrBadRequest)
+	}
+	return nil
+}
+
+// normalizeClientAllowedIPs 校验并规整客户端 AllowedIPs（允许默认路由）
+func normalizeClientAllowedIPs(s string) (string, error) {
+	return normalizeCIDRList("client_allowed_ips", s)
+}
+
+// normalizeExcludedIPs 校验并规整 excluded_ips（合并为最少前缀）
+func normalizeExcludedIPs(s string) (string, error) {
+	ps, err := cidrset.Parse(s)
+	if err != nil {
+		return "", fmt.Errorf("%w: excluded_ips: %v", ErrBadRequest, err)
+	}
+	return strings.Join(cidrset.Strings(cidrset.Union(ps)), ", "), nil
+}
+
+func normalizeCIDRList(field, s string) (string, error) {
+	ps, err := cidrset.Parse(s)
+	if err != nil {
+		return "", fmt.Errorf("%w: %s: %v", ErrBadRequest, field, err)
+	}
+	return strings.Join(cidrset.Strings(ps), ", "), nil
+}
+
+// checkRoutingProfileID 确认模板存在；0 表示解除关联，返回 nil
+func checkRoutingProfileID(ctx context.Context, store repository.Store, id *int) (*int, error) {
+	if id == nil || *id == 0 {
+		return nil, nil
+	}
+	if _, err := store.RoutingProfiles().Get(ctx, *id); err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, fmt.Errorf("%w: routing profile %d does not exist", ErrBadRequest, *id)
+		}
+		return nil, err
+	}
+	v := *id
+	return &v, nil
+}
@@ -0,0 +1,243 @@
+package services
+
+import (
+	"backend/cidrset"
+	"backend/models"
+	"backend/repository"
+	"context"
+	"fmt"
+	"net"
+	"net/netip"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+/* -------------------- 接口模式 / 对外地址 -------------------- */
+
+// applyInterfaceSite 把请求中的 mode / endpoint / local_subnets 合并到接口
+func applyInterfaceSite(it *models.WireGuardInterface, req models.InterfaceSite) error {
+	if req.Mode != nil {
+		mode := strings.ToLower(strings.TrimSpace(*req.Mode))
+		if mode == "" {
+			mode = models.InterfaceModeServer
+		}
+		if mode != models.InterfaceModeServer && mode != models.InterfaceModeClient {
+			return fmt.Errorf("%w: unsupported interface mode %q", ErrBadRequest, mode)
+		}
+		it.Mode = mode
+	}
+	if it.Mode == "" {
+		it.Mode = models.InterfaceModeServer
+	}
+	if req.Endpoint != nil {
+		ep, err := normalizeInterfaceEndpoint(*req.Endpoint)
+		if err != nil {
+			return err
+		}
+		it.Endpoint = ep
+	}
+	if req.LocalSubnets != nil {
+		v, err := normalizeSubnets("local_subnets", *req.LocalSubnets)
+		if err != nil {
+			return err
+		}
+		it.LocalSubnets = v
+	}
+	return nil
+}
+
+// normalizeInterfaceEndpoint 校验 host[:port]；IPv6 带端口须写成 [addr]:port
+func normalizeInterfaceEndpoint(ep string) (string, error) {
+	ep = strings.TrimSpace(ep)
+	if ep == "" {
+		return "", nil
+	}
+	if strings.ContainsAny(ep, " \t,/") {
+		return "", fmt.Errorf("%w: endpoint %q: expect host or host:port", ErrBadRequest, ep)
+	}
+	if a, err := netip.ParseAddr(strings.Trim(ep, "[]")); err == nil {
+		return a.String(), nil // 不带端口的地址（含 IPv6）
+	}
+	host, port, err := net.SplitHostPort(ep)
+	if err != nil {
+		return ep, nil // 不带端口的主机名
+	}
+	n, err := strconv.Atoi(port)
+	if host == "" || err != nil || n < 1 || n > 65535 {
+		return "", fmt.Errorf("%w: endpoint %q: expect host or host:port", ErrBadRequest, ep)
+	}
+	return net.JoinHostPort(host, port), nil
+}
+
+// interfaceEndpoint 是客户端配置中的 Endpoint：接口 endpoint 优先（未写端口时用监听端口），
+// 否则为 WG_PUBLIC_ENDPOINT / 服务端地址 + 监听端口
+func interfaceEndpoint(it *models.WireGuardInterface, fams []addrFamily) string {
+	port := strconv.Itoa(it.ListenPort)
+	ep := strings.TrimSpace(it.Endpoint)
+	if ep == "" {
+		return net.JoinHostPort(endpointHost(fams), port)
+	}
+	if _, _, err := net.SplitHostPort(ep); err == nil {
+		return ep
+	}
+	return net.JoinHostPort(ep, port)
+}
+
+// checkLocalSubnets 确认本端局域网不与接口自身网段、任何 site peer 路由的对端局域网重叠
+func checkLocalSubnets(ctx context.Context, store repository.Store, it *models.WireGuardInterface) error {
+	local, _ := cidrset.Parse(it.LocalSubnets)
+	if len(local) == 0 {
+		return nil
+	}
+	fams, err := parseInterfaceAddress(it.Address)
+	if err != nil {
+		return err
+	}
+	peers, err := store.Peers().List(ctx)
+	if err != nil {
+		return err
+	}
+	for _, l := range local {
+		for _, f := range fams {
+			if l.Overlaps(f.Prefix) {
+				return fmt.Errorf("%w: local subnet %s overlaps the tunnel subnet %s", ErrBadRequest, l, f.Prefix)
+			}
+		}
+		for _, p := range peers {
+			ps, _ := cidrset.Parse(p.RoutedSubnets)
+			for _, sn := range ps {
+				if l.Overlaps(sn) {
+					return fmt.Errorf("%w: local subnet %s overlaps %s routed to site peer %s on %s",
+						ErrConflict, l, sn, p.Name, p.InterfaceName)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+/* -------------------- site 类型 peer -------------------- */
+
+// normalizeSubnets 校验并规整局域网网段列表：不允许默认路由与重复 / 重叠
+func normalizeSubnets(field, s string) (string, error) {
+	ps, err := cidrset.Parse(s)
+	if err != nil {
+		return "", fmt.Errorf("%w: %s: %v", ErrBadRequest, field, err)
+	}
+	for i, p := range ps {
+		if p.Bits() == 0 {
+			return "", fmt.Errorf("%w: %s cannot contain a default route", ErrBadRequest, field)
+		}
+		for _, q := range ps[:i] {
+			if p.Overlaps(q) {
+				return "", fmt.Errorf("%w: %s: %s overlaps %s", ErrBadRequest, field, p, q)
+			}
+		}
+	}
+	return strings.Join(cidrset.Strings(ps), ", "), nil
+}
+
+// setPeerSite 合并请求中的 type / routed_subnets 并校验，返回是否有变化。
+// site 的网段不能与任何接口的网段或 local_subnets、主机路由、其他 site peer 的网段重叠
+func (s *WireGuardService) setPeerSite(ctx context.Context, store repository.Store, iface *models.WireGuardInterface,
+	p *models.WireGuardPeer, typ, routed *string) (bool, error) {
+	before := p.Type + "|" + p.RoutedSubnets
+	if typ != nil {
+		t := strings.ToLower(strings.TrimSpace(*typ))
+		switch t {
+		case "":
+			t = models.PeerTypeClient
+		case models.PeerTypeClient, models.PeerTypeSite:
+		default:
+			return false, fmt.Errorf("%w: peer type must be client or site", ErrBadRequest)
+		}
+		p.Type = t
+	}
+	if p.Type == "" {
+		p.Type = models.PeerTypeClient
+	}
+	if routed != nil {
+		v, err := normalizeSubnets("routed_subnets", *routed)
+		if err != nil {
+			return false, err
+		}
+		p.RoutedSubnets = v
+	}
+
+	if p.Type != models.PeerTypeSite {
+		if routed != nil && p.RoutedSubnets != "" {
+			return false, fmt.Errorf("%w: routed_subnets requires peer type site", ErrBadRequest)
+		}
+		p.RoutedSubnets = ""
+		return before != p.Type+"|"+p.RoutedSubnets, nil
+	}
+	if before == p.Type+"|"+p.RoutedSubnets {
+		return false, nil
+	}
+
+	subnets, _ := cidrset.Parse(p.RoutedSubnets)
+	if len(subnets) == 0 {
+		return false, fmt.Errorf("%w: site peer requires routed_subnets", ErrBadRequest)
+	}
+	used, err := s.usedSubnets(ctx, store, 0, iface.Name)
+	if err != nil {
+		return false, err
+	}
+	for _, sn := range subnets {
+		for _, u := range used {
+			if p.ID != 0 && u.PeerID == p.ID {
+				continue
+			}
+			if sn.Overlaps(u.Prefix) {
+				return false, fmt.Errorf("%w: routed subnet %s overlaps %s (%s)", ErrConflict, sn, u.Source, u.Prefix)
+			}
+		}
+	}
+	return true, nil
+}
+
+// serverAllowedIPs 是服务端配置 / 内核中该 peer 的 AllowedIPs：allowed_ips（默认隧道地址），
+// site 类型再加上 routed_subnets
+func serverAllowedIPs(p *models.WireGuardPeer) string {
+	allowed := strings.TrimSpace(p.AllowedIPs)
+	if allowed == "" {
+		allowed = hostCIDR(p.IP)
+	}
+	if p.Type != models.PeerTypeSite {
+		return allowed
+	}
+	list := splitCSV(allowed)
+	for _, sn := range splitCSV(p.RoutedSubnets) {
+		if !slices.Contains(list, sn) {
+			list = append(list, sn)
+		}
+	}
+	return strings.Join(list, ", ")
+}
+
+// siteRoutes 汇总接口上需要内核路由的网段（启用的 site peer 的 routed_subnets）
+func siteRoutes(peers []models.WireGuardPeer) []netip.Prefix {
+	var out []netip.Prefix
+	for _, p := range peers {
+		if p.Type != models.PeerTypeSite || p.Disabled || strings.TrimSpace(p.PublicKey) == "" {
+			continue
+		}
+		ps, _ := cidrset.Parse(p.RoutedSubnets)
+		out = append(out, ps...)
+	}
+	return out
+}
+
+// clientTunnelCIDRs 是客户端配置默认走隧道的网段：接口网段；site peer 另加本端局域网，
+// 使对端站点把发往本端 LAN 的流量送进隧道
+func clientTunnelCIDRs(it *models.WireGuardInterface, fams []addrFamily, p *models.WireGuardPeer) string {
+	nets := make([]string, 0, len(fams))
+	for _, f := range fams {
+		nets = append(nets, f.Prefix.String())
+	}
+	if p.Type == models.PeerTypeSite {
+		nets = append(nets, splitCSV(it.LocalSubnets)...)
+	}
+	return strings.Join(nets, ", ")
+}
@@ -0,0 +1,998 @@
+package services
+
+import (
+	"backend/models"
+	"backend/repository"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+/* -------------------- 声明式状态文档 --------------------
+ * 以接口名标识接口、以公钥（缺省时退回名称）标识 peer，路由模板、地址池按名称标识；
+ * 私钥与预共享密钥从不导出，新建时由服务端生成。
+ */
+
+const stateVersion = 1
+
+type StateDocument struct {
+	Version int `json:"version" yaml:"version"`
+	// RoutingProfiles 整体管理：文档中没有的模板会被删除
+	RoutingProfiles []StateRoutingProfile `json:"routing_profiles,omitempty" yaml:"routing_profiles,omitempty"`
+	Interfaces      []StateInterface      `json:"interfaces" yaml:"interfaces"`
+}
+
+type StateRoutingProfile struct {
+	Name        string `json:"name" yaml:"name"`
+	Kind        string `json:"kind" yaml:"kind"`
+	Routes      string `json:"routes,omitempty" yaml:"routes,omitempty"`
+	Excluded    string `json:"excluded,omitempty" yaml:"excluded,omitempty"`
+	Description string `json:"description,omitempty" yaml:"description,omitempty"`
+}
+
+type StateInterface struct {
+	Name string `json:"name" yaml:"name"`
+	// Mode 为 server（默认）或 client；客户端模式接口不能声明 peers，远端（/remote）不在文档中管理
+	Mode         string `json:"mode,omitempty" yaml:"mode,omitempty"`
+	Address      string `json:"address" yaml:"address"`
+	ListenPort   int    `json:"listen_port,omitempty" yaml:"listen_port,omitempty"`
+	DNS          string `json:"dns,omitempty" yaml:"dns,omitempty"`
+	MTU          int    `json:"mtu,omitempty" yaml:"mtu,omitempty"`
+	Endpoint     string `json:"endpoint,omitempty" yaml:"endpoint,omitempty"`
+	LocalSubnets string `json:"local_subnets,omitempty" yaml:"local_subnets,omitempty"`
+	PreUp        string `json:"pre_up,omitempty" yaml:"pre_up,omitempty"`
+	PostUp       string `json:"post_up,omitempty" yaml:"post_up,omitempty"`
+	PreDown      string `json:"pre_down,omitempty" yaml:"pre_down,omitempty"`
+	PostDown     string `json:"post_down,omitempty" yaml:"post_down,omitempty"`
+	// PublicKey 仅供参考，apply 时不会修改接口密钥
+	PublicKey string `json:"public_key,omitempty" yaml:"public_key,omitempty"`
+	// Gateway 为空表示默认设置（不做 NAT，转发与 ACL 默认放行）
+	Gateway      *StateGateway      `json:"gateway,omitempty" yaml:"gateway,omitempty"`
+	Pools        []StatePool        `json:"pools,omitempty" yaml:"pools,omitempty"`
+	Reservations []StateReservation `json:"reservations,omitempty" yaml:"reservations,omitempty"`
+	ACL          []StateACLRule     `json:"acl,omitempty" yaml:"acl,omitempty"`
+	Peers        []StatePeer        `json:"peers" yaml:"peers"`
+}
+
+type StateGateway struct {
+	Masquerade      bool   `json:"masquerade,omitempty" yaml:"masquerade,omitempty"`
+	EgressInterface string `json:"egress_interface,omitempty" yaml:"egress_interface,omitempty"`
+	LANForward      string `json:"lan_forward,omitempty" yaml:"lan_forward,omitempty"`
+	LANCIDRs        string `json:"lan_cidrs,omitempty" yaml:"lan_cidrs,omitempty"`
+	ACLDefault      string `json:"acl_default,omitempty" yaml:"acl_default,omitempty"`
+}
+
+type StatePool struct {
+	Name        string `json:"name" yaml:"name"`
+	Ranges      string `json:"ranges" yaml:"ranges"`
+	Description string `json:"description,omitempty" yaml:"description,omitempty"`
+}
+
+// StateReservation 以 addresses 标识
+type StateReservation struct {
+	Addresses string `json:"addresses" yaml:"addresses"`
+	Note      string `json:"note,omitempty" yaml:"note,omitempty"`
+}
+
+// StateACLRule 按名称引用本接口的 peer 或分组；两者都为空表示接口下全部 peer
+type StateACLRule struct {
+	Peer         string `json:"peer,omitempty" yaml:"peer,omitempty"`
+	Group        string `json:"group,omitempty" yaml:"group,omitempty"`
+	Action       string `json:"action,omitempty" yaml:"action,omitempty"`
+	Destinations string `json:"destinations,omitempty" yaml:"destinations,omitempty"`
+	Protocol     string `json:"protocol,omitempty" yaml:"protocol,omitempty"`
+	Ports        string `json:"ports,omitempty" yaml:"ports,omitempty"`
+	Priority     int    `json:"priority,omitempty" yaml:"priority,omitempty"`
+	Description  string `json:"description,omitempty" yaml:"description,omitempty"`
+}
+
+type StatePeer struct {
+	Name                string `json:"name" yaml:"name"`
+	PublicKey           string `json:"public_key,omitempty" yaml:"public_key,omitempty"`
+	IP                  string `json:"ip,omitempty" yaml:"ip,omitempty"`
+	AllowedIPs          string `json:"allowed_ips,omitempty" yaml:"allowed_ips,omitempty"`
+	Endpoint            string `json:"endpoint,omitempty" yaml:"endpoint,omitempty"`
+	PersistentKeepalive int    `json:"persistent_keepalive,omitempty" yaml:"persistent_keepalive,omitempty"`
+	ClientAllowedIPs    string `json:"client_allowed_ips,omitempty" yaml:"client_allowed_ips,omitempty"`
+	ExcludedIPs         string `json:"excluded_ips,omitempty" yaml:"excluded_ips,omitempty"`
+	// RoutingProfile 按名称引用文档 routing_profiles 中的模板
+	RoutingProfile string `json:"routing_profile,omitempty" yaml:"routing_profile,omitempty"`
+	Type           string `json:"type,omitempty" yaml:"type,omitempty"` // client（默认）| site
+	RoutedSubnets  string `json:"routed_subnets,omitempty" yaml:"routed_subnets,omitempty"`
+	Disabled       bool   `json:"disabled,omitempty" yaml:"disabled,omitempty"`
+	// Groups 整体替换所属分组，不存在的分组自动创建
+	Groups []string `json:"groups,omitempty" yaml:"groups,omitempty"`
+}
+
+type StateChange struct {
+	Action    string   `json:"action"` // create | update | delete
+	Kind      string   `json:"kind"`   // routing_profile | interface | gateway | pool | reservation | peer | acl
+	Interface string   `json:"interface,omitempty"`
+	Name      string   `json:"name,omitempty"` // 接口以外对象的名称
+	Fields    []string `json:"fields,omitempty"`
+}
+
+type StatePlan struct {
+	Changes  []StateChange `json:"changes"`
+	Warnings []string      `json:"warnings,omitempty"`
+	Create   int           `json:"create"`
+	Update   int           `json:"update"`
+	Delete   int           `json:"delete"`
+	// 已应用到内核的接口（仅 apply 返回）
+	Applied []string `json:"applied,omitempty"`
+	Errors  []string `json:"errors,omitempty"`
+}
+
+func (p *StatePlan) add(c StateChange) {
+	p.Changes = append(p.Changes, c)
+	switch c.Action {
+	case "create":
+		p.Create++
+	case "update":
+		p.Update++
+	case "delete":
+		p.Delete++
+	}
+}
+
+type StateService struct {
+	store repository.Store
+	wg    *WireGuardService
+}
+
+func NewStateService(store repository.Store, wg *WireGuardService) *StateService {
+	return &StateService{store: store, wg: wg}
+}
+
+/* -------------------- 编解码 -------------------- */
+
+// ParseStateDocument 解析 YAML 或 JSON（JSON 是 YAML 的子集），拒绝未知字段
+func ParseStateDocument(r io.Reader) (*StateDocument, error) {
+	dec := yaml.NewDecoder(r)
+	dec.KnownFields(true)
+	var doc StateDocument
+	if err := dec.Decode(&doc); err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil, fmt.Errorf("%w: empty state document", ErrBadRequest)
+		}
+		return nil, fmt.Errorf("%w: invalid state document: %v", ErrBadRequest, err)
+	}
+	if doc.Version != stateVersion {
+		return nil, fmt.Errorf("%w: unsupported state version %d", ErrBadRequest, doc.Version)
+	}
+	return &doc, nil
+}
+
+// EncodeStateDocument 以 yaml 或 json 输出
+func EncodeStateDocument(w io.Writer, doc *StateDocument, format string) error {
+	switch format {
+	case "", "yaml", "yml":
+		enc := yaml.NewEncoder(w)
+		enc.SetIndent(2)
+		if err := enc.Encode(doc); err != nil {
+			return err
+		}
+		return enc.Close()
+	case "json":
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(doc)
+	}
+	return fmt.Errorf("%w: unsupported format %q", ErrBadRequest, format)
+}
+
+/* -------------------- 导出 -------------------- */
+
+func (s *StateService) Export(ctx context.Context) (*StateDocument, error) {
+	doc := &StateDocument{Version: stateVersion, Interfaces: []StateInterface{}}
+	err := s.store.WithTx(ctx, func(tx repository.Store) error {
+		ifaces, err := tx.Interfaces().List(ctx)
+		if err != nil {
+			return err
+		}
+		sort.Slice(ifaces, func(i, j int) bool { return ifaces[i].Name < ifaces[j].Name })
+		profiles, err := tx.RoutingProfiles().List(ctx)
+		if err != nil {
+			return err
+		}
+		sort.Slice(profiles, func(i, j int) bool { return profiles[i].Name < profiles[j].Name })
+		profileNames := make(map[int]string, len(profiles))
+		for _, rp := range profiles {
+			profileNames[rp.ID] = rp.Name
+			doc.RoutingProfiles = append(doc.RoutingProfiles, StateRoutingProfile{
+				Name:        rp.Name,
+				Kind:        rp.Kind,
+				Routes:      rp.Routes,
+				Excluded:    rp.Excluded,
+				Description: rp.Description,
+			})
+		}
+		groups, err := tx.PeerGroups().Memberships(ctx)
+		if err != nil {
+			return err
+		}
+		for _, it := range ifaces {
+			si, err := exportInterface(ctx, tx, &it, profileNames, groups)
+			if err != nil {
+				return err
+			}
+			doc.Interfaces = append(doc.Interfaces, *si)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return doc, nil
+}
+
+func exportInterface(ctx context.Context, tx repository.Store, it *models.WireGuardInterface,
+	profileNames map[int]string, groups map[int][]string) (*StateInterface, error) {
+	si := &StateInterface{
+		Name:         it.Name,
+		Mode:         it.Mode,
+		Address:      it.Address,
+		ListenPort:   it.ListenPort,
+		DNS:          it.DNS,
+		MTU:          it.MTU,
+		Endpoint:     it.Endpoint,
+		LocalSubnets: it.LocalSubnets,
+		PreUp:        it.PreUp,
+		PostUp:       it.PostUp,
+		PreDown:      it.PreDown,
+		PostDown:     it.PostDown,
+		PublicKey:    it.PublicKey,
+		Peers:        []StatePeer{},
+	}
+
+	g, err := tx.Gateways().Get(ctx, it.ID)
+	switch {
+	case err == nil:
+		if sg := stateGatewayOf(g); *sg != (StateGateway{}) {
+			si.Gateway = sg
+		}
+	case !errors.Is(err, repository.ErrNotFound):
+		return nil, err
+	}
+
+	pools, err := tx.IPAM().ListPools(ctx, it.ID)
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(pools, func(i, j int) bool { return pools[i].Name < pools[j].Name })
+	for _, p := range pools {
+		si.Pools = append(si.Pools, StatePool{Name: p.Name, Ranges: p.Ranges, Description: p.Description})
+	}
+	rs, err := tx.IPAM().ListReservations(ctx, it.ID)
+	if err != nil {
+		return nil, err
+	}
+	for _, r := range rs {
+		si.Reservations = append(si.Reservations, StateReservation{Addresses: r.Addresses, Note: r.Note})
+	}
+
+	peers, err := tx.Peers().ListByInterface(ctx, it.ID)
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(peers, func(i, j int) bool { return peers[i].Name < peers[j].Name })
+	peerNames := make(map[int]string, len(peers))
+	for _, p := range peers {
+		peerNames[p.ID] = p.Name
+		sp := StatePeer{
+			Name:                p.Name,
+			PublicKey:           p.PublicKey,
+			IP:                  p.IP,
+			AllowedIPs:          p.AllowedIPs,
+			Endpoint:            p.Endpoint,
+			PersistentKeepalive: p.PersistentKeepalive,
+			ClientAllowedIPs:    p.ClientAllowedIPs,
+			ExcludedIPs:         p.ExcludedIPs,
+			Type:                p.Type,
+			RoutedSubnets:       p.RoutedSubnets,
+			Disabled:            p.Disabled,
+			Groups:              groups[p.ID],
+		}
+		if sp.Type == models.PeerTypeClient {
+			sp.Type = ""
+		}
+		if p.RoutingProfileID != nil {
+			sp.RoutingProfile = profileNames[*p.RoutingProfileID]
+		}
+		si.Peers = append(si.Peers, sp)
+	}
+
+	rules, err := tx.ACLs().List(ctx, it.ID)
+	if err != nil {
+		return nil, err
+	}
+	for _, r := range rules {
+		sr, err := stateACLRuleOf(ctx, tx, &r, peerNames)
+		if err != nil {
+			return nil, err
+		}
+		si.ACL = append(si.ACL, *sr)
+	}
+	return si, nil
+}
+
+/* -------------------- plan / apply -------------------- */
+
+// Plan 只计算差异，不写库
+func (s *StateService) Plan(ctx context.Context, doc *StateDocument) (*StatePlan, error) {
+	plan, _, err := s.dryRun(ctx, doc)
+	return plan, err
+}
+
+func (s *StateService) dryRun(ctx context.Context, doc *StateDocument) (*StatePlan, *stateEffects, error) {
+	var plan *StatePlan
+	var fx *stateEffects
+	err := s.store.WithTx(ctx, func(tx repository.Store) error {
+		var err error
+		plan, fx, err = s.reconcile(ctx, tx, doc, true)
+		return err
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return plan, fx, nil
+}
+
+// Apply 在单个事务内把库调整为文档描述的状态，提交后重新下发受影响且在运行的接口。
+// 要删除的接口与切换模式的运行中接口在提交前经 StopInterface 停止（执行 PreDown/PostDown、
+// 移除防火墙规则与客户端路由，这些都依赖库中的旧配置），与 DeleteInterface 的顺序一致；
+// 事务失败时库未改变，把停掉的运行中接口重新启动
+func (s *StateService) Apply(ctx context.Context, doc *StateDocument) (*StatePlan, error) {
+	// 先完整校验一遍，避免为一份无法应用的文档停掉接口
+	_, pre, err := s.dryRun(ctx, doc)
+	if err != nil {
+		return nil, err
+	}
+	var stopped []int // 停止前在运行的接口
+	for _, it := range pre.removed {
+		if it.Status == "running" {
+			stopped = append(stopped, it.ID)
+		}
+		_ = s.wg.StopInterface(it.ID)
+	}
+	for _, id := range pre.restart {
+		stopped = append(stopped, id)
+		_ = s.wg.StopInterface(id)
+	}
+
+	var plan *StatePlan
+	var fx *stateEffects
+	err = s.store.WithTx(ctx, func(tx repository.Store) error {
+		var err error
+		plan, fx, err = s.reconcile(ctx, tx, doc, false)
+		return err
+	})
+	if err != nil {
+		err = mapRepoErr(err, "interface name, listen port or peer ip")
+		for _, id := range stopped {
+			if serr := s.wg.StartInterface(id); serr != nil {
+				err = fmt.Errorf("%w; restart interface %d: %v", err, id, serr)
+			}
+		}
+		return nil, err
+	}
+
+	// 被删除的接口：清理残留链路与 .conf
+	for _, it := range fx.removed {
+		_ = ipLinkDel(it.Name)
+		s.wg.removeConfFile(it.Name)
+	}
+	// 切换了模式的接口：提交前已停止，按新模式重新启动
+	for _, id := range fx.restart {
+		s.wg.syncConfFile(id)
+		it, err := s.wg.GetInterface(id)
+		if err != nil {
+			continue
+		}
+		if err := s.wg.StartInterface(id); err != nil {
+			plan.Errors = append(plan.Errors, fmt.Sprintf("start %s: %v", it.Name, err))
+			continue
+		}
+		plan.Applied = append(plan.Applied, it.Name)
+	}
+	// 有变更且在运行的接口：整体重新下发
+	for _, id := range fx.touched {
+		if slices.Contains(fx.restart, id) {
+			continue
+		}
+		s.wg.syncConfFile(id)
+		it, err := s.wg.GetInterface(id)
+		if err != nil || it.Status != "running" {
+			continue
+		}
+		if err := s.wg.ApplyInterfaceConfig(id); err != nil {
+			plan.Errors = append(plan.Errors, fmt.Sprintf("apply %s: %v", it.Name, err))
+			continue
+		}
+		plan.Applied = append(plan.Applied, it.Name)
+	}
+	return plan, nil
+}
+
+// 提交后需要对内核执行的动作；dryRun 时同样填写，供 Apply 在提交前停止接口
+type stateEffects struct {
+	touched []int                       // 有变更的接口 ID
+	removed []models.WireGuardInterface // 被删除的接口
+	restart []int                       // 切换了模式的运行中接口
+}
+
+func normalizeStateInterface(si *StateInterface) error {
+	si.Name = strings.TrimSpace(si.Name)
+	si.Address = strings.TrimSpace(si.Address)
+	si.DNS = strings.TrimSpace(si.DNS)
+	si.PublicKey = strings.TrimSpace(si.PublicKey)
+	if si.Name == "" {
+		return fmt.Errorf("%w: interface name is required", ErrBadRequest)
+	}
+	if err := checkInterfaceName(si.Name); err != nil {
+		return err
+	}
+	var it models.WireGuardInterface
+	if err := applyInterfaceSite(&it, models.InterfaceSite{
+		Mode: &si.Mode, Endpoint: &si.Endpoint, LocalSubnets: &si.LocalSubnets,
+	}); err != nil {
+		return fmt.Errorf("interface %s: %w", si.Name, err)
+	}
+	si.Mode, si.Endpoint, si.LocalSubnets = it.Mode, it.Endpoint, it.LocalSubnets
+	if _, err := applyHooks(&it, models.InterfaceHooks{
+		PreUp: &si.PreUp, PostUp: &si.PostUp, PreDown: &si.PreDown, PostDown: &si.PostDown,
+	}); err != nil {
+		return fmt.Errorf("interface %s: %w", si.Name, err)
+	}
+	si.PreUp, si.PostUp, si.PreDown, si.PostDown = it.PreUp, it.PostUp, it.PreDown, it.PostDown
+	// 客户端模式可不监听固定端口（0 表示由内核随机选择）
+	if si.ListenPort < 0 || si.ListenPort > 65535 || (si.ListenPort == 0 && si.Mode != models.InterfaceModeClient) {
+		return fmt.Errorf("%w: interface %s: invalid listen_port %d", ErrBadRequest, si.Name, si.ListenPort)
+	}
+	if _, _, err := deriveCIDR(si.Address); err != nil {
+		return fmt.Errorf("interface %s: %w", si.Name, err)
+	}
+	// 与 CreateInterface 的默认值保持一致，避免无意义的 diff
+	if si.DNS == "" {
+		si.DNS = "8.8.8.8"
+	}
+	if si.MTU == 0 {
+		si.MTU = 1420
+	}
+	return nil
+}
+
+func normalizeStatePeer(iface string, sp *StatePeer, fams []addrFamily) error {
+	sp.Name = strings.TrimSpace(sp.Name)
+	sp.PublicKey = strings.TrimSpace(sp.PublicKey)
+	sp.IP = strings.TrimSpace(sp.IP)
+	sp.AllowedIPs = strings.TrimSpace(sp.AllowedIPs)
+	sp.Endpoint = strings.TrimSpace(sp.Endpoint)
+	sp.RoutingProfile = strings.TrimSpace(sp.RoutingProfile)
+	if sp.Name == "" {
+		return fmt.Errorf("%w: interface %s: peer name is required", ErrBadRequest, iface)
+	}
+	if sp.PublicKey != "" {
+		if _, err := parseWGPublicKey(sp.PublicKey); err != nil {
+			return fmt.Errorf("%w: peer %s/%s: %v", ErrBadRequest, iface, sp.Name, err)
+		}
+	}
+	if sp.IP != "" {
+		have, err := fitPeerIP(fams, sp.IP)
+		if err != nil {
+			return fmt.Errorf("%w: peer %s/%s: %v", ErrBadRequest, iface, sp.Name, err)
+		}
+		var ips []string
+		for _, a := range have {
+			if a.IsValid() {
+				ips = append(ips, a.String())
+			}
+		}
+		sp.IP = strings.Join(ips, ", ")
+	}
+	if sp.AllowedIPs != "" {
+		if err := validateServerAllowedIPs(sp.AllowedIPs); err != nil {
+			return fmt.Errorf("peer %s/%s: %w", iface, sp.Name, err)
+		}
+	}
+	client, err := normalizeClientAllowedIPs(sp.ClientAllowedIPs)
+	if err != nil {
+		return fmt.Errorf("peer %s/%s: %w", iface, sp.Name, err)
+	}
+	sp.ClientAllowedIPs = client
+	excluded, err := normalizeExcludedIPs(sp.ExcludedIPs)
+	if err != nil {
+		return fmt.Errorf("peer %s/%s: %w", iface, sp.Name, err)
+	}
+	sp.ExcludedIPs = excluded
+	if sp.Endpoint != "" {
+		if _, err := parseEndpoint(sp.Endpoint); err != nil {
+			return fmt.Errorf("%w: peer %s/%s: %v", ErrBadRequest, iface, sp.Name, err)
+		}
+	}
+	if sp.PersistentKeepalive == 0 {
+		sp.PersistentKeepalive = 25
+	}
+	var groups []string
+	for _, g := range sp.Groups {
+		name, err := normalizeGroupName(g)
+		if err != nil {
+			return fmt.Errorf("peer %s/%s: %w", iface, sp.Name, err)
+		}
+		if !slices.Contains(groups, name) {
+			groups = append(groups, name)
+		}
+	}
+	sort.Strings(groups)
+	sp.Groups = groups
+	return nil
+}
+
+// reconcile 计算并（dryRun=false 时）执行把 tx 中的状态变为 doc 所需的变更
+func (s *StateService) reconcile(ctx context.Context, tx repository.Store, doc *StateDocument, dryRun bool) (*StatePlan, *stateEffects, error) {
+	plan := &StatePlan{Changes: []StateChange{}}
+	fx := &stateEffects{}
+
+	// 0) 文档自身校验
+	names := map[string]bool{}
+	ports := map[int]string{}
+	for i := range doc.Interfaces {
+		si := &doc.Interfaces[i]
+		if err := normalizeStateInterface(si); err != nil {
+			return nil, nil, err
+		}
+		if names[si.Name] {
+			return nil, nil, fmt.Errorf("%w: duplicate interface %s", ErrBadRequest, si.Name)
+		}
+		names[si.Name] = true
+		if si.ListenPort == 0 {
+			continue
+		}
+		if other, ok := ports[si.ListenPort]; ok {
+			return nil, nil, fmt.Errorf("%w: interfaces %s and %s share listen_port %d", ErrBadRequest, other, si.Name, si.ListenPort)
+		}
+		ports[si.ListenPort] = si.Name
+	}
+
+	// 1) 路由模板先于 peer，peer 按名称引用
+	profiles, err := s.reconcileRoutingProfiles(ctx, tx, plan, doc.RoutingProfiles, dryRun)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	current, err := tx.Interfaces().List(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	sort.Slice(current, func(i, j int) bool { return current[i].Name < current[j].Name })
+	byName := make(map[string]*models.WireGuardInterface, len(current))
+	for i := range current {
+		byName[current[i].Name] = &current[i]
+	}
+
+	// 2) 先删除文档中不存在的接口，释放名称与端口
+	for _, it := range current {
+		if names[it.Name] {
+			continue
+		}
+		plan.add(StateChange{Action: "delete", Kind: "interface", Interface: it.Name})
+		fx.removed = append(fx.removed, it)
+		if !dryRun {
+			if err := tx.Interfaces().Delete(ctx, it.ID); err != nil {
+				return nil, nil, err
+			}
+		}
+	}
+
+	groups, err := tx.PeerGroups().Memberships(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// 3) 逐个接口创建/更新，再依次对比网关、地址池与保留地址、peers、ACL
+	for i := range doc.Interfaces {
+		si := &doc.Interfaces[i]
+		cidr, serverIP, _ := deriveCIDR(si.Address)
+		fams, _ := parseInterfaceAddress(si.Address)
+
+		cur, exists := byName[si.Name]
+		if !exists {
+			plan.add(StateChange{Action: "create", Kind: "interface", Interface: si.Name})
+			if si.PublicKey != "" {
+				plan.Warnings = append(plan.Warnings,
+					fmt.Sprintf("interface %s: public_key is ignored, a new key pair will be generated", si.Name))
+			}
+			cur = &models.WireGuardInterface{Name: si.Name, Mode: models.InterfaceModeServer, Status: "stopped"}
+		} else if si.PublicKey != "" && si.PublicKey != cur.PublicKey {
+			plan.Warnings = append(plan.Warnings,
+				fmt.Sprintf("interface %s: public_key differs from the stored key and is ignored", si.Name))
+		}
+
+		it := *cur
+		it.Mode, it.Endpoint, it.LocalSubnets = si.Mode, si.Endpoint, si.LocalSubnets
+		it.Address, it.ListenPort, it.DNS, it.MTU = si.Address, si.ListenPort, si.DNS, si.MTU
+		it.PreUp, it.PostUp, it.PreDown, it.PostDown = si.PreUp, si.PostUp, si.PreDown, si.PostDown
+		it.CIDR, it.ServerIP = cidr, serverIP
+
+		var fields []string
+		for _, f := range []struct {
+			name     string
+			old, new any
+		}{
+			{"mode", cur.Mode, it.Mode},
+			{"address", cur.Address, it.Address},
+			{"listen_port", cur.ListenPort, it.ListenPort},
+			{"dns", cur.DNS, it.DNS},
+			{"mtu", cur.MTU, it.MTU},
+			{"endpoint", cur.Endpoint, it.Endpoint},
+			{"local_subnets", cur.LocalSubnets, it.LocalSubnets},
+			{"pre_up", cur.PreUp, it.PreUp},
+			{"post_up", cur.PostUp, it.PostUp},
+			{"pre_down", cur.PreDown, it.PreDown},
+			{"post_down", cur.PostDown, it.PostDown},
+		} {
+			if f.old != f.new {
+				fields = append(fields, f.name)
+			}
+		}
+		if slices.Contains(fields, "address") {
+			if err := s.wg.checkSubnetConflicts(ctx, tx, it.ID, it.Name, fams); err != nil {
+				return nil, nil, fmt.Errorf("interface %s: %w", si.Name, err)
+			}
+		}
+		if slices.Contains(fields, "local_subnets") {
+			if err := checkLocalSubnets(ctx, tx, &it); err != nil {
+				return nil, nil, fmt.Errorf("interface %s: %w", si.Name, err)
+			}
+		}
+		modeChanged := exists && cur.Mode != it.Mode
+		if exists && len(fields) > 0 {
+			plan.add(StateChange{Action: "update", Kind: "interface", Interface: si.Name, Fields: fields})
+		}
+		if modeChanged && cur.Status == "running" {
+			fx.restart = append(fx.restart, it.ID)
+		}
+		if !dryRun && modeChanged && it.Mode == models.InterfaceModeServer {
+			// 改回服务端模式：丢弃远端配置（改为客户端模式时，peers 已由 checkPeerHost 保证为空并在下面删除）
+			if err := tx.Remotes().Delete(ctx, it.ID); err != nil {
+				return nil, nil, err
+			}
+		}
+		if !dryRun && !exists {
+			priv, pub, err := s.wg.GenerateKeyPair()
+			if err != nil {
+				return nil, nil, err
+			}
+			it.PrivateKey, it.PublicKey = priv, pub
+			if err := tx.Interfaces().Create(ctx, &it); err != nil {
+				return nil, nil, err
+			}
+		} else if !dryRun && len(fields) > 0 {
+			if err := tx.Interfaces().Update(ctx, &it); err != nil {
+				return nil, nil, err
+			}
+		}
+
+		n, err := s.reconcileGateway(ctx, tx, plan, &it, exists, si, dryRun)
+		if err != nil {
+			return nil, nil, err
+		}
+		// 地址池与保留地址先于 peers，新分配的地址才会避开它们
+		if err := s.reconcileIPAM(ctx, tx, plan, &it, exists, si, fams, dryRun); err != nil {
+			return nil, nil, err
+		}
+		peerIDs, c, err := s.reconcilePeers(ctx, tx, plan, &it, exists, si, fams, profiles, groups, dryRun)
+		if err != nil {
+			return nil, nil, err
+		}
+		n += c
+		if c, err = s.reconcileACL(ctx, tx, plan, &it, exists, si, peerIDs, dryRun); err != nil {
+			return nil, nil, err
+		}
+		n += c
+		if !dryRun && (!exists || len(fields) > 0 || n > 0) {
+			fx.touched = append(fx.touched, it.ID)
+		}
+	}
+	return plan, fx, nil
+}
+
+// reconcilePeers 对比单个接口下的 peers，返回文档中 peer 名称到 ID 的映射（dryRun 时新 peer 为 0）与变更数
+func (s *StateService) reconcilePeers(
+	ctx context.Context, tx repository.Store, plan *StatePlan,
+	it *models.WireGuardInterface, exists bool, si *StateInterface,
+	fams []addrFamily, profiles map[string]int, groups map[int][]string, dryRun bool,
+) (map[string]int, int, error) {
+	if len(si.Peers) > 0 {
+		// 与 CreatePeer 一致：客户端模式接口不能有 peer
+		if err := checkPeerHost(it); err != nil {
+			return nil, 0, err
+		}
+	}
+
+	var current []models.WireGuardPeer
+	var err error
+	if exists {
+		if current, err = tx.Peers().ListByInterface(ctx, it.ID); err != nil {
+			return nil, 0, err
+		}
+	}
+
+	// 文档内校验：名称、公钥、IP 不可重复
+	seenName := map[string]bool{}
+	seenKey := map[string]bool{}
+	seenIP := map[string]bool{}
+	for i := range si.Peers {
+		sp := &si.Peers[i]
+		if err := normalizeStatePeer(si.Name, sp, fams); err != nil {
+			return nil, 0, err
+		}
+		if seenName[sp.Name] {
+			return nil, 0, fmt.Errorf("%w: interface %s: duplicate peer %s", ErrBadRequest, si.Name, sp.Name)
+		}
+		seenName[sp.Name] = true
+		if sp.PublicKey != "" {
+			if seenKey[sp.PublicKey] {
+				return nil, 0, fmt.Errorf("%w: interface %s: duplicate public_key on peer %s", ErrBadRequest, si.Name, sp.Name)
+			}
+			seenKey[sp.PublicKey] = true
+		}
+		for _, ip := range splitCSV(sp.IP) {
+			if seenIP[ip] {
+				return nil, 0, fmt.Errorf("%w: interface %s: duplicate ip %s", ErrBadRequest, si.Name, ip)
+			}
+			seenIP[ip] = true
+		}
+	}
+
+	// 路由模板按名称解析，只能引用文档中声明的模板
+	profileIDs := make([]*int, len(si.Peers))
+	for i, sp := range si.Peers {
+		if sp.RoutingProfile == "" {
+			continue
+		}
+		id, ok := profiles[sp.RoutingProfile]
+		if !ok {
+			return nil, 0, fmt.Errorf("%w: peer %s/%s: unknown routing profile %q", ErrBadRequest, si.Name, sp.Name, sp.RoutingProfile)
+		}
+		profileIDs[i] = &id
+	}
+
+	// 匹配：优先公钥，其次名称
+	matched := make([]*models.WireGuardPeer, len(si.Peers))
+	taken := map[int]bool{}
+	for i, sp := range si.Peers {
+		if sp.PublicKey == "" {
+			continue
+		}
+		for j := range current {
+			if !taken[current[j].ID] && current[j].PublicKey == sp.PublicKey {
+				matched[i] = &current[j]
+				taken[current[j].ID] = true
+				break
+			}
+		}
+	}
+	for i, sp := range si.Peers {
+		if matched[i] != nil {
+			continue
+		}
+		for j := range current {
+			if !taken[current[j].ID] && current[j].Name == sp.Name {
+				matched[i] = &current[j]
+				taken[current[j].ID] = true
+				break
+			}
+		}
+	}
+
+	ids := make(map[string]int, len(si.Peers))
+	changes := 0
+	// 1) 删除未匹配的 peer，释放 IP
+	for _, p := range current {
+		if taken[p.ID] {
+			continue
+		}
+		changes++
+		plan.add(StateChange{Action: "delete", Kind: "peer", Interface: si.Name, Name: p.Name})
+		if !dryRun {
+			if err := tx.Peers().Delete(ctx, p.ID); err != nil {
+				return nil, 0, err
+			}
+			if err := s.wg.quarantineIPs(ctx, tx, it.ID, p.Name, p.IP, ""); err != nil {
+				return nil, 0, err
+			}
+		}
+	}
+
+	// 已占用 IP：保留的 peer + 文档里显式指定的 IP（声明式文档优先，不受保留地址/隔离期限制）
+	view, err := s.wg.loadIPAMView(ctx, tx, it.ID, fams, nil)
+	if err != nil {
+		return nil, 0, err
+	}
+	for i, sp := range si.Peers {
+		switch {
+		case sp.IP != "":
+			markUsed(view.used, sp.IP)
+		case matched[i] != nil:
+			markUsed(view.used, fittingPeerIP(fams, matched[i].IP))
+		}
+	}
+
+	// 2) 更新已有 peer
+	for i, sp := range si.Peers {
+		p := matched[i]
+		if p == nil {
+			continue
+		}
+		ids[sp.Name] = p.ID
+		want := *p
+		want.Name = sp.Name
+		// 未指定 IP 时沿用仍有效的旧地址；接口换网段或新增地址族时为缺失的地址族分配
+		keep := sp.IP
+		if keep == "" {
+			keep = fittingPeerIP(fams, p.IP)
+		}
+		ip, err := view.assign("", keep)
+		if err != nil {
+			return nil, 0, fmt.Errorf("interface %s: peer %s: %w", si.Name, sp.Name, err)
+		}
+		want.IP = ip
+		want.AllowedIPs = sp.AllowedIPs
+		if want.AllowedIPs == "" || want.AllowedIPs == hostCIDR(keep) {
+			// 只有主机路由时视为默认值，跟随新分配的地址族
+			want.AllowedIPs = hostCIDR(want.IP)
+		}
+		want.Endpoint = sp.Endpoint
+		want.PersistentKeepalive = sp.PersistentKeepalive
+		want.ClientAllowedIPs = sp.ClientAllowedIPs
+		want.ExcludedIPs = sp.ExcludedIPs
+		want.RoutingProfileID = profileIDs[i]
+		want.Disabled = sp.Disabled
+		if _, err := s.wg.setPeerSite(ctx, tx, it, &want, &sp.Type, &sp.RoutedSubnets); err != nil {
+			return nil, 0, fmt.Errorf("peer %s/%s: %w", si.Name, sp.Name, err)
+		}
+		if sp.PublicKey != "" && sp.PublicKey != p.PublicKey {
+			// 换成客户端自持的公钥后，服务端保存的私钥不再对应
+			want.PublicKey = sp.PublicKey
+			if p.PrivateKey != "" && publicKeyOf(p.PrivateKey) != sp.PublicKey {
+				want.PrivateKey = ""
+			}
+		}
+
+		var fields []string
+		for _, f := range []struct {
+			name     string
+			old, new any
+		}{
+			{"name", p.Name, want.Name},
+			{"public_key", p.PublicKey, want.PublicKey},
+			{"ip", p.IP, want.IP},
+			{"allowed_ips", p.AllowedIPs, want.AllowedIPs},
+			{"endpoint", p.Endpoint, want.Endpoint},
+			{"persistent_keepalive", p.PersistentKeepalive, want.PersistentKeepalive},
+			{"client_allowed_ips", p.ClientAllowedIPs, want.ClientAllowedIPs},
+			{"excluded_ips", p.ExcludedIPs, want.ExcludedIPs},
+			{"type", p.Type, want.Type},
+			{"routed_subnets", p.RoutedSubnets, want.RoutedSubnets},
+			{"disabled", p.Disabled, want.Disabled},
+		} {
+			if f.old != f.new {
+				fields = append(fields, f.name)
+			}
+		}
+		if !sameIntPtr(want.RoutingProfileID, p.RoutingProfileID) {
+			fields = append(fields, "routing_profile")
+		}
+		groupsChanged := !slices.Equal(groups[p.ID], sp.Groups)
+		if groupsChanged {
+			fields = append(fields, "groups")
+		}
+		if len(fields) == 0 {
+			continue
+		}
+		changes++
+		plan.add(StateChange{Action: "update", Kind: "peer", Interface: si.Name, Name: sp.Name, Fields: fields})
+		if dryRun {
+			continue
+		}
+		if err := tx.Peers().Update(ctx, &want); err != nil {
+			return nil, 0, err
+		}
+		if err := s.wg.quarantineIPs(ctx, tx, it.ID, p.Name, p.IP, want.IP); err != nil {
+			return nil, 0, err
+		}
+		if groupsChanged {
+			if err := setStatePeerGroups(ctx, tx, want.ID, sp.Groups); err != nil {
+				return nil, 0, err
+			}
+		}
+	}
+
+	// 3) 创建新 peer
+	for i, sp := range si.Peers {
+		if matched[i] != nil {
+			continue
+		}
+		changes++
+		plan.add(StateChange{Action: "create", Kind: "peer", Interface: si.Name, Name: sp.Name})
+		p := &models.WireGuardPeer{
+			InterfaceID:         it.ID,
+			Name:                sp.Name,
+			AllowedIPs:          sp.AllowedIPs,
+			Endpoint:            sp.Endpoint,
+			PersistentKeepalive: sp.PersistentKeepalive,
+			ClientAllowedIPs:    sp.ClientAllowedIPs,
+			ExcludedIPs:         sp.ExcludedIPs,
+			RoutingProfileID:    profileIDs[i],
+			PublicKey:           sp.PublicKey,
+			Disabled:            sp.Disabled,
+		}
+		if _, err := s.wg.setPeerSite(ctx, tx, it, p, &sp.Type, &sp.RoutedSubnets); err != nil {
+			return nil, 0, fmt.Errorf("peer %s/%s: %w", si.Name, sp.Name, err)
+		}
+		ids[sp.Name] = 0
+		if dryRun {
+			continue
+		}
+		ip, err := view.assign("", sp.IP)
+		if err != nil {
+			return nil, 0, fmt.Errorf("interface %s: peer %s: %w", si.Name, sp.Name, err)
+		}
+		p.IP = ip
+		if p.AllowedIPs == "" || p.AllowedIPs == hostCIDR(sp.IP) {
+			p.AllowedIPs = hostCIDR(ip)
+		}
+		if p.PublicKey == "" {
+			priv, pub, err := s.wg.GenerateKeyPair()
+			if err != nil {
+				return nil, 0, err
+			}
+			p.PrivateKey, p.PublicKey = priv, pub
+		}
+		if err := tx.Peers().Create(ctx, p); err != nil {
+			return nil, 0, err
+		}
+		if err := setStatePeerGroups(ctx, tx, p.ID, sp.Groups); err != nil {
+			return nil, 0, err
+		}
+		ids[sp.Name] = p.ID
+	}
+
+	if err := checkStateReservations(ctx, tx, it, si, dryRun); err != nil {
+		return nil, 0, err
+	}
+	return ids, changes, nil
+}
+
+// setStatePeerGroups 整体替换 peer 的分组，不存在的分组自动创建
+func setStatePeerGroups(ctx context.Context, tx repository.Store, peerID int, names []string) error {
+	ids, err := resolvePeerGroups(ctx, tx, names)
+	if err != nil {
+		return err
+	}
+	return tx.PeerGroups().SetPeerGroups(ctx, peerID, ids)
+}
+
+func sameIntPtr(a, b *int) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
+// publicKeyOf 由私钥派生公钥；私钥非法时返回空串
+func publicKeyOf(privateKey string) string {
+	k, err := parseWGPrivateKey(privateKey)
+	if err != nil {
+		return ""
+	}
+	return k.PublicKey().String()
+}
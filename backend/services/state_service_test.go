@@ -0,0 +1,354 @@
+package services
+
+import (
+	"backend/repository"
+	"bytes"
+	"context"
+	"errors"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// newTestService 使用内存仓储，不管理防火墙与网络、不执行 hook；
+// 删除接口时仍会对 ip 命令调用 link del，测试中的接口名因此避开常见名称
+func newTestService(t *testing.T) *WireGuardService {
+	t.Helper()
+	wg := NewWireGuardServiceWithStore(repository.NewMemoryStore())
+	wg.SetFirewall(nil)
+	wg.SetNetworkBackend(nil)
+	wg.SetHooks(false, 0)
+	t.Cleanup(func() { wg.Close() })
+	return wg
+}
+
+func newTestStateService(t *testing.T) *StateService {
+	t.Helper()
+	wg := newTestService(t)
+	return NewStateService(wg.store, wg)
+}
+
+const testStateYAML = `
+version: 1
+routing_profiles:
+  - name: office
+    kind: split
+    routes: 192.168.10.0/24
+  - name: lan-out
+    kind: full_except_lan
+    excluded: 10.0.0.0/8
+interfaces:
+  - name: wgstate0
+    address: 10.8.0.1/24
+    listen_port: 51820
+    endpoint: vpn.example.com
+    local_subnets: 192.168.50.0/24
+    post_up: |
+      echo up %i
+    gateway:
+      masquerade: true
+      egress_interface: eth0
+      acl_default: deny
+    pools:
+      - name: laptops
+        ranges: 10.8.0.10-10.8.0.49
+    reservations:
+      - addresses: 10.8.0.200-10.8.0.210
+        note: printers
+    acl:
+      - peer: alice
+        action: allow
+        destinations: 192.168.50.0/24
+        protocol: tcp
+        ports: 22, 443
+        priority: 10
+      - group: ops
+        destinations: 0.0.0.0/0
+        priority: 20
+    peers:
+      - name: alice
+        ip: 10.8.0.2
+        routing_profile: office
+        groups: [ops, laptops]
+      - name: branch
+        ip: 10.8.0.3
+        type: site
+        routed_subnets: 192.168.60.0/24
+      - name: old
+        disabled: true
+  - name: wgstate1
+    mode: client
+    address: 10.9.0.2/32
+`
+
+func parseTestState(t *testing.T, s string) *StateDocument {
+	t.Helper()
+	doc, err := ParseStateDocument(strings.NewReader(s))
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	return doc
+}
+
+// exportRoundTrip 导出并经 YAML 编解码，得到与用户手里的文件相同的文档
+func exportRoundTrip(t *testing.T, svc *StateService) *StateDocument {
+	t.Helper()
+	doc, err := svc.Export(context.Background())
+	if err != nil {
+		t.Fatalf("export: %v", err)
+	}
+	var buf bytes.Buffer
+	if err := EncodeStateDocument(&buf, doc, "yaml"); err != nil {
+		t.Fatalf("encode: %v", err)
+	}
+	return parseTestState(t, buf.String())
+}
+
+func TestStateRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	svc := newTestStateService(t)
+
+	plan, err := svc.Apply(ctx, parseTestState(t, testStateYAML))
+	if err != nil {
+		t.Fatalf("apply: %v", err)
+	}
+	if plan.Create == 0 || plan.Update != 0 || plan.Delete != 0 {
+		t.Fatalf("first apply: got create=%d update=%d delete=%d", plan.Create, plan.Update, plan.Delete)
+	}
+
+	got := exportRoundTrip(t, svc)
+	if len(got.RoutingProfiles) != 2 || len(got.Interfaces) != 2 {
+		t.Fatalf("export: %d profiles, %d interfaces", len(got.RoutingProfiles), len(got.Interfaces))
+	}
+	wgstate0 := got.Interfaces[0]
+	checks := []struct {
+		name      string
+		got, want any
+	}{
+		{"endpoint", wgstate0.Endpoint, "vpn.example.com"},
+		{"local_subnets", wgstate0.LocalSubnets, "192.168.50.0/24"},
+		{"post_up", wgstate0.PostUp, "echo up %i"},
+		{"gateway", *wgstate0.Gateway, StateGateway{Masquerade: true, EgressInterface: "eth0", ACLDefault: "deny"}},
+		{"pools", wgstate0.Pools, []StatePool{{Name: "laptops", Ranges: "10.8.0.10-10.8.0.49"}}},
+		{"reservations", wgstate0.Reservations, []StateReservation{{Addresses: "10.8.0.200-10.8.0.210", Note: "printers"}}},
+		{"acl count", len(wgstate0.ACL), 2},
+		{"acl peer", wgstate0.ACL[0].Peer, "alice"},
+		{"acl ports", wgstate0.ACL[0].Ports, "22, 443"},
+		{"acl group", wgstate0.ACL[1].Group, "ops"},
+		{"alice profile", wgstate0.Peers[0].RoutingProfile, "office"},
+		{"alice groups", wgstate0.Peers[0].Groups, []string{"laptops", "ops"}},
+		{"branch type", wgstate0.Peers[1].Type, "site"},
+		{"branch routed", wgstate0.Peers[1].RoutedSubnets, "192.168.60.0/24"},
+		{"old disabled", wgstate0.Peers[2].Disabled, true},
+		{"wgstate1 mode", got.Interfaces[1].Mode, "client"},
+	}
+	for _, c := range checks {
+		if !reflect.DeepEqual(c.got, c.want) {
+			t.Errorf("%s: got %#v, want %#v", c.name, c.got, c.want)
+		}
+	}
+
+	// 导出的文档再 plan 必须没有任何变更
+	plan, err = svc.Plan(ctx, got)
+	if err != nil {
+		t.Fatalf("plan: %v", err)
+	}
+	if len(plan.Changes) != 0 {
+		t.Fatalf("plan of exported state is not empty: %+v", plan.Changes)
+	}
+}
+
+func TestStatePlanChanges(t *testing.T) {
+	tests := []struct {
+		name   string
+		edit   func(d *StateDocument)
+		expect []StateChange
+	}{
+		{
+			name: "drop pool",
+			edit: func(d *StateDocument) { d.Interfaces[0].Pools = nil },
+			expect: []StateChange{
+				{Action: "delete", Kind: "pool", Interface: "wgstate0", Name: "laptops"},
+			},
+		},
+		{
+			name: "gateway back to defaults",
+			edit: func(d *StateDocument) { d.Interfaces[0].Gateway = nil },
+			expect: []StateChange{
+				{Action: "update", Kind: "gateway", Interface: "wgstate0", Fields: []string{"masquerade", "egress_interface", "acl_default"}},
+			},
+		},
+		{
+			name: "remove acl rule",
+			edit: func(d *StateDocument) { d.Interfaces[0].ACL = d.Interfaces[0].ACL[:1] },
+			expect: []StateChange{
+				{Action: "delete", Kind: "acl", Interface: "wgstate0", Name: "allow any to 0.0.0.0/0 from group ops"},
+			},
+		},
+		{
+			name: "disable peer and change groups",
+			edit: func(d *StateDocument) {
+				d.Interfaces[0].Peers[0].Disabled = true
+				d.Interfaces[0].Peers[0].Groups = []string{"ops"}
+			},
+			expect: []StateChange{
+				{Action: "update", Kind: "peer", Interface: "wgstate0", Name: "alice", Fields: []string{"disabled", "groups"}},
+			},
+		},
+		{
+			name: "drop routing profile",
+			edit: func(d *StateDocument) {
+				d.RoutingProfiles = slices.DeleteFunc(d.RoutingProfiles, func(rp StateRoutingProfile) bool { return rp.Name == "office" })
+				d.Interfaces[0].Peers[0].RoutingProfile = ""
+			},
+			expect: []StateChange{
+				{Action: "delete", Kind: "routing_profile", Name: "office"},
+				{Action: "update", Kind: "peer", Interface: "wgstate0", Name: "alice", Fields: []string{"routing_profile"}},
+			},
+		},
+		{
+			name: "change hooks and mode",
+			edit: func(d *StateDocument) {
+				d.Interfaces[0].PostUp = ""
+				d.Interfaces[1].Mode = "server"
+				d.Interfaces[1].ListenPort = 51821
+			},
+			expect: []StateChange{
+				{Action: "update", Kind: "interface", Interface: "wgstate0", Fields: []string{"post_up"}},
+				{Action: "update", Kind: "interface", Interface: "wgstate1", Fields: []string{"mode", "listen_port"}},
+			},
+		},
+		{
+			name: "delete interface",
+			edit: func(d *StateDocument) { d.Interfaces = d.Interfaces[:1] },
+			expect: []StateChange{
+				{Action: "delete", Kind: "interface", Interface: "wgstate1"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			svc := newTestStateService(t)
+			if _, err := svc.Apply(ctx, parseTestState(t, testStateYAML)); err != nil {
+				t.Fatalf("apply: %v", err)
+			}
+
+			doc := exportRoundTrip(t, svc)
+			tt.edit(doc)
+			plan, err := svc.Plan(ctx, doc)
+			if err != nil {
+				t.Fatalf("plan: %v", err)
+			}
+			if !reflect.DeepEqual(plan.Changes, tt.expect) {
+				t.Fatalf("plan:\n got  %+v\n want %+v", plan.Changes, tt.expect)
+			}
+
+			// apply 后状态与文档一致
+			if _, err := svc.Apply(ctx, doc); err != nil {
+				t.Fatalf("apply edited: %v", err)
+			}
+			plan, err = svc.Plan(ctx, exportRoundTrip(t, svc))
+			if err != nil {
+				t.Fatalf("re-plan: %v", err)
+			}
+			if len(plan.Changes) != 0 {
+				t.Fatalf("state did not converge: %+v", plan.Changes)
+			}
+		})
+	}
+}
+
+func TestStateRejects(t *testing.T) {
+	tests := []struct {
+		name string
+		doc  string
+		want error
+	}{
+		{
+			name: "peers on client-mode interface",
+			doc: `
+version: 1
+interfaces:
+  - name: wgstate1
+    mode: client
+    address: 10.9.0.2/32
+    peers:
+      - name: a
+`,
+			want: ErrBadRequest,
+		},
+		{
+			name: "unknown routing profile",
+			doc: `
+version: 1
+interfaces:
+  - name: wgstate0
+    address: 10.8.0.1/24
+    listen_port: 51820
+    peers:
+      - name: a
+        routing_profile: nope
+`,
+			want: ErrBadRequest,
+		},
+		{
+			name: "acl references unknown peer",
+			doc: `
+version: 1
+interfaces:
+  - name: wgstate0
+    address: 10.8.0.1/24
+    listen_port: 51820
+    acl:
+      - peer: ghost
+    peers: []
+`,
+			want: ErrBadRequest,
+		},
+		{
+			name: "overlapping pools",
+			doc: `
+version: 1
+interfaces:
+  - name: wgstate0
+    address: 10.8.0.1/24
+    listen_port: 51820
+    pools:
+      - name: a
+        ranges: 10.8.0.0/25
+      - name: b
+        ranges: 10.8.0.100-10.8.0.120
+    peers: []
+`,
+			want: ErrBadRequest,
+		},
+		{
+			name: "peer ip inside reservation",
+			doc: `
+version: 1
+interfaces:
+  - name: wgstate0
+    address: 10.8.0.1/24
+    listen_port: 51820
+    reservations:
+      - addresses: 10.8.0.0/28
+    peers:
+      - name: a
+        ip: 10.8.0.5
+`,
+			want: ErrConflict,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svc := newTestStateService(t)
+			_, err := svc.Apply(context.Background(), parseTestState(t, tt.doc))
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("got %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
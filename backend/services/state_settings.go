@@ -0,0 +1,496 @@
+package services
+
+import (
+	"backend/cidrset"
+	"backend/models"
+	"backend/repository"
+	"context"
+	"errors"
+	"fmt"
+	"net/netip"
+	"strings"
+)
+
+/* -------------------- 声明式状态：路由模板、网关、IPAM 与 ACL -------------------- */
+
+// reconcileRoutingProfiles 按名称对比路由模板，返回模板名到 ID 的映射（dryRun 时新模板为 0）
+func (s *StateService) reconcileRoutingProfiles(ctx context.Context, tx repository.Store, plan *StatePlan,
+	doc []StateRoutingProfile, dryRun bool) (map[string]int, error) {
+	want := make([]*models.RoutingProfile, len(doc))
+	seen := map[string]bool{}
+	for i := range doc {
+		sp := &doc[i]
+		rp, err := normalizeRoutingProfile(&models.RoutingProfileRequest{
+			Name: sp.Name, Kind: sp.Kind, Routes: sp.Routes, Excluded: sp.Excluded, Description: sp.Description,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("routing profile %s: %w", strings.TrimSpace(sp.Name), err)
+		}
+		if seen[rp.Name] {
+			return nil, fmt.Errorf("%w: duplicate routing profile %s", ErrBadRequest, rp.Name)
+		}
+		seen[rp.Name] = true
+		*sp = StateRoutingProfile{Name: rp.Name, Kind: rp.Kind, Routes: rp.Routes, Excluded: rp.Excluded, Description: rp.Description}
+		want[i] = rp
+	}
+
+	current, err := tx.RoutingProfiles().List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	byName := make(map[string]models.RoutingProfile, len(current))
+	for _, rp := range current {
+		if seen[rp.Name] {
+			byName[rp.Name] = rp
+			continue
+		}
+		// 引用它的 peer 解除关联，随后按文档重新设置
+		plan.add(StateChange{Action: "delete", Kind: "routing_profile", Name: rp.Name})
+		if !dryRun {
+			if err := tx.RoutingProfiles().Delete(ctx, rp.ID); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	ids := make(map[string]int, len(want))
+	for _, rp := range want {
+		cur, ok := byName[rp.Name]
+		if !ok {
+			plan.add(StateChange{Action: "create", Kind: "routing_profile", Name: rp.Name})
+			if !dryRun {
+				if err := tx.RoutingProfiles().Create(ctx, rp); err != nil {
+					return nil, err
+				}
+			}
+			ids[rp.Name] = rp.ID
+			continue
+		}
+		ids[rp.Name] = cur.ID
+		var fields []string
+		for _, f := range []struct{ name, old, new string }{
+			{"kind", cur.Kind, rp.Kind},
+			{"routes", cur.Routes, rp.Routes},
+			{"excluded", cur.Excluded, rp.Excluded},
+			{"description", cur.Description, rp.Description},
+		} {
+			if f.old != f.new {
+				fields = append(fields, f.name)
+			}
+		}
+		if len(fields) == 0 {
+			continue
+		}
+		plan.add(StateChange{Action: "update", Kind: "routing_profile", Name: rp.Name, Fields: fields})
+		if !dryRun {
+			rp.ID = cur.ID
+			if err := tx.RoutingProfiles().Update(ctx, rp); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return ids, nil
+}
+
+// stateGatewayOf 转为文档形式；与默认值相同的字段留空
+func stateGatewayOf(g *models.InterfaceGateway) *StateGateway {
+	sg := &StateGateway{
+		Masquerade:      g.Masquerade,
+		EgressInterface: g.EgressInterface,
+		LANForward:      g.LANForward,
+		LANCIDRs:        g.LANCIDRs,
+		ACLDefault:      g.ACLDefault,
+	}
+	if sg.LANForward == models.ForwardAllow {
+		sg.LANForward = ""
+	}
+	if sg.ACLDefault == models.ForwardAllow {
+		sg.ACLDefault = ""
+	}
+	return sg
+}
+
+// reconcileGateway 对比接口的网关设置；文档未写 gateway 视为默认设置。返回变更数
+func (s *StateService) reconcileGateway(ctx context.Context, tx repository.Store, plan *StatePlan,
+	it *models.WireGuardInterface, exists bool, si *StateInterface, dryRun bool) (int, error) {
+	var req models.InterfaceGatewayRequest
+	if sg := si.Gateway; sg != nil {
+		req = models.InterfaceGatewayRequest{
+			Masquerade:      sg.Masquerade,
+			EgressInterface: sg.EgressInterface,
+			LANForward:      sg.LANForward,
+			LANCIDRs:        sg.LANCIDRs,
+			ACLDefault:      sg.ACLDefault,
+		}
+	}
+	want, err := normalizeGateway(it.ID, &req)
+	if err != nil {
+		return 0, fmt.Errorf("interface %s: gateway: %w", si.Name, err)
+	}
+	if si.Gateway = stateGatewayOf(want); *si.Gateway == (StateGateway{}) {
+		si.Gateway = nil
+	} else if _, err := renderGatewayRules(it, want); err != nil {
+		// 先校验能否生成规则，避免存下无法下发的设置
+		return 0, fmt.Errorf("interface %s: gateway: %w", si.Name, err)
+	}
+
+	cur, _ := normalizeGateway(it.ID, &models.InterfaceGatewayRequest{})
+	action := "create"
+	if exists {
+		g, err := tx.Gateways().Get(ctx, it.ID)
+		switch {
+		case err == nil:
+			cur, action = g, "update"
+		case !errors.Is(err, repository.ErrNotFound):
+			return 0, err
+		}
+	}
+	var fields []string
+	for _, f := range []struct {
+		name     string
+		old, new any
+	}{
+		{"masquerade", cur.Masquerade, want.Masquerade},
+		{"egress_interface", cur.EgressInterface, want.EgressInterface},
+		{"lan_forward", cur.LANForward, want.LANForward},
+		{"lan_cidrs", cur.LANCIDRs, want.LANCIDRs},
+		{"acl_default", cur.ACLDefault, want.ACLDefault},
+	} {
+		if f.old != f.new {
+			fields = append(fields, f.name)
+		}
+	}
+	if len(fields) == 0 {
+		return 0, nil
+	}
+	plan.add(StateChange{Action: action, Kind: "gateway", Interface: si.Name, Fields: fields})
+	if !dryRun {
+		want.InterfaceID = it.ID
+		if err := tx.Gateways().Save(ctx, want); err != nil {
+			return 0, err
+		}
+	}
+	return 1, nil
+}
+
+// reconcileIPAM 对比接口的地址池（按名称）与保留地址（按 addresses）；只影响之后的分配，不需要重新下发
+func (s *StateService) reconcileIPAM(ctx context.Context, tx repository.Store, plan *StatePlan,
+	it *models.WireGuardInterface, exists bool, si *StateInterface, fams []addrFamily, dryRun bool) error {
+	// 1) 地址池：文档内不可重名、不可重叠
+	seen := map[string]bool{}
+	var prev [][]netip.Prefix
+	for i := range si.Pools {
+		sp := &si.Pools[i]
+		sp.Name = strings.TrimSpace(sp.Name)
+		sp.Description = strings.TrimSpace(sp.Description)
+		if sp.Name == "" {
+			return fmt.Errorf("%w: interface %s: ip pool name is required", ErrBadRequest, si.Name)
+		}
+		if seen[sp.Name] {
+			return fmt.Errorf("%w: interface %s: duplicate ip pool %s", ErrBadRequest, si.Name, sp.Name)
+		}
+		seen[sp.Name] = true
+		ranges, ps, err := parseInterfaceRanges("ranges", sp.Ranges, fams)
+		if err != nil {
+			return fmt.Errorf("interface %s: ip pool %s: %w", si.Name, sp.Name, err)
+		}
+		sp.Ranges = ranges
+		for j, ops := range prev {
+			if cidrset.Size(cidrset.Subtract(ps, ops)).Cmp(cidrset.Size(cidrset.Union(ps))) != 0 {
+				return fmt.Errorf("%w: interface %s: ip pools %s and %s overlap", ErrBadRequest, si.Name, si.Pools[j].Name, sp.Name)
+			}
+		}
+		prev = append(prev, ps)
+	}
+
+	var pools []models.IPPool
+	var err error
+	if exists {
+		if pools, err = tx.IPAM().ListPools(ctx, it.ID); err != nil {
+			return err
+		}
+	}
+	byName := make(map[string]models.IPPool, len(pools))
+	for _, p := range pools {
+		if seen[p.Name] {
+			byName[p.Name] = p
+			continue
+		}
+		plan.add(StateChange{Action: "delete", Kind: "pool", Interface: si.Name, Name: p.Name})
+		if !dryRun {
+			if err := tx.IPAM().DeletePool(ctx, p.ID); err != nil {
+				return err
+			}
+		}
+	}
+	for _, sp := range si.Pools {
+		cur, ok := byName[sp.Name]
+		if !ok {
+			plan.add(StateChange{Action: "create", Kind: "pool", Interface: si.Name, Name: sp.Name})
+			if !dryRun {
+				p := &models.IPPool{InterfaceID: it.ID, Name: sp.Name, Ranges: sp.Ranges, Description: sp.Description}
+				if err := tx.IPAM().CreatePool(ctx, p); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+		var fields []string
+		if cur.Ranges != sp.Ranges {
+			fields = append(fields, "ranges")
+		}
+		if cur.Description != sp.Description {
+			fields = append(fields, "description")
+		}
+		if len(fields) == 0 {
+			continue
+		}
+		plan.add(StateChange{Action: "update", Kind: "pool", Interface: si.Name, Name: sp.Name, Fields: fields})
+		if !dryRun {
+			cur.Ranges, cur.Description = sp.Ranges, sp.Description
+			if err := tx.IPAM().UpdatePool(ctx, &cur); err != nil {
+				return err
+			}
+		}
+	}
+
+	// 2) 保留地址
+	seenAddrs := map[string]bool{}
+	for i := range si.Reservations {
+		r := &si.Reservations[i]
+		addrs, _, err := parseInterfaceRanges("addresses", r.Addresses, fams)
+		if err != nil {
+			return fmt.Errorf("interface %s: ip reservation: %w", si.Name, err)
+		}
+		if seenAddrs[addrs] {
+			return fmt.Errorf("%w: interface %s: duplicate ip reservation %s", ErrBadRequest, si.Name, addrs)
+		}
+		seenAddrs[addrs] = true
+		r.Addresses, r.Note = addrs, strings.TrimSpace(r.Note)
+	}
+
+	var rs []models.IPReservation
+	if exists {
+		if rs, err = tx.IPAM().ListReservations(ctx, it.ID); err != nil {
+			return err
+		}
+	}
+	byAddrs := make(map[string]models.IPReservation, len(rs))
+	for _, r := range rs {
+		if seenAddrs[r.Addresses] {
+			byAddrs[r.Addresses] = r
+			continue
+		}
+		plan.add(StateChange{Action: "delete", Kind: "reservation", Interface: si.Name, Name: r.Addresses})
+		if !dryRun {
+			if err := tx.IPAM().DeleteReservation(ctx, r.ID); err != nil {
+				return err
+			}
+		}
+	}
+	for _, r := range si.Reservations {
+		cur, ok := byAddrs[r.Addresses]
+		switch {
+		case !ok:
+			plan.add(StateChange{Action: "create", Kind: "reservation", Interface: si.Name, Name: r.Addresses})
+			if !dryRun {
+				if err := tx.IPAM().CreateReservation(ctx, &models.IPReservation{InterfaceID: it.ID, Addresses: r.Addresses, Note: r.Note}); err != nil {
+					return err
+				}
+			}
+		case cur.Note != r.Note:
+			plan.add(StateChange{Action: "update", Kind: "reservation", Interface: si.Name, Name: r.Addresses, Fields: []string{"note"}})
+			if !dryRun {
+				cur.Note = r.Note
+				if err := tx.IPAM().UpdateReservation(ctx, &cur); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// checkStateReservations 与 CreateIPReservation 一致：保留地址不能已分配给 peer。
+// dryRun 时新 peer 尚未分配，只检查文档中显式写出的 IP
+func checkStateReservations(ctx context.Context, tx repository.Store, it *models.WireGuardInterface, si *StateInterface, dryRun bool) error {
+	var reserved []netip.Prefix
+	for _, r := range si.Reservations {
+		ps, err := parseCIDRItems(splitCSV(r.Addresses))
+		if err != nil {
+			return fmt.Errorf("%w: interface %s: ip reservation: %v", ErrBadRequest, si.Name, err)
+		}
+		reserved = append(reserved, ps...)
+	}
+	if len(reserved) == 0 {
+		return nil
+	}
+	var peers []models.WireGuardPeer
+	if dryRun {
+		for _, sp := range si.Peers {
+			peers = append(peers, models.WireGuardPeer{Name: sp.Name, IP: sp.IP})
+		}
+	} else {
+		var err error
+		if peers, err = tx.Peers().ListByInterface(ctx, it.ID); err != nil {
+			return err
+		}
+	}
+	for _, p := range peers {
+		for _, a := range peerAddrs(p.IP) {
+			if cidrset.ContainsAddr(reserved, a) {
+				return fmt.Errorf("%w: interface %s: %s is reserved but assigned to peer %s", ErrConflict, si.Name, a, p.Name)
+			}
+		}
+	}
+	return nil
+}
+
+// key 唯一描述一条规则，用于与库中的规则逐条配对
+func (r *StateACLRule) key() string {
+	return fmt.Sprintf("%d|%s|%s|%s|%s|%s|%s|%s",
+		r.Priority, r.Peer, r.Group, r.Action, r.Protocol, r.Destinations, r.Ports, r.Description)
+}
+
+// label 是计划中展示的规则摘要
+func (r *StateACLRule) label() string {
+	dst := r.Destinations
+	if dst == "" {
+		dst = "any"
+	}
+	s := fmt.Sprintf("%s %s to %s", r.Action, r.Protocol, dst)
+	if r.Ports != "" {
+		s += " port " + r.Ports
+	}
+	switch {
+	case r.Peer != "":
+		s += " from peer " + r.Peer
+	case r.Group != "":
+		s += " from group " + r.Group
+	}
+	return s
+}
+
+// stateACLRuleOf 转为文档形式；peerNames 为本接口 peer ID 到名称的映射
+func stateACLRuleOf(ctx context.Context, tx repository.Store, r *models.ACLRule, peerNames map[int]string) (*StateACLRule, error) {
+	sr := &StateACLRule{
+		Action:       r.Action,
+		Destinations: r.Destinations,
+		Protocol:     r.Protocol,
+		Ports:        r.Ports,
+		Priority:     r.Priority,
+		Description:  r.Description,
+	}
+	if r.PeerID != nil {
+		sr.Peer = peerNames[*r.PeerID]
+	}
+	if r.GroupID != nil {
+		g, err := tx.PeerGroups().Get(ctx, *r.GroupID)
+		if err != nil {
+			return nil, err
+		}
+		sr.Group = g.Name
+	}
+	return sr, nil
+}
+
+// reconcileACL 对比接口的 ACL 规则：规则没有名称，按内容整条配对，多出的删除、缺少的按文档顺序创建。
+// peerIDs 为文档中 peer 名称到 ID 的映射；返回变更数
+func (s *StateService) reconcileACL(ctx context.Context, tx repository.Store, plan *StatePlan,
+	it *models.WireGuardInterface, exists bool, si *StateInterface, peerIDs map[string]int, dryRun bool) (int, error) {
+	want := map[string]int{}
+	for i := range si.ACL {
+		sr := &si.ACL[i]
+		r, err := s.wg.normalizeACLRule(ctx, tx, it.ID, &models.ACLRuleRequest{
+			Action: sr.Action, Destinations: sr.Destinations, Protocol: sr.Protocol,
+			Ports: sr.Ports, Priority: sr.Priority, Description: sr.Description,
+		})
+		if err != nil {
+			return 0, fmt.Errorf("interface %s: acl rule %d: %w", si.Name, i+1, err)
+		}
+		sr.Action, sr.Destinations, sr.Protocol, sr.Ports, sr.Description = r.Action, r.Destinations, r.Protocol, r.Ports, r.Description
+		sr.Peer, sr.Group = strings.TrimSpace(sr.Peer), strings.TrimSpace(sr.Group)
+		if sr.Peer != "" && sr.Group != "" {
+			return 0, fmt.Errorf("%w: interface %s: acl rule %d: peer and group are mutually exclusive", ErrBadRequest, si.Name, i+1)
+		}
+		if _, ok := peerIDs[sr.Peer]; sr.Peer != "" && !ok {
+			return 0, fmt.Errorf("%w: interface %s: acl rule %d: unknown peer %q", ErrBadRequest, si.Name, i+1, sr.Peer)
+		}
+		if sr.Group != "" {
+			if sr.Group, err = normalizeGroupName(sr.Group); err != nil {
+				return 0, fmt.Errorf("interface %s: acl rule %d: %w", si.Name, i+1, err)
+			}
+		}
+		want[sr.key()]++
+	}
+
+	var current []models.ACLRule
+	var err error
+	if exists {
+		if current, err = tx.ACLs().List(ctx, it.ID); err != nil {
+			return 0, err
+		}
+	}
+	peerNames := make(map[int]string, len(peerIDs))
+	for name, id := range peerIDs {
+		if id != 0 {
+			peerNames[id] = name
+		}
+	}
+
+	changes := 0
+	kept := map[string]int{}
+	for _, r := range current {
+		sr, err := stateACLRuleOf(ctx, tx, &r, peerNames)
+		if err != nil {
+			return 0, err
+		}
+		// 指向被删除 peer 的规则随 peer 一起删除（dryRun 时仍在库中）
+		gone := r.PeerID != nil && sr.Peer == ""
+		if k := sr.key(); !gone && want[k] > 0 {
+			want[k]--
+			kept[k]++
+			continue
+		}
+		changes++
+		plan.add(StateChange{Action: "delete", Kind: "acl", Interface: si.Name, Name: sr.label()})
+		if !dryRun && !gone {
+			if err := tx.ACLs().Delete(ctx, r.ID); err != nil {
+				return 0, err
+			}
+		}
+	}
+	for _, sr := range si.ACL {
+		if k := sr.key(); kept[k] > 0 {
+			kept[k]--
+			continue
+		}
+		changes++
+		plan.add(StateChange{Action: "create", Kind: "acl", Interface: si.Name, Name: sr.label()})
+		if dryRun {
+			continue
+		}
+		r, err := s.wg.normalizeACLRule(ctx, tx, it.ID, &models.ACLRuleRequest{
+			Action: sr.Action, Destinations: sr.Destinations, Protocol: sr.Protocol,
+			Ports: sr.Ports, Priority: sr.Priority, Description: sr.Description,
+		})
+		if err != nil {
+			return 0, err
+		}
+		if sr.Peer != "" {
+			id := peerIDs[sr.Peer]
+			r.PeerID = &id
+		}
+		if sr.Group != "" {
+			ids, err := resolvePeerGroups(ctx, tx, []string{sr.Group})
+			if err != nil {
+				return 0, err
+			}
+			r.GroupID = &ids[0]
+		}
+		if err := tx.ACLs().Create(ctx, r); err != nil {
+			return 0, err
+		}
+	}
+	return changes, nil
+}
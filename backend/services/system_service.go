@@ -0,0 +1,37 @@
+package services
+
+import (
+	"backend/keystore"
+	"backend/repository"
+	"context"
+	"fmt"
+)
+
+type SystemService struct {
+	store *repository.SQLStore
+	keys  *keystore.Keyring // nil 表示未启用落库加密
+}
+
+func NewSystemService(store *repository.SQLStore, keys *keystore.Keyring) *SystemService {
+	return &SystemService{store: store, keys: keys}
+}
+
+type KeyStatus struct {
+	Encrypted bool   `json:"encrypted"`
+	KeyID     string `json:"key_id,omitempty"`
+}
+
+func (s *SystemService) KeyStatus() KeyStatus {
+	if s.keys == nil {
+		return KeyStatus{}
+	}
+	return KeyStatus{Encrypted: true, KeyID: s.keys.CurrentID()}
+}
+
+// RotateKeys 用当前主密钥和全新的数据密钥重新加密所有私钥，返回改写的行数
+func (s *SystemService) RotateKeys(ctx context.Context) (int, error) {
+	if s.keys == nil {
+		return 0, fmt.Errorf("%w: master key not configured (set WG_MASTER_KEY or WG_MASTER_KEY_FILE)", ErrBadRequest)
+	}
+	return s.store.RewrapSecrets(ctx, true)
+}
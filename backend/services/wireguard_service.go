@@ -1,30 +1,61 @@
 package services
 
 import (
-	"backend/ipam"
 	"backend/models"
+	"backend/repository"
+	"backend/wgconf"
 	"context"
 	"database/sql"
 	"errors"
 	"fmt"
 	"golang.zx2c4.com/wireguard/wgctrl"
 	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+	"log"
 	"net"
-	"os/exec"
+	"os"
 	"strings"
+	"sync"
 	"time"
-	"os"
-	"strconv"
 )
 
 type WireGuardService struct {
-	db     *sql.DB
+	store  repository.Store
 	client *wgctrl.Client
+	conf   *ConfWriter // 非 nil 时每次变更后写出 <name>.conf
+
+	ipQuarantine time.Duration // 释放地址的隔离期
+	randomIPv6   bool          // IPv6 地址随机分配
+	network      NetworkBackend
+	firewall     Firewall   // nil 时不管理 NAT/转发规则
+	fwMu         sync.Mutex // 串行化管理表的重建
+
+	hooksDisabled bool          // 不执行接口 hook（仍可保存）
+	hookTimeout   time.Duration // 单条 hook 命令的超时
+
+	clientMu sync.Mutex            // 保护 client 的创建与 clients
+	clients  map[int]*clientHealth // 客户端模式接口的握手监控状态
+
+	health PeerHealthPolicy // peer 在线判定与 stale 策略
+
+	ipamMu    sync.Mutex              // 保护 ipamCache 及其中的分配视图
+	ipamCache map[int]*ipamCacheEntry // 按接口缓存的分配视图，见 leaseIPAMView
 }
 
 func NewWireGuardService(db *sql.DB) *WireGuardService {
+	return NewWireGuardServiceWithStore(repository.NewSQLStore(db))
+}
+
+// NewWireGuardServiceWithStore 使用指定的仓储（如 repository.NewMemoryStore()）构造服务
+func NewWireGuardServiceWithStore(store repository.Store) *WireGuardService {
 	c, _ := wgctrl.New() // 失败时为 nil，调用处会兜底
-	return &WireGuardService{db: db, client: c}
+	return &WireGuardService{store: store, client: c, ipQuarantine: defaultIPQuarantine, randomIPv6: true,
+		network: NewIPCommandBackend(), firewall: NewNFTFirewall(),
+		health: PeerHealthPolicy{OnlineThreshold: defaultPeerOnlineThreshold, SessionRetention: defaultPeerSessionRetention}}
+}
+
+// SetConfWriter 启用 wg-quick 配置落盘；传 nil 关闭
+func (s *WireGuardService) SetConfWriter(w *ConfWriter) {
+	s.conf = w
 }
 
 func (s *WireGuardService) Close() error {
@@ -61,64 +92,6 @@ func parseWGPublicKey(b64 string) (*wgtypes.Key, error) {
 	return &k, nil
 }
 
-func runShell(cmd string) ([]byte, error) {
-	return exec.Command("bash", "-lc", cmd).CombinedOutput()
-}
-
-func ipEnsureLink(name string) error {
-	// 已存在则忽略错误
-	if out, err := runShell(fmt.Sprintf(`ip link show %q`, name)); err == nil && len(out) > 0 {
-		return nil
-	}
-	// 创建 wireguard 链路
-	if out, err := runShell(fmt.Sprintf(`ip link add dev %q type wireguard`, name)); err != nil {
-		return fmt.Errorf("ip link add %s: %v (%s)", name, err, strings.TrimSpace(string(out)))
-	}
-	return nil
-}
-
-func ipSetMTU(name string, mtu int) error {
-	if mtu <= 0 {
-		return nil
-	}
-	if out, err := runShell(fmt.Sprintf(`ip link set dev %q mtu %d`, name, mtu)); err != nil {
-		return fmt.Errorf("ip set mtu: %v (%s)", err, strings.TrimSpace(string(out)))
-	}
-	return nil
-}
-
-func ipAddrReplace(name, cidr string) error {
-	cidr = strings.TrimSpace(cidr)
-	if cidr == "" {
-		return nil
-	}
-	if out, err := runShell(fmt.Sprintf(`ip address replace %s dev %q`, cidr, name)); err != nil {
-		return fmt.Errorf("ip addr replace: %v (%s)", err, strings.TrimSpace(string(out)))
-	}
-	return nil
-}
-
-func ipLinkUp(name string) error {
-	if out, err := runShell(fmt.Sprintf(`ip link set up dev %q`, name)); err != nil {
-		return fmt.Errorf("ip link up: %v (%s)", err, strings.TrimSpace(string(out)))
-	}
-	return nil
-}
-
-func ipLinkDown(name string) error {
-	if out, err := runShell(fmt.Sprintf(`ip link set down dev %q`, name)); err != nil {
-		return fmt.Errorf("ip link down: %v (%s)", err, strings.TrimSpace(string(out)))
-	}
-	return nil
-}
-
-func ipLinkDel(name string) error {
-	if out, err := runShell(fmt.Sprintf(`ip link del dev %q`, name)); err != nil {
-		return fmt.Errorf("ip link del: %v (%s)", err, strings.TrimSpace(string(out)))
-	}
-	return nil
-}
-
 func splitCSV(s string) []string {
 	s = strings.TrimSpace(s)
 	if s == "" {
@@ -149,7 +122,8 @@ func parseEndpoint(ep string) (*net.UDPAddr, error) {
 	if ep == "" {
 		return nil, nil
 	}
-	ua, err := net.ResolveUDPAddr("udp", ep)
+	// 与定时重新解析使用同一套规则（优先 IPv4），避免两边结果来回切换
+	ua, err := resolveEndpoint(context.Background(), ep)
 	if err != nil {
 		return nil, fmt.Errorf("parse endpoint %q: %w", ep, err)
 	}
@@ -166,33 +140,6 @@ func durationPtrSeconds(sec int) *time.Duration {
 	return &d
 }
 
-type ifaceRow struct {
-	ID       uint
-	Name     string
-	CIDR     string
-	ServerIP string
-}
-
-type Peer struct {
-	ID                  uint
-	InterfaceID         uint
-	Name                string
-	IP                  string
-	AllowedIPs          string
-	Endpoint            sql.NullString
-	PersistentKeepalive int
-	PublicKey           sql.NullString
-	PrivateKey          sql.NullString
-}
-
-// 工具：把 *string 转成 sql.NullString（nil/空串 => NULL）
-func nullStr(p *string) sql.NullString {
-	if p == nil || strings.TrimSpace(*p) == "" {
-		return sql.NullString{Valid: false}
-	}
-	return sql.NullString{String: strings.TrimSpace(*p), Valid: true}
-}
-
 // 把 *string 安全取值（nil -> ""）
 func strFromPtr(p *string) string {
 	if p == nil {
@@ -201,24 +148,20 @@ func strFromPtr(p *string) string {
 	return *p
 }
 
-func isUniqueError(err error) bool {
-	s := strings.ToLower(err.Error())
-	// SQLite
-	if strings.Contains(s, "unique constraint failed") {
-		return true
-	}
-	// MySQL
-	if strings.Contains(s, "error 1062") || strings.Contains(s, "duplicate entry") {
-		return true
-	}
-	// Postgres
-	if strings.Contains(s, "sqlstate 23505") || strings.Contains(s, "duplicate key value violates unique constraint") {
-		return true
+// 把仓储层错误映射为 service 层语义错误（供 handler 选择状态码）
+func mapRepoErr(err error, what string) error {
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, repository.ErrNotFound):
+		return fmt.Errorf("%w: %s not found", ErrNotFound, what)
+	case errors.Is(err, repository.ErrConflict):
+		return fmt.Errorf("%w: %s already exists", ErrConflict, what)
+	default:
+		return err
 	}
-	return false
 }
 
-
 func containsDefaultRoute(s string) bool {
 	// true if 包含 0.0.0.0/0 或 ::/0
 	ss := strings.Split(s, ",")
@@ -234,58 +177,29 @@ func containsDefaultRoute(s string) bool {
 /* -------------------- 接口（DB） -------------------- */
 
 func (s *WireGuardService) GetInterfaces() ([]models.WireGuardInterface, error) {
-	query := `
-		SELECT id, name, private_key, public_key, listen_port, address, 
-			   COALESCE(dns, '') as dns, COALESCE(mtu, 1420) as mtu, 
-			   COALESCE(status, 'stopped') as status, created_at, updated_at
-		FROM wireguard_interfaces
-		ORDER BY created_at DESC
-	`
-	rows, err := s.db.Query(query)
-	if err != nil {
-		return nil, fmt.Errorf("query interfaces: %w", err)
-	}
-	defer rows.Close()
-
-	var list []models.WireGuardInterface
-	for rows.Next() {
-		var it models.WireGuardInterface
-		if err := rows.Scan(
-			&it.ID, &it.Name, &it.PrivateKey, &it.PublicKey,
-			&it.ListenPort, &it.Address, &it.DNS, &it.MTU,
-			&it.Status, &it.CreatedAt, &it.UpdatedAt,
-		); err != nil {
-			return nil, fmt.Errorf("scan interface: %w", err)
-		}
-		list = append(list, it)
-	}
-	return list, nil
+	return s.store.Interfaces().List(context.Background())
 }
 
 func (s *WireGuardService) GetInterface(id int) (*models.WireGuardInterface, error) {
-	query := `
-		SELECT id, name, private_key, public_key, listen_port, address,
-			   COALESCE(dns, '') as dns, COALESCE(mtu, 1420) as mtu,
-			   COALESCE(status, 'stopped') as status, created_at, updated_at
-		FROM wireguard_interfaces
-		WHERE id = ?
-	`
-	var it models.WireGuardInterface
-	err := s.db.QueryRow(query, id).Scan(
-		&it.ID, &it.Name, &it.PrivateKey, &it.PublicKey,
-		&it.ListenPort, &it.Address, &it.DNS, &it.MTU,
-		&it.Status, &it.CreatedAt, &it.UpdatedAt,
-	)
+	it, err := s.store.Interfaces().Get(context.Background(), id)
 	if err != nil {
-		if err == sql.ErrNoRows {
-			return nil, fmt.Errorf("interface not found")
-		}
-		return nil, fmt.Errorf("get interface: %w", err)
+		return nil, mapRepoErr(err, "interface")
 	}
-	return &it, nil
+	return it, nil
+}
+
+// checkInterfaceName 校验接口名：它会成为内核链路名和 <name>.conf 文件名
+func checkInterfaceName(name string) error {
+	if !ifaceNameRe.MatchString(name) || name == "." || name == ".." {
+		return fmt.Errorf("%w: invalid interface name %q", ErrBadRequest, name)
+	}
+	return nil
 }
 
 func (s *WireGuardService) CreateInterface(req models.CreateInterfaceRequest) (*models.WireGuardInterface, error) {
+	if err := checkInterfaceName(req.Name); err != nil {
+		return nil, err
+	}
 	privateKey := strings.TrimSpace(req.PrivateKey)
 	var publicKey string
 	var err error
@@ -300,11 +214,20 @@ func (s *WireGuardService) CreateInterface(req models.CreateInterfaceRequest) (*
 		// 已提供私钥：由私钥派生公钥
 		k, err := wgtypes.ParseKey(privateKey)
 		if err != nil {
-			return nil, fmt.Errorf("invalid private key: %w", err)
+			return nil, fmt.Errorf("%w: invalid private key: %v", ErrBadRequest, err)
 		}
 		publicKey = k.PublicKey().String()
 	}
 
+	cidr, serverIP, err := deriveCIDR(req.Address)
+	if err != nil {
+		return nil, err
+	}
+	fams, _ := parseInterfaceAddress(req.Address)
+	if err := s.checkSubnetConflicts(context.Background(), s.store, 0, req.Name, fams); err != nil {
+		return nil, err
+	}
+
 	dns := req.DNS
 	if dns == "" {
 		dns = "8.8.8.8"
@@ -314,19 +237,43 @@ func (s *WireGuardService) CreateInterface(req models.CreateInterfaceRequest) (*
 		mtu = 1420
 	}
 
-	query := `
-		INSERT INTO wireguard_interfaces (name, private_key, public_key, listen_port, address, dns, mtu, status)
-		VALUES (?, ?, ?, ?, ?, ?, ?, 'stopped')
-	`
-	res, err := s.db.Exec(query, req.Name, privateKey, publicKey, req.ListenPort, req.Address, dns, mtu)
-	if err != nil {
-		return nil, fmt.Errorf("create interface: %w", err)
+	it := &models.WireGuardInterface{
+		Name:       req.Name,
+		PrivateKey: privateKey,
+		PublicKey:  publicKey,
+		ListenPort: req.ListenPort,
+		Address:    strings.Join(splitCSV(req.Address), ", "),
+		DNS:        dns,
+		MTU:        mtu,
+		CIDR:       cidr,
+		ServerIP:   serverIP,
+		Status:     "stopped",
+	}
+	if _, err := applyHooks(it, req.InterfaceHooks); err != nil {
+		return nil, err
+	}
+	if err := applyInterfaceSite(it, req.InterfaceSite); err != nil {
+		return nil, err
+	}
+	ctx := context.Background()
+	if err := checkLocalSubnets(ctx, s.store, it); err != nil {
+		return nil, err
 	}
-	id, _ := res.LastInsertId()
-	return s.GetInterface(int(id))
+	if err := s.store.Interfaces().Create(ctx, it); err != nil {
+		return nil, mapRepoErr(err, "interface name or listen port")
+	}
+	s.syncConfFile(it.ID)
+	return s.GetInterface(it.ID)
 }
 
 func (s *WireGuardService) UpdateInterface(id int, req models.UpdateInterfaceRequest) (*models.WireGuardInterface, error) {
+	if err := checkInterfaceName(req.Name); err != nil {
+		return nil, err
+	}
+	it, err := s.GetInterface(id)
+	if err != nil {
+		return nil, err
+	}
 	dns := req.DNS
 	if dns == "" {
 		dns = "8.8.8.8"
@@ -335,15 +282,50 @@ func (s *WireGuardService) UpdateInterface(id int, req models.UpdateInterfaceReq
 	if mtu == 0 {
 		mtu = 1420
 	}
-	query := `
-		UPDATE wireguard_interfaces
-		SET name=?, listen_port=?, address=?, dns=?, mtu=?, updated_at=CURRENT_TIMESTAMP
-		WHERE id=?
-	`
-	if _, err := s.db.Exec(query, req.Name, req.ListenPort, req.Address, dns, mtu, id); err != nil {
-		return nil, fmt.Errorf("update interface: %w", err)
+	oldName, oldAddress := it.Name, it.Address
+	address := strings.Join(splitCSV(req.Address), ", ")
+	if address == "" {
+		address = it.Address
+	}
+	if _, err := applyHooks(it, req.InterfaceHooks); err != nil {
+		return nil, err
+	}
+	if err := applyInterfaceSite(it, req.InterfaceSite); err != nil {
+		return nil, err
+	}
+	ctx := context.Background()
+	err = s.store.WithTx(ctx, func(tx repository.Store) error {
+		if err := checkModeChange(ctx, tx, it); err != nil {
+			return err
+		}
+		it.Name = req.Name
+		it.ListenPort = req.ListenPort
+		it.DNS = dns
+		it.MTU = mtu
+		// 改地址即改网段：peer 地址、allowed_ips、地址池随之平移（同 RenumberInterface）
+		if address != it.Address {
+			if _, err := s.renumberTx(ctx, tx, it, address); err != nil {
+				return err
+			}
+		}
+		if err := checkLocalSubnets(ctx, tx, it); err != nil {
+			return err
+		}
+		return mapRepoErr(tx.Interfaces().Update(ctx, it), "interface")
+	})
+	if err != nil {
+		return nil, err
+	}
+	if oldName != it.Name {
+		s.removeConfFile(oldName)
 	}
-	// 若接口在运行，可选择立即热更新（这里不自动，交由 Start/Restart/Apply）
+	if address != oldAddress {
+		// 地址变化后内核里的旧地址与 peer 路由已失效，运行中的接口立即重新下发
+		_ = s.reapplyRenumbered(id, oldAddress)
+	} else {
+		s.syncConfFile(id)
+	}
+	// 其余字段若接口在运行，可选择立即热更新（这里不自动，交由 Start/Restart/Apply）
 	return s.GetInterface(id)
 }
 
@@ -355,195 +337,111 @@ func (s *WireGuardService) DeleteInterface(id int) error {
 	// 尝试先停掉
 	_ = s.StopInterface(id)
 	// 删除 DB
-	_, err = s.db.Exec(`DELETE FROM wireguard_interfaces WHERE id=?`, id)
-	if err != nil {
-		return fmt.Errorf("delete interface: %w", err)
+	if err := s.store.Interfaces().Delete(context.Background(), id); err != nil {
+		return mapRepoErr(err, "interface")
 	}
 	// 删除链路（如果还在）
 	_ = ipLinkDel(it.Name)
+	s.removeConfFile(it.Name)
 	return nil
 }
 
 /* -------------------- Peer（DB） -------------------- */
 
 func (s *WireGuardService) GetPeers() ([]models.WireGuardPeer, error) {
-	// 1) 先把基础信息从 DB 查出来（你已有的 SELECT）
-	rows, err := s.db.Query(`
-	  SELECT
-	    p.id,
-	    p.interface_id,
-	    i.name                              AS interface_name,
-	    p.name,
-	    p.ip,
-	    p.allowed_ips,
-	    COALESCE(p.endpoint, '')            AS endpoint,
-	    COALESCE(p.persistent_keepalive, 0) AS persistent_keepalive,
-	    COALESCE(p.public_key, '')          AS public_key,
-	    COALESCE(p.private_key, '')         AS private_key,
-	    COALESCE(p.status, 'disconnected')  AS status,
-	    p.last_handshake,
-	    COALESCE(p.bytes_received, 0)       AS bytes_received,
-	    COALESCE(p.bytes_sent, 0)           AS bytes_sent,
-	    p.created_at,
-	    p.updated_at
-	  FROM wireguard_peers p
-	  LEFT JOIN wireguard_interfaces i ON i.id = p.interface_id
-	  ORDER BY p.created_at DESC`)
+	// 1) 先把基础信息从 DB 查出来
+	list, err := s.store.Peers().List(context.Background())
 	if err != nil {
-		return nil, fmt.Errorf("query peers: %w", err)
-	}
-	defer rows.Close()
-
-	var list []models.WireGuardPeer
-	type itemPtr = *models.WireGuardPeer
-
-	// 2) 先扫描到内存；用 (interface_name + public_key) 做索引，方便覆盖
-	idx := make(map[string]itemPtr)
-	for rows.Next() {
-		var p models.WireGuardPeer
-		var last sql.NullTime
-		if err := rows.Scan(
-			&p.ID,
-			&p.InterfaceID,
-			&p.InterfaceName,
-			&p.Name,
-			&p.IP,
-			&p.AllowedIPs,
-			&p.Endpoint,
-			&p.PersistentKeepalive,
-			&p.PublicKey,
-			&p.PrivateKey,
-			&p.Status,
-			&last,
-			&p.BytesReceived,
-			&p.BytesSent,
-			&p.CreatedAt,
-			&p.UpdatedAt,
-		); err != nil {
-			return nil, fmt.Errorf("scan peer: %w", err)
-		}
-		if last.Valid {
-			t := last.Time
-			p.LastHandshake = &t
-		}
+		return nil, err
+	}
 
-		list = append(list, p)
-		key := p.InterfaceName + "|" + p.PublicKey
-		idx[key] = &list[len(list)-1]
+	// 2) 用 (interface_name + public_key) 做索引，方便覆盖
+	idx := make(map[string]*models.WireGuardPeer, len(list))
+	for i := range list {
+		idx[list[i].InterfaceName+"|"+list[i].PublicKey] = &list[i]
 	}
 
 	// 3) 用 wgctrl 获取实时状态，覆盖到返回值
+	if s.client == nil {
+		return list, nil
+	}
 	devs, err := s.client.Devices()
 	if err == nil {
-		const recent = 180 * time.Second
 		now := time.Now()
 
 		for _, d := range devs {
 			for _, pr := range d.Peers {
 				key := d.Name + "|" + pr.PublicKey.String()
 				if it, ok := idx[key]; ok {
+					// 配置的主机名保留在 Endpoint，实际地址放 ResolvedEndpoint
 					if pr.Endpoint != nil {
-						it.Endpoint = pr.Endpoint.String()
+						it.ResolvedEndpoint = pr.Endpoint.String()
+						if it.Endpoint == "" {
+							it.Endpoint = it.ResolvedEndpoint
+						}
 					}
-					// 最新握手
+					// 最新握手；内核中清零（如接口重建）时保留已持久化的 last seen
 					if !pr.LastHandshakeTime.IsZero() {
 						t := pr.LastHandshakeTime
 						it.LastHandshake = &t
-					} else {
-						it.LastHandshake = nil
 					}
-					// 流量（uint64 -> int64/你的类型）
+					// 流量（uint64 -> int64）
 					it.BytesReceived = int64(pr.ReceiveBytes)
 					it.BytesSent = int64(pr.TransmitBytes)
 					// 状态
-					if !pr.LastHandshakeTime.IsZero() && now.Sub(pr.LastHandshakeTime) <= recent {
-						it.Status = "connected"
+					if s.peerOnline(pr.LastHandshakeTime, now) {
+						it.Status = peerStatusConnected
 					} else {
-						it.Status = "disconnected"
+						it.Status = peerStatusDisconnected
 					}
 				}
 			}
 		}
 	} // 如果 wgctrl 出错，就保留 DB 的值返回
 
+	// 4) 分组（标签）与在线时段 / stale 标记
+	if err := s.fillPeerGroups(context.Background(), list); err != nil {
+		return nil, err
+	}
+	if err := s.fillPeerHealth(context.Background(), list); err != nil {
+		return nil, err
+	}
 	return list, nil
 }
 
 func (s *WireGuardService) GetPeersByInterface(interfaceID int) ([]models.WireGuardPeer, error) {
-	rows, err := s.db.Query(`
-		SELECT
-		  id, interface_id, name,
-		  COALESCE(public_key,'')          AS public_key,
-		  COALESCE(private_key,'')         AS private_key,
-		  COALESCE(ip,'')                  AS ip,             -- ← 新增
-		  COALESCE(allowed_ips,'')         AS allowed_ips,
-		  COALESCE(preshared_key,'')       AS preshared_key,  -- ← 需要 PSK 时新增
-		  COALESCE(endpoint,'')            AS endpoint,
-		  COALESCE(persistent_keepalive,0) AS persistent_keepalive,
-		  COALESCE(status,'disconnected')  AS status,
-		  last_handshake,
-		  COALESCE(bytes_received,0)       AS bytes_received,
-		  COALESCE(bytes_sent,0)           AS bytes_sent,
-		  created_at, updated_at
-		FROM wireguard_peers
-		WHERE interface_id = ?
-		ORDER BY created_at DESC`, interfaceID)
+	return s.store.Peers().ListByInterface(context.Background(), interfaceID)
+}
+
+func (s *WireGuardService) GetPeer(id int) (*models.WireGuardPeer, error) {
+	p, err := s.store.Peers().Get(context.Background(), id)
 	if err != nil {
-		return nil, fmt.Errorf("query peers by interface: %w", err)
-	}
-	defer rows.Close()
-
-	var list []models.WireGuardPeer
-	for rows.Next() {
-		var p models.WireGuardPeer
-		var last sql.NullTime
-
-		if err := rows.Scan(
-			&p.ID, &p.InterfaceID, &p.Name,
-			&p.PublicKey, &p.PrivateKey,
-			&p.IP, &p.AllowedIPs,           // ← 对齐新增列
-			&p.PresharedKey,                // ← 若没用 PSK，请从 SELECT 和这里都删掉
-			&p.Endpoint, &p.PersistentKeepalive,
-			&p.Status, &last,
-			&p.BytesReceived, &p.BytesSent,
-			&p.CreatedAt, &p.UpdatedAt,
-		); err != nil {
-			return nil, fmt.Errorf("scan peer: %w", err)
-		}
-		if last.Valid {
-			t := last.Time
-			p.LastHandshake = &t
-		}
-		list = append(list, p)
+		return nil, mapRepoErr(err, "peer")
 	}
-	return list, nil
+	one := []models.WireGuardPeer{*p}
+	if err := s.fillPeerGroups(context.Background(), one); err != nil {
+		return nil, err
+	}
+	if err := s.fillPeerHealth(context.Background(), one); err != nil {
+		return nil, err
+	}
+	return &one[0], nil
 }
 
-func (s *WireGuardService) GetPeer(id int) (*models.WireGuardPeer, error) {
-	var p models.WireGuardPeer
-	err := s.db.QueryRow(`
-		SELECT id, interface_id, name, public_key, private_key, allowed_ips,
-			   COALESCE(endpoint, '') AS endpoint,
-			   COALESCE(persistent_keepalive, 0) AS persistent_keepalive,
-			   COALESCE(status, 'disconnected') AS status,
-			   last_handshake, bytes_received, bytes_sent, created_at, updated_at
-		FROM wireguard_peers
-		WHERE id = ?`, id).Scan(
-		&p.ID, &p.InterfaceID, &p.Name, &p.PublicKey, &p.PrivateKey,
-		&p.AllowedIPs, &p.Endpoint, &p.PersistentKeepalive, &p.Status,
-		&p.LastHandshake, &p.BytesReceived, &p.BytesSent,
-		&p.CreatedAt, &p.UpdatedAt,
-	)
+// 确保接口有 cidr/server_ip；缺失则从 address 推导并回写
+func ensureInterfaceCIDR(ctx context.Context, tx repository.Store, iface *models.WireGuardInterface) error {
+	if strings.TrimSpace(iface.CIDR) != "" && strings.TrimSpace(iface.ServerIP) != "" {
+		return nil
+	}
+	cidr, serverIP, err := deriveCIDR(iface.Address)
 	if err != nil {
-		if err == sql.ErrNoRows {
-			return nil, fmt.Errorf("peer not found")
-		}
-		return nil, fmt.Errorf("get peer: %w", err)
+		return fmt.Errorf("%w: interface missing cidr/server_ip", ErrBadRequest)
 	}
-	return &p, nil
+	iface.CIDR, iface.ServerIP = cidr, serverIP
+	return tx.Interfaces().Update(ctx, iface)
 }
 
-func (s *WireGuardService) CreatePeer(ctx context.Context, req *models.CreatePeerRequest) (*Peer, error) {
+func (s *WireGuardService) CreatePeer(ctx context.Context, req *models.CreatePeerRequest) (*models.WireGuardPeer, error) {
 	// 0) keepalive 默认 25
 	keepalive := 25
 	if req.PersistentKeepalive != nil && *req.PersistentKeepalive > 0 {
@@ -551,215 +449,277 @@ func (s *WireGuardService) CreatePeer(ctx context.Context, req *models.CreatePee
 	}
 
 	// 生成/获取公钥、私钥
-	var pubKeyStr string
-	var privKeyNull sql.NullString
+	var pubKeyStr, privKeyStr string
 	if req.PublicKey != nil && strings.TrimSpace(*req.PublicKey) != "" {
 		pubKeyStr = strings.TrimSpace(*req.PublicKey)
-		privKeyNull = sql.NullString{Valid: false}
+		if _, err := parseWGPublicKey(pubKeyStr); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrBadRequest, err)
+		}
 	} else {
-		// 自动生成（需 import "golang.zx2c4.com/wireguard/wgctrl/wgtypes"）
-		priv, err := wgtypes.GeneratePrivateKey()
+		priv, pub, err := s.GenerateKeyPair()
 		if err != nil {
 			return nil, fmt.Errorf("%w: generate private key failed: %v", ErrBadRequest, err)
 		}
-		pub := priv.PublicKey()
-		pubKeyStr = pub.String()
-		privKeyNull = sql.NullString{String: priv.String(), Valid: true}
+		pubKeyStr, privKeyStr = pub, priv
 	}
 
-	const maxTries = 5
-	for attempt := 0; attempt < maxTries; attempt++ {
-		// —— 每一轮新事务（避免 SQLite 快照读看不到别的事务新插入的 IP）——
-		tx, err := s.db.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelSerializable})
-		if err != nil {
+	// 服务端 / 客户端 AllowedIPs 分开校验
+	if req.AllowedIPs != nil && strings.TrimSpace(*req.AllowedIPs) != "" {
+		if err := validateServerAllowedIPs(*req.AllowedIPs); err != nil {
 			return nil, err
 		}
-
-		// 1) 读取接口（带 address/cidr/server_ip）
-		var iface struct {
-			ID       uint
-			Name     string
-			Address  sql.NullString
-			CIDR     sql.NullString
-			ServerIP sql.NullString
+	}
+	clientAllowed := ""
+	if req.ClientAllowedIPs != nil {
+		v, err := normalizeClientAllowedIPs(*req.ClientAllowedIPs)
+		if err != nil {
+			return nil, err
 		}
-		row := tx.QueryRowContext(ctx,
-			`SELECT id, name, address, cidr, server_ip FROM wireguard_interfaces WHERE id = ?`,
-			req.InterfaceID,
-		)
-		if err := row.Scan(&iface.ID, &iface.Name, &iface.Address, &iface.CIDR, &iface.ServerIP); err != nil {
-			_ = tx.Rollback()
-			if errors.Is(err, sql.ErrNoRows) {
-				return nil, fmt.Errorf("%w: interface not found", ErrNotFound)
-			}
+		clientAllowed = v
+	}
+	excludedIPs := ""
+	if req.ExcludedIPs != nil {
+		v, err := normalizeExcludedIPs(*req.ExcludedIPs)
+		if err != nil {
 			return nil, err
 		}
+		excludedIPs = v
+	}
 
-		cidr := strings.TrimSpace(iface.CIDR.String)
-		serverIP := strings.TrimSpace(iface.ServerIP.String)
-
-		// 1.1) 缺失则从 address 推导并回写
-		if cidr == "" || serverIP == "" {
-			if iface.Address.Valid && strings.Contains(iface.Address.String, "/") {
-				if ip, ipNet, perr := net.ParseCIDR(strings.TrimSpace(iface.Address.String)); perr == nil && ipNet != nil {
-					cidr = ipNet.String()
-					serverIP = ip.String()
-					if _, perr := tx.ExecContext(ctx,
-						`UPDATE wireguard_interfaces SET cidr = ?, server_ip = ? WHERE id = ?`,
-						cidr, serverIP, iface.ID,
-					); perr != nil {
-						_ = tx.Rollback()
-						return nil, perr
-					}
-				}
+	static := strings.TrimSpace(strFromPtr(req.IP))
+
+	const maxTries = 5
+	for attempt := 0; attempt < maxTries; attempt++ {
+		var peerID int
+		var lease *ipamLease
+		// —— 每一轮新事务（避免 SQLite 快照读看不到别的事务新插入的 IP）——
+		err := s.store.WithTx(ctx, func(tx repository.Store) error {
+			// 1) 读取接口（带 address/cidr/server_ip）
+			iface, err := tx.Interfaces().Get(ctx, int(req.InterfaceID))
+			if err != nil {
+				return mapRepoErr(err, "interface")
+			}
+			if err := checkPeerHost(iface); err != nil {
+				return err
+			}
+			if err := checkPeerPublicKey(ctx, tx, iface.ID, 0, pubKeyStr); err != nil {
+				return err
+			}
+			if err := ensureInterfaceCIDR(ctx, tx, iface); err != nil {
+				return err
+			}
+			profileID, err := checkRoutingProfileID(ctx, tx, req.RoutingProfileID)
+			if err != nil {
+				return err
 			}
-		}
-		if cidr == "" || serverIP == "" {
-			_ = tx.Rollback()
-			return nil, fmt.Errorf("%w: interface missing cidr/server_ip", ErrBadRequest)
-		}
 
-		// 2) 刷新已用 IP（含 server_ip）
-		used := map[string]struct{}{serverIP: {}}
-		rows, err := tx.QueryContext(ctx, `SELECT ip FROM wireguard_peers WHERE interface_id = ?`, req.InterfaceID)
-		if err != nil {
-			_ = tx.Rollback()
-			return nil, err
-		}
-		for rows.Next() {
-			var ip string
-			if err := rows.Scan(&ip); err != nil {
-				rows.Close()
-				_ = tx.Rollback()
-				return nil, err
+			// 2) 3) IPAM 分配：使用缓存的分配视图（地址占用变化后才重建）；
+			// 静态地址先校验，缺失的地址族从指定池（或池外地址）各分配一个
+			fams, err := interfaceFamilies(iface)
+			if err != nil {
+				return err
+			}
+			var ipStr string
+			lease, err = s.leaseIPAMView(ctx, tx, iface.ID, fams, func(view *ipamView) error {
+				if err := view.checkStatic(static); err != nil {
+					return err
+				}
+				ipStr, err = view.assign(strings.TrimSpace(strFromPtr(req.Pool)), static)
+				return err
+			})
+			if err != nil {
+				return err
 			}
-			used[ip] = struct{}{}
-		}
-		if err := rows.Close(); err != nil {
-			_ = tx.Rollback()
-			return nil, err
-		}
 
-		// 3) IPAM 分配
-		ipStr, err := ipam.AllocateNextIP(cidr, used, serverIP)
-		if err != nil {
-			_ = tx.Rollback()
-			if errors.Is(err, ipam.ErrNoAvailableIP) {
-				return nil, fmt.Errorf("%w: no available ip in %s", ErrConflict, cidr)
+			// 4) allowed_ips 兜底
+			allowed := hostCIDR(ipStr)
+			if req.AllowedIPs != nil && strings.TrimSpace(*req.AllowedIPs) != "" {
+				allowed = strings.TrimSpace(*req.AllowedIPs)
 			}
-			return nil, err
-		}
 
-		// 4) allowed_ips 兜底
-		allowed := ""
-		if req.AllowedIPs != nil && strings.TrimSpace(*req.AllowedIPs) != "" {
-			allowed = strings.TrimSpace(*req.AllowedIPs)
-		} else {
-			if net.ParseIP(ipStr).To4() != nil {
-				allowed = fmt.Sprintf("%s/32", ipStr)
-			} else {
-				allowed = fmt.Sprintf("%s/128", ipStr)
+			// 5) 插入（包含 private_key & public_key）
+			p := &models.WireGuardPeer{
+				InterfaceID:         iface.ID,
+				Name:                strings.TrimSpace(req.Name),
+				IP:                  ipStr,
+				AllowedIPs:          allowed,
+				Endpoint:            strings.TrimSpace(strFromPtr(req.Endpoint)),
+				PersistentKeepalive: keepalive,
+				ClientAllowedIPs:    clientAllowed,
+				RoutingProfileID:    profileID,
+				ExcludedIPs:         excludedIPs,
+				PublicKey:           pubKeyStr,
+				PrivateKey:          privKeyStr,
+			}
+			// site：校验对端局域网（routed_subnets）
+			if _, err := s.setPeerSite(ctx, tx, iface, p, req.Type, req.RoutedSubnets); err != nil {
+				return err
+			}
+			if err := tx.Peers().Create(ctx, p); err != nil {
+				return err
+			}
+			peerID = p.ID
+			if err := lease.written(ctx, tx); err != nil {
+				return err
 			}
-		}
 
-		// 5) 插入（包含 private_key & public_key）
-		res, err := tx.ExecContext(ctx,
-			`INSERT INTO wireguard_peers
-			 (interface_id, name, ip, allowed_ips, endpoint, persistent_keepalive, public_key, private_key)
-			 VALUES(?,?,?,?,?,?,?,?)`,
-			req.InterfaceID,
-			strings.TrimSpace(req.Name),
-			ipStr,
-			allowed,
-			nullStr(req.Endpoint),
-			keepalive,
-			pubKeyStr,
-			privKeyNull,
-		)
+			// 6) 分组（不存在的自动创建）
+			if len(req.Groups) > 0 {
+				groupIDs, err := resolvePeerGroups(ctx, tx, req.Groups)
+				if err != nil {
+					return err
+				}
+				if err := tx.PeerGroups().SetPeerGroups(ctx, p.ID, groupIDs); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		lease.done(err == nil)
 		if err != nil {
-			// 精准识别唯一冲突；NOT NULL/外键等不要误判为冲突
-			if isUniqueError(err) {
-				_ = tx.Rollback()
-				continue // 新事务重试
+			// 只有自动分配的地址被并发写入抢占时才换地址重试；静态地址与其他唯一冲突直接返回
+			if errors.Is(err, repository.ErrIPConflict) {
+				if static == "" {
+					continue // 新事务重试
+				}
+				return nil, fmt.Errorf("%w: ip %s already allocated in this interface", ErrConflict, static)
 			}
-			_ = tx.Rollback()
-			return nil, err
-		}
-
-		// 成功
-		id64, _ := res.LastInsertId()
-		peer := &Peer{
-			ID:                  uint(id64),
-			InterfaceID:         req.InterfaceID,
-			Name:                strings.TrimSpace(req.Name),
-			IP:                  ipStr,
-			AllowedIPs:          allowed,
-			Endpoint:            nullStr(req.Endpoint),
-			PersistentKeepalive: keepalive,
-			PublicKey:           sql.NullString{String: pubKeyStr, Valid: true},
-			PrivateKey:          privKeyNull,
-		}
-		if err := tx.Commit(); err != nil {
-			return nil, err
+			return nil, mapRepoErr(err, "peer")
 		}
 		// 可选：wgctrl 下发
-		// _ = s.applyPeerToKernel(ctx, iface.Name, peer)
-		return peer, nil
+		// _ = s.ApplyInterfaceConfig(int(req.InterfaceID))
+		s.syncConfFile(int(req.InterfaceID))
+		s.refreshFirewall(int(req.InterfaceID))
+		return s.GetPeer(peerID)
 	}
 
 	return nil, fmt.Errorf("%w: ip already allocated in this interface", ErrConflict)
 }
 
-func (s *WireGuardService) UpdatePeer(ctx context.Context, id int, req *models.UpdatePeerRequest) (*Peer, error) {
-	// 动态拼 UPDATE
-	set := []string{}
-	args := []any{}
+// checkPeerPublicKey 拒绝同一接口下重复的公钥（内核会把它们当作同一个 peer）；exceptID 为正在修改的 peer
+func checkPeerPublicKey(ctx context.Context, st repository.Store, interfaceID, exceptID int, publicKey string) error {
+	peers, err := st.Peers().ListByInterface(ctx, interfaceID)
+	if err != nil {
+		return err
+	}
+	for _, p := range peers {
+		if p.ID != exceptID && p.PublicKey == publicKey {
+			return fmt.Errorf("%w: public key already used by peer %q", ErrConflict, p.Name)
+		}
+	}
+	return nil
+}
+
+func (s *WireGuardService) UpdatePeer(ctx context.Context, id int, req *models.UpdatePeerRequest) (*models.WireGuardPeer, error) {
+	p, err := s.store.Peers().Get(ctx, id)
+	if err != nil {
+		return nil, mapRepoErr(err, "peer")
+	}
 
+	// 记录会下发到内核的字段，更新后比较以决定是否重新应用运行中的接口
+	oldAllowed, oldEndpoint, oldKeepalive := p.AllowedIPs, p.Endpoint, p.PersistentKeepalive
+	changed := false
 	if req.Name != nil {
-		set = append(set, "name = ?")
-		args = append(args, strings.TrimSpace(*req.Name))
+		p.Name = strings.TrimSpace(*req.Name)
+		changed = true
 	}
 	if req.AllowedIPs != nil {
-		set = append(set, "allowed_ips = ?")
-		args = append(args, strings.TrimSpace(*req.AllowedIPs))
+		p.AllowedIPs = strings.TrimSpace(*req.AllowedIPs)
+		if p.AllowedIPs == "" {
+			p.AllowedIPs = hostCIDR(p.IP)
+		}
+		if err := validateServerAllowedIPs(p.AllowedIPs); err != nil {
+			return nil, err
+		}
+		changed = true
+	}
+	if req.ClientAllowedIPs != nil {
+		v, err := normalizeClientAllowedIPs(*req.ClientAllowedIPs)
+		if err != nil {
+			return nil, err
+		}
+		p.ClientAllowedIPs = v
+		changed = true
+	}
+	if req.ExcludedIPs != nil {
+		v, err := normalizeExcludedIPs(*req.ExcludedIPs)
+		if err != nil {
+			return nil, err
+		}
+		p.ExcludedIPs = v
+		changed = true
+	}
+	if req.RoutingProfileID != nil {
+		id, err := checkRoutingProfileID(ctx, s.store, req.RoutingProfileID)
+		if err != nil {
+			return nil, err
+		}
+		p.RoutingProfileID = id
+		changed = true
 	}
 	if req.Endpoint != nil {
-		set = append(set, "endpoint = ?")
-		args = append(args, nullStr(req.Endpoint))
+		p.Endpoint = strings.TrimSpace(*req.Endpoint)
+		changed = true
 	}
 	if req.PersistentKeepalive != nil && *req.PersistentKeepalive > 0 {
-		set = append(set, "persistent_keepalive = ?")
-		args = append(args, *req.PersistentKeepalive)
+		p.PersistentKeepalive = *req.PersistentKeepalive
+		changed = true
+	}
+	toggled := req.Disabled != nil && *req.Disabled != p.Disabled
+	if toggled {
+		p.Disabled = *req.Disabled
+		changed = true
+	}
+	routesChanged := false
+	if req.Type != nil || req.RoutedSubnets != nil {
+		iface, err := s.store.Interfaces().Get(ctx, p.InterfaceID)
+		if err != nil {
+			return nil, mapRepoErr(err, "interface")
+		}
+		if routesChanged, err = s.setPeerSite(ctx, s.store, iface, p, req.Type, req.RoutedSubnets); err != nil {
+			return nil, err
+		}
+		changed = changed || routesChanged
 	}
 
-	if len(set) == 0 {
+	if !changed && req.Groups == nil {
 		// 没有要更新的字段，直接返回当前
-		return s.getPeerByID(ctx, id)
+		return s.GetPeer(id)
 	}
-
-	args = append(args, id)
-
-	q := "UPDATE wireguard_peers SET " + strings.Join(set, ", ") + " WHERE id = ?"
-	if _, err := s.db.ExecContext(ctx, q, args...); err != nil {
+	err = s.store.WithTx(ctx, func(tx repository.Store) error {
+		if changed {
+			if err := tx.Peers().Update(ctx, p); err != nil {
+				return mapRepoErr(err, "peer")
+			}
+		}
+		if req.Groups != nil {
+			groupIDs, err := resolvePeerGroups(ctx, tx, *req.Groups)
+			if err != nil {
+				return err
+			}
+			return tx.PeerGroups().SetPeerGroups(ctx, p.ID, groupIDs)
+		}
+		return nil
+	})
+	if err != nil {
 		return nil, err
 	}
-	return s.getPeerByID(ctx, id)
-}
-
-func (s *WireGuardService) getPeerByID(ctx context.Context, id int) (*Peer, error) {
-	row := s.db.QueryRowContext(ctx, `
-	SELECT id, interface_id, name, ip, allowed_ips,
-			COALESCE(endpoint,''), persistent_keepalive,
-			COALESCE(public_key,''), COALESCE(private_key,'')
-	FROM wireguard_peers WHERE id = ?`, id)
-
-	var p Peer // 这里 Peer 的 endpoint/public_key/private_key 都是 string
-	if err := row.Scan(
-		&p.ID, &p.InterfaceID, &p.Name, &p.IP, &p.AllowedIPs,
-		&p.Endpoint, &p.PersistentKeepalive, &p.PublicKey, &p.PrivateKey,
-	); err != nil { /* ... */
+	if changed {
+		s.syncConfFile(p.InterfaceID)
+	}
+	// 启用/停用、AllowedIPs/Endpoint/Keepalive、site 网段变化需要立即更新内核中的 peer 与路由
+	// （ApplyInterfaceConfig 末尾会重建管理表）；否则只有分组等变化可能影响 ACL，刷新管理表即可
+	kernelChanged := toggled || routesChanged || p.AllowedIPs != oldAllowed ||
+		p.Endpoint != oldEndpoint || p.PersistentKeepalive != oldKeepalive
+	if it, err := s.store.Interfaces().Get(ctx, p.InterfaceID); err == nil && it.Status == "running" && kernelChanged {
+		if err := s.ApplyInterfaceConfig(p.InterfaceID); err != nil {
+			log.Printf("[wg] apply %s after peer %d update: %v", it.Name, p.ID, err)
+			s.refreshFirewall(p.InterfaceID)
+		}
+	} else {
+		s.refreshFirewall(p.InterfaceID)
 	}
-	return &p, nil
+	return s.GetPeer(id)
 }
 
 func (s *WireGuardService) DeletePeer(id int) error {
@@ -767,189 +727,260 @@ func (s *WireGuardService) DeletePeer(id int) error {
 	if err != nil {
 		return err
 	}
-	_, err = s.db.Exec(`DELETE FROM wireguard_peers WHERE id=?`, id)
+	ctx := context.Background()
+	err = s.store.WithTx(ctx, func(tx repository.Store) error {
+		if err := tx.Peers().Delete(ctx, id); err != nil {
+			return mapRepoErr(err, "peer")
+		}
+		return s.quarantineIPs(ctx, tx, p.InterfaceID, p.Name, p.IP, "")
+	})
 	if err != nil {
-		return fmt.Errorf("delete peer: %w", err)
+		return err
 	}
 	// 热更新：从内核清理
 	_ = s.ApplyInterfaceConfig(p.InterfaceID)
+	s.syncConfFile(p.InterfaceID)
 	return nil
 }
 
 /* -------------------- 配置导出（.conf 文本） -------------------- */
 
 func (s *WireGuardService) GetInterfaceConfig(id int) (string, error) {
-    iface, err := s.GetInterface(id)
-    if err != nil {
-        return "", err
-    }
-    if strings.TrimSpace(iface.PrivateKey) == "" {
-        return "", errors.New("interface private key missing")
-    }
-    if iface.ListenPort == 0 {
-        return "", errors.New("listen port required")
-    }
-    if strings.TrimSpace(iface.Address) == "" {
-        return "", errors.New("address required")
-    }
-
-    peers, err := s.GetPeersByInterface(id)
-    if err != nil {
-        return "", err
-    }
-
-    var b strings.Builder
-    fmt.Fprintf(&b, "[Interface]\nPrivateKey = %s\nAddress = %s\nListenPort = %d\n",
-        strings.TrimSpace(iface.PrivateKey),
-        strings.TrimSpace(iface.Address),
-        iface.ListenPort,
-    )
-    if iface.MTU > 0 {
-        fmt.Fprintf(&b, "MTU = %d\n", iface.MTU)
-    }
-    if dns := strings.TrimSpace(iface.DNS); dns != "" {
-        fmt.Fprintf(&b, "DNS = %s\n", dns)
-    }
-
-    for _, p := range peers {
-        pk := strings.TrimSpace(p.PublicKey)
-        if pk == "" {
-            continue
-        }
-        fmt.Fprintf(&b, "\n[Peer]\nPublicKey = %s\n", pk)
-
-        // AllowedIPs（服务端应为客户端隧道地址；若配置了默认路由则改为 /32 或 /128）
-        allowed := strings.TrimSpace(p.AllowedIPs)
-        if allowed == "" || containsDefaultRoute(allowed) {
-            ip := strings.TrimSpace(p.IP) // 若 GetPeersByInterface 未选出 ip，建议一并补上
-            if ip != "" {
-                if net.ParseIP(ip).To4() != nil {
-                    allowed = ip + "/32"
-                } else {
-                    allowed = ip + "/128"
-                }
-            } else {
-                // 如果没有 ip，保持空，避免误下发默认路由
-                allowed = ""
-            }
-        }
-        if allowed != "" {
-            fmt.Fprintf(&b, "AllowedIPs = %s\n", allowed)
-        }
-
-        if ep := strings.TrimSpace(p.Endpoint); ep != "" {
-            // 服务端一般不需要 Endpoint；如做站点间固定对接可保留
-            fmt.Fprintf(&b, "Endpoint = %s\n", ep)
-        }
-        if p.PersistentKeepalive > 0 {
-            fmt.Fprintf(&b, "PersistentKeepalive = %d\n", p.PersistentKeepalive)
-        }
-    }
-
-    return b.String(), nil
+	iface, err := s.GetInterface(id)
+	if err != nil {
+		return "", err
+	}
+	peers, err := s.GetPeersByInterface(id)
+	if err != nil {
+		return "", err
+	}
+	var f *wgconf.File
+	if iface.Mode == models.InterfaceModeClient {
+		f, err = s.clientConfFile(context.Background(), iface)
+	} else {
+		f, err = interfaceConfFile(iface, peers)
+	}
+	if err != nil {
+		return "", err
+	}
+	return wgconf.Render(f), nil
+}
+
+/* -------------------- 配置落盘（<name>.conf） -------------------- */
+
+// syncConfFile 在变更后重写接口的 .conf；DB 变更已提交，失败只记日志，可通过 conf-file 接口查看/强制写入
+func (s *WireGuardService) syncConfFile(id int) {
+	if s.conf == nil {
+		return
+	}
+	if _, err := s.WriteConfFile(id, false); err != nil {
+		log.Printf("[conf] interface %d: %v", id, err)
+	}
+}
+
+func (s *WireGuardService) removeConfFile(name string) {
+	if s.conf == nil {
+		return
+	}
+	if err := s.conf.Remove(context.Background(), name, false); err != nil {
+		log.Printf("[conf] remove %s: %v", name, err)
+	}
 }
 
+func (s *WireGuardService) confWriter() (*ConfWriter, error) {
+	if s.conf == nil {
+		return nil, fmt.Errorf("%w: writing config files is disabled (set WG_WRITE_CONF=true)", ErrBadRequest)
+	}
+	return s.conf, nil
+}
+
+// ConfFileStatus 返回接口 .conf 文件与当前配置的一致性及差异
+func (s *WireGuardService) ConfFileStatus(id int) (*ConfFileStatus, error) {
+	w, err := s.confWriter()
+	if err != nil {
+		return nil, err
+	}
+	iface, err := s.GetInterface(id)
+	if err != nil {
+		return nil, err
+	}
+	content, err := s.GetInterfaceConfig(id)
+	if err != nil {
+		return nil, err
+	}
+	return w.Status(context.Background(), iface.Name, content)
+}
+
+// WriteConfFile 写出接口 .conf；force 为 true 时覆盖手工修改过的文件（旧文件保留为 .bak）
+func (s *WireGuardService) WriteConfFile(id int, force bool) (*ConfFileStatus, error) {
+	w, err := s.confWriter()
+	if err != nil {
+		return nil, err
+	}
+	iface, err := s.GetInterface(id)
+	if err != nil {
+		return nil, err
+	}
+	content, err := s.GetInterfaceConfig(id)
+	if err != nil {
+		return nil, err
+	}
+	return w.Write(context.Background(), iface.Name, content, force)
+}
+
+// interfaceConfFile 组装服务端配置模型（.conf 导出与落盘共用）
+func interfaceConfFile(iface *models.WireGuardInterface, peers []models.WireGuardPeer) (*wgconf.File, error) {
+	if strings.TrimSpace(iface.PrivateKey) == "" {
+		return nil, errors.New("interface private key missing")
+	}
+	if iface.ListenPort == 0 {
+		return nil, errors.New("listen port required")
+	}
+	if strings.TrimSpace(iface.Address) == "" {
+		return nil, errors.New("address required")
+	}
+
+	f := &wgconf.File{
+		Interface: wgconf.Interface{
+			PrivateKey: strings.TrimSpace(iface.PrivateKey),
+			Address:    splitCSV(iface.Address),
+			ListenPort: iface.ListenPort,
+			MTU:        iface.MTU,
+			DNS:        splitCSV(iface.DNS),
+			PreUp:      hookLines(iface.PreUp),
+			PostUp:     hookLines(iface.PostUp),
+			PreDown:    hookLines(iface.PreDown),
+			PostDown:   hookLines(iface.PostDown),
+		},
+	}
+
+	for _, p := range peers {
+		pk := strings.TrimSpace(p.PublicKey)
+		if pk == "" || p.Disabled {
+			continue
+		}
+
+		// AllowedIPs（服务端：路由到该 peer 的网段，默认为隧道 IP 的主机路由，site 另加对端局域网）；
+		// 默认路由在写入时已被拒绝、旧数据已迁移，这里仍兜底以免把全部流量导向单个 peer
+		if containsDefaultRoute(p.AllowedIPs) {
+			log.Printf("[conf] peer %d (%s): ignoring default route in server-side allowed_ips", p.ID, p.Name)
+			p.AllowedIPs = ""
+		}
+		allowed := serverAllowedIPs(&p) // 如果没有 ip，保持空
+
+		f.Peers = append(f.Peers, wgconf.Peer{
+			Name:         p.Name,
+			PublicKey:    pk,
+			PresharedKey: strings.TrimSpace(p.PresharedKey),
+			AllowedIPs:   splitCSV(allowed),
+			// 服务端一般不需要 Endpoint；如做站点间固定对接可保留
+			Endpoint:            strings.TrimSpace(p.Endpoint),
+			PersistentKeepalive: p.PersistentKeepalive,
+		})
+	}
+	return f, nil
+}
 
 func (s *WireGuardService) GetPeerConfig(peerID int, regenerate bool) (string, error) {
-    row := s.db.QueryRow(`
-        SELECT
-          p.interface_id,
-          COALESCE(p.name,''),
-          COALESCE(p.private_key,''),      -- 客户端私钥
-          COALESCE(p.ip,''),
-          COALESCE(p.persistent_keepalive,0),
-
-          COALESCE(i.name,''),
-          i.listen_port,
-          COALESCE(i.address,''),
-          COALESCE(i.cidr,''),
-          COALESCE(i.server_ip,''),
-          COALESCE(i.dns,''),
-          COALESCE(i.public_key,'')        -- 服务器公钥（给 [Peer].PublicKey）
-        FROM wireguard_peers p
-        JOIN wireguard_interfaces i ON i.id = p.interface_id
-        WHERE p.id = ?`, peerID)
-
-    var (
-        ifaceID int
-        pName, privKey, peerIP string
-        keepalive int
-        ifName, ifAddress, ifCIDR, serverIP, dns, serverPub string
-        listenPort int
-    )
-    if err := row.Scan(&ifaceID, &pName, &privKey, &peerIP, &keepalive,
-        &ifName, &listenPort, &ifAddress, &ifCIDR, &serverIP, &dns, &serverPub); err != nil {
-        if errors.Is(err, sql.ErrNoRows) { return "", fmt.Errorf("peer not found") }
-        return "", err
-    }
-
-    // 若无私钥：按需旋转（生成新对，更新 DB & 内核）
-    if strings.TrimSpace(privKey) == "" {
-        if !regenerate {
-            return "", fmt.Errorf("peer private key missing (add ?regenerate=1 to rotate)")
-        }
-        priv, err := wgtypes.GeneratePrivateKey()
-        if err != nil { return "", fmt.Errorf("generate private key: %w", err) }
-        pub := priv.PublicKey().String()
-
-        if _, err := s.db.Exec(`UPDATE wireguard_peers SET private_key=?, public_key=?, updated_at=CURRENT_TIMESTAMP WHERE id=?`,
-            priv.String(), pub, peerID); err != nil {
-            return "", err
-        }
-        privKey = priv.String()
-        // 让内核同步使用新公钥
-        _ = s.ApplyInterfaceConfig(ifaceID)
-    }
-
-    // 推导 CIDR/server_ip（若表里为空，从 address 推）
-    if strings.TrimSpace(ifCIDR) == "" || strings.TrimSpace(serverIP) == "" {
-        if ip, ipNet, err := net.ParseCIDR(strings.TrimSpace(ifAddress)); err == nil && ipNet != nil {
-            if strings.TrimSpace(ifCIDR) == "" { ifCIDR = ipNet.String() }
-            if strings.TrimSpace(serverIP) == "" { serverIP = ip.String() }
-        }
-    }
-    _, ipNet, err := net.ParseCIDR(strings.TrimSpace(ifCIDR))
-    if err != nil { return "", fmt.Errorf("bad interface cidr: %v", err) }
-    if strings.TrimSpace(peerIP) == "" { return "", fmt.Errorf("peer ip missing") }
-    ones, _ := ipNet.Mask.Size()
-
-    address := fmt.Sprintf("%s/%d", strings.TrimSpace(peerIP), ones)
-    allowed := strings.TrimSpace(ifCIDR)
-
-    host := strings.TrimSpace(os.Getenv("WG_PUBLIC_ENDPOINT"))
-    if host == "" { host = strings.TrimSpace(serverIP) }
-    endpoint := net.JoinHostPort(host, strconv.Itoa(listenPort))
-
-    if keepalive <= 0 { keepalive = 25 }
-    if strings.TrimSpace(dns) == "" { dns = "1.1.1.1" }
-
-    cfg := strings.TrimSpace(fmt.Sprintf(`[Interface]
-PrivateKey = %s
-Address = %s
-DNS = %s
-
-[Peer]
-PublicKey = %s
-AllowedIPs = %s
-Endpoint = %s
-PersistentKeepalive = %d
-`, strings.TrimSpace(privKey), address, strings.TrimSpace(dns),
-        strings.TrimSpace(serverPub), allowed, endpoint, keepalive))
-
-    return cfg, nil
+	f, _, err := s.peerConfFile(peerID, regenerate)
+	if err != nil {
+		return "", err
+	}
+	return wgconf.Render(f), nil
+}
+
+// endpointHost 是客户端连接服务端用的主机：WG_PUBLIC_ENDPOINT，未设置时取接口首个地址族的服务端地址
+func endpointHost(fams []addrFamily) string {
+	if host := strings.TrimSpace(os.Getenv("WG_PUBLIC_ENDPOINT")); host != "" {
+		return host
+	}
+	return fams[0].Server.String()
+}
+
+// peerConfFile 组装客户端配置模型（各导出格式共用），同时返回所属接口
+func (s *WireGuardService) peerConfFile(peerID int, regenerate bool) (*wgconf.File, *models.WireGuardInterface, error) {
+	ctx := context.Background()
+	p, err := s.GetPeer(peerID)
+	if err != nil {
+		return nil, nil, err
+	}
+	iface, err := s.GetInterface(p.InterfaceID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// 若无私钥：按需旋转（生成新对，更新 DB & 内核）
+	if strings.TrimSpace(p.PrivateKey) == "" {
+		if !regenerate {
+			return nil, nil, fmt.Errorf("%w: peer private key missing (add ?regenerate=1 to rotate)", ErrBadRequest)
+		}
+		priv, pub, err := s.GenerateKeyPair()
+		if err != nil {
+			return nil, nil, err
+		}
+		p.PrivateKey, p.PublicKey = priv, pub
+		if err := s.store.Peers().Update(ctx, p); err != nil {
+			return nil, nil, mapRepoErr(err, "peer")
+		}
+		// 让内核同步使用新公钥
+		_ = s.ApplyInterfaceConfig(p.InterfaceID)
+		s.syncConfFile(p.InterfaceID)
+	}
+
+	// 网段/服务端地址一律从 address 推导（双栈时每个地址族一项）
+	fams, err := interfaceFamilies(iface)
+	if err != nil {
+		return nil, nil, err
+	}
+	if strings.TrimSpace(p.IP) == "" {
+		return nil, nil, fmt.Errorf("peer ip missing")
+	}
+	ifCIDR := clientTunnelCIDRs(iface, fams, p)
+
+	keepalive := p.PersistentKeepalive
+	if keepalive <= 0 {
+		keepalive = 25
+	}
+	dns := strings.TrimSpace(iface.DNS)
+	if dns == "" {
+		dns = "1.1.1.1"
+	}
+	if p.Type == models.PeerTypeSite {
+		dns = "" // 对端是站点网关，不接管其 DNS
+	}
+	allowed, err := s.clientAllowedIPs(ctx, p, ifCIDR)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	f := &wgconf.File{
+		Name: p.Name,
+		Interface: wgconf.Interface{
+			PrivateKey: strings.TrimSpace(p.PrivateKey),
+			Address:    peerInterfaceAddress(fams, p.IP),
+			DNS:        splitCSV(dns),
+		},
+		Peers: []wgconf.Peer{{
+			Name:                iface.Name,
+			PublicKey:           strings.TrimSpace(iface.PublicKey),
+			PresharedKey:        strings.TrimSpace(p.PresharedKey),
+			AllowedIPs:          allowed,
+			Endpoint:            interfaceEndpoint(iface, fams),
+			PersistentKeepalive: keepalive,
+		}},
+	}
+	return f, iface, nil
 }
 
 /* -------------------- 核心：应用配置到内核（wgctrl） -------------------- */
 
 // 把 DB 中的 interface+peers 一次性下发到内核（幂等，ReplacePeers）
 func (s *WireGuardService) ApplyInterfaceConfig(interfaceID int) error {
-	if s.client == nil {
-		c, err := wgctrl.New()
-		if err != nil {
-			return fmt.Errorf("wgctrl new: %w", err)
-		}
-		s.client = c
+	client, err := s.wgClient()
+	if err != nil {
+		return err
 	}
+	ctx := context.Background()
 
 	iface, err := s.GetInterface(interfaceID)
 	if err != nil {
@@ -964,13 +995,18 @@ func (s *WireGuardService) ApplyInterfaceConfig(interfaceID int) error {
 	}
 	// 若 DB 公钥为空，用私钥派生并回写一次
 	if strings.TrimSpace(iface.PublicKey) == "" {
-		_, _ = s.db.Exec(`UPDATE wireguard_interfaces SET public_key=?, updated_at=CURRENT_TIMESTAMP WHERE id=?`, priv.PublicKey().String(), iface.ID)
+		iface.PublicKey = priv.PublicKey().String()
+		_ = s.store.Interfaces().Update(ctx, iface)
 	}
 
 	// 1) 确保链路存在
 	if err := ipEnsureLink(iface.Name); err != nil {
 		return err
 	}
+	// 客户端模式：只有一个远端 peer，路由与策略规则另行处理
+	if iface.Mode == models.InterfaceModeClient {
+		return s.applyClientInterface(ctx, iface, priv)
+	}
 
 	// 2) 组装 PeerConfig
 	peers, err := s.GetPeersByInterface(interfaceID)
@@ -978,15 +1014,17 @@ func (s *WireGuardService) ApplyInterfaceConfig(interfaceID int) error {
 		return err
 	}
 	var peerCfgs []wgtypes.PeerConfig
+	resolved := map[int]string{} // peer ID -> 本次下发的 endpoint 地址
 	for _, p := range peers {
-		if strings.TrimSpace(p.PublicKey) == "" {
+		// 停用的 peer 不下发，ReplacePeers 会把它从内核移除
+		if strings.TrimSpace(p.PublicKey) == "" || p.Disabled {
 			continue
 		}
 		pub, err := parseWGPublicKey(p.PublicKey)
 		if err != nil {
 			return fmt.Errorf("peer %d pubkey: %w", p.ID, err)
 		}
-		allowed, err := parseAllowedIPs(p.AllowedIPs)
+		allowed, err := parseAllowedIPs(serverAllowedIPs(&p))
 		if err != nil {
 			return fmt.Errorf("peer %d allowedIPs: %w", p.ID, err)
 		}
@@ -997,6 +1035,9 @@ func (s *WireGuardService) ApplyInterfaceConfig(interfaceID int) error {
 				return fmt.Errorf("peer %d endpoint: %w", p.ID, err)
 			}
 		}
+		if eps != nil && eps.String() != p.ResolvedEndpoint {
+			resolved[p.ID] = eps.String()
+		}
 		pc := wgtypes.PeerConfig{
 			PublicKey:                   *pub,
 			Remove:                      false,
@@ -1005,6 +1046,13 @@ func (s *WireGuardService) ApplyInterfaceConfig(interfaceID int) error {
 			PersistentKeepaliveInterval: durationPtrSeconds(p.PersistentKeepalive),
 			Endpoint:                    eps,
 		}
+		if psk := strings.TrimSpace(p.PresharedKey); psk != "" {
+			k, err := wgtypes.ParseKey(psk)
+			if err != nil {
+				return fmt.Errorf("peer %d preshared key: %w", p.ID, err)
+			}
+			pc.PresharedKey = &k
+		}
 		peerCfgs = append(peerCfgs, pc)
 	}
 
@@ -1015,9 +1063,12 @@ func (s *WireGuardService) ApplyInterfaceConfig(interfaceID int) error {
 		ReplacePeers: true,
 		Peers:        peerCfgs,
 	}
-	if err := s.client.ConfigureDevice(iface.Name, cfg); err != nil {
+	if err := client.ConfigureDevice(iface.Name, cfg); err != nil {
 		return fmt.Errorf("configure device: %w", err)
 	}
+	for id, ep := range resolved {
+		_ = s.store.Peers().SetResolvedEndpoint(ctx, id, ep)
+	}
 
 	// 4) 地址/MTU & up
 	if err := ipAddrReplace(iface.Name, iface.Address); err != nil {
@@ -1029,28 +1080,71 @@ func (s *WireGuardService) ApplyInterfaceConfig(interfaceID int) error {
 	if err := ipLinkUp(iface.Name); err != nil {
 		return err
 	}
+	// site peer 背后的局域网：wireguard 设备不会自动加路由（wg-quick 才会）
+	if err := ipRouteSync(iface.Name, "", siteRoutes(peers)); err != nil {
+		return err
+	}
 
-	_, _ = s.db.Exec(`UPDATE wireguard_interfaces SET status='running', updated_at=CURRENT_TIMESTAMP WHERE id=?`, interfaceID)
-	return nil
+	_ = s.store.Interfaces().SetStatus(ctx, interfaceID, "running")
+
+	// 5) 网关规则（NAT / 转发）：按运行中的接口重建管理表
+	return s.applyGatewayRules(ctx, interfaceID)
 }
 
 /* -------------------- 启停（不再用 wg-quick） -------------------- */
 
+// StartInterface 依次执行 PreUp、下发配置、PostUp；与 wg-quick 一样，PostUp 失败时拆除接口
 func (s *WireGuardService) StartInterface(id int) error {
-	return s.ApplyInterfaceConfig(id)
+	iface, err := s.GetInterface(id)
+	if err != nil {
+		return err
+	}
+	ctx := context.Background()
+	if err := s.runHooks(ctx, iface, "PreUp", iface.PreUp); err != nil {
+		return err
+	}
+	if err := s.ApplyInterfaceConfig(id); err != nil {
+		return err
+	}
+	if err := s.runHooks(ctx, iface, "PostUp", iface.PostUp); err != nil {
+		s.downInterface(iface)
+		return err
+	}
+	return nil
 }
 
+// StopInterface 依次执行 PreDown、删除链路、PostDown；hook 失败不阻止停止，结果见事件日志
 func (s *WireGuardService) StopInterface(id int) error {
 	iface, err := s.GetInterface(id)
 	if err != nil {
 		return err
 	}
+	ctx := context.Background()
+	if err := s.runHooks(ctx, iface, "PreDown", iface.PreDown); err != nil {
+		log.Printf("[hook] %s: %v", iface.Name, err)
+	}
+	s.downInterface(iface)
+	if err := s.runHooks(ctx, iface, "PostDown", iface.PostDown); err != nil {
+		log.Printf("[hook] %s: %v", iface.Name, err)
+	}
+	return nil
+}
+
+// downInterface 删除链路、标记为已停止并移除该接口的管理规则（不执行 hook）
+func (s *WireGuardService) downInterface(iface *models.WireGuardInterface) {
 	// 先 link down，再删设备（更干净）
 	_ = ipLinkDown(iface.Name)
 	_ = ipLinkDel(iface.Name)
+	if iface.Mode == models.InterfaceModeClient {
+		s.downClientInterface(context.Background(), iface)
+	}
 
-	_, _ = s.db.Exec(`UPDATE wireguard_interfaces SET status='stopped', updated_at=CURRENT_TIMESTAMP WHERE id=?`, id)
-	return nil
+	_ = s.store.Interfaces().SetStatus(context.Background(), iface.ID, "stopped")
+
+	// 停止后该接口的规则不再生成，重建即移除
+	if err := s.syncFirewall(context.Background()); err != nil {
+		log.Printf("[firewall] remove rules of %s: %v", iface.Name, err)
+	}
 }
 
 func (s *WireGuardService) RestartInterface(id int) error {
@@ -0,0 +1,340 @@
+package wgconf
+
+import (
+	"crypto/sha1"
+	"fmt"
+	"net"
+	"net/netip"
+	"strings"
+)
+
+// 其它网络管理器的配置格式，均由同一个 File 生成；ifname 为客户端上的接口名
+
+/* -------------------- NetworkManager keyfile -------------------- */
+
+// RenderNetworkManager 输出 /etc/NetworkManager/system-connections/<id>.nmconnection（需 0600）
+func RenderNetworkManager(f *File, ifname string) string {
+	var b strings.Builder
+	it := f.Interface
+	id := f.Name
+	if id == "" {
+		id = ifname
+	}
+
+	b.WriteString("[connection]\n")
+	fmt.Fprintf(&b, "id=%s\n", id)
+	fmt.Fprintf(&b, "uuid=%s\n", stableUUID(ifname+"\x00"+it.PrivateKey))
+	b.WriteString("type=wireguard\n")
+	fmt.Fprintf(&b, "interface-name=%s\n", ifname)
+
+	b.WriteString("\n[wireguard]\n")
+	writeIni(&b, "private-key", it.PrivateKey)
+	if it.ListenPort > 0 {
+		fmt.Fprintf(&b, "listen-port=%d\n", it.ListenPort)
+	}
+	if it.MTU > 0 {
+		fmt.Fprintf(&b, "mtu=%d\n", it.MTU)
+	}
+	if it.FwMark != "" {
+		writeIni(&b, "fwmark", it.FwMark)
+	}
+
+	for _, p := range f.Peers {
+		fmt.Fprintf(&b, "\n[wireguard-peer.%s]\n", p.PublicKey)
+		writeIni(&b, "endpoint", p.Endpoint)
+		if p.PresharedKey != "" {
+			writeIni(&b, "preshared-key", p.PresharedKey)
+			b.WriteString("preshared-key-flags=0\n")
+		}
+		if p.PersistentKeepalive > 0 {
+			fmt.Fprintf(&b, "persistent-keepalive=%d\n", p.PersistentKeepalive)
+		}
+		writeIni(&b, "allowed-ips", nmList(p.AllowedIPs))
+	}
+
+	v4, v6 := splitFamily(it.Address)
+	dns4, dns6 := splitFamily(it.DNS)
+	writeNMIP(&b, "ipv4", v4, dns4)
+	writeNMIP(&b, "ipv6", v6, dns6)
+	return b.String()
+}
+
+func writeNMIP(b *strings.Builder, section string, addrs, dns []string) {
+	fmt.Fprintf(b, "\n[%s]\n", section)
+	if len(addrs) == 0 {
+		if section == "ipv6" {
+			b.WriteString("method=ignore\n")
+		} else {
+			b.WriteString("method=disabled\n")
+		}
+		return
+	}
+	for i, a := range addrs {
+		fmt.Fprintf(b, "address%d=%s\n", i+1, a)
+	}
+	writeIni(b, "dns", nmList(dns))
+	b.WriteString("method=manual\n")
+}
+
+// NetworkManager 的列表以 ";" 结尾
+func nmList(v []string) string {
+	if len(v) == 0 {
+		return ""
+	}
+	return strings.Join(v, ";") + ";"
+}
+
+// stableUUID 由 seed 派生固定的 UUID（v5 布局），重复导出时 NM 视为同一连接
+func stableUUID(seed string) string {
+	h := sha1.Sum([]byte(seed))
+	h[6] = (h[6] & 0x0f) | 0x50
+	h[8] = (h[8] & 0x3f) | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", h[0:4], h[4:6], h[6:8], h[8:10], h[10:16])
+}
+
+/* -------------------- systemd-networkd -------------------- */
+
+// RenderSystemd 输出 <ifname>.netdev 与 <ifname>.network；
+// .netdev 含私钥，应为 0640 root:systemd-network
+func RenderSystemd(f *File, ifname string) (netdev, network string) {
+	var nd strings.Builder
+	it := f.Interface
+
+	nd.WriteString("[NetDev]\n")
+	fmt.Fprintf(&nd, "Name=%s\n", ifname)
+	nd.WriteString("Kind=wireguard\n")
+	if f.Name != "" {
+		fmt.Fprintf(&nd, "Description=%s\n", f.Name)
+	}
+	if it.MTU > 0 {
+		fmt.Fprintf(&nd, "MTUBytes=%d\n", it.MTU)
+	}
+
+	rt := systemdRouting(f)
+
+	nd.WriteString("\n[WireGuard]\n")
+	writeIni(&nd, "PrivateKey", it.PrivateKey)
+	if it.ListenPort > 0 {
+		fmt.Fprintf(&nd, "ListenPort=%d\n", it.ListenPort)
+	}
+	writeIni(&nd, "FirewallMark", rt.fwmark)
+
+	for _, p := range f.Peers {
+		nd.WriteString("\n[WireGuardPeer]\n")
+		writeIni(&nd, "PublicKey", p.PublicKey)
+		writeIni(&nd, "PresharedKey", p.PresharedKey)
+		writeIni(&nd, "AllowedIPs", strings.Join(p.AllowedIPs, ","))
+		writeIni(&nd, "Endpoint", p.Endpoint)
+		if p.PersistentKeepalive > 0 {
+			fmt.Fprintf(&nd, "PersistentKeepalive=%d\n", p.PersistentKeepalive)
+		}
+	}
+
+	var nw strings.Builder
+	nw.WriteString("[Match]\n")
+	fmt.Fprintf(&nw, "Name=%s\n", ifname)
+	nw.WriteString("\n[Network]\n")
+	for _, a := range it.Address {
+		writeIni(&nw, "Address", a)
+	}
+	for _, d := range it.DNS {
+		writeIni(&nw, "DNS", d)
+	}
+	if rt.off {
+		return nd.String(), nw.String()
+	}
+
+	// networkd 不会按 AllowedIPs 建路由；地址自带的网段路由已存在，不再重复添加
+	connected := map[netip.Prefix]bool{}
+	for _, a := range it.Address {
+		if p, err := netip.ParsePrefix(a); err == nil {
+			connected[p.Masked()] = true
+		}
+	}
+	for _, p := range f.Peers {
+		for _, a := range p.AllowedIPs {
+			pfx, err := netip.ParsePrefix(a)
+			if err == nil && connected[pfx.Masked()] {
+				continue
+			}
+			nw.WriteString("\n[Route]\n")
+			fmt.Fprintf(&nw, "Destination=%s\n", a)
+			if table := rt.tableFor(pfx); table != "" {
+				fmt.Fprintf(&nw, "Table=%s\n", table)
+			}
+		}
+	}
+
+	// 同 wg-quick 的 Table=auto：默认路由放进独立路由表，隧道自身的（带 fwmark 的）报文仍走 main 表，
+	// main 表中除默认路由外的路由仍优先
+	for _, fam := range rt.policyFams {
+		nw.WriteString("\n[RoutingPolicyRule]\n")
+		fmt.Fprintf(&nw, "Family=%s\n", fam)
+		fmt.Fprintf(&nw, "FirewallMark=%s\n", rt.fwmark)
+		nw.WriteString("InvertRule=yes\n")
+		fmt.Fprintf(&nw, "Table=%s\n", rt.table)
+		fmt.Fprintf(&nw, "Priority=%d\n", systemdPolicyPriority+1)
+		nw.WriteString("\n[RoutingPolicyRule]\n")
+		fmt.Fprintf(&nw, "Family=%s\n", fam)
+		nw.WriteString("Table=main\n")
+		nw.WriteString("SuppressPrefixLength=0\n")
+		fmt.Fprintf(&nw, "Priority=%d\n", systemdPolicyPriority)
+	}
+	return nd.String(), nw.String()
+}
+
+const (
+	// systemdPolicyTable 是 AllowedIPs 含默认路由且未指定 Table / FwMark 时使用的路由表与 fwmark（同 wg-quick）
+	systemdPolicyTable = 51820
+	// systemdPolicyPriority 是 suppress_prefixlength 规则的优先级，fwmark 规则紧随其后，均先于 main（32766）
+	systemdPolicyPriority = 32764
+)
+
+// systemdRoute 描述 [Route] 放进哪张表，以及是否需要 [RoutingPolicyRule]
+type systemdRoute struct {
+	off        bool     // Table=off：不加路由
+	table      string   // 路由表；空表示 main
+	fwmark     string   // [WireGuard] FirewallMark
+	policyFams []string // 需要策略路由的地址族（ipv4 / ipv6）
+	all        bool     // Table 为编号时全部路由进该表，不加策略规则（同 wg-quick）
+}
+
+// tableFor 返回前缀所在的路由表；策略路由只接管含默认路由的地址族
+func (r *systemdRoute) tableFor(p netip.Prefix) string {
+	if r.all {
+		return r.table
+	}
+	fam := "ipv4"
+	if p.IsValid() && p.Addr().Is6() && !p.Addr().Is4In6() {
+		fam = "ipv6"
+	}
+	for _, f := range r.policyFams {
+		if f == fam {
+			return r.table
+		}
+	}
+	return ""
+}
+
+// systemdRouting 按 wg-quick 的规则解释 Table / FwMark：
+// off 不加路由；编号表示全部路由进该表；auto（默认）时含 0.0.0.0/0 或 ::/0 的地址族改用 fwmark 策略路由
+func systemdRouting(f *File) *systemdRoute {
+	it := f.Interface
+	r := &systemdRoute{fwmark: strings.TrimSpace(it.FwMark)}
+	if strings.EqualFold(r.fwmark, "off") {
+		r.fwmark = ""
+	}
+	table := strings.ToLower(strings.TrimSpace(it.Table))
+	switch table {
+	case "off":
+		r.off = true
+		return r
+	case "", "auto", "main":
+	default:
+		r.table, r.all = table, true
+		return r
+	}
+
+	v4, v6 := false, false
+	for _, p := range f.Peers {
+		for _, a := range p.AllowedIPs {
+			pfx, err := netip.ParsePrefix(strings.TrimSpace(a))
+			if err != nil || pfx.Bits() != 0 {
+				continue
+			}
+			if pfx.Addr().Is4() {
+				v4 = true
+			} else {
+				v6 = true
+			}
+		}
+	}
+	if table == "main" || (!v4 && !v6) {
+		return r
+	}
+	if v4 {
+		r.policyFams = append(r.policyFams, "ipv4")
+	}
+	if v6 {
+		r.policyFams = append(r.policyFams, "ipv6")
+	}
+	r.table = fmt.Sprint(systemdPolicyTable)
+	if r.fwmark == "" {
+		r.fwmark = r.table
+	}
+	return r
+}
+
+/* -------------------- OpenWrt UCI -------------------- */
+
+// RenderOpenWrt 输出可追加到 /etc/config/network 的 UCI 片段
+func RenderOpenWrt(f *File, ifname string) string {
+	var b strings.Builder
+	it := f.Interface
+
+	fmt.Fprintf(&b, "config interface '%s'\n", ifname)
+	writeUCI(&b, "option", "proto", "wireguard")
+	writeUCI(&b, "option", "private_key", it.PrivateKey)
+	for _, a := range it.Address {
+		writeUCI(&b, "list", "addresses", a)
+	}
+	if it.ListenPort > 0 {
+		writeUCI(&b, "option", "listen_port", fmt.Sprint(it.ListenPort))
+	}
+	if it.MTU > 0 {
+		writeUCI(&b, "option", "mtu", fmt.Sprint(it.MTU))
+	}
+	for _, d := range it.DNS {
+		writeUCI(&b, "list", "dns", d)
+	}
+
+	for _, p := range f.Peers {
+		fmt.Fprintf(&b, "\nconfig wireguard_%s\n", ifname)
+		writeUCI(&b, "option", "description", p.Name)
+		writeUCI(&b, "option", "public_key", p.PublicKey)
+		writeUCI(&b, "option", "preshared_key", p.PresharedKey)
+		for _, a := range p.AllowedIPs {
+			writeUCI(&b, "list", "allowed_ips", a)
+		}
+		if host, port, err := net.SplitHostPort(p.Endpoint); err == nil {
+			writeUCI(&b, "option", "endpoint_host", host)
+			writeUCI(&b, "option", "endpoint_port", port)
+		}
+		if p.PersistentKeepalive > 0 {
+			writeUCI(&b, "option", "persistent_keepalive", fmt.Sprint(p.PersistentKeepalive))
+		}
+		writeUCI(&b, "option", "route_allowed_ips", "1")
+	}
+	return b.String()
+}
+
+func writeUCI(b *strings.Builder, kind, key, val string) {
+	if val = strings.TrimSpace(val); val != "" {
+		// UCI 值用单引号包裹，内部单引号按 shell 规则转义
+		fmt.Fprintf(b, "\t%s %s '%s'\n", kind, key, strings.ReplaceAll(val, "'", `'\''`))
+	}
+}
+
+/* -------------------- 工具 -------------------- */
+
+func writeIni(b *strings.Builder, key, val string) {
+	if val = strings.TrimSpace(val); val != "" {
+		fmt.Fprintf(b, "%s=%s\n", key, val)
+	}
+}
+
+// splitFamily 按地址族拆分地址/前缀列表；无法解析的项归入 IPv4
+func splitFamily(list []string) (v4, v6 []string) {
+	for _, s := range list {
+		host := s
+		if i := strings.IndexByte(s, '/'); i >= 0 {
+			host = s[:i]
+		}
+		if a, err := netip.ParseAddr(host); err == nil && a.Is6() && !a.Is4In6() {
+			v6 = append(v6, s)
+		} else {
+			v4 = append(v4, s)
+		}
+	}
+	return v4, v6
+}
@@ -0,0 +1,118 @@
+package wgconf
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRenderSystemdRouting(t *testing.T) {
+	tests := []struct {
+		name     string
+		conf     string
+		netdev   []string
+		network  []string
+		excluded []string
+	}{
+		{
+			name: "split tunnel stays in main",
+			conf: `[Interface]
+PrivateKey = k
+Address = 10.8.0.2/24
+
+[Peer]
+PublicKey = p
+AllowedIPs = 10.8.0.0/24, 192.168.10.0/24
+`,
+			network:  []string{"[Route]\nDestination=192.168.10.0/24\n"},
+			excluded: []string{"FirewallMark=", "Table=", "[RoutingPolicyRule]", "Destination=10.8.0.0/24"},
+		},
+		{
+			name: "default route goes through policy table",
+			conf: `[Interface]
+PrivateKey = k
+Address = 10.8.0.2/24
+
+[Peer]
+PublicKey = p
+AllowedIPs = 0.0.0.0/0, 192.168.10.0/24
+`,
+			netdev: []string{"FirewallMark=51820\n"},
+			network: []string{
+				"[Route]\nDestination=0.0.0.0/0\nTable=51820\n",
+				"[Route]\nDestination=192.168.10.0/24\nTable=51820\n",
+				"Family=ipv4\nFirewallMark=51820\nInvertRule=yes\nTable=51820\nPriority=32765\n",
+				"Family=ipv4\nTable=main\nSuppressPrefixLength=0\nPriority=32764\n",
+			},
+			excluded: []string{"Family=ipv6"},
+		},
+		{
+			name: "dual stack default keeps explicit fwmark",
+			conf: `[Interface]
+PrivateKey = k
+Address = 10.8.0.2/24, fd00::2/64
+FwMark = 0x1234
+
+[Peer]
+PublicKey = p
+AllowedIPs = 0.0.0.0/0, ::/0
+`,
+			netdev: []string{"FirewallMark=0x1234\n"},
+			network: []string{
+				"[Route]\nDestination=::/0\nTable=51820\n",
+				"Family=ipv6\nFirewallMark=0x1234\nInvertRule=yes\n",
+				"Family=ipv6\nTable=main\nSuppressPrefixLength=0\n",
+			},
+		},
+		{
+			name: "numeric table takes every route without rules",
+			conf: `[Interface]
+PrivateKey = k
+Address = 10.8.0.2/24
+Table = 100
+
+[Peer]
+PublicKey = p
+AllowedIPs = 0.0.0.0/0
+`,
+			network:  []string{"[Route]\nDestination=0.0.0.0/0\nTable=100\n"},
+			excluded: []string{"FirewallMark=", "[RoutingPolicyRule]"},
+		},
+		{
+			name: "table off adds no routes",
+			conf: `[Interface]
+PrivateKey = k
+Address = 10.8.0.2/24
+Table = off
+
+[Peer]
+PublicKey = p
+AllowedIPs = 0.0.0.0/0
+`,
+			excluded: []string{"[Route]", "[RoutingPolicyRule]", "FirewallMark="},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, err := Parse(strings.NewReader(tt.conf))
+			if err != nil {
+				t.Fatalf("parse: %v", err)
+			}
+			netdev, network := RenderSystemd(f, "wg0")
+			for _, s := range tt.netdev {
+				if !strings.Contains(netdev, s) {
+					t.Errorf("netdev missing %q:\n%s", s, netdev)
+				}
+			}
+			for _, s := range tt.network {
+				if !strings.Contains(network, s) {
+					t.Errorf("network missing %q:\n%s", s, network)
+				}
+			}
+			for _, s := range tt.excluded {
+				if strings.Contains(netdev+network, s) {
+					t.Errorf("unexpected %q:\n%s\n%s", s, netdev, network)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,64 @@
+package wgconf
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Render 输出 wg-quick 格式文本；空字段省略，Name 以 "# Name = xxx" 注释写出，可被 Parse 读回
+func Render(f *File) string {
+	var b strings.Builder
+	it := f.Interface
+
+	b.WriteString("[Interface]\n")
+	if f.Name != "" {
+		fmt.Fprintf(&b, "# Name = %s\n", f.Name)
+	}
+	writeKV(&b, "PrivateKey", it.PrivateKey)
+	writeKV(&b, "Address", strings.Join(it.Address, ", "))
+	if it.ListenPort > 0 {
+		fmt.Fprintf(&b, "ListenPort = %d\n", it.ListenPort)
+	}
+	if it.MTU > 0 {
+		fmt.Fprintf(&b, "MTU = %d\n", it.MTU)
+	}
+	writeKV(&b, "DNS", strings.Join(it.DNS, ", "))
+	writeKV(&b, "Table", it.Table)
+	writeKV(&b, "FwMark", it.FwMark)
+	for _, c := range it.PreUp {
+		writeKV(&b, "PreUp", c)
+	}
+	for _, c := range it.PostUp {
+		writeKV(&b, "PostUp", c)
+	}
+	for _, c := range it.PreDown {
+		writeKV(&b, "PreDown", c)
+	}
+	for _, c := range it.PostDown {
+		writeKV(&b, "PostDown", c)
+	}
+	if it.SaveConfig {
+		b.WriteString("SaveConfig = true\n")
+	}
+
+	for _, p := range f.Peers {
+		b.WriteString("\n[Peer]\n")
+		if p.Name != "" {
+			fmt.Fprintf(&b, "# Name = %s\n", p.Name)
+		}
+		writeKV(&b, "PublicKey", p.PublicKey)
+		writeKV(&b, "PresharedKey", p.PresharedKey)
+		writeKV(&b, "AllowedIPs", strings.Join(p.AllowedIPs, ", "))
+		writeKV(&b, "Endpoint", p.Endpoint)
+		if p.PersistentKeepalive > 0 {
+			fmt.Fprintf(&b, "PersistentKeepalive = %d\n", p.PersistentKeepalive)
+		}
+	}
+	return b.String()
+}
+
+func writeKV(b *strings.Builder, key, val string) {
+	if val = strings.TrimSpace(val); val != "" {
+		fmt.Fprintf(b, "%s = %s\n", key, val)
+	}
+}
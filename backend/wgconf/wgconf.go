@@ -0,0 +1,215 @@
+// Package wgconf 解析 wg-quick(8) 格式的配置文件
+package wgconf
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+type Interface struct {
+	PrivateKey string   `json:"private_key,omitempty"`
+	Address    []string `json:"address"`
+	ListenPort int      `json:"listen_port,omitempty"`
+	DNS        []string `json:"dns,omitempty"`
+	MTU        int      `json:"mtu,omitempty"`
+	Table      string   `json:"table,omitempty"`
+	FwMark     string   `json:"fwmark,omitempty"`
+	SaveConfig bool     `json:"save_config,omitempty"`
+	PreUp      []string `json:"pre_up,omitempty"`
+	PostUp     []string `json:"post_up,omitempty"`
+	PreDown    []string `json:"pre_down,omitempty"`
+	PostDown   []string `json:"post_down,omitempty"`
+}
+
+type Peer struct {
+	Name                string   `json:"name,omitempty"` // 来自 "# Name = xxx" 注释
+	PublicKey           string   `json:"public_key"`
+	PresharedKey        string   `json:"preshared_key,omitempty"`
+	AllowedIPs          []string `json:"allowed_ips"`
+	Endpoint            string   `json:"endpoint,omitempty"`
+	PersistentKeepalive int      `json:"persistent_keepalive,omitempty"`
+}
+
+type File struct {
+	Name      string    `json:"name,omitempty"` // 来自 [Interface] 内的 "# Name = xxx" 注释
+	Interface Interface `json:"interface"`
+	Peers     []Peer    `json:"peers"`
+	// 无法识别的键等非致命问题
+	Warnings []string `json:"warnings,omitempty"`
+}
+
+// 识别为名称的注释键（大小写不敏感）
+var nameKeys = map[string]bool{"name": true, "friendly_name": true, "friendlyname": true, "client": true}
+
+// parseNameComment 识别 "# Name = laptop" / "# Name: laptop" 等约定
+func parseNameComment(line string) (string, bool) {
+	body := strings.TrimSpace(strings.TrimLeft(line, "#;"))
+	i := strings.IndexAny(body, "=:")
+	if i <= 0 {
+		return "", false
+	}
+	key := strings.ToLower(strings.TrimSpace(body[:i]))
+	val := strings.TrimSpace(body[i+1:])
+	if !nameKeys[key] || val == "" {
+		return "", false
+	}
+	return val, true
+}
+
+func splitList(v string) []string {
+	var out []string
+	for _, x := range strings.Split(v, ",") {
+		if x = strings.TrimSpace(x); x != "" {
+			out = append(out, x)
+		}
+	}
+	return out
+}
+
+// Parse 解析配置；键名大小写不敏感，同名列表键（Address/AllowedIPs/DNS/PostUp 等）可重复出现
+func Parse(r io.Reader) (*File, error) {
+	f := &File{}
+	sc := bufio.NewScanner(r)
+	section := ""
+	var peer *Peer
+	pendingName := "" // 出现在 [Peer] 之前的名称注释，归属下一个段
+	lineNo := 0
+
+	for sc.Scan() {
+		lineNo++
+		line := strings.TrimSpace(sc.Text())
+		if line == "" {
+			continue
+		}
+		if strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";") {
+			if name, ok := parseNameComment(line); ok {
+				pendingName = name
+			}
+			continue
+		}
+
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			section = strings.ToLower(strings.TrimSpace(strings.Trim(line, "[]")))
+			switch section {
+			case "interface":
+				if pendingName != "" {
+					f.Name, pendingName = pendingName, ""
+				}
+			case "peer":
+				f.Peers = append(f.Peers, Peer{})
+				peer = &f.Peers[len(f.Peers)-1]
+				if pendingName != "" {
+					peer.Name, pendingName = pendingName, ""
+				}
+			default:
+				return nil, fmt.Errorf("line %d: unknown section [%s]", lineNo, strings.Trim(line, "[]"))
+			}
+			continue
+		}
+
+		// 段内键值之前出现的名称注释属于当前段
+		if pendingName != "" {
+			switch {
+			case section == "interface" && f.Name == "":
+				f.Name = pendingName
+			case section == "peer" && peer.Name == "":
+				peer.Name = pendingName
+			}
+			pendingName = ""
+		}
+
+		kv := strings.SplitN(line, "=", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("line %d: expected key = value", lineNo)
+		}
+		key := strings.ToLower(strings.TrimSpace(kv[0]))
+		val := strings.TrimSpace(kv[1])
+		// 去掉行尾注释（值里不会出现 #）
+		if i := strings.Index(val, "#"); i >= 0 {
+			val = strings.TrimSpace(val[:i])
+		}
+
+		var err error
+		switch section {
+		case "interface":
+			err = f.Interface.set(key, val)
+		case "peer":
+			err = peer.set(key, val)
+		default:
+			return nil, fmt.Errorf("line %d: %s outside of a section", lineNo, kv[0])
+		}
+		if err == errUnknownKey {
+			f.Warnings = append(f.Warnings, fmt.Sprintf("line %d: unknown key %s ignored", lineNo, strings.TrimSpace(kv[0])))
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %s: %v", lineNo, strings.TrimSpace(kv[0]), err)
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+var errUnknownKey = errors.New("unknown key")
+
+func (it *Interface) set(key, val string) error {
+	var err error
+	switch key {
+	case "privatekey":
+		it.PrivateKey = val
+	case "address":
+		it.Address = append(it.Address, splitList(val)...)
+	case "listenport":
+		it.ListenPort, err = strconv.Atoi(val)
+	case "dns":
+		it.DNS = append(it.DNS, splitList(val)...)
+	case "mtu":
+		it.MTU, err = strconv.Atoi(val)
+	case "table":
+		it.Table = val
+	case "fwmark":
+		it.FwMark = val
+	case "saveconfig":
+		it.SaveConfig, err = strconv.ParseBool(val)
+	case "preup":
+		it.PreUp = append(it.PreUp, val)
+	case "postup":
+		it.PostUp = append(it.PostUp, val)
+	case "predown":
+		it.PreDown = append(it.PreDown, val)
+	case "postdown":
+		it.PostDown = append(it.PostDown, val)
+	default:
+		return errUnknownKey
+	}
+	return err
+}
+
+func (p *Peer) set(key, val string) error {
+	var err error
+	switch key {
+	case "publickey":
+		p.PublicKey = val
+	case "presharedkey":
+		p.PresharedKey = val
+	case "allowedips":
+		p.AllowedIPs = append(p.AllowedIPs, splitList(val)...)
+	case "endpoint":
+		p.Endpoint = val
+	case "persistentkeepalive":
+		if strings.EqualFold(val, "off") {
+			p.PersistentKeepalive = 0
+			return nil
+		}
+		p.PersistentKeepalive, err = strconv.Atoi(val)
+	default:
+		return errUnknownKey
+	}
+	return err
+}
@@ -0,0 +1,154 @@
+package wgconf
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseRenderRoundTrip(t *testing.T) {
+	tests := []struct {
+		name string
+		conf string
+	}{
+		{
+			name: "server",
+			conf: `# Name = office
+[Interface]
+PrivateKey = cGFydHMgb2YgYSBrZXkgdGhhdCBpcyB0aGlydHkgdHc=
+Address = 10.8.0.1/24, fd00:8::1/64
+ListenPort = 51820
+MTU = 1420
+PostUp = iptables -A FORWARD -i %i -j ACCEPT
+PostUp = iptables -t nat -A POSTROUTING -o eth0 -j MASQUERADE
+PostDown = iptables -D FORWARD -i %i -j ACCEPT
+
+[Peer]
+# Name = laptop
+PublicKey = bGFwdG9wIHB1YmxpYyBrZXkgZm9yIHRlc3RpbmcgeHg=
+PresharedKey = cHNrIGZvciB0aGUgbGFwdG9wIHBlZXIgdGVzdGluZyE=
+AllowedIPs = 10.8.0.2/32, fd00:8::2/128
+
+[Peer]
+PublicKey = cGhvbmUgcHVibGljIGtleSBmb3IgdGVzdGluZyB4eHg=
+AllowedIPs = 10.8.0.3/32
+`,
+		},
+		{
+			name: "client",
+			conf: `[Interface]
+PrivateKey = Y2xpZW50IHByaXZhdGUga2V5IGZvciB0ZXN0aW5nIHg=
+Address = 10.8.0.2/32
+DNS = 1.1.1.1, 2606:4700:4700::1111
+Table = 1234
+FwMark = 0x10
+SaveConfig = true
+
+[Peer]
+PublicKey = c2VydmVyIHB1YmxpYyBrZXkgZm9yIHRlc3RpbmcgeHg=
+AllowedIPs = 0.0.0.0/0, ::/0
+Endpoint = vpn.example.com:51820
+PersistentKeepalive = 25
+`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			first, err := Parse(strings.NewReader(tt.conf))
+			if err != nil {
+				t.Fatalf("parse: %v", err)
+			}
+			if len(first.Warnings) != 0 {
+				t.Fatalf("warnings: %v", first.Warnings)
+			}
+			out := Render(first)
+			second, err := Parse(strings.NewReader(out))
+			if err != nil {
+				t.Fatalf("parse rendered: %v\n%s", err, out)
+			}
+			if !reflect.DeepEqual(first, second) {
+				t.Fatalf("round trip changed the file:\n got  %+v\n want %+v", second, first)
+			}
+			if again := Render(second); again != out {
+				t.Fatalf("render is not stable:\n%s\n---\n%s", out, again)
+			}
+		})
+	}
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name  string
+		conf  string
+		check func(t *testing.T, f *File)
+	}{
+		{
+			name: "keys are case-insensitive and lists repeat",
+			conf: "[interface]\naddress = 10.0.0.1/24\nADDRESS = fd00::1/64\n[PEER]\nallowedips = 10.0.0.2/32\nAllowedIPs = 10.0.0.3/32\n",
+			check: func(t *testing.T, f *File) {
+				if !reflect.DeepEqual(f.Interface.Address, []string{"10.0.0.1/24", "fd00::1/64"}) ||
+					!reflect.DeepEqual(f.Peers[0].AllowedIPs, []string{"10.0.0.2/32", "10.0.0.3/32"}) {
+					t.Fatalf("got %+v", f)
+				}
+			},
+		},
+		{
+			name: "name comments inside and before sections",
+			conf: "[Interface]\n# Client: home\nAddress = 10.0.0.1/24\n\n# friendly_name = phone\n[Peer]\nPublicKey = k\n",
+			check: func(t *testing.T, f *File) {
+				if f.Name != "home" || f.Peers[0].Name != "phone" {
+					t.Fatalf("names: %q, %q", f.Name, f.Peers[0].Name)
+				}
+			},
+		},
+		{
+			name: "keepalive off and trailing comment",
+			conf: "[Peer]\nPublicKey = k # laptop\nPersistentKeepalive = off\n",
+			check: func(t *testing.T, f *File) {
+				if f.Peers[0].PublicKey != "k" || f.Peers[0].PersistentKeepalive != 0 {
+					t.Fatalf("got %+v", f.Peers[0])
+				}
+			},
+		},
+		{
+			name: "unknown key is a warning",
+			conf: "[Interface]\nAddress = 10.0.0.1/24\nFoo = bar\n",
+			check: func(t *testing.T, f *File) {
+				if len(f.Warnings) != 1 || !strings.Contains(f.Warnings[0], "Foo") {
+					t.Fatalf("warnings: %v", f.Warnings)
+				}
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, err := Parse(strings.NewReader(tt.conf))
+			if err != nil {
+				t.Fatalf("parse: %v", err)
+			}
+			tt.check(t, f)
+		})
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		conf string
+		want string
+	}{
+		{"unknown section", "[Wat]\n", "unknown section"},
+		{"missing equals", "[Interface]\nAddress\n", "expected key = value"},
+		{"key outside section", "Address = 10.0.0.1/24\n", "outside of a section"},
+		{"bad port", "[Interface]\nListenPort = x\n", "ListenPort"},
+		{"bad keepalive", "[Peer]\nPersistentKeepalive = soon\n", "PersistentKeepalive"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse(strings.NewReader(tt.conf))
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("got %v, want error containing %q", err, tt.want)
+			}
+		})
+	}
+}